@@ -0,0 +1,253 @@
+// Package archiveはツリーのスナップショットをtarなどのアーカイブとして書き出す.
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kanon1343/fsegit/attr"
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+)
+
+var ErrUnknownFormat = errors.New("unknown archive format")
+
+// Formatはアーカイブの形式.
+type Format string
+
+const (
+	FormatTar   Format = "tar"
+	FormatTarGz Format = "tar.gz"
+	FormatZip   Format = "zip"
+)
+
+// ParseFormatは"tar", "tgz", "tar.gz", "zip"などの名前をFormatに変換する.
+func ParseFormat(name string) (Format, error) {
+	switch name {
+	case "tar":
+		return FormatTar, nil
+	case "tgz", "tar.gz":
+		return FormatTarGz, nil
+	case "zip":
+		return FormatZip, nil
+	}
+	return "", fmt.Errorf("%w : %s", ErrUnknownFormat, name)
+}
+
+// FormatFromFileNameは出力ファイル名の拡張子から形式を推測する. 推測できなければtarを返す.
+func FormatFromFileName(name string) Format {
+	for _, ext := range []string{".tar.gz", ".tgz"} {
+		if strings.HasSuffix(name, ext) {
+			return FormatTarGz
+		}
+	}
+	if strings.HasSuffix(name, ".zip") {
+		return FormatZip
+	}
+	return FormatTar
+}
+
+// gitのtar.umaskのデフォルト値(002)を適用したパーミッション.
+const (
+	fileMode       = 0664
+	executableMode = 0775
+	dirMode        = 0775
+)
+
+// Archiverはstore.Clientからツリーを読み出してアーカイブを作成する.
+type Archiver struct {
+	// Prefixはアーカイブ中の全てのパスの前に付ける文字列. gitと同じくそのまま付けるので、
+	// ディレクトリにまとめるときは"project/"のように"/"で終える.
+	Prefix string
+
+	client *store.Client
+	format Format
+}
+
+// NewArchiverはformat形式で書き出すArchiverを返す.
+func NewArchiver(client *store.Client, format Format) *Archiver {
+	return &Archiver{
+		client: client,
+		format: format,
+	}
+}
+
+// Writeはhashで指定したツリー(またはコミット)をwに書き出す.
+// コミットが指定された場合は、タイムスタンプとexport-substの展開にそのコミットを使う.
+// ファイルの内容は全体を読み込まずに、オブジェクトを展開しながら書き出す.
+func (a *Archiver) Write(w io.Writer, hash sha.SHA1) error {
+	obj, err := a.client.GetObject(hash)
+	if err != nil {
+		return err
+	}
+	var commit *object.Commit
+	mtime := time.Now()
+	if obj.Type == object.CommitObject {
+		if commit, err = object.NewCommit(obj); err != nil {
+			return err
+		}
+		mtime = commit.Committer.When
+	}
+
+	attributes, err := a.loadAttributes(hash)
+	if err != nil {
+		return err
+	}
+
+	var ew entryWriter
+	switch a.format {
+	case FormatZip:
+		ew, err = newZipWriter(w, commit, mtime)
+	case FormatTarGz:
+		// 出力を再現可能にするため、gzipヘッダには時刻やファイル名を書かない.
+		zw := gzip.NewWriter(w)
+		if ew, err = newTarWriter(zw, commit, mtime); err == nil {
+			ew = &gzipTarWriter{entryWriter: ew, zw: zw}
+		}
+	default:
+		ew, err = newTarWriter(w, commit, mtime)
+	}
+	if err != nil {
+		return err
+	}
+	if err := a.writeEntries(ew, hash, commit, attributes); err != nil {
+		return err
+	}
+	return ew.Close()
+}
+
+// entryWriterはアーカイブの形式ごとにエントリを書き出す. 名前にはPrefixが付いている.
+type entryWriter interface {
+	writeDir(name string) error
+	writeSymlink(name, target string) error
+	writeFile(name string, perm int64, size int64, r io.Reader) error
+	Close() error
+}
+
+// writeEntriesはツリーのファイルをパスの順にewに書き出す. ディレクトリはその中の最初のエントリの前に書く.
+func (a *Archiver) writeEntries(ew entryWriter, hash sha.SHA1, commit *object.Commit, attributes *attr.Checker) error {
+	writtenDirs := map[string]struct{}{}
+	writeDir := func(dir string) error {
+		if _, ok := writtenDirs[dir]; ok {
+			return nil
+		}
+		writtenDirs[dir] = struct{}{}
+		return ew.writeDir(dir + "/")
+	}
+
+	filter := exportFilter{attributes: attributes}
+	return a.client.WalkTree(hash, filter, func(name string, entry object.TreeEntry) error {
+		fullName := a.Prefix + name
+		for _, dir := range parentDirs(fullName) {
+			if err := writeDir(dir); err != nil {
+				return err
+			}
+		}
+
+		switch entry.Mode {
+		case object.ModeGitlink:
+			// サブモジュールは中身を持たない空ディレクトリとして書き出す.
+			return writeDir(fullName)
+		case object.ModeSymlink:
+			obj, err := a.client.GetObject(entry.Hash)
+			if err != nil {
+				return err
+			}
+			return ew.writeSymlink(fullName, string(obj.Data))
+		}
+
+		perm := int64(fileMode)
+		if entry.Mode == object.ModeExecutable {
+			perm = executableMode
+		}
+		if commit != nil && attributes.Get(name, false, "export-subst").IsSet() {
+			obj, err := a.client.GetObject(entry.Hash)
+			if err != nil {
+				return err
+			}
+			data := expandSubst(obj.Data, commit)
+			return ew.writeFile(fullName, perm, int64(len(data)), bytes.NewReader(data))
+		}
+		r, err := a.client.OpenObject(entry.Hash)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		return ew.writeFile(fullName, perm, r.Size, r)
+	})
+}
+
+// loadAttributesはツリー中の全ての.gitattributesを浅い階層から順に読み込む.
+func (a *Archiver) loadAttributes(hash sha.SHA1) (*attr.Checker, error) {
+	type attributesFile struct {
+		dir  string
+		data []byte
+	}
+	var files []attributesFile
+	if err := a.client.WalkTree(hash, nil, func(name string, entry object.TreeEntry) error {
+		if path.Base(name) != ".gitattributes" || entry.Mode.ObjectType() != object.BlobObject {
+			return nil
+		}
+		obj, err := a.client.GetObject(entry.Hash)
+		if err != nil {
+			return err
+		}
+		dir := path.Dir(name)
+		if dir == "." {
+			dir = ""
+		}
+		files = append(files, attributesFile{dir: dir, data: obj.Data})
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return depth(files[i].dir) < depth(files[j].dir)
+	})
+
+	checker := attr.NewChecker()
+	for _, f := range files {
+		checker.Add(f.dir, f.data)
+	}
+	return checker, nil
+}
+
+// exportFilterはexport-ignore属性の付いたパスをWalkTreeから除外する.
+type exportFilter struct {
+	attributes *attr.Checker
+}
+
+func (f exportFilter) Match(name string) bool {
+	return !f.attributes.Get(name, false, "export-ignore").IsSet()
+}
+
+func (f exportFilter) MatchDir(dir string) bool {
+	return !f.attributes.Get(dir, true, "export-ignore").IsSet()
+}
+
+// depthはディレクトリの階層の深さを返す. ルートは0.
+func depth(dir string) int {
+	if dir == "" {
+		return 0
+	}
+	return strings.Count(dir, "/") + 1
+}
+
+// parentDirsは"a/b/c"に対して["a", "a/b"]を返す.
+func parentDirs(name string) []string {
+	var dirs []string
+	for i := 0; i < len(name); i++ {
+		if name[i] == '/' {
+			dirs = append(dirs, name[:i])
+		}
+	}
+	return dirs
+}
@@ -0,0 +1,191 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+)
+
+// newTestCommitは.gitattributesでexport-ignoreとexport-substを指定したコミットを作る.
+func newTestCommit(t *testing.T) (*store.Client, sha.SHA1) {
+	t.Helper()
+	client, _, err := store.Init(t.TempDir(), store.InitOptions{InitialBranch: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := []struct {
+		path    string
+		mode    object.FileMode
+		content string
+	}{
+		{".gitattributes", object.ModeBlob, "version.txt export-subst\nsecret/ export-ignore\n*.log export-ignore\n"},
+		{"a.txt", object.ModeBlob, "a\n"},
+		{"bin/run", object.ModeExecutable, "#!/bin/sh\n"},
+		{"dir/app.log", object.ModeBlob, "log\n"},
+		{"dir/b.txt", object.ModeBlob, "b $Format:%H$\n"},
+		{"link", object.ModeSymlink, "a.txt"},
+		{"secret/key", object.ModeBlob, "key\n"},
+		{"version.txt", object.ModeBlob, "$Format:%h %an <%ae> %s %%$ $Format:%x$ $Format:\n"},
+	}
+	var entries []store.PathEntry
+	for _, f := range files {
+		blob, err := client.StoreRaw(object.BlobObject, []byte(f.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, store.PathEntry{Path: f.path, Mode: f.mode, Hash: blob})
+	}
+	tree, err := client.BuildTree(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := fmt.Sprintf("tree %s\nauthor fsegit <fsegit@example.com> 1672531200 +0900\ncommitter fsegit <fsegit@example.com> 1672531200 +0900\n\nrelease\n\nbody\n", tree)
+	hash, err := client.StoreRaw(object.CommitObject, []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, hash
+}
+
+type tarEntry struct {
+	typeflag byte
+	mode     int64
+	content  string
+}
+
+func readTar(t *testing.T, r io.Reader) (map[string]tarEntry, []string, string) {
+	t.Helper()
+	entries := map[string]tarEntry{}
+	var names []string
+	var comment string
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			comment = header.PAXRecords["comment"]
+			continue
+		}
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Typeflag == tar.TypeSymlink {
+			content = []byte(header.Linkname)
+		}
+		names = append(names, header.Name)
+		entries[header.Name] = tarEntry{typeflag: header.Typeflag, mode: header.Mode, content: string(content)}
+	}
+	return entries, names, comment
+}
+
+// tarとtgzのどちらでも、export-ignoreのパスを除き、export-substを展開して書き出すか
+func TestArchiver_Write(t *testing.T) {
+	client, hash := newTestCommit(t)
+	short := hash.String()[:7]
+	want := map[string]tarEntry{
+		"p/":               {tar.TypeDir, dirMode, ""},
+		"p/.gitattributes": {tar.TypeReg, fileMode, "version.txt export-subst\nsecret/ export-ignore\n*.log export-ignore\n"},
+		"p/a.txt":          {tar.TypeReg, fileMode, "a\n"},
+		"p/bin/":           {tar.TypeDir, dirMode, ""},
+		"p/bin/run":        {tar.TypeReg, executableMode, "#!/bin/sh\n"},
+		"p/dir/":           {tar.TypeDir, dirMode, ""},
+		// export-substのないファイルは展開しない.
+		"p/dir/b.txt": {tar.TypeReg, fileMode, "b $Format:%H$\n"},
+		"p/link":      {tar.TypeSymlink, 0777, "a.txt"},
+		// 未知のプレースホルダと閉じていない"$Format:"はそのまま残す.
+		"p/version.txt": {tar.TypeReg, fileMode, short + " fsegit <fsegit@example.com> release % %x $Format:\n"},
+	}
+
+	for _, format := range []Format{FormatTar, FormatTarGz} {
+		t.Run(string(format), func(t *testing.T) {
+			a := NewArchiver(client, format)
+			a.Prefix = "p/"
+			var buf bytes.Buffer
+			if err := a.Write(&buf, hash); err != nil {
+				t.Fatal(err)
+			}
+			var r io.Reader = &buf
+			if format == FormatTarGz {
+				zr, err := gzip.NewReader(&buf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				r = zr
+			}
+			got, names, comment := readTar(t, r)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("entries = %+v, want %+v", got, want)
+			}
+			if !sort.StringsAreSorted(names) {
+				t.Errorf("entries are not in path order: %v", names)
+			}
+			if comment != hash.String() {
+				t.Errorf("pax comment = %q, want %s", comment, hash)
+			}
+		})
+	}
+}
+
+// ツリーを指定した場合はコミットがないので、export-substを展開しないか
+func TestArchiver_WriteTree(t *testing.T) {
+	client, hash := newTestCommit(t)
+	commit, err := client.GetCommit(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := NewArchiver(client, FormatTar).Write(&buf, commit.Tree); err != nil {
+		t.Fatal(err)
+	}
+	got, _, comment := readTar(t, &buf)
+	if content := got["version.txt"].content; content != "$Format:%h %an <%ae> %s %%$ $Format:%x$ $Format:\n" {
+		t.Errorf("version.txt = %q", content)
+	}
+	if _, ok := got["secret/key"]; ok {
+		t.Error("secret/key is not ignored")
+	}
+	if comment != "" {
+		t.Errorf("pax comment = %q, want none", comment)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		want Format
+	}{
+		{"tar", FormatTar},
+		{"tgz", FormatTarGz},
+		{"tar.gz", FormatTarGz},
+		{"zip", FormatZip},
+	}
+	for _, test := range tests {
+		if got, err := ParseFormat(test.name); err != nil || got != test.want {
+			t.Errorf("ParseFormat(%q) = %q, %v, want %q", test.name, got, err, test.want)
+		}
+	}
+	if _, err := ParseFormat("rar"); err == nil {
+		t.Error("ParseFormat(\"rar\") error = nil")
+	}
+	for name, want := range map[string]Format{"a.tar.gz": FormatTarGz, "a.tgz": FormatTarGz, "a.zip": FormatZip, "a.tar": FormatTar, "a": FormatTar} {
+		if got := FormatFromFileName(name); got != want {
+			t.Errorf("FormatFromFileName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
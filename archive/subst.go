@@ -0,0 +1,92 @@
+package archive
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/kanon1343/fsegit/object"
+)
+
+// expandSubstはexport-subst属性の付いたファイル中の"$Format:...$"をコミットの情報で置き換える.
+func expandSubst(data []byte, commit *object.Commit) []byte {
+	const open = "$Format:"
+	var buf bytes.Buffer
+	for {
+		start := bytes.Index(data, []byte(open))
+		if start < 0 {
+			break
+		}
+		end := bytes.IndexByte(data[start+len(open):], '$')
+		if end < 0 {
+			break
+		}
+		end += start + len(open)
+		buf.Write(data[:start])
+		buf.WriteString(formatCommit(string(data[start+len(open):end]), commit))
+		data = data[end+1:]
+	}
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+// formatCommitはgit logの--formatと同じプレースホルダを展開する.
+func formatCommit(format string, commit *object.Commit) string {
+	var sb strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 >= len(format) {
+			sb.WriteByte(format[i])
+			continue
+		}
+		rest := format[i+1:]
+		switch {
+		case strings.HasPrefix(rest, "H"):
+			sb.WriteString(commit.Hash.String())
+		case strings.HasPrefix(rest, "h"):
+			sb.WriteString(commit.Hash.String()[:7])
+		case strings.HasPrefix(rest, "T"):
+			sb.WriteString(commit.Tree.String())
+		case strings.HasPrefix(rest, "t"):
+			sb.WriteString(commit.Tree.String()[:7])
+		case strings.HasPrefix(rest, "P"), strings.HasPrefix(rest, "p"):
+			parents := make([]string, 0, len(commit.Parents))
+			for _, parent := range commit.Parents {
+				if rest[0] == 'P' {
+					parents = append(parents, parent.String())
+				} else {
+					parents = append(parents, parent.String()[:7])
+				}
+			}
+			sb.WriteString(strings.Join(parents, " "))
+		case strings.HasPrefix(rest, "an"):
+			sb.WriteString(commit.Author.Name)
+			i++
+		case strings.HasPrefix(rest, "ae"):
+			sb.WriteString(commit.Author.Email)
+			i++
+		case strings.HasPrefix(rest, "ad"):
+			sb.WriteString(commit.Author.When.Format("Mon Jan 2 15:04:05 2006 -0700"))
+			i++
+		case strings.HasPrefix(rest, "cn"):
+			sb.WriteString(commit.Committer.Name)
+			i++
+		case strings.HasPrefix(rest, "ce"):
+			sb.WriteString(commit.Committer.Email)
+			i++
+		case strings.HasPrefix(rest, "cd"):
+			sb.WriteString(commit.Committer.When.Format("Mon Jan 2 15:04:05 2006 -0700"))
+			i++
+		case strings.HasPrefix(rest, "s"):
+			sb.WriteString(strings.SplitN(strings.TrimLeft(commit.Message, "\n"), "\n", 2)[0])
+		case strings.HasPrefix(rest, "n"):
+			sb.WriteByte('\n')
+		case strings.HasPrefix(rest, "%"):
+			sb.WriteByte('%')
+		default:
+			// 未知のプレースホルダはそのまま残す.
+			sb.WriteByte('%')
+			continue
+		}
+		i++
+	}
+	return sb.String()
+}
@@ -0,0 +1,79 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"time"
+
+	"github.com/kanon1343/fsegit/object"
+)
+
+// tarWriterはtar形式でエントリを書き出す.
+type tarWriter struct {
+	tw    *tar.Writer
+	mtime time.Time
+}
+
+func newTarWriter(w io.Writer, commit *object.Commit, mtime time.Time) (*tarWriter, error) {
+	tw := tar.NewWriter(w)
+	if commit != nil {
+		// git archiveと同様、コミットIDをpaxのグローバルヘッダに記録する.
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag:   tar.TypeXGlobalHeader,
+			PAXRecords: map[string]string{"comment": commit.Hash.String()},
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return &tarWriter{tw: tw, mtime: mtime}, nil
+}
+
+func (t *tarWriter) writeDir(name string) error {
+	return t.tw.WriteHeader(newHeader(tar.TypeDir, name, dirMode, 0, t.mtime))
+}
+
+func (t *tarWriter) writeSymlink(name, target string) error {
+	header := newHeader(tar.TypeSymlink, name, 0777, 0, t.mtime)
+	header.Linkname = target
+	return t.tw.WriteHeader(header)
+}
+
+func (t *tarWriter) writeFile(name string, perm int64, size int64, r io.Reader) error {
+	if err := t.tw.WriteHeader(newHeader(tar.TypeReg, name, perm, size, t.mtime)); err != nil {
+		return err
+	}
+	_, err := io.Copy(t.tw, r)
+	return err
+}
+
+func (t *tarWriter) Close() error {
+	return t.tw.Close()
+}
+
+// gzipTarWriterはtarを閉じた後にgzipも閉じる.
+type gzipTarWriter struct {
+	entryWriter
+	zw *gzip.Writer
+}
+
+func (g *gzipTarWriter) Close() error {
+	if err := g.entryWriter.Close(); err != nil {
+		return err
+	}
+	return g.zw.Close()
+}
+
+// newHeaderは所有者やタイムスタンプを固定したtarヘッダを返す.
+func newHeader(typeflag byte, name string, mode, size int64, mtime time.Time) *tar.Header {
+	return &tar.Header{
+		Typeflag: typeflag,
+		Name:     name,
+		Mode:     mode,
+		Size:     size,
+		ModTime:  mtime,
+		Uname:    "root",
+		Gname:    "root",
+		Format:   tar.FormatPAX,
+	}
+}
@@ -0,0 +1,61 @@
+package archive
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"time"
+
+	"github.com/kanon1343/fsegit/object"
+)
+
+// zipWriterはzip形式でエントリを書き出す.
+type zipWriter struct {
+	zw    *zip.Writer
+	mtime time.Time
+}
+
+func newZipWriter(w io.Writer, commit *object.Commit, mtime time.Time) (*zipWriter, error) {
+	zw := zip.NewWriter(w)
+	if commit != nil {
+		// git archiveと同様、コミットIDをzipのコメントに記録する.
+		if err := zw.SetComment(commit.Hash.String()); err != nil {
+			return nil, err
+		}
+	}
+	return &zipWriter{zw: zw, mtime: mtime}, nil
+}
+
+// createはUnixのパーミッションとタイムスタンプを持つエントリを作る.
+func (z *zipWriter) create(name string, mode os.FileMode, method uint16) (io.Writer, error) {
+	header := &zip.FileHeader{Name: name, Method: method, Modified: z.mtime}
+	header.SetMode(mode)
+	return z.zw.CreateHeader(header)
+}
+
+func (z *zipWriter) writeDir(name string) error {
+	_, err := z.create(name, os.ModeDir|dirMode, zip.Store)
+	return err
+}
+
+func (z *zipWriter) writeSymlink(name, target string) error {
+	w, err := z.create(name, os.ModeSymlink|0777, zip.Store)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, target)
+	return err
+}
+
+func (z *zipWriter) writeFile(name string, perm int64, size int64, r io.Reader) error {
+	w, err := z.create(name, os.FileMode(perm), zip.Deflate)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+func (z *zipWriter) Close() error {
+	return z.zw.Close()
+}
@@ -0,0 +1,149 @@
+// Package attrは.gitattributesの読み込みと、パスに対する属性の判定を行う.
+package attr
+
+import (
+	"bufio"
+	"bytes"
+	"path"
+	"strings"
+
+	"github.com/kanon1343/fsegit/wildmatch"
+)
+
+// Stateは属性の状態を表す.
+type State int
+
+const (
+	Unspecified State = iota
+	Set
+	Unset
+	Value
+)
+
+// Attrはあるパスに対する1つの属性の値.
+type Attr struct {
+	State State
+	Value string
+}
+
+// IsSetは属性がSetの場合にtrueを返す.
+func (a Attr) IsSet() bool {
+	return a.State == Set
+}
+
+// IsUnsetは属性が"-attr"で明示的に外されている場合にtrueを返す.
+func (a Attr) IsUnset() bool {
+	return a.State == Unset
+}
+
+type assignment struct {
+	name string
+	attr Attr
+}
+
+type rule struct {
+	// dirは.gitattributesが置かれたディレクトリ.
+	dir     string
+	pattern string
+	// basenameOnlyは"/"を含まないパターンで、ファイル名だけに照合する.
+	basenameOnly bool
+	dirOnly      bool
+	assignments  []assignment
+}
+
+// gitに組み込みのマクロ属性.
+var macros = map[string][]assignment{
+	"binary": {
+		{"diff", Attr{State: Unset}},
+		{"merge", Attr{State: Unset}},
+		{"text", Attr{State: Unset}},
+	},
+}
+
+// Checkerは複数の.gitattributesの規則をまとめて保持する.
+type Checker struct {
+	rules []rule
+}
+
+// NewCheckerは空のCheckerを返す.
+func NewChecker() *Checker {
+	return &Checker{}
+}
+
+// Addはdirに置かれた.gitattributesの内容を追加する. 後から追加した規則ほど優先される.
+func (c *Checker) Add(dir string, data []byte) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		pattern := fields[0]
+		// マクロ定義は無視する.
+		if strings.HasPrefix(pattern, "[attr]") {
+			continue
+		}
+
+		r := rule{dir: strings.Trim(dir, "/")}
+		if strings.HasSuffix(pattern, "/") {
+			r.dirOnly = true
+			pattern = strings.TrimSuffix(pattern, "/")
+		}
+		r.basenameOnly = !strings.Contains(pattern, "/")
+		r.pattern = strings.TrimPrefix(pattern, "/")
+		for _, field := range fields[1:] {
+			r.assignments = append(r.assignments, parseAssignment(field)...)
+		}
+		c.rules = append(c.rules, r)
+	}
+}
+
+func parseAssignment(field string) []assignment {
+	switch {
+	case strings.HasPrefix(field, "-"):
+		return []assignment{{field[1:], Attr{State: Unset}}}
+	case strings.HasPrefix(field, "!"):
+		return []assignment{{field[1:], Attr{State: Unspecified}}}
+	case strings.Contains(field, "="):
+		kv := strings.SplitN(field, "=", 2)
+		return []assignment{{kv[0], Attr{State: Value, Value: kv[1]}}}
+	}
+	if expanded, ok := macros[field]; ok {
+		return append([]assignment{{field, Attr{State: Set}}}, expanded...)
+	}
+	return []assignment{{field, Attr{State: Set}}}
+}
+
+// Getはnameで指定したパスの属性attrNameの値を返す. isDirはnameがディレクトリかどうか.
+func (c *Checker) Get(name string, isDir bool, attrName string) Attr {
+	result := Attr{}
+	for _, r := range c.rules {
+		if !r.match(name, isDir) {
+			continue
+		}
+		for _, a := range r.assignments {
+			if a.name == attrName {
+				result = a.attr
+			}
+		}
+	}
+	return result
+}
+
+func (r rule) match(name string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	relative := name
+	if r.dir != "" {
+		if !strings.HasPrefix(name, r.dir+"/") {
+			return false
+		}
+		relative = name[len(r.dir)+1:]
+	}
+	if r.basenameOnly {
+		return wildmatch.Match(r.pattern, path.Base(relative), 0)
+	}
+	return wildmatch.Match(r.pattern, relative, wildmatch.Pathname)
+}
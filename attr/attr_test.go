@@ -0,0 +1,55 @@
+package attr
+
+import "testing"
+
+func TestChecker_Get(t *testing.T) {
+	checker := NewChecker()
+	checker.Add("", []byte(`# comment
+[attr]custom export-ignore
+*.txt text eol=lf
+*.bin binary
+/root.md export-ignore
+build/ export-ignore
+docs/*.md -text
+vendor/** export-ignore
+keep.txt !text
+`))
+	// サブディレクトリの規則は、そのディレクトリの中のパスにだけ効き、上書きできる.
+	checker.Add("sub", []byte("*.txt -text\n/local.md export-ignore\n"))
+
+	tests := []struct {
+		name  string
+		isDir bool
+		attr  string
+		want  Attr
+	}{
+		{"a.txt", false, "text", Attr{State: Set}},
+		{"dir/a.txt", false, "text", Attr{State: Set}},
+		{"a.txt", false, "eol", Attr{State: Value, Value: "lf"}},
+		{"a.go", false, "text", Attr{}},
+		{"keep.txt", false, "text", Attr{}},
+		{"x.bin", false, "binary", Attr{State: Set}},
+		{"x.bin", false, "diff", Attr{State: Unset}},
+		{"x.bin", false, "text", Attr{State: Unset}},
+		{"root.md", false, "export-ignore", Attr{State: Set}},
+		{"dir/root.md", false, "export-ignore", Attr{}},
+		{"build", true, "export-ignore", Attr{State: Set}},
+		{"build", false, "export-ignore", Attr{}},
+		{"dir/build", true, "export-ignore", Attr{State: Set}},
+		{"docs/a.md", false, "text", Attr{State: Unset}},
+		{"docs/dir/a.md", false, "text", Attr{}},
+		{"vendor/a/b.go", false, "export-ignore", Attr{State: Set}},
+		{"custom", false, "export-ignore", Attr{}},
+		{"sub/a.txt", false, "text", Attr{State: Unset}},
+		{"sub/a.txt", false, "eol", Attr{State: Value, Value: "lf"}},
+		{"sub/local.md", false, "export-ignore", Attr{State: Set}},
+		{"sub/dir/local.md", false, "export-ignore", Attr{}},
+		{"local.md", false, "export-ignore", Attr{}},
+		{"subway/a.txt", false, "text", Attr{State: Set}},
+	}
+	for _, test := range tests {
+		if got := checker.Get(test.name, test.isDir, test.attr); got != test.want {
+			t.Errorf("Get(%q, %v, %q) = %+v, want %+v", test.name, test.isDir, test.attr, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+// Package bisectは悪いコミットと良いコミットの間を二分探索して、最初の悪いコミットを探す.
+// 途中経過はgitと同じく<GitDir>/BISECT_*のファイルに保存する.
+package bisect
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+	"github.com/kanon1343/fsegit/util"
+)
+
+var (
+	ErrNotBisecting  = errors.New("not bisecting")
+	ErrInvalidState  = errors.New("invalid bisect state")
+	ErrBadBeforeGood = errors.New("the bad commit is an ancestor of a good commit")
+)
+
+// 途中経過のファイルの名前. 管理ディレクトリの直下に置く.
+const (
+	// startFileは開始前のHEAD. ブランチにいればその名前、切り離されていればコミットのハッシュ.
+	startFile = "BISECT_START"
+	// badFileは悪いと分かっているコミットのうち最も古いもの.
+	badFile = "BISECT_BAD"
+	// goodFileは良いと分かっているコミット. 1行に1つ.
+	goodFile = "BISECT_GOOD"
+)
+
+var stateFiles = []string{startFile, badFile, goodFile}
+
+// Stateは保存された途中経過.
+type State struct {
+	client *store.Client
+	// Startは開始前のHEAD. ブランチにいればその名前(main)、切り離されていればコミットのハッシュ.
+	// resetで戻す先になる.
+	Start string
+	// Badは悪いと分かっているコミット. まだなければnil.
+	Bad sha.SHA1
+	// Goodは良いと分かっているコミット.
+	Good []sha.SHA1
+}
+
+// Stepは次に調べるコミット.
+type Step struct {
+	// Commitは次に調べるコミット. Foundならそれが最初の悪いコミット.
+	Commit sha.SHA1
+	Found  bool
+	// RemainingはCommitを調べた後に残る候補の数の目安、Stepsは残りの手順の数の見積もり. gitと同じ計算をする.
+	Remaining int
+	Steps     int
+}
+
+// InProgressはbisectの途中かを返す.
+func InProgress(client *store.Client) bool {
+	_, err := os.Stat(filepath.Join(client.GitDir(), startFile))
+	return err == nil
+}
+
+// Startは新しくbisectを始めて途中経過を保存する. 既にbisectの途中なら、良いコミットと悪いコミットを忘れて
+// 始め直す. このときresetで戻す先は最初に始めたときのHEADのままにする.
+func Start(client *store.Client) (*State, error) {
+	if InProgress(client) {
+		s, err := Load(client)
+		if err != nil {
+			return nil, err
+		}
+		s.Bad, s.Good = nil, nil
+		return s, s.save()
+	}
+	head, err := client.ReadHead()
+	if err != nil {
+		return nil, err
+	}
+	if head.Unborn() {
+		return nil, fmt.Errorf("%w : %s", store.ErrUnbornBranch, head.ShortBranch())
+	}
+	s := &State{client: client, Start: head.ShortBranch()}
+	if head.Detached() {
+		s.Start = head.Hash.String()
+	}
+	if err := util.WriteFileAtomic(filepath.Join(client.GitDir(), startFile), []byte(s.Start+"\n"), 0644); err != nil {
+		return nil, err
+	}
+	return s, s.save()
+}
+
+// Loadは保存された途中経過を読み込む. bisectの途中でなければErrNotBisectingを返す.
+func Load(client *store.Client) (*State, error) {
+	dir := client.GitDir()
+	start, err := ioutil.ReadFile(filepath.Join(dir, startFile))
+	if os.IsNotExist(err) {
+		return nil, ErrNotBisecting
+	}
+	if err != nil {
+		return nil, err
+	}
+	s := &State{client: client, Start: strings.TrimSpace(string(start))}
+	if s.Start == "" {
+		return nil, fmt.Errorf("%w : %s", ErrInvalidState, startFile)
+	}
+	bad, err := readHashes(filepath.Join(dir, badFile))
+	if err != nil {
+		return nil, err
+	}
+	if len(bad) > 0 {
+		s.Bad = bad[0]
+	}
+	if s.Good, err = readHashes(filepath.Join(dir, goodFile)); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// MarkBadはhashのコミットを悪いコミットとして記録する. 悪いコミットは1つだけ覚えておけばよいので前のものは忘れる.
+func (s *State) MarkBad(hash sha.SHA1) error {
+	commit, err := s.client.PeelToCommit(hash)
+	if err != nil {
+		return err
+	}
+	s.Bad = commit
+	return s.save()
+}
+
+// MarkGoodはhashのコミットを良いコミットとして記録する.
+func (s *State) MarkGood(hash sha.SHA1) error {
+	commit, err := s.client.PeelToCommit(hash)
+	if err != nil {
+		return err
+	}
+	for _, good := range s.Good {
+		if bytes.Equal(good, commit) {
+			return nil
+		}
+	}
+	s.Good = append(s.Good, commit)
+	return s.save()
+}
+
+// Readyは次のコミットを選べるだけ、悪いコミットと良いコミットが分かっているかを返す.
+func (s *State) Ready() bool {
+	return s.Bad != nil && len(s.Good) > 0
+}
+
+// Nextは次に調べるコミットを選ぶ. 候補は悪いコミットから辿れて、どの良いコミットからも辿れないコミットで、
+// 候補が1つだけならそれが最初の悪いコミットになる. それ以外では、gitと同じく候補のうちそこから辿れる候補の数が
+// 全体の半分に最も近いものを選ぶ. 悪いコミットが良いコミットの祖先(か同じコミット)ならErrBadBeforeGoodを返す.
+func (s *State) Next() (*Step, error) {
+	for _, good := range s.Good {
+		ok, err := s.client.IsAncestor(s.Bad, good)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return nil, fmt.Errorf("%w : %s", ErrBadBeforeGood, good)
+		}
+	}
+	entries, err := s.client.RevList(store.RevListOptions{Include: []sha.SHA1{s.Bad}, Exclude: s.Good})
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 1 {
+		return &Step{Commit: entries[0].Hash, Found: true}, nil
+	}
+
+	// 候補の中での親を求めておき、それぞれの候補から辿れる候補の数(自身を含む)を数える.
+	parents := make(map[string][]sha.SHA1, len(entries))
+	for _, entry := range entries {
+		parents[string(entry.Hash)] = nil
+	}
+	for _, entry := range entries {
+		commit, err := s.client.GetCommit(entry.Hash)
+		if err != nil {
+			return nil, err
+		}
+		for _, parent := range commit.Parents {
+			if _, ok := parents[string(parent)]; ok {
+				parents[string(entry.Hash)] = append(parents[string(entry.Hash)], parent)
+			}
+		}
+	}
+	all := len(entries)
+	weights := make([]int, all)
+	for i, entry := range entries {
+		weights[i] = reachable(parents, entry.Hash)
+	}
+	step := func(i int) *Step {
+		return &Step{Commit: entries[i].Hash, Remaining: all - weights[i] - 1, Steps: estimateSteps(all)}
+	}
+	halfway := func(i int) bool {
+		diff := 2*weights[i] - all
+		return -1 <= diff && diff <= 1
+	}
+
+	// ちょうど半分のコミットが複数あれば、gitと同じものを選ぶ. gitは先にマージコミットを、それから親が1つの
+	// コミットを良いコミットに近い方から、見つけた順に調べ、最初にちょうど半分になったものを選ぶ.
+	for i, entry := range entries {
+		if len(parents[string(entry.Hash)]) > 1 && halfway(i) {
+			return step(i), nil
+		}
+	}
+	counted := make(map[string]bool, all)
+	for _, entry := range entries {
+		if len(parents[string(entry.Hash)]) != 1 {
+			counted[string(entry.Hash)] = true
+		}
+	}
+	for len(counted) < all {
+		for i, entry := range entries {
+			ps := parents[string(entry.Hash)]
+			if counted[string(entry.Hash)] || !counted[string(ps[0])] {
+				continue
+			}
+			counted[string(entry.Hash)] = true
+			if halfway(i) {
+				return step(i), nil
+			}
+		}
+	}
+
+	// ちょうど半分のものがなければ、最も半分に近いもののうちコミット日時の新しいものを選ぶ.
+	best, bestDistance := 0, -1
+	for i := range entries {
+		distance := weights[i]
+		if all-weights[i] < distance {
+			distance = all - weights[i]
+		}
+		if distance > bestDistance {
+			best, bestDistance = i, distance
+		}
+	}
+	return step(best), nil
+}
+
+// Clearは途中経過を削除する.
+func (s *State) Clear() error {
+	for _, name := range stateFiles {
+		if err := os.Remove(filepath.Join(s.client.GitDir(), name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *State) save() error {
+	dir := s.client.GitDir()
+	var bad string
+	if s.Bad != nil {
+		bad = s.Bad.String() + "\n"
+	}
+	if err := util.WriteFileAtomic(filepath.Join(dir, badFile), []byte(bad), 0644); err != nil {
+		return err
+	}
+	var good strings.Builder
+	for _, hash := range s.Good {
+		good.WriteString(hash.String() + "\n")
+	}
+	return util.WriteFileAtomic(filepath.Join(dir, goodFile), []byte(good.String()), 0644)
+}
+
+// reachableはhashから、parentsで表した候補の中の親を辿って到達できる候補の数を返す.
+func reachable(parents map[string][]sha.SHA1, hash sha.SHA1) int {
+	visited := map[string]struct{}{}
+	stack := []sha.SHA1{hash}
+	for len(stack) > 0 {
+		hash := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if _, ok := visited[string(hash)]; ok {
+			continue
+		}
+		visited[string(hash)] = struct{}{}
+		stack = append(stack, parents[string(hash)]...)
+	}
+	return len(visited)
+}
+
+// estimateStepsはall個の候補から最初の悪いコミットを見つけるまでの手順の数を見積もる.
+// gitのestimate_bisect_stepsと同じく、候補の数が2の冪を超えた分で切り上げるかを決める.
+func estimateSteps(all int) int {
+	if all < 3 {
+		return 0
+	}
+	n := bits.Len(uint(all)) - 1
+	e := 1 << n
+	if e < 3*(all-e) {
+		return n
+	}
+	return n - 1
+}
+
+func readHashes(name string) ([]sha.SHA1, error) {
+	data, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var hashes []sha.SHA1
+	for _, line := range strings.Fields(string(data)) {
+		hash, err := hex.DecodeString(line)
+		if err != nil || len(hash) != 20 {
+			return nil, fmt.Errorf("%w : %s", ErrInvalidState, filepath.Base(name))
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, nil
+}
@@ -0,0 +1,113 @@
+package bisect
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+)
+
+// 一直線の履歴で、どのコミットが最初の悪いコミットでも、見積もった手順の数以内で見つけられるか
+func TestState_Next(t *testing.T) {
+	client, _, err := store.Init(t.TempDir(), store.InitOptions{InitialBranch: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := client.StoreRaw(object.TreeObject, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var commits []sha.SHA1
+	for i := 0; i < 10; i++ {
+		data := fmt.Sprintf("tree %s\n", tree)
+		if i > 0 {
+			data += fmt.Sprintf("parent %s\n", commits[i-1])
+		}
+		data += fmt.Sprintf("author fsegit <fsegit@example.com> %d +0900\ncommitter fsegit <fsegit@example.com> %d +0900\n\nc%d\n", 1672531200+i, 1672531200+i, i)
+		hash, err := client.StoreRaw(object.CommitObject, []byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		commits = append(commits, hash)
+	}
+	if err := client.WriteRef("refs/heads/main", commits[9]); err != nil {
+		t.Fatal(err)
+	}
+
+	for firstBad := 1; firstBad < 10; firstBad++ {
+		s, err := Start(client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.MarkBad(commits[9]); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.MarkGood(commits[0]); err != nil {
+			t.Fatal(err)
+		}
+		step, err := s.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if step.Steps != 2 || step.Remaining != 4 || !bytes.Equal(step.Commit, commits[4]) {
+			t.Errorf("first Next() = %+v, want c4 with 4 remaining in 2 steps", step)
+		}
+		for tested := 0; !step.Found; tested++ {
+			if tested > 3 {
+				t.Fatalf("first bad c%d: not found after %d steps", firstBad, tested)
+			}
+			s, err = Load(client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if isAfter(commits, step.Commit, firstBad) {
+				err = s.MarkBad(step.Commit)
+			} else {
+				err = s.MarkGood(step.Commit)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if step, err = s.Next(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !bytes.Equal(step.Commit, commits[firstBad]) {
+			t.Errorf("first bad c%d: found %s", firstBad, step.Commit)
+		}
+	}
+
+	s, err := Load(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.MarkGood(commits[9]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Next(); !errors.Is(err, ErrBadBeforeGood) {
+		t.Errorf("Next() with a good descendant = %v, want ErrBadBeforeGood", err)
+	}
+	if err := s.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if InProgress(client) {
+		t.Error("InProgress() after Clear() = true")
+	}
+	if _, err := Load(client); !errors.Is(err, ErrNotBisecting) {
+		t.Errorf("Load() after Clear() = %v, want ErrNotBisecting", err)
+	}
+}
+
+// isAfterはhashがcommitsのn番目以降にあるかを返す.
+func isAfter(commits []sha.SHA1, hash sha.SHA1, n int) bool {
+	for _, c := range commits[n:] {
+		if bytes.Equal(c, hash) {
+			return true
+		}
+	}
+	return false
+}
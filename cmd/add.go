@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/repo"
+	"github.com/spf13/cobra"
+)
+
+var (
+	addAll    bool
+	addUpdate bool
+	addForce  bool
+)
+
+// addCmd represents the add command
+var addCmd = &cobra.Command{
+	Use:   "add [-A | -u] [<pathspec>...]",
+	Short: "Add file contents to the index",
+	Long: `Store the current contents of the files matching the pathspecs as blobs and
+record them in the index, so that they are included in the next commit. A
+directory adds every file under it. A tracked path that no longer exists in the
+working tree is removed from the index.
+
+-A (--all) also stages new and deleted files, and without a pathspec works on
+the whole working tree. -u (--update) only stages changes to files that are
+already tracked: modifications and deletions, never new files.
+
+Untracked files matched by .gitignore, .fsegitignore, .git/info/exclude or
+core.excludesFile are not added unless -f (--force) is given. Naming such a
+path explicitly reports it and exits with status 1 after adding the rest.
+
+Files inside another repository nested in the working tree are not added.`,
+	ValidArgsFunction: completeTrackedPaths,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := newRepository()
+		if err != nil {
+			return err
+		}
+		prefix, err := pathspecPrefix(r.Client())
+		if err != nil {
+			return err
+		}
+		ignored, err := r.Add(args, repo.AddOptions{
+			All:    addAll,
+			Update: addUpdate,
+			Force:  addForce,
+			Prefix: prefix,
+		})
+		if err != nil {
+			return err
+		}
+		if len(ignored) > 0 {
+			out := cmd.ErrOrStderr()
+			fmt.Fprintln(out, i18n.T("The following paths are ignored by one of your .gitignore files:"))
+			for _, arg := range ignored {
+				fmt.Fprintln(out, arg)
+			}
+			fmt.Fprint(out, i18n.T("hint: Use -f if you really want to add them.\n"))
+			return &exitError{code: 1}
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(addCmd)
+
+	addCmd.Flags().BoolVarP(&addAll, "all", "A", false, "add changes from all tracked and untracked files")
+	addCmd.Flags().BoolVarP(&addUpdate, "update", "u", false, "only stage modifications and deletions of tracked files")
+	addCmd.Flags().BoolVarP(&addForce, "force", "f", false, "allow adding otherwise ignored files")
+}
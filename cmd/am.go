@@ -0,0 +1,244 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+
+	"github.com/kanon1343/fsegit/diff"
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/repo"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+	"github.com/spf13/cobra"
+)
+
+// amCmd represents the am command
+var amCmd = &cobra.Command{
+	Use:   "am [<mbox>...]",
+	Short: "Apply patches from a mailbox as commits",
+	Long: `Read mails in mbox format, such as the output of "format-patch", from the
+given files, or from standard input if none is given or the file is "-", and
+apply the patch in each of them to the working tree and the index, committing
+the result on top of HEAD.
+
+The subject of the mail, without a leading "[PATCH ...]", and the body up to
+the "---" line become the commit message. The author and the author date of
+the commit are taken from the From and Date headers of the mail.
+
+The index and the working tree must not have uncommitted changes. When a patch
+does not apply, the command stops there, leaving the commits made for the
+earlier patches.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		if len(args) == 0 {
+			args = []string{"-"}
+		}
+		var mails [][]byte
+		for _, name := range args {
+			var data []byte
+			if name == "-" {
+				data, err = ioutil.ReadAll(cmd.InOrStdin())
+			} else {
+				data, err = ioutil.ReadFile(resolvePath(name))
+			}
+			if err != nil {
+				return err
+			}
+			mails = append(mails, splitMbox(data)...)
+		}
+
+		status, err := client.Status()
+		if err != nil {
+			return err
+		}
+		if len(status.Staged) > 0 || len(status.Unstaged) > 0 || len(status.Unmerged) > 0 {
+			return i18n.Errorf("cannot apply patches: your index or working tree contains uncommitted changes")
+		}
+		out := cmd.OutOrStdout()
+		for i, data := range mails {
+			patch, err := parsePatchMail(data)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(out, i18n.Sprintf("Applying: %s", patch.subject))
+			if err := applyPatchMail(cmd, client, patch); err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), i18n.Sprintf("error: %s", i18n.ErrorMessage(err)))
+				fmt.Fprintln(cmd.ErrOrStderr(), i18n.Sprintf("Patch failed at %04d %s", i+1, patch.subject))
+				return &exitError{code: 1}
+			}
+		}
+		return nil
+	},
+}
+
+// patchMailはamで読んだ1通のメール.
+type patchMail struct {
+	author  object.Signature
+	subject string
+	message string
+	patches []*diff.FilePatch
+}
+
+// splitMboxはmbox形式のdataをメールごとに分ける. メールは先頭か空行の直後の"From "で始まる行から始まる.
+// "From "の行がなければ、全体を1通のメールとする.
+func splitMbox(data []byte) [][]byte {
+	if !bytes.HasPrefix(data, []byte("From ")) {
+		return [][]byte{data}
+	}
+	var mails [][]byte
+	start := 0
+	for pos := 0; pos < len(data); {
+		end := bytes.IndexByte(data[pos:], '\n')
+		if end < 0 {
+			break
+		}
+		next := pos + end + 1
+		if pos > start && bytes.HasPrefix(data[pos:], []byte("From ")) && bytes.HasSuffix(data[:pos], []byte("\n\n")) {
+			mails = append(mails, data[start:pos])
+			start = pos
+		}
+		pos = next
+	}
+	return append(mails, data[start:])
+}
+
+// parsePatchMailはメールのヘッダから作者と件名を、本文からコミットメッセージとパッチを読む.
+func parsePatchMail(data []byte) (*patchMail, error) {
+	// 先頭の"From "の行はメールのヘッダではない.
+	if bytes.HasPrefix(data, []byte("From ")) {
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			data = data[i+1:]
+		}
+	}
+	msg, err := mail.ReadMessage(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		return nil, err
+	}
+	from, err := mail.ParseAddress(msg.Header.Get("From"))
+	if err != nil {
+		return nil, i18n.Errorf("invalid From header %q", msg.Header.Get("From"))
+	}
+	date, err := msg.Header.Date()
+	if err != nil {
+		return nil, i18n.Errorf("invalid Date header %q", msg.Header.Get("Date"))
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(msg.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(msg.Header.Get("Content-Transfer-Encoding")) {
+	case "quoted-printable":
+		body, err = ioutil.ReadAll(quotedprintable.NewReader(bytes.NewReader(body)))
+	case "base64":
+		body, err = ioutil.ReadAll(base64.NewDecoder(base64.StdEncoding, bytes.NewReader(bytes.Join(bytes.Fields(body), nil))))
+	}
+	if err != nil {
+		return nil, err
+	}
+	body = bytes.ReplaceAll(body, []byte("\r\n"), []byte("\n"))
+
+	patches, err := diff.ParsePatch(body)
+	if err != nil {
+		return nil, err
+	}
+	subject = patchSubject(subject)
+	if len(patches) == 0 {
+		return nil, i18n.Errorf("patch is empty: %s", subject)
+	}
+	return &patchMail{
+		author:  object.Signature{Name: from.Name, Email: from.Address, When: date},
+		subject: subject,
+		message: repo.CleanupMessage(subject + "\n\n" + patchMailDescription(string(body))),
+		patches: patches,
+	}, nil
+}
+
+// patchSubjectは件名の先頭の"[PATCH 1/2]"や"Re:"を取り除き、折り返しを1行に戻す.
+func patchSubject(subject string) string {
+	subject = strings.Join(strings.Fields(subject), " ")
+	for {
+		switch {
+		case strings.HasPrefix(subject, "["):
+			i := strings.IndexByte(subject, ']')
+			if i < 0 {
+				return subject
+			}
+			subject = strings.TrimSpace(subject[i+1:])
+		case len(subject) >= 3 && strings.EqualFold(subject[:3], "re:"):
+			subject = strings.TrimSpace(subject[3:])
+		default:
+			return subject
+		}
+	}
+}
+
+// patchMailDescriptionはメールの本文のうち、"---"の行か差分の始まりより前をコミットメッセージの本文として返す.
+func patchMailDescription(body string) string {
+	lines := strings.SplitAfter(body, "\n")
+	for i, line := range lines {
+		line = strings.TrimRight(line, "\r\n")
+		if line == "---" || strings.HasPrefix(line, "diff --git ") || strings.HasPrefix(line, "Index: ") {
+			return strings.Join(lines[:i], "")
+		}
+	}
+	return body
+}
+
+// applyPatchMailはpatchのパッチを作業ツリーとインデックスに適用し、メールの作者でコミットする.
+func applyPatchMail(cmd *cobra.Command, client *store.Client, patch *patchMail) error {
+	if err := client.Apply(patch.patches, store.ApplyOptions{Index: true}); err != nil {
+		return err
+	}
+	index, err := client.ReadIndex()
+	if err != nil {
+		return err
+	}
+	tree, err := client.WriteTree(index)
+	if err != nil {
+		return err
+	}
+	if err := client.WriteIndex(index); err != nil {
+		return err
+	}
+	head, err := client.ReadHead()
+	if err != nil {
+		return err
+	}
+	committer, err := client.Identity(store.Committer)
+	if err != nil {
+		printIdentityHint(cmd.ErrOrStderr(), err)
+		return err
+	}
+
+	commit := object.Commit{
+		Tree:      tree,
+		Parents:   head.Parents(),
+		Author:    patch.author,
+		Committer: committer,
+		Message:   patch.message,
+	}
+	var hash sha.SHA1
+	if hash, err = client.StoreRaw(object.CommitObject, commit.Encode()); err != nil {
+		return err
+	}
+	return client.UpdateHead(hash, "am: "+commit.Subject())
+}
+
+func init() {
+	rootCmd.AddCommand(amCmd)
+}
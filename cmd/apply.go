@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"io/ioutil"
+
+	"github.com/kanon1343/fsegit/diff"
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/store"
+	"github.com/spf13/cobra"
+)
+
+var (
+	applyCached bool
+	applyIndex  bool
+	applyCheck  bool
+)
+
+// applyCmd represents the apply command
+var applyCmd = &cobra.Command{
+	Use:   "apply [--cached | --index] [--check] [<patch>...]",
+	Short: "Apply a patch to files in the working tree or the index",
+	Long: `Read unified diffs from the given files, or from standard input if none is
+given or the file is "-", and apply them to the files in the working tree.
+The extended headers of "diff" and "format-patch" output are understood, so
+files can be created, deleted and renamed, and their modes changed. Text
+around the patches, such as a commit message, is ignored.
+
+A hunk whose lines have moved is applied where the lines are found closest to
+the recorded position. The patch is applied only if every hunk applies;
+otherwise nothing is changed. Binary patches cannot be applied.
+
+With --cached, the patch is applied to the index instead, leaving the working
+tree alone. With --index, it is applied to both the working tree and the
+index. With --check, nothing is changed; the command only fails if the
+patch would not apply.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if applyCached && applyIndex {
+			return i18n.Errorf("--cached and --index cannot be used together")
+		}
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		if len(args) == 0 {
+			args = []string{"-"}
+		}
+		var patches []*diff.FilePatch
+		for _, name := range args {
+			var data []byte
+			if name == "-" {
+				data, err = ioutil.ReadAll(cmd.InOrStdin())
+			} else {
+				data, err = ioutil.ReadFile(resolvePath(name))
+			}
+			if err != nil {
+				return err
+			}
+			parsed, err := diff.ParsePatch(data)
+			if err != nil {
+				return err
+			}
+			patches = append(patches, parsed...)
+		}
+		if len(patches) == 0 {
+			return i18n.Errorf("no valid patches in input")
+		}
+		return client.Apply(patches, store.ApplyOptions{Cached: applyCached, Index: applyIndex, Check: applyCheck})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(applyCmd)
+
+	applyCmd.Flags().BoolVar(&applyCached, "cached", false, "apply the patch to the index without touching the working tree")
+	applyCmd.Flags().BoolVar(&applyIndex, "index", false, "apply the patch to both the working tree and the index")
+	applyCmd.Flags().BoolVar(&applyCheck, "check", false, "only check that the patch applies")
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"io"
+	"os"
+
+	"github.com/kanon1343/fsegit/archive"
+	"github.com/spf13/cobra"
+)
+
+var (
+	archiveFormat string
+	archiveOutput string
+	archivePrefix string
+)
+
+// archiveCmd represents the archive command
+var archiveCmd = &cobra.Command{
+	Use:   "archive [--format=<fmt>] [--prefix=<prefix>/] [-o <file>] <tree-ish>",
+	Short: "Create an archive of files from a named tree",
+	Long: `Create an archive of the files in the given tree or commit and write it to
+standard output, or to the file given with -o.
+
+Supported formats are tar, tgz (tar.gz) and zip. When --format is omitted the
+format is guessed from the output file name. File modes and symbolic links are
+preserved. Paths with the export-ignore attribute are left out, and
+$Format:...$ placeholders in files with the export-subst attribute are expanded
+using the commit.
+
+--prefix is prepended to every path in the archive. Like git, it is used as is,
+so end it with "/" to put the files in a directory.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		hash, err := resolveCommitish(client, args[0])
+		if err != nil {
+			return err
+		}
+
+		format := archive.FormatFromFileName(archiveOutput)
+		if archiveFormat != "" {
+			if format, err = archive.ParseFormat(archiveFormat); err != nil {
+				return err
+			}
+		}
+
+		var w io.Writer = cmd.OutOrStdout()
+		if archiveOutput != "" {
+			f, err := os.Create(resolvePath(archiveOutput))
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+		archiver := archive.NewArchiver(client, format)
+		archiver.Prefix = archivePrefix
+		return archiver.Write(w, hash)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(archiveCmd)
+
+	archiveCmd.Flags().StringVar(&archiveFormat, "format", "", "archive format (tar, tgz, tar.gz, zip)")
+	archiveCmd.Flags().StringVarP(&archiveOutput, "output", "o", "", "write the archive to this file")
+	archiveCmd.Flags().StringVar(&archivePrefix, "prefix", "", "prepend <prefix> to every path in the archive")
+	archiveCmd.RegisterFlagCompletionFunc("format", cobra.FixedCompletions([]string{"tar", "tgz", "tar.gz", "zip"}, cobra.ShellCompDirectiveNoFileComp))
+}
@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/kanon1343/fsegit/bisect"
+	"github.com/kanon1343/fsegit/diff"
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/repo"
+	"github.com/spf13/cobra"
+)
+
+// bisectCmd represents the bisect command
+var bisectCmd = &cobra.Command{
+	Use:   "bisect (start | bad | good | reset)",
+	Short: "Find the commit that introduced a bug by binary search",
+	Long: `Find the first bad commit between a bad commit and good ones by binary
+search. Start with "bisect start", mark a commit with the bug with "bisect
+bad" and one without it with "bisect good". fsegit then checks out a commit
+halfway between them; test it and mark it good or bad, and repeat until the
+first bad commit is printed. "bisect reset" returns to the branch or commit
+HEAD was on before the search started.
+
+The candidates are the commits reachable from the bad commit but not from any
+good one. Like git, the next commit is the candidate from which the number of
+reachable candidates is closest to half of all of them, so merges are handled
+as well as linear history.
+
+The progress is kept in the .fsegit/BISECT_* files until "bisect reset".`,
+}
+
+// bisectStartCmd represents the bisect start command
+var bisectStartCmd = &cobra.Command{
+	Use:   "start [<bad> [<good>...]]",
+	Short: "Start a bisection",
+	Long: `Start a bisection, forgetting the commits marked in an earlier one. The
+first revision given is marked bad and the rest good.`,
+	ValidArgsFunction: completeRefs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := newRepository()
+		if err != nil {
+			return err
+		}
+		state, err := bisect.Start(r.Client())
+		if err != nil {
+			return err
+		}
+		for i, arg := range args {
+			hash, err := resolveCommitish(r.Client(), arg)
+			if err != nil {
+				return err
+			}
+			if i == 0 {
+				err = state.MarkBad(hash)
+			} else {
+				err = state.MarkGood(hash)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return bisectNext(cmd, r, state)
+	},
+}
+
+// bisectBadCmd represents the bisect bad command
+var bisectBadCmd = &cobra.Command{
+	Use:               "bad [<revision>]",
+	Short:             "Mark a commit as bad",
+	Long:              `Mark the given commit (HEAD by default) as one that has the bug.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: completeRefs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runBisectMark(cmd, args, true)
+	},
+}
+
+// bisectGoodCmd represents the bisect good command
+var bisectGoodCmd = &cobra.Command{
+	Use:               "good [<revision>...]",
+	Short:             "Mark commits as good",
+	Long:              `Mark the given commits (HEAD by default) as ones that do not have the bug.`,
+	ValidArgsFunction: completeRefs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runBisectMark(cmd, args, false)
+	},
+}
+
+// bisectResetCmd represents the bisect reset command
+var bisectResetCmd = &cobra.Command{
+	Use:   "reset [<commit>]",
+	Short: "Finish a bisection",
+	Long: `Finish the bisection and check out the branch or commit HEAD was on when it
+started, or the given commit instead.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: completeRefs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := newRepository()
+		if err != nil {
+			return err
+		}
+		state, err := bisect.Load(r.Client())
+		if err != nil {
+			return err
+		}
+		target := state.Start
+		if len(args) == 1 {
+			target = args[0]
+		}
+		result, err := r.Checkout(target, repo.CheckoutOptions{})
+		if err != nil {
+			return err
+		}
+		if err := state.Clear(); err != nil {
+			return err
+		}
+		if result.Branch != "" {
+			fmt.Fprintln(cmd.ErrOrStderr(), i18n.Sprintf("Switched to branch '%s'", target))
+			return nil
+		}
+		commit, err := r.Client().GetCommit(result.Commit)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.ErrOrStderr(), i18n.Sprintf("HEAD is now at %s %s", result.Commit.String()[:7], commit.Subject()))
+		return nil
+	},
+}
+
+// runBisectMarkはargsのコミット(なければHEAD)を悪いか良いコミットとして記録し、次のコミットに進む.
+func runBisectMark(cmd *cobra.Command, args []string, bad bool) error {
+	r, err := newRepository()
+	if err != nil {
+		return err
+	}
+	state, err := bisect.Load(r.Client())
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		args = []string{"HEAD"}
+	}
+	for _, arg := range args {
+		hash, err := resolveCommitish(r.Client(), arg)
+		if err != nil {
+			return err
+		}
+		if bad {
+			err = state.MarkBad(hash)
+		} else {
+			err = state.MarkGood(hash)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return bisectNext(cmd, r, state)
+}
+
+// bisectNextは次に調べるコミットをチェックアウトする. 最初の悪いコミットが見つかればそれを表示し、
+// まだ悪いコミットか良いコミットが分かっていなければ待っているものを表示する.
+func bisectNext(cmd *cobra.Command, r *repo.Repository, state *bisect.State) error {
+	out := cmd.OutOrStdout()
+	if !state.Ready() {
+		switch {
+		case state.Bad == nil && len(state.Good) == 0:
+			fmt.Fprintln(out, i18n.Sprintf("status: waiting for both good and bad commits"))
+		case state.Bad == nil:
+			fmt.Fprintln(out, i18n.Sprintf("status: waiting for bad commit, %d good commit(s) known", len(state.Good)))
+		default:
+			fmt.Fprintln(out, i18n.Sprintf("status: waiting for good commit(s), bad commit known"))
+		}
+		return nil
+	}
+	step, err := state.Next()
+	if err != nil {
+		return err
+	}
+	commit, err := r.Client().GetCommit(step.Commit)
+	if err != nil {
+		return err
+	}
+	if step.Found {
+		fmt.Fprintln(out, i18n.Sprintf("%s is the first bad commit", step.Commit))
+		fmt.Fprintln(out, commit)
+		stats, err := commitStats(r.Client(), commit, nil)
+		if err != nil {
+			return err
+		}
+		if len(stats) > 0 {
+			fmt.Fprintln(out)
+			return diff.WriteStat(out, stats)
+		}
+		return nil
+	}
+	if _, err := r.Checkout(step.Commit.String(), repo.CheckoutOptions{}); err != nil {
+		return err
+	}
+	fmt.Fprintln(out, i18n.Sprintf("Bisecting: %d revision(s) left to test after this (roughly %d step(s))", step.Remaining, step.Steps))
+	fmt.Fprintf(out, "[%s] %s\n", step.Commit, commit.Subject())
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(bisectCmd)
+	bisectCmd.AddCommand(bisectStartCmd, bisectBadCmd, bisectGoodCmd, bisectResetCmd)
+}
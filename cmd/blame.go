@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/spf13/cobra"
+)
+
+// blameCmd represents the blame command
+var blameCmd = &cobra.Command{
+	Use:   "blame [<revision>] [--] <file>",
+	Short: "Show which commit last changed each line of a file",
+	Long: `Annotate each line of <file> at <revision> (HEAD by default) with the commit
+that introduced it, walking back through the history and comparing the file
+with each commit's parents. Lines that a commit did not change are passed on
+to its parent, so each line ends up at the commit that added it in its
+current form. Renames are not followed.
+
+Each line is printed as "<hash> (<author> <date> <line>) <text>". A commit at
+the start of the history, a root commit or a shallow boundary, is marked with
+"^".`,
+	Args:              cobra.RangeArgs(1, 2),
+	ValidArgsFunction: completeRefs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		revision := "HEAD"
+		if dash := cmd.ArgsLenAtDash(); dash >= 0 && len(args)-dash != 1 {
+			return i18n.Errorf("exactly one file must be given after --")
+		}
+		if len(args) == 2 {
+			revision = args[0]
+		}
+		path, err := worktreePath(client, args[len(args)-1])
+		if err != nil {
+			return err
+		}
+		hash, err := resolveCommitish(client, revision)
+		if err != nil {
+			return err
+		}
+		if hash, err = client.PeelToCommit(hash); err != nil {
+			return err
+		}
+		lines, err := client.Blame(hash, path)
+		if err != nil {
+			return err
+		}
+
+		authorWidth := 0
+		for _, line := range lines {
+			if width := utf8.RuneCountInString(line.Commit.Author.Name); width > authorWidth {
+				authorWidth = width
+			}
+		}
+		numberWidth := len(fmt.Sprint(len(lines)))
+		out := cmd.OutOrStdout()
+		for i, line := range lines {
+			commit := line.Commit
+			name := commit.Author.Name + strings.Repeat(" ", authorWidth-utf8.RuneCountInString(commit.Author.Name))
+			date := commit.Author.When.Format("2006-01-02 15:04:05 -0700")
+			fmt.Fprintf(out, "%s (%s %s %*d) %s\n", blameHash(commit.Hash, len(commit.Parents) == 0), name, date, numberWidth, i+1, strings.TrimSuffix(line.Text, "\n"))
+		}
+		return nil
+	},
+}
+
+// blameHashはblameで行の先頭に表示するハッシュを返す. gitと同じく8桁に縮め、履歴の始まりのコミットは"^"を付けて7桁にする.
+func blameHash(hash sha.SHA1, boundary bool) string {
+	if boundary {
+		return "^" + hash.String()[:7]
+	}
+	return hash.String()[:8]
+}
+
+func init() {
+	rootCmd.AddCommand(blameCmd)
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/repo"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/spf13/cobra"
+)
+
+var (
+	branchDelete      bool
+	branchForceDelete bool
+	branchMove        bool
+	branchVerbose     bool
+)
+
+// branchCmd represents the branch command
+var branchCmd = &cobra.Command{
+	Use:   "branch [-v] | <name> [<start-point>] | -d|-D <name>... | -m [<old>] <new>",
+	Short: "List, create, delete or rename branches",
+	Long: `Without arguments, list the branches under refs/heads and mark the current
+one with "*". With -v the commit hash and subject of each branch are shown too.
+
+With a name, create a branch pointing at HEAD or at the given start point.
+
+With -d, delete the named branches. A branch whose commits are not reachable
+from HEAD is kept unless -D is used instead.
+
+With -m, rename a branch (the current one if only the new name is given).
+HEAD follows the branch if it was checked out.`,
+	ValidArgsFunction: completeRefs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := newRepository()
+		if err != nil {
+			return err
+		}
+		switch {
+		case branchDelete || branchForceDelete:
+			if len(args) == 0 {
+				return i18n.Errorf("branch name required")
+			}
+			for _, name := range args {
+				hash, err := r.DeleteBranch(name, branchForceDelete)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), i18n.Sprintf("Deleted branch %s (was %s).", name, hash.String()[:7]))
+			}
+			return nil
+
+		case branchMove:
+			switch len(args) {
+			case 1:
+				return r.RenameBranch("", args[0])
+			case 2:
+				return r.RenameBranch(args[0], args[1])
+			}
+			return i18n.Errorf("too many arguments for a rename operation")
+
+		case len(args) > 2:
+			return i18n.Errorf("too many arguments")
+
+		case len(args) == 2:
+			return r.CreateBranch(args[0], args[1])
+		case len(args) == 1:
+			return r.CreateBranch(args[0], "")
+		}
+		return listBranches(cmd, r)
+	},
+}
+
+// listBranchesはブランチを一覧表示する. 現在のブランチ(切り離されたHEAD)には"*"を付ける.
+func listBranches(cmd *cobra.Command, r *repo.Repository) error {
+	head, err := r.Head()
+	if err != nil {
+		return err
+	}
+	branches, err := r.Branches()
+	if err != nil {
+		return err
+	}
+
+	type line struct {
+		current bool
+		name    string
+		hash    sha.SHA1
+	}
+	var lines []line
+	if head.Detached() {
+		lines = append(lines, line{true, i18n.Sprintf("(HEAD detached at %s)", head.Hash.String()[:7]), head.Hash})
+	}
+	for _, branch := range branches {
+		lines = append(lines, line{branch.Name == head.Branch, strings.TrimPrefix(branch.Name, "refs/heads/"), branch.Hash})
+	}
+	width := 0
+	for _, l := range lines {
+		if len(l.name) > width {
+			width = len(l.name)
+		}
+	}
+
+	out := cmd.OutOrStdout()
+	for _, l := range lines {
+		mark := " "
+		if l.current {
+			mark = "*"
+		}
+		if !branchVerbose {
+			fmt.Fprintf(out, "%s %s\n", mark, l.name)
+			continue
+		}
+		obj, err := r.Client().GetObject(l.hash)
+		if err != nil {
+			return err
+		}
+		commit, err := object.NewCommit(obj)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s %-*s %s %s\n", mark, width, l.name, l.hash.String()[:7], commit.Subject())
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(branchCmd)
+
+	branchCmd.Flags().BoolVarP(&branchDelete, "delete", "d", false, "delete fully merged branches")
+	branchCmd.Flags().BoolVarP(&branchForceDelete, "force-delete", "D", false, "delete branches even if they are not merged")
+	branchCmd.Flags().BoolVarP(&branchMove, "move", "m", false, "rename a branch")
+	branchCmd.Flags().BoolVarP(&branchVerbose, "verbose", "v", false, "show hash and subject for each branch")
+}
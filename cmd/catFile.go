@@ -5,52 +5,103 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
-	"encoding/hex"
 	"fmt"
-	"log"
+	"io"
 
-	"github.com/kanon1343/fsegit/store"
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/object"
 	"github.com/spf13/cobra"
 )
 
+var (
+	catFileType   bool
+	catFileSize   bool
+	catFilePretty bool
+	catFileExists bool
+)
+
 // catFileCmd represents the catFile command
 var catFileCmd = &cobra.Command{
-	Use:   "cat-file",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		client, err := store.NewClient("./")
+	Use:   "cat-file (-t | -s | -p | -e) <object> | cat-file [<type>] <object>",
+	Short: "Show the type, size or contents of an object",
+	Long: `Show information about an object given by its full hash or a ref name.
+
+  -t  print the object type
+  -s  print the object size in bytes
+  -p  pretty-print the contents: trees are listed as
+      "<mode> <type> <hash>\t<name>", other objects are printed as they are
+  -e  print nothing and exit with status 1 if the object does not exist
+
+Without an option the raw contents are printed. If a type is given as well, the
+object must be of that type.`,
+	Args:              cobra.RangeArgs(1, 2),
+	ValidArgsFunction: completeRefs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
 		if err != nil {
-			log.Fatal(err)
+			return err
+		}
+		options := 0
+		for _, set := range []bool{catFileType, catFileSize, catFilePretty, catFileExists} {
+			if set {
+				options++
+			}
+		}
+		if options > 1 || (options == 1 && len(args) != 1) {
+			return i18n.Errorf("only one of -t, -s, -p and -e can be used with a single object")
 		}
-		hashString := args[0]
-		hash, err := hex.DecodeString(hashString)
+
+		hash, err := resolveCommitish(client, args[len(args)-1])
 		if err != nil {
-			log.Fatal(err)
+			if catFileExists {
+				return &exitError{code: 1}
+			}
+			return err
 		}
-		obj, err := client.GetObject(hash)
+		// 内容を全て読み込まずに済むように、まず種類とサイズだけを読む.
+		obj, err := client.OpenObject(hash)
 		if err != nil {
-			log.Fatal(err)
+			if catFileExists {
+				return &exitError{code: 1}
+			}
+			return err
+		}
+		defer obj.Close()
+
+		out := cmd.OutOrStdout()
+		switch {
+		case catFileExists:
+			return nil
+		case catFileType:
+			fmt.Fprintln(out, obj.Type)
+		case catFileSize:
+			fmt.Fprintln(out, obj.Size)
+		case catFilePretty && obj.Type == object.TreeObject:
+			treeObj, err := client.GetObject(hash)
+			if err != nil {
+				return err
+			}
+			tree, err := object.NewTree(treeObj)
+			if err != nil {
+				return err
+			}
+			fmt.Fprint(out, tree)
+		default:
+			if len(args) == 2 && args[0] != obj.Type.String() {
+				return i18n.Errorf("object %s is a %s, not a %s", hash, obj.Type, args[0])
+			}
+			_, err = io.Copy(out, obj)
+			return err
 		}
-		fmt.Println(string(obj.Data))
+		return nil
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(catFileCmd)
 
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// catFileCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// catFileCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	catFileCmd.Flags().BoolVarP(&catFileType, "type", "t", false, "show the object type")
+	catFileCmd.Flags().BoolVarP(&catFileSize, "size", "s", false, "show the object size")
+	catFileCmd.Flags().BoolVarP(&catFilePretty, "pretty", "p", false, "pretty-print the object contents")
+	catFileCmd.Flags().BoolVarP(&catFileExists, "exists", "e", false, "exit with zero status if the object exists")
 }
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/repo"
+	"github.com/kanon1343/fsegit/revparse"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+	"github.com/spf13/cobra"
+)
+
+var checkoutForce bool
+
+// checkoutCmd represents the checkout command
+var checkoutCmd = &cobra.Command{
+	Use:   "checkout [-f] <branch|commit>",
+	Short: "Switch branches or check out a commit",
+	Long: `Update the working tree and the index to match the given branch or commit.
+
+If the argument names a branch under refs/heads, HEAD is pointed at that
+branch. Otherwise it is resolved as a tag, another ref or a full commit hash
+and HEAD is detached at that commit.
+
+Files that differ between HEAD and the target are rewritten. If any of them
+has local changes, or an untracked file is in the way, nothing is changed
+unless -f is given, which discards all local changes.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeRefs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := newRepository()
+		if err != nil {
+			return err
+		}
+		result, err := r.Checkout(args[0], repo.CheckoutOptions{Force: checkoutForce})
+		if err != nil {
+			return err
+		}
+		printOrphanedCommits(cmd, result.Orphaned)
+		switch {
+		case result.Branch == "":
+			obj, err := r.Client().GetObject(result.Commit)
+			if err != nil {
+				return err
+			}
+			commit, err := object.NewCommit(obj)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.ErrOrStderr(), i18n.Sprintf("HEAD is now at %s %s", result.Commit.String()[:7], commit.Subject()))
+		case result.Branch == result.Previous.Branch:
+			fmt.Fprintln(cmd.ErrOrStderr(), i18n.Sprintf("Already on '%s'", args[0]))
+		default:
+			fmt.Fprintln(cmd.ErrOrStderr(), i18n.Sprintf("Switched to branch '%s'", args[0]))
+		}
+		return nil
+	},
+}
+
+// resolveCommitishは"HEAD~2"や"v1.0^{tree}"、省略したハッシュなど、rev-parseと同じ書き方のリビジョンを解決する.
+func resolveCommitish(client *store.Client, name string) (sha.SHA1, error) {
+	return revparse.Resolve(client, name)
+}
+
+// printOrphanedCommitsは切り離されたHEADから移動したときに、どのブランチからも辿れなくなったコミットを警告する.
+func printOrphanedCommits(cmd *cobra.Command, orphaned []*object.Commit) {
+	if len(orphaned) == 0 {
+		return
+	}
+	out := cmd.ErrOrStderr()
+	fmt.Fprintln(out, i18n.Sprintf("Warning: you are leaving %d commit(s) behind, not connected to any of your branches:", len(orphaned)))
+	fmt.Fprintln(out)
+	for _, commit := range orphaned {
+		fmt.Fprintf(out, "  %s %s\n", commit.Hash.String()[:7], commit.Subject())
+	}
+	fmt.Fprintln(out)
+}
+
+func init() {
+	rootCmd.AddCommand(checkoutCmd)
+
+	checkoutCmd.Flags().BoolVarP(&checkoutForce, "force", "f", false, "throw away local changes")
+}
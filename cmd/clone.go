@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+	"github.com/kanon1343/fsegit/transport"
+	"github.com/spf13/cobra"
+)
+
+var (
+	cloneBare   bool
+	cloneBranch string
+	cloneDepth  int
+	cloneOrigin string
+	cloneQuiet  bool
+)
+
+// cloneCmd represents the clone command
+var cloneCmd = &cobra.Command{
+	Use:   "clone [--bare] [-b <branch>] [-o <name>] [--depth <n>] [-q] <url> [<dir>]",
+	Short: "Clone a repository over the smart HTTP protocol",
+	Long: `Clone the repository at <url> into a new directory <dir>. Without <dir>, the
+last component of the URL without ".git" is used.
+
+Branches of the remote become remote-tracking branches under
+refs/remotes/origin/ and tags are copied as they are. The branch the remote
+HEAD points to, or the one given with -b, is created locally and checked out.
+With --bare, the branches are copied to refs/heads/ and nothing is checked out.
+
+With --depth, only the last <n> commits of each branch are downloaded. The
+commits at the boundary are recorded in .git/shallow and treated as having no
+parents.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if cloneDepth < 0 {
+			return i18n.Errorf("depth %d is not a positive number", cloneDepth)
+		}
+		url := args[0]
+		dir := cloneDirName(url, cloneBare)
+		if len(args) == 2 {
+			dir = args[1]
+		}
+		dir = resolvePath(dir)
+		if entries, err := ioutil.ReadDir(dir); err == nil && len(entries) > 0 {
+			return i18n.Errorf("destination path '%s' already exists and is not an empty directory", dir)
+		}
+		_, statErr := os.Stat(dir)
+		created := os.IsNotExist(statErr)
+
+		stderr := cmd.ErrOrStderr()
+		if !cloneQuiet {
+			if cloneBare {
+				fmt.Fprintln(stderr, i18n.Sprintf("Cloning into bare repository '%s'...", dir))
+			} else {
+				fmt.Fprintln(stderr, i18n.Sprintf("Cloning into '%s'...", dir))
+			}
+		}
+		err := clone(cmd.Context(), url, dir, stderr)
+		if err != nil && created {
+			os.RemoveAll(dir)
+		}
+		return err
+	},
+}
+
+// cloneDirNameはURLの最後の要素から".git"を除いてcloneするディレクトリの名前にする.
+func cloneDirName(url string, bare bool) string {
+	name := strings.TrimRight(url, "/")
+	name = strings.TrimSuffix(name, "/.git")
+	name = path.Base(strings.TrimSuffix(name, ".git"))
+	if i := strings.LastIndexAny(name, ":"); i >= 0 {
+		name = name[i+1:]
+	}
+	if bare {
+		name += ".git"
+	}
+	return name
+}
+
+// cloneはurlのリポジトリをdirに作った新しいリポジトリに取り込み、デフォルトのブランチをチェックアウトする.
+func clone(ctx context.Context, url, dir string, stderr io.Writer) error {
+	client, _, err := store.Init(dir, store.InitOptions{Bare: cloneBare})
+	if err != nil {
+		return err
+	}
+	remote := transport.NewRemote(url)
+	if !cloneQuiet {
+		remote.Progress = stderr
+	}
+	adv, err := remote.ListRefsContext(ctx, "git-upload-pack")
+	if err != nil {
+		return err
+	}
+	// 参照の名前はそのまま手元のファイルの名前になるので、".."などを含む不正な名前があれば取り込まない.
+	for _, ref := range adv.Refs {
+		if strings.HasPrefix(ref.Name, "refs/heads/") || strings.HasPrefix(ref.Name, "refs/tags/") {
+			if err := store.CheckRefName(ref.Name); err != nil {
+				return err
+			}
+		}
+	}
+
+	var wants []sha.SHA1
+	seen := map[string]bool{}
+	for _, ref := range adv.Refs {
+		if !strings.HasPrefix(ref.Name, "refs/heads/") && !strings.HasPrefix(ref.Name, "refs/tags/") {
+			continue
+		}
+		if !seen[string(ref.Hash)] {
+			seen[string(ref.Hash)] = true
+			wants = append(wants, ref.Hash)
+		}
+	}
+	if len(wants) > 0 {
+		packData, shallow, err := remote.FetchPackWithOptions(ctx, adv, wants, nil, transport.FetchOptions{Depth: cloneDepth})
+		if err != nil {
+			return err
+		}
+		_, err = client.IndexPack(packData)
+		packData.Close()
+		if err != nil {
+			return err
+		}
+		if shallow != nil {
+			if err := client.UpdateShallow(shallow.Shallow, shallow.Unshallow); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := client.AddRemote(cloneOrigin, url); err != nil {
+		return err
+	}
+	for _, ref := range adv.Refs {
+		name := ref.Name
+		switch {
+		case strings.HasPrefix(name, "refs/tags/"):
+		case strings.HasPrefix(name, "refs/heads/") && !cloneBare:
+			name = "refs/remotes/" + cloneOrigin + "/" + strings.TrimPrefix(name, "refs/heads/")
+		case strings.HasPrefix(name, "refs/heads/"):
+		default:
+			continue
+		}
+		if err := client.UpdateRef(name, ref.Hash, "clone: from "+url); err != nil {
+			return err
+		}
+	}
+
+	branch, err := cloneDefaultBranch(adv)
+	if err != nil {
+		return err
+	}
+	if len(wants) == 0 {
+		fmt.Fprintln(stderr, i18n.Sprintf("warning: You appear to have cloned an empty repository."))
+		// 最初のコミットがリモートと同じブランチ名になるようにHEADだけは合わせておく.
+		if branch != "" {
+			return client.WriteSymbolicRef("HEAD", "refs/heads/"+branch)
+		}
+		return nil
+	}
+	hash, ok := adv.Lookup("refs/heads/" + branch)
+	if !ok {
+		fmt.Fprintln(stderr, i18n.Sprintf("warning: remote HEAD refers to nonexistent ref, unable to checkout"))
+		return nil
+	}
+	if err := client.WriteSymbolicRef("HEAD", "refs/heads/"+branch); err != nil {
+		return err
+	}
+	if cloneBare {
+		return nil
+	}
+	if err := client.WriteSymbolicRef("refs/remotes/"+cloneOrigin+"/HEAD", "refs/remotes/"+cloneOrigin+"/"+branch); err != nil {
+		return err
+	}
+	if err := client.UpdateRef("refs/heads/"+branch, hash, "clone: from "+url); err != nil {
+		return err
+	}
+	if err := client.SetUpstream(branch, cloneOrigin, "refs/heads/"+branch); err != nil {
+		return err
+	}
+	return client.CheckoutCommit(hash, store.CheckoutOptions{Force: true})
+}
+
+// cloneDefaultBranchはチェックアウトするブランチの名前を返す. -bの指定、リモートのHEADの指す先、
+// HEADと同じコミットを指すブランチの順に決める. 決められなければ空文字列を返す.
+func cloneDefaultBranch(adv *transport.Advertisement) (string, error) {
+	if cloneBranch != "" {
+		if err := store.CheckRefName("refs/heads/" + cloneBranch); err != nil {
+			return "", err
+		}
+		if _, ok := adv.Lookup("refs/heads/" + cloneBranch); !ok {
+			return "", i18n.Errorf("Remote branch %s not found in upstream %s", cloneBranch, cloneOrigin)
+		}
+		return cloneBranch, nil
+	}
+	if target := adv.Symref("HEAD"); strings.HasPrefix(target, "refs/heads/") {
+		if err := store.CheckRefName(target); err != nil {
+			return "", err
+		}
+		return strings.TrimPrefix(target, "refs/heads/"), nil
+	}
+	head, ok := adv.Lookup("HEAD")
+	if !ok {
+		return "", nil
+	}
+	candidates := []string{"refs/heads/main", "refs/heads/master"}
+	for _, ref := range adv.Refs {
+		candidates = append(candidates, ref.Name)
+	}
+	for _, name := range candidates {
+		if hash, ok := adv.Lookup(name); ok && strings.HasPrefix(name, "refs/heads/") && bytes.Equal(hash, head) {
+			return strings.TrimPrefix(name, "refs/heads/"), nil
+		}
+	}
+	return "", nil
+}
+
+func init() {
+	rootCmd.AddCommand(cloneCmd)
+
+	cloneCmd.Flags().BoolVar(&cloneBare, "bare", false, "make a bare repository")
+	cloneCmd.Flags().StringVarP(&cloneBranch, "branch", "b", "", "check out <branch> instead of the remote HEAD")
+	cloneCmd.Flags().StringVarP(&cloneOrigin, "origin", "o", store.DefaultRemote, "name of the remote")
+	cloneCmd.Flags().IntVar(&cloneDepth, "depth", 0, "download only the last <n> commits of history")
+	cloneCmd.Flags().BoolVarP(&cloneQuiet, "quiet", "q", false, "suppress progress messages")
+}
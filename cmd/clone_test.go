@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kanon1343/fsegit/store"
+	"github.com/kanon1343/fsegit/transport"
+)
+
+// 広告された参照、リモートのHEADの指す先、-bのブランチのどれかが不正な名前なら、
+// 何も書き込まずにcloneを失敗させて作りかけのディレクトリを消すか
+func TestClone_BrokenRefName(t *testing.T) {
+	src, _, err := store.Init(t.TempDir(), store.InitOptions{InitialBranch: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit := storeTestCommit(t, "a\n", src)
+
+	tests := []struct {
+		name         string
+		refs         []transport.Ref
+		capabilities []string
+		args         []string
+	}{
+		{
+			name: "advertised tag",
+			refs: []transport.Ref{{Name: "refs/heads/main", Hash: commit}, {Name: "refs/tags/../../config", Hash: commit}},
+		},
+		{
+			name: "advertised branch",
+			refs: []transport.Ref{{Name: "refs/heads/main", Hash: commit}, {Name: "refs/heads/../../../outside", Hash: commit}},
+		},
+		{
+			name:         "remote HEAD",
+			refs:         []transport.Ref{{Name: "HEAD", Hash: commit}, {Name: "refs/heads/main", Hash: commit}},
+			capabilities: []string{"symref=HEAD:refs/heads/../../config"},
+		},
+		{
+			name: "branch option",
+			refs: []transport.Ref{{Name: "refs/heads/main", Hash: commit}},
+			args: []string{"-b", "../../config"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var wants []string
+			server := newUploadPackServer(t, src, test.refs, &wants, test.capabilities...)
+			defer server.Close()
+
+			parent := t.TempDir()
+			dir := filepath.Join(parent, "repo")
+			args := append([]string{"clone", "-q"}, test.args...)
+			_, _, err := executeCommand(t, append(args, server.URL, dir)...)
+			if !errors.Is(err, store.ErrInvalidRefName) {
+				t.Errorf("clone error = %v, want %v", err, store.ErrInvalidRefName)
+			}
+			if _, err := os.Stat(dir); !os.IsNotExist(err) {
+				t.Errorf("the new repository was not removed: %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(parent, "outside")); !os.IsNotExist(err) {
+				t.Errorf("a file was written outside the repository: %v", err)
+			}
+		})
+	}
+}
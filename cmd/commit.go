@@ -0,0 +1,264 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/repo"
+	"github.com/kanon1343/fsegit/store"
+	"github.com/spf13/cobra"
+)
+
+var (
+	commitMessages   []string
+	commitFile       string
+	commitAmend      bool
+	commitAll        bool
+	commitAllowEmpty bool
+	commitSign       bool
+	commitNoSign     bool
+)
+
+// commitCmd represents the commit command
+var commitCmd = &cobra.Command{
+	Use:   "commit [-a] [--amend] [--allow-empty] [-S | --no-gpg-sign] [-m <message> | -F <file>]",
+	Short: "Record the staged changes as a new commit",
+	Long: `Create a commit from the contents of the index and move the current branch
+(or the detached HEAD) to it.
+
+Several -m options are joined as separate paragraphs. -F reads the message
+from a file, or from standard input if the file is "-". Without -m and -F, the
+editor (GIT_EDITOR, core.editor, VISUAL or EDITOR, in that order, or vi) is
+started on .fsegit/COMMIT_EDITMSG with a summary of the changes in lines
+starting with "#". Those lines are removed, and the commit is aborted if the
+message is left empty.
+
+With -a, the modifications and deletions of tracked files are staged first, as
+with "add -u". New files are not added.
+
+A commit that would record the same tree as its parent is refused, and the
+status is shown instead, unless --allow-empty is given. Merge commits are
+always allowed.
+
+With --amend, the commit replaces the current HEAD commit instead of being
+added on top of it: it gets the parents and the author of that commit, and
+its message unless a new one is given (the editor starts with the old
+message). The reflog records the move from the replaced commit.
+
+When concluding a merge that stopped on conflicts, the saved merge message is
+used (or offered in the editor) if no message is given, and the merged commits
+become additional parents. The commit is refused while the index still has
+unmerged paths.
+
+With -S, or when commit.gpgSign is true and --no-gpg-sign is not given, the
+commit is signed with gpg, gpgsm or ssh-keygen as selected by gpg.format
+(openpgp, x509 or ssh), using the key in user.signingKey. For OpenPGP and
+X.509 the committer identity selects the key if user.signingKey is not set.
+gpg.program, or gpg.<format>.program, replaces the program. "verify-commit"
+checks the signature.
+
+The author and committer are taken from user.name and user.email (or
+author.* and committer.*), overridden by GIT_AUTHOR_NAME, GIT_AUTHOR_EMAIL,
+GIT_COMMITTER_NAME and GIT_COMMITTER_EMAIL. GIT_AUTHOR_DATE and
+GIT_COMMITTER_DATE set the dates. The commit fails if no identity is set.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := newRepository()
+		if err != nil {
+			return err
+		}
+		if commitAmend {
+			head, err := r.Head()
+			if err != nil {
+				return err
+			}
+			if head.Unborn() {
+				return i18n.Errorf("you have nothing to amend")
+			}
+		}
+		message := strings.Join(commitMessages, "\n\n")
+		switch {
+		case commitFile != "":
+			if len(commitMessages) > 0 {
+				return i18n.Errorf("-m and -F cannot be used together")
+			}
+			var data []byte
+			if commitFile == "-" {
+				data, err = ioutil.ReadAll(cmd.InOrStdin())
+			} else {
+				data, err = ioutil.ReadFile(resolvePath(commitFile))
+			}
+			if err != nil {
+				return err
+			}
+			message = string(data)
+		case len(commitMessages) == 0:
+			if message, err = editCommitMessage(r, commitAmend, commitAll); err != nil {
+				return nothingToCommit(cmd, r, err)
+			}
+			if message == "" {
+				return i18n.Errorf("aborting commit due to empty commit message")
+			}
+		}
+		cfg, err := r.Client().Config()
+		if err != nil {
+			return err
+		}
+		sign, err := cfg.GetBool("commit.gpgsign", false)
+		if err != nil {
+			return err
+		}
+		commit, err := r.Commit(repo.CommitOptions{
+			Message:    message,
+			All:        commitAll,
+			AllowEmpty: commitAllowEmpty,
+			Amend:      commitAmend,
+			Sign:       (sign || commitSign) && !commitNoSign,
+		})
+		if err != nil {
+			printIdentityHint(cmd.ErrOrStderr(), err)
+			return nothingToCommit(cmd, r, err)
+		}
+
+		head, err := r.Head()
+		if err != nil {
+			return err
+		}
+		where := head.ShortBranch()
+		if head.Detached() {
+			where = "detached HEAD"
+		}
+		if len(commit.Parents) == 0 {
+			where += " (root-commit)"
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "[%s %s] %s\n", where, commit.Hash.String()[:7], commit.Subject())
+		return nil
+	},
+}
+
+// editCommitMessageはCOMMIT_EDITMSGに、amendなら置き換えるコミットの、マージの途中ならマージのメッセージと、
+// 変更の一覧をコメントにして書き、エディタで編集させたメッセージからコメントを取り除いて返す.
+// allなら、コミットの前に追加する追跡しているファイルの変更も、コミットする変更として一覧に含める.
+func editCommitMessage(r *repo.Repository, amend, all bool) (string, error) {
+	client := r.Client()
+	var buf strings.Builder
+	merge, err := client.ReadMergeState()
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case amend && merge == nil:
+		head, err := r.HeadCommit()
+		if err != nil {
+			return "", err
+		}
+		buf.WriteString(head.Message)
+	case merge != nil:
+		buf.WriteString(merge.Message)
+	}
+	buf.WriteString("\n")
+
+	status, err := r.Status()
+	if err != nil {
+		return "", err
+	}
+	// 何も変更しないならエディタを開く前にやめる.
+	if !commitAllowEmpty && !amend && merge == nil && len(status.Staged) == 0 && (!all || len(status.Unstaged) == 0) {
+		return "", repo.ErrNothingToCommit
+	}
+	if all {
+		staged := map[string]struct{}{}
+		for _, change := range status.Staged {
+			staged[change.Path] = struct{}{}
+		}
+		for _, change := range status.Unstaged {
+			if _, ok := staged[change.Path]; !ok {
+				status.Staged = append(status.Staged, change)
+			}
+		}
+		sort.Slice(status.Staged, func(i, j int) bool { return status.Staged[i].Path < status.Staged[j].Path })
+		status.Unstaged = nil
+	}
+	var summary bytes.Buffer
+	fmt.Fprintln(&summary, i18n.T("Please enter the commit message for your changes. Lines starting"))
+	fmt.Fprintln(&summary, i18n.T("with '#' will be ignored, and an empty message aborts the commit."))
+	fmt.Fprintln(&summary)
+	if err := printStatus(&summary, r, status, false); err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(strings.TrimRight(summary.String(), "\n"), "\n") {
+		switch {
+		case line == "":
+			buf.WriteString("#\n")
+		case strings.HasPrefix(line, "\t"):
+			buf.WriteString("#" + line + "\n")
+		default:
+			buf.WriteString("# " + line + "\n")
+		}
+	}
+
+	path := client.CommitEditMsgPath()
+	if err := ioutil.WriteFile(path, []byte(buf.String()), 0644); err != nil {
+		return "", err
+	}
+	if err := launchEditor(client, path); err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return repo.CleanupMessage(repo.StripComments(string(data))), nil
+}
+
+// nothingToCommitは、errがコミットする変更がないことを表していれば、gitと同じく状態を表示して終了コード1で終わる.
+// --amendのときとそれ以外のエラーはそのまま返す.
+func nothingToCommit(cmd *cobra.Command, r *repo.Repository, err error) error {
+	if !errors.Is(err, repo.ErrNothingToCommit) || commitAmend {
+		return err
+	}
+	status, statusErr := r.Status()
+	if statusErr != nil {
+		return err
+	}
+	if printErr := printStatus(cmd.OutOrStdout(), r, status, false); printErr != nil {
+		return err
+	}
+	return &exitError{code: 1}
+}
+
+// commitIdentityは作者とコミッターの署名を作る. 名前かメールアドレスが分からなければ、設定の方法を表示してエラーを返す.
+func commitIdentity(client *store.Client, stderr io.Writer) (author, committer object.Signature, err error) {
+	if author, err = client.Identity(store.Author); err == nil {
+		committer, err = client.Identity(store.Committer)
+	}
+	printIdentityHint(stderr, err)
+	return author, committer, err
+}
+
+// printIdentityHintはerrが名前かメールアドレスが分からないことを表していれば、設定の方法を表示する.
+func printIdentityHint(stderr io.Writer, err error) {
+	if errors.Is(err, store.ErrNoIdentity) {
+		fmt.Fprint(stderr, i18n.Sprintf("\n*** Please tell me who you are.\n\nRun\n\n  fsegit config --global user.email \"you@example.com\"\n  fsegit config --global user.name \"Your Name\"\n\nto set your account's default identity.\nOmit --global to set the identity only in this repository.\n"))
+		fmt.Fprintln(stderr)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(commitCmd)
+
+	commitCmd.Flags().StringArrayVarP(&commitMessages, "message", "m", nil, "use the given message as the commit message")
+	commitCmd.Flags().StringVarP(&commitFile, "file", "F", "", "read the commit message from the given file")
+	commitCmd.Flags().BoolVar(&commitAmend, "amend", false, "replace the HEAD commit with a new commit")
+	commitCmd.Flags().BoolVarP(&commitAll, "all", "a", false, "stage modified and deleted tracked files before committing")
+	commitCmd.Flags().BoolVar(&commitAllowEmpty, "allow-empty", false, "allow a commit that does not change the tree")
+	commitCmd.Flags().BoolVarP(&commitSign, "gpg-sign", "S", false, "sign the commit")
+	commitCmd.Flags().BoolVar(&commitNoSign, "no-gpg-sign", false, "do not sign the commit even if commit.gpgSign is set")
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/spf13/cobra"
+)
+
+var commitGraphQuiet bool
+
+// commitGraphCmd represents the commit-graph command
+var commitGraphCmd = &cobra.Command{
+	Use:   "commit-graph write [-q]",
+	Short: "Write the commit-graph file",
+	Long: `The commit-graph file (objects/info/commit-graph) stores the tree, parents,
+generation number and commit date of every commit in a compact table in the
+same format as Git. Commands that look up parents, such as merge-base, merge,
+rebase and branch -d, read it instead of decompressing commit objects, and
+skip parts of the history that cannot contain the commit they look for.
+
+Commits made after the file was written are read from their objects as usual.
+Set core.commitGraph to false to ignore the file.`,
+	Args: cobra.NoArgs,
+}
+
+// commitGraphWriteCmd represents the commit-graph write command
+var commitGraphWriteCmd = &cobra.Command{
+	Use:   "write [-q]",
+	Short: "Write the commit-graph file for all reachable commits",
+	Long: `Rewrite the commit-graph file with every commit reachable from the refs, HEAD,
+ORIG_HEAD, MERGE_HEAD and FETCH_HEAD. Commits already in the old file are
+copied without reading their objects.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		n, err := client.WriteCommitGraph()
+		if err != nil {
+			return err
+		}
+		if !commitGraphQuiet {
+			fmt.Fprintln(cmd.OutOrStdout(), i18n.Sprintf("Wrote commit-graph with %d commits", n))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(commitGraphCmd)
+	commitGraphCmd.AddCommand(commitGraphWriteCmd)
+
+	commitGraphWriteCmd.Flags().BoolVarP(&commitGraphQuiet, "quiet", "q", false, "suppress the summary")
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/revparse"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/spf13/cobra"
+)
+
+var (
+	commitTreeParents  []string
+	commitTreeMessages []string
+	commitTreeFile     string
+)
+
+// commitTreeCmd represents the commit-tree command
+var commitTreeCmd = &cobra.Command{
+	Use:   "commit-tree <tree> [-p <parent>]... [-m <message>]... [-F <file>]",
+	Short: "Create a new commit object",
+	Long: `Create a commit object that records <tree> with the given parents and print
+its hash. No ref is updated, not even HEAD; use update-ref to point a branch at
+the new commit.
+
+Each -p adds a parent, in order, and a parent given twice is used once. Several
+-m options are joined as separate paragraphs. -F reads the message from a file,
+or from standard input if the file is "-". Without -m and -F the message is
+read from standard input.
+
+The author and committer are determined in the same way as for commit.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		tree, err := revparse.Resolve(client, args[0]+"^{tree}")
+		if err != nil {
+			return err
+		}
+		var parents []sha.SHA1
+	parents:
+		for _, arg := range commitTreeParents {
+			parent, err := revparse.Resolve(client, arg+"^{commit}")
+			if err != nil {
+				return err
+			}
+			for _, p := range parents {
+				if bytes.Equal(p, parent) {
+					continue parents
+				}
+			}
+			parents = append(parents, parent)
+		}
+
+		message := strings.Join(commitTreeMessages, "\n\n")
+		switch {
+		case commitTreeFile == "-" || commitTreeFile == "" && len(commitTreeMessages) == 0:
+			data, err := ioutil.ReadAll(cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+			message = string(data)
+		case commitTreeFile != "":
+			if len(commitTreeMessages) > 0 {
+				return i18n.Errorf("-m and -F cannot be used together")
+			}
+			data, err := ioutil.ReadFile(resolvePath(commitTreeFile))
+			if err != nil {
+				return err
+			}
+			message = string(data)
+		}
+		// gitのcommit-treeと同じく、メッセージの中身はそのまま記録し、末尾の改行だけをそろえる.
+		if message != "" && !strings.HasSuffix(message, "\n") {
+			message += "\n"
+		}
+
+		author, committer, err := commitIdentity(client, cmd.ErrOrStderr())
+		if err != nil {
+			return err
+		}
+		commit := object.Commit{
+			Tree:      tree,
+			Parents:   parents,
+			Author:    author,
+			Committer: committer,
+			Message:   message,
+		}
+		hash, err := client.StoreRaw(object.CommitObject, commit.Encode())
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), hash)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(commitTreeCmd)
+
+	commitTreeCmd.Flags().StringArrayVarP(&commitTreeParents, "parent", "p", nil, "add a parent commit")
+	commitTreeCmd.Flags().StringArrayVarP(&commitTreeMessages, "message", "m", nil, "use the given message as the commit message")
+	commitTreeCmd.Flags().StringVarP(&commitTreeFile, "file", "F", "", "read the commit message from the given file")
+}
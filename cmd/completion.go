@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/store"
+	"github.com/spf13/cobra"
+)
+
+// 補完候補の計算はPersistentPreRunEを通らないので、-Cの適用とリポジトリを開く処理をここで行う.
+// リポジトリの外や壊れたリポジトリでは候補を出さずにファイル名の補完もしない.
+func completionClient() (*store.Client, bool) {
+	if err := applyChdir(); err != nil {
+		return nil, false
+	}
+	client, err := newClient()
+	if err != nil {
+		return nil, false
+	}
+	return client, true
+}
+
+// completeRefsはブランチ名、タグ名、リモート追跡ブランチ名を短い名前で補完する.
+func completeRefs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	client, ok := completionClient()
+	if !ok {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	// "a..b"や"^a"の形式は記号の後ろの部分だけを補完する.
+	prefix := ""
+	if i := strings.LastIndex(toComplete, ".."); i >= 0 {
+		prefix, toComplete = toComplete[:i+2], toComplete[i+2:]
+	} else if strings.HasPrefix(toComplete, "^") {
+		prefix, toComplete = "^", toComplete[1:]
+	}
+
+	var names []string
+	if strings.HasPrefix("HEAD", toComplete) {
+		names = append(names, prefix+"HEAD")
+	}
+	for _, namespace := range []string{"refs/heads/", "refs/tags/", "refs/remotes/"} {
+		refs, err := client.ListRefs(namespace)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		for _, ref := range refs {
+			name := strings.TrimPrefix(ref.Name, namespace)
+			if strings.HasPrefix(name, toComplete) {
+				names = append(names, prefix+name)
+			}
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeRemotesは最初の引数としてリモートの名前を補完する.
+func completeRemotes(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	client, ok := completionClient()
+	if !ok {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	remotes, err := client.ListRemotes()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var names []string
+	for _, remote := range remotes {
+		if strings.HasPrefix(remote.Name, toComplete) {
+			names = append(names, remote.Name)
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeTrackedPathsはHEADのツリーに含まれるパスを補完する.
+// 入力済みの部分の次のディレクトリまでを候補にして、候補の数を抑える.
+func completeTrackedPaths(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	client, ok := completionClient()
+	if !ok {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+	head, err := client.ResolveRef("HEAD")
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+
+	seen := map[string]struct{}{}
+	if err := client.WalkTree(head, nil, func(path string, entry object.TreeEntry) error {
+		if !strings.HasPrefix(path, toComplete) {
+			return nil
+		}
+		if i := strings.IndexByte(path[len(toComplete):], '/'); i >= 0 {
+			path = path[:len(toComplete)+i+1]
+		}
+		seen[path] = struct{}{}
+		return nil
+	}); err != nil {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+
+	directive := cobra.ShellCompDirectiveNoFileComp
+	paths := make([]string, 0, len(seen))
+	for path := range seen {
+		// ディレクトリの候補は続けて入力できるように空白を入れない.
+		if strings.HasSuffix(path, "/") {
+			directive |= cobra.ShellCompDirectiveNoSpace
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths, directive
+}
@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/kanon1343/fsegit/config"
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/spf13/cobra"
+)
+
+var (
+	configGlobal   bool
+	configSystem   bool
+	configLocal    bool
+	configFile     string
+	configGetAll   bool
+	configAdd      bool
+	configUnset    bool
+	configUnsetAll bool
+	configList     bool
+)
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config [<scope>] [--get-all | --add | --unset | --unset-all | -l] [<name> [<value>]]",
+	Short: "Get and set repository or global options",
+	Long: `With <name>, print the value of the option (the last one if it is set more
+than once, all of them with --get-all). With <name> and <value>, set the
+option, or add another value with --add. --unset and --unset-all remove the
+option. -l lists all options as <name>=<value>.
+
+Options are read from the system config (/etc/gitconfig), the global config
+(~/.gitconfig or ~/.config/git/config) and the repository config
+(.fsegit/config), with later ones taking precedence. Writes go to the
+repository config unless another scope is chosen with --global, --system or
+-f <file>.
+
+Exits with status 1 if the option to get is not set and with status 5 if the
+option to unset is not set.`,
+	Args: cobra.MaximumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		scopes := 0
+		for _, set := range []bool{configGlobal, configSystem, configLocal, configFile != ""} {
+			if set {
+				scopes++
+			}
+		}
+		if scopes > 1 {
+			return i18n.Errorf("only one config file at a time")
+		}
+		actions := 0
+		for _, set := range []bool{configGetAll, configAdd, configUnset, configUnsetAll, configList} {
+			if set {
+				actions++
+			}
+		}
+		if actions > 1 {
+			return i18n.Errorf("only one action at a time")
+		}
+
+		switch {
+		case configList:
+			if len(args) != 0 {
+				return i18n.Errorf("wrong number of arguments, should be %d", 0)
+			}
+			cfg, err := readConfig()
+			if err != nil {
+				return err
+			}
+			for _, entry := range cfg.Entries() {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s=%s\n", entry.Key, entry.Value)
+			}
+			return nil
+
+		case configUnset || configUnsetAll:
+			if len(args) != 1 {
+				return i18n.Errorf("wrong number of arguments, should be %d", 1)
+			}
+			return editConfig(func(d *config.Document) error {
+				n := d.Count(args[0])
+				if n > 1 && !configUnsetAll {
+					return i18n.Errorf("%s has multiple values", args[0])
+				}
+				if _, err := d.Unset(args[0]); err != nil {
+					return err
+				}
+				if n == 0 {
+					return &exitError{code: 5}
+				}
+				return nil
+			})
+
+		case len(args) == 2:
+			return editConfig(func(d *config.Document) error {
+				if configAdd {
+					return d.Add(args[0], args[1])
+				}
+				if d.Count(args[0]) > 1 {
+					return i18n.Errorf("cannot overwrite multiple values with a single value")
+				}
+				return d.Set(args[0], args[1])
+			})
+
+		case len(args) == 1 && !configAdd:
+			if err := config.CheckKey(args[0]); err != nil {
+				return err
+			}
+			cfg, err := readConfig()
+			if err != nil {
+				return err
+			}
+			values := cfg.GetAll(args[0])
+			if len(values) == 0 {
+				return &exitError{code: 1}
+			}
+			if !configGetAll {
+				values = values[len(values)-1:]
+			}
+			for _, value := range values {
+				fmt.Fprintln(cmd.OutOrStdout(), value)
+			}
+			return nil
+		}
+		return i18n.Errorf("wrong number of arguments, should be %d", 2)
+	},
+}
+
+// configPathは--globalなどで選んだ設定ファイルを返す. 選んでいなければリポジトリの設定ファイルを返す.
+func configPath() (string, error) {
+	switch {
+	case configFile != "":
+		return resolvePath(configFile), nil
+	case configSystem:
+		return config.SystemPath(), nil
+	case configGlobal:
+		path := config.GlobalPath()
+		if path == "" {
+			return "", i18n.Errorf("$HOME not set")
+		}
+		return path, nil
+	}
+	client, err := newClient()
+	if err != nil {
+		return "", err
+	}
+	return client.ConfigPath(), nil
+}
+
+// readConfigは設定を読み込む. 設定ファイルを選んでいなければ全ての設定を重ね、
+// リポジトリの外ではシステム全体と利用者全体の設定だけを読む.
+func readConfig() (*config.Config, error) {
+	if configGlobal || configSystem || configLocal || configFile != "" {
+		if configGlobal {
+			return config.LoadGlobal()
+		}
+		path, err := configPath()
+		if err != nil {
+			return nil, err
+		}
+		return config.Load(path)
+	}
+	client, err := newClient()
+	if err != nil {
+		return config.LoadDefaults()
+	}
+	return client.Config()
+}
+
+// editConfigは選んだ設定ファイルをeditで書き換える.
+func editConfig(edit func(d *config.Document) error) error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	return config.UpdateFile(path, edit)
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+
+	configCmd.Flags().BoolVar(&configGlobal, "global", false, "use the global config file")
+	configCmd.Flags().BoolVar(&configSystem, "system", false, "use the system config file")
+	configCmd.Flags().BoolVar(&configLocal, "local", false, "use the repository config file")
+	configCmd.Flags().StringVarP(&configFile, "file", "f", "", "use the given config file")
+	configCmd.Flags().BoolVar(&configGetAll, "get-all", false, "print all values of a multi-valued option")
+	configCmd.Flags().BoolVar(&configAdd, "add", false, "add a value without replacing the existing ones")
+	configCmd.Flags().BoolVar(&configUnset, "unset", false, "remove an option")
+	configCmd.Flags().BoolVar(&configUnsetAll, "unset-all", false, "remove all values of an option")
+	configCmd.Flags().BoolVarP(&configList, "list", "l", false, "list all options")
+	configCmd.MarkFlagFilename("file")
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/store"
+	"github.com/spf13/cobra"
+)
+
+var (
+	describeTags   bool
+	describeLong   bool
+	describeAlways bool
+	describeAbbrev int
+)
+
+// describeCmd represents the describe command
+var describeCmd = &cobra.Command{
+	Use:   "describe [--tags] [--long] [--always] [--abbrev=<n>] [<commit>]",
+	Short: "Describe a commit by the nearest tag reachable from it",
+	Long: `Describe the given commit (HEAD by default) by the nearest annotated tag
+reachable from it, as <tag>-<n>-g<hash>: n is the number of commits on top of
+the tag and hash the abbreviated commit hash. When the commit is tagged, only
+the tag name is shown.
+
+Like git, the history is searched newest commit date first, and the tag
+closest to the commit among the first 10 tags found is used. When several
+tags point at the same commit, a newer annotated tag is preferred.
+
+--tags also uses lightweight tags. --long always shows the number of commits
+and the hash, even when the commit is tagged. --always shows the abbreviated
+hash when no tag can describe the commit. --abbrev sets the number of hex
+digits of the hash; with 0 only the tag name is shown.`,
+	ValidArgsFunction: completeRefs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) > 1 {
+			return i18n.Errorf("too many arguments")
+		}
+		if describeAbbrev < 0 {
+			describeAbbrev = 0
+		} else if describeAbbrev > 0 && describeAbbrev < 4 {
+			describeAbbrev = 4
+		}
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		name := "HEAD"
+		if len(args) == 1 {
+			name = args[0]
+		}
+		hash, err := resolveCommitish(client, name)
+		if err != nil {
+			return err
+		}
+		out := cmd.OutOrStdout()
+		desc, err := client.Describe(hash, store.DescribeOptions{Tags: describeTags})
+		if errors.Is(err, store.ErrNoDescription) && describeAlways {
+			commit, err := client.PeelToCommit(hash)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(out, abbrevHash(commit.String(), describeAbbrev))
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if describeAbbrev == 0 || (desc.Distance == 0 && !describeLong) {
+			fmt.Fprintln(out, desc.Tag)
+			return nil
+		}
+		fmt.Fprintf(out, "%s-%d-g%s\n", desc.Tag, desc.Distance, abbrevHash(desc.Commit.String(), describeAbbrev))
+		return nil
+	},
+}
+
+// abbrevHashはhashを先頭のn文字にする. nが0ならhashをそのまま返す.
+func abbrevHash(hash string, n int) string {
+	if n == 0 || n >= len(hash) {
+		return hash
+	}
+	return hash[:n]
+}
+
+func init() {
+	rootCmd.AddCommand(describeCmd)
+
+	describeCmd.Flags().BoolVar(&describeTags, "tags", false, "use lightweight tags as well as annotated tags")
+	describeCmd.Flags().BoolVar(&describeLong, "long", false, "always show the number of commits and the hash")
+	describeCmd.Flags().BoolVar(&describeAlways, "always", false, "show the abbreviated hash when no tag can describe the commit")
+	describeCmd.Flags().IntVar(&describeAbbrev, "abbrev", 7, "the number of hex digits of the abbreviated hash")
+}
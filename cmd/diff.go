@@ -0,0 +1,342 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kanon1343/fsegit/diff"
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+	"github.com/spf13/cobra"
+)
+
+var (
+	diffCached     bool
+	diffContext    int
+	diffNameOnly   bool
+	diffNameStatus bool
+	diffRenames    string
+	diffNoRenames  bool
+	diffColor      string
+	diffWordDiff   string
+)
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff [--cached] [<commit> [<commit>]] [-- <path>...]",
+	Short: "Show changes between commits, the index and the working tree",
+	Long: `Show the changes as a unified diff.
+
+  diff                      working tree relative to the index
+  diff --cached [<commit>]  index relative to HEAD or <commit>
+  diff <commit>             working tree relative to <commit>
+  diff <commit> <commit>    between two commits
+
+Paths after "--" limit the output to matching files. -U sets the number of
+context lines around each change.
+
+A deleted file and an added file whose contents are at least 50% similar are
+shown as a rename. --find-renames=<n> (or -M=<n>) changes the threshold to
+<n>, given as 75% or as 75 for 0.75, and --no-renames turns the detection
+off. diff.renames=false in the config turns it off by default.
+
+--color=<when> colors the output: always, never, or auto (the default) to
+color it only when writing to a terminal and NO_COLOR is not set. color.diff
+or color.ui in the config changes the default. --word-diff shows changed
+lines as words, marking removed words as [-...-] and added ones as {+...+};
+--word-diff=color marks them with colors instead.`,
+	ValidArgsFunction: completeRefs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		revs, paths := args, []string(nil)
+		if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+			revs, paths = args[:dash], args[dash:]
+		}
+		ps, err := parsePathspec(client, paths)
+		if err != nil {
+			return err
+		}
+
+		var commits []sha.SHA1
+		for _, rev := range revs {
+			hash, err := resolveCommitish(client, rev)
+			if err != nil {
+				return err
+			}
+			if hash, err = client.PeelToCommit(hash); err != nil {
+				return err
+			}
+			commits = append(commits, hash)
+		}
+
+		var changes []store.TreeChange
+		// fromWorktreeは変更後の内容を作業ツリーから読むパス.
+		fromWorktree := map[string]bool{}
+		switch {
+		case len(commits) > 2 || (diffCached && len(commits) > 1):
+			return i18n.Errorf("too many arguments")
+		case len(commits) == 2:
+			if changes, err = client.DiffTrees(commits[0], commits[1], ps); err != nil {
+				return err
+			}
+		default:
+			index, err := client.ReadIndex()
+			if err != nil {
+				return err
+			}
+			if diffCached || len(commits) == 1 {
+				tree, err := diffBaseTree(client, commits)
+				if err != nil {
+					return err
+				}
+				if changes, err = client.DiffTreeIndex(tree, index); err != nil {
+					return err
+				}
+			}
+			if !diffCached {
+				unstaged, err := client.DiffIndexWorktree(index)
+				if err != nil {
+					return err
+				}
+				changes = combineChanges(changes, unstaged)
+				for _, change := range unstaged {
+					fromWorktree[change.Path] = change.Type != store.ChangeDelete
+				}
+			}
+		}
+		if changes, err = findRenames(client, changes, diffRenames, diffNoRenames, "diff.renames"); err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		opts := diff.Options{Context: diffContext}
+		if opts.Color, err = colorEnabled(client, out, diffColor, "color.diff"); err != nil {
+			return err
+		}
+		switch diffWordDiff {
+		case "":
+		case "plain":
+			opts.WordDiff = diff.WordDiffPlain
+		case "color":
+			opts.WordDiff, opts.Color = diff.WordDiffColor, true
+		default:
+			return i18n.Errorf("invalid --word-diff mode %q", diffWordDiff)
+		}
+		for _, change := range changes {
+			oldPath := change.Path
+			if change.Type == store.ChangeRename {
+				oldPath = change.OldPath
+			}
+			if !ps.Match(change.Path) && !ps.Match(oldPath) {
+				continue
+			}
+			switch {
+			case diffNameOnly:
+				fmt.Fprintln(out, change.Path)
+				continue
+			case diffNameStatus && change.Type == store.ChangeRename:
+				fmt.Fprintf(out, "%s%03d\t%s\t%s\n", change.Type, change.Similarity, oldPath, change.Path)
+				continue
+			case diffNameStatus:
+				fmt.Fprintf(out, "%s\t%s\n", change.Type, change.Path)
+				continue
+			}
+
+			file := diff.File{
+				OldPath:    oldPath,
+				NewPath:    change.Path,
+				OldMode:    change.OldMode,
+				NewMode:    change.NewMode,
+				OldHash:    change.OldHash,
+				NewHash:    change.NewHash,
+				Similarity: change.Similarity,
+			}
+			if file.Old, err = diffContent(client, oldPath, change.OldMode, change.OldHash, false); err != nil {
+				return err
+			}
+			if file.New, err = diffContent(client, change.Path, change.NewMode, change.NewHash, fromWorktree[change.Path]); err != nil {
+				return err
+			}
+			if err := diff.WriteUnified(out, file, opts); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// diffBaseTreeはdiff --cachedなどで比較の基準にするコミットを返す. 指定がなければHEAD、まだコミットがなければnil.
+func diffBaseTree(client *store.Client, commits []sha.SHA1) (sha.SHA1, error) {
+	if len(commits) == 1 {
+		return commits[0], nil
+	}
+	head, err := client.ReadHead()
+	if err != nil {
+		return nil, err
+	}
+	return head.Hash, nil
+}
+
+// combineChangesはツリーからインデックスへの変更stagedと、インデックスから作業ツリーへの変更unstagedを
+// つなげて、ツリーから作業ツリーへの変更にする. stagedが空ならunstagedそのものになる.
+func combineChanges(staged, unstaged []store.TreeChange) []store.TreeChange {
+	byPath := map[string]store.TreeChange{}
+	for _, change := range staged {
+		byPath[change.Path] = change
+	}
+	for _, u := range unstaged {
+		s, ok := byPath[u.Path]
+		if !ok {
+			// インデックスとツリーが同じパスなので、作業ツリーの変更がそのままツリーからの変更になる.
+			byPath[u.Path] = u
+			continue
+		}
+		switch {
+		case u.Type == store.ChangeDelete && s.Type == store.ChangeAdd:
+			delete(byPath, u.Path)
+			continue
+		case u.Type == store.ChangeDelete:
+			s.Type = store.ChangeDelete
+		}
+		s.NewMode, s.NewHash = u.NewMode, u.NewHash
+		if s.Type == store.ChangeModify && s.OldMode == s.NewMode && bytes.Equal(s.OldHash, s.NewHash) {
+			delete(byPath, u.Path)
+			continue
+		}
+		byPath[u.Path] = s
+	}
+
+	changes := make([]store.TreeChange, 0, len(byPath))
+	for _, change := range byPath {
+		changes = append(changes, change)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+// findRenamesはフラグと設定に従ってchangesの中の名前の変更を探す. thresholdは-Mの値で、空なら既定の類似度を使う.
+// noRenamesか、configKeysのうち最初に設定されているもの(どれもなければtrue)がfalseなら探さない.
+func findRenames(client *store.Client, changes []store.TreeChange, threshold string, noRenames bool, configKeys ...string) ([]store.TreeChange, error) {
+	if noRenames {
+		return changes, nil
+	}
+	if threshold == "" {
+		cfg, err := client.Config()
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range configKeys {
+			if _, ok := cfg.Get(key); !ok {
+				continue
+			}
+			enabled, err := cfg.GetBool(key, true)
+			if err != nil {
+				return nil, err
+			}
+			if !enabled {
+				return changes, nil
+			}
+			break
+		}
+	}
+	score, err := parseRenameScore(threshold)
+	if err != nil {
+		return nil, err
+	}
+	return client.DetectRenames(changes, score)
+}
+
+// parseRenameScoreは-Mの値を類似度(%)にする. "75%"は75%、"75"や"0.75"のような数字は小数点以下として読む(gitと同じ).
+func parseRenameScore(s string) (int, error) {
+	if s == "" {
+		return store.DefaultRenameThreshold, nil
+	}
+	if strings.HasSuffix(s, "%") {
+		score, err := strconv.Atoi(strings.TrimSuffix(s, "%"))
+		if err != nil || score < 0 || score > 100 {
+			return 0, i18n.Errorf("invalid rename score %q", s)
+		}
+		return score, nil
+	}
+	digits := strings.TrimPrefix(s, "0.")
+	value, err := strconv.ParseUint(digits, 10, 32)
+	if err != nil || len(digits) > 9 {
+		return 0, i18n.Errorf("invalid rename score %q", s)
+	}
+	scale := uint64(1)
+	for range digits {
+		scale *= 10
+	}
+	return int(value * 100 / scale), nil
+}
+
+// treeChangeFileはツリーの間の変更changeについて、両側の内容を読んで差分を取るファイルを作る.
+func treeChangeFile(client *store.Client, change store.TreeChange) (diff.File, error) {
+	oldPath := change.Path
+	if change.Type == store.ChangeRename {
+		oldPath = change.OldPath
+	}
+	file := diff.File{
+		OldPath:    oldPath,
+		NewPath:    change.Path,
+		OldMode:    change.OldMode,
+		NewMode:    change.NewMode,
+		OldHash:    change.OldHash,
+		NewHash:    change.NewHash,
+		Similarity: change.Similarity,
+	}
+	var err error
+	if file.Old, err = diffContent(client, oldPath, change.OldMode, change.OldHash, false); err != nil {
+		return file, err
+	}
+	file.New, err = diffContent(client, change.Path, change.NewMode, change.NewHash, false)
+	return file, err
+}
+
+// diffContentは差分を取るファイルの内容を返す. modeが0(存在しない側)なら空を返す.
+func diffContent(client *store.Client, path string, mode object.FileMode, hash sha.SHA1, fromWorktree bool) ([]byte, error) {
+	switch {
+	case mode == 0:
+		return nil, nil
+	case mode == object.ModeGitlink:
+		return []byte(fmt.Sprintf("Subproject commit %s\n", hash)), nil
+	case fromWorktree:
+		info, err := os.Lstat(filepath.Join(client.WorkTree(), filepath.FromSlash(path)))
+		if err != nil {
+			return nil, err
+		}
+		return client.ReadWorktreeFile(path, info)
+	}
+	obj, err := client.GetObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	return obj.Data, nil
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+
+	diffCmd.Flags().BoolVar(&diffCached, "cached", false, "compare the index with HEAD or the given commit")
+	diffCmd.Flags().BoolVar(&diffCached, "staged", false, "synonym for --cached")
+	diffCmd.Flags().IntVarP(&diffContext, "unified", "U", diff.DefaultContext, "number of context lines")
+	diffCmd.Flags().BoolVar(&diffNameOnly, "name-only", false, "show only the names of changed files")
+	diffCmd.Flags().BoolVar(&diffNameStatus, "name-status", false, "show the names and the status of changed files")
+	diffCmd.Flags().StringVarP(&diffRenames, "find-renames", "M", "", "detect renames whose contents are at least the given percent similar")
+	diffCmd.Flags().Lookup("find-renames").NoOptDefVal = fmt.Sprintf("%d%%", store.DefaultRenameThreshold)
+	diffCmd.Flags().BoolVar(&diffNoRenames, "no-renames", false, "do not detect renames")
+	diffCmd.Flags().StringVar(&diffColor, "color", "", "color the output: always, never or auto")
+	diffCmd.Flags().Lookup("color").NoOptDefVal = "always"
+	diffCmd.Flags().StringVar(&diffWordDiff, "word-diff", "", "show changed words instead of lines: plain or color")
+	diffCmd.Flags().Lookup("word-diff").NoOptDefVal = "plain"
+}
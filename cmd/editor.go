@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/store"
+)
+
+// launchEditorはエディタでpathのファイルを開き、閉じられるまで待つ.
+// gitと同じく、エディタのコマンドは引数を含めてシェルで解釈する. Windowsでは空白で区切って直接起動する.
+func launchEditor(client *store.Client, path string) error {
+	editor, err := client.Editor()
+	if err != nil {
+		return err
+	}
+	// GIT_EDITOR=: のように何もしないエディタなら起動しない.
+	if editor == ":" {
+		return nil
+	}
+	var c *exec.Cmd
+	if runtime.GOOS == "windows" {
+		fields := strings.Fields(editor)
+		c = exec.Command(fields[0], append(fields[1:], path)...)
+	} else {
+		c = exec.Command("sh", "-c", editor+` "$@"`, editor, path)
+	}
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := c.Run(); err != nil {
+		return i18n.Errorf("there was a problem with the editor '%s': %v", editor, err)
+	}
+	return nil
+}
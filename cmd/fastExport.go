@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"os"
+	"strings"
+
+	"github.com/kanon1343/fsegit/fastexport"
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+	"github.com/spf13/cobra"
+)
+
+var (
+	fastExportAll         bool
+	fastExportExportMarks string
+	fastExportImportMarks string
+)
+
+// fastExportCmd represents the fast-export command
+var fastExportCmd = &cobra.Command{
+	Use:   "fast-export [--all] [<rev>...]",
+	Short: "Export history as a git fast-import stream",
+	Long: `Write the commits reachable from the given revisions, together with the
+blobs they touch and annotated tags, to standard output in the format read by
+git fast-import.
+
+Revisions may be ref names or full hashes; "^<rev>" and "<a>..<b>" exclude
+history that is reachable from <rev> or <a>. Use --export-marks and
+--import-marks to keep mark numbers stable across incremental exports.`,
+	ValidArgsFunction: completeRefs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+
+		var refs []fastexport.Ref
+		var exclude []sha.SHA1
+		if fastExportAll {
+			all, err := client.ListRefs("refs/")
+			if err != nil {
+				return err
+			}
+			for _, ref := range all {
+				refs = append(refs, fastexport.Ref{Name: ref.Name, Hash: ref.Hash})
+			}
+		}
+		for _, arg := range args {
+			var include, excludeName string
+			switch {
+			case strings.Contains(arg, ".."):
+				split := strings.SplitN(arg, "..", 2)
+				excludeName, include = split[0], split[1]
+			case strings.HasPrefix(arg, "^"):
+				excludeName = arg[1:]
+			default:
+				include = arg
+			}
+			if excludeName != "" {
+				ref, err := resolveExportRef(client, excludeName)
+				if err != nil {
+					return err
+				}
+				exclude = append(exclude, ref.Hash)
+			}
+			if include != "" {
+				ref, err := resolveExportRef(client, include)
+				if err != nil {
+					return err
+				}
+				refs = append(refs, ref)
+			}
+		}
+		if len(refs) == 0 {
+			return i18n.Errorf("no revisions to export")
+		}
+
+		exporter := fastexport.NewExporter(client, cmd.OutOrStdout())
+		if fastExportImportMarks != "" {
+			f, err := os.Open(resolvePath(fastExportImportMarks))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			if err == nil {
+				defer f.Close()
+				if err := exporter.ImportMarks(f); err != nil {
+					return err
+				}
+			}
+		}
+		if err := exporter.Export(refs, exclude); err != nil {
+			return err
+		}
+		if fastExportExportMarks != "" {
+			f, err := os.Create(resolvePath(fastExportExportMarks))
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return exporter.ExportMarks(f)
+		}
+		return nil
+	},
+}
+
+// resolveExportRefは参照名かハッシュを解決する. シンボリック参照は参照先の名前で書き出す.
+func resolveExportRef(client *store.Client, name string) (fastexport.Ref, error) {
+	if len(name) == 40 {
+		if hash, err := hex.DecodeString(name); err == nil {
+			return fastexport.Ref{Name: name, Hash: hash}, nil
+		}
+	}
+	fullName, err := client.DWIMRef(name)
+	if err != nil {
+		return fastexport.Ref{}, err
+	}
+	for {
+		ref, err := client.ReadRef(fullName)
+		if err != nil {
+			return fastexport.Ref{}, err
+		}
+		if ref.Target == "" {
+			return fastexport.Ref{Name: fullName, Hash: ref.Hash}, nil
+		}
+		fullName = ref.Target
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(fastExportCmd)
+
+	fastExportCmd.Flags().BoolVar(&fastExportAll, "all", false, "export all refs")
+	fastExportCmd.Flags().StringVar(&fastExportExportMarks, "export-marks", "", "write the mark table to this file when done")
+	fastExportCmd.Flags().StringVar(&fastExportImportMarks, "import-marks", "", "read a mark table written by --export-marks")
+	fastExportCmd.MarkFlagFilename("export-marks")
+	fastExportCmd.MarkFlagFilename("import-marks")
+}
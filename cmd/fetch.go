@@ -0,0 +1,344 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+	"github.com/kanon1343/fsegit/transport"
+	"github.com/spf13/cobra"
+)
+
+var (
+	fetchDepth int
+	fetchQuiet bool
+)
+
+// fetchCmd represents the fetch command
+var fetchCmd = &cobra.Command{
+	Use:   "fetch [--depth <n>] [-q] [<remote>]",
+	Short: "Download objects and refs from a remote",
+	Long: `Fetch the branches of <remote> (origin by default) over the smart HTTP
+protocol and update the remote-tracking branches given by the remote's fetch
+refspecs, usually refs/remotes/<remote>/*.
+
+Only objects that are missing locally are downloaded: the local branches are
+sent as "have" lines so that the remote can leave out what we already have.
+Tags that point into the fetched history, or at commits that are already
+present, are fetched as well. A remote-tracking branch that would not be
+fast-forwarded is only updated if its refspec starts with "+". The fetched refs are recorded in FETCH_HEAD.
+
+In a shallow repository the boundary commits in .git/shallow are sent to the
+remote and updated with what it reports. --depth limits the fetched history to
+the last <n> commits of each branch, and can also deepen a shallow repository.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: completeRemotes,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if fetchDepth < 0 {
+			return i18n.Errorf("depth %d is not a positive number", fetchDepth)
+		}
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		name := store.DefaultRemote
+		if len(args) == 1 {
+			name = args[0]
+		}
+		rejected, err := fetch(cmd.Context(), client, name, fetchDepth, cmd.ErrOrStderr(), fetchQuiet)
+		if err != nil {
+			return err
+		}
+		if rejected {
+			return &exitError{code: 1}
+		}
+		return nil
+	},
+}
+
+// refUpdateはfetchで更新する1つの参照.
+type refUpdate struct {
+	// srcはリモートでの名前、dstは手元での名前. dstが空ならFETCH_HEADにだけ記録する.
+	src, dst string
+	hash     sha.SHA1
+	force    bool
+}
+
+// fetchはリモートnameから参照とオブジェクトを取得して手元の参照を更新する. depthが正なら、
+// それぞれのブランチの先頭からdepth個のコミットまでの浅い履歴にする.
+// 早送りできずに更新を拒否した参照があればrejectedにtrueを返す.
+func fetch(ctx context.Context, client *store.Client, name string, depth int, stderr io.Writer, quiet bool) (rejected bool, err error) {
+	remote, err := client.ReadRemote(name)
+	if err != nil {
+		return false, err
+	}
+	var specs []store.RefSpec
+	for _, s := range remote.Fetch {
+		spec, err := store.ParseRefSpec(s)
+		if err != nil {
+			return false, err
+		}
+		specs = append(specs, spec)
+	}
+
+	conn := transport.NewRemote(remote.URL)
+	if !quiet {
+		conn.Progress = stderr
+	}
+	adv, err := conn.ListRefsContext(ctx, "git-upload-pack")
+	if err != nil {
+		return false, err
+	}
+
+	var updates []refUpdate
+	var tags []refUpdate
+	for _, ref := range adv.Refs {
+		// 不正な名前の参照は、".."などで管理ディレクトリの外に書き込まれないように無視する.
+		if err := store.CheckRefName(ref.Name); err != nil {
+			if !quiet {
+				fmt.Fprintln(stderr, i18n.Sprintf("warning: ignoring ref with broken name %s", ref.Name))
+			}
+			continue
+		}
+		matched := false
+		for _, spec := range specs {
+			if dst, ok := spec.Match(ref.Name); ok && store.CheckRefName(dst) == nil {
+				updates = append(updates, refUpdate{src: ref.Name, dst: dst, hash: ref.Hash, force: spec.Force})
+				matched = true
+			}
+		}
+		// 手元にないタグは、取得した履歴の中を指していれば後で追加する.
+		if !matched && strings.HasPrefix(ref.Name, "refs/tags/") {
+			if _, err := client.ResolveRef(ref.Name); err != nil {
+				tags = append(tags, refUpdate{src: ref.Name, dst: ref.Name, hash: ref.Hash})
+			}
+		}
+	}
+
+	var wants []sha.SHA1
+	seen := map[string]bool{}
+	// include-tagは送られてくるパックの中を指すタグしか付けないので、既に手元にあるコミットを指す
+	// 注釈付きタグは、広告の"^{}"の行で指す先を確かめて自分で要求する.
+	for _, ref := range adv.Refs {
+		if ref.Peeled == nil || !isFollowedTag(tags, ref.Name) || seen[string(ref.Hash)] {
+			continue
+		}
+		hasTag, err := client.HasObject(ref.Hash)
+		if err != nil {
+			return false, err
+		}
+		hasTarget, err := client.HasObject(ref.Peeled)
+		if err != nil {
+			return false, err
+		}
+		if !hasTag && hasTarget {
+			seen[string(ref.Hash)] = true
+			wants = append(wants, ref.Hash)
+		}
+	}
+	for _, update := range updates {
+		if seen[string(update.hash)] {
+			continue
+		}
+		seen[string(update.hash)] = true
+		// 手元にあるオブジェクトは要求しない. 浅い履歴を深くするときは、手元にあるコミットも要求し直す.
+		ok, err := client.HasObject(update.hash)
+		if err != nil {
+			return false, err
+		}
+		if depth > 0 || !ok {
+			wants = append(wants, update.hash)
+		}
+	}
+	if len(wants) > 0 {
+		haves, err := client.Haves()
+		if err != nil {
+			return false, err
+		}
+		shallow, err := client.ReadShallow()
+		if err != nil {
+			return false, err
+		}
+		packData, update, err := conn.FetchPackWithOptions(ctx, adv, wants, haves, transport.FetchOptions{Depth: depth, Shallow: shallow})
+		if err != nil {
+			return false, err
+		}
+		_, err = client.IndexPack(packData)
+		packData.Close()
+		if err != nil {
+			return false, err
+		}
+		if update != nil {
+			if err := client.UpdateShallow(update.Shallow, update.Unshallow); err != nil {
+				return false, err
+			}
+		}
+	}
+	for _, tag := range tags {
+		ok, err := client.HasObject(tag.hash)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			updates = append(updates, tag)
+		}
+	}
+
+	lines, rejected, err := applyRefUpdates(client, updates)
+	if err != nil {
+		return false, err
+	}
+	if err := writeFetchHead(client, remote, updates); err != nil {
+		return false, err
+	}
+	if len(lines) > 0 && !quiet {
+		fmt.Fprintln(stderr, i18n.Sprintf("From %s", remote.URL))
+		printRefUpdateLines(stderr, lines)
+	}
+	return rejected, nil
+}
+
+// isFollowedTagはnameがfetchで後から追加するタグの1つかを返す.
+func isFollowedTag(tags []refUpdate, name string) bool {
+	for _, tag := range tags {
+		if tag.src == name {
+			return true
+		}
+	}
+	return false
+}
+
+// refUpdateLineはfetchやpushで参照ごとに表示する1行.
+type refUpdateLine struct {
+	flag    byte
+	summary string
+	from    string
+	to      string
+	note    string
+}
+
+// applyRefUpdatesはupdatesを手元の参照に書き込み、表示する行を返す.
+func applyRefUpdates(client *store.Client, updates []refUpdate) ([]refUpdateLine, bool, error) {
+	var lines []refUpdateLine
+	rejected := false
+	for _, update := range updates {
+		if update.dst == "" {
+			continue
+		}
+		line := refUpdateLine{from: shortRefName(update.src), to: shortRefName(update.dst)}
+		message := "fetch: storing head"
+		old, err := client.ResolveRef(update.dst)
+		switch {
+		case err != nil:
+			line.flag = '*'
+			switch {
+			case strings.HasPrefix(update.dst, "refs/tags/"):
+				line.summary = i18n.Sprintf("[new tag]")
+			case strings.HasPrefix(update.src, "refs/heads/"):
+				line.summary = i18n.Sprintf("[new branch]")
+			default:
+				line.summary = i18n.Sprintf("[new ref]")
+			}
+		case bytes.Equal(old, update.hash):
+			continue
+		default:
+			ancestor, err := client.IsAncestor(old, update.hash)
+			if err != nil {
+				ancestor = false
+			}
+			switch {
+			case ancestor:
+				line.flag = ' '
+				line.summary = old.String()[:7] + ".." + update.hash.String()[:7]
+				message = "fetch: fast-forward"
+			case update.force:
+				line.flag = '+'
+				line.summary = old.String()[:7] + "..." + update.hash.String()[:7]
+				line.note = i18n.Sprintf("(forced update)")
+				message = "fetch: forced-update"
+			default:
+				line.flag = '!'
+				line.summary = i18n.Sprintf("[rejected]")
+				line.note = i18n.Sprintf("(non-fast-forward)")
+				rejected = true
+				lines = append(lines, line)
+				continue
+			}
+		}
+		if err := client.UpdateRef(update.dst, update.hash, message); err != nil {
+			return nil, false, err
+		}
+		lines = append(lines, line)
+	}
+	return lines, rejected, nil
+}
+
+// printRefUpdateLinesはgitと同じく、要約と参照の名前の列を揃えて表示する.
+func printRefUpdateLines(w io.Writer, lines []refUpdateLine) {
+	width := 0
+	for _, line := range lines {
+		if len(line.from) > width {
+			width = len(line.from)
+		}
+	}
+	for _, line := range lines {
+		// 削除した参照はリモートでの名前だけを表示する.
+		text := fmt.Sprintf(" %c %-17s %s", line.flag, line.summary, line.to)
+		if line.from != "" {
+			text = fmt.Sprintf(" %c %-17s %-*s -> %s", line.flag, line.summary, width, line.from, line.to)
+		}
+		if line.note != "" {
+			text += "  " + line.note
+		}
+		fmt.Fprintln(w, text)
+	}
+}
+
+// writeFetchHeadは取得したブランチとタグをFETCH_HEADに記録する.
+// 現在のブランチの上流(branch.<name>.mergeとbranch.<name>.remote)に当たる参照だけをマージの対象にする.
+func writeFetchHead(client *store.Client, remote *store.Remote, updates []refUpdate) error {
+	cfg, err := client.Config()
+	if err != nil {
+		return err
+	}
+	mergeRef := ""
+	if head, err := client.ReadHead(); err == nil && head.Branch != "" {
+		branch := strings.TrimPrefix(head.Branch, "refs/heads/")
+		if r, _ := cfg.Get("branch." + branch + ".remote"); r == remote.Name {
+			mergeRef, _ = cfg.Get("branch." + branch + ".merge")
+		}
+	}
+
+	var entries []store.FetchHeadEntry
+	for _, update := range updates {
+		kind, name := "branch", strings.TrimPrefix(update.src, "refs/heads/")
+		switch {
+		case strings.HasPrefix(update.src, "refs/tags/"):
+			kind, name = "tag", strings.TrimPrefix(update.src, "refs/tags/")
+		case !strings.HasPrefix(update.src, "refs/heads/"):
+			kind = ""
+		}
+		description := fmt.Sprintf("'%s' of %s", name, remote.URL)
+		if kind != "" {
+			description = kind + " " + description
+		}
+		entries = append(entries, store.FetchHeadEntry{
+			Hash:        update.hash,
+			NotForMerge: update.src != mergeRef,
+			Description: description,
+		})
+	}
+	return client.WriteFetchHead(entries)
+}
+
+func init() {
+	rootCmd.AddCommand(fetchCmd)
+
+	fetchCmd.Flags().IntVar(&fetchDepth, "depth", 0, "limit the history to the last <n> commits of each branch")
+	fetchCmd.Flags().BoolVarP(&fetchQuiet, "quiet", "q", false, "suppress progress and ref update messages")
+}
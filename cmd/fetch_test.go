@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+	"github.com/kanon1343/fsegit/transport"
+)
+
+// storeTestCommitは1つのファイルだけを持つコミットをclientsの全てに同じ内容で書き込む.
+func storeTestCommit(t *testing.T, content string, clients ...*store.Client) sha.SHA1 {
+	t.Helper()
+	var hash sha.SHA1
+	for _, client := range clients {
+		blob, err := client.StoreRaw(object.BlobObject, []byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree := object.Tree{Entries: []object.TreeEntry{{Mode: object.ModeBlob, Name: "a.txt", Hash: blob}}}
+		treeHash, err := client.StoreRaw(object.TreeObject, tree.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := fmt.Sprintf("tree %s\nauthor fsegit <fsegit@example.com> 1672531200 +0900\ncommitter fsegit <fsegit@example.com> 1672531200 +0900\n\ncommit\n", treeHash)
+		if hash, err = client.StoreRaw(object.CommitObject, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return hash
+}
+
+// newUploadPackServerはsrcの参照を広告し、要求されたオブジェクトをパックにして返すsmart HTTPのサーバーを作る.
+// 受け取ったwantの行は*wantsに記録する. capabilitiesは最初の行にofs-deltaと一緒に付けて広告する.
+func newUploadPackServer(t *testing.T, src *store.Client, refs []transport.Ref, wants *[]string, capabilities ...string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
+			transport.WritePacketString(w, "# service=git-upload-pack\n")
+			transport.WriteFlush(w)
+			for i, ref := range refs {
+				line := ref.Hash.String() + " " + ref.Name
+				if i == 0 {
+					line += "\x00" + strings.Join(append([]string{"ofs-delta"}, capabilities...), " ")
+				}
+				transport.WritePacketString(w, line+"\n")
+				if ref.Peeled != nil {
+					transport.WritePacketString(w, ref.Peeled.String()+" "+ref.Name+"^{}\n")
+				}
+			}
+			transport.WriteFlush(w)
+			return
+		}
+		var requested, haves []sha.SHA1
+		pr := transport.NewPacketReader(r.Body)
+		for {
+			data, flush, err := pr.ReadPacket()
+			if err != nil {
+				t.Errorf("reading request: %v", err)
+				return
+			}
+			line := strings.TrimSuffix(string(data), "\n")
+			if flush {
+				continue
+			}
+			if line == "done" {
+				break
+			}
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				t.Errorf("bad request line %q", line)
+				return
+			}
+			hash, err := hex.DecodeString(fields[1])
+			if err != nil {
+				t.Errorf("bad request line %q", line)
+				return
+			}
+			switch fields[0] {
+			case "want":
+				*wants = append(*wants, fields[1])
+				requested = append(requested, hash)
+			case "have":
+				haves = append(haves, hash)
+			}
+		}
+		transport.WritePacketString(w, "NAK\n")
+		if _, err := src.WritePushPack(w, requested, haves, store.PackOptions{}); err != nil {
+			t.Errorf("WritePushPack() error = %v", err)
+		}
+	}))
+}
+
+// 既に手元にあるコミットを指す注釈付きタグも、"^{}"の行から指す先を読んでタグのオブジェクトを取得するか
+func TestFetch_TagOnLocalCommit(t *testing.T) {
+	src, _, err := store.Init(t.TempDir(), store.InitOptions{InitialBranch: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, _, err := store.Init(t.TempDir(), store.InitOptions{InitialBranch: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit := storeTestCommit(t, "a\n", src, client)
+	if err := client.WriteRef("refs/remotes/origin/main", commit); err != nil {
+		t.Fatal(err)
+	}
+	tagger := object.Signature{Name: "fsegit", Email: "fsegit@example.com", When: time.Unix(1672531200, 0)}
+	tag, _, err := src.CreateAnnotatedTag("v1", commit, tagger, "release\n", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wants []string
+	server := newUploadPackServer(t, src, []transport.Ref{
+		{Name: "refs/heads/main", Hash: commit},
+		{Name: "refs/tags/v1", Hash: tag, Peeled: commit},
+	}, &wants)
+	defer server.Close()
+	if err := client.AddRemote("origin", server.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	rejected, err := fetch(context.Background(), client, "origin", 0, ioutil.Discard, true)
+	if err != nil || rejected {
+		t.Fatalf("fetch() = %v, %v", rejected, err)
+	}
+	if len(wants) != 1 || wants[0] != tag.String() {
+		t.Errorf("wants = %v, want only the tag %s", wants, tag)
+	}
+	if got, err := client.ResolveRef("refs/tags/v1"); err != nil || !bytes.Equal(got, tag) {
+		t.Errorf("refs/tags/v1 = %s, %v, want %s", got, err, tag)
+	}
+	if _, err := client.GetObject(tag); err != nil {
+		t.Errorf("tag object was not fetched: %v", err)
+	}
+}
+
+// "../"を含む名前を広告されても、管理ディレクトリの設定や外のファイルを書き換えずに無視するか
+func TestFetch_BrokenRefName(t *testing.T) {
+	src, _, err := store.Init(t.TempDir(), store.InitOptions{InitialBranch: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, _, err := store.Init(t.TempDir(), store.InitOptions{InitialBranch: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit := storeTestCommit(t, "a\n", src)
+
+	var wants []string
+	server := newUploadPackServer(t, src, []transport.Ref{
+		{Name: "refs/heads/main", Hash: commit},
+		{Name: "refs/tags/../../config", Hash: commit},
+		{Name: "refs/heads/../../../../outside", Hash: commit},
+	}, &wants)
+	defer server.Close()
+	if err := client.AddRemote("origin", server.URL); err != nil {
+		t.Fatal(err)
+	}
+	configPath := filepath.Join(client.GitDir(), "config")
+	config, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stderr bytes.Buffer
+	if _, err := fetch(context.Background(), client, "origin", 0, &stderr, false); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ioutil.ReadFile(configPath); err != nil || !bytes.Equal(got, config) {
+		t.Errorf("config was overwritten: %q, %v", got, err)
+	}
+	if _, err := os.Stat(filepath.Join(client.WorkTree(), "..", "outside")); !os.IsNotExist(err) {
+		t.Errorf("a file was written outside the repository: %v", err)
+	}
+	if got, err := client.ResolveRef("refs/remotes/origin/main"); err != nil || !bytes.Equal(got, commit) {
+		t.Errorf("refs/remotes/origin/main = %s, %v, want %s", got, err, commit)
+	}
+	if !strings.Contains(stderr.String(), "ignoring ref with broken name refs/tags/../../config") {
+		t.Errorf("stderr = %q, want a warning about the broken name", stderr.String())
+	}
+}
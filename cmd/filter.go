@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kanon1343/fsegit/filter"
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/pathspec"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+	"github.com/kanon1343/fsegit/util"
+	"github.com/spf13/cobra"
+)
+
+var (
+	filterPathRemove   []string
+	filterPathRename   []string
+	filterEmailRewrite []string
+	filterStripBlobs   string
+)
+
+// filterCmd represents the filter command
+var filterCmd = &cobra.Command{
+	Use:   "filter [options] [<ref>...]",
+	Short: "Rewrite history by replaying commits",
+	Long: `Rewrite every commit reachable from the given refs (all branches and tags
+by default), remove or rename paths, rewrite author and committer emails, and
+drop large blobs. Commits that become empty are pruned, and the refs are moved
+to the rewritten commits and the moves recorded in their reflogs.
+
+The old-to-new commit mapping is written to .git/filter/commit-map and the
+updated refs to .git/filter/ref-map. The index and working tree are left
+untouched.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+
+		opts := filter.Options{
+			EmailMap: map[string]string{},
+		}
+		if len(filterPathRemove) > 0 {
+			if opts.RemovePaths, err = pathspec.Parse("", filterPathRemove); err != nil {
+				return err
+			}
+		}
+		for _, rename := range filterPathRename {
+			split := strings.SplitN(rename, ":", 2)
+			if len(split) != 2 {
+				return i18n.Errorf("invalid --path-rename %q: expected <old>:<new>", rename)
+			}
+			opts.Renames = append(opts.Renames, filter.Rename{From: split[0], To: split[1]})
+		}
+		for _, rewrite := range filterEmailRewrite {
+			split := strings.SplitN(rewrite, ":", 2)
+			if len(split) != 2 {
+				return i18n.Errorf("invalid --email-rewrite %q: expected <old>:<new>", rewrite)
+			}
+			opts.EmailMap[split[0]] = split[1]
+		}
+		if filterStripBlobs != "" {
+			if opts.MaxBlobSize, err = parseSize(filterStripBlobs); err != nil {
+				return err
+			}
+		}
+
+		var refs []store.Ref
+		if len(args) == 0 {
+			for _, prefix := range []string{"refs/heads/", "refs/tags/"} {
+				found, err := client.ListRefs(prefix)
+				if err != nil {
+					return err
+				}
+				refs = append(refs, found...)
+			}
+		}
+		for _, arg := range args {
+			name, err := client.DWIMRef(arg)
+			if err != nil {
+				return err
+			}
+			hash, err := client.ResolveRef(name)
+			if err != nil {
+				return err
+			}
+			refs = append(refs, store.Ref{Name: name, Hash: hash})
+		}
+
+		f := filter.New(client, opts)
+		updates, err := f.Run(refs)
+		if err != nil {
+			return err
+		}
+		if err := writeFilterMaps(client, f.CommitMap(), updates); err != nil {
+			return err
+		}
+		for _, update := range updates {
+			fmt.Fprintf(cmd.OutOrStdout(), "%s: %s -> %s\n", update.Name, update.Old, update.New)
+		}
+		return nil
+	},
+}
+
+// writeFilterMapsはコミットと参照の新旧の対応を.git/filter以下に書き出す.
+func writeFilterMaps(client *store.Client, commitMap map[string]sha.SHA1, updates []filter.RefUpdate) error {
+	dir := filepath.Join(client.GitDir(), "filter")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	lines := make([]string, 0, len(commitMap))
+	for old, rewritten := range commitMap {
+		lines = append(lines, fmt.Sprintf("%s %s", sha.SHA1(old), rewritten))
+	}
+	sort.Strings(lines)
+	if err := writeLines(filepath.Join(dir, "commit-map"), lines); err != nil {
+		return err
+	}
+
+	lines = lines[:0]
+	for _, update := range updates {
+		lines = append(lines, fmt.Sprintf("%s %s %s", update.Old, update.New, update.Name))
+	}
+	return writeLines(filepath.Join(dir, "ref-map"), lines)
+}
+
+// writeLinesはlinesを1行ずつnameに書き込む. 途中までしか書かれていないファイルが残らないように、
+// 一時ファイルに書いてから置き換える.
+func writeLines(name string, lines []string) error {
+	var buf bytes.Buffer
+	for _, line := range lines {
+		fmt.Fprintln(&buf, line)
+	}
+	return util.WriteFileAtomic(name, buf.Bytes(), 0644)
+}
+
+// parseSizeは"10M"のようにK/M/Gの単位が付いたサイズをバイト数に変換する.
+func parseSize(s string) (int, error) {
+	multiplier := 1
+	switch strings.ToUpper(s[len(s)-1:]) {
+	case "K":
+		multiplier = 1 << 10
+	case "M":
+		multiplier = 1 << 20
+	case "G":
+		multiplier = 1 << 30
+	}
+	if multiplier != 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, i18n.Errorf("invalid size %q", s)
+	}
+	return n * multiplier, nil
+}
+
+func init() {
+	rootCmd.AddCommand(filterCmd)
+
+	filterCmd.Flags().StringArrayVar(&filterPathRemove, "path-remove", nil, "remove paths matching this pathspec from every commit")
+	filterCmd.Flags().StringArrayVar(&filterPathRename, "path-rename", nil, "rename a file or directory, given as <old>:<new>")
+	filterCmd.Flags().StringArrayVar(&filterEmailRewrite, "email-rewrite", nil, "rewrite author and committer emails, given as <old>:<new>")
+	filterCmd.Flags().StringVar(&filterStripBlobs, "strip-blobs-bigger-than", "", "remove blobs larger than this size (e.g. 10M)")
+	filterCmd.RegisterFlagCompletionFunc("path-remove", completeTrackedPaths)
+}
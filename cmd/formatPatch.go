@@ -0,0 +1,281 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kanon1343/fsegit/diff"
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/revparse"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+	"github.com/spf13/cobra"
+)
+
+var (
+	formatPatchOutputDir string
+	formatPatchStdout    bool
+	formatPatchMaxCount  int
+	formatPatchRoot      bool
+)
+
+// formatPatchNameMaxはパッチのファイル名にする件名の長さの上限. gitと同じ.
+const formatPatchNameMax = 64
+
+// formatPatchCmd represents the format-patch command
+var formatPatchCmd = &cobra.Command{
+	Use:   "format-patch [-o <dir>] [--stdout] [--max-count <n>] [--root] <since> | <revision range>",
+	Short: "Write commits as patches in mbox format",
+	Long: `Write each commit in <since>..HEAD, or in the given <a>..<b> range, as a mail
+in mbox format, oldest first, to a file named after its number and subject
+(0001-Fix-the-bug.patch). With --max-count, a single revision gives its last
+<n> commits instead, and with --root, all the commits reachable from it.
+Merge commits and commits that change nothing are skipped.
+
+The -<n> shorthand of git is not supported: write "format-patch -3" as
+"format-patch --max-count 3 HEAD".
+
+Each mail has the author and the author date of the commit in its From and
+Date headers, and the subject of the commit, prefixed with [PATCH] (or
+[PATCH i/n] when there are several), as its subject. The rest of the commit
+message is followed by "---", a diffstat and the diff, which "am" and "apply"
+can read back.
+
+The files are written to the current directory, or to the directory given
+with -o, and their names are printed. --stdout writes all the mails to
+standard output instead.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeRefs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		commits, err := formatPatchCommits(client, args[0])
+		if err != nil {
+			return err
+		}
+
+		dir := resolvePath(formatPatchOutputDir)
+		if dir == "" {
+			dir = workDir
+		}
+		if !formatPatchStdout {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+		}
+		out := cmd.OutOrStdout()
+		for i, commit := range commits {
+			var buf bytes.Buffer
+			if err := writePatchMail(&buf, client, commit, i+1, len(commits)); err != nil {
+				return err
+			}
+			if formatPatchStdout {
+				if _, err := out.Write(buf.Bytes()); err != nil {
+					return err
+				}
+				continue
+			}
+			name := filepath.Join(dir, fmt.Sprintf("%04d-%s.patch", i+1, patchFileName(commit.Subject())))
+			if err := ioutil.WriteFile(name, buf.Bytes(), 0644); err != nil {
+				return err
+			}
+			if formatPatchOutputDir == "" {
+				name = filepath.Base(name)
+			} else {
+				name = filepath.Join(formatPatchOutputDir, filepath.Base(name))
+			}
+			fmt.Fprintln(out, name)
+		}
+		return nil
+	},
+}
+
+// formatPatchCommitsはrevが表すコミットを古い順に返す. マージコミットは含めない.
+func formatPatchCommits(client *store.Client, rev string) ([]*object.Commit, error) {
+	var opts store.RevListOptions
+	include, exclude := "HEAD", rev
+	switch {
+	case strings.Contains(rev, ".."):
+		split := strings.SplitN(rev, "..", 2)
+		exclude, include = split[0], split[1]
+		if include == "" {
+			include = "HEAD"
+		}
+	case formatPatchMaxCount > 0, formatPatchRoot:
+		include, exclude = rev, ""
+	}
+	hash, err := revparse.Resolve(client, include)
+	if err != nil {
+		return nil, err
+	}
+	opts.Include = []sha.SHA1{hash}
+	if exclude != "" {
+		if hash, err = revparse.Resolve(client, exclude); err != nil {
+			return nil, err
+		}
+		opts.Exclude = []sha.SHA1{hash}
+	}
+
+	entries, err := client.RevList(opts)
+	if err != nil {
+		return nil, err
+	}
+	var commits []*object.Commit
+	for _, entry := range entries {
+		if formatPatchMaxCount > 0 && len(commits) == formatPatchMaxCount {
+			break
+		}
+		commit, err := client.GetCommit(entry.Hash)
+		if err != nil {
+			return nil, err
+		}
+		if len(commit.Parents) > 1 {
+			continue
+		}
+		// 何も変更しないコミットもパッチにしない.
+		if len(commit.Parents) == 1 {
+			parent, err := client.GetCommit(commit.Parents[0])
+			if err != nil {
+				return nil, err
+			}
+			if bytes.Equal(parent.Tree, commit.Tree) {
+				continue
+			}
+		}
+		commits = append(commits, commit)
+	}
+	for i, j := 0, len(commits)-1; i < j; i, j = i+1, j-1 {
+		commits[i], commits[j] = commits[j], commits[i]
+	}
+	return commits, nil
+}
+
+// writePatchMailはcommitをn件中i番目のパッチのメールとしてwに書き出す.
+func writePatchMail(w io.Writer, client *store.Client, commit *object.Commit, i, n int) error {
+	subject, body := splitCommitMessage(commit.Message)
+	prefix := "[PATCH]"
+	if n > 1 {
+		prefix = fmt.Sprintf("[PATCH %d/%d]", i, n)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From %s Mon Sep 17 00:00:00 2001\n", commit.Hash)
+	fmt.Fprintf(&buf, "From: %s <%s>\n", encodeMailHeader(commit.Author.Name), commit.Author.Email)
+	fmt.Fprintf(&buf, "Date: %s\n", commit.Author.When.Format("Mon, 2 Jan 2006 15:04:05 -0700"))
+	fmt.Fprintf(&buf, "Subject: %s %s\n", prefix, encodeMailHeader(subject))
+	if !isASCII(commit.Message) || !isASCII(commit.Author.Name) {
+		buf.WriteString("MIME-Version: 1.0\nContent-Type: text/plain; charset=UTF-8\nContent-Transfer-Encoding: 8bit\n")
+	}
+	buf.WriteString("\n")
+	if body != "" {
+		buf.WriteString(body)
+	}
+	buf.WriteString("---\n")
+
+	var parent sha.SHA1
+	if len(commit.Parents) > 0 {
+		parent = commit.Parents[0]
+	}
+	changes, err := client.DiffTrees(parent, commit.Hash, nil)
+	if err != nil {
+		return err
+	}
+	var patch bytes.Buffer
+	stats := make([]diff.FileStat, 0, len(changes))
+	for _, change := range changes {
+		file, err := treeChangeFile(client, change)
+		if err != nil {
+			return err
+		}
+		stats = append(stats, diff.NewFileStat(file))
+		if err := diff.WriteUnified(&patch, file, diff.Options{Context: diff.DefaultContext}); err != nil {
+			return err
+		}
+	}
+	if err := diff.WriteStat(&buf, stats); err != nil {
+		return err
+	}
+	// gitと同じく、追加、削除、モードの変更の一覧を続ける.
+	for _, change := range changes {
+		switch {
+		case change.Type == store.ChangeAdd:
+			fmt.Fprintf(&buf, " create mode %s %s\n", change.NewMode, change.Path)
+		case change.Type == store.ChangeDelete:
+			fmt.Fprintf(&buf, " delete mode %s %s\n", change.OldMode, change.Path)
+		case change.OldMode != change.NewMode:
+			fmt.Fprintf(&buf, " mode change %s => %s %s\n", change.OldMode, change.NewMode, change.Path)
+		}
+	}
+	buf.WriteString("\n")
+	buf.Write(patch.Bytes())
+	buf.WriteString("-- \nfsegit\n\n")
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// splitCommitMessageはコミットメッセージを、最初の段落を1行にした件名と、残りの本文に分ける.
+func splitCommitMessage(message string) (subject, body string) {
+	message = strings.TrimLeft(message, "\n")
+	paragraph := message
+	if i := strings.Index(message, "\n\n"); i >= 0 {
+		paragraph, body = message[:i], strings.TrimLeft(message[i:], "\n")
+	}
+	return strings.Join(strings.Fields(paragraph), " "), body
+}
+
+// patchFileNameは件名をパッチのファイル名に使える形にする. 英数字と'.'、'_'以外の並びは'-'にする.
+func patchFileName(subject string) string {
+	var sb strings.Builder
+	dash := false
+	for _, r := range subject {
+		if r < utf8.RuneSelf && (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '_') {
+			if dash && sb.Len() > 0 {
+				sb.WriteByte('-')
+			}
+			sb.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	name := sb.String()
+	if len(name) > formatPatchNameMax {
+		name = name[:formatPatchNameMax]
+	}
+	return strings.TrimRight(name, ".-")
+}
+
+// encodeMailHeaderはASCII以外の文字を含むヘッダの値をRFC 2047の形式にする.
+func encodeMailHeader(s string) string {
+	if isASCII(s) {
+		return s
+	}
+	return mime.QEncoding.Encode("UTF-8", s)
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+func init() {
+	rootCmd.AddCommand(formatPatchCmd)
+
+	formatPatchCmd.Flags().StringVarP(&formatPatchOutputDir, "output-directory", "o", "", "write the patches to the given directory")
+	formatPatchCmd.Flags().BoolVar(&formatPatchStdout, "stdout", false, "write all the patches to standard output")
+	formatPatchCmd.Flags().IntVar(&formatPatchMaxCount, "max-count", 0, "limit the number of patches")
+	formatPatchCmd.Flags().BoolVar(&formatPatchRoot, "root", false, "treat the revision as the tip of the commits to write, from the root commit")
+}
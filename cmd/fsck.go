@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/kanon1343/fsegit/store"
+	"github.com/spf13/cobra"
+)
+
+var fsckNoDangling bool
+
+// fsckCmd represents the fsck command
+var fsckCmd = &cobra.Command{
+	Use:   "fsck [--no-dangling]",
+	Short: "Verify the connectivity and validity of the objects",
+	Long: `Check every loose object and every object in the packfiles: each one must
+decompress cleanly and hash to its name, commits, trees and tags must be well
+formed, and every object they point to must exist. The checksum of each
+packfile is verified as well.
+
+Refs, HEAD, ORIG_HEAD, MERGE_HEAD, FETCH_HEAD, the reflogs and the index must
+point to existing objects. Objects that cannot be reached from any of them and
+that no other object points to are reported as dangling, unless
+--no-dangling is given. Dangling objects are not an error.
+
+The exit status is 1 if any corruption is found.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		issues, err := client.Fsck()
+		if err != nil {
+			return err
+		}
+		out, stderr := cmd.OutOrStdout(), cmd.ErrOrStderr()
+		corrupt := false
+		for _, issue := range issues {
+			if issue.IsError() {
+				corrupt = true
+			}
+			switch issue.Kind {
+			case store.FsckCorrupt:
+				fmt.Fprintf(stderr, "error: %s: object corrupt or missing: %s (%s)\n", issue.Hash, issue.Name, issue.Detail)
+			case store.FsckBadObject:
+				fmt.Fprintf(stderr, "error in %s %s: %s\n", issue.Type, issue.Hash, issue.Detail)
+			case store.FsckBrokenLink:
+				fmt.Fprintf(out, "broken link from %7s %s\n              to %7s %s\n", issue.Type, issue.Hash, issue.TargetType, issue.Target)
+				fmt.Fprintf(out, "missing %s %s\n", issue.TargetType, issue.Target)
+			case store.FsckBadRef:
+				fmt.Fprintf(stderr, "error: %s: %s %s\n", issue.Name, issue.Detail, issue.Hash)
+			case store.FsckDangling:
+				if !fsckNoDangling {
+					fmt.Fprintf(out, "dangling %s %s\n", issue.Type, issue.Hash)
+				}
+			}
+		}
+		if corrupt {
+			return &exitError{code: 1}
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(fsckCmd)
+
+	fsckCmd.Flags().BoolVar(&fsckNoDangling, "no-dangling", false, "do not report dangling objects")
+}
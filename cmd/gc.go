@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/store"
+	"github.com/spf13/cobra"
+)
+
+var (
+	gcQuiet            bool
+	gcWriteBitmapIndex bool
+)
+
+// gcCmd represents the gc command
+var gcCmd = &cobra.Command{
+	Use:   "gc [-q] [--write-bitmap-index]",
+	Short: "Pack reachable objects into a single packfile",
+	Long: `Collect every object reachable from refs, HEAD, ORIG_HEAD, MERGE_HEAD,
+FETCH_HEAD and the index, write them into one delta-compressed packfile under
+objects/pack, and delete the loose copies and the old packfiles.
+
+Objects already in a packfile are kept even if they are unreachable. Loose
+objects that cannot be reached are left as they are.
+
+The commit-graph file is rewritten as well, unless gc.writeCommitGraph is set
+to false.
+
+With --write-bitmap-index, or when repack.writeBitmaps is true, a bitmap index
+(.bitmap) is written next to the packfile. It records which objects are
+reachable from selected commits, so that counting the objects to push or
+rev-list --count does not have to walk the whole history. No bitmap is written
+in a shallow repository.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		cfg, err := client.Config()
+		if err != nil {
+			return err
+		}
+		writeBitmap, err := cfg.GetBool("repack.writebitmaps", false)
+		if err != nil {
+			return err
+		}
+		result, err := client.RepackWithOptions(cmd.Context(), store.RepackOptions{WriteBitmap: writeBitmap || gcWriteBitmapIndex})
+		if err != nil {
+			return err
+		}
+		writeGraph, err := cfg.GetBool("gc.writecommitgraph", true)
+		if err != nil {
+			return err
+		}
+		if writeGraph {
+			if _, err := client.WriteCommitGraphContext(cmd.Context()); err != nil {
+				return err
+			}
+		}
+		if gcQuiet {
+			return nil
+		}
+		out := cmd.OutOrStdout()
+		if result.Pack == "" {
+			fmt.Fprintln(out, i18n.Sprintf("Nothing to pack"))
+			return nil
+		}
+		fmt.Fprintln(out, i18n.Sprintf("Packed %d objects (%d deltas) into %s", result.Objects, result.Deltas, filepath.Base(result.Pack)))
+		fmt.Fprintln(out, i18n.Sprintf("Removed %d loose objects", result.PrunedLoose))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(gcCmd)
+
+	gcCmd.Flags().BoolVarP(&gcQuiet, "quiet", "q", false, "suppress the summary")
+	gcCmd.Flags().BoolVar(&gcWriteBitmapIndex, "write-bitmap-index", false, "write a bitmap index for the new packfile")
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/store"
+	"github.com/spf13/cobra"
+)
+
+var (
+	grepLineNumber bool
+	grepIgnoreCase bool
+	grepNameOnly   bool
+)
+
+// grepCmd represents the grep command
+var grepCmd = &cobra.Command{
+	Use:   "grep [-n] [-i] [-l] <pattern> [<tree-ish>]",
+	Short: "Print lines matching a pattern in tracked files",
+	Long: `Search the files registered in the index, or the files of <tree-ish> when it
+is given, for lines matching <pattern>, a Go regular expression (RE2 syntax),
+and print them as "<path>:<line>". Files are read from the object store, not
+from the working tree, one line at a time.
+
+-n prefixes each line with its line number, -i matches case-insensitively, and
+-l (--name-only) prints only the paths of the files that match. For binary
+files only "Binary file <path> matches" is printed.
+
+Exits with status 1 when nothing matches.`,
+	Args:              cobra.RangeArgs(1, 2),
+	ValidArgsFunction: completeRefs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		pattern := args[0]
+		if grepIgnoreCase {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return err
+		}
+		opts := store.GrepOptions{FirstMatchOnly: grepNameOnly}
+		if len(args) == 2 {
+			if opts.Tree, err = resolveCommitish(client, args[1]); err != nil {
+				return err
+			}
+		}
+
+		out := cmd.OutOrStdout()
+		matched := false
+		err = client.Grep(re, opts, func(match store.GrepMatch) error {
+			matched = true
+			switch {
+			case grepNameOnly:
+				fmt.Fprintln(out, match.Path)
+			case match.Binary:
+				fmt.Fprintln(out, i18n.Sprintf("Binary file %s matches", match.Path))
+			case grepLineNumber:
+				fmt.Fprintf(out, "%s:%d:%s\n", match.Path, match.Line, match.Text)
+			default:
+				fmt.Fprintf(out, "%s:%s\n", match.Path, match.Text)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if !matched {
+			return &exitError{code: 1}
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(grepCmd)
+
+	grepCmd.Flags().BoolVarP(&grepLineNumber, "line-number", "n", false, "prefix each matching line with its line number")
+	grepCmd.Flags().BoolVarP(&grepIgnoreCase, "ignore-case", "i", false, "ignore case differences")
+	grepCmd.Flags().BoolVarP(&grepNameOnly, "name-only", "l", false, "print only the names of matching files")
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/spf13/cobra"
+)
+
+var (
+	hashObjectType    string
+	hashObjectWrite   bool
+	hashObjectStdin   bool
+	hashObjectLiteral bool
+)
+
+// hashObjectCmd represents the hash-object command
+var hashObjectCmd = &cobra.Command{
+	Use:   "hash-object [-t <type>] [-w] [--stdin] [<file>...]",
+	Short: "Compute the object hash of files",
+	Long: `Print the hash of the object that would be created from each file, or from
+standard input with --stdin. With -w the object is also written into the
+repository.
+
+-t selects the object type (blob by default). The contents of commit, tree and
+tag objects are checked to be well formed unless --literally is given.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		objectType, err := object.NewType(hashObjectType)
+		if err != nil {
+			return err
+		}
+
+		var inputs [][]byte
+		if hashObjectStdin {
+			data, err := ioutil.ReadAll(cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+			inputs = append(inputs, data)
+		}
+		for _, arg := range args {
+			data, err := ioutil.ReadFile(resolvePath(arg))
+			if err != nil {
+				return err
+			}
+			inputs = append(inputs, data)
+		}
+
+		for _, data := range inputs {
+			obj := object.NewObject(objectType, data)
+			if !hashObjectLiteral {
+				if err := validateObject(obj); err != nil {
+					return err
+				}
+			}
+			if hashObjectWrite {
+				client, err := newClient()
+				if err != nil {
+					return err
+				}
+				if err := client.WriteObject(obj); err != nil {
+					return err
+				}
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), obj.Hash)
+		}
+		return nil
+	},
+}
+
+// validateObjectはobjの内容がその種類のオブジェクトとして読めるかを調べる.
+func validateObject(obj *object.Object) error {
+	var err error
+	switch obj.Type {
+	case object.CommitObject:
+		_, err = object.NewCommit(obj)
+	case object.TreeObject:
+		_, err = object.NewTree(obj)
+	case object.TagObject:
+		_, err = object.NewTag(obj)
+	}
+	return err
+}
+
+func init() {
+	rootCmd.AddCommand(hashObjectCmd)
+
+	hashObjectCmd.Flags().StringVarP(&hashObjectType, "type", "t", "blob", "object type")
+	hashObjectCmd.Flags().BoolVarP(&hashObjectWrite, "write", "w", false, "write the object into the repository")
+	hashObjectCmd.Flags().BoolVar(&hashObjectStdin, "stdin", false, "read the object from standard input")
+	hashObjectCmd.Flags().BoolVar(&hashObjectLiteral, "literally", false, "do not check the object contents")
+	hashObjectCmd.RegisterFlagCompletionFunc("type", cobra.FixedCompletions([]string{"blob", "tree", "commit", "tag"}, cobra.ShellCompDirectiveNoFileComp))
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/repo"
+	"github.com/kanon1343/fsegit/store"
+	"github.com/spf13/cobra"
+)
+
+var (
+	initBare          bool
+	initInitialBranch string
+	initQuiet         bool
+)
+
+// initCmd represents the init command
+var initCmd = &cobra.Command{
+	Use:   "init [--bare] [-b <branch>] [<directory>]",
+	Short: "Create an empty repository",
+	Long: `Create an empty repository in the given directory (the current directory by
+default). The repository data is stored in a .fsegit directory, or directly in
+the directory with --bare. Set fsegit.dirName to ".git" in the global
+configuration (or FSEGIT_DIR_NAME in the environment) to use a .git directory
+instead.
+
+HEAD points at the branch given with -b, or at init.defaultBranch from the
+global configuration, falling back to "main". Running init in an existing
+repository only creates missing directories.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := "."
+		if len(args) == 1 {
+			dir = args[0]
+		}
+		r, reinitialized, err := repo.Init(resolvePath(dir), store.InitOptions{
+			Bare:          initBare,
+			InitialBranch: initInitialBranch,
+		})
+		if err != nil {
+			return err
+		}
+		if initQuiet {
+			return nil
+		}
+		if reinitialized {
+			fmt.Fprintln(cmd.OutOrStdout(), i18n.Sprintf("Reinitialized existing fsegit repository in %s/", r.GitDir()))
+		} else {
+			fmt.Fprintln(cmd.OutOrStdout(), i18n.Sprintf("Initialized empty fsegit repository in %s/", r.GitDir()))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(initCmd)
+
+	initCmd.Flags().BoolVar(&initBare, "bare", false, "create a bare repository")
+	initCmd.Flags().StringVarP(&initInitialBranch, "initial-branch", "b", "", "name of the initial branch")
+	initCmd.Flags().BoolVarP(&initQuiet, "quiet", "q", false, "only print error messages")
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/kanon1343/fsegit/web"
+	"github.com/spf13/cobra"
+)
+
+var (
+	instawebListen string
+	instawebPort   int
+)
+
+// instawebCmd represents the instaweb command
+var instawebCmd = &cobra.Command{
+	Use:   "instaweb [--listen=<addr>] [--port=<port>]",
+	Short: "Browse the repository in a web browser",
+	Long: `Start a local HTTP server that shows the refs, history, commits with their
+diffs, trees and blobs of the current repository. Pages are rendered on the
+server, so any browser works.
+
+The server listens on 127.0.0.1 by default; use --listen to make it reachable
+from other hosts. Stop it with Ctrl-C.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		listener, err := net.Listen("tcp", net.JoinHostPort(instawebListen, strconv.Itoa(instawebPort)))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "http://%s/\n", listener.Addr())
+		return http.Serve(listener, web.NewServer(client))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(instawebCmd)
+
+	instawebCmd.Flags().StringVar(&instawebListen, "listen", "127.0.0.1", "address to listen on")
+	instawebCmd.Flags().IntVarP(&instawebPort, "port", "p", 1234, "port to listen on (0 picks a free port)")
+}
@@ -1,89 +1,245 @@
 package cmd
 
 import (
-	"encoding/hex"
 	"fmt"
-	"io/ioutil"
-	"log"
-	"os"
-	"path/filepath"
+	"strings"
 
+	"github.com/kanon1343/fsegit/color"
+	"github.com/kanon1343/fsegit/diff"
+	"github.com/kanon1343/fsegit/graph"
+	"github.com/kanon1343/fsegit/i18n"
 	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/repo"
+	"github.com/kanon1343/fsegit/sha"
 	"github.com/kanon1343/fsegit/store"
 	"github.com/spf13/cobra"
 )
 
+var (
+	logMaxCount int
+	logOneline  bool
+	logGraph    bool
+	logFollow   bool
+	logColor    string
+	logStat     bool
+	logNumStat  bool
+	logNoNotes  bool
+)
+
 // logCmd represents the log command
 var logCmd = &cobra.Command{
-	Use:   "log",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
+	Use:   "log [-n <count>] [--oneline] [--graph] [--follow] [--stat] [--numstat] [--no-notes] [--color[=<when>]] [<revision>] [-- <path>...]",
+	Short: "Show the commit history",
+	Long: `Show the commits reachable from HEAD, or from the given branch, tag or
+commit, newest commit date first. Annotated tags are followed to the commit
+they point at. With --graph or paths, the commits are shown in topological
+order like git's --topo-order: a commit is always shown before its parents and
+lines of history are not interleaved.
+
+-n limits the number of commits shown. --oneline shows each commit as its
+abbreviated hash and subject. --graph draws the ancestry of the commits as an
+ASCII graph to the left of the output.
+
+Paths after "--" limit the output to the commits that changed a matching
+file. Like git, the history is simplified: a commit that leaves the matching
+files as they were in one of its parents is not shown, and only that parent's
+side of a merge is followed.
+
+--follow takes exactly one path and continues its history across renames:
+when a commit adds the file by renaming another one, the older commits are
+searched for the file's previous name.
 
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		// 最新のコミットオブジェクトを取得.
-		f, err := os.Open("./.git/HEAD")
+--stat follows each commit with the number of lines added and removed in each
+file, relative to its first parent, and --numstat with the same numbers in a
+tab-separated form for scripts. Merge commits have no statistics.
+
+The notes attached to the commits with "fsegit notes add" are shown after their
+messages, except with --oneline or --no-notes.
+
+--color=<when> shows the commit hashes in color: always, never, or auto (the
+default) to color them only when writing to a terminal. color.ui in the
+config changes the default.
+
+On a branch that does not have any commits yet, a note is printed instead of
+an error.`,
+	ValidArgsFunction: completeRefs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := newRepository()
 		if err != nil {
-			log.Fatal()
+			return err
 		}
-		defer func(f *os.File) {
-			err := f.Close()
+		var opts repo.LogOptions
+		if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+			ps, err := parsePathspec(r.Client(), args[dash:])
 			if err != nil {
-
+				return err
 			}
-		}(f)
-		buf, err := ioutil.ReadAll(f)
-		if err != nil {
-			log.Fatal(err)
+			if !ps.Empty() {
+				opts.Paths = ps
+			}
+			if logFollow {
+				if items := ps.Items(); len(items) == 1 {
+					opts.Follow = items[0].Pattern
+				}
+			}
+			args = args[:dash]
 		}
-		head := string(buf)
-		headLength := len(head) - 1
-		latestCommitHash := filepath.Join(".git/", head[5:headLength])
-		f, err = os.Open(latestCommitHash)
-		if err != nil {
-			log.Fatal(err)
+		if logFollow && opts.Follow == "" {
+			return i18n.Errorf("--follow requires exactly one pathspec")
+		}
+		if len(args) > 1 {
+			return i18n.Errorf("too many arguments")
 		}
-		defer func(f *os.File) {
-			err := f.Close()
+		if len(args) == 1 {
+			opts.Revision = args[0]
+		} else {
+			head, err := r.Head()
 			if err != nil {
-
+				return err
+			}
+			if head.Unborn() {
+				fmt.Fprintln(cmd.ErrOrStderr(), i18n.Sprintf("your current branch '%s' does not have any commits yet", head.ShortBranch()))
+				return nil
 			}
-		}(f)
-		buf, err = ioutil.ReadAll(f)
-		headFilePath := string(buf)
-		hash, err := hex.DecodeString(headFilePath[:40])
+		}
+		switch {
+		case logMaxCount == 0:
+			return nil
+		case logMaxCount > 0:
+			opts.MaxCount = logMaxCount
+		}
+		// gitと同じく、グラフを描くときとパスで絞り込むときは子が親より先になる順、それ以外はコミット日時の新しい順に並べる.
+		if logGraph {
+			opts.Order = store.WalkOrderTopo
+		}
+		commits, err := r.LogContext(cmd.Context(), opts)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 
-		// コミット履歴を探索し、出力.
-		client, err := store.NewClient("./")
+		out := cmd.OutOrStdout()
+		useColor, err := colorEnabled(r.Client(), out, logColor)
 		if err != nil {
-			log.Fatal()
+			return err
 		}
-		if err := client.WalkHistory(hash, func(commit *object.Commit) error {
-			fmt.Println(commit)
-			fmt.Println("")
-			return nil
-		}); err != nil {
-			log.Fatal(err)
+		notes := map[string]sha.SHA1{}
+		if !logOneline && !logNoNotes {
+			list, err := r.Client().ListNotes()
+			if err != nil {
+				return err
+			}
+			for _, note := range list {
+				notes[string(note.Object)] = note.Blob
+			}
+		}
+		commitGraph := &graph.Graph{}
+		for _, commit := range commits {
+			// gitと同じく、ハッシュ(--onelineでなければハッシュの行)を黄色にする.
+			var lines []string
+			if logOneline {
+				hash := commit.Hash.String()[:7]
+				if useColor {
+					hash = color.Wrap(color.Yellow, hash)
+				}
+				lines = []string{fmt.Sprintf("%s %s", hash, commit.Subject())}
+			} else {
+				lines = append(strings.Split(commit.String(), "\n"), "")
+				if useColor {
+					lines[0] = color.Wrap(color.Yellow, lines[0])
+				}
+				if blob, ok := notes[string(commit.Hash)]; ok {
+					obj, err := r.Client().GetObject(blob)
+					if err != nil {
+						return err
+					}
+					// gitと同じく、ノートは"Notes:"の後に字下げして表示する.
+					lines = append(lines, "Notes:")
+					for _, line := range strings.Split(strings.TrimRight(string(obj.Data), "\n"), "\n") {
+						lines = append(lines, "    "+line)
+					}
+					lines = append(lines, "")
+				}
+			}
+			if logStat || logNumStat {
+				stats, err := commitStats(r.Client(), commit, opts.Paths)
+				if err != nil {
+					return err
+				}
+				if len(stats) > 0 {
+					var buf strings.Builder
+					if logNumStat {
+						diff.WriteNumStat(&buf, stats)
+					}
+					if logStat {
+						diff.WriteStat(&buf, stats)
+					}
+					lines = append(lines, strings.Split(buf.String(), "\n")...)
+					if logOneline {
+						// 最後の改行の後の空の行を除く.
+						lines = lines[:len(lines)-1]
+					}
+				}
+			}
+			if !logGraph {
+				for _, line := range lines {
+					fmt.Fprintln(out, line)
+				}
+				continue
+			}
+			row, padding, transition := commitGraph.Next(commit)
+			for i, line := range lines {
+				prefix := padding
+				if i == 0 {
+					prefix = row
+				}
+				fmt.Fprintln(out, strings.TrimRight(prefix+" "+line, " "))
+			}
+			for _, line := range transition {
+				fmt.Fprintln(out, line)
+			}
 		}
+		return nil
 	},
 }
 
+// commitStatsはcommitの最初の親(なければ空のツリー)からの、filterにマッチするファイルの変更の行数を
+// 名前の変更をまとめて返す. マージコミットでは何も返さない.
+func commitStats(client *store.Client, commit *object.Commit, filter store.TreeFilter) ([]diff.FileStat, error) {
+	if len(commit.Parents) > 1 {
+		return nil, nil
+	}
+	var parent sha.SHA1
+	if len(commit.Parents) == 1 {
+		parent = commit.Parents[0]
+	}
+	changes, err := client.DiffTrees(parent, commit.Hash, filter)
+	if err != nil {
+		return nil, err
+	}
+	if changes, err = findRenames(client, changes, "", false, "diff.renames"); err != nil {
+		return nil, err
+	}
+	stats := make([]diff.FileStat, 0, len(changes))
+	for _, change := range changes {
+		file, err := treeChangeFile(client, change)
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, diff.NewFileStat(file))
+	}
+	return stats, nil
+}
+
 func init() {
 	rootCmd.AddCommand(logCmd)
 
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// logCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// logCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	logCmd.Flags().IntVarP(&logMaxCount, "max-count", "n", -1, "limit the number of commits to show")
+	logCmd.Flags().BoolVar(&logOneline, "oneline", false, "show each commit as its abbreviated hash and subject")
+	logCmd.Flags().BoolVar(&logGraph, "graph", false, "draw an ASCII graph of the commit ancestry")
+	logCmd.Flags().BoolVar(&logFollow, "follow", false, "continue the history of a file across renames")
+	logCmd.Flags().BoolVar(&logStat, "stat", false, "show the number of changed lines in each file")
+	logCmd.Flags().BoolVar(&logNumStat, "numstat", false, "show the number of added and deleted lines in a machine-readable form")
+	logCmd.Flags().BoolVar(&logNoNotes, "no-notes", false, "do not show the notes attached to the commits")
+	logCmd.Flags().StringVar(&logColor, "color", "", "color the output: always, never or auto")
+	logCmd.Flags().Lookup("color").NoOptDefVal = "always"
 }
@@ -6,31 +6,37 @@ import (
 	"github.com/spf13/cobra"
 )
 
-// lsFilesCmd represents the lsFiles command
-var lsFilesCmd = &cobra.Command{
-	Use:   "lsFiles",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
+var lsFilesStage bool
 
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("lsFiles called")
+// lsFilesCmd represents the ls-files command
+var lsFilesCmd = &cobra.Command{
+	Use:   "ls-files [-s]",
+	Short: "Show the files in the index",
+	Long: `List the paths recorded in the index, one per line. With -s the mode, object
+hash and stage number of each entry are shown as well.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		index, err := client.ReadIndex()
+		if err != nil {
+			return err
+		}
+		for _, entry := range index.Entries {
+			if lsFilesStage {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s %s %d\t%s\n", entry.Mode, entry.Hash, entry.Stage, entry.Path)
+			} else {
+				fmt.Fprintln(cmd.OutOrStdout(), entry.Path)
+			}
+		}
+		return nil
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(lsFilesCmd)
 
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// lsFilesCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// lsFilesCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	lsFilesCmd.Flags().BoolVarP(&lsFilesStage, "stage", "s", false, "show mode, object hash and stage number")
 }
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+	"github.com/spf13/cobra"
+)
+
+var (
+	lsTreeRecursive bool
+	lsTreeShowTrees bool
+	lsTreeNameOnly  bool
+)
+
+// lsTreeCmd represents the ls-tree command
+var lsTreeCmd = &cobra.Command{
+	Use:   "ls-tree [-r [-t]] [--name-only] <tree-ish>",
+	Short: "List the contents of a tree object",
+	Long: `List the entries of a tree as "<mode> <type> <hash>\t<name>". A commit or a tag
+is resolved to its root tree.
+
+With -r subtrees are listed recursively with their full paths instead of
+being shown as entries; -t shows the subtree entries as well. --name-only
+prints only the paths.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeRefs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		hash, err := resolveCommitish(client, args[0])
+		if err != nil {
+			return err
+		}
+		return listTree(cmd.OutOrStdout(), client, hash)
+	},
+}
+
+// listTreeはhashのツリーのエントリを書き出す. -rならstore.WalkTreeでサブツリーの中のファイルをルートからのパスで
+// 書き出し、-tも指定されていれば辿る途中のサブツリーのエントリも書き出す.
+func listTree(out io.Writer, client *store.Client, hash sha.SHA1) error {
+	print := func(name string, entry object.TreeEntry) {
+		if lsTreeNameOnly {
+			fmt.Fprintln(out, name)
+		} else {
+			fmt.Fprintf(out, "%s %s %s\t%s\n", entry.Mode, entry.Mode.ObjectType(), entry.Hash, name)
+		}
+	}
+	if !lsTreeRecursive {
+		tree, err := client.GetTree(hash)
+		if err != nil {
+			return err
+		}
+		for _, entry := range tree.Entries {
+			print(entry.Name, entry)
+		}
+		return nil
+	}
+
+	var trees *treeEntryPrinter
+	var filter store.TreeFilter
+	if lsTreeShowTrees {
+		trees = &treeEntryPrinter{client: client, hashes: map[string]sha.SHA1{"": hash}, print: print}
+		filter = trees
+	}
+	if err := client.WalkTree(hash, filter, func(name string, entry object.TreeEntry) error {
+		print(name, entry)
+		return nil
+	}); err != nil {
+		return err
+	}
+	if trees != nil {
+		return trees.err
+	}
+	return nil
+}
+
+// treeEntryPrinterは-tのために、WalkTreeがサブツリーに入る直前にそのサブツリーのエントリを書き出すフィルタ.
+// MatchDirにはパスしか渡されないので、エントリは親のツリーから探す.
+type treeEntryPrinter struct {
+	client *store.Client
+	// hashesは書き出したサブツリーのパスからハッシュへの対応. ルートは空文字列.
+	hashes map[string]sha.SHA1
+	print  func(name string, entry object.TreeEntry)
+	err    error
+}
+
+func (p *treeEntryPrinter) Match(name string) bool {
+	return true
+}
+
+func (p *treeEntryPrinter) MatchDir(dir string) bool {
+	if p.err != nil {
+		return false
+	}
+	parent := path.Dir(dir)
+	if parent == "." {
+		parent = ""
+	}
+	tree, err := p.client.GetTree(p.hashes[parent])
+	if err != nil {
+		p.err = err
+		return false
+	}
+	for _, entry := range tree.Entries {
+		if entry.Name == path.Base(dir) {
+			p.hashes[dir] = entry.Hash
+			p.print(dir, entry)
+			break
+		}
+	}
+	return true
+}
+
+func init() {
+	rootCmd.AddCommand(lsTreeCmd)
+
+	lsTreeCmd.Flags().BoolVarP(&lsTreeRecursive, "recursive", "r", false, "recurse into subtrees")
+	lsTreeCmd.Flags().BoolVarP(&lsTreeShowTrees, "trees", "t", false, "show tree entries even when recursing")
+	lsTreeCmd.Flags().BoolVar(&lsTreeNameOnly, "name-only", false, "list only the names")
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// -rはサブツリーの中のファイルだけを、-tを付けるとサブツリーのエントリもその中身の前に書き出すか
+func TestLsTree(t *testing.T) {
+	dir, _, _ := newRevertTestRepository(t)
+	if err := os.MkdirAll(filepath.Join(dir, "dir", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, dir, "dir/c.txt", "c\n")
+	writeTestFile(t, dir, "dir/sub/d.txt", "d\n")
+	for _, args := range [][]string{{"add", "."}, {"commit", "-m", "dir"}} {
+		if _, stderr, err := executeCommand(t, append([]string{"-C", dir}, args...)...); err != nil {
+			t.Fatalf("%v: %v\n%s", args, err, stderr)
+		}
+	}
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, "a.txt\nb.txt\ndir\n"},
+		{[]string{"-r"}, "a.txt\nb.txt\ndir/c.txt\ndir/sub/d.txt\n"},
+		{[]string{"-r", "-t"}, "a.txt\nb.txt\ndir\ndir/c.txt\ndir/sub\ndir/sub/d.txt\n"},
+		{[]string{"-t"}, "a.txt\nb.txt\ndir\n"},
+	}
+	for _, test := range tests {
+		args := append([]string{"-C", dir, "ls-tree", "--name-only"}, test.args...)
+		stdout, stderr, err := executeCommand(t, append(args, "HEAD")...)
+		if err != nil {
+			t.Fatalf("ls-tree %v: %v\n%s", test.args, err, stderr)
+		}
+		if stdout != test.want {
+			t.Errorf("ls-tree %v = %q, want %q", test.args, stdout, test.want)
+		}
+	}
+
+	// gitのls-tree -r -tと同じ出力になる.
+	stdout, _, err := executeCommand(t, "-C", dir, "ls-tree", "-r", "-t", "HEAD:dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "100644 blob f2ad6c76f0115a6ba5b00456a849810e7ec0af20\tc.txt\n" +
+		"040000 tree abc366656a510a2a2f9f848d218d7dc5a7ee5ef7\tsub\n" +
+		"100644 blob 4bcfe98e640c8284511312660fb8709b0afa888e\tsub/d.txt\n"; stdout != want {
+		t.Errorf("ls-tree -r -t HEAD:dir =\n%s\nwant\n%s", stdout, want)
+	}
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/repo"
+	"github.com/kanon1343/fsegit/store"
+	"github.com/spf13/cobra"
+)
+
+var (
+	notesMessages []string
+	notesForce    bool
+)
+
+// notesCmd represents the notes command
+var notesCmd = &cobra.Command{
+	Use:   "notes [add [-m <message>] [-f] [<object>] | show [<object>] | list [<object>]]",
+	Short: "Add or inspect notes attached to objects",
+	Long: `Attach notes to commits and other objects without changing them. Like git,
+the notes are kept as blobs in a tree under refs/notes/commits, each named by
+the hash of the object it is attached to, and every change is recorded as a
+commit on that ref.
+
+Without a subcommand, the same as "notes list". "notes add" attaches the
+message given with -m to an object (HEAD by default); an existing note is only
+replaced with -f. "notes show" prints the note of an object, and "notes list"
+lists each note as the hash of its blob and of the object it is attached to.
+
+log shows the note of each commit after its message.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runNotesList(cmd, args)
+	},
+}
+
+// notesAddCmd represents the notes add command
+var notesAddCmd = &cobra.Command{
+	Use:               "add [-m <message>] [-f] [<object>]",
+	Short:             "Attach a note to an object",
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: completeRefs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		message := repo.CleanupMessage(strings.Join(notesMessages, "\n\n"))
+		if message == "" {
+			return i18n.Errorf("no note message given; use -m")
+		}
+		hash, err := resolveCommitish(client, notesObject(args))
+		if err != nil {
+			return err
+		}
+		_, committer, err := commitIdentity(client, cmd.ErrOrStderr())
+		if err != nil {
+			return err
+		}
+		return client.AddNote(hash, message, committer, notesForce)
+	},
+}
+
+// notesShowCmd represents the notes show command
+var notesShowCmd = &cobra.Command{
+	Use:               "show [<object>]",
+	Short:             "Show the note attached to an object",
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: completeRefs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		hash, err := resolveCommitish(client, notesObject(args))
+		if err != nil {
+			return err
+		}
+		note, err := client.ReadNote(hash)
+		if err != nil {
+			return err
+		}
+		_, err = cmd.OutOrStdout().Write(note)
+		return err
+	},
+}
+
+// notesListCmd represents the notes list command
+var notesListCmd = &cobra.Command{
+	Use:               "list [<object>]",
+	Short:             "List the notes",
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: completeRefs,
+	RunE:              runNotesList,
+}
+
+// runNotesListは全てのノートを"<ブロブのハッシュ> <オブジェクトのハッシュ>"の形で表示する.
+// オブジェクトを指定したときは、そのノートのブロブのハッシュだけを表示する.
+func runNotesList(cmd *cobra.Command, args []string) error {
+	client, err := newClient()
+	if err != nil {
+		return err
+	}
+	notes, err := client.ListNotes()
+	if err != nil {
+		return err
+	}
+	out := cmd.OutOrStdout()
+	if len(args) == 0 {
+		for _, note := range notes {
+			fmt.Fprintf(out, "%s %s\n", note.Blob, note.Object)
+		}
+		return nil
+	}
+	hash, err := resolveCommitish(client, args[0])
+	if err != nil {
+		return err
+	}
+	for _, note := range notes {
+		if bytes.Equal(note.Object, hash) {
+			fmt.Fprintln(out, note.Blob)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w : %s", store.ErrNoNote, hash)
+}
+
+// notesObjectはノートを付けるオブジェクトの引数を返す. 省略されていればHEADにする.
+func notesObject(args []string) string {
+	if len(args) == 0 {
+		return "HEAD"
+	}
+	return args[0]
+}
+
+func init() {
+	rootCmd.AddCommand(notesCmd)
+	notesCmd.AddCommand(notesAddCmd, notesShowCmd, notesListCmd)
+
+	notesAddCmd.Flags().StringArrayVarP(&notesMessages, "message", "m", nil, "use the given message for the note")
+	notesAddCmd.Flags().BoolVarP(&notesForce, "force", "f", false, "replace an existing note")
+}
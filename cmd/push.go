@@ -0,0 +1,373 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+	"github.com/kanon1343/fsegit/transport"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pushForce bool
+	pushQuiet bool
+)
+
+// pushCmd represents the push command
+var pushCmd = &cobra.Command{
+	Use:   "push [-f] [-q] [<remote> [<refspec>...]]",
+	Short: "Update remote refs along with the objects they need",
+	Long: `Send the objects the remote is missing and update its refs over the smart
+HTTP protocol. Without <remote>, the upstream remote of the current branch or
+origin is used. Without <refspec>, the current branch is pushed to the branch of
+the same name.
+
+A <refspec> is <src>[:<dst>]: the local branch or tag <src> is pushed to <dst>,
+which defaults to the same name. An empty <src> (":<dst>") deletes <dst> on
+the remote. An update that would not fast-forward the remote ref is rejected
+unless -f is given or the refspec starts with "+".
+
+The objects are sent as a thin pack, so that changed files can be sent as
+deltas against the versions the remote already has. On success the matching
+remote-tracking branches are updated.`,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) == 0 {
+			return completeRemotes(cmd, args, toComplete)
+		}
+		return completeRefs(cmd, args, toComplete)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		name := ""
+		if len(args) > 0 {
+			name = args[0]
+		} else {
+			name = pushDefaultRemote(client)
+		}
+		var specs []string
+		if len(args) > 1 {
+			specs = args[1:]
+		}
+		rejected, err := push(cmd.Context(), client, name, specs, cmd.ErrOrStderr())
+		if err != nil {
+			return err
+		}
+		if rejected {
+			return &exitError{code: 1}
+		}
+		return nil
+	},
+}
+
+// pushDefaultRemoteは現在のブランチの上流のリモート(branch.<name>.remote)を返す. なければoriginを返す.
+func pushDefaultRemote(client *store.Client) string {
+	cfg, err := client.Config()
+	if err != nil {
+		return store.DefaultRemote
+	}
+	if head, err := client.ReadHead(); err == nil && head.Branch != "" {
+		branch := strings.TrimPrefix(head.Branch, "refs/heads/")
+		if remote, ok := cfg.Get("branch." + branch + ".remote"); ok && remote != "" {
+			return remote
+		}
+	}
+	return store.DefaultRemote
+}
+
+// pushUpdateはpushで更新するリモートの1つの参照.
+type pushUpdate struct {
+	// srcは手元の参照の名前、dstはリモートの参照の名前. srcが空なら削除する.
+	src, dst string
+	// oldはリモートでの現在の値、newは更新後の値. それぞれnilなら参照がないことを表す.
+	old, new sha.SHA1
+	force    bool
+	// forcedは早送りでない更新を-fや"+"で強制したことを表す.
+	forced bool
+}
+
+// pushはspecsで指定した参照をリモートnameに送る. リモートかこちらで拒否した参照があればrejectedにtrueを返す.
+func push(ctx context.Context, client *store.Client, name string, specs []string, stderr io.Writer) (rejected bool, err error) {
+	remote, err := client.ReadRemote(name)
+	if err != nil {
+		return false, err
+	}
+	if len(specs) == 0 {
+		head, err := client.ReadHead()
+		if err != nil {
+			return false, err
+		}
+		if head.Branch == "" {
+			return false, i18n.Errorf("You are not currently on a branch.")
+		}
+		specs = []string{head.Branch}
+	}
+
+	conn := transport.NewRemote(remote.URL)
+	if !pushQuiet {
+		conn.Progress = stderr
+	}
+	adv, err := conn.ListRefsContext(ctx, "git-receive-pack")
+	if err != nil {
+		return false, err
+	}
+
+	var updates []pushUpdate
+	for _, s := range specs {
+		update, err := parsePushSpec(client, s)
+		if err != nil {
+			return false, err
+		}
+		update.force = update.force || pushForce
+		update.old, _ = adv.Lookup(update.dst)
+		if update.src == "" && update.old == nil {
+			return false, i18n.Errorf("unable to delete '%s': remote ref does not exist", update.dst)
+		}
+		updates = append(updates, update)
+	}
+
+	// 早送りにならない更新は、リモートに送る前にこちらで拒否する.
+	var lines []refUpdateLine
+	var commands []transport.Command
+	var wants []sha.SHA1
+	for i := range updates {
+		update := &updates[i]
+		switch {
+		case bytes.Equal(update.old, update.new):
+			continue
+		case update.src == "":
+			if !adv.Has("delete-refs") {
+				lines = append(lines, pushRejectLine(*update, i18n.Sprintf("(remote does not support deleting refs)")))
+				rejected = true
+				continue
+			}
+		case update.old != nil && update.force:
+			if ok, err := client.IsAncestor(update.old, update.new); err != nil || !ok {
+				update.forced = true
+			}
+		case update.old != nil:
+			ok, err := client.HasObject(update.old)
+			if err != nil {
+				return false, err
+			}
+			if !ok {
+				lines = append(lines, pushRejectLine(*update, i18n.Sprintf("(fetch first)")))
+				rejected = true
+				continue
+			}
+			if ok, err := client.IsAncestor(update.old, update.new); err != nil || !ok {
+				lines = append(lines, pushRejectLine(*update, i18n.Sprintf("(non-fast-forward)")))
+				rejected = true
+				continue
+			}
+		}
+		commands = append(commands, transport.Command{Name: update.dst, Old: update.old, New: update.new})
+		if update.new != nil {
+			wants = append(wants, update.new)
+		}
+	}
+
+	if len(commands) > 0 {
+		var packData []byte
+		if len(wants) > 0 {
+			var haves []sha.SHA1
+			for _, ref := range adv.Refs {
+				ok, err := client.HasObject(ref.Hash)
+				if err != nil {
+					return false, err
+				}
+				if ok {
+					haves = append(haves, ref.Hash)
+				}
+			}
+			var buf bytes.Buffer
+			opts := store.PackOptions{Thin: !adv.Has("no-thin")}
+			if _, err := client.WritePushPack(&buf, wants, haves, opts); err != nil {
+				return false, err
+			}
+			packData = buf.Bytes()
+		}
+		result, err := conn.SendPackContext(ctx, adv, commands, packData)
+		if err != nil {
+			return false, err
+		}
+		if result.Unpack != "ok" {
+			return false, i18n.Errorf("remote unpack failed: %s", result.Unpack)
+		}
+		for _, update := range updates {
+			status, ok := result.Status(update.dst)
+			if !ok {
+				continue
+			}
+			if !status.OK {
+				line := pushRejectLine(update, "("+status.Reason+")")
+				line.summary = i18n.Sprintf("[remote rejected]")
+				lines = append(lines, line)
+				rejected = true
+				continue
+			}
+			lines = append(lines, pushSuccessLine(update))
+			if err := updateTrackingRefs(client, remote, update); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	if pushQuiet && !rejected {
+		return rejected, nil
+	}
+	if len(lines) == 0 {
+		fmt.Fprintln(stderr, i18n.Sprintf("Everything up-to-date"))
+		return rejected, nil
+	}
+	fmt.Fprintln(stderr, i18n.Sprintf("To %s", remote.URL))
+	printRefUpdateLines(stderr, lines)
+	return rejected, nil
+}
+
+// parsePushSpecは"[+]<src>[:<dst>]"を解釈する. <src>は手元のブランチかタグ、HEADで、
+// <dst>が省略されればsrcと同じ名前、"refs/"で始まらなければsrcと同じ種類の参照とみなす.
+func parsePushSpec(client *store.Client, spec string) (pushUpdate, error) {
+	update := pushUpdate{}
+	if strings.HasPrefix(spec, "+") {
+		update.force = true
+		spec = spec[1:]
+	}
+	src, dst := spec, ""
+	if i := strings.IndexByte(spec, ':'); i >= 0 {
+		src, dst = spec[:i], spec[i+1:]
+		if dst == "" {
+			return update, i18n.Errorf("invalid refspec '%s'", spec)
+		}
+	}
+
+	if src != "" {
+		name, hash, err := resolvePushSource(client, src)
+		if err != nil {
+			return update, err
+		}
+		update.src, update.new = name, hash
+		if dst == "" {
+			dst = name
+		}
+	}
+	if !strings.HasPrefix(dst, "refs/") {
+		if strings.HasPrefix(update.src, "refs/tags/") {
+			dst = "refs/tags/" + dst
+		} else {
+			dst = "refs/heads/" + dst
+		}
+	}
+	if err := store.CheckRefName(dst); err != nil {
+		return update, err
+	}
+	update.dst = dst
+	return update, nil
+}
+
+// resolvePushSourceはpushするsrcの参照の完全な名前とハッシュを返す. HEADは現在のブランチとみなす.
+func resolvePushSource(client *store.Client, src string) (string, sha.SHA1, error) {
+	if src == "HEAD" {
+		head, err := client.ReadHead()
+		if err != nil {
+			return "", nil, err
+		}
+		if head.Branch == "" {
+			return "", nil, i18n.Errorf("You are not currently on a branch.")
+		}
+		src = head.Branch
+	}
+	candidates := []string{"refs/heads/" + src, "refs/tags/" + src}
+	if strings.HasPrefix(src, "refs/") {
+		candidates = []string{src}
+	}
+	for _, name := range candidates {
+		if hash, err := client.ResolveRef(name); err == nil {
+			return name, hash, nil
+		}
+	}
+	return "", nil, i18n.Errorf("src refspec %s does not match any", src)
+}
+
+// pushRejectLineはupdateを拒否したことを表す行を返す.
+func pushRejectLine(update pushUpdate, note string) refUpdateLine {
+	line := pushLine(update)
+	line.flag = '!'
+	line.summary = i18n.Sprintf("[rejected]")
+	line.note = note
+	return line
+}
+
+// pushSuccessLineはupdateが成功したことを表す行を返す.
+func pushSuccessLine(update pushUpdate) refUpdateLine {
+	line := pushLine(update)
+	switch {
+	case update.new == nil:
+		line.flag = '-'
+		line.summary = i18n.Sprintf("[deleted]")
+	case update.old == nil:
+		line.flag = '*'
+		switch {
+		case strings.HasPrefix(update.dst, "refs/tags/"):
+			line.summary = i18n.Sprintf("[new tag]")
+		case strings.HasPrefix(update.dst, "refs/heads/"):
+			line.summary = i18n.Sprintf("[new branch]")
+		default:
+			line.summary = i18n.Sprintf("[new reference]")
+		}
+	case update.forced:
+		line.flag = '+'
+		line.summary = update.old.String()[:7] + "..." + update.new.String()[:7]
+		line.note = i18n.Sprintf("(forced update)")
+	default:
+		line.flag = ' '
+		line.summary = update.old.String()[:7] + ".." + update.new.String()[:7]
+	}
+	return line
+}
+
+func pushLine(update pushUpdate) refUpdateLine {
+	if update.src == "" {
+		return refUpdateLine{to: shortRefName(update.dst)}
+	}
+	return refUpdateLine{from: shortRefName(update.src), to: shortRefName(update.dst)}
+}
+
+// updateTrackingRefsはpushに成功したupdateを、リモートのfetchのrefspecに対応する追跡ブランチに反映する.
+func updateTrackingRefs(client *store.Client, remote *store.Remote, update pushUpdate) error {
+	for _, s := range remote.Fetch {
+		spec, err := store.ParseRefSpec(s)
+		if err != nil {
+			return err
+		}
+		dst, ok := spec.Match(update.dst)
+		if !ok {
+			continue
+		}
+		if update.new == nil {
+			if err := client.DeleteRef(dst); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := client.UpdateRef(dst, update.new, "update by push"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(pushCmd)
+
+	pushCmd.Flags().BoolVarP(&pushForce, "force", "f", false, "update remote refs even if it is not a fast-forward")
+	pushCmd.Flags().BoolVarP(&pushQuiet, "quiet", "q", false, "suppress output unless a ref is rejected")
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/revparse"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/spf13/cobra"
+)
+
+var readTreeMerge bool
+
+// readTreeCmd represents the read-tree command
+var readTreeCmd = &cobra.Command{
+	Use:   "read-tree [-m] <tree-ish>...",
+	Short: "Read tree information into the index",
+	Long: `Replace the index with the contents of <tree-ish>. Only the index is changed;
+the working tree and HEAD are left alone, so the files may show up as modified
+until they are checked out.
+
+With -m, the trees are merged into the current index instead, which must not
+have unmerged paths:
+
+  read-tree -m <tree>                 the same as reset --mixed, but keeps the
+                                      cached file information of unchanged
+                                      entries
+  read-tree -m <current> <new>        switch from <current> to <new>: paths that
+                                      differ between them take the contents of
+                                      <new>, other index changes are kept
+  read-tree -m <base> <ours> <theirs> three-way merge: paths changed on only one
+                                      side are resolved, paths changed on both
+                                      are left as unmerged stages 1, 2 and 3
+
+A merge that would discard a change in the index is refused.`,
+	Args: cobra.RangeArgs(1, 3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !readTreeMerge && len(args) > 1 {
+			return i18n.Errorf("more than one tree requires -m")
+		}
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		var trees []sha.SHA1
+		for _, arg := range args {
+			tree, err := revparse.Resolve(client, arg+"^{tree}")
+			if err != nil {
+				return err
+			}
+			trees = append(trees, tree)
+		}
+		if readTreeMerge {
+			return client.ReadTreeMerge(trees...)
+		}
+		return client.ReadTree(trees[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(readTreeCmd)
+
+	readTreeCmd.Flags().BoolVarP(&readTreeMerge, "merge", "m", false, "merge the trees into the index")
+}
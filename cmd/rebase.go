@@ -0,0 +1,352 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/kanon1343/fsegit/diff"
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sequencer"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+	"github.com/spf13/cobra"
+)
+
+var (
+	rebaseContinue bool
+	rebaseAbort    bool
+	rebaseSkip     bool
+)
+
+// errRebaseStoppedはコンフリクトでrebaseを止めたことを表す. 止めた理由は表示済み.
+var errRebaseStopped = errors.New("rebase stopped")
+
+// rebaseCmd represents the rebase command
+var rebaseCmd = &cobra.Command{
+	Use:   "rebase <upstream> | --continue | --skip | --abort",
+	Short: "Reapply commits on top of another branch",
+	Long: `Replay the commits of the current branch that are not in <upstream> on top of
+<upstream>, one at a time, and move the branch to the last replayed commit.
+Each commit is replayed by merging the changes it made to its parent into the
+new base. The original author and message are kept. Merge commits are not
+replayed, and commits whose changes are already in <upstream> are dropped.
+
+When a commit cannot be replayed cleanly, the rebase stops with conflict
+markers in the working tree. Resolve the conflicts, stage the result with
+"fsegit add" and run "fsegit rebase --continue". --skip drops the commit
+instead, and --abort returns the branch to where it was before the rebase.
+The progress is kept in .fsegit/rebase-merge while the rebase is stopped.
+
+The working tree and the index must not have uncommitted changes.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: completeRefs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		actions := 0
+		for _, set := range []bool{rebaseContinue, rebaseAbort, rebaseSkip} {
+			if set {
+				actions++
+			}
+		}
+		if actions > 1 {
+			return i18n.Errorf("only one action at a time")
+		}
+		if actions == 1 && len(args) > 0 {
+			return i18n.Errorf("too many arguments")
+		}
+		if actions == 0 && len(args) == 0 {
+			return i18n.Errorf("upstream required")
+		}
+
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		if rebaseAbort {
+			return abortRebase(cmd, client)
+		}
+		committer, err := client.Identity(store.Committer)
+		if err != nil {
+			printIdentityHint(cmd.ErrOrStderr(), err)
+			return err
+		}
+		r := &rebaser{cmd: cmd, client: client, committer: committer}
+
+		var seq *sequencer.Sequencer
+		switch {
+		case rebaseContinue, rebaseSkip:
+			if seq, err = loadRebase(client); err != nil {
+				return err
+			}
+			if rebaseSkip {
+				err = r.skip(seq)
+			} else {
+				err = r.resume(seq)
+			}
+		default:
+			seq, err = r.start(args[0])
+		}
+		if err != nil || seq == nil {
+			return err
+		}
+		return r.run(seq)
+	},
+}
+
+// rebaserはrebaseの1回の実行で共通に使う値.
+type rebaser struct {
+	cmd       *cobra.Command
+	client    *store.Client
+	committer object.Signature
+}
+
+// startはupstreamへのrebaseを始め、付け替えるコミットの一覧を保存してHEADをupstreamに移す.
+// 付け替えるものがなければnilを返す.
+func (r *rebaser) start(upstreamName string) (*sequencer.Sequencer, error) {
+	if sequencer.InProgress(r.client) {
+		return nil, sequencer.ErrInProgress
+	}
+	head, err := r.client.ReadHead()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.client.ResolveHeadCommit(); err != nil {
+		return nil, err
+	}
+	status, err := r.client.Status()
+	if err != nil {
+		return nil, err
+	}
+	if len(status.Staged) > 0 || len(status.Unstaged) > 0 || len(status.Unmerged) > 0 {
+		return nil, i18n.Errorf("cannot rebase: you have uncommitted changes")
+	}
+
+	upstream, err := resolveCommitish(r.client, upstreamName)
+	if err != nil {
+		return nil, err
+	}
+	if upstream, err = r.client.PeelToCommit(upstream); err != nil {
+		return nil, err
+	}
+	upToDate, err := r.client.IsAncestor(upstream, head.Hash)
+	if err != nil {
+		return nil, err
+	}
+	if upToDate {
+		name := head.ShortBranch()
+		if head.Detached() {
+			name = "HEAD"
+		}
+		fmt.Fprintln(r.cmd.OutOrStdout(), i18n.Sprintf("Current branch %s is up to date.", name))
+		return nil, nil
+	}
+
+	commits, err := r.client.RebaseCommits(upstream, head.Hash)
+	if err != nil {
+		return nil, err
+	}
+	todo := make([]sequencer.Step, 0, len(commits))
+	for _, commit := range commits {
+		todo = append(todo, sequencer.Step{Action: sequencer.Pick, Commit: commit.Hash, Subject: commit.Subject()})
+	}
+	if err := r.client.SaveOrigHead(); err != nil {
+		return nil, err
+	}
+	seq, err := sequencer.Start(r.client, sequencer.Options{Operation: "rebase", Onto: upstream, HeadName: head.Branch}, todo)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.client.CheckoutCommit(upstream, store.CheckoutOptions{}); err != nil {
+		seq.Finish()
+		return nil, err
+	}
+	return seq, r.client.DetachHead(upstream, "rebase (start): checkout "+upstreamName)
+}
+
+// runは残りのコミットを順に付け替え、全て終わったら元のブランチを新しいコミットに移す.
+func (r *rebaser) run(seq *sequencer.Sequencer) error {
+	if err := seq.Run(r.pick); err != nil {
+		if errors.Is(err, errRebaseStopped) {
+			return &exitError{code: 1}
+		}
+		return err
+	}
+	head, err := r.client.ResolveHeadCommit()
+	if err != nil {
+		return err
+	}
+	name := "HEAD"
+	if seq.Options.HeadName != "" {
+		if err := r.client.UpdateRef(seq.Options.HeadName, head, fmt.Sprintf("rebase (finish): %s onto %s", seq.Options.HeadName, seq.Options.Onto)); err != nil {
+			return err
+		}
+		if err := r.client.AttachHead(seq.Options.HeadName, "rebase (finish): returning to "+seq.Options.HeadName); err != nil {
+			return err
+		}
+		name = seq.Options.HeadName
+	}
+	fmt.Fprintln(r.cmd.ErrOrStderr(), i18n.Sprintf("Successfully rebased and updated %s.", name))
+	return nil
+}
+
+// pickはstepのコミットが親に対して行った変更をHEADに取り込んでコミットする.
+// コンフリクトしたら作業ツリーにコンフリクトの印を残し、解決の方法を表示してerrRebaseStoppedを返す.
+func (r *rebaser) pick(step sequencer.Step) error {
+	commit, err := r.readCommit(step.Commit)
+	if err != nil {
+		return err
+	}
+	head, err := r.client.ResolveHeadCommit()
+	if err != nil {
+		return err
+	}
+	var parent sha.SHA1
+	if len(commit.Parents) > 0 {
+		parent = commit.Parents[0]
+	}
+	// 親が今のHEADなら付け替える必要がないので、そのコミットをそのまま使う.
+	if parent != nil && bytes.Equal(parent, head) {
+		if err := r.client.CheckoutCommit(commit.Hash, store.CheckoutOptions{}); err != nil {
+			return err
+		}
+		return r.client.DetachHead(commit.Hash, "rebase (pick): "+commit.Subject())
+	}
+
+	short := commit.Hash.String()[:7]
+	labels := diff.MergeLabels{Ours: "HEAD", Theirs: fmt.Sprintf("%s (%s)", short, commit.Subject())}
+	conflicts, err := r.client.MergeIntoWorktree(parent, commit.Hash, labels)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		out := r.cmd.ErrOrStderr()
+		for _, conflict := range conflicts {
+			fmt.Fprintln(out, i18n.Sprintf("CONFLICT (%s): Merge conflict in %s", conflict.Kind, conflict.Path))
+		}
+		fmt.Fprintln(out, i18n.Sprintf("error: could not apply %s... %s", short, commit.Subject()))
+		fmt.Fprint(out, i18n.Sprintf("hint: Resolve all conflicts manually, mark them as resolved with\nhint: \"fsegit add <pathspec>\", then run \"fsegit rebase --continue\".\nhint: You can instead skip this commit: run \"fsegit rebase --skip\".\nhint: To abort and get back to the state before \"fsegit rebase\", run \"fsegit rebase --abort\".\n"))
+		return errRebaseStopped
+	}
+	return r.commit(commit)
+}
+
+// commitはインデックスの内容を、元のコミットの作者とメッセージで新しいコミットにしてHEADを進める.
+// HEADから何も変わっていなければ、変更が既に取り込まれているのでコミットしない.
+func (r *rebaser) commit(original *object.Commit) error {
+	index, err := r.client.ReadIndex()
+	if err != nil {
+		return err
+	}
+	tree, err := r.client.WriteTree(index)
+	if err != nil {
+		return err
+	}
+	if err := r.client.WriteIndex(index); err != nil {
+		return err
+	}
+	head, err := r.client.ResolveHeadCommit()
+	if err != nil {
+		return err
+	}
+	headCommit, err := r.readCommit(head)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(tree, headCommit.Tree) {
+		return nil
+	}
+	commit := object.Commit{
+		Tree:      tree,
+		Parents:   []sha.SHA1{head},
+		Author:    original.Author,
+		Committer: r.committer,
+		Message:   original.Message,
+	}
+	obj := object.NewObject(object.CommitObject, commit.Encode())
+	if err := r.client.WriteObject(obj); err != nil {
+		return err
+	}
+	return r.client.DetachHead(obj.Hash, "rebase (pick): "+commit.Subject())
+}
+
+// resumeはコンフリクトを解決したインデックスで止まっていたコミットを作り、次のコミットに進む.
+func (r *rebaser) resume(seq *sequencer.Sequencer) error {
+	if len(seq.Todo) == 0 {
+		return nil
+	}
+	index, err := r.client.ReadIndex()
+	if err != nil {
+		return err
+	}
+	if len(index.Unmerged()) > 0 {
+		return i18n.Errorf("you must edit all merge conflicts and then mark them as resolved using fsegit add")
+	}
+	commit, err := r.readCommit(seq.Todo[0].Commit)
+	if err != nil {
+		return err
+	}
+	if err := r.commit(commit); err != nil {
+		return err
+	}
+	return seq.Advance()
+}
+
+// skipは止まっていたコミットを取り込まずに捨て、作業ツリーとインデックスをHEADに戻して次のコミットに進む.
+func (r *rebaser) skip(seq *sequencer.Sequencer) error {
+	head, err := r.client.ResolveHeadCommit()
+	if err != nil {
+		return err
+	}
+	if err := r.client.CheckoutCommit(head, store.CheckoutOptions{Force: true}); err != nil {
+		return err
+	}
+	return seq.Advance()
+}
+
+func (r *rebaser) readCommit(hash sha.SHA1) (*object.Commit, error) {
+	obj, err := r.client.GetObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	return object.NewCommit(obj)
+}
+
+// abortRebaseは途中経過を捨て、作業ツリー、インデックス、HEADをrebaseを始める前に戻す.
+func abortRebase(cmd *cobra.Command, client *store.Client) error {
+	seq, err := loadRebase(client)
+	if err != nil {
+		return err
+	}
+	orig, err := seq.Abort()
+	if err != nil {
+		return err
+	}
+	if err := client.CheckoutCommit(orig, store.CheckoutOptions{Force: true}); err != nil {
+		return err
+	}
+	if seq.Options.HeadName == "" {
+		return client.DetachHead(orig, "rebase (abort): returning to "+orig.String())
+	}
+	if err := client.WriteRef(seq.Options.HeadName, orig); err != nil {
+		return err
+	}
+	return client.AttachHead(seq.Options.HeadName, "rebase (abort): returning to "+seq.Options.HeadName)
+}
+
+// loadRebaseは止まっているrebaseの途中経過を読み込む. rebase以外の操作の途中ならエラーを返す.
+func loadRebase(client *store.Client) (*sequencer.Sequencer, error) {
+	seq, err := sequencer.Load(client)
+	if errors.Is(err, sequencer.ErrNoSequence) || (err == nil && seq.Options.Operation != "rebase") {
+		return nil, i18n.Errorf("no rebase in progress")
+	}
+	return seq, err
+}
+
+func init() {
+	rootCmd.AddCommand(rebaseCmd)
+
+	rebaseCmd.Flags().BoolVar(&rebaseContinue, "continue", false, "continue after resolving conflicts")
+	rebaseCmd.Flags().BoolVar(&rebaseAbort, "abort", false, "abort and return to the original branch")
+	rebaseCmd.Flags().BoolVar(&rebaseSkip, "skip", false, "drop the current commit and continue")
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/store"
+	"github.com/spf13/cobra"
+)
+
+var reflogMaxCount int
+
+// reflogCmd represents the reflog command
+var reflogCmd = &cobra.Command{
+	Use:   "reflog [show] [-n <count>] [<ref>]",
+	Short: "Show the history of a ref",
+	Long: `Show the updates recorded in the reflog of <ref> (HEAD by default), newest
+first. Every commit, checkout, rebase, fetch and branch creation appends to the
+reflogs of the refs it moves, under logs/ in the repository directory.
+
+Each line shows the commit the ref pointed to after the update, the
+<ref>@{<n>} name that selects it in rev-parse and other commands, and the
+reason for the update.
+
+-n limits the number of entries shown.`,
+	Args:              cobra.MaximumNArgs(2),
+	ValidArgsFunction: completeRefs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) > 0 && args[0] == "show" {
+			args = args[1:]
+		}
+		if len(args) > 1 {
+			return i18n.Errorf("too many arguments")
+		}
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		name, fullName := "HEAD", "HEAD"
+		if len(args) == 1 && args[0] != "HEAD" {
+			name = args[0]
+			if fullName, err = client.DWIMRef(name); err != nil {
+				return err
+			}
+		}
+		entries, err := client.ReadReflog(fullName)
+		if errors.Is(err, store.ErrNoReflog) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		out := cmd.OutOrStdout()
+		for i, entry := range entries {
+			if reflogMaxCount >= 0 && i >= reflogMaxCount {
+				break
+			}
+			fmt.Fprintf(out, "%s %s@{%d}: %s\n", entry.New.String()[:7], name, i, entry.Message)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reflogCmd)
+
+	reflogCmd.Flags().IntVarP(&reflogMaxCount, "max-count", "n", -1, "limit the number of entries to show")
+}
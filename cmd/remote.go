@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var remoteVerbose bool
+
+// remoteCmd represents the remote command
+var remoteCmd = &cobra.Command{
+	Use:   "remote [-v]",
+	Short: "Manage the remotes of the repository",
+	Long: `Without a subcommand, list the names of the remotes configured in the
+repository. With -v the URL of each remote is shown too.
+
+The remotes are stored in the repository config file as [remote "<name>"]
+sections holding the URL and the fetch refspecs.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		remotes, err := client.ListRemotes()
+		if err != nil {
+			return err
+		}
+		out := cmd.OutOrStdout()
+		for _, remote := range remotes {
+			if !remoteVerbose {
+				fmt.Fprintln(out, remote.Name)
+				continue
+			}
+			fmt.Fprintf(out, "%s\t%s (fetch)\n", remote.Name, remote.URL)
+			fmt.Fprintf(out, "%s\t%s (push)\n", remote.Name, remote.URL)
+		}
+		return nil
+	},
+}
+
+// remoteAddCmd represents the remote add command
+var remoteAddCmd = &cobra.Command{
+	Use:   "add <name> <url>",
+	Short: "Add a remote",
+	Long: `Add a remote named <name> for the repository at <url>. Its branches are
+fetched into refs/remotes/<name>/.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		return client.AddRemote(args[0], args[1])
+	},
+}
+
+// remoteRemoveCmd represents the remote remove command
+var remoteRemoveCmd = &cobra.Command{
+	Use:     "remove <name>",
+	Aliases: []string{"rm"},
+	Short:   "Remove a remote",
+	Long: `Remove the remote named <name>. Its remote-tracking branches and the upstream
+settings of the branches tracking it are removed as well.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeRemotes,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		return client.RemoveRemote(args[0])
+	},
+}
+
+// remoteRenameCmd represents the remote rename command
+var remoteRenameCmd = &cobra.Command{
+	Use:   "rename <old> <new>",
+	Short: "Rename a remote",
+	Long: `Rename the remote named <old> to <new>. The remote-tracking branches, the
+fetch refspecs and the upstream settings of the branches tracking it are
+updated to use the new name.`,
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: completeRemotes,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		return client.RenameRemote(args[0], args[1])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(remoteCmd)
+	remoteCmd.AddCommand(remoteAddCmd, remoteRemoveCmd, remoteRenameCmd)
+
+	remoteCmd.Flags().BoolVarP(&remoteVerbose, "verbose", "v", false, "show the URL of each remote")
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/store"
+	"github.com/spf13/cobra"
+)
+
+var (
+	resetSoft  bool
+	resetMixed bool
+	resetHard  bool
+	resetQuiet bool
+)
+
+// resetCmd represents the reset command
+var resetCmd = &cobra.Command{
+	Use:   "reset [--soft | --mixed | --hard] [-q] [<commit>]",
+	Short: "Move the current branch to a commit",
+	Long: `Move the current branch (or the detached HEAD) to <commit>, HEAD by default.
+
+  --soft    only move the branch; the index and the working tree are kept,
+            so the changes since <commit> appear as staged
+  --mixed   also make the index match <commit>; the working tree is kept,
+            so the changes appear as unstaged (the default)
+  --hard    also make the working tree match <commit>; local changes to
+            tracked files are lost, untracked files are kept
+
+The previous position is saved in ORIG_HEAD and recorded in the reflog, so a
+reset can be undone with "fsegit reset ORIG_HEAD" or "fsegit reset HEAD@{1}".
+--mixed and --hard also abort a merge that stopped on conflicts.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: completeRefs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		mode := store.ResetMixed
+		modes := 0
+		for _, m := range []struct {
+			set  bool
+			mode store.ResetMode
+		}{{resetSoft, store.ResetSoft}, {resetMixed, store.ResetMixed}, {resetHard, store.ResetHard}} {
+			if m.set {
+				mode = m.mode
+				modes++
+			}
+		}
+		if modes > 1 {
+			return i18n.Errorf("--soft, --mixed and --hard cannot be used together")
+		}
+
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		rev := "HEAD"
+		if len(args) == 1 {
+			rev = args[0]
+		}
+		target, err := resolveCommitish(client, rev)
+		if err != nil {
+			return err
+		}
+		if target, err = client.PeelToCommit(target); err != nil {
+			return err
+		}
+		if err := client.Reset(target, mode, "reset: moving to "+rev); err != nil {
+			return err
+		}
+		if resetQuiet {
+			return nil
+		}
+
+		out := cmd.OutOrStdout()
+		switch mode {
+		case store.ResetMixed:
+			index, err := client.ReadIndex()
+			if err != nil {
+				return err
+			}
+			changes, err := client.DiffIndexWorktree(index)
+			if err != nil || len(changes) == 0 {
+				return err
+			}
+			fmt.Fprintln(out, i18n.Sprintf("Unstaged changes after reset:"))
+			for _, change := range changes {
+				flag := "M"
+				if change.Type == store.ChangeDelete {
+					flag = "D"
+				}
+				fmt.Fprintf(out, "%s\t%s\n", flag, change.Path)
+			}
+		case store.ResetHard:
+			obj, err := client.GetObject(target)
+			if err != nil {
+				return err
+			}
+			commit, err := object.NewCommit(obj)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(out, i18n.Sprintf("HEAD is now at %s %s", target.String()[:7], commit.Subject()))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(resetCmd)
+
+	resetCmd.Flags().BoolVar(&resetSoft, "soft", false, "only move the current branch")
+	resetCmd.Flags().BoolVar(&resetMixed, "mixed", false, "also reset the index (default)")
+	resetCmd.Flags().BoolVar(&resetHard, "hard", false, "also reset the index and the working tree")
+	resetCmd.Flags().BoolVarP(&resetQuiet, "quiet", "q", false, "suppress the summary")
+}
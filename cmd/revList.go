@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/revparse"
+	"github.com/kanon1343/fsegit/store"
+	"github.com/spf13/cobra"
+)
+
+var (
+	revListAll      bool
+	revListCount    bool
+	revListObjects  bool
+	revListMaxCount int
+	revListNot      []string
+)
+
+// revListCmd represents the rev-list command
+var revListCmd = &cobra.Command{
+	Use:   "rev-list [--all] [--count] [--objects] [-n <count>] <revision>... [--not <revision>]...",
+	Short: "List the commits reachable from the given revisions",
+	Long: `List the commits reachable from the given revisions (and, with --all, from
+every ref and HEAD) that are not reachable from any revision given with --not
+or prefixed with "^", newest commit date first. A range <a>..<b> is the same
+as ^<a> <b>.
+
+With --objects, the annotated tags given and the trees and blobs reachable
+from the listed commits are printed after the commits, each tree and blob
+followed by the path it was first found at. Objects reachable from the
+excluded revisions are not listed.
+
+-n limits the number of commits. With --count, only the number of commits (or
+of objects, with --objects) is printed.
+
+When a packfile has a bitmap index (written by "gc --write-bitmap-index"), --count
+without -n does not read the history behind the commits it covers, so counting
+the objects of a large repository is fast.`,
+	ValidArgsFunction: completeRefs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		var opts store.RevListOptions
+		if revListAll {
+			refs, err := client.ListRefs("refs/")
+			if err != nil {
+				return err
+			}
+			for _, ref := range refs {
+				opts.Include = append(opts.Include, ref.Hash)
+			}
+			if head, err := client.ResolveRef("HEAD"); err == nil {
+				opts.Include = append(opts.Include, head)
+			}
+		}
+		for _, arg := range args {
+			var include, exclude string
+			switch {
+			case strings.Contains(arg, ".."):
+				split := strings.SplitN(arg, "..", 2)
+				exclude, include = split[0], split[1]
+			case strings.HasPrefix(arg, "^"):
+				exclude = arg[1:]
+			default:
+				include = arg
+			}
+			if exclude != "" {
+				revListNot = append(revListNot, exclude)
+			}
+			if include != "" {
+				hash, err := revparse.Resolve(client, include)
+				if err != nil {
+					return err
+				}
+				opts.Include = append(opts.Include, hash)
+			}
+		}
+		for _, name := range revListNot {
+			hash, err := revparse.Resolve(client, name)
+			if err != nil {
+				return err
+			}
+			opts.Exclude = append(opts.Exclude, hash)
+		}
+		if len(opts.Include) == 0 {
+			return i18n.Errorf("no revisions to list")
+		}
+		out := cmd.OutOrStdout()
+		switch {
+		case revListMaxCount == 0:
+			if revListCount {
+				fmt.Fprintln(out, 0)
+			}
+			return nil
+		case revListMaxCount > 0:
+			opts.MaxCount = revListMaxCount
+		}
+		opts.Objects = revListObjects
+
+		if revListCount {
+			n, err := client.RevListCount(opts)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(out, n)
+			return nil
+		}
+		entries, err := client.RevList(opts)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			// gitと同じく、ツリーとブロブにはパスを付ける. ルートのツリーのパスは空.
+			if entry.Type == object.TreeObject || entry.Type == object.BlobObject {
+				fmt.Fprintf(out, "%s %s\n", entry.Hash, entry.Path)
+			} else {
+				fmt.Fprintln(out, entry.Hash)
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(revListCmd)
+
+	revListCmd.Flags().BoolVar(&revListAll, "all", false, "include the commits reachable from every ref and HEAD")
+	revListCmd.Flags().BoolVar(&revListCount, "count", false, "print the number of objects instead of their hashes")
+	revListCmd.Flags().BoolVar(&revListObjects, "objects", false, "list the trees and blobs as well")
+	revListCmd.Flags().IntVarP(&revListMaxCount, "max-count", "n", -1, "limit the number of commits")
+	revListCmd.Flags().StringArrayVar(&revListNot, "not", nil, "exclude the commits reachable from the revision")
+}
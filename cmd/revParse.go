@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/revparse"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/spf13/cobra"
+)
+
+var (
+	revParseVerify bool
+	revParseQuiet  bool
+	revParseShort  int
+)
+
+// revParseCmd represents the rev-parse command
+var revParseCmd = &cobra.Command{
+	Use:   "rev-parse [--verify [-q]] [--short[=<length>]] <revision>...",
+	Short: "Resolve revisions to object hashes",
+	Long: `Print the full hash of the object each revision names. A revision is one of
+
+  HEAD, @              the current commit
+  <refname>            a branch, tag or other ref, e.g. main or v1.0
+  <hash>               a full or unique abbreviated (4+ characters) hash
+  <ref>@{<n>}          the value of <ref> n updates ago, from its reflog
+                       (without <ref>, the current branch)
+  <rev>~<n>            the n-th first-parent ancestor (n defaults to 1)
+  <rev>^<n>            the n-th parent (n defaults to 1, ^0 is the commit)
+  <rev>^{<type>}       peel tags (and commits, for tree) to the given type
+  <rev>:<path>         the blob or tree at <path> in the commit or tree
+
+The same forms are accepted by every command that takes a commit or tree.
+
+--verify requires exactly one revision and, with -q, exits with status 1
+without a message if it cannot be resolved. --short abbreviates the hashes.`,
+	ValidArgsFunction: completeRefs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if revParseVerify && len(args) != 1 {
+			return i18n.Errorf("needed a single revision")
+		}
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		var hashes []sha.SHA1
+		for _, arg := range args {
+			hash, err := revparse.Resolve(client, arg)
+			if err != nil {
+				if revParseVerify && revParseQuiet {
+					return &exitError{code: 1}
+				}
+				return err
+			}
+			hashes = append(hashes, hash)
+		}
+		for _, hash := range hashes {
+			s := hash.String()
+			if revParseShort > 0 && revParseShort < len(s) {
+				s = s[:revParseShort]
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), s)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(revParseCmd)
+
+	revParseCmd.Flags().BoolVar(&revParseVerify, "verify", false, "require exactly one revision that can be resolved")
+	revParseCmd.Flags().BoolVarP(&revParseQuiet, "quiet", "q", false, "with --verify, exit without a message on failure")
+	revParseCmd.Flags().IntVar(&revParseShort, "short", 0, "abbreviate the hashes to the given length")
+	revParseCmd.Flags().Lookup("short").NoOptDefVal = "7"
+}
@@ -0,0 +1,419 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/kanon1343/fsegit/diff"
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/repo"
+	"github.com/kanon1343/fsegit/sequencer"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+	"github.com/spf13/cobra"
+)
+
+var (
+	revertContinue bool
+	revertAbort    bool
+	revertSkip     bool
+	revertNoCommit bool
+	revertEdit     bool
+	revertMainline int
+)
+
+// errRevertStoppedはコンフリクトでrevertを止めたことを表す. 止めた理由は表示済み.
+var errRevertStopped = errors.New("revert stopped")
+
+// revertCmd represents the revert command
+var revertCmd = &cobra.Command{
+	Use:   "revert [-n] [-e] [-m <parent>] <commit>... | --continue | --skip | --abort",
+	Short: "Create commits that undo earlier commits",
+	Long: `For each given commit, in order, merge the inverse of the changes it made to
+its parent into HEAD and record the result as a new commit with the message
+
+    Revert "<subject of the commit>"
+
+    This reverts commit <commit>.
+
+-e opens the editor on the message first. With -n, the changes are only
+applied to the working tree and the index, and no commit is made.
+
+Reverting a merge commit requires -m to tell which parent (counting from 1)
+the changes are reverted to.
+
+When a commit cannot be reverted cleanly, the revert stops with conflict
+markers in the working tree, like rebase does. Resolve the conflicts, stage
+the result with "fsegit add" and run "fsegit revert --continue". --skip drops
+the commit instead, and --abort returns to the commit HEAD was on before the
+revert. The progress is kept in .fsegit/sequencer while the revert is stopped.
+
+The index must not have staged changes, and the files the revert changes
+must not have local modifications.`,
+	ValidArgsFunction: completeRefs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		actions := 0
+		for _, set := range []bool{revertContinue, revertAbort, revertSkip} {
+			if set {
+				actions++
+			}
+		}
+		if actions > 1 {
+			return i18n.Errorf("only one action at a time")
+		}
+		if actions == 1 && len(args) > 0 {
+			return i18n.Errorf("too many arguments")
+		}
+		if actions == 0 && len(args) == 0 {
+			return i18n.Errorf("commit required")
+		}
+
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		if revertAbort {
+			return abortRevert(client)
+		}
+		r := &reverter{cmd: cmd, client: client}
+
+		var seq *sequencer.Sequencer
+		switch {
+		case revertContinue, revertSkip:
+			if seq, err = loadRevert(client); err != nil {
+				return err
+			}
+			if revertSkip {
+				err = r.skip(seq)
+			} else {
+				err = r.resume(seq)
+			}
+		default:
+			seq, err = r.start(args)
+		}
+		if err != nil {
+			return err
+		}
+		if err := seq.Run(func(step sequencer.Step) error {
+			return r.revert(seq, step)
+		}); err != nil {
+			if errors.Is(err, errRevertStopped) {
+				return &exitError{code: 1}
+			}
+			return err
+		}
+		return nil
+	},
+}
+
+// reverterはrevertの1回の実行で共通に使う値.
+type reverter struct {
+	cmd    *cobra.Command
+	client *store.Client
+}
+
+// startはnamesのコミットを取り消すrevertを始め、取り消すコミットの一覧を保存する.
+func (r *reverter) start(names []string) (*sequencer.Sequencer, error) {
+	if sequencer.InProgress(r.client) {
+		return nil, sequencer.ErrInProgress
+	}
+	if _, err := r.client.ResolveHeadCommit(); err != nil {
+		return nil, err
+	}
+	status, err := r.client.Status()
+	if err != nil {
+		return nil, err
+	}
+	if len(status.Unmerged) > 0 || (len(status.Staged) > 0 && !revertNoCommit) {
+		return nil, i18n.Errorf("cannot revert: your index contains uncommitted changes")
+	}
+
+	todo := make([]sequencer.Step, 0, len(names))
+	for _, name := range names {
+		hash, err := resolveCommitish(r.client, name)
+		if err != nil {
+			return nil, err
+		}
+		if hash, err = r.client.PeelToCommit(hash); err != nil {
+			return nil, err
+		}
+		commit, err := r.readCommit(hash)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := revertParent(commit, revertMainline); err != nil {
+			return nil, err
+		}
+		todo = append(todo, sequencer.Step{Action: sequencer.Revert, Commit: hash, Subject: commit.Subject()})
+	}
+	opts := sequencer.Options{Operation: "revert", Mainline: revertMainline, NoCommit: revertNoCommit, Edit: revertEdit}
+	return sequencer.Start(r.client, opts, todo)
+}
+
+// revertParentはcommitの変更を取り消して戻す先の親を返す. 親がなければnilを返す.
+// マージコミットではmainlineで指定した親を使い、指定がなければエラーを返す.
+func revertParent(commit *object.Commit, mainline int) (sha.SHA1, error) {
+	short := commit.Hash.String()[:7]
+	switch {
+	case len(commit.Parents) > 1 && mainline == 0:
+		return nil, i18n.Errorf("commit %s is a merge but no -m option was given", short)
+	case len(commit.Parents) <= 1 && mainline != 0:
+		return nil, i18n.Errorf("mainline was specified but commit %s is not a merge", short)
+	case mainline < 0 || mainline > len(commit.Parents):
+		return nil, i18n.Errorf("commit %s does not have parent %d", short, mainline)
+	case mainline > 0:
+		return commit.Parents[mainline-1], nil
+	case len(commit.Parents) == 1:
+		return commit.Parents[0], nil
+	}
+	return nil, nil
+}
+
+// revertはstepのコミットが親に対して行った変更の逆をHEADに取り込み、NoCommitでなければコミットする.
+// コンフリクトしたら作業ツリーにコンフリクトの印を残し、gitのcherry-pickと同じくメッセージをMERGE_MSGに、
+// NoCommitでなければ取り消すコミットをREVERT_HEADに書いて、解決の方法を表示してerrRevertStoppedを返す.
+func (r *reverter) revert(seq *sequencer.Sequencer, step sequencer.Step) error {
+	commit, err := r.readCommit(step.Commit)
+	if err != nil {
+		return err
+	}
+	parent, err := revertParent(commit, seq.Options.Mainline)
+	if err != nil {
+		return err
+	}
+
+	// コミットを基準に、親の側への変更として3方向マージする.
+	short := commit.Hash.String()[:7]
+	labels := diff.MergeLabels{Ours: "HEAD", Theirs: fmt.Sprintf("parent of %s (%s)", short, commit.Subject())}
+	conflicts, err := r.client.MergeIntoWorktree(commit.Hash, parent, labels)
+	if err != nil {
+		return err
+	}
+	message := revertMessage(commit, parent)
+	if len(conflicts) > 0 {
+		message += "\n# Conflicts:\n"
+		for _, conflict := range conflicts {
+			message += "#\t" + conflict.Path + "\n"
+		}
+		if err := r.client.WriteMergeMsg(message); err != nil {
+			return err
+		}
+		if !seq.Options.NoCommit {
+			if err := r.client.WriteRef(store.RevertHead, commit.Hash); err != nil {
+				return err
+			}
+		}
+		out := r.cmd.ErrOrStderr()
+		for _, conflict := range conflicts {
+			fmt.Fprintln(out, i18n.Sprintf("CONFLICT (%s): Merge conflict in %s", conflict.Kind, conflict.Path))
+		}
+		fmt.Fprintln(out, i18n.Sprintf("error: could not revert %s... %s", short, commit.Subject()))
+		fmt.Fprint(out, i18n.Sprintf("hint: Resolve all conflicts manually, mark them as resolved with\nhint: \"fsegit add <pathspec>\", then run \"fsegit revert --continue\".\nhint: You can instead skip this commit: run \"fsegit revert --skip\".\nhint: To abort and get back to the state before \"fsegit revert\", run \"fsegit revert --abort\".\n"))
+		return errRevertStopped
+	}
+	if seq.Options.NoCommit {
+		return nil
+	}
+	return r.commit(commit, message, seq.Options.Edit)
+}
+
+// revertMessageはrevertedを取り消すコミットのメッセージを返す. parentは変更を戻す先の親.
+func revertMessage(reverted *object.Commit, parent sha.SHA1) string {
+	message := fmt.Sprintf("Revert \"%s\"\n\nThis reverts commit %s", reverted.Subject(), reverted.Hash)
+	if len(reverted.Parents) > 1 {
+		message += fmt.Sprintf(", reversing\nchanges made to %s", parent)
+	}
+	return message + ".\n"
+}
+
+// commitはインデックスの内容をmessageで新しいコミットにしてHEADを進め、コンフリクトで止まったときの状態を消す.
+// editならメッセージをエディタで編集させる. HEADから何も変わっていなければ、変更が既に取り消されているので
+// そのことを表示してコミットしない.
+func (r *reverter) commit(reverted *object.Commit, message string, edit bool) error {
+	index, err := r.client.ReadIndex()
+	if err != nil {
+		return err
+	}
+	tree, err := r.client.WriteTree(index)
+	if err != nil {
+		return err
+	}
+	if err := r.client.WriteIndex(index); err != nil {
+		return err
+	}
+	head, err := r.client.ResolveHeadCommit()
+	if err != nil {
+		return err
+	}
+	headCommit, err := r.readCommit(head)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(tree, headCommit.Tree) {
+		fmt.Fprintln(r.cmd.ErrOrStderr(), i18n.Sprintf("nothing to commit: the changes of %s... %s have already been reverted", reverted.Hash.String()[:7], reverted.Subject()))
+		return clearRevertState(r.client)
+	}
+
+	if edit {
+		if message, err = r.editMessage(message); err != nil {
+			return err
+		}
+	} else if message = repo.CleanupMessage(repo.StripComments(message)); message == "" {
+		return i18n.Errorf("aborting commit due to empty commit message")
+	}
+	author, committer, err := commitIdentity(r.client, r.cmd.ErrOrStderr())
+	if err != nil {
+		return err
+	}
+
+	commit := object.Commit{
+		Tree:      tree,
+		Parents:   []sha.SHA1{head},
+		Author:    author,
+		Committer: committer,
+		Message:   message,
+	}
+	obj := object.NewObject(object.CommitObject, commit.Encode())
+	if err := r.client.WriteObject(obj); err != nil {
+		return err
+	}
+	if err := r.client.UpdateHead(obj.Hash, "revert: "+commit.Subject()); err != nil {
+		return err
+	}
+	where, err := r.client.ReadHead()
+	if err != nil {
+		return err
+	}
+	name := where.ShortBranch()
+	if where.Detached() {
+		name = "detached HEAD"
+	}
+	fmt.Fprintf(r.cmd.OutOrStdout(), "[%s %s] %s\n", name, obj.Hash.String()[:7], commit.Subject())
+	return clearRevertState(r.client)
+}
+
+// clearRevertStateはコンフリクトで止まったときに書いたMERGE_MSGとREVERT_HEADを消す.
+func clearRevertState(client *store.Client) error {
+	if err := client.ClearMergeState(); err != nil {
+		return err
+	}
+	return client.ClearSpecialRef(store.RevertHead)
+}
+
+// editMessageはmessageをCOMMIT_EDITMSGに書いてエディタで編集させ、コメントを取り除いたメッセージを返す.
+func (r *reverter) editMessage(message string) (string, error) {
+	path := r.client.CommitEditMsgPath()
+	if err := ioutil.WriteFile(path, []byte(message), 0644); err != nil {
+		return "", err
+	}
+	if err := launchEditor(r.client, path); err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	message = repo.CleanupMessage(repo.StripComments(string(data)))
+	if message == "" {
+		return "", i18n.Errorf("aborting commit due to empty commit message")
+	}
+	return message, nil
+}
+
+// resumeはコンフリクトを解決したインデックスで止まっていたコミットを、MERGE_MSGに保存したメッセージで作り、
+// 次のコミットに進む.
+func (r *reverter) resume(seq *sequencer.Sequencer) error {
+	if len(seq.Todo) == 0 {
+		return nil
+	}
+	index, err := r.client.ReadIndex()
+	if err != nil {
+		return err
+	}
+	if len(index.Unmerged()) > 0 {
+		return i18n.Errorf("you must edit all merge conflicts and then mark them as resolved using fsegit add")
+	}
+	if !seq.Options.NoCommit {
+		commit, err := r.readCommit(seq.Todo[0].Commit)
+		if err != nil {
+			return err
+		}
+		parent, err := revertParent(commit, seq.Options.Mainline)
+		if err != nil {
+			return err
+		}
+		message, err := r.client.ReadMergeMsg()
+		if err != nil {
+			return err
+		}
+		if message == "" {
+			message = revertMessage(commit, parent)
+		}
+		if err := r.commit(commit, message, seq.Options.Edit); err != nil {
+			return err
+		}
+	}
+	return seq.Advance()
+}
+
+// skipは止まっていたコミットを取り消さずに飛ばし、作業ツリーとインデックスをHEADに戻して次のコミットに進む.
+func (r *reverter) skip(seq *sequencer.Sequencer) error {
+	head, err := r.client.ResolveHeadCommit()
+	if err != nil {
+		return err
+	}
+	if err := r.client.CheckoutCommit(head, store.CheckoutOptions{Force: true}); err != nil {
+		return err
+	}
+	if err := clearRevertState(r.client); err != nil {
+		return err
+	}
+	return seq.Advance()
+}
+
+func (r *reverter) readCommit(hash sha.SHA1) (*object.Commit, error) {
+	obj, err := r.client.GetObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	return object.NewCommit(obj)
+}
+
+// abortRevertは現在のブランチ、インデックス、作業ツリーをrevertを始める前のコミットに戻してから途中経過を捨てる.
+// 戻すのに失敗したら、もう一度--abortできるように途中経過を残す.
+func abortRevert(client *store.Client) error {
+	seq, err := loadRevert(client)
+	if err != nil {
+		return err
+	}
+	if err := client.Reset(seq.Head, store.ResetHard, "revert: abort"); err != nil {
+		return err
+	}
+	if err := clearRevertState(client); err != nil {
+		return err
+	}
+	return seq.Finish()
+}
+
+// loadRevertは止まっているrevertの途中経過を読み込む. revert以外の操作の途中ならエラーを返す.
+func loadRevert(client *store.Client) (*sequencer.Sequencer, error) {
+	seq, err := sequencer.Load(client)
+	if errors.Is(err, sequencer.ErrNoSequence) || (err == nil && seq.Options.Operation != "revert") {
+		return nil, i18n.Errorf("no revert in progress")
+	}
+	return seq, err
+}
+
+func init() {
+	rootCmd.AddCommand(revertCmd)
+
+	revertCmd.Flags().BoolVar(&revertContinue, "continue", false, "continue after resolving conflicts")
+	revertCmd.Flags().BoolVar(&revertAbort, "abort", false, "abort and return to the commit before the revert")
+	revertCmd.Flags().BoolVar(&revertSkip, "skip", false, "skip the current commit and continue")
+	revertCmd.Flags().BoolVarP(&revertNoCommit, "no-commit", "n", false, "apply the changes without committing")
+	revertCmd.Flags().BoolVarP(&revertEdit, "edit", "e", false, "edit the commit message")
+	revertCmd.Flags().IntVarP(&revertMainline, "mainline", "m", 0, "the parent number to revert a merge commit to")
+}
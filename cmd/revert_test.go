@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kanon1343/fsegit/sequencer"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+)
+
+// newRevertTestRepositoryは、b.txtを変えるコミットと、a.txtの同じ行を続けて変える2つのコミットのある
+// リポジトリを作り、コミットのハッシュを古い順に返す.
+func newRevertTestRepository(t *testing.T) (string, *store.Client, []sha.SHA1) {
+	t.Helper()
+	dir := t.TempDir()
+	client, _, err := store.Init(dir, store.InitOptions{InitialBranch: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := func(args ...string) {
+		t.Helper()
+		if _, stderr, err := executeCommand(t, append([]string{"-C", dir}, args...)...); err != nil {
+			t.Fatalf("%v: %v\n%s", args, err, stderr)
+		}
+	}
+	run("config", "user.name", "fsegit")
+	run("config", "user.email", "fsegit@example.com")
+	var commits []sha.SHA1
+	for i, files := range []map[string]string{
+		{"a.txt": "1\n2\n3\n", "b.txt": "b\n"},
+		{"b.txt": "changed\n"},
+		{"a.txt": "1\ntwo\n3\n"},
+		{"a.txt": "1\nTWO\n3\n"},
+	} {
+		for name, content := range files {
+			writeTestFile(t, dir, name, content)
+		}
+		run("add", ".")
+		run("commit", "-m", []string{"init", "change b", "two", "TWO"}[i])
+		head, err := client.ResolveHeadCommit()
+		if err != nil {
+			t.Fatal(err)
+		}
+		commits = append(commits, head)
+	}
+	return dir, client, commits
+}
+
+func writeTestFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readTestFile(t *testing.T, dir, name string) string {
+	t.Helper()
+	data, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// 他のコミットと重ならない変更を取り消すと、変更を戻したコミットが作られるか
+func TestRevert_Clean(t *testing.T) {
+	dir, client, commits := newRevertTestRepository(t)
+	stdout, stderr, err := executeCommand(t, "-C", dir, "revert", commits[1].String())
+	if err != nil {
+		t.Fatalf("revert: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stdout, `Revert "change b"`) {
+		t.Errorf("revert output = %q", stdout)
+	}
+	head, err := client.ResolveHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := client.GetCommit(head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Revert \"change b\"\n\nThis reverts commit " + commits[1].String() + ".\n"
+	if commit.Message != want || len(commit.Parents) != 1 || !bytes.Equal(commit.Parents[0], commits[3]) {
+		t.Errorf("revert commit = %q with parents %v", commit.Message, commit.Parents)
+	}
+	if got := readTestFile(t, dir, "b.txt"); got != "b\n" {
+		t.Errorf("b.txt = %q, want b", got)
+	}
+	if sequencer.InProgress(client) {
+		t.Error("sequencer state is left after a clean revert")
+	}
+}
+
+// コンフリクトで止まったrevertを、--abortで始める前に戻し、解決してから--continueで続けられるか
+func TestRevert_ConflictContinueAbort(t *testing.T) {
+	dir, client, commits := newRevertTestRepository(t)
+	_, stderr, err := executeCommand(t, "-C", dir, "revert", commits[2].String())
+	var exit *exitError
+	if !errors.As(err, &exit) || exit.code != 1 {
+		t.Fatalf("revert with conflict error = %v, want exit status 1\n%s", err, stderr)
+	}
+	if !sequencer.InProgress(client) {
+		t.Fatal("sequencer state is not saved after a conflict")
+	}
+	if got := readTestFile(t, dir, "a.txt"); !strings.Contains(got, "<<<<<<< HEAD\nTWO\n=======\n2\n>>>>>>> ") {
+		t.Errorf("a.txt = %q, want conflict markers", got)
+	}
+	if got := readTestFile(t, client.GitDir(), "MERGE_MSG"); !strings.HasPrefix(got, `Revert "two"`) || !strings.HasSuffix(got, "# Conflicts:\n#\ta.txt\n") {
+		t.Errorf("MERGE_MSG = %q", got)
+	}
+	if got := readTestFile(t, client.GitDir(), store.RevertHead); strings.TrimSpace(got) != commits[2].String() {
+		t.Errorf("REVERT_HEAD = %q, want %s", got, commits[2])
+	}
+	if _, _, err := executeCommand(t, "-C", dir, "revert", "--continue"); err == nil {
+		t.Error("revert --continue with unresolved conflicts succeeded")
+	}
+
+	if _, stderr, err := executeCommand(t, "-C", dir, "revert", "--abort"); err != nil {
+		t.Fatalf("revert --abort: %v\n%s", err, stderr)
+	}
+	if head, err := client.ResolveHeadCommit(); err != nil || !bytes.Equal(head, commits[3]) {
+		t.Errorf("HEAD after --abort = %s, %v, want %s", head, err, commits[3])
+	}
+	if got := readTestFile(t, dir, "a.txt"); got != "1\nTWO\n3\n" {
+		t.Errorf("a.txt after --abort = %q", got)
+	}
+	if sequencer.InProgress(client) {
+		t.Error("sequencer state is left after --abort")
+	}
+	assertNoRevertState(t, client)
+	if _, _, err := executeCommand(t, "-C", dir, "revert", "--continue"); err == nil {
+		t.Error("revert --continue without a revert in progress succeeded")
+	}
+
+	if _, _, err := executeCommand(t, "-C", dir, "revert", commits[2].String()); !errors.As(err, &exit) {
+		t.Fatalf("second revert error = %v, want exit status", err)
+	}
+	writeTestFile(t, dir, "a.txt", "1\n2\n3\n")
+	if _, stderr, err := executeCommand(t, "-C", dir, "add", "a.txt"); err != nil {
+		t.Fatalf("add: %v\n%s", err, stderr)
+	}
+	if _, stderr, err := executeCommand(t, "-C", dir, "revert", "--continue"); err != nil {
+		t.Fatalf("revert --continue: %v\n%s", err, stderr)
+	}
+	head, err := client.ResolveHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := client.GetCommit(head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// コンフリクトしたパスの注釈はMERGE_MSGからコミットのメッセージに残らない.
+	want := "Revert \"two\"\n\nThis reverts commit " + commits[2].String() + ".\n"
+	if commit.Message != want || !bytes.Equal(commit.Parents[0], commits[3]) {
+		t.Errorf("commit after --continue = %q with parents %v", commit.Message, commit.Parents)
+	}
+	if sequencer.InProgress(client) {
+		t.Error("sequencer state is left after --continue")
+	}
+	assertNoRevertState(t, client)
+}
+
+// assertNoRevertStateはコンフリクトで止まったときに書くMERGE_MSGとREVERT_HEADが消えていることを確かめる.
+func assertNoRevertState(t *testing.T, client *store.Client) {
+	t.Helper()
+	for _, name := range []string{"MERGE_MSG", store.RevertHead} {
+		if _, err := os.Stat(filepath.Join(client.GitDir(), name)); !os.IsNotExist(err) {
+			t.Errorf("%s is left: %v", name, err)
+		}
+	}
+}
+
+// -eを指定したことが、コンフリクトで止まったあとの--continueのために保存されるか
+func TestRevert_EditIsSaved(t *testing.T) {
+	dir, client, commits := newRevertTestRepository(t)
+	if _, _, err := executeCommand(t, "-C", dir, "revert", "-e", commits[2].String()); err == nil {
+		t.Fatal("revert with conflict succeeded")
+	}
+	seq, err := sequencer.Load(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !seq.Options.Edit {
+		t.Error("Options.Edit = false after revert -e")
+	}
+}
+
+// 既に取り消された変更をもう一度取り消すと、コミットを作らずにそのことを表示するか
+func TestRevert_AlreadyReverted(t *testing.T) {
+	dir, client, commits := newRevertTestRepository(t)
+	if _, stderr, err := executeCommand(t, "-C", dir, "revert", commits[1].String()); err != nil {
+		t.Fatalf("revert: %v\n%s", err, stderr)
+	}
+	head, err := client.ResolveHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, stderr, err := executeCommand(t, "-C", dir, "revert", commits[1].String())
+	if err != nil {
+		t.Fatalf("second revert: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(stderr, "have already been reverted") {
+		t.Errorf("second revert stderr = %q", stderr)
+	}
+	if got, err := client.ResolveHeadCommit(); err != nil || !bytes.Equal(got, head) {
+		t.Errorf("HEAD after second revert = %s, %v, want %s", got, err, head)
+	}
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/store"
+	"github.com/spf13/cobra"
+)
+
+var (
+	rmCached    bool
+	rmRecursive bool
+	rmForce     bool
+	rmQuiet     bool
+)
+
+// rmCmd represents the rm command
+var rmCmd = &cobra.Command{
+	Use:   "rm [--cached] [-r] [-f] <path>...",
+	Short: "Remove files from the working tree and from the index",
+	Long: `Remove the given files from the index and from the working tree. With
+--cached the files are only removed from the index and kept in the working
+tree. A directory is only removed with -r.
+
+A file whose contents differ from HEAD or from the working tree is not removed,
+because the changes would be lost, unless -f is given. With --cached only a file
+that differs from both is refused.`,
+	Args:              cobra.MinimumNArgs(1),
+	ValidArgsFunction: completeTrackedPaths,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		index, err := client.ReadIndex()
+		if err != nil {
+			return err
+		}
+
+		var paths []string
+		seen := map[string]struct{}{}
+		for _, arg := range args {
+			path, err := worktreePath(client, arg)
+			if err != nil {
+				return err
+			}
+			matched := false
+			for _, entry := range index.Entries {
+				if entry.Path != path && path != "." && !strings.HasPrefix(entry.Path, path+"/") {
+					continue
+				}
+				if entry.Path != path && !rmRecursive {
+					return i18n.Errorf("not removing '%s' recursively without -r", arg)
+				}
+				if _, ok := seen[entry.Path]; !ok {
+					seen[entry.Path] = struct{}{}
+					paths = append(paths, entry.Path)
+				}
+				matched = true
+			}
+			if !matched {
+				return i18n.Errorf("pathspec '%s' did not match any files", arg)
+			}
+		}
+
+		if !rmForce {
+			status, err := client.Status()
+			if err != nil {
+				return err
+			}
+			staged, unstaged := map[string]bool{}, map[string]bool{}
+			for _, change := range status.Staged {
+				staged[change.Path] = true
+			}
+			for _, change := range status.Unstaged {
+				unstaged[change.Path] = change.Type != store.ChangeDelete
+			}
+			for _, path := range paths {
+				switch {
+				case staged[path] && unstaged[path]:
+					return i18n.Errorf("'%s' has staged content different from both the file and the HEAD", path)
+				case rmCached:
+				case unstaged[path]:
+					return i18n.Errorf("'%s' has local modifications", path)
+				case staged[path]:
+					return i18n.Errorf("'%s' has changes staged in the index", path)
+				}
+			}
+		}
+
+		for _, path := range paths {
+			index.Remove(path)
+			if !rmCached {
+				if err := client.RemoveWorktreeFile(path); err != nil {
+					return err
+				}
+			}
+			if !rmQuiet {
+				fmt.Fprintf(cmd.OutOrStdout(), "rm '%s'\n", path)
+			}
+		}
+		return client.WriteIndex(index)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rmCmd)
+
+	rmCmd.Flags().BoolVar(&rmCached, "cached", false, "only remove from the index")
+	rmCmd.Flags().BoolVarP(&rmRecursive, "recursive", "r", false, "allow recursive removal")
+	rmCmd.Flags().BoolVarP(&rmForce, "force", "f", false, "override the up-to-date check")
+	rmCmd.Flags().BoolVarP(&rmQuiet, "quiet", "q", false, "do not list removed files")
+}
@@ -5,47 +5,205 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/kanon1343/fsegit/color"
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/pathspec"
+	"github.com/kanon1343/fsegit/repo"
+	"github.com/kanon1343/fsegit/store"
 	"github.com/spf13/cobra"
 )
 
-
+var (
+	gitDirFlag   string
+	workTreeFlag string
+	chdirFlags   []string
+	// workDirは-Cを適用した後の実効的なカレントディレクトリ. プロセスのカレントディレクトリは変更しない.
+	workDir = "."
+)
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "fsegit",
-	Short: "A brief description of your application",
-	Long: `A longer description that spans multiple lines and likely contains
-examples and usage of using your application. For example:
+	Short: "A Git implementation written in Go",
+	Long: `fsegit reads and writes Git repositories. Its data is stored in a .fsegit
+directory, and existing .git repositories can be used as well.
 
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
-	// Uncomment the following line if your bare application
-	// has an action associated with it:
-	// Run: func(cmd *cobra.Command, args []string) { },
+The repository is found by searching the current directory and its parents
+for a .fsegit directory, then a .git directory. Setting fsegit.dirName in the
+global configuration, or FSEGIT_DIR_NAME in the environment, to ".fsegit" or
+".git" makes every command look for that directory only.
+-C <dir> runs the command as if it was started in <dir>, and --git-dir and
+--work-tree point at a repository and a working tree in any location.`,
+	// エラー時に毎回usageを表示しない. エラーはExecuteで翻訳して表示する.
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := applyChdir(); err != nil {
+			return err
+		}
+		applyLanguageConfig()
+		return nil
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
 	err := rootCmd.Execute()
+	var exit *exitError
+	if errors.As(err, &exit) {
+		os.Exit(exit.code)
+	}
 	if err != nil {
+		fmt.Fprintln(os.Stderr, i18n.Sprintf("error: %s", i18n.ErrorMessage(err)))
 		os.Exit(1)
 	}
 }
 
-func init() {
-	// Here you will define your flags and configuration settings.
-	// Cobra supports persistent flags, which, if defined here,
-	// will be global for your application.
+// exitErrorはメッセージを表示せずに終了コードだけを返すときに使う.
+type exitError struct {
+	code int
+}
+
+func (e *exitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+// applyChdirは-Cを前から順に適用して実効的なカレントディレクトリを決める.
+func applyChdir() error {
+	workDir = "."
+	for _, dir := range chdirFlags {
+		if dir == "" {
+			continue
+		}
+		workDir = resolvePath(dir)
+	}
+	if info, err := os.Stat(workDir); err != nil {
+		return err
+	} else if !info.IsDir() {
+		return i18n.Errorf("cannot change to '%s': not a directory", workDir)
+	}
+	return nil
+}
 
-	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.fsegit.yaml)")
+// resolvePathはコマンドラインで受け取った相対パスを-Cで指定したディレクトリからのパスに変換する.
+func resolvePath(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(workDir, path)
+}
 
-	// Cobra also supports local flags, which will only run
-	// when this action is called directly.
-	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+// worktreePathはコマンドラインで受け取ったパスを作業ツリーのルートからの"/"区切りのパスに変換する.
+func worktreePath(client *store.Client, path string) (string, error) {
+	abs, err := filepath.Abs(resolvePath(path))
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(client.WorkTree(), abs)
+	if err != nil {
+		return "", err
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", i18n.Errorf("'%s' is outside repository", path)
+	}
+	return rel, nil
 }
 
+// parsePathspecはカレントディレクトリを基準にargsをパススペックとして解釈する.
+func parsePathspec(client *store.Client, args []string) (*pathspec.Pathspec, error) {
+	prefix, err := pathspecPrefix(client)
+	if err != nil {
+		return nil, err
+	}
+	return pathspec.Parse(prefix, args)
+}
 
+// pathspecPrefixはカレントディレクトリの作業ツリーのルートからのパスを返す. ルートなら空.
+// --work-treeでカレントディレクトリの外の作業ツリーを指定した場合は、gitと同じくルートからのパスとして扱うので空.
+func pathspecPrefix(client *store.Client) (string, error) {
+	abs, err := filepath.Abs(workDir)
+	if err != nil {
+		return "", err
+	}
+	prefix, err := filepath.Rel(client.WorkTree(), abs)
+	if err != nil {
+		return "", err
+	}
+	prefix = filepath.ToSlash(prefix)
+	if prefix == "." || prefix == ".." || strings.HasPrefix(prefix, "../") {
+		return "", nil
+	}
+	return prefix, nil
+}
+
+// colorEnabledはoutに色を付けて書くかを返す. whenは--colorの値で、空ならconfigKeysのうち最初に設定されている
+// もの、どれもなければcolor.uiの設定に従う. 設定もなければ、outが端末のときだけ色を付ける.
+func colorEnabled(client *store.Client, out io.Writer, when string, configKeys ...string) (bool, error) {
+	if when == "" {
+		cfg, err := client.Config()
+		if err != nil {
+			return false, err
+		}
+		for _, key := range append(configKeys, "color.ui") {
+			if value, ok := cfg.Get(key); ok {
+				when = value
+				break
+			}
+		}
+	}
+	return color.Enabled(when, out)
+}
+
+// applyLanguageConfigはリポジトリの設定i18n.languageがあれば出力する言語をそれに合わせる.
+// 環境変数FSEGIT_LANGが設定されている場合はそちらを優先する.
+func applyLanguageConfig() {
+	if os.Getenv("FSEGIT_LANG") != "" {
+		return
+	}
+	client, err := newClient()
+	if err != nil {
+		return
+	}
+	cfg, err := client.Config()
+	if err != nil {
+		return
+	}
+	if lang, ok := cfg.Get("i18n.language"); ok {
+		i18n.SetLanguage(i18n.ParseLanguage(lang))
+	}
+}
+
+// newClientはグローバルフラグで指定されたリポジトリを開く.
+func newClient() (*store.Client, error) {
+	return store.NewClientWithOptions(workDir, store.Options{
+		GitDir:   gitDirFlag,
+		WorkTree: workTreeFlag,
+	})
+}
+
+// newRepositoryはグローバルフラグで指定されたリポジトリをrepo.Repositoryとして開く.
+func newRepository() (*repo.Repository, error) {
+	client, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+	return repo.New(client), nil
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&gitDirFlag, "git-dir", "", "path to the repository's .git directory")
+	rootCmd.PersistentFlags().StringVar(&workTreeFlag, "work-tree", "", "path to the working tree")
+	rootCmd.PersistentFlags().StringArrayVarP(&chdirFlags, "chdir", "C", nil, "run as if fsegit was started in this directory (can be repeated)")
+	rootCmd.MarkPersistentFlagDirname("git-dir")
+	rootCmd.MarkPersistentFlagDirname("work-tree")
+	rootCmd.MarkPersistentFlagDirname("chdir")
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kanon1343/fsegit/store"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// TestMainは開発者のシステム全体と利用者全体の設定(commit.gpgSignなど)がテストの結果を変えないように、
+// 空の設定ファイルだけを読むようにしてからテストを実行する.
+func TestMain(m *testing.M) {
+	os.Exit(runWithoutUserConfig(m))
+}
+
+func runWithoutUserConfig(m *testing.M) int {
+	dir, err := ioutil.TempDir("", "fsegit-cmd-test")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	globalConfig := filepath.Join(dir, "gitconfig")
+	if err := ioutil.WriteFile(globalConfig, nil, 0644); err != nil {
+		panic(err)
+	}
+	for name, value := range map[string]string{
+		"GIT_CONFIG_GLOBAL":   globalConfig,
+		"GIT_CONFIG_NOSYSTEM": "1",
+		"XDG_CONFIG_HOME":     filepath.Join(dir, "xdg"),
+	} {
+		os.Setenv(name, value)
+	}
+	return m.Run()
+}
+
+// executeCommandはargsでfsegitのコマンドを実行し、標準出力と標準エラー出力を返す.
+// フラグの値はパッケージの変数に残るので、実行の後で既定値に戻す.
+func executeCommand(t *testing.T, args ...string) (stdout, stderr string, err error) {
+	t.Helper()
+	var out, errOut bytes.Buffer
+	rootCmd.SetArgs(args)
+	rootCmd.SetOut(&out)
+	rootCmd.SetErr(&errOut)
+	defer resetFlags(rootCmd)
+	err = rootCmd.Execute()
+	return out.String(), errOut.String(), err
+}
+
+func resetFlags(cmd *cobra.Command) {
+	reset := func(f *pflag.Flag) {
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			slice.Replace(nil)
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	}
+	cmd.Flags().VisitAll(reset)
+	cmd.PersistentFlags().VisitAll(reset)
+	for _, sub := range cmd.Commands() {
+		resetFlags(sub)
+	}
+}
+
+// 繰り返した-Cは、後の相対パスを前の-Cのディレクトリから解決するか
+func TestChdir_Repeated(t *testing.T) {
+	base := t.TempDir()
+	for _, dir := range []string{"a/b", "abs"} {
+		if err := os.MkdirAll(filepath.Join(base, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-C", filepath.Join(base, "a"), "-C", "b"}, filepath.Join(base, "a", "b")},
+		// 空の-Cは無視する.
+		{[]string{"-C", filepath.Join(base, "a"), "-C", "", "-C", "b"}, filepath.Join(base, "a", "b")},
+		// 絶対パスの-Cはそれまでの-Cに関係なくそのディレクトリになる.
+		{[]string{"-C", filepath.Join(base, "a"), "-C", filepath.Join(base, "abs")}, filepath.Join(base, "abs")},
+	}
+	for _, test := range tests {
+		stdout, stderr, err := executeCommand(t, append(test.args, "init")...)
+		if err != nil {
+			t.Fatalf("%v init: %v\n%s", test.args, err, stderr)
+		}
+		if !strings.Contains(stdout, " in "+test.want+string(filepath.Separator)) {
+			t.Errorf("%v init output = %q, want a repository in %s", test.args, stdout, test.want)
+		}
+	}
+}
+
+// -Cと一緒に指定した相対パスの--git-dirと--work-treeは、-Cのディレクトリから解決するか
+func TestChdir_RelativeGitDirAndWorkTree(t *testing.T) {
+	base := t.TempDir()
+	if _, _, err := store.Init(filepath.Join(base, "repo.git"), store.InitOptions{Bare: true, InitialBranch: "main"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(base, "wt"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(base, "wt"), "a.txt", "a\n")
+
+	// カレントディレクトリが作業ツリーの外なので、gitと同じくパススペックは作業ツリーのルートから解決する.
+	args := []string{"-C", base, "--git-dir", "repo.git", "--work-tree", "wt"}
+	if _, stderr, err := executeCommand(t, append(args, "add", "a.txt")...); err != nil {
+		t.Fatalf("add: %v\n%s", err, stderr)
+	}
+	stdout, stderr, err := executeCommand(t, append(args, "ls-files")...)
+	if err != nil {
+		t.Fatalf("ls-files: %v\n%s", err, stderr)
+	}
+	if stdout != "a.txt\n" {
+		t.Errorf("ls-files = %q, want a.txt", stdout)
+	}
+}
+
+// 存在しないディレクトリやファイルを-Cで指定するとエラーになるか
+func TestChdir_NotDirectory(t *testing.T) {
+	base := t.TempDir()
+	writeTestFile(t, base, "file", "")
+	for _, args := range [][]string{
+		{"-C", filepath.Join(base, "missing")},
+		{"-C", base, "-C", "missing"},
+		{"-C", filepath.Join(base, "file")},
+	} {
+		if _, _, err := executeCommand(t, append(args, "init")...); err == nil {
+			t.Errorf("%v init succeeded", args)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(base, "missing")); !os.IsNotExist(err) {
+		t.Errorf("missing directory was created: %v", err)
+	}
+}
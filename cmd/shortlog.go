@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/repo"
+	"github.com/spf13/cobra"
+)
+
+var (
+	shortlogNumbered bool
+	shortlogSummary  bool
+	shortlogEmail    bool
+)
+
+// shortlogCmd represents the shortlog command
+var shortlogCmd = &cobra.Command{
+	Use:   "shortlog [-n] [-s] [-e] [<revision>]",
+	Short: "Summarize the commit history by author",
+	Long: `Summarize the commits reachable from HEAD, or from the given branch, tag or
+commit, grouped by author. Each author is shown with the number of their
+commits followed by the subjects of the commits, oldest first. Authors are
+sorted by name.
+
+-n sorts the authors by the number of commits, most first. -s shows only the
+number of commits of each author. -e shows the email address of each author
+after the name, and authors with the same name but different addresses are
+shown separately.`,
+	ValidArgsFunction: completeRefs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) > 1 {
+			return i18n.Errorf("too many arguments")
+		}
+		r, err := newRepository()
+		if err != nil {
+			return err
+		}
+		var opts repo.LogOptions
+		if len(args) == 1 {
+			opts.Revision = args[0]
+		} else {
+			head, err := r.Head()
+			if err != nil {
+				return err
+			}
+			if head.Unborn() {
+				fmt.Fprintln(cmd.ErrOrStderr(), i18n.Sprintf("your current branch '%s' does not have any commits yet", head.ShortBranch()))
+				return nil
+			}
+		}
+		commits, err := r.LogContext(cmd.Context(), opts)
+		if err != nil {
+			return err
+		}
+
+		type author struct {
+			name     string
+			subjects []string
+		}
+		var authors []*author
+		byName := map[string]*author{}
+		// コミットは新しい順に並んでいるので、古い方から数えて各作者の件名を古い順にする.
+		for i := len(commits) - 1; i >= 0; i-- {
+			name := commits[i].Author.Name
+			if shortlogEmail {
+				name = fmt.Sprintf("%s <%s>", name, commits[i].Author.Email)
+			}
+			a, ok := byName[name]
+			if !ok {
+				a = &author{name: name}
+				byName[name] = a
+				authors = append(authors, a)
+			}
+			a.subjects = append(a.subjects, commits[i].Subject())
+		}
+		sort.SliceStable(authors, func(i, j int) bool {
+			if shortlogNumbered && len(authors[i].subjects) != len(authors[j].subjects) {
+				return len(authors[i].subjects) > len(authors[j].subjects)
+			}
+			return authors[i].name < authors[j].name
+		})
+
+		out := cmd.OutOrStdout()
+		for _, a := range authors {
+			if shortlogSummary {
+				fmt.Fprintf(out, "%6d\t%s\n", len(a.subjects), a.name)
+				continue
+			}
+			fmt.Fprintf(out, "%s (%d):\n", a.name, len(a.subjects))
+			for _, subject := range a.subjects {
+				fmt.Fprintf(out, "      %s\n", subject)
+			}
+			fmt.Fprintln(out)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(shortlogCmd)
+
+	shortlogCmd.Flags().BoolVarP(&shortlogNumbered, "numbered", "n", false, "sort the authors by the number of commits")
+	shortlogCmd.Flags().BoolVarP(&shortlogSummary, "summary", "s", false, "show only the number of commits of each author")
+	shortlogCmd.Flags().BoolVarP(&shortlogEmail, "email", "e", false, "show the email address of each author")
+}
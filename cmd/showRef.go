@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/kanon1343/fsegit/revparse"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+	"github.com/spf13/cobra"
+)
+
+var (
+	showRefHeads       bool
+	showRefTags        bool
+	showRefHash        bool
+	showRefDereference bool
+)
+
+// showRefCmd represents the show-ref command
+var showRefCmd = &cobra.Command{
+	Use:   "show-ref [--heads] [--tags] [--hash] [-d] [<pattern>...]",
+	Short: "List refs and the objects they point to",
+	Long: `Print "<hash> <ref>" for every ref under refs/, from both loose ref files and
+packed-refs, sorted by name. --heads and --tags limit the output to branches
+and tags. With patterns, only refs whose name is a pattern or ends with
+"/<pattern>" are shown, so "main" matches refs/heads/main and
+refs/remotes/origin/main.
+
+--hash prints only the hashes. -d also prints the object each annotated tag
+points to, as "<hash> <ref>^{}".
+
+The exit status is 1 if no ref is shown.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		refs, err := client.ListRefs("refs/")
+		if err != nil {
+			return err
+		}
+		out := cmd.OutOrStdout()
+		found := false
+		for _, ref := range refs {
+			if !showRefSelected(ref, args) {
+				continue
+			}
+			found = true
+			printShowRef(out, ref.Hash, ref.Name)
+			if !showRefDereference || !strings.HasPrefix(ref.Name, "refs/tags/") {
+				continue
+			}
+			peeled, err := revparse.Resolve(client, ref.Hash.String()+"^{}")
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(peeled, ref.Hash) {
+				printShowRef(out, peeled, ref.Name+"^{}")
+			}
+		}
+		if !found {
+			return &exitError{code: 1}
+		}
+		return nil
+	},
+}
+
+// showRefSelectedはrefが--heads、--tagsとpatternsの条件に合うかを返す.
+func showRefSelected(ref store.Ref, patterns []string) bool {
+	if showRefHeads || showRefTags {
+		if !(showRefHeads && strings.HasPrefix(ref.Name, "refs/heads/") ||
+			showRefTags && strings.HasPrefix(ref.Name, "refs/tags/")) {
+			return false
+		}
+	}
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ref.Name == pattern || strings.HasSuffix(ref.Name, "/"+pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// printShowRefはshow-refの1行を出力する.
+func printShowRef(out io.Writer, hash sha.SHA1, name string) {
+	if showRefHash {
+		fmt.Fprintln(out, hash)
+		return
+	}
+	fmt.Fprintf(out, "%s %s\n", hash, name)
+}
+
+func init() {
+	rootCmd.AddCommand(showRefCmd)
+
+	showRefCmd.Flags().BoolVar(&showRefHeads, "heads", false, "show only branches")
+	showRefCmd.Flags().BoolVar(&showRefTags, "tags", false, "show only tags")
+	showRefCmd.Flags().BoolVar(&showRefHash, "hash", false, "show only the hashes")
+	showRefCmd.Flags().BoolVarP(&showRefDereference, "dereference", "d", false, "also show the objects annotated tags point to")
+}
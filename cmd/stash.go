@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/store"
+	"github.com/spf13/cobra"
+)
+
+var stashMessage string
+
+// stashCmd represents the stash command
+var stashCmd = &cobra.Command{
+	Use:   "stash [push [-m <message>] | list | apply | pop | drop]",
+	Short: "Set local changes aside and restore them later",
+	Long: `Without a subcommand, the same as "stash push": save the changes to tracked
+files in the working tree and the index, then reset both to HEAD.
+
+Each saved entry is a commit recorded in refs/stash, and the older entries are
+kept in its reflog, so stash@{0} is the latest entry and stash@{1} the one
+before it. The entries can be shown with "stash list", and given to log,
+rev-parse and other commands as revisions.
+
+"stash apply" brings the changes of an entry (stash@{0} by default) back into
+the working tree with a three-way merge against the commit HEAD was on when
+it was saved. Conflicting files get conflict markers as in a merge. "stash pop"
+also drops the entry unless there were conflicts, and "stash drop" only drops
+it.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runStashPush(cmd)
+	},
+}
+
+// stashPushCmd represents the stash push command
+var stashPushCmd = &cobra.Command{
+	Use:   "push [-m <message>]",
+	Short: "Save local changes to a new stash entry",
+	Long: `Save the changes to tracked files in the working tree and the index as a new
+stash entry, then reset both to HEAD. -m sets the description of the entry,
+which is "WIP on <branch>: <commit>" by default. Untracked files are not saved.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runStashPush(cmd)
+	},
+}
+
+// stashListCmd represents the stash list command
+var stashListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the stash entries",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		entries, err := client.StashList()
+		if err != nil {
+			return err
+		}
+		for i, entry := range entries {
+			fmt.Fprintf(cmd.OutOrStdout(), "stash@{%d}: %s\n", i, entry.Message)
+		}
+		return nil
+	},
+}
+
+// stashApplyCmd represents the stash apply command
+var stashApplyCmd = &cobra.Command{
+	Use:   "apply [<stash>]",
+	Short: "Restore the changes of a stash entry",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, err := runStashApply(cmd, args)
+		return err
+	},
+}
+
+// stashPopCmd represents the stash pop command
+var stashPopCmd = &cobra.Command{
+	Use:   "pop [<stash>]",
+	Short: "Restore the changes of a stash entry and drop it",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		n, err := runStashApply(cmd, args)
+		if err != nil {
+			return err
+		}
+		return runStashDrop(cmd, n)
+	},
+}
+
+// stashDropCmd represents the stash drop command
+var stashDropCmd = &cobra.Command{
+	Use:   "drop [<stash>]",
+	Short: "Remove a stash entry",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		n, err := parseStashArg(args)
+		if err != nil {
+			return err
+		}
+		return runStashDrop(cmd, n)
+	},
+}
+
+// runStashPushは手元の変更を新しいエントリとして退避する.
+func runStashPush(cmd *cobra.Command) error {
+	client, err := newClient()
+	if err != nil {
+		return err
+	}
+	committer, err := client.Identity(store.Committer)
+	if err != nil {
+		printIdentityHint(cmd.ErrOrStderr(), err)
+		return err
+	}
+	hash, err := client.StashPush(stashMessage, committer)
+	if err != nil {
+		return err
+	}
+	if hash == nil {
+		fmt.Fprintln(cmd.ErrOrStderr(), i18n.Sprintf("No local changes to save"))
+		return nil
+	}
+	entries, err := client.StashList()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(cmd.OutOrStdout(), i18n.Sprintf("Saved working directory and index state %s", entries[0].Message))
+	return nil
+}
+
+// runStashApplyはargsで指定したエントリの変更を作業ツリーに戻し、そのエントリの番号を返す.
+// コンフリクトしたらエントリを残したまま終了コード1で終わる.
+func runStashApply(cmd *cobra.Command, args []string) (int, error) {
+	n, err := parseStashArg(args)
+	if err != nil {
+		return 0, err
+	}
+	client, err := newClient()
+	if err != nil {
+		return 0, err
+	}
+	conflicts, err := client.StashApply(n)
+	if err != nil {
+		return 0, err
+	}
+	if len(conflicts) > 0 {
+		out := cmd.ErrOrStderr()
+		for _, conflict := range conflicts {
+			fmt.Fprintln(out, i18n.Sprintf("CONFLICT (%s): Merge conflict in %s", conflict.Kind, conflict.Path))
+		}
+		fmt.Fprintln(out, i18n.Sprintf("The stash entry is kept in case you need it again."))
+		return 0, &exitError{code: 1}
+	}
+	return n, nil
+}
+
+// runStashDropはstash@{n}を取り除く.
+func runStashDrop(cmd *cobra.Command, n int) error {
+	client, err := newClient()
+	if err != nil {
+		return err
+	}
+	hash, err := client.StashDrop(n)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(cmd.OutOrStdout(), i18n.Sprintf("Dropped stash@{%d} (%s)", n, hash))
+	return nil
+}
+
+// parseStashArgは"stash@{1}"か"1"の形で指定されたエントリの番号を返す. 省略されていれば0を返す.
+func parseStashArg(args []string) (int, error) {
+	if len(args) == 0 {
+		return 0, nil
+	}
+	s := args[0]
+	if strings.HasPrefix(s, "stash@{") && strings.HasSuffix(s, "}") {
+		s = s[len("stash@{") : len(s)-1]
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%w : %s", store.ErrInvalidStash, args[0])
+	}
+	return n, nil
+}
+
+func init() {
+	rootCmd.AddCommand(stashCmd)
+	stashCmd.AddCommand(stashPushCmd, stashListCmd, stashApplyCmd, stashPopCmd, stashDropCmd)
+
+	stashCmd.Flags().StringVarP(&stashMessage, "message", "m", "", "describe the stash entry")
+	stashPushCmd.Flags().StringVarP(&stashMessage, "message", "m", "", "describe the stash entry")
+}
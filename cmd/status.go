@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/kanon1343/fsegit/color"
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/repo"
+	"github.com/kanon1343/fsegit/store"
+	"github.com/spf13/cobra"
+)
+
+var (
+	statusShort     bool
+	statusRenames   string
+	statusNoRenames bool
+	statusColor     string
+)
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:   "status [-s]",
+	Short: "Show the working tree status",
+	Long: `Show the changes staged in the index relative to HEAD, the changes in the
+working tree that are not staged yet, and the files that are not tracked.
+
+Files whose modification time and size match the index are assumed to be
+unchanged without reading them. With -s each path is printed on one line with
+a two-letter status code, like git status --short.
+
+Staged deletions and additions whose contents are similar are shown as
+renames, as in diff. --find-renames=<n> and --no-renames change this;
+status.renames, or diff.renames if it is not set, can turn it off by default.
+
+--color=<when> colors the paths: staged changes in green, and other changes
+and untracked files in red. <when> is always, never, or auto (the default) to
+color them only when writing to a terminal. color.status or color.ui in the
+config changes the default.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := newRepository()
+		if err != nil {
+			return err
+		}
+		status, err := r.Status()
+		if err != nil {
+			return err
+		}
+		if status.Staged, err = findRenames(r.Client(), status.Staged, statusRenames, statusNoRenames, "status.renames", "diff.renames"); err != nil {
+			return err
+		}
+		useColor, err := colorEnabled(r.Client(), cmd.OutOrStdout(), statusColor, "color.status")
+		if err != nil {
+			return err
+		}
+		if statusShort {
+			printShortStatus(cmd.OutOrStdout(), status, useColor)
+			return nil
+		}
+
+		return printStatus(cmd.OutOrStdout(), r, status, useColor)
+	},
+}
+
+// printStatusは現在のブランチとマージの状態に続けて、git statusと同じ形式で変更の一覧を書き出す.
+func printStatus(out io.Writer, r *repo.Repository, status *store.Status, useColor bool) error {
+	head, err := r.Head()
+	if err != nil {
+		return err
+	}
+	merge, err := r.Client().ReadMergeState()
+	if err != nil {
+		return err
+	}
+	if head.Detached() {
+		fmt.Fprintln(out, i18n.Sprintf("HEAD detached at %s", head.Hash.String()[:7]))
+	} else {
+		fmt.Fprintln(out, i18n.Sprintf("On branch %s", head.ShortBranch()))
+	}
+	if merge != nil {
+		if len(status.Unmerged) > 0 {
+			fmt.Fprintln(out, i18n.T("You have unmerged paths."))
+		} else {
+			fmt.Fprintln(out, i18n.T("All conflicts fixed but you are still merging."))
+		}
+	}
+	if head.Unborn() {
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, i18n.T("No commits yet"))
+	}
+	printLongStatus(out, status, useColor)
+	return nil
+}
+
+// printLongStatusはgit statusと同じ形式で変更の一覧を書き出す. useColorならパスに色を付ける.
+func printLongStatus(out io.Writer, status *store.Status, useColor bool) {
+	labels := map[store.ChangeType]string{
+		store.ChangeAdd:    i18n.T("new file:"),
+		store.ChangeModify: i18n.T("modified:"),
+		store.ChangeDelete: i18n.T("deleted:"),
+		store.ChangeRename: i18n.T("renamed:"),
+	}
+	section := func(title, code string, paths []string) {
+		if len(paths) == 0 {
+			return
+		}
+		if !useColor {
+			code = ""
+		}
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, title)
+		for _, path := range paths {
+			fmt.Fprintf(out, "\t%s\n", color.Wrap(code, path))
+		}
+	}
+	changes := func(changes []store.TreeChange) []string {
+		var lines []string
+		for _, change := range changes {
+			path := change.Path
+			if change.Type == store.ChangeRename {
+				path = change.OldPath + " -> " + change.Path
+			}
+			lines = append(lines, fmt.Sprintf("%-12s%s", labels[change.Type], path))
+		}
+		return lines
+	}
+
+	section(i18n.T("Changes to be committed:"), color.Green, changes(status.Staged))
+	var unmerged []string
+	for _, path := range status.Unmerged {
+		unmerged = append(unmerged, fmt.Sprintf("%-12s%s", i18n.T("unmerged:"), path))
+	}
+	section(i18n.T("Unmerged paths:"), color.Red, unmerged)
+	section(i18n.T("Changes not staged for commit:"), color.Red, changes(status.Unstaged))
+	section(i18n.T("Untracked files:"), color.Red, status.Untracked)
+
+	fmt.Fprintln(out)
+	switch {
+	case status.Clean():
+		fmt.Fprintln(out, i18n.T("nothing to commit, working tree clean"))
+	case len(status.Staged) == 0 && len(status.Unstaged) == 0 && len(status.Unmerged) == 0:
+		fmt.Fprintln(out, i18n.T("nothing added to commit but untracked files present"))
+	case len(status.Staged) == 0:
+		fmt.Fprintln(out, i18n.T("no changes added to commit"))
+	}
+}
+
+// printShortStatusはgit status --shortと同じ形式で1パス1行で書き出す.
+// 1文字目はインデックス、2文字目は作業ツリーの状態. useColorなら1文字目を緑、2文字目を赤にする.
+func printShortStatus(out io.Writer, status *store.Status, useColor bool) {
+	paint := func(code string, c byte) string {
+		if !useColor || c == ' ' {
+			return string(c)
+		}
+		return color.Wrap(code, string(c))
+	}
+	codes := map[string][2]byte{}
+	// renamedは名前を変えたファイルの変更後のパスから変更前のパスへの対応.
+	renamed := map[string]string{}
+	var paths []string
+	mark := func(path string, column int, code byte) {
+		c, ok := codes[path]
+		if !ok {
+			c = [2]byte{' ', ' '}
+			paths = append(paths, path)
+		}
+		c[column] = code
+		codes[path] = c
+	}
+	for _, change := range status.Staged {
+		mark(change.Path, 0, change.Type.String()[0])
+		if change.Type == store.ChangeRename {
+			renamed[change.Path] = change.OldPath
+		}
+	}
+	for _, change := range status.Unstaged {
+		mark(change.Path, 1, change.Type.String()[0])
+	}
+	for _, path := range status.Unmerged {
+		mark(path, 0, 'U')
+		mark(path, 1, 'U')
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		c := codes[path]
+		if old, ok := renamed[path]; ok {
+			fmt.Fprintf(out, "%s%s %s -> %s\n", paint(color.Green, c[0]), paint(color.Red, c[1]), old, path)
+			continue
+		}
+		fmt.Fprintf(out, "%s%s %s\n", paint(color.Green, c[0]), paint(color.Red, c[1]), path)
+	}
+	untracked := "??"
+	if useColor {
+		untracked = color.Wrap(color.Red, untracked)
+	}
+	for _, path := range status.Untracked {
+		fmt.Fprintf(out, "%s %s\n", untracked, path)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+
+	statusCmd.Flags().BoolVarP(&statusShort, "short", "s", false, "give the output in the short format")
+	statusCmd.Flags().StringVarP(&statusRenames, "find-renames", "M", "", "detect renames whose contents are at least the given percent similar")
+	statusCmd.Flags().Lookup("find-renames").NoOptDefVal = fmt.Sprintf("%d%%", store.DefaultRenameThreshold)
+	statusCmd.Flags().BoolVar(&statusNoRenames, "no-renames", false, "do not detect renames")
+	statusCmd.Flags().StringVar(&statusColor, "color", "", "color the output: always, never or auto")
+	statusCmd.Flags().Lookup("color").NoOptDefVal = "always"
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// submoduleCmd represents the submodule command
+var submoduleCmd = &cobra.Command{
+	Use:   "submodule",
+	Short: "Inspect submodules",
+	Long: `Without a subcommand, show the status of the submodules like "submodule status".
+
+A submodule is recorded in trees and the index as a gitlink entry (mode 160000)
+pointing at a commit of another repository, and its name, path and URL are
+described in the .gitmodules file at the top of the working tree. Checking out
+a commit only creates an empty directory for each submodule; its files are not
+checked out.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return submoduleStatusCmd.RunE(cmd, args)
+	},
+}
+
+// submoduleStatusCmd represents the submodule status command
+var submoduleStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the status of the submodules",
+	Long: `Show the commit recorded in the index and the path of each submodule, prefixed
+with "-" if the submodule is not checked out, "+" if the commit checked out in
+the submodule differs from the one in the index (that commit is shown
+instead), and "U" if the submodule has merge conflicts.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		statuses, err := client.SubmoduleStatuses()
+		if err != nil {
+			return err
+		}
+		out := cmd.OutOrStdout()
+		for _, status := range statuses {
+			flag, hash := " ", status.Hash
+			switch {
+			case status.Unmerged:
+				flag = "U"
+			case !status.Initialized():
+				flag = "-"
+			case status.Modified():
+				flag, hash = "+", status.Current
+			}
+			fmt.Fprintf(out, "%s%s %s\n", flag, hash, status.Path)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(submoduleCmd)
+	submoduleCmd.AddCommand(submoduleStatusCmd)
+}
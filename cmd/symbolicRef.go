@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/store"
+	"github.com/spf13/cobra"
+)
+
+var (
+	symbolicRefShort  bool
+	symbolicRefQuiet  bool
+	symbolicRefDelete bool
+)
+
+// symbolicRefCmd represents the symbolic-ref command
+var symbolicRefCmd = &cobra.Command{
+	Use:   "symbolic-ref [-q] [--short] <name> | <name> <ref> | -d <name>",
+	Short: "Read, modify and delete symbolic refs",
+	Long: `With one argument, print the ref that the symbolic ref <name> (usually HEAD)
+points to. --short strips refs/heads/ and similar prefixes. -q suppresses the
+error message when <name> is not a symbolic ref, for example a detached HEAD.
+
+With two arguments, make <name> point to <ref>, which must start with refs/.
+The target does not have to exist yet.
+
+With -d, delete the symbolic ref <name>.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		name := args[0]
+		switch {
+		case symbolicRefDelete:
+			if len(args) != 1 {
+				return i18n.Errorf("too many arguments")
+			}
+			if _, err := client.ReadSymbolicRef(name); err != nil {
+				return err
+			}
+			return client.DeleteRef(name)
+
+		case len(args) == 2:
+			target := args[1]
+			if !strings.HasPrefix(target, "refs/") {
+				return i18n.Errorf("refusing to point %s outside of refs/: %s", name, target)
+			}
+			if err := store.CheckRefName(target); err != nil {
+				return err
+			}
+			return client.WriteSymbolicRef(name, target)
+		}
+
+		target, err := client.ReadSymbolicRef(name)
+		if errors.Is(err, store.ErrNotSymbolicRef) && symbolicRefQuiet {
+			return &exitError{code: 1}
+		}
+		if err != nil {
+			return err
+		}
+		if symbolicRefShort {
+			target = shortRefName(target)
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), target)
+		return nil
+	},
+}
+
+// shortRefNameはrefs/heads/などの接頭辞を除いた参照名を返す.
+func shortRefName(name string) string {
+	for _, prefix := range []string{"refs/heads/", "refs/tags/", "refs/remotes/"} {
+		if strings.HasPrefix(name, prefix) {
+			return strings.TrimPrefix(name, prefix)
+		}
+	}
+	return name
+}
+
+func init() {
+	rootCmd.AddCommand(symbolicRefCmd)
+
+	symbolicRefCmd.Flags().BoolVar(&symbolicRefShort, "short", false, "shorten the ref name")
+	symbolicRefCmd.Flags().BoolVarP(&symbolicRefQuiet, "quiet", "q", false, "do not report an error for a non-symbolic ref")
+	symbolicRefCmd.Flags().BoolVarP(&symbolicRefDelete, "delete", "d", false, "delete the symbolic ref")
+}
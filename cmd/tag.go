@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/repo"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+	"github.com/kanon1343/fsegit/wildmatch"
+	"github.com/spf13/cobra"
+)
+
+var (
+	tagAnnotate bool
+	tagMessages []string
+	tagDelete   bool
+	tagForce    bool
+	tagList     bool
+	tagSign     bool
+)
+
+// tagCmd represents the tag command
+var tagCmd = &cobra.Command{
+	Use:   "tag [-l [<pattern>...]] | [-a | -s] [-m <message>] [-f] <name> [<object>] | -d <name>...",
+	Short: "Create, list or delete tags",
+	Long: `Without arguments, or with -l, list the tags under refs/tags. With -l the
+tags can be filtered by shell wildcard patterns.
+
+With a name, create a lightweight tag pointing at HEAD or at the given object.
+With -a or -m, create an annotated tag object instead, recording the tagger
+(taken like the committer of a commit) and the message. An existing tag is only
+replaced with -f.
+
+With -s, create an annotated tag signed like "commit -S" does, with the
+signature appended to the message. Annotated tags are also signed when
+tag.gpgSign is true. "verify-tag" checks the signature.
+
+With -d, delete the named tags.`,
+	ValidArgsFunction: completeRefs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		out := cmd.OutOrStdout()
+		switch {
+		case tagDelete:
+			if len(args) == 0 {
+				return i18n.Errorf("tag name required")
+			}
+			for _, name := range args {
+				hash, err := client.DeleteTag(name)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(out, i18n.Sprintf("Deleted tag '%s' (was %s)", name, hash.String()[:7]))
+			}
+			return nil
+
+		case tagList || len(args) == 0:
+			return listTags(cmd, client, args)
+
+		case len(args) > 2:
+			return i18n.Errorf("too many arguments")
+		}
+
+		var target sha.SHA1
+		if len(args) == 2 {
+			target, err = resolveCommitish(client, args[1])
+		} else {
+			target, err = client.ResolveHeadCommit()
+		}
+		if err != nil {
+			return err
+		}
+
+		var old sha.SHA1
+		if tagAnnotate || tagSign || len(tagMessages) > 0 {
+			message := repo.CleanupMessage(strings.Join(tagMessages, "\n\n"))
+			if message == "" {
+				return i18n.Errorf("no tag message given; use -m")
+			}
+			tagger, err := client.Identity(store.Committer)
+			if err != nil {
+				printIdentityHint(cmd.ErrOrStderr(), err)
+				return err
+			}
+			cfg, err := client.Config()
+			if err != nil {
+				return err
+			}
+			sign, err := cfg.GetBool("tag.gpgsign", false)
+			if err != nil {
+				return err
+			}
+			create := client.CreateAnnotatedTag
+			if sign || tagSign {
+				create = client.CreateSignedTag
+			}
+			if _, old, err = create(args[0], target, tagger, message, tagForce); err != nil {
+				return err
+			}
+		} else if old, err = client.CreateTag(args[0], target, tagForce); err != nil {
+			return err
+		}
+		if old != nil {
+			fmt.Fprintln(out, i18n.Sprintf("Updated tag '%s' (was %s)", args[0], old.String()[:7]))
+		}
+		return nil
+	},
+}
+
+// listTagsはpatternsのいずれかにマッチするタグを名前順に表示する. patternsが空なら全てのタグを表示する.
+func listTags(cmd *cobra.Command, client *store.Client, patterns []string) error {
+	tags, err := client.ListTags()
+	if err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		name := strings.TrimPrefix(tag.Name, "refs/tags/")
+		matched := len(patterns) == 0
+		for _, pattern := range patterns {
+			if wildmatch.Match(pattern, name, 0) {
+				matched = true
+				break
+			}
+		}
+		if matched {
+			fmt.Fprintln(cmd.OutOrStdout(), name)
+		}
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(tagCmd)
+
+	tagCmd.Flags().BoolVarP(&tagAnnotate, "annotate", "a", false, "create an annotated tag object")
+	tagCmd.Flags().StringArrayVarP(&tagMessages, "message", "m", nil, "use the given message for an annotated tag")
+	tagCmd.Flags().BoolVarP(&tagDelete, "delete", "d", false, "delete tags")
+	tagCmd.Flags().BoolVarP(&tagForce, "force", "f", false, "replace an existing tag")
+	tagCmd.Flags().BoolVarP(&tagList, "list", "l", false, "list tags, optionally filtered by patterns")
+	tagCmd.Flags().BoolVarP(&tagSign, "sign", "s", false, "create a signed annotated tag")
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/tui"
+	"github.com/spf13/cobra"
+)
+
+var tuiPageSize int
+
+// tuiCmd represents the tui command
+var tuiCmd = &cobra.Command{
+	Use:   "tui",
+	Short: "Browse the history and stage changes interactively in the terminal",
+	Long: `Show the commit graph of HEAD page by page, open a commit to see its diff,
+and stage or unstage the changes in the working tree by file or by hunk.
+
+Commands are read one line at a time:
+
+  l, n, p            show the current, next or previous page of the graph
+  <number>           show the commit with that number and its diff
+  s                  list the staged, unstaged and untracked files
+  d <file>           show the diff of a listed file with numbered hunks
+  a <file> [<hunk>]  stage the file, or only the hunk with that number
+  r <file> [<hunk>]  unstage the file, or only the hunk with that number
+  h, q               show the commands or quit`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		head, err := client.ReadHead()
+		if err != nil {
+			return err
+		}
+		// まだコミットがなくても、ファイルのステージには使える.
+		var start sha.SHA1
+		if !head.Unborn() {
+			start = head.Hash
+		}
+		browser := tui.NewBrowser(client, cmd.InOrStdin(), cmd.OutOrStdout())
+		browser.PageSize = tuiPageSize
+		return browser.Run(start)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(tuiCmd)
+
+	tuiCmd.Flags().IntVar(&tuiPageSize, "page-size", tui.DefaultPageSize, "number of commits shown per page")
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/revparse"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+	"github.com/spf13/cobra"
+)
+
+var (
+	updateRefMessage string
+	updateRefDelete  bool
+	updateRefNoDeref bool
+)
+
+// updateRefCmd represents the update-ref command
+var updateRefCmd = &cobra.Command{
+	Use:   "update-ref [-m <reason>] [--no-deref] (-d <ref> [<old>] | <ref> <new> [<old>])",
+	Short: "Update the object name stored in a ref safely",
+	Long: `Make <ref> point to <new>, or delete it with -d. If <ref> is a symbolic ref
+such as HEAD, the ref it points to is updated instead, unless --no-deref is
+given.
+
+With <old>, the ref is changed only if it still points to <old>; the check is
+done while the ref is locked, so a concurrent update is never lost. An empty
+<old> or 40 zeros means the ref must not exist yet.
+
+The update is recorded in the reflog of the ref with -m as the reason.`,
+	Args: cobra.RangeArgs(1, 3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if updateRefDelete && len(args) > 2 || !updateRefDelete && len(args) < 2 {
+			return i18n.Errorf("wrong number of arguments")
+		}
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		name := args[0]
+		if err := store.CheckRefName(name); err != nil {
+			return err
+		}
+		if !updateRefNoDeref {
+			if name, err = client.DerefRefName(name); err != nil {
+				return err
+			}
+		}
+
+		oldArg := 1
+		if !updateRefDelete {
+			oldArg = 2
+		}
+		var old sha.SHA1
+		if len(args) > oldArg {
+			if old, err = parseOldValue(client, args[oldArg]); err != nil {
+				return err
+			}
+		}
+		if updateRefDelete {
+			return client.DeleteRefIfMatch(name, old)
+		}
+		hash, err := revparse.Resolve(client, args[1])
+		if err != nil {
+			return err
+		}
+		return client.UpdateRefIfMatch(name, hash, old, updateRefMessage)
+	},
+}
+
+// parseOldValueはupdate-refの<old>を解釈する. 空文字列か全て0のハッシュは参照がまだないことを表す.
+func parseOldValue(client *store.Client, arg string) (sha.SHA1, error) {
+	if arg == "" || arg == "0000000000000000000000000000000000000000" {
+		return make(sha.SHA1, 20), nil
+	}
+	return revparse.Resolve(client, arg)
+}
+
+func init() {
+	rootCmd.AddCommand(updateRefCmd)
+
+	updateRefCmd.Flags().StringVarP(&updateRefMessage, "message", "m", "", "reason of the update for the reflog")
+	updateRefCmd.Flags().BoolVarP(&updateRefDelete, "delete", "d", false, "delete the ref")
+	updateRefCmd.Flags().BoolVar(&updateRefNoDeref, "no-deref", false, "update the symbolic ref itself")
+}
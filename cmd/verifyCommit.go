@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kanon1343/fsegit/revparse"
+	"github.com/kanon1343/fsegit/store"
+	"github.com/spf13/cobra"
+)
+
+// verifyCommitCmd represents the verify-commit command
+var verifyCommitCmd = &cobra.Command{
+	Use:   "verify-commit <commit>...",
+	Short: "Check the signatures of commits",
+	Long: `Check the signature in the gpgsig header of each commit made by "commit -S".
+The output of gpg, gpgsm or ssh-keygen is printed to standard error. SSH
+signatures are checked against the keys in gpg.ssh.allowedSignersFile.
+
+The command fails if a commit is not signed or a signature is not valid.`,
+	Args:              cobra.MinimumNArgs(1),
+	ValidArgsFunction: completeRefs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		return verifySignatures(cmd, args, func(name string) (string, error) {
+			hash, err := revparse.Resolve(client, name+"^{commit}")
+			if err != nil {
+				return "", err
+			}
+			return client.VerifyCommit(hash)
+		})
+	},
+}
+
+// verifySignaturesはargsのそれぞれをverifyで検証し、検証したプログラムの出力を標準エラー出力に表示する.
+// 署名が正しくないものがあれば、全て検証した後に終了コード1で終わる.
+func verifySignatures(cmd *cobra.Command, args []string, verify func(name string) (string, error)) error {
+	bad := false
+	for _, name := range args {
+		output, err := verify(name)
+		fmt.Fprint(cmd.ErrOrStderr(), output)
+		if errors.Is(err, store.ErrBadSignature) {
+			bad = true
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if bad {
+		return &exitError{code: 1}
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCommitCmd)
+}
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"github.com/kanon1343/fsegit/revparse"
+	"github.com/spf13/cobra"
+)
+
+// verifyTagCmd represents the verify-tag command
+var verifyTagCmd = &cobra.Command{
+	Use:   "verify-tag <tag>...",
+	Short: "Check the signatures of tags",
+	Long: `Check the signature at the end of the message of each annotated tag made by
+"tag -s", like "verify-commit" does for commits.
+
+The command fails if a tag is not signed or a signature is not valid.`,
+	Args:              cobra.MinimumNArgs(1),
+	ValidArgsFunction: completeRefs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		return verifySignatures(cmd, args, func(name string) (string, error) {
+			hash, err := revparse.Resolve(client, name)
+			if err != nil {
+				return "", err
+			}
+			return client.VerifyTag(hash)
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyTagCmd)
+}
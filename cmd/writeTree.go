@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// writeTreeCmd represents the write-tree command
+var writeTreeCmd = &cobra.Command{
+	Use:   "write-tree",
+	Short: "Create a tree object from the index",
+	Long: `Write tree objects for the current contents of the index, the same ones
+commit would record, and print the hash of the top-level tree. Subtrees that
+have not changed since the last commit are reused from the index.
+
+The index must not have unmerged paths. HEAD and the working tree are not
+touched; combine with commit-tree and update-ref to make a commit by hand.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		index, err := client.ReadIndex()
+		if err != nil {
+			return err
+		}
+		tree, err := client.WriteTree(index)
+		if err != nil {
+			return err
+		}
+		// 組み立てたツリーをTREE拡張としてインデックスに残し、次に使う.
+		if err := client.WriteIndex(index); err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), tree)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(writeTreeCmd)
+}
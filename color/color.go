@@ -0,0 +1,58 @@
+// Package colorは端末への出力に色を付けるためのANSIエスケープシーケンスと、色を付けるかの判定を扱う.
+package color
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// 出力に使う色. gitの既定の色に合わせてある.
+const (
+	Reset  = "\x1b[m"
+	Bold   = "\x1b[1m"
+	Red    = "\x1b[31m"
+	Green  = "\x1b[32m"
+	Yellow = "\x1b[33m"
+	Cyan   = "\x1b[36m"
+)
+
+var ErrInvalidWhen = errors.New("invalid color setting")
+
+// Wrapはsをcodeの色で囲む. codeが空ならsをそのまま返す.
+func Wrap(code, s string) string {
+	if code == "" || s == "" {
+		return s
+	}
+	return code + s + Reset
+}
+
+// Enabledは--colorやcolor.uiの値whenから、wに色を付けて書くかを返す. whenは"always"、"never"(または"false")、
+// "auto"(または"true")のどれかで、空なら"auto"とみなす. "auto"では、wが端末で、環境変数NO_COLORが
+// 空でなく設定されておらず、TERMが"dumb"でなければ色を付ける.
+func Enabled(when string, w io.Writer) (bool, error) {
+	switch when {
+	case "always":
+		return true, nil
+	case "never", "false":
+		return false, nil
+	case "auto", "true", "":
+	default:
+		return false, fmt.Errorf("%w : %q", ErrInvalidWhen, when)
+	}
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false, nil
+	}
+	return isTerminal(w), nil
+}
+
+// isTerminalはwが端末(キャラクタデバイス)に書き込むファイルかを返す.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
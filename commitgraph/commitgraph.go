@@ -0,0 +1,337 @@
+// Package commitgraphはgitのコミットグラフファイル(objects/info/commit-graph)を読み書きする.
+// コミットグラフにはコミットごとにツリー、親、世代数、コミット日時が並んでいて、
+// コミットオブジェクトを展開せずに履歴を辿れる.
+package commitgraph
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/kanon1343/fsegit/sha"
+)
+
+var (
+	ErrInvalidGraph  = errors.New("invalid commit-graph file")
+	ErrMissingParent = errors.New("parent is not in the commit-graph")
+)
+
+const (
+	signature   = "CGPH"
+	version     = 1
+	hashVersion = 1 // SHA-1
+
+	chunkOIDFanout   = 0x4f494446 // "OIDF"
+	chunkOIDLookup   = 0x4f49444c // "OIDL"
+	chunkCommitData  = 0x43444154 // "CDAT"
+	chunkExtraEdges  = 0x45444745 // "EDGE"
+	commitDataSize   = 20 + 16
+	headerSize       = 8
+	chunkLookupWidth = 12
+
+	// parentNoneは親がないことを表すCDATの値. parentExtraEdgesが立っていれば、
+	// 2つ目の親の欄は3つ目以降の親を並べたEDGEチャンクの位置になる.
+	parentNone       = 0x70000000
+	parentExtraEdges = 0x80000000
+
+	// MaxGenerationは書き込める世代数の上限. CDATでは30bitで持つ.
+	MaxGeneration = 1<<30 - 1
+)
+
+// Commitはコミットグラフの1コミット分の情報.
+type Commit struct {
+	Hash    sha.SHA1
+	Tree    sha.SHA1
+	Parents []sha.SHA1
+	// Generationは根のコミットを1とし、それ以外は親の世代数の最大値に1を足したもの.
+	Generation uint32
+	// CommitTimeはコミッターの日時(Unix時間).
+	CommitTime int64
+}
+
+// Graphは読み込んだコミットグラフファイル.
+type Graph struct {
+	fanout     [256]uint32
+	oids       []byte
+	commitData []byte
+	extraEdges []byte
+}
+
+// Parseはコミットグラフファイルの内容を読む. チェックサムとチャンクの大きさを確かめる.
+func Parse(data []byte) (*Graph, error) {
+	if len(data) < headerSize+chunkLookupWidth+20 || string(data[:4]) != signature {
+		return nil, fmt.Errorf("%w : bad signature", ErrInvalidGraph)
+	}
+	if data[4] != version {
+		return nil, fmt.Errorf("%w : unsupported version %d", ErrInvalidGraph, data[4])
+	}
+	if data[5] != hashVersion {
+		return nil, fmt.Errorf("%w : unsupported hash version %d", ErrInvalidGraph, data[5])
+	}
+	sum := sha1.Sum(data[:len(data)-20])
+	if !bytes.Equal(sum[:], data[len(data)-20:]) {
+		return nil, fmt.Errorf("%w : checksum mismatch", ErrInvalidGraph)
+	}
+
+	// チャンクの表は(ID, 位置)の組が並び、ID 0の終端の位置が最後のチャンクの終わりになる.
+	chunkCount := int(data[6])
+	tail := len(data) - 20
+	if headerSize+(chunkCount+1)*chunkLookupWidth > tail {
+		return nil, fmt.Errorf("%w : truncated chunk table", ErrInvalidGraph)
+	}
+	chunks := map[uint32][]byte{}
+	for i := 0; i < chunkCount; i++ {
+		entry := data[headerSize+i*chunkLookupWidth:]
+		id := binary.BigEndian.Uint32(entry)
+		start := binary.BigEndian.Uint64(entry[4:])
+		end := binary.BigEndian.Uint64(entry[4+chunkLookupWidth:])
+		if start > end || end > uint64(tail) {
+			return nil, fmt.Errorf("%w : bad chunk offset", ErrInvalidGraph)
+		}
+		chunks[id] = data[start:end]
+	}
+
+	g := &Graph{extraEdges: chunks[chunkExtraEdges]}
+	fanout, ok := chunks[chunkOIDFanout]
+	if !ok || len(fanout) != 256*4 {
+		return nil, fmt.Errorf("%w : bad OID fanout chunk", ErrInvalidGraph)
+	}
+	for i := range g.fanout {
+		g.fanout[i] = binary.BigEndian.Uint32(fanout[i*4:])
+		if i > 0 && g.fanout[i] < g.fanout[i-1] {
+			return nil, fmt.Errorf("%w : bad fanout table", ErrInvalidGraph)
+		}
+	}
+	n := int(g.fanout[255])
+	if g.oids = chunks[chunkOIDLookup]; len(g.oids) != n*20 {
+		return nil, fmt.Errorf("%w : bad OID lookup chunk", ErrInvalidGraph)
+	}
+	if g.commitData = chunks[chunkCommitData]; len(g.commitData) != n*commitDataSize {
+		return nil, fmt.Errorf("%w : bad commit data chunk", ErrInvalidGraph)
+	}
+	if len(g.extraEdges)%4 != 0 {
+		return nil, fmt.Errorf("%w : bad extra edges chunk", ErrInvalidGraph)
+	}
+	return g, nil
+}
+
+// Countはコミットグラフにあるコミットの数を返す.
+func (g *Graph) Count() int {
+	return int(g.fanout[255])
+}
+
+// Lookupはhashのコミットを返す. コミットグラフになければfalseを返す.
+func (g *Graph) Lookup(hash sha.SHA1) (*Commit, bool, error) {
+	if len(hash) != 20 {
+		return nil, false, nil
+	}
+	lo := 0
+	if hash[0] > 0 {
+		lo = int(g.fanout[hash[0]-1])
+	}
+	hi := int(g.fanout[hash[0]])
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		return bytes.Compare(g.oid(lo+i), hash) >= 0
+	})
+	if i >= hi || !bytes.Equal(g.oid(i), hash) {
+		return nil, false, nil
+	}
+	commit, err := g.commit(i)
+	return commit, err == nil, err
+}
+
+func (g *Graph) oid(i int) []byte {
+	return g.oids[i*20 : i*20+20]
+}
+
+// commitはi番目のコミットの情報を読む.
+func (g *Graph) commit(i int) (*Commit, error) {
+	data := g.commitData[i*commitDataSize:]
+	commit := &Commit{
+		Hash: sha.SHA1(append([]byte{}, g.oid(i)...)),
+		Tree: sha.SHA1(append([]byte{}, data[:20]...)),
+	}
+	parent := func(pos uint32) (sha.SHA1, error) {
+		if int(pos) >= g.Count() {
+			return nil, fmt.Errorf("%w : bad parent position %d", ErrInvalidGraph, pos)
+		}
+		return sha.SHA1(append([]byte{}, g.oid(int(pos))...)), nil
+	}
+
+	first, second := binary.BigEndian.Uint32(data[20:]), binary.BigEndian.Uint32(data[24:])
+	if first != parentNone {
+		p, err := parent(first)
+		if err != nil {
+			return nil, err
+		}
+		commit.Parents = append(commit.Parents, p)
+	}
+	switch {
+	case second == parentNone:
+	case second&parentExtraEdges == 0:
+		p, err := parent(second)
+		if err != nil {
+			return nil, err
+		}
+		commit.Parents = append(commit.Parents, p)
+	default:
+		// EDGEチャンクには2つ目以降の親が並び、最後の親に最上位ビットが立っている.
+		for j := int(second &^ parentExtraEdges); ; j++ {
+			if j*4+4 > len(g.extraEdges) {
+				return nil, fmt.Errorf("%w : bad extra edge position %d", ErrInvalidGraph, j)
+			}
+			edge := binary.BigEndian.Uint32(g.extraEdges[j*4:])
+			p, err := parent(edge &^ parentExtraEdges)
+			if err != nil {
+				return nil, err
+			}
+			commit.Parents = append(commit.Parents, p)
+			if edge&parentExtraEdges != 0 {
+				break
+			}
+		}
+	}
+
+	// 上位30bitが世代数、残りの34bitがコミット日時.
+	generationAndTime := binary.BigEndian.Uint64(data[28:])
+	commit.Generation = uint32(generationAndTime >> 34)
+	commit.CommitTime = int64(generationAndTime & (1<<34 - 1))
+	return commit, nil
+}
+
+// Writeはcommitsからコミットグラフファイルを書き出す. 親は全てcommitsに含まれていなければならない.
+// 世代数はcommitsの親子関係から求め直すので、Generationは設定しなくてよい.
+func Write(w io.Writer, commits []Commit) error {
+	sorted := make([]Commit, len(commits))
+	copy(sorted, commits)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i].Hash, sorted[j].Hash) < 0 })
+	positions := make(map[string]uint32, len(sorted))
+	for i, commit := range sorted {
+		positions[string(commit.Hash)] = uint32(i)
+	}
+	for _, commit := range sorted {
+		for _, parent := range commit.Parents {
+			if _, ok := positions[string(parent)]; !ok {
+				return fmt.Errorf("%w : %s (parent of %s)", ErrMissingParent, parent, commit.Hash)
+			}
+		}
+	}
+	generations, err := computeGenerations(sorted, positions)
+	if err != nil {
+		return err
+	}
+
+	var fanout, oids, commitData, extraEdges bytes.Buffer
+	var counts [256]uint32
+	for _, commit := range sorted {
+		counts[commit.Hash[0]]++
+		oids.Write(commit.Hash)
+	}
+	for i := 1; i < 256; i++ {
+		counts[i] += counts[i-1]
+	}
+	binary.Write(&fanout, binary.BigEndian, counts)
+
+	for i, commit := range sorted {
+		commitData.Write(commit.Tree)
+		first, second := uint32(parentNone), uint32(parentNone)
+		switch len(commit.Parents) {
+		case 0:
+		case 1:
+			first = positions[string(commit.Parents[0])]
+		case 2:
+			first, second = positions[string(commit.Parents[0])], positions[string(commit.Parents[1])]
+		default:
+			first = positions[string(commit.Parents[0])]
+			second = parentExtraEdges | uint32(extraEdges.Len()/4)
+			for j, parent := range commit.Parents[1:] {
+				edge := positions[string(parent)]
+				if j == len(commit.Parents)-2 {
+					edge |= parentExtraEdges
+				}
+				binary.Write(&extraEdges, binary.BigEndian, edge)
+			}
+		}
+		binary.Write(&commitData, binary.BigEndian, first)
+		binary.Write(&commitData, binary.BigEndian, second)
+		commitTime := uint64(commit.CommitTime)
+		if commit.CommitTime < 0 || commitTime >= 1<<34 {
+			commitTime = 0
+		}
+		binary.Write(&commitData, binary.BigEndian, uint64(generations[i])<<34|commitTime)
+	}
+
+	type chunk struct {
+		id   uint32
+		data []byte
+	}
+	chunks := []chunk{{chunkOIDFanout, fanout.Bytes()}, {chunkOIDLookup, oids.Bytes()}, {chunkCommitData, commitData.Bytes()}}
+	if extraEdges.Len() > 0 {
+		chunks = append(chunks, chunk{chunkExtraEdges, extraEdges.Bytes()})
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(signature)
+	buf.Write([]byte{version, hashVersion, byte(len(chunks)), 0})
+	offset := uint64(headerSize + (len(chunks)+1)*chunkLookupWidth)
+	for _, c := range chunks {
+		binary.Write(&buf, binary.BigEndian, c.id)
+		binary.Write(&buf, binary.BigEndian, offset)
+		offset += uint64(len(c.data))
+	}
+	binary.Write(&buf, binary.BigEndian, uint32(0))
+	binary.Write(&buf, binary.BigEndian, offset)
+	for _, c := range chunks {
+		buf.Write(c.data)
+	}
+	sum := sha1.Sum(buf.Bytes())
+	buf.Write(sum[:])
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// computeGenerationsはsortedのそれぞれのコミットの世代数を求める. 深い履歴でもスタックを使い切らないように、
+// 再帰ではなく明示的なスタックで求める. 親子関係が循環していればErrInvalidGraphを返す.
+func computeGenerations(sorted []Commit, positions map[string]uint32) ([]uint32, error) {
+	generations := make([]uint32, len(sorted))
+	visiting := make([]bool, len(sorted))
+	for i := range sorted {
+		stack := []int{i}
+		for len(stack) > 0 {
+			top := stack[len(stack)-1]
+			if generations[top] > 0 {
+				stack = stack[:len(stack)-1]
+				continue
+			}
+			visiting[top] = true
+			generation, pending := uint32(1), false
+			for _, parent := range sorted[top].Parents {
+				p := int(positions[string(parent)])
+				if generations[p] == 0 {
+					if visiting[p] {
+						return nil, fmt.Errorf("%w : cycle at %s", ErrInvalidGraph, sorted[p].Hash)
+					}
+					stack = append(stack, p)
+					pending = true
+					continue
+				}
+				if generations[p]+1 > generation {
+					generation = generations[p] + 1
+				}
+			}
+			if !pending {
+				if generation > MaxGeneration {
+					generation = MaxGeneration
+				}
+				generations[top] = generation
+				visiting[top] = false
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	return generations, nil
+}
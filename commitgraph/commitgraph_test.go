@@ -0,0 +1,98 @@
+package commitgraph
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/kanon1343/fsegit/sha"
+)
+
+func testHash(s string) sha.SHA1 {
+	sum := sha1.Sum([]byte(s))
+	return sum[:]
+}
+
+// 書き出したコミットグラフを読むと、親、世代数、日時が元に戻るか
+func TestWriteParse(t *testing.T) {
+	root := Commit{Hash: testHash("root"), Tree: testHash("tree1"), CommitTime: 1672531200}
+	a := Commit{Hash: testHash("a"), Tree: testHash("tree2"), Parents: []sha.SHA1{root.Hash}, CommitTime: 1672531300}
+	b := Commit{Hash: testHash("b"), Tree: testHash("tree3"), Parents: []sha.SHA1{root.Hash}, CommitTime: 1672531400}
+	c := Commit{Hash: testHash("c"), Tree: testHash("tree4"), Parents: []sha.SHA1{a.Hash}, CommitTime: 1672531500}
+	merge := Commit{Hash: testHash("merge"), Tree: testHash("tree5"), Parents: []sha.SHA1{c.Hash, b.Hash}, CommitTime: 1672531600}
+	octopus := Commit{Hash: testHash("octopus"), Tree: testHash("tree6"), Parents: []sha.SHA1{merge.Hash, a.Hash, b.Hash, c.Hash}, CommitTime: 1672531700}
+	commits := []Commit{octopus, merge, c, b, a, root}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, commits); err != nil {
+		t.Fatal(err)
+	}
+	g, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Count() != len(commits) {
+		t.Errorf("Count() = %d, want %d", g.Count(), len(commits))
+	}
+	generations := map[string]uint32{"root": 1, "a": 2, "b": 2, "c": 3, "merge": 4, "octopus": 5}
+	for _, want := range commits {
+		got, ok, err := g.Lookup(want.Hash)
+		if err != nil || !ok {
+			t.Fatalf("Lookup(%s) = %v, %v", want.Hash, ok, err)
+		}
+		for name, generation := range generations {
+			if bytes.Equal(testHash(name), want.Hash) {
+				want.Generation = generation
+			}
+		}
+		if !reflect.DeepEqual(*got, want) {
+			t.Errorf("Lookup(%s) = %+v, want %+v", want.Hash, *got, want)
+		}
+	}
+	if _, ok, err := g.Lookup(testHash("unknown")); ok || err != nil {
+		t.Errorf("Lookup(unknown) = %v, %v, want not found", ok, err)
+	}
+
+	// 1バイトでも変わっていればチェックサムで気付く.
+	data := buf.Bytes()
+	data[len(data)/2] ^= 0xff
+	if _, err := Parse(data); !errors.Is(err, ErrInvalidGraph) {
+		t.Errorf("Parse(corrupt) error = %v, want %v", err, ErrInvalidGraph)
+	}
+}
+
+// 親がないコミットグラフは書き出さない
+func TestWriteMissingParent(t *testing.T) {
+	commits := []Commit{{Hash: testHash("a"), Tree: testHash("tree"), Parents: []sha.SHA1{testHash("missing")}}}
+	if err := Write(&bytes.Buffer{}, commits); !errors.Is(err, ErrMissingParent) {
+		t.Errorf("Write() error = %v, want %v", err, ErrMissingParent)
+	}
+}
+
+// 長い履歴でも世代数を求められるか
+func TestWriteDeepHistory(t *testing.T) {
+	var commits []Commit
+	var parent sha.SHA1
+	for i := 0; i < 100000; i++ {
+		commit := Commit{Hash: testHash(fmt.Sprint(i)), Tree: testHash("tree")}
+		if parent != nil {
+			commit.Parents = []sha.SHA1{parent}
+		}
+		commits = append(commits, commit)
+		parent = commit.Hash
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, commits); err != nil {
+		t.Fatal(err)
+	}
+	g, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tip, ok, err := g.Lookup(parent); err != nil || !ok || tip.Generation != 100000 {
+		t.Errorf("Lookup(tip) = %+v, %v, %v, want generation 100000", tip, ok, err)
+	}
+}
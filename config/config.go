@@ -0,0 +1,334 @@
+// Package configはgitの設定ファイル(.git/configなど)を読み書きする.
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidConfig = errors.New("invalid config")
+
+// Configは設定ファイルの内容を保持する. 同じキーが複数回現れた場合は全ての値を保持する.
+type Config struct {
+	values map[string][]string
+	// entriesは全ての値を現れた順に保持する.
+	entries []Entry
+}
+
+// Entryは設定の1つの値. Keyはセクション名と変数名を小文字にした"core.bare"のような形.
+type Entry struct {
+	Key   string
+	Value string
+}
+
+// Newは空のConfigを返す.
+func New() *Config {
+	return &Config{values: map[string][]string{}}
+}
+
+// addはkeyにvalueを追加する. keyは正規化してあること.
+func (c *Config) add(key, value string) {
+	c.values[key] = append(c.values[key], value)
+	c.entries = append(c.entries, Entry{Key: key, Value: value})
+}
+
+// Entriesは全ての値を読み込んだ順に返す.
+func (c *Config) Entries() []Entry {
+	return c.entries
+}
+
+// Loadはpathの設定ファイルを読み込む. ファイルが存在しない場合は空のConfigを返す.
+func Load(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return New(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// LoadDefaultsはリポジトリの外の設定を、システム全体、利用者全体の順に読んで重ねる.
+func LoadDefaults() (*Config, error) {
+	c, err := LoadSystem()
+	if err != nil {
+		return nil, err
+	}
+	global, err := LoadGlobal()
+	if err != nil {
+		return nil, err
+	}
+	c.Merge(global)
+	return c, nil
+}
+
+// SystemPathはシステム全体の設定ファイルの場所を返す. 環境変数GIT_CONFIG_SYSTEMがあればそれを、なければ/etc/gitconfigを返す.
+func SystemPath() string {
+	if path := os.Getenv("GIT_CONFIG_SYSTEM"); path != "" {
+		return path
+	}
+	return "/etc/gitconfig"
+}
+
+// LoadSystemはシステム全体の設定を読み込む. 環境変数GIT_CONFIG_NOSYSTEMが真なら読まない.
+func LoadSystem() (*Config, error) {
+	if skip, err := ParseBool(os.Getenv("GIT_CONFIG_NOSYSTEM")); err == nil && skip {
+		return New(), nil
+	}
+	return Load(SystemPath())
+}
+
+// globalPathsは利用者全体の設定ファイルを読む順に返す. 環境変数GIT_CONFIG_GLOBALがあればそのファイルだけを、
+// なければgitと同じく$XDG_CONFIG_HOME/git/config(~/.config/git/config)、~/.gitconfigを返す.
+func globalPaths() []string {
+	if path := os.Getenv("GIT_CONFIG_GLOBAL"); path != "" {
+		return []string{path}
+	}
+
+	var paths []string
+	home, _ := os.UserHomeDir()
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		paths = append(paths, filepath.Join(xdg, "git", "config"))
+	} else if home != "" {
+		paths = append(paths, filepath.Join(home, ".config", "git", "config"))
+	}
+	if home != "" {
+		paths = append(paths, filepath.Join(home, ".gitconfig"))
+	}
+	return paths
+}
+
+// GlobalPathは利用者全体の設定を書き込むファイルを返す. gitと同じく~/.gitconfigがなく、
+// XDGの場所のファイルだけがあればそちらに書く. ホームディレクトリが分からなければ空文字列を返す.
+func GlobalPath() string {
+	paths := globalPaths()
+	if len(paths) == 0 {
+		return ""
+	}
+	last := paths[len(paths)-1]
+	if len(paths) == 2 {
+		if _, err := os.Stat(last); os.IsNotExist(err) {
+			if _, err := os.Stat(paths[0]); err == nil {
+				return paths[0]
+			}
+		}
+	}
+	return last
+}
+
+// LoadGlobalは利用者全体の設定を読み込む.
+func LoadGlobal() (*Config, error) {
+	c := New()
+	for _, path := range globalPaths() {
+		loaded, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		c.Merge(loaded)
+	}
+	return c, nil
+}
+
+// Mergeはotherの値をcの後ろに追加する. Getでは後から追加した値が優先される.
+func (c *Config) Merge(other *Config) {
+	for _, entry := range other.entries {
+		c.add(entry.Key, entry.Value)
+	}
+}
+
+// Parseはrから設定を読み込む.
+func Parse(r io.Reader) (*Config, error) {
+	c := New()
+	section := ""
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if line[0] == '[' {
+			end := strings.LastIndexByte(line, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("%w : line %d", ErrInvalidConfig, lineNumber)
+			}
+			name, err := parseSectionHeader(line[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("%w : line %d", err, lineNumber)
+			}
+			section = name
+			line = strings.TrimSpace(line[end+1:])
+			if line == "" || line[0] == '#' || line[0] == ';' {
+				continue
+			}
+		}
+		if section == "" {
+			return nil, fmt.Errorf("%w : line %d: key outside of section", ErrInvalidConfig, lineNumber)
+		}
+
+		key, value := line, "true"
+		if i := strings.IndexByte(line, '='); i >= 0 {
+			key = strings.TrimSpace(line[:i])
+			var err error
+			if value, err = parseValue(line[i+1:]); err != nil {
+				return nil, fmt.Errorf("%w : line %d", err, lineNumber)
+			}
+		}
+		c.add(section+"."+strings.ToLower(key), value)
+	}
+	return c, scanner.Err()
+}
+
+// parseSectionHeaderは`core`や`remote "origin"`を"core"や"remote.origin"の形式に変換する.
+// セクション名は大文字小文字を区別しないが、サブセクション名は区別する.
+func parseSectionHeader(header string) (string, error) {
+	header = strings.TrimSpace(header)
+	i := strings.IndexByte(header, '"')
+	if i < 0 {
+		// 古い形式の[section.subsection]
+		if dot := strings.IndexByte(header, '.'); dot >= 0 {
+			return strings.ToLower(header[:dot]) + header[dot:], nil
+		}
+		return strings.ToLower(header), nil
+	}
+	name := strings.ToLower(strings.TrimSpace(header[:i]))
+	subsection := header[i:]
+	if len(subsection) < 2 || subsection[len(subsection)-1] != '"' {
+		return "", ErrInvalidConfig
+	}
+	subsection = strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(subsection[1 : len(subsection)-1])
+	return name + "." + subsection, nil
+}
+
+// parseValueはクォートやエスケープ、行末のコメントを処理して値を返す.
+func parseValue(raw string) (string, error) {
+	var sb strings.Builder
+	quoted := false
+	raw = strings.TrimSpace(raw)
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == '\\' && i+1 < len(raw):
+			i++
+			switch raw[i] {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			default:
+				sb.WriteByte(raw[i])
+			}
+		case (c == '#' || c == ';') && !quoted:
+			return strings.TrimSpace(sb.String()), nil
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	if quoted {
+		return "", ErrInvalidConfig
+	}
+	return sb.String(), nil
+}
+
+// normalizeKeyは"core.fileMode"のようなキーのセクション名と変数名を小文字にする.
+func normalizeKey(key string) string {
+	first := strings.IndexByte(key, '.')
+	last := strings.LastIndexByte(key, '.')
+	if first < 0 {
+		return strings.ToLower(key)
+	}
+	return strings.ToLower(key[:first]) + key[first:last] + strings.ToLower(key[last:])
+}
+
+// Getはkeyの最後の値を返す.
+func (c *Config) Get(key string) (string, bool) {
+	values := c.values[normalizeKey(key)]
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[len(values)-1], true
+}
+
+// GetAllはkeyの全ての値を返す.
+func (c *Config) GetAll(key string) []string {
+	return c.values[normalizeKey(key)]
+}
+
+// Subsectionsはsectionのサブセクションの名前(remote.originなら"origin")を重複なく名前順に返す.
+func (c *Config) Subsections(section string) []string {
+	prefix := strings.ToLower(section) + "."
+	seen := map[string]bool{}
+	var names []string
+	for key := range c.values {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		rest := key[len(prefix):]
+		i := strings.LastIndexByte(rest, '.')
+		if i < 0 || seen[rest[:i]] {
+			continue
+		}
+		seen[rest[:i]] = true
+		names = append(names, rest[:i])
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetBoolはkeyの値を真偽値として返す. 値がなければdefaultValueを返す.
+func (c *Config) GetBool(key string, defaultValue bool) (bool, error) {
+	value, ok := c.Get(key)
+	if !ok {
+		return defaultValue, nil
+	}
+	return ParseBool(value)
+}
+
+// ParseBoolはgitの真偽値の表記(true/yes/on/1, false/no/off/0/空)を解釈する.
+func ParseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on":
+		return true, nil
+	case "false", "no", "off", "":
+		return false, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return false, fmt.Errorf("%w : bad boolean value %q", ErrInvalidConfig, value)
+	}
+	return n != 0, nil
+}
+
+// GitDirNameは作業ツリーの直下に置く管理ディレクトリの名前(fsegit.dirName)を返す.
+// ".fsegit"か".git"のどちらかで、設定がなければ空文字列を返す.
+func (c *Config) GitDirName() (string, error) {
+	name, ok := c.Get("fsegit.dirName")
+	if !ok || name == "" {
+		return "", nil
+	}
+	if name != ".fsegit" && name != ".git" {
+		return "", fmt.Errorf("%w : fsegit.dirName must be .fsegit or .git: %q", ErrInvalidConfig, name)
+	}
+	return name, nil
+}
+
+// DefaultBranchNameは新しいリポジトリで最初に使うブランチ名(init.defaultBranch)を返す.
+func (c *Config) DefaultBranchName() string {
+	if name, ok := c.Get("init.defaultBranch"); ok && name != "" {
+		return name
+	}
+	return "main"
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// システム全体、利用者全体の順に設定が重なり、GIT_CONFIG_NOSYSTEMでシステム全体の設定を読まないか
+func TestLoadDefaults(t *testing.T) {
+	dir := t.TempDir()
+	system := filepath.Join(dir, "system")
+	global := filepath.Join(dir, "global")
+	if err := ioutil.WriteFile(system, []byte("[user]\n\tname = system\n\temail = s@example.com\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(global, []byte("[user]\n\tname = global\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range map[string]string{"GIT_CONFIG_SYSTEM": system, "GIT_CONFIG_GLOBAL": global, "GIT_CONFIG_NOSYSTEM": ""} {
+		old, ok := os.LookupEnv(name)
+		os.Setenv(name, value)
+		defer func(name, old string, ok bool) {
+			if ok {
+				os.Setenv(name, old)
+			} else {
+				os.Unsetenv(name)
+			}
+		}(name, old, ok)
+	}
+
+	c, err := LoadDefaults()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, _ := c.Get("user.name"); name != "global" {
+		t.Errorf("user.name = %q, want global", name)
+	}
+	if email, _ := c.Get("user.email"); email != "s@example.com" {
+		t.Errorf("user.email = %q, want s@example.com", email)
+	}
+	want := []Entry{{"user.name", "system"}, {"user.email", "s@example.com"}, {"user.name", "global"}}
+	entries := c.Entries()
+	if len(entries) != len(want) {
+		t.Fatalf("Entries() = %v, want %v", entries, want)
+	}
+	for i := range want {
+		if entries[i] != want[i] {
+			t.Errorf("Entries()[%d] = %v, want %v", i, entries[i], want[i])
+		}
+	}
+
+	os.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	if c, err = LoadDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get("user.email"); ok {
+		t.Error("system config is read with GIT_CONFIG_NOSYSTEM")
+	}
+}
@@ -0,0 +1,270 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/kanon1343/fsegit/util"
+)
+
+// Documentは書き換えるために読み込んだ設定ファイル. 変更しない行はコメントや空白も含めてそのまま残す.
+type Document struct {
+	lines []docLine
+}
+
+// docLineは設定ファイルの1行.
+type docLine struct {
+	raw string
+	// sectionはこの行が属するセクションを"core"や"remote.origin"の形式で表したもの.
+	section string
+	// headerはセクションの見出しの行であることを表す.
+	header bool
+	// nameは変数の行の小文字にした変数名. 変数の行でなければ空.
+	name string
+}
+
+// ParseDocumentはdataを書き換えられる形で読み込む.
+func ParseDocument(data []byte) (*Document, error) {
+	d := &Document{}
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		raw := scanner.Text()
+		line := strings.TrimSpace(raw)
+		l := docLine{raw: raw, section: section}
+		if line != "" && line[0] == '[' {
+			end := strings.LastIndexByte(line, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("%w : line %d", ErrInvalidConfig, lineNumber)
+			}
+			name, err := parseSectionHeader(line[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("%w : line %d", err, lineNumber)
+			}
+			section = name
+			l.section, l.header = name, true
+			line = strings.TrimSpace(line[end+1:])
+		}
+		if line != "" && line[0] != '#' && line[0] != ';' {
+			if section == "" {
+				return nil, fmt.Errorf("%w : line %d: key outside of section", ErrInvalidConfig, lineNumber)
+			}
+			key := line
+			if i := strings.IndexByte(line, '='); i >= 0 {
+				key = line[:i]
+			}
+			l.name = strings.ToLower(strings.TrimSpace(key))
+		}
+		d.lines = append(d.lines, l)
+	}
+	return d, scanner.Err()
+}
+
+// Bytesは設定ファイルの内容を返す.
+func (d *Document) Bytes() []byte {
+	var buf bytes.Buffer
+	for _, l := range d.lines {
+		buf.WriteString(l.raw)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// CheckKeyはkeyがセクション名と変数名を持つかを調べる.
+func CheckKey(key string) error {
+	_, _, err := splitKey(key)
+	return err
+}
+
+// splitKeyは"remote.origin.url"を"remote.origin"と"url"に分ける.
+func splitKey(key string) (section, name string, err error) {
+	key = normalizeKey(key)
+	i := strings.LastIndexByte(key, '.')
+	if i <= 0 || i == len(key)-1 {
+		return "", "", fmt.Errorf("%w : key does not contain a section: %s", ErrInvalidConfig, key)
+	}
+	return key[:i], key[i+1:], nil
+}
+
+// Countはkeyの値の数を返す.
+func (d *Document) Count(key string) int {
+	section, name, err := splitKey(key)
+	if err != nil {
+		return 0
+	}
+	n := 0
+	for _, l := range d.lines {
+		if l.section == section && l.name == name {
+			n++
+		}
+	}
+	return n
+}
+
+// Setはkeyの値をvalueにする. keyが複数あれば最後のものを書き換え、なければセクションの末尾に追加する.
+func (d *Document) Set(key, value string) error {
+	section, name, err := splitKey(key)
+	if err != nil {
+		return err
+	}
+	for i := len(d.lines) - 1; i >= 0; i-- {
+		if d.lines[i].section == section && d.lines[i].name == name {
+			d.lines[i].raw = formatVariable(key, value)
+			// 見出しと同じ行に書かれた変数は、見出しを残して次の行に移す.
+			if d.lines[i].header {
+				d.lines[i].name = ""
+				d.lines[i].raw = formatSectionHeader(section)
+				d.insert(i+1, docLine{raw: formatVariable(key, value), section: section, name: name})
+			}
+			return nil
+		}
+	}
+	return d.Add(key, value)
+}
+
+// Addはkeyにvalueを追加する. 既にある値は残す.
+func (d *Document) Add(key, value string) error {
+	section, name, err := splitKey(key)
+	if err != nil {
+		return err
+	}
+	l := docLine{raw: formatVariable(key, value), section: section, name: name}
+	last := -1
+	for i, dl := range d.lines {
+		if dl.section == section {
+			last = i
+		}
+	}
+	if last < 0 {
+		d.lines = append(d.lines, docLine{raw: formatSectionHeader(section), section: section, header: true}, l)
+		return nil
+	}
+	// セクションの後ろの空行やコメントの前に入れる.
+	for last > 0 && d.lines[last].name == "" && !d.lines[last].header {
+		last--
+	}
+	d.insert(last+1, l)
+	return nil
+}
+
+func (d *Document) insert(i int, l docLine) {
+	d.lines = append(d.lines, docLine{})
+	copy(d.lines[i+1:], d.lines[i:])
+	d.lines[i] = l
+}
+
+// Unsetはkeyの全ての値を取り除き、取り除いた数を返す.
+func (d *Document) Unset(key string) (int, error) {
+	section, name, err := splitKey(key)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	lines := d.lines[:0]
+	for _, l := range d.lines {
+		if l.section == section && l.name == name {
+			removed++
+			if !l.header {
+				continue
+			}
+			l.raw, l.name = formatSectionHeader(section), ""
+		}
+		lines = append(lines, l)
+	}
+	d.lines = lines
+	return removed, nil
+}
+
+// RemoveSectionはsection("remote.origin"など)を全て取り除く. 見つからなければfalseを返す.
+func (d *Document) RemoveSection(section string) bool {
+	section = normalizeSection(section)
+	found := false
+	lines := d.lines[:0]
+	for _, l := range d.lines {
+		if l.section == section {
+			found = true
+			continue
+		}
+		lines = append(lines, l)
+	}
+	d.lines = lines
+	return found
+}
+
+// RenameSectionはoldNameのセクションの見出しをnewNameに書き換える. 見つからなければfalseを返す.
+func (d *Document) RenameSection(oldName, newName string) bool {
+	oldName, newName = normalizeSection(oldName), normalizeSection(newName)
+	found := false
+	for i, l := range d.lines {
+		if l.section != oldName {
+			continue
+		}
+		found = true
+		d.lines[i].section = newName
+		if l.header {
+			rest := ""
+			if l.name != "" {
+				// 見出しと同じ行の変数は残す.
+				line := strings.TrimSpace(l.raw)
+				rest = " " + strings.TrimSpace(line[strings.LastIndexByte(line, ']')+1:])
+			}
+			d.lines[i].raw = formatSectionHeader(newName) + rest
+		}
+	}
+	return found
+}
+
+// normalizeSectionはセクション名を小文字にする. サブセクション名はそのまま残す.
+func normalizeSection(section string) string {
+	if i := strings.IndexByte(section, '.'); i >= 0 {
+		return strings.ToLower(section[:i]) + section[i:]
+	}
+	return strings.ToLower(section)
+}
+
+// formatSectionHeaderは"remote.origin"を`[remote "origin"]`の形式にする.
+func formatSectionHeader(section string) string {
+	i := strings.IndexByte(section, '.')
+	if i < 0 {
+		return "[" + section + "]"
+	}
+	subsection := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(section[i+1:])
+	return fmt.Sprintf("[%s \"%s\"]", section[:i], subsection)
+}
+
+// formatVariableはkeyの変数の行を作る. 変数名は指定された大文字小文字のまま書く.
+func formatVariable(key, value string) string {
+	return "\t" + key[strings.LastIndexByte(key, '.')+1:] + " = " + QuoteValue(value)
+}
+
+// QuoteValueはコメントや空白として読まれてしまう文字を含む値をクォートする.
+func QuoteValue(value string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`).Replace(value)
+	if escaped != value || strings.ContainsAny(value, "#; ") || strings.TrimSpace(value) != value {
+		return `"` + escaped + `"`
+	}
+	return value
+}
+
+// UpdateFileはpathの設定ファイルを読み込んでeditで書き換え、アトミックに書き戻す.
+// ファイルがなければ空の設定として扱い、editがエラーを返せば何も書かない.
+func UpdateFile(path string, edit func(d *Document) error) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	d, err := ParseDocument(data)
+	if err != nil {
+		return err
+	}
+	if err := edit(d); err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(path, d.Bytes(), 0644)
+}
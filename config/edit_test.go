@@ -0,0 +1,69 @@
+package config
+
+import (
+	"bytes"
+	"testing"
+)
+
+// 書き換えていない行をそのまま残して、値の設定と削除、セクションの削除と名前の変更ができるか
+func TestDocument(t *testing.T) {
+	d, err := ParseDocument([]byte(`# comment
+[core]
+	bare = false
+[remote "origin"]
+	url = https://example.com/a.git
+	fetch = +refs/heads/*:refs/remotes/origin/*
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Set("core.bare", "true"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Add("core.editor", "my editor"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Add("remote.origin.fetch", "+refs/tags/*:refs/tags/*"); err != nil {
+		t.Fatal(err)
+	}
+	if !d.RenameSection("remote.origin", "remote.upstream") {
+		t.Error("RenameSection() = false")
+	}
+	if err := d.Set("branch.main.remote", "upstream"); err != nil {
+		t.Fatal(err)
+	}
+	want := `# comment
+[core]
+	bare = true
+	editor = "my editor"
+[remote "upstream"]
+	url = https://example.com/a.git
+	fetch = +refs/heads/*:refs/remotes/origin/*
+	fetch = +refs/tags/*:refs/tags/*
+[branch "main"]
+	remote = upstream
+`
+	if got := string(d.Bytes()); got != want {
+		t.Errorf("Bytes() = %q, want %q", got, want)
+	}
+
+	if n, err := d.Unset("remote.upstream.fetch"); err != nil || n != 2 {
+		t.Errorf("Unset() = %d, %v, want 2", n, err)
+	}
+	if !d.RemoveSection("branch.main") || d.RemoveSection("branch.main") {
+		t.Error("RemoveSection() should succeed only once")
+	}
+	cfg, err := Parse(bytes.NewReader(d.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.GetAll("remote.upstream.fetch"); len(got) != 0 {
+		t.Errorf("fetch = %q after Unset", got)
+	}
+	if got, _ := cfg.Get("core.editor"); got != "my editor" {
+		t.Errorf("core.editor = %q", got)
+	}
+	if _, ok := cfg.Get("branch.main.remote"); ok {
+		t.Error("branch.main.remote remains after RemoveSection")
+	}
+}
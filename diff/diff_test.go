@@ -0,0 +1,274 @@
+package diff
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+)
+
+// 編集から元の2つの入力が復元でき、編集の数が最短になっているか
+func TestLines(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	random := func() []string {
+		lines := make([]string, r.Intn(30))
+		for i := range lines {
+			lines[i] = string(rune('a' + r.Intn(4)))
+		}
+		return lines
+	}
+	for i := 0; i < 500; i++ {
+		a, b := random(), random()
+		edits := Lines(a, b)
+
+		var gotA, gotB []string
+		changes := 0
+		for _, edit := range edits {
+			if edit.Op != Insert {
+				gotA = append(gotA, edit.Text)
+			}
+			if edit.Op != Delete {
+				gotB = append(gotB, edit.Text)
+			}
+			if edit.Op != Equal {
+				changes++
+			}
+		}
+		if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") {
+			t.Fatalf("Lines(%q, %q) = %v does not reproduce the inputs", a, b, edits)
+		}
+		if want := len(a) + len(b) - 2*lcs(a, b); changes != want {
+			t.Fatalf("Lines(%q, %q) has %d changes, want %d", a, b, changes, want)
+		}
+	}
+}
+
+// lcsは最長共通部分列の長さを動的計画法で求める.
+func lcs(a, b []string) int {
+	table := make([][]int, len(a)+1)
+	for i := range table {
+		table[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				table[i][j] = table[i+1][j+1] + 1
+			case table[i+1][j] > table[i][j+1]:
+				table[i][j] = table[i+1][j]
+			default:
+				table[i][j] = table[i][j+1]
+			}
+		}
+	}
+	return table[0][0]
+}
+
+// git diffと同じ形式で書き出されるか
+func TestWriteUnified(t *testing.T) {
+	old := []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n")
+	new := []byte("1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\nthirteen")
+	f := File{
+		OldPath: "a.txt",
+		NewPath: "a.txt",
+		OldMode: object.ModeBlob,
+		NewMode: object.ModeBlob,
+		OldHash: sha.SHA1(bytes.Repeat([]byte{0x11}, 20)),
+		NewHash: sha.SHA1(bytes.Repeat([]byte{0x22}, 20)),
+		Old:     old,
+		New:     new,
+	}
+	var buf bytes.Buffer
+	if err := WriteUnified(&buf, f, Options{Context: DefaultContext}); err != nil {
+		t.Fatal(err)
+	}
+	want := `diff --git a/a.txt b/a.txt
+index 1111111..2222222 100644
+--- a/a.txt
++++ b/a.txt
+@@ -1,6 +1,6 @@
+ 1
+ 2
+-3
++three
+ 4
+ 5
+ 6
+@@ -10,3 +10,4 @@
+ 10
+ 11
+ 12
++thirteen
+\ No newline at end of file
+`
+	if buf.String() != want {
+		t.Errorf("WriteUnified() =\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	f.OldMode, f.OldHash, f.Old = 0, nil, nil
+	buf.Reset()
+	if err := WriteUnified(&buf, f, Options{Context: 0}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "new file mode 100644\nindex 0000000..2222222\n--- /dev/null\n+++ b/a.txt\n@@ -0,0 +1,13 @@\n") {
+		t.Errorf("WriteUnified() for a new file =\n%s", buf.String())
+	}
+}
+
+func TestWriteUnified_WordDiff(t *testing.T) {
+	f := File{
+		OldPath: "a.txt",
+		NewPath: "a.txt",
+		OldMode: object.ModeBlob,
+		NewMode: object.ModeBlob,
+		OldHash: sha.SHA1(bytes.Repeat([]byte{0x11}, 20)),
+		NewHash: sha.SHA1(bytes.Repeat([]byte{0x22}, 20)),
+		Old:     []byte("alpha beta gamma\nline two\nkeep\n"),
+		New:     []byte("alpha BETA gamma\nline\nkeep\nnew line\n"),
+	}
+	var buf bytes.Buffer
+	if err := WriteUnified(&buf, f, Options{Context: DefaultContext, WordDiff: WordDiffPlain}); err != nil {
+		t.Fatal(err)
+	}
+	want := "@@ -1,3 +1,4 @@\nalpha [-beta-]{+BETA+} gamma\nline[-two-]\nkeep\n{+new line+}\n"
+	if !strings.HasSuffix(buf.String(), want) {
+		t.Errorf("WriteUnified(WordDiffPlain) =\n%s\nwant suffix\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := WriteUnified(&buf, f, Options{Context: 0, Color: true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"\x1b[1mdiff --git a/a.txt b/a.txt\x1b[m\n", "\x1b[36m@@ -1,2 +1,2 @@\x1b[m\n", "\x1b[31m-line two\x1b[m\n", "\x1b[32m+new line\x1b[m\n"} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("WriteUnified(Color) =\n%q\nwant %q", buf.String(), line)
+		}
+	}
+}
+
+func TestWriteStat(t *testing.T) {
+	stats := []FileStat{
+		NewFileStat(File{OldPath: "a.txt", NewPath: "a.txt", Old: []byte("1\n2\n3\n"), New: []byte("1\ntwo\n3\n4\n")}),
+		NewFileStat(File{OldPath: "gone.txt", Old: []byte("x\n")}),
+		NewFileStat(File{OldPath: "bin", NewPath: "bin", New: []byte("\x00")}),
+		NewFileStat(File{OldPath: "src/x.txt", NewPath: "lib/x.txt", OldMode: object.ModeBlob, NewMode: object.ModeBlob}),
+	}
+	var buf bytes.Buffer
+	if err := WriteStat(&buf, stats); err != nil {
+		t.Fatal(err)
+	}
+	want := ` a.txt              |   3 ++-
+ gone.txt           |   1 -
+ bin                | Bin
+ {src => lib}/x.txt |   0
+ 4 files changed, 2 insertions(+), 2 deletions(-)
+`
+	if buf.String() != want {
+		t.Errorf("WriteStat() =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestWriteNumStat(t *testing.T) {
+	stats := []FileStat{
+		NewFileStat(File{OldPath: "a.txt", NewPath: "a.txt", Old: []byte("1\n2\n3\n"), New: []byte("1\ntwo\n3\n4\n")}),
+		NewFileStat(File{OldPath: "bin", NewPath: "bin", New: []byte("\x00")}),
+		NewFileStat(File{OldPath: "src/x.txt", NewPath: "lib/x.txt", OldMode: object.ModeBlob, NewMode: object.ModeBlob}),
+	}
+	var buf bytes.Buffer
+	if err := WriteNumStat(&buf, stats); err != nil {
+		t.Fatal(err)
+	}
+	want := "2\t1\ta.txt\n-\t-\tbin\n0\t0\t{src => lib}/x.txt\n"
+	if buf.String() != want {
+		t.Errorf("WriteNumStat() = %q, want %q", buf.String(), want)
+	}
+}
+
+// 離れた変更は両方取り込み、同じ箇所の異なる変更はコンフリクトの印で囲むか
+func TestMerge3(t *testing.T) {
+	labels := MergeLabels{Ours: "HEAD", Theirs: "topic"}
+	tests := []struct {
+		name               string
+		base, ours, theirs string
+		want               string
+		clean              bool
+	}{
+		{"separate", "1\n2\n3\n4\n5\n", "one\n2\n3\n4\n5\n", "1\n2\n3\n4\nfive\n", "one\n2\n3\n4\nfive\n", true},
+		{"same change", "1\n2\n3\n", "1\ntwo\n3\n", "1\ntwo\n3\n", "1\ntwo\n3\n", true},
+		{"one side", "1\n2\n3\n", "1\n2\n3\n", "1\n3\n", "1\n3\n", true},
+		{"conflict", "1\n2\n3\n", "1\nours\n3\n", "1\ntheirs\n3\n", "1\n<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> topic\n3\n", false},
+		{"add/add", "", "a\n", "b", "<<<<<<< HEAD\na\n=======\nb\n>>>>>>> topic\n", false},
+	}
+	for _, tt := range tests {
+		merged, clean := Merge3([]byte(tt.base), []byte(tt.ours), []byte(tt.theirs), labels)
+		if string(merged) != tt.want || clean != tt.clean {
+			t.Errorf("%s: Merge3() = %q, %v, want %q, %v", tt.name, merged, clean, tt.want, tt.clean)
+		}
+	}
+}
+
+// WriteUnifiedで書いた差分を読んで元の内容に適用でき、行がずれていても適用できるか
+func TestParsePatch_Apply(t *testing.T) {
+	old := []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n")
+	new := []byte("1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\nthirteen")
+	var buf bytes.Buffer
+	f := File{OldPath: "a.txt", NewPath: "a.txt", OldMode: object.ModeBlob, NewMode: object.ModeBlob, Old: old, New: new,
+		OldHash: sha.SHA1(bytes.Repeat([]byte{0x11}, 20)), NewHash: sha.SHA1(bytes.Repeat([]byte{0x22}, 20))}
+	if err := WriteUnified(&buf, f, Options{Context: DefaultContext}); err != nil {
+		t.Fatal(err)
+	}
+	patches, err := ParsePatch(append([]byte("Subject: message\n\n"), buf.Bytes()...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(patches) != 1 || patches[0].OldPath != "a.txt" || patches[0].NewPath != "a.txt" || len(patches[0].Hunks) != 2 {
+		t.Fatalf("ParsePatch() = %+v", patches)
+	}
+	if got, err := patches[0].Apply(old); err != nil || string(got) != string(new) {
+		t.Errorf("Apply() = %q, %v, want %q", got, err, new)
+	}
+	shifted := append([]byte("0\n"), old...)
+	if got, err := patches[0].Apply(shifted); err != nil || string(got) != "0\n"+string(new) {
+		t.Errorf("Apply(shifted) = %q, %v", got, err)
+	}
+	if _, err := patches[0].Apply([]byte("1\n2\n4\n")); !errors.Is(err, ErrPatchFailed) {
+		t.Errorf("Apply(other) = %v, want ErrPatchFailed", err)
+	}
+
+	patches, err = ParsePatch([]byte(`diff --git a/old name b/new name
+similarity index 90%
+rename from old name
+rename to new name
+diff --git a/run b/run
+old mode 100644
+new mode 100755
+diff --git a/gone b/gone
+deleted file mode 100644
+index 1111111..0000000
+--- a/gone
++++ /dev/null
+@@ -1 +0,0 @@
+-bye
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(patches) != 3 {
+		t.Fatalf("ParsePatch() = %d patches, want 3", len(patches))
+	}
+	if p := patches[0]; !p.IsRename() || p.OldPath != "old name" || p.NewPath != "new name" {
+		t.Errorf("rename = %+v", p)
+	}
+	if p := patches[1]; p.OldMode != object.ModeBlob || p.NewMode != object.ModeExecutable || len(p.Hunks) != 0 {
+		t.Errorf("mode change = %+v", p)
+	}
+	if p := patches[2]; !p.IsDelete() || p.OldPath != "gone" {
+		t.Errorf("delete = %+v", p)
+	} else if got, err := p.Apply([]byte("bye\n")); err != nil || len(got) != 0 {
+		t.Errorf("Apply(delete) = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,149 @@
+package diff
+
+import (
+	"strings"
+)
+
+// ConflictMarkerSizeはコンフリクトの印("<<<<<<<"など)の長さ. gitと同じ.
+const ConflictMarkerSize = 7
+
+// MergeLabelsはコンフリクトの印の後ろに書く、それぞれの側の名前.
+type MergeLabels struct {
+	Ours, Theirs string
+}
+
+// regionは共通の祖先の[start, end)の行を、片方の側でlinesに置き換えた変更.
+type region struct {
+	start, end int
+	lines      []string
+}
+
+// changedRegionsはbaseからotherへの編集を、baseの行の範囲ごとの変更にまとめる.
+func changedRegions(base, other []string) []region {
+	var regions []region
+	i := 0
+	var current *region
+	for _, edit := range Lines(base, other) {
+		if edit.Op == Equal {
+			if current != nil {
+				regions = append(regions, *current)
+				current = nil
+			}
+			i++
+			continue
+		}
+		if current == nil {
+			current = &region{start: i, end: i}
+		}
+		if edit.Op == Delete {
+			i++
+			current.end = i
+		} else {
+			current.lines = append(current.lines, edit.Text)
+		}
+	}
+	if current != nil {
+		regions = append(regions, *current)
+	}
+	return regions
+}
+
+// applyRegionsはbaseの[start, end)にregionsの変更を当てた行を返す.
+func applyRegions(base []string, start, end int, regions []region) []string {
+	var lines []string
+	for _, r := range regions {
+		lines = append(lines, base[start:r.start]...)
+		lines = append(lines, r.lines...)
+		start = r.end
+	}
+	return append(lines, base[start:end]...)
+}
+
+// Merge3は共通の祖先baseからoursとtheirsへの変更を行単位で合わせる.
+// 両方の側が同じ箇所(接している箇所を含む)を異なる内容に変えていれば、その箇所をgitと同じ
+// コンフリクトの印で囲み、cleanをfalseにする. 両方の側が同じ変更をしていればコンフリクトにしない.
+func Merge3(base, ours, theirs []byte, labels MergeLabels) (merged []byte, clean bool) {
+	baseLines := SplitLines(base)
+	oursRegions := changedRegions(baseLines, SplitLines(ours))
+	theirsRegions := changedRegions(baseLines, SplitLines(theirs))
+
+	var out strings.Builder
+	clean = true
+	pos, i, j := 0, 0, 0
+	for i < len(oursRegions) || j < len(theirsRegions) {
+		// 先に始まる変更から、重なるか接する変更を両方の側から集める.
+		var start int
+		switch {
+		case j == len(theirsRegions) || (i < len(oursRegions) && oursRegions[i].start <= theirsRegions[j].start):
+			start = oursRegions[i].start
+		default:
+			start = theirsRegions[j].start
+		}
+		end := start
+		oursFrom, theirsFrom := i, j
+		for {
+			if i < len(oursRegions) && oursRegions[i].start <= end {
+				if oursRegions[i].end > end {
+					end = oursRegions[i].end
+				}
+				i++
+				continue
+			}
+			if j < len(theirsRegions) && theirsRegions[j].start <= end {
+				if theirsRegions[j].end > end {
+					end = theirsRegions[j].end
+				}
+				j++
+				continue
+			}
+			break
+		}
+
+		writeLines(&out, baseLines[pos:start])
+		oursLines := applyRegions(baseLines, start, end, oursRegions[oursFrom:i])
+		theirsLines := applyRegions(baseLines, start, end, theirsRegions[theirsFrom:j])
+		switch {
+		case theirsFrom == j:
+			writeLines(&out, oursLines)
+		case oursFrom == i:
+			writeLines(&out, theirsLines)
+		case strings.Join(oursLines, "") == strings.Join(theirsLines, ""):
+			writeLines(&out, oursLines)
+		default:
+			clean = false
+			writeConflict(&out, oursLines, theirsLines, labels)
+		}
+		pos = end
+	}
+	writeLines(&out, baseLines[pos:])
+	return []byte(out.String()), clean
+}
+
+func writeLines(out *strings.Builder, lines []string) {
+	for _, line := range lines {
+		out.WriteString(line)
+	}
+}
+
+// writeConflictは両方の側の行をコンフリクトの印で囲んで書き出す. 印が行の途中に来ないように、
+// 改行で終わらない側の最後の行には改行を補う.
+func writeConflict(out *strings.Builder, ours, theirs []string, labels MergeLabels) {
+	marker := func(c byte, label string) {
+		out.WriteString(strings.Repeat(string(c), ConflictMarkerSize))
+		if label != "" {
+			out.WriteString(" " + label)
+		}
+		out.WriteString("\n")
+	}
+	side := func(lines []string) {
+		writeLines(out, lines)
+		if len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+			out.WriteString("\n")
+		}
+	}
+	marker('<', labels.Ours)
+	side(ours)
+	marker('=', "")
+	side(theirs)
+	marker('>', labels.Theirs)
+}
@@ -0,0 +1,173 @@
+// Package diffは行単位の差分を計算し、unified形式で書き出す.
+package diff
+
+// Opは差分の1行の種類.
+type Op int
+
+const (
+	Equal Op = iota
+	Delete
+	Insert
+)
+
+// Editは差分の1行. Deleteは変更前の行、InsertとEqualは変更後の行のテキストを持つ.
+type Edit struct {
+	Op   Op
+	Text string
+}
+
+// Linesはaをbに変える最短の編集をMyersのアルゴリズムで求める.
+// 変更箇所の中では削除が挿入より先に並ぶ.
+func Lines(a, b []string) []Edit {
+	d := &differ{
+		a:       a,
+		b:       b,
+		deleted: make([]bool, len(a)),
+		added:   make([]bool, len(b)),
+	}
+	d.compare(0, len(a), 0, len(b))
+
+	edits := make([]Edit, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && d.deleted[i]:
+			edits = append(edits, Edit{Delete, a[i]})
+			i++
+		case j < len(b) && d.added[j]:
+			edits = append(edits, Edit{Insert, b[j]})
+			j++
+		default:
+			edits = append(edits, Edit{Equal, b[j]})
+			i++
+			j++
+		}
+	}
+	return edits
+}
+
+// differは比較の途中経過を持つ. deletedとaddedは最短の編集で削除、追加される行の印.
+type differ struct {
+	a, b    []string
+	deleted []bool
+	added   []bool
+}
+
+// compareはa[aLo:aHi]とb[bLo:bHi]の差分を求めて印を付ける.
+// 中央のスネークで分割して再帰するので、必要なメモリは入力の長さに比例する.
+func (d *differ) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		aLo++
+		bLo++
+	}
+	for aLo < aHi && bLo < bHi && d.a[aHi-1] == d.b[bHi-1] {
+		aHi--
+		bHi--
+	}
+	if aLo == aHi || bLo == bHi {
+		for i := aLo; i < aHi; i++ {
+			d.deleted[i] = true
+		}
+		for j := bLo; j < bHi; j++ {
+			d.added[j] = true
+		}
+		return
+	}
+
+	x, y, ok := d.bisect(aLo, aHi, bLo, bHi)
+	if !ok {
+		for i := aLo; i < aHi; i++ {
+			d.deleted[i] = true
+		}
+		for j := bLo; j < bHi; j++ {
+			d.added[j] = true
+		}
+		return
+	}
+	d.compare(aLo, x, bLo, y)
+	d.compare(x, aHi, y, bHi)
+}
+
+// bisectは前後から同時に最短経路を伸ばし、両者が重なった点を分割点として返す.
+func (d *differ) bisect(aLo, aHi, bLo, bHi int) (int, int, bool) {
+	n, m := aHi-aLo, bHi-bLo
+	maxD := (n + m + 1) / 2
+	offset := maxD
+	length := 2*maxD + 2
+	forward := make([]int, length)
+	backward := make([]int, length)
+	for i := range forward {
+		forward[i] = -1
+		backward[i] = -1
+	}
+	forward[offset+1] = 0
+	backward[offset+1] = 0
+	delta := n - m
+	// 差分の行数が奇数なら前向きの探索で、偶数なら後ろ向きの探索で重なりを見つける.
+	front := delta%2 != 0
+
+	// 範囲の外に出た対角線は以降の探索から外す.
+	k1Start, k1End, k2Start, k2End := 0, 0, 0, 0
+	for step := 0; step < maxD; step++ {
+		for k1 := -step + k1Start; k1 <= step-k1End; k1 += 2 {
+			k1Offset := offset + k1
+			var x1 int
+			if k1 == -step || (k1 != step && forward[k1Offset-1] < forward[k1Offset+1]) {
+				x1 = forward[k1Offset+1]
+			} else {
+				x1 = forward[k1Offset-1] + 1
+			}
+			y1 := x1 - k1
+			for x1 < n && y1 < m && d.a[aLo+x1] == d.b[bLo+y1] {
+				x1++
+				y1++
+			}
+			forward[k1Offset] = x1
+			switch {
+			case x1 > n:
+				k1End += 2
+			case y1 > m:
+				k1Start += 2
+			case front:
+				k2Offset := offset + delta - k1
+				if k2Offset >= 0 && k2Offset < length && backward[k2Offset] != -1 {
+					if x1 >= n-backward[k2Offset] {
+						return aLo + x1, bLo + y1, true
+					}
+				}
+			}
+		}
+
+		for k2 := -step + k2Start; k2 <= step-k2End; k2 += 2 {
+			k2Offset := offset + k2
+			var x2 int
+			if k2 == -step || (k2 != step && backward[k2Offset-1] < backward[k2Offset+1]) {
+				x2 = backward[k2Offset+1]
+			} else {
+				x2 = backward[k2Offset-1] + 1
+			}
+			y2 := x2 - k2
+			for x2 < n && y2 < m && d.a[aHi-1-x2] == d.b[bHi-1-y2] {
+				x2++
+				y2++
+			}
+			backward[k2Offset] = x2
+			switch {
+			case x2 > n:
+				k2End += 2
+			case y2 > m:
+				k2Start += 2
+			case !front:
+				k1Offset := offset + delta - k2
+				if k1Offset >= 0 && k1Offset < length && forward[k1Offset] != -1 {
+					x1 := forward[k1Offset]
+					y1 := offset + x1 - k1Offset
+					if x1 >= n-x2 {
+						return aLo + x1, bLo + y1, true
+					}
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
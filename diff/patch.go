@@ -0,0 +1,309 @@
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kanon1343/fsegit/object"
+)
+
+var (
+	ErrInvalidPatch = errors.New("invalid patch")
+	ErrPatchFailed  = errors.New("patch does not apply")
+)
+
+// FilePatchはパッチの中の1つのファイルへの変更. 追加ではOldPathが、削除ではNewPathが空になる.
+// モードはパッチに書かれていなければ0になる.
+type FilePatch struct {
+	OldPath, NewPath string
+	OldMode, NewMode object.FileMode
+	// CopyならOldPathを残したまま、その内容からNewPathを作る.
+	Copy bool
+	// Binaryは"Binary files ... differ"などの、内容を含まないバイナリの変更.
+	Binary bool
+	Hunks  []Hunk
+}
+
+// IsNewはファイルを追加する変更かを返す.
+func (p *FilePatch) IsNew() bool {
+	return p.OldPath == ""
+}
+
+// IsDeleteはファイルを削除する変更かを返す.
+func (p *FilePatch) IsDelete() bool {
+	return p.NewPath == ""
+}
+
+// IsRenameはファイルの名前を変える変更かを返す.
+func (p *FilePatch) IsRename() bool {
+	return !p.Copy && !p.IsNew() && !p.IsDelete() && p.OldPath != p.NewPath
+}
+
+// ParsePatchはunified形式の差分を読む. "diff --git"で始まるgitの形式では、追加、削除、名前の変更、
+// コピー、モードの変更の行も読む. "--- a/file"と"+++ b/file"だけの差分も読め、パスの最初の要素は取り除く.
+// 差分の前後やファイルの間にある、差分でない行(コミットメッセージなど)は無視する.
+func ParsePatch(data []byte) ([]*FilePatch, error) {
+	var patches []*FilePatch
+	var current *FilePatch
+	// inHeaderは"diff --git"の行からhunkまでの間にいるかどうか.
+	inHeader := false
+	lines := SplitLines(data)
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSuffix(lines[i], "\n")
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			oldPath, newPath := parseGitDiffHeader(line[len("diff --git "):])
+			current = &FilePatch{OldPath: oldPath, NewPath: newPath}
+			patches = append(patches, current)
+			inHeader = true
+
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			oldPath := patchPath(line[len("--- "):])
+			newPath := patchPath(strings.TrimSuffix(lines[i+1], "\n")[len("+++ "):])
+			i++
+			if !inHeader {
+				current = &FilePatch{OldPath: oldPath, NewPath: newPath}
+				patches = append(patches, current)
+				inHeader = true
+				continue
+			}
+			if oldPath == "" {
+				current.OldPath = ""
+			}
+			if newPath == "" {
+				current.NewPath = ""
+			}
+
+		case strings.HasPrefix(line, "@@ "):
+			if current == nil {
+				return nil, fmt.Errorf("%w : hunk without a file header", ErrInvalidPatch)
+			}
+			hunk, n, err := parseHunk(lines[i:])
+			if err != nil {
+				return nil, err
+			}
+			current.Hunks = append(current.Hunks, hunk)
+			i += n - 1
+			inHeader = false
+
+		case inHeader:
+			if err := parseExtendedHeader(current, line); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return patches, nil
+}
+
+// parseExtendedHeaderは"diff --git"の行と最初のhunkの間の行を読む. 知らない行は無視する.
+func parseExtendedHeader(p *FilePatch, line string) error {
+	var err error
+	switch {
+	case strings.HasPrefix(line, "old mode "):
+		p.OldMode, err = parsePatchMode(line[len("old mode "):])
+	case strings.HasPrefix(line, "new mode "):
+		p.NewMode, err = parsePatchMode(line[len("new mode "):])
+	case strings.HasPrefix(line, "deleted file mode "):
+		p.OldMode, err = parsePatchMode(line[len("deleted file mode "):])
+		p.NewPath = ""
+	case strings.HasPrefix(line, "new file mode "):
+		p.NewMode, err = parsePatchMode(line[len("new file mode "):])
+		p.OldPath = ""
+	case strings.HasPrefix(line, "rename from "):
+		p.OldPath = line[len("rename from "):]
+	case strings.HasPrefix(line, "rename to "):
+		p.NewPath = line[len("rename to "):]
+	case strings.HasPrefix(line, "copy from "):
+		p.OldPath, p.Copy = line[len("copy from "):], true
+	case strings.HasPrefix(line, "copy to "):
+		p.NewPath, p.Copy = line[len("copy to "):], true
+	case strings.HasPrefix(line, "index "):
+		// "index abc..def 100644"の最後はモードが変わらないときのモード.
+		if fields := strings.Fields(line); len(fields) == 3 {
+			var mode object.FileMode
+			if mode, err = parsePatchMode(fields[2]); err == nil {
+				p.OldMode, p.NewMode = mode, mode
+			}
+		}
+	case strings.HasPrefix(line, "Binary files "), line == "GIT binary patch":
+		p.Binary = true
+	}
+	return err
+}
+
+// parseGitDiffHeaderは"diff --git a/x b/x"の"a/x b/x"の部分から変更前と変更後のパスを取り出す.
+// パスに空白を含むこともあるので、名前を変えない変更では前後が同じパスになる区切りを探す.
+func parseGitDiffHeader(names string) (string, string) {
+	if strings.HasPrefix(names, "a/") && len(names)%2 == 1 {
+		half := (len(names) - 1) / 2
+		if names[half] == ' ' && strings.HasPrefix(names[half+1:], "b/") && names[2:half] == names[half+3:] {
+			return names[2:half], names[half+3:]
+		}
+	}
+	if i := strings.LastIndex(names, " b/"); i >= 0 {
+		return patchPath(names[:i]), patchPath(names[i+1:])
+	}
+	return "", ""
+}
+
+// patchPathは"---"と"+++"の行のパスから、最初の要素("a/"など)と後ろのタブ以降(日時など)を取り除く.
+// /dev/nullなら空を返す.
+func patchPath(name string) string {
+	if i := strings.IndexByte(name, '\t'); i >= 0 {
+		name = name[:i]
+	}
+	if name == "/dev/null" {
+		return ""
+	}
+	if i := strings.IndexByte(name, '/'); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+func parsePatchMode(s string) (object.FileMode, error) {
+	mode, err := strconv.ParseUint(strings.TrimSpace(s), 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%w : invalid mode %q", ErrInvalidPatch, s)
+	}
+	return object.FileMode(mode), nil
+}
+
+// parseHunkはlinesの先頭の"@@ -a,b +c,d @@"から始まるhunkを読み、読んだ行数とともに返す.
+func parseHunk(lines []string) (Hunk, int, error) {
+	header := strings.TrimSuffix(lines[0], "\n")
+	fields := strings.Fields(header)
+	if len(fields) < 4 || !strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") || fields[3] != "@@" {
+		return Hunk{}, 0, fmt.Errorf("%w : %s", ErrInvalidPatch, header)
+	}
+	var hunk Hunk
+	var err error
+	if hunk.OldStart, hunk.OldLines, err = parseHunkRange(fields[1][1:]); err != nil {
+		return Hunk{}, 0, fmt.Errorf("%w : %s", ErrInvalidPatch, header)
+	}
+	if hunk.NewStart, hunk.NewLines, err = parseHunkRange(fields[2][1:]); err != nil {
+		return Hunk{}, 0, fmt.Errorf("%w : %s", ErrInvalidPatch, header)
+	}
+
+	oldLeft, newLeft := hunk.OldLines, hunk.NewLines
+	n := 1
+	for ; n < len(lines) && (oldLeft > 0 || newLeft > 0); n++ {
+		line := lines[n]
+		var op Op
+		switch {
+		case line == "\n":
+			// 末尾の空白を取り除かれた、空行の文脈.
+			op, line = Equal, " \n"
+		case line[0] == ' ':
+			op = Equal
+		case line[0] == '-':
+			op = Delete
+		case line[0] == '+':
+			op = Insert
+		case line[0] == '\\':
+			// "\ No newline at end of file"は直前の行に改行がないことを表す.
+			if len(hunk.Edits) > 0 {
+				last := &hunk.Edits[len(hunk.Edits)-1]
+				last.Text = strings.TrimSuffix(last.Text, "\n")
+			}
+			continue
+		default:
+			return Hunk{}, 0, fmt.Errorf("%w : truncated hunk %s", ErrInvalidPatch, header)
+		}
+		if op != Insert {
+			oldLeft--
+		}
+		if op != Delete {
+			newLeft--
+		}
+		if oldLeft < 0 || newLeft < 0 {
+			return Hunk{}, 0, fmt.Errorf("%w : hunk %s has too many lines", ErrInvalidPatch, header)
+		}
+		hunk.Edits = append(hunk.Edits, Edit{Op: op, Text: line[1:]})
+	}
+	if oldLeft > 0 || newLeft > 0 {
+		return Hunk{}, 0, fmt.Errorf("%w : truncated hunk %s", ErrInvalidPatch, header)
+	}
+	// 最後の行の直後の"\ No newline at end of file"も読む.
+	if n < len(lines) && strings.HasPrefix(lines[n], "\\") && len(hunk.Edits) > 0 {
+		last := &hunk.Edits[len(hunk.Edits)-1]
+		last.Text = strings.TrimSuffix(last.Text, "\n")
+		n++
+	}
+	return hunk, n, nil
+}
+
+// parseHunkRangeは"1,3"や"1"の形式の範囲を読む. 行数が0なら、開始行を直前の行から次の行に直す.
+func parseHunkRange(s string) (start, lines int, err error) {
+	lines = 1
+	if i := strings.IndexByte(s, ','); i >= 0 {
+		if lines, err = strconv.Atoi(s[i+1:]); err != nil {
+			return 0, 0, err
+		}
+		s = s[:i]
+	}
+	if start, err = strconv.Atoi(s); err != nil {
+		return 0, 0, err
+	}
+	if lines == 0 {
+		start++
+	}
+	return start, lines, nil
+}
+
+// Applyはpのhunkをoldに順に適用した内容を返す. hunkの変更前の行が書かれた位置になければ、
+// 前後に最も近い一致する位置に適用する. どこにもなければErrPatchFailedを返す.
+func (p *FilePatch) Apply(old []byte) ([]byte, error) {
+	lines := SplitLines(old)
+	var out strings.Builder
+	// cursorはまだ書き出していないoldの行、offsetは前のhunkを適用した位置のずれ.
+	cursor, offset := 0, 0
+	for _, hunk := range p.Hunks {
+		var preimage, postimage []string
+		for _, edit := range hunk.Edits {
+			if edit.Op != Insert {
+				preimage = append(preimage, edit.Text)
+			}
+			if edit.Op != Delete {
+				postimage = append(postimage, edit.Text)
+			}
+		}
+		pos, ok := findPreimage(lines, preimage, hunk.OldStart-1+offset, cursor)
+		if !ok {
+			return nil, fmt.Errorf("%w : %s", ErrPatchFailed, hunk.Header())
+		}
+		offset = pos - (hunk.OldStart - 1)
+		writeLines(&out, lines[cursor:pos])
+		writeLines(&out, postimage)
+		cursor = pos + len(preimage)
+	}
+	writeLines(&out, lines[cursor:])
+	return []byte(out.String()), nil
+}
+
+// findPreimageはlinesのfrom以降で、preimageと一致する位置をwantに近い順に探す.
+func findPreimage(lines, preimage []string, want, from int) (int, bool) {
+	last := len(lines) - len(preimage)
+	for delta := 0; want-delta >= from || want+delta <= last; delta++ {
+		for _, pos := range []int{want - delta, want + delta} {
+			if pos < from || pos > last {
+				continue
+			}
+			if matchLines(lines[pos:pos+len(preimage)], preimage) {
+				return pos, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func matchLines(a, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,51 @@
+package diff
+
+import "hash/fnv"
+
+// similarityChunkは内容を比べる単位の長さの上限. 改行がなくてもこの長さで区切る. gitと同じ.
+const similarityChunk = 64
+
+// Similarityはoldとnewの内容がどれだけ似ているかを0から100で返す. 内容を行(長い行は64バイトごと)に区切って
+// ハッシュを取り、両方にある部分のバイト数を大きい方のサイズで割る. 行の順序は考えない. どちらも空なら100を返す.
+func Similarity(old, new []byte) int {
+	size := len(old)
+	if len(new) > size {
+		size = len(new)
+	}
+	if size == 0 {
+		return 100
+	}
+	counts := map[uint64]int{}
+	for _, chunk := range similarityChunks(old) {
+		counts[chunkHash(chunk)] += len(chunk)
+	}
+	shared := 0
+	for _, chunk := range similarityChunks(new) {
+		h := chunkHash(chunk)
+		n := min(counts[h], len(chunk))
+		counts[h] -= n
+		shared += n
+	}
+	return shared * 100 / size
+}
+
+func similarityChunks(data []byte) [][]byte {
+	var chunks [][]byte
+	start := 0
+	for i, b := range data {
+		if b == '\n' || i+1-start == similarityChunk {
+			chunks = append(chunks, data[start:i+1])
+			start = i + 1
+		}
+	}
+	if start < len(data) {
+		chunks = append(chunks, data[start:])
+	}
+	return chunks
+}
+
+func chunkHash(chunk []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(chunk)
+	return h.Sum64()
+}
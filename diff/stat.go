@@ -0,0 +1,165 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// FileStatはdiff --statで表示する1つのファイルの変更行数.
+type FileStat struct {
+	Path           string
+	Added, Deleted int
+	Binary         bool
+}
+
+// NewFileStatはfの追加行数と削除行数を数える. どちらかの側がバイナリなら行数は数えない.
+func NewFileStat(f File) FileStat {
+	path := f.NewPath
+	switch {
+	case f.NewMode == 0:
+		path = f.OldPath
+	case f.OldMode != 0 && f.OldPath != f.NewPath:
+		path = renamePath(f.OldPath, f.NewPath)
+	}
+	stat := FileStat{Path: path}
+	if IsBinary(f.Old) || IsBinary(f.New) {
+		stat.Binary = true
+		return stat
+	}
+	for _, edit := range Lines(SplitLines(f.Old), SplitLines(f.New)) {
+		switch edit.Op {
+		case Insert:
+			stat.Added++
+		case Delete:
+			stat.Deleted++
+		}
+	}
+	return stat
+}
+
+// renamePathは名前の変更を"dir/{old => new}"のように、共通のディレクトリをまとめて表す.
+func renamePath(old, new string) string {
+	prefix := 0
+	for i := 0; i < len(old) && i < len(new) && old[i] == new[i]; i++ {
+		if old[i] == '/' {
+			prefix = i + 1
+		}
+	}
+	suffix := 0
+	for i := 1; i <= len(old)-prefix && i <= len(new)-prefix && old[len(old)-i] == new[len(new)-i]; i++ {
+		if old[len(old)-i] == '/' {
+			suffix = i
+		}
+	}
+	if prefix == 0 && suffix == 0 {
+		return old + " => " + new
+	}
+	return fmt.Sprintf("%s{%s => %s}%s", old[:prefix], old[prefix:len(old)-suffix], new[prefix:len(new)-suffix], old[len(old)-suffix:])
+}
+
+// statWidthはWriteStatの1行の幅の上限. 変更行数のグラフはこの幅に収まるように縮める.
+const statWidth = 80
+
+// WriteStatはstatsをgit diff --statと同じ形式で、ファイルごとの行と合計の行にして書き出す.
+func WriteStat(w io.Writer, stats []FileStat) error {
+	nameWidth, countWidth, maxChanges := 0, 1, 0
+	added, deleted := 0, 0
+	for _, stat := range stats {
+		if len(stat.Path) > nameWidth {
+			nameWidth = len(stat.Path)
+		}
+		changes := stat.Added + stat.Deleted
+		if n := len(fmt.Sprint(changes)); n > countWidth {
+			countWidth = n
+		}
+		if changes > maxChanges {
+			maxChanges = changes
+		}
+		added += stat.Added
+		deleted += stat.Deleted
+	}
+	if countWidth < 3 && hasBinary(stats) {
+		countWidth = 3
+	}
+	graphWidth := statWidth - nameWidth - countWidth - 5
+	if graphWidth < 10 {
+		graphWidth = 10
+	}
+
+	var buf strings.Builder
+	for _, stat := range stats {
+		if stat.Binary {
+			fmt.Fprintf(&buf, " %-*s | %*s\n", nameWidth, stat.Path, countWidth, "Bin")
+			continue
+		}
+		plus, minus := stat.Added, stat.Deleted
+		if maxChanges > graphWidth {
+			// 0でない行数は少なくとも1文字で表す.
+			plus, minus = scaleStat(plus, maxChanges, graphWidth), scaleStat(minus, maxChanges, graphWidth)
+		}
+		fmt.Fprintf(&buf, " %-*s | %*d", nameWidth, stat.Path, countWidth, stat.Added+stat.Deleted)
+		if plus+minus > 0 {
+			fmt.Fprintf(&buf, " %s%s", strings.Repeat("+", plus), strings.Repeat("-", minus))
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString(statSummary(len(stats), added, deleted))
+	buf.WriteString("\n")
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+// WriteNumStatはstatsをgit diff --numstatと同じく、ファイルごとに"追加行数\t削除行数\tパス"の行にして
+// 書き出す. バイナリのファイルは行数の代わりに"-"を書く.
+func WriteNumStat(w io.Writer, stats []FileStat) error {
+	var buf strings.Builder
+	for _, stat := range stats {
+		if stat.Binary {
+			fmt.Fprintf(&buf, "-\t-\t%s\n", stat.Path)
+			continue
+		}
+		fmt.Fprintf(&buf, "%d\t%d\t%s\n", stat.Added, stat.Deleted, stat.Path)
+	}
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+func hasBinary(stats []FileStat) bool {
+	for _, stat := range stats {
+		if stat.Binary {
+			return true
+		}
+	}
+	return false
+}
+
+func scaleStat(n, max, width int) int {
+	if n == 0 {
+		return 0
+	}
+	scaled := n * width / max
+	if scaled == 0 {
+		scaled = 1
+	}
+	return scaled
+}
+
+// statSummaryは" 2 files changed, 3 insertions(+), 1 deletion(-)"の形式の合計の行を返す.
+func statSummary(files, added, deleted int) string {
+	summary := fmt.Sprintf(" %d %s changed", files, plural(files, "file", "files"))
+	if added > 0 || deleted == 0 {
+		summary += fmt.Sprintf(", %d %s(+)", added, plural(added, "insertion", "insertions"))
+	}
+	if deleted > 0 || added == 0 {
+		summary += fmt.Sprintf(", %d %s(-)", deleted, plural(deleted, "deletion", "deletions"))
+	}
+	return summary
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
@@ -0,0 +1,362 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/kanon1343/fsegit/color"
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+)
+
+// DefaultContextはhunkの前後に表示する変更のない行の数.
+const DefaultContext = 3
+
+// binaryCheckSizeはバイナリかを判定するときに調べる先頭のバイト数. gitと同じ.
+const binaryCheckSize = 8000
+
+// SplitLinesはdataを改行の直後で分割する. 各行は改行を含み、最後の行だけは改行がないことがある.
+func SplitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// IsBinaryはdataの先頭にヌル文字があればバイナリとみなす.
+func IsBinary(data []byte) bool {
+	if len(data) > binaryCheckSize {
+		data = data[:binaryCheckSize]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+// Hunkはunified形式の1つの変更箇所. 開始行は1から数え、行数が0の場合は直前の行を指す.
+type Hunk struct {
+	OldStart, OldLines int
+	NewStart, NewLines int
+	Edits              []Edit
+}
+
+// Headerは"@@ -1,3 +1,4 @@"の形式の見出しを返す.
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.OldStart, h.OldLines), hunkRange(h.NewStart, h.NewLines))
+}
+
+func hunkRange(start, lines int) string {
+	if lines == 0 {
+		start--
+	}
+	if lines == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+// Hunksは編集をcontext行の前後の文脈を含むhunkにまとめる. 文脈が重なるhunkは1つにする.
+func Hunks(edits []Edit, context int) []Hunk {
+	if context < 0 {
+		context = 0
+	}
+	var hunks []Hunk
+	oldLine, newLine := 1, 1
+	for i := 0; i < len(edits); {
+		if edits[i].Op == Equal {
+			oldLine++
+			newLine++
+			i++
+			continue
+		}
+
+		// 変更の前のcontext行から始め、次の変更までの変更のない行が2*context以下なら続ける.
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for end < len(edits) {
+			if edits[end].Op != Equal {
+				end++
+				continue
+			}
+			gap := end
+			for gap < len(edits) && edits[gap].Op == Equal {
+				gap++
+			}
+			if gap == len(edits) || gap-end > 2*context {
+				end += min(context, gap-end)
+				break
+			}
+			end = gap
+		}
+
+		hunk := Hunk{
+			OldStart: oldLine - (i - start),
+			NewStart: newLine - (i - start),
+			Edits:    edits[start:end],
+		}
+		for _, edit := range hunk.Edits {
+			if edit.Op != Insert {
+				hunk.OldLines++
+			}
+			if edit.Op != Delete {
+				hunk.NewLines++
+			}
+		}
+		hunks = append(hunks, hunk)
+		for _, edit := range edits[i:end] {
+			if edit.Op != Insert {
+				oldLine++
+			}
+			if edit.Op != Delete {
+				newLine++
+			}
+		}
+		i = end
+	}
+	return hunks
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Fileは差分を表示する1つのファイル. 追加ではOldModeが、削除ではNewModeが0になる.
+// 名前の変更ではOldPathとNewPathが異なり、Similarityに内容の類似度(%)を入れる.
+type File struct {
+	OldPath, NewPath string
+	OldMode, NewMode object.FileMode
+	OldHash, NewHash sha.SHA1
+	Old, New         []byte
+	Similarity       int
+}
+
+// WordDiffModeは変更した行を単語単位の差分で表示するときの示し方.
+type WordDiffMode int
+
+const (
+	// WordDiffNoneは単語単位の差分を使わず、行単位で表示する.
+	WordDiffNone WordDiffMode = iota
+	// WordDiffPlainは削除した単語を[-...-]で、追加した単語を{+...+}で囲む.
+	WordDiffPlain
+	// WordDiffColorは削除した単語を赤で、追加した単語を緑で示す.
+	WordDiffColor
+)
+
+// Optionsは差分の表示方法を指定する.
+type Options struct {
+	// Contextはhunkの前後に表示する行数.
+	Context int
+	// Colorなら見出し、hunkの見出し、削除と追加の行にgitと同じ色を付ける.
+	Color bool
+	// WordDiffを指定すると、変更した行を単語単位の差分で表示する.
+	WordDiff WordDiffMode
+}
+
+// WriteUnifiedはfをgit diffと同じ形式で書き出す.
+func WriteUnified(w io.Writer, f File, opts Options) error {
+	var buf bytes.Buffer
+	paint := func(code, s string) string {
+		if !opts.Color {
+			return s
+		}
+		return color.Wrap(code, s)
+	}
+	meta := func(format string, args ...interface{}) {
+		buf.WriteString(paint(color.Bold, fmt.Sprintf(format, args...)))
+		buf.WriteString("\n")
+	}
+
+	oldName, newName := "a/"+f.OldPath, "b/"+f.NewPath
+	meta("diff --git %s %s", oldName, newName)
+	switch {
+	case f.OldMode == 0:
+		meta("new file mode %s", f.NewMode)
+		oldName = "/dev/null"
+	case f.NewMode == 0:
+		meta("deleted file mode %s", f.OldMode)
+		newName = "/dev/null"
+	case f.OldMode != f.NewMode:
+		meta("old mode %s", f.OldMode)
+		meta("new mode %s", f.NewMode)
+	}
+	if f.OldMode != 0 && f.NewMode != 0 && f.OldPath != f.NewPath {
+		meta("similarity index %d%%", f.Similarity)
+		meta("rename from %s", f.OldPath)
+		meta("rename to %s", f.NewPath)
+	}
+
+	if !bytes.Equal(f.OldHash, f.NewHash) {
+		index := fmt.Sprintf("index %s..%s", abbrev(f.OldHash), abbrev(f.NewHash))
+		if f.OldMode == f.NewMode {
+			index += fmt.Sprintf(" %s", f.OldMode)
+		}
+		meta("%s", index)
+
+		if IsBinary(f.Old) || IsBinary(f.New) {
+			fmt.Fprintf(&buf, "Binary files %s and %s differ\n", oldName, newName)
+		} else {
+			meta("--- %s", oldName)
+			meta("+++ %s", newName)
+			edits := Lines(SplitLines(f.Old), SplitLines(f.New))
+			for _, hunk := range Hunks(edits, opts.Context) {
+				buf.WriteString(paint(color.Cyan, hunk.Header()))
+				buf.WriteString("\n")
+				if opts.WordDiff != WordDiffNone {
+					writeWordDiffHunk(&buf, hunk, opts)
+					continue
+				}
+				for _, edit := range hunk.Edits {
+					line := []string{" ", "-", "+"}[edit.Op] + strings.TrimSuffix(edit.Text, "\n")
+					buf.WriteString(paint([]string{"", color.Red, color.Green}[edit.Op], line))
+					buf.WriteString("\n")
+					if !strings.HasSuffix(edit.Text, "\n") {
+						buf.WriteString("\\ No newline at end of file\n")
+					}
+				}
+			}
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// writeWordDiffHunkはhunkを単語単位の差分で書き出す. 変更のない行は先頭の" "を付けずにそのまま書き、
+// 続けて削除と追加をした行は、それぞれをつなげた内容の単語を比べて1つにまとめて書く.
+func writeWordDiffHunk(buf *bytes.Buffer, hunk Hunk, opts Options) {
+	var old, new strings.Builder
+	flush := func() {
+		if old.Len() == 0 && new.Len() == 0 {
+			return
+		}
+		text := wordDiff(old.String(), new.String(), opts)
+		buf.WriteString(text)
+		if !strings.HasSuffix(text, "\n") {
+			buf.WriteString("\n")
+		}
+		old.Reset()
+		new.Reset()
+	}
+	for _, edit := range hunk.Edits {
+		switch edit.Op {
+		case Delete:
+			old.WriteString(edit.Text)
+		case Insert:
+			new.WriteString(edit.Text)
+		default:
+			flush()
+			buf.WriteString(edit.Text)
+			if !strings.HasSuffix(edit.Text, "\n") {
+				buf.WriteString("\n")
+			}
+		}
+	}
+	flush()
+}
+
+// wordは単語単位の差分で比べる、空白を含まない文字の並び. start、endはテキストの中の位置.
+type word struct {
+	start, end int
+}
+
+// splitWordsはtextを空白(改行を含む)で区切った単語に分ける.
+func splitWords(text string) ([]word, []string) {
+	var words []word
+	var texts []string
+	start := -1
+	for i := 0; i <= len(text); i++ {
+		space := i == len(text) || text[i] == ' ' || text[i] == '\t' || text[i] == '\n' || text[i] == '\r'
+		switch {
+		case space && start >= 0:
+			words = append(words, word{start, i})
+			texts = append(texts, text[start:i])
+			start = -1
+		case !space && start < 0:
+			start = i
+		}
+	}
+	return words, texts
+}
+
+// wordDiffはoldからnewへの変更を単語単位で示したテキストを返す. gitと同じく、空白はnewのものを使い、
+// 削除だけの箇所の前には空白を書かない. 削除や追加が複数行にわたるときは行ごとに囲む.
+func wordDiff(old, new string, opts Options) string {
+	oldWords, oldTexts := splitWords(old)
+	newWords, newTexts := splitWords(new)
+	edits := Lines(oldTexts, newTexts)
+
+	var out strings.Builder
+	// newPosはnewのうち書き終えた位置.
+	newPos, oi, ni := 0, 0, 0
+	for i := 0; i < len(edits); {
+		if edits[i].Op == Equal {
+			out.WriteString(new[newPos:newWords[ni].end])
+			newPos = newWords[ni].end
+			oi++
+			ni++
+			i++
+			continue
+		}
+		delStart, insStart := oi, ni
+		for ; i < len(edits) && edits[i].Op != Equal; i++ {
+			if edits[i].Op == Delete {
+				oi++
+			} else {
+				ni++
+			}
+		}
+		if ni > insStart {
+			out.WriteString(new[newPos:newWords[insStart].start])
+			newPos = newWords[insStart].start
+		}
+		if oi > delStart {
+			out.WriteString(markWords(old[oldWords[delStart].start:oldWords[oi-1].end], Delete, opts))
+		}
+		if ni > insStart {
+			out.WriteString(markWords(new[newWords[insStart].start:newWords[ni-1].end], Insert, opts))
+			newPos = newWords[ni-1].end
+		}
+	}
+	out.WriteString(new[newPos:])
+	return out.String()
+}
+
+// markWordsは削除(op == Delete)か追加した単語の並びを、opts.WordDiffに従って囲むか色を付ける.
+func markWords(text string, op Op, opts Options) string {
+	open, close, code := "[-", "-]", color.Red
+	if op == Insert {
+		open, close, code = "{+", "+}", color.Green
+	}
+	if opts.WordDiff == WordDiffColor {
+		open, close = "", ""
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line == "" {
+			continue
+		}
+		line = open + line + close
+		if opts.Color || opts.WordDiff == WordDiffColor {
+			line = color.Wrap(code, line)
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// abbrevはハッシュの先頭7文字を返す. nilなら0を並べる.
+func abbrev(hash sha.SHA1) string {
+	if hash == nil {
+		return "0000000"
+	}
+	return hash.String()[:7]
+}
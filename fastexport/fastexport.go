@@ -0,0 +1,347 @@
+// Package fastexportは履歴をgit fast-importのストリーム形式で書き出す.
+package fastexport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+)
+
+// Refは書き出す参照の名前と指しているオブジェクト.
+type Ref struct {
+	Name string
+	Hash sha.SHA1
+}
+
+// Exporterはコミット、ブロブ、タグにマークを振りながらストリームを書き出す.
+type Exporter struct {
+	client   *store.Client
+	w        *bufio.Writer
+	marks    map[string]int
+	nextMark int
+	// refOfはコミットを書き出したときの参照名.
+	refOf map[string]string
+}
+
+// NewExporterはwに書き出すExporterを返す.
+func NewExporter(client *store.Client, w io.Writer) *Exporter {
+	return &Exporter{
+		client:   client,
+		w:        bufio.NewWriter(w),
+		marks:    map[string]int{},
+		nextMark: 1,
+		refOf:    map[string]string{},
+	}
+}
+
+// ImportMarksは以前に書き出したマークファイルを読み込む. 読み込んだオブジェクトは再度書き出さない.
+func (e *Exporter) ImportMarks(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		var mark int
+		var hashString string
+		if _, err := fmt.Sscanf(line, ":%d %s", &mark, &hashString); err != nil {
+			return fmt.Errorf("invalid mark line %q: %w", line, err)
+		}
+		hash, err := hex.DecodeString(hashString)
+		if err != nil {
+			return err
+		}
+		e.marks[string(hash)] = mark
+		if mark >= e.nextMark {
+			e.nextMark = mark + 1
+		}
+	}
+	return scanner.Err()
+}
+
+// ExportMarksはマークとオブジェクトの対応を":<mark> <hash>"の形式で書き出す.
+func (e *Exporter) ExportMarks(w io.Writer) error {
+	type entry struct {
+		mark int
+		hash sha.SHA1
+	}
+	entries := make([]entry, 0, len(e.marks))
+	for hash, mark := range e.marks {
+		entries = append(entries, entry{mark, sha.SHA1(hash)})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].mark < entries[j].mark
+	})
+	for _, entry := range entries {
+		if _, err := fmt.Fprintf(w, ":%d %s\n", entry.mark, entry.hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Exportはrefsから辿れてexcludeから辿れないコミットを、親が先になる順で書き出す.
+func (e *Exporter) Export(refs []Ref, exclude []sha.SHA1) error {
+	excluded := map[string]struct{}{}
+	for _, hash := range exclude {
+		commitHash, err := e.peelToCommit(hash)
+		if err != nil {
+			return err
+		}
+		if err := e.client.WalkHistory(commitHash, func(commit *object.Commit) error {
+			excluded[string(commit.Hash)] = struct{}{}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	var tags []Ref
+	for _, ref := range refs {
+		obj, err := e.client.GetObject(ref.Hash)
+		if err != nil {
+			return err
+		}
+		if obj.Type == object.TagObject {
+			tags = append(tags, ref)
+		}
+		commitHash, err := e.peelToCommit(ref.Hash)
+		if err != nil {
+			return err
+		}
+		if err := e.exportHistory(ref.Name, commitHash, excluded); err != nil {
+			return err
+		}
+		if obj.Type == object.TagObject {
+			continue
+		}
+		// 先端のコミットが別の参照名で書き出されていれば、この参照を付け替える.
+		if name, ok := e.refOf[string(commitHash)]; !ok || name != ref.Name {
+			if _, ok := e.marks[string(commitHash)]; ok {
+				fmt.Fprintf(e.w, "reset %s\nfrom %s\n\n", ref.Name, e.dataRef(commitHash))
+			}
+		}
+	}
+
+	for _, ref := range tags {
+		if err := e.exportTag(ref); err != nil {
+			return err
+		}
+	}
+	return e.w.Flush()
+}
+
+// exportHistoryはtipから辿れるコミットを親が先になる順で書き出す.
+func (e *Exporter) exportHistory(refName string, tip sha.SHA1, excluded map[string]struct{}) error {
+	skip := func(hash sha.SHA1) bool {
+		_, isExcluded := excluded[string(hash)]
+		_, isMarked := e.marks[string(hash)]
+		return isExcluded || isMarked
+	}
+	return e.client.WalkHistoryReverse([]sha.SHA1{tip}, skip, func(commit *object.Commit) error {
+		return e.exportCommit(refName, commit)
+	})
+}
+
+func (e *Exporter) exportCommit(refName string, commit *object.Commit) error {
+	var parentTree sha.SHA1
+	if len(commit.Parents) > 0 {
+		parent, err := e.getCommit(commit.Parents[0])
+		if err != nil {
+			return err
+		}
+		parentTree = parent.Tree
+	}
+	changes, err := e.treeChanges(parentTree, commit.Tree)
+	if err != nil {
+		return err
+	}
+
+	// 変更されたブロブを先に書き出す.
+	for _, change := range changes {
+		if change.deleted || change.entry.Mode == object.ModeGitlink {
+			continue
+		}
+		if err := e.exportBlob(change.entry.Hash); err != nil {
+			return err
+		}
+	}
+
+	mark := e.mark(commit.Hash)
+	e.refOf[string(commit.Hash)] = refName
+
+	if len(commit.Parents) == 0 {
+		fmt.Fprintf(e.w, "reset %s\n", refName)
+	}
+	fmt.Fprintf(e.w, "commit %s\n", refName)
+	fmt.Fprintf(e.w, "mark :%d\n", mark)
+	fmt.Fprintf(e.w, "author %s\n", commit.Author.Encode())
+	fmt.Fprintf(e.w, "committer %s\n", commit.Committer.Encode())
+	e.writeData([]byte(commit.Message))
+	for i, parent := range commit.Parents {
+		command := "merge"
+		if i == 0 {
+			command = "from"
+		}
+		fmt.Fprintf(e.w, "%s %s\n", command, e.dataRef(parent))
+	}
+	for _, change := range changes {
+		if change.deleted {
+			fmt.Fprintf(e.w, "D %s\n", quotePath(change.path))
+			continue
+		}
+		fmt.Fprintf(e.w, "M %o %s %s\n", uint32(change.entry.Mode), e.dataRef(change.entry.Hash), quotePath(change.path))
+	}
+	fmt.Fprintln(e.w)
+	return nil
+}
+
+func (e *Exporter) exportBlob(hash sha.SHA1) error {
+	if _, ok := e.marks[string(hash)]; ok {
+		return nil
+	}
+	obj, err := e.client.GetObject(hash)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.w, "blob\nmark :%d\n", e.mark(hash))
+	e.writeData(obj.Data)
+	return nil
+}
+
+func (e *Exporter) exportTag(ref Ref) error {
+	obj, err := e.client.GetObject(ref.Hash)
+	if err != nil {
+		return err
+	}
+	tag, err := object.NewTag(obj)
+	if err != nil {
+		return err
+	}
+	if _, ok := e.marks[string(tag.Hash)]; ok {
+		return nil
+	}
+	fmt.Fprintf(e.w, "tag %s\n", strings.TrimPrefix(ref.Name, "refs/tags/"))
+	fmt.Fprintf(e.w, "mark :%d\n", e.mark(tag.Hash))
+	fmt.Fprintf(e.w, "from %s\n", e.dataRef(tag.Object))
+	if tag.Tagger.Name != "" || tag.Tagger.Email != "" {
+		fmt.Fprintf(e.w, "tagger %s\n", tag.Tagger.Encode())
+	}
+	e.writeData([]byte(tag.Message))
+	return nil
+}
+
+// markはhashにマークを振って返す.
+func (e *Exporter) mark(hash sha.SHA1) int {
+	if mark, ok := e.marks[string(hash)]; ok {
+		return mark
+	}
+	mark := e.nextMark
+	e.marks[string(hash)] = mark
+	e.nextMark++
+	return mark
+}
+
+// dataRefはマークが振られていれば":<mark>"を、なければハッシュをそのまま返す.
+func (e *Exporter) dataRef(hash sha.SHA1) string {
+	if mark, ok := e.marks[string(hash)]; ok {
+		return ":" + strconv.Itoa(mark)
+	}
+	return hash.String()
+}
+
+func (e *Exporter) writeData(data []byte) {
+	fmt.Fprintf(e.w, "data %d\n", len(data))
+	e.w.Write(data)
+	e.w.WriteString("\n")
+}
+
+func (e *Exporter) getCommit(hash sha.SHA1) (*object.Commit, error) {
+	obj, err := e.client.GetObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	return object.NewCommit(obj)
+}
+
+// peelToCommitはタグを辿ってコミットのハッシュを返す.
+func (e *Exporter) peelToCommit(hash sha.SHA1) (sha.SHA1, error) {
+	for {
+		obj, err := e.client.GetObject(hash)
+		if err != nil {
+			return nil, err
+		}
+		switch obj.Type {
+		case object.CommitObject:
+			return hash, nil
+		case object.TagObject:
+			tag, err := object.NewTag(obj)
+			if err != nil {
+				return nil, err
+			}
+			hash = tag.Object
+		default:
+			return nil, fmt.Errorf("%w : %s is a %s", object.ErrNotCommitObject, hash, obj.Type)
+		}
+	}
+}
+
+type change struct {
+	path    string
+	entry   object.TreeEntry
+	deleted bool
+}
+
+// treeChangesはfromからtoへのファイル単位の変更をパス順に返す. fromがnilなら全て追加になる.
+func (e *Exporter) treeChanges(from, to sha.SHA1) ([]change, error) {
+	before := map[string]object.TreeEntry{}
+	if from != nil {
+		if err := e.client.WalkTree(from, nil, func(path string, entry object.TreeEntry) error {
+			before[path] = entry
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	var changes []change
+	if err := e.client.WalkTree(to, nil, func(path string, entry object.TreeEntry) error {
+		old, ok := before[path]
+		delete(before, path)
+		if ok && old.Mode == entry.Mode && bytes.Equal(old.Hash, entry.Hash) {
+			return nil
+		}
+		changes = append(changes, change{path: path, entry: entry})
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	for path, entry := range before {
+		changes = append(changes, change{path: path, entry: entry, deleted: true})
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		// 削除を先に適用しないと、ファイルがディレクトリに置き換わる場合に失敗する.
+		if changes[i].deleted != changes[j].deleted {
+			return changes[i].deleted
+		}
+		return changes[i].path < changes[j].path
+	})
+	return changes, nil
+}
+
+// quotePathは必要な場合だけパスをC言語風にクォートする.
+func quotePath(path string) string {
+	if strings.ContainsAny(path, "\"\\\n") || strings.HasPrefix(path, "\"") {
+		return strconv.Quote(path)
+	}
+	return path
+}
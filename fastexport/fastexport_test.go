@@ -0,0 +1,154 @@
+package fastexport
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+)
+
+// storeCommitはfilesを内容に持つコミットを書き込む. whenはコミットの時刻を基準からずらす秒数.
+func storeCommit(t *testing.T, client *store.Client, files map[string]string, message string, when int, parents ...sha.SHA1) sha.SHA1 {
+	t.Helper()
+	var entries []store.PathEntry
+	for name, content := range files {
+		blob, err := client.StoreRaw(object.BlobObject, []byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, store.PathEntry{Path: name, Mode: object.ModeBlob, Hash: blob})
+	}
+	tree, err := client.BuildTree(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := fmt.Sprintf("tree %s\n", tree)
+	for _, parent := range parents {
+		data += fmt.Sprintf("parent %s\n", parent)
+	}
+	data += fmt.Sprintf("author fsegit <fsegit@example.com> %d +0900\ncommitter fsegit <fsegit@example.com> %d +0900\n\n%s\n", 1672531200+when, 1672531200+when, message)
+	hash, err := client.StoreRaw(object.CommitObject, []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+// マージコミットはfromとmergeで親を、注釈付きタグはtagコマンドで指す先のマークを書き出すか
+func TestExporter_Export(t *testing.T) {
+	client, _, err := store.Init(t.TempDir(), store.InitOptions{InitialBranch: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := storeCommit(t, client, map[string]string{"a.txt": "a\n", "old.txt": "old\n"}, "root", 0)
+	side := storeCommit(t, client, map[string]string{"a.txt": "a\n", "old.txt": "old\n", "b.txt": "b\n"}, "side", 1, root)
+	second := storeCommit(t, client, map[string]string{"a.txt": "a2\n"}, "second", 2, root)
+	merge := storeCommit(t, client, map[string]string{"a.txt": "a2\n", "b.txt": "b\n"}, "merge", 3, second, side)
+	tagger := object.Signature{Name: "tagger", Email: "tagger@example.com", When: time.Unix(1672531300, 0).In(time.FixedZone("", 9*60*60))}
+	tag, _, err := client.CreateAnnotatedTag("v1", root, tagger, "release\n", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	e := NewExporter(client, &buf)
+	if err := e.Export([]Ref{{Name: "refs/heads/main", Hash: merge}, {Name: "refs/tags/v1", Hash: tag}}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `blob
+mark :1
+data 2
+a
+
+blob
+mark :2
+data 4
+old
+
+reset refs/heads/main
+commit refs/heads/main
+mark :3
+author fsegit <fsegit@example.com> 1672531200 +0900
+committer fsegit <fsegit@example.com> 1672531200 +0900
+data 5
+root
+
+M 100644 :1 a.txt
+M 100644 :2 old.txt
+
+blob
+mark :4
+data 3
+a2
+
+commit refs/heads/main
+mark :5
+author fsegit <fsegit@example.com> 1672531202 +0900
+committer fsegit <fsegit@example.com> 1672531202 +0900
+data 7
+second
+
+from :3
+D old.txt
+M 100644 :4 a.txt
+
+blob
+mark :6
+data 2
+b
+
+commit refs/heads/main
+mark :7
+author fsegit <fsegit@example.com> 1672531201 +0900
+committer fsegit <fsegit@example.com> 1672531201 +0900
+data 5
+side
+
+from :3
+M 100644 :6 b.txt
+
+commit refs/heads/main
+mark :8
+author fsegit <fsegit@example.com> 1672531203 +0900
+committer fsegit <fsegit@example.com> 1672531203 +0900
+data 6
+merge
+
+from :5
+merge :7
+M 100644 :6 b.txt
+
+tag v1
+mark :9
+from :3
+tagger tagger <tagger@example.com> 1672531300 +0900
+data 8
+release
+
+`
+	if got := buf.String(); got != want {
+		t.Errorf("Export() =\n%s\nwant\n%s", got, want)
+	}
+
+	var marks bytes.Buffer
+	if err := e.ExportMarks(&marks); err != nil {
+		t.Fatal(err)
+	}
+	// 書き出したマークを読み込むと、同じ参照はコミットを書き出さずに付け替えるだけになる.
+	buf.Reset()
+	again := NewExporter(client, &buf)
+	if err := again.ImportMarks(&marks); err != nil {
+		t.Fatal(err)
+	}
+	if err := again.Export([]Ref{{Name: "refs/heads/main", Hash: merge}, {Name: "refs/tags/v1", Hash: tag}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "reset refs/heads/main\nfrom :8\n\n"; got != want {
+		t.Errorf("Export() after ImportMarks = %q, want %q", got, want)
+	}
+}
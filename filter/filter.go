@@ -0,0 +1,274 @@
+// Package filterはコミットを再生しながら履歴を書き換える.
+package filter
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/pathspec"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+)
+
+// Renameはパスの接頭辞FromをToに付け替える.
+type Rename struct {
+	From string
+	To   string
+}
+
+// Optionsは履歴の書き換え方を指定する.
+type Options struct {
+	// RemovePathsにマッチするパスを全てのコミットから取り除く.
+	RemovePaths *pathspec.Pathspec
+	Renames     []Rename
+	// EmailMapは作者とコミッターのメールアドレスの置き換え表.
+	EmailMap map[string]string
+	// MaxBlobSizeより大きいブロブを取り除く. 0なら制限しない.
+	MaxBlobSize int
+}
+
+// RefUpdateは書き換えた参照の前後の値.
+type RefUpdate struct {
+	Name string
+	Old  sha.SHA1
+	New  sha.SHA1
+}
+
+// Filterは書き換え前後のコミットの対応を保持する.
+type Filter struct {
+	client    *store.Client
+	opts      Options
+	commitMap map[string]sha.SHA1
+	// treeMapは書き換え前のルートツリーと書き換え後のツリーの対応.
+	treeMap map[string]sha.SHA1
+	// oldTreesは書き換え前のコミットのツリー.
+	oldTrees map[string]sha.SHA1
+}
+
+// NewはFilterを返す.
+func New(client *store.Client, opts Options) *Filter {
+	return &Filter{
+		client:    client,
+		opts:      opts,
+		commitMap: map[string]sha.SHA1{},
+		treeMap:   map[string]sha.SHA1{},
+		oldTrees:  map[string]sha.SHA1{},
+	}
+}
+
+// CommitMapは書き換え前のコミットから書き換え後のコミットへの対応を返す.
+func (f *Filter) CommitMap() map[string]sha.SHA1 {
+	return f.commitMap
+}
+
+// Runはrefsから辿れる全てのコミットを書き換え、参照を新しいコミットに付け替えてreflogに記録する.
+func (f *Filter) Run(refs []store.Ref) ([]RefUpdate, error) {
+	var tips []sha.SHA1
+	for _, ref := range refs {
+		tip, err := f.peel(ref.Hash)
+		if err != nil {
+			return nil, err
+		}
+		if tip != nil {
+			tips = append(tips, tip)
+		}
+	}
+
+	// 浅いリポジトリの境界の親のように手元にないコミットは辿らず、書き換えたコミットからもそのまま指す.
+	missing := func(hash sha.SHA1) bool {
+		ok, err := f.client.HasObject(hash)
+		return err == nil && !ok
+	}
+	if err := f.client.WalkHistoryReverse(tips, missing, f.rewriteCommit); err != nil {
+		return nil, err
+	}
+
+	var updates []RefUpdate
+	for _, ref := range refs {
+		newHash, err := f.rewriteRefTarget(ref.Hash)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(newHash, ref.Hash) {
+			continue
+		}
+		if err := f.client.UpdateRefIfMatch(ref.Name, newHash, ref.Hash, "filter: rewrite history"); err != nil {
+			return nil, err
+		}
+		updates = append(updates, RefUpdate{Name: ref.Name, Old: ref.Hash, New: newHash})
+	}
+	return updates, nil
+}
+
+func (f *Filter) rewriteCommit(commit *object.Commit) error {
+	f.oldTrees[string(commit.Hash)] = commit.Tree
+
+	tree, err := f.rewriteTree(commit.Tree)
+	if err != nil {
+		return err
+	}
+
+	var parents []sha.SHA1
+	seen := map[string]struct{}{}
+	for _, parent := range commit.Parents {
+		newParent, ok := f.commitMap[string(parent)]
+		if !ok {
+			newParent = parent
+		}
+		if _, ok := seen[string(newParent)]; ok {
+			continue
+		}
+		seen[string(newParent)] = struct{}{}
+		parents = append(parents, newParent)
+	}
+
+	// 書き換えによって変更がなくなったコミットは取り除き、親に置き換える. 手元にない親とは比べられないので残す.
+	if len(parents) == 1 && len(commit.Parents) == 1 {
+		if oldParentTree, ok := f.oldTrees[string(commit.Parents[0])]; ok {
+			newParentTree, err := f.commitTree(parents[0])
+			if err != nil {
+				return err
+			}
+			if bytes.Equal(tree, newParentTree) && !bytes.Equal(commit.Tree, oldParentTree) {
+				f.commitMap[string(commit.Hash)] = parents[0]
+				return nil
+			}
+		}
+	}
+
+	rewritten := *commit
+	rewritten.Tree = tree
+	rewritten.Parents = parents
+	rewritten.Author.Email = f.mapEmail(commit.Author.Email)
+	rewritten.Committer.Email = f.mapEmail(commit.Committer.Email)
+
+	obj := object.NewObject(object.CommitObject, rewritten.Encode())
+	if err := f.client.WriteObject(obj); err != nil {
+		return err
+	}
+	f.commitMap[string(commit.Hash)] = obj.Hash
+	return nil
+}
+
+// rewriteTreeはツリーを平坦化してパスの除去と付け替えを行い、ツリーを組み立て直す.
+func (f *Filter) rewriteTree(hash sha.SHA1) (sha.SHA1, error) {
+	if newHash, ok := f.treeMap[string(hash)]; ok {
+		return newHash, nil
+	}
+
+	var entries []store.PathEntry
+	if err := f.client.WalkTree(hash, nil, func(path string, entry object.TreeEntry) error {
+		if f.opts.RemovePaths != nil && !f.opts.RemovePaths.Empty() && f.opts.RemovePaths.Match(path) {
+			return nil
+		}
+		if f.opts.MaxBlobSize > 0 && entry.Mode.ObjectType() == object.BlobObject {
+			obj, err := f.client.GetObject(entry.Hash)
+			if err != nil {
+				return err
+			}
+			if obj.Size > f.opts.MaxBlobSize {
+				return nil
+			}
+		}
+		entries = append(entries, store.PathEntry{
+			Path: f.renamePath(path),
+			Mode: entry.Mode,
+			Hash: entry.Hash,
+		})
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	newHash, err := f.client.BuildTree(entries)
+	if err != nil {
+		return nil, err
+	}
+	f.treeMap[string(hash)] = newHash
+	return newHash, nil
+}
+
+func (f *Filter) renamePath(path string) string {
+	for _, rename := range f.opts.Renames {
+		if path == rename.From {
+			return rename.To
+		}
+		if strings.HasPrefix(path, rename.From+"/") {
+			return strings.TrimSuffix(rename.To, "/") + path[len(rename.From):]
+		}
+	}
+	return path
+}
+
+func (f *Filter) mapEmail(email string) string {
+	if mapped, ok := f.opts.EmailMap[email]; ok {
+		return mapped
+	}
+	return email
+}
+
+// rewriteRefTargetは参照が指すコミットかタグを書き換え後のものに置き換える.
+func (f *Filter) rewriteRefTarget(hash sha.SHA1) (sha.SHA1, error) {
+	obj, err := f.client.GetObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	switch obj.Type {
+	case object.CommitObject:
+		if newHash, ok := f.commitMap[string(hash)]; ok {
+			return newHash, nil
+		}
+	case object.TagObject:
+		tag, err := object.NewTag(obj)
+		if err != nil {
+			return nil, err
+		}
+		target, err := f.rewriteRefTarget(tag.Object)
+		if err != nil {
+			return nil, err
+		}
+		tag.Object = target
+		tag.Tagger.Email = f.mapEmail(tag.Tagger.Email)
+		newObj := object.NewObject(object.TagObject, tag.Encode())
+		if err := f.client.WriteObject(newObj); err != nil {
+			return nil, err
+		}
+		return newObj.Hash, nil
+	}
+	return hash, nil
+}
+
+func (f *Filter) commitTree(hash sha.SHA1) (sha.SHA1, error) {
+	obj, err := f.client.GetObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := object.NewCommit(obj)
+	if err != nil {
+		return nil, err
+	}
+	return commit.Tree, nil
+}
+
+// peelはタグを辿ってコミットのハッシュを返す. コミット以外を指している場合はnilを返す.
+func (f *Filter) peel(hash sha.SHA1) (sha.SHA1, error) {
+	for {
+		obj, err := f.client.GetObject(hash)
+		if err != nil {
+			return nil, err
+		}
+		switch obj.Type {
+		case object.CommitObject:
+			return hash, nil
+		case object.TagObject:
+		default:
+			return nil, nil
+		}
+		tag, err := object.NewTag(obj)
+		if err != nil {
+			return nil, err
+		}
+		hash = tag.Object
+	}
+}
@@ -0,0 +1,189 @@
+package filter
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/pathspec"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+)
+
+func newTestClient(t *testing.T) *store.Client {
+	t.Helper()
+	client, _, err := store.Init(t.TempDir(), store.InitOptions{InitialBranch: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// storeCommitはfilesを内容に持つコミットを書き込む. filesのキーはファイル名.
+func storeCommit(t *testing.T, client *store.Client, files map[string]string, message string, parents ...sha.SHA1) sha.SHA1 {
+	t.Helper()
+	var entries []store.PathEntry
+	for name, content := range files {
+		blob, err := client.StoreRaw(object.BlobObject, []byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, store.PathEntry{Path: name, Mode: object.ModeBlob, Hash: blob})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	tree, err := client.BuildTree(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := fmt.Sprintf("tree %s\n", tree)
+	for _, parent := range parents {
+		data += fmt.Sprintf("parent %s\n", parent)
+	}
+	data += "author fsegit <fsegit@example.com> 1672531200 +0900\ncommitter fsegit <fsegit@example.com> 1672531200 +0900\n\n" + message + "\n"
+	hash, err := client.StoreRaw(object.CommitObject, []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+func removePaths(t *testing.T, paths ...string) *pathspec.Pathspec {
+	t.Helper()
+	ps, err := pathspec.Parse("", paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ps
+}
+
+func getCommit(t *testing.T, client *store.Client, hash sha.SHA1) *object.Commit {
+	t.Helper()
+	commit, err := client.GetCommit(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return commit
+}
+
+func hasPath(t *testing.T, client *store.Client, tree sha.SHA1, path string) bool {
+	t.Helper()
+	found := false
+	if err := client.WalkTree(tree, nil, func(p string, entry object.TreeEntry) error {
+		found = found || p == path
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return found
+}
+
+func sameHashes(a, b []sha.SHA1) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// パスを取り除いて空になったコミットを除き、マージの親を書き換え後のコミットに付け替え、
+// ブランチと注釈付きタグを新しいコミットに移してreflogに記録するか
+func TestFilter_Run(t *testing.T) {
+	client := newTestClient(t)
+	root := storeCommit(t, client, map[string]string{"a.txt": "a\n", "secret.txt": "1\n"}, "root")
+	// secret.txtだけを変えたコミットは、取り除くと変更がなくなる.
+	secret := storeCommit(t, client, map[string]string{"a.txt": "a\n", "secret.txt": "2\n"}, "secret", root)
+	left := storeCommit(t, client, map[string]string{"a.txt": "left\n", "secret.txt": "2\n"}, "left", secret)
+	right := storeCommit(t, client, map[string]string{"a.txt": "a\n", "b.txt": "b\n", "secret.txt": "2\n"}, "right", secret)
+	merge := storeCommit(t, client, map[string]string{"a.txt": "left\n", "b.txt": "b\n", "secret.txt": "2\n"}, "merge", left, right)
+	if err := client.WriteRef("refs/heads/main", merge); err != nil {
+		t.Fatal(err)
+	}
+	tagger := object.Signature{Name: "fsegit", Email: "fsegit@example.com", When: time.Unix(1672531200, 0)}
+	tag, _, err := client.CreateAnnotatedTag("v1", secret, tagger, "release\n", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := New(client, Options{RemovePaths: removePaths(t, "secret.txt")})
+	updates, err := f.Run([]store.Ref{{Name: "refs/heads/main", Hash: merge}, {Name: "refs/tags/v1", Hash: tag}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitMap := f.CommitMap()
+	newRoot, newLeft, newRight, newMerge := commitMap[string(root)], commitMap[string(left)], commitMap[string(right)], commitMap[string(merge)]
+
+	if !bytes.Equal(commitMap[string(secret)], newRoot) {
+		t.Errorf("empty commit was not pruned: %s -> %s, want %s", secret, commitMap[string(secret)], newRoot)
+	}
+	for _, hash := range []sha.SHA1{newRoot, newLeft, newRight, newMerge} {
+		if hasPath(t, client, getCommit(t, client, hash).Tree, "secret.txt") {
+			t.Errorf("%s still has secret.txt", hash)
+		}
+	}
+	if got := getCommit(t, client, newMerge).Parents; !sameHashes(got, []sha.SHA1{newLeft, newRight}) {
+		t.Errorf("merge parents = %v, want %s %s", got, newLeft, newRight)
+	}
+	for _, hash := range []sha.SHA1{newLeft, newRight} {
+		if got := getCommit(t, client, hash).Parents; !sameHashes(got, []sha.SHA1{newRoot}) {
+			t.Errorf("%s parents = %v, want %s", hash, got, newRoot)
+		}
+	}
+
+	if len(updates) != 2 || updates[0].Name != "refs/heads/main" || !bytes.Equal(updates[0].New, newMerge) || updates[1].Name != "refs/tags/v1" {
+		t.Fatalf("Run() updates = %+v", updates)
+	}
+	if got, err := client.ResolveRef("refs/heads/main"); err != nil || !bytes.Equal(got, newMerge) {
+		t.Errorf("refs/heads/main = %s, %v, want %s", got, err, newMerge)
+	}
+	reflog, err := client.ReadReflog("refs/heads/main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reflog) == 0 || !bytes.Equal(reflog[0].Old, merge) || !bytes.Equal(reflog[0].New, newMerge) || reflog[0].Message != "filter: rewrite history" {
+		t.Errorf("reflog of refs/heads/main = %+v", reflog)
+	}
+	obj, err := client.GetObject(updates[1].New)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newTag, err := object.NewTag(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(newTag.Object, newRoot) || newTag.Name != "v1" {
+		t.Errorf("rewritten tag points at %s, want %s", newTag.Object, newRoot)
+	}
+}
+
+// 浅いリポジトリのように親が手元にないコミットは、親のハッシュをそのまま残して書き換えるか
+func TestFilter_RunMissingParent(t *testing.T) {
+	client := newTestClient(t)
+	missing := sha.SHA1(bytes.Repeat([]byte{0x11}, 20))
+	boundary := storeCommit(t, client, map[string]string{"a.txt": "a\n", "secret.txt": "1\n"}, "boundary", missing)
+	tip := storeCommit(t, client, map[string]string{"a.txt": "b\n", "secret.txt": "1\n"}, "tip", boundary)
+	if err := client.WriteRef("refs/heads/main", tip); err != nil {
+		t.Fatal(err)
+	}
+
+	f := New(client, Options{RemovePaths: removePaths(t, "secret.txt")})
+	if _, err := f.Run([]store.Ref{{Name: "refs/heads/main", Hash: tip}}); err != nil {
+		t.Fatal(err)
+	}
+	newBoundary := f.CommitMap()[string(boundary)]
+	if newBoundary == nil || bytes.Equal(newBoundary, boundary) {
+		t.Fatalf("boundary commit was not rewritten: %s", newBoundary)
+	}
+	if got := getCommit(t, client, newBoundary).Parents; !sameHashes(got, []sha.SHA1{missing}) {
+		t.Errorf("boundary parents = %v, want %s", got, missing)
+	}
+	if got := getCommit(t, client, f.CommitMap()[string(tip)]).Parents; !sameHashes(got, []sha.SHA1{newBoundary}) {
+		t.Errorf("tip parents = %v, want %s", got, newBoundary)
+	}
+}
@@ -5,4 +5,5 @@ go 1.16
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/spf13/cobra v1.6.1
+	github.com/spf13/pflag v1.0.5
 )
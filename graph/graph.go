@@ -0,0 +1,98 @@
+// Package graphはlog --graphと同じ形でコミットの祖先関係を文字で描く.
+package graph
+
+import (
+	"strings"
+
+	"github.com/kanon1343/fsegit/object"
+)
+
+// Graphはコミットの左に描く祖先関係の線を組み立てる.
+// 各列は次に現れるのを待っているコミットを表し、コミットを表示するとその列を親に置き換える.
+type Graph struct {
+	columns []string
+}
+
+// Nextはcommitの行の前置き、コミットの残りの行の前置き、親の列へつなぐ線の行を返し、列をcommitの親に進める.
+func (g *Graph) Next(commit *object.Commit) (row, padding string, transition []string) {
+	hash := string(commit.Hash)
+	idx := indexOfColumn(g.columns, hash)
+	if idx < 0 {
+		g.columns = append(g.columns, hash)
+		idx = len(g.columns) - 1
+	}
+
+	rowChars := make([]string, len(g.columns))
+	paddingChars := make([]string, len(g.columns))
+	for i := range g.columns {
+		rowChars[i], paddingChars[i] = "|", "|"
+	}
+	rowChars[idx] = "*"
+	if len(commit.Parents) == 0 {
+		paddingChars[idx] = " "
+	}
+
+	// commitの列を、まだどの列にもない親で置き換える. 既に列のある親へは線を寄せる.
+	newColumns := append([]string{}, g.columns[:idx]...)
+	for _, parent := range commit.Parents {
+		if indexOfColumn(g.columns, string(parent)) < 0 && indexOfColumn(newColumns[idx:], string(parent)) < 0 {
+			newColumns = append(newColumns, string(parent))
+		}
+	}
+	newColumns = append(newColumns, g.columns[idx+1:]...)
+
+	type edge struct{ pos, target int }
+	var edges []edge
+	for i, column := range g.columns {
+		if i != idx {
+			edges = append(edges, edge{i, indexOfColumn(newColumns, column)})
+			continue
+		}
+		for _, parent := range commit.Parents {
+			edges = append(edges, edge{i, indexOfColumn(newColumns, string(parent))})
+		}
+	}
+	width := len(g.columns)
+	if len(newColumns) > width {
+		width = len(newColumns)
+	}
+	// 全ての線が行き先の列に着くまで、1行に1列ずつ斜めに動かす.
+	for {
+		moving := false
+		for _, e := range edges {
+			if e.pos != e.target {
+				moving = true
+			}
+		}
+		if !moving {
+			break
+		}
+		line := []byte(strings.Repeat(" ", 2*width))
+		for i := range edges {
+			e := &edges[i]
+			switch {
+			case e.pos == e.target:
+				line[2*e.pos] = '|'
+			case e.pos < e.target:
+				line[2*e.pos+1] = '\\'
+				e.pos++
+			default:
+				line[2*e.pos-1] = '/'
+				e.pos--
+			}
+		}
+		transition = append(transition, strings.TrimRight(string(line), " "))
+	}
+
+	g.columns = newColumns
+	return strings.Join(rowChars, " "), strings.Join(paddingChars, " "), transition
+}
+
+func indexOfColumn(columns []string, hash string) int {
+	for i, column := range columns {
+		if column == hash {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,38 @@
+package graph
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+)
+
+// 分かれてマージした履歴を、log --graphと同じ線で描くか
+func TestGraph(t *testing.T) {
+	hash := func(name string) sha.SHA1 { return sha.SHA1(strings.Repeat(name, 20)) }
+	commits := []*object.Commit{
+		{Hash: hash("m"), Parents: []sha.SHA1{hash("l"), hash("r")}},
+		{Hash: hash("r"), Parents: []sha.SHA1{hash("b")}},
+		{Hash: hash("l"), Parents: []sha.SHA1{hash("b")}},
+		{Hash: hash("b")},
+	}
+	var lines []string
+	g := &Graph{}
+	for _, commit := range commits {
+		row, padding, transition := g.Next(commit)
+		lines = append(lines, row+" "+string(commit.Hash[:1]), padding)
+		lines = append(lines, transition...)
+	}
+	want := []string{
+		"* m", "|",
+		"|\\",
+		"| * r", "| |",
+		"* | l", "| |",
+		"|/",
+		"* b", " ",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Graph =\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+}
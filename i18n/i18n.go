@@ -0,0 +1,92 @@
+// Package i18nはコマンドやエラーのメッセージを利用者の言語(英語/日本語)で出力する.
+//
+// メッセージは英語の書式文字列をキーとして翻訳表から引く. 翻訳がなければ英語のまま出力する.
+package i18n
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Languageはメッセージの言語.
+type Language int
+
+const (
+	English Language = iota
+	Japanese
+)
+
+var current = Detect()
+
+// catalogsは言語ごとの翻訳表. 英語はキーそのものを使う.
+var catalogs = map[Language]map[string]string{
+	Japanese: japanese,
+}
+
+// Detectは環境変数FSEGIT_LANG, LC_ALL, LC_MESSAGES, LANGの順に見て言語を決める.
+func Detect() Language {
+	for _, name := range []string{"FSEGIT_LANG", "LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := os.Getenv(name); value != "" {
+			return ParseLanguage(value)
+		}
+	}
+	return English
+}
+
+// ParseLanguageは"ja_JP.UTF-8"や"en"のようなロケール名を言語に変換する.
+// 対応していない言語は英語として扱う.
+func ParseLanguage(value string) Language {
+	if strings.HasPrefix(strings.ToLower(value), "ja") {
+		return Japanese
+	}
+	return English
+}
+
+// SetLanguageは出力する言語を切り替える.
+func SetLanguage(lang Language) {
+	current = lang
+}
+
+// CurrentLanguageは現在の言語を返す.
+func CurrentLanguage() Language {
+	return current
+}
+
+// Tはmessageを現在の言語に翻訳する.
+func T(message string) string {
+	if translated, ok := catalogs[current][message]; ok {
+		return translated
+	}
+	return message
+}
+
+// Sprintfはformatを翻訳してからfmt.Sprintfを適用する.
+func Sprintf(format string, args ...interface{}) string {
+	return fmt.Sprintf(T(format), args...)
+}
+
+// Errorfはformatを翻訳してからfmt.Errorfを適用する. %wによるラップはそのまま使える.
+func Errorf(format string, args ...interface{}) error {
+	return fmt.Errorf(T(format), args...)
+}
+
+// ErrorMessageはerrのメッセージを翻訳して返す.
+// パッケージのエラーは"<ErrX> : <詳細>"の形でラップされているので、最も内側のエラーの文言だけを置き換える.
+func ErrorMessage(err error) string {
+	message := err.Error()
+	inner := err
+	for {
+		next := errors.Unwrap(inner)
+		if next == nil {
+			break
+		}
+		inner = next
+	}
+	base := inner.Error()
+	if translated := T(base); translated != base && strings.HasPrefix(message, base) {
+		return translated + message[len(base):]
+	}
+	return T(message)
+}
@@ -0,0 +1,95 @@
+package i18n
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+// setEnvはenvの環境変数を設定し、空の値は消す. テストの終わりに元の値に戻す.
+func setEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+	for name, value := range env {
+		old, ok := os.LookupEnv(name)
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(name, old)
+			} else {
+				os.Unsetenv(name)
+			}
+		})
+		if value == "" {
+			os.Unsetenv(name)
+		} else {
+			os.Setenv(name, value)
+		}
+	}
+}
+
+// useLanguageは言語をlangに切り替え、テストの終わりに元に戻す.
+func useLanguage(t *testing.T, lang Language) {
+	t.Helper()
+	old := CurrentLanguage()
+	t.Cleanup(func() { SetLanguage(old) })
+	SetLanguage(lang)
+}
+
+// FSEGIT_LANG, LC_ALL, LC_MESSAGES, LANGの順に、最初に設定されているものから言語を決めるか
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		fsegitLang, lcAll, lcMessages, lang string
+		want                                Language
+	}{
+		{"", "", "", "", English},
+		{"", "", "", "ja_JP.UTF-8", Japanese},
+		{"", "", "", "en_US.UTF-8", English},
+		{"", "", "", "C", English},
+		{"", "", "ja_JP.UTF-8", "en_US.UTF-8", Japanese},
+		{"", "", "en_US.UTF-8", "ja_JP.UTF-8", English},
+		{"", "ja_JP.UTF-8", "en_US.UTF-8", "en_US.UTF-8", Japanese},
+		{"", "C", "ja_JP.UTF-8", "ja_JP.UTF-8", English},
+		{"ja", "C", "C", "C", Japanese},
+		{"en", "ja_JP.UTF-8", "ja_JP.UTF-8", "ja_JP.UTF-8", English},
+	}
+	for _, test := range tests {
+		setEnv(t, map[string]string{
+			"FSEGIT_LANG": test.fsegitLang,
+			"LC_ALL":      test.lcAll,
+			"LC_MESSAGES": test.lcMessages,
+			"LANG":        test.lang,
+		})
+		if got := Detect(); got != test.want {
+			t.Errorf("Detect() with FSEGIT_LANG=%q LC_ALL=%q LC_MESSAGES=%q LANG=%q = %v, want %v",
+				test.fsegitLang, test.lcAll, test.lcMessages, test.lang, got, test.want)
+		}
+	}
+}
+
+// 翻訳表にないメッセージは英語のまま出力するか
+func TestSprintf_Fallback(t *testing.T) {
+	useLanguage(t, Japanese)
+	if got, want := Sprintf("error: %s", "x"), "エラー: x"; got != want {
+		t.Errorf("Sprintf(translated) = %q, want %q", got, want)
+	}
+	if got, want := Sprintf("no translation for %s", "x"), "no translation for x"; got != want {
+		t.Errorf("Sprintf(missing key) = %q, want %q", got, want)
+	}
+
+	SetLanguage(English)
+	if got, want := Sprintf("error: %s", "x"), "error: x"; got != want {
+		t.Errorf("Sprintf in English = %q, want %q", got, want)
+	}
+}
+
+// Errorfの%wでラップしたエラーをerrors.Isで判定でき、ErrorMessageは内側のエラーの文言だけを翻訳するか
+func TestErrorf_Wrap(t *testing.T) {
+	useLanguage(t, Japanese)
+	errInvalid := errors.New("invalid object")
+	err := Errorf("%w : %s", errInvalid, "abc")
+	if !errors.Is(err, errInvalid) {
+		t.Errorf("errors.Is(%v, errInvalid) = false", err)
+	}
+	if got, want := ErrorMessage(err), "不正なオブジェクトです : abc"; got != want {
+		t.Errorf("ErrorMessage() = %q, want %q", got, want)
+	}
+}
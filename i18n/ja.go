@@ -0,0 +1,269 @@
+package i18n
+
+// japaneseは日本語の翻訳表.
+var japanese = map[string]string{
+	// cmd
+	"error: %s":                                              "エラー: %s",
+	"cannot change to '%s': not a directory":                 "'%s' に移動できません: ディレクトリではありません",
+	"no revisions to export":                                 "エクスポートするリビジョンがありません",
+	"no revisions to list":                                   "一覧にするリビジョンがありません",
+	"invalid --path-rename %q: expected <old>:<new>":         "--path-rename の値 %q が不正です: <旧>:<新> の形式で指定してください",
+	"invalid --email-rewrite %q: expected <old>:<new>":       "--email-rewrite の値 %q が不正です: <旧>:<新> の形式で指定してください",
+	"your current branch '%s' does not have any commits yet": "現在のブランチ '%s' にはまだコミットがありません",
+	"'%s' is outside repository":                             "'%s' はリポジトリの外にあります",
+	"pathspec '%s' did not match any files":                  "pathspec '%s' に一致するファイルがありません",
+	"aborting commit due to empty commit message":            "コミットメッセージが空なのでコミットを中止します",
+	"Initialized empty fsegit repository in %s/":             "空のfsegitリポジトリを %s/ に作成しました",
+	"Reinitialized existing fsegit repository in %s/":        "既存のfsegitリポジトリ %s/ を初期化し直しました",
+	"HEAD detached at %s":                                    "HEADは %s で切り離されています",
+	"On branch %s":                                           "ブランチ %s",
+	"You have unmerged paths.":                               "マージされていないパスがあります.",
+	"All conflicts fixed but you are still merging.":         "全てのコンフリクトは解決されましたが、まだマージ中です.",
+	"No commits yet":                                         "まだコミットがありません",
+	"new file:":                                              "新規:",
+	"modified:":                                              "変更:",
+	"deleted:":                                               "削除:",
+	"unmerged:":                                              "未マージ:",
+	"Changes to be committed:":                               "コミット予定の変更:",
+	"Unmerged paths:":                                        "マージされていないパス:",
+	"Changes not staged for commit:":                         "ステージされていない変更:",
+	"Untracked files:":                                       "追跡されていないファイル:",
+	"nothing to commit, working tree clean":                  "コミットするものはありません. 作業ツリーはクリーンです",
+	"nothing added to commit but untracked files present":    "コミットするものはありませんが、追跡されていないファイルがあります",
+	"no changes added to commit":                             "コミットする変更がステージされていません",
+	"HEAD is now at %s %s":                                   "HEADは %s %s を指しています",
+	"Unstaged changes after reset:":                          "リセット後のステージされていない変更:",
+	"--soft, --mixed and --hard cannot be used together":     "--soft、--mixed、--hardは同時に指定できません",
+	"-m and -F cannot be used together":                      "-mと-Fは同時に指定できません",
+	"there was a problem with the editor '%s': %v":           "エディタ '%s' で問題が発生しました: %v",
+	"you have nothing to amend":                              "修正するコミットがありません",
+	"you are in the middle of a merge -- cannot amend":       "マージの途中なのでコミットを修正できません",
+	"more than one tree requires -m":                         "複数のツリーを読むには-mが必要です",
+	"No local changes to save":                               "退避する変更がありません",
+	"Saved working directory and index state %s":             "作業ツリーとインデックスの状態を退避しました: %s",
+	"The stash entry is kept in case you need it again.":     "退避したエントリは後で使えるように残してあります.",
+	"Dropped stash@{%d} (%s)":                                "stash@{%d} を取り除きました (%s)",
+	"Already on '%s'":                                        "既に '%s' にいます",
+	"Switched to branch '%s'":                                "ブランチ '%s' に切り替えました",
+	"Warning: you are leaving %d commit(s) behind, not connected to any of your branches:": "警告: どのブランチからも辿れない %d 個のコミットを残して移動します:",
+	"branch name required":                                               "ブランチ名を指定してください",
+	"Deleted branch %s (was %s).":                                        "ブランチ %s を削除しました (%s を指していました).",
+	"cannot rename the current branch while not on any":                  "どのブランチにもいないので現在のブランチの名前を変えられません",
+	"too many arguments for a rename operation":                          "名前の変更には引数が多すぎます",
+	"too many arguments":                                                 "引数が多すぎます",
+	"wrong number of arguments":                                          "引数の数が違います",
+	"(HEAD detached at %s)":                                              "(HEADは %s で切り離されています)",
+	"refusing to point %s outside of refs/: %s":                          "%s を refs/ の外 (%s) に向けることはできません",
+	"not removing '%s' recursively without -r":                           "-r なしでは '%s' を再帰的に削除しません",
+	"'%s' has staged content different from both the file and the HEAD":  "'%s' にはファイルともHEADとも異なる内容がステージされています",
+	"'%s' has local modifications":                                       "'%s' には手元の変更があります",
+	"'%s' has changes staged in the index":                               "'%s' にはステージされた変更があります",
+	"Please enter the commit message for your changes. Lines starting":   "変更のコミットメッセージを入力してください. '#'で始まる行は無視され、",
+	"with '#' will be ignored, and an empty message aborts the commit.":  "空のメッセージはコミットを中止します.",
+	"only one of -t, -s, -p and -e can be used with a single object":     "-t, -s, -p, -e はどれか1つだけを1つのオブジェクトに対して指定してください",
+	"object %s is a %s, not a %s":                                        "オブジェクト %s は %s で、%s ではありません",
+	"Nothing to pack":                                                    "パックするオブジェクトがありません",
+	"Packed %d objects (%d deltas) into %s":                              "%d 個のオブジェクト (デルタ %d 個) を %s にまとめました",
+	"Removed %d loose objects":                                           "%d 個のルースオブジェクトを削除しました",
+	"Wrote commit-graph with %d commits":                                 "%d 個のコミットでコミットグラフを書き込みました",
+	"destination path '%s' already exists and is not an empty directory": "移動先のパス '%s' は既に存在し、空のディレクトリではありません",
+	"Cloning into bare repository '%s'...":                               "ベアリポジトリ '%s' にクローンしています...",
+	"Cloning into '%s'...":                                               "'%s' にクローンしています...",
+	"warning: You appear to have cloned an empty repository.":            "警告: 空のリポジトリをクローンしたようです.",
+	"warning: remote HEAD refers to nonexistent ref, unable to checkout": "警告: リモートのHEADが存在しない参照を指しているのでチェックアウトできません",
+	"Remote branch %s not found in upstream %s":                          "リモートのブランチ %s が上流の %s に見つかりません",
+	"exactly one file must be given after --":                            "-- の後にはファイルを1つだけ指定してください",
+	"From %s":                            "%s から",
+	"[new tag]":                          "[新しいタグ]",
+	"[new branch]":                       "[新しいブランチ]",
+	"[new ref]":                          "[新しい参照]",
+	"(forced update)":                    "(強制更新)",
+	"[rejected]":                         "[拒否]",
+	"(non-fast-forward)":                 "(早送りではありません)",
+	"depth %d is not a positive number":  "深さ %d は正の数ではありません",
+	"Binary file %s matches":             "バイナリファイル %s がマッチしました",
+	"You are not currently on a branch.": "現在どのブランチにもいません.",
+	"unable to delete '%s': remote ref does not exist": "'%s' を削除できません: リモートの参照が存在しません",
+	"(remote does not support deleting refs)":          "(リモートが参照の削除に対応していません)",
+	"(fetch first)":                           "(先に fetch してください)",
+	"remote unpack failed: %s":                "リモートでのパックの展開に失敗しました: %s",
+	"[remote rejected]":                       "[リモートが拒否]",
+	"Everything up-to-date":                   "すべて最新です",
+	"To %s":                                   "%s へ",
+	"invalid refspec '%s'":                    "refspec '%s' が不正です",
+	"src refspec %s does not match any":       "送信元の refspec %s に一致するものがありません",
+	"[deleted]":                               "[削除]",
+	"[new reference]":                         "[新しい参照]",
+	"only one config file at a time":          "設定ファイルは1つだけ指定してください",
+	"only one action at a time":               "操作は1つだけ指定してください",
+	"wrong number of arguments, should be %d": "引数の数が違います. %d 個必要です",
+	"%s has multiple values":                  "%s には複数の値があります",
+	"cannot overwrite multiple values with a single value": "複数の値を1つの値で上書きすることはできません",
+	"$HOME not set": "$HOME が設定されていません",
+	"\n*** Please tell me who you are.\n\nRun\n\n  fsegit config --global user.email \"you@example.com\"\n  fsegit config --global user.name \"Your Name\"\n\nto set your account's default identity.\nOmit --global to set the identity only in this repository.\n": "\n*** あなたが誰なのかを設定してください.\n\n次のコマンドで\n\n  fsegit config --global user.email \"you@example.com\"\n  fsegit config --global user.name \"Your Name\"\n\nアカウントの既定の名前とメールアドレスを設定できます.\nこのリポジトリだけで使うには --global を付けずに実行してください.\n",
+	"tag name required":                           "タグ名を指定してください",
+	"Deleted tag '%s' (was %s)":                   "タグ '%s' を削除しました (%s でした)",
+	"no tag message given; use -m":                "タグのメッセージがありません. -m で指定してください",
+	"Updated tag '%s' (was %s)":                   "タグ '%s' を更新しました (%s でした)",
+	"upstream required":                           "upstream を指定してください",
+	"cannot rebase: you have uncommitted changes": "rebase できません: コミットしていない変更があります",
+	"Current branch %s is up to date.":            "現在のブランチ %s は最新です.",
+	"Successfully rebased and updated %s.":        "rebase が完了し、%s を更新しました.",
+	"CONFLICT (%s): Merge conflict in %s":         "コンフリクト (%s): %s でマージがコンフリクトしました",
+	"error: could not apply %s... %s":             "error: %s... %s を適用できませんでした",
+	"hint: Resolve all conflicts manually, mark them as resolved with\nhint: \"fsegit add <pathspec>\", then run \"fsegit rebase --continue\".\nhint: You can instead skip this commit: run \"fsegit rebase --skip\".\nhint: To abort and get back to the state before \"fsegit rebase\", run \"fsegit rebase --abort\".\n": "hint: 全てのコンフリクトを手で解決し、\"fsegit add <pathspec>\" で解決済みにしてから\nhint: \"fsegit rebase --continue\" を実行してください.\nhint: このコミットを飛ばすには \"fsegit rebase --skip\" を実行してください.\nhint: \"fsegit rebase\" を始める前の状態に戻すには \"fsegit rebase --abort\" を実行してください.\n",
+	"you must edit all merge conflicts and then mark them as resolved using fsegit add": "全てのコンフリクトを解決し、fsegit add で解決済みにしてください",
+	"no rebase in progress":                                            "進行中の rebase はありません",
+	"needed a single revision":                                         "リビジョンを1つだけ指定してください",
+	"nothing specified, nothing added":                                 "何も指定されていないので、何も追加しません",
+	"-A and -u are mutually incompatible":                              "-Aと-uは同時に指定できません",
+	"The following paths are ignored by one of your .gitignore files:": "以下のパスは .gitignore などで無視されています:",
+	"hint: Use -f if you really want to add them.\n":                   "hint: それでも追加するには -f を指定してください.\n",
+	"invalid size %q":                                                  "サイズ %q が不正です",
+
+	"cannot revert: your index contains uncommitted changes": "revert できません: インデックスにコミットしていない変更があります",
+	"commit %s is a merge but no -m option was given":        "コミット %s はマージですが、-m が指定されていません",
+	"mainline was specified but commit %s is not a merge":    "-m が指定されましたが、コミット %s はマージではありません",
+	"commit %s does not have parent %d":                      "コミット %s には親 %d がありません",
+	"commit required":                                        "コミットを指定してください",
+	"error: could not revert %s... %s":                       "error: %s... %s を取り消せませんでした",
+	"no revert in progress":                                  "進行中の revert はありません",
+	"no valid patches in input":                              "入力に有効なパッチがありません",
+	"hint: Resolve all conflicts manually, mark them as resolved with\nhint: \"fsegit add <pathspec>\", then run \"fsegit revert --continue\".\nhint: You can instead skip this commit: run \"fsegit revert --skip\".\nhint: To abort and get back to the state before \"fsegit revert\", run \"fsegit revert --abort\".\n": "hint: 全てのコンフリクトを手で解決し、\"fsegit add <pathspec>\" で解決済みにしてから\nhint: \"fsegit revert --continue\" を実行してください.\nhint: このコミットを飛ばすには \"fsegit revert --skip\" を実行してください.\nhint: \"fsegit revert\" を始める前の状態に戻すには \"fsegit revert --abort\" を実行してください.\n",
+
+	"cannot apply patches: your index or working tree contains uncommitted changes": "パッチを適用できません: インデックスか作業ツリーにコミットしていない変更があります",
+	"--cached and --index cannot be used together":                                  "--cachedと--indexは同時に指定できません",
+	"Patch failed at %04d %s":                                                       "パッチ %04d %s の適用に失敗しました",
+	"invalid From header %q":                                                        "不正なFromヘッダです: %q",
+	"invalid Date header %q":                                                        "不正なDateヘッダです: %q",
+	"patch is empty: %s":                                                            "パッチが空です: %s",
+	"Applying: %s":                                                                  "適用しています: %s",
+
+	"invalid rename score %q": "不正な類似度です: %q",
+	"renamed:":                "名前変更:",
+
+	"--follow requires exactly one pathspec": "--followにはパスを1つだけ指定してください",
+
+	"invalid --word-diff mode %q": "不正な--word-diffのモードです: %q",
+
+	"Bisecting: %d revision(s) left to test after this (roughly %d step(s))": "二分探索中: これを調べた後に残るリビジョンは%d個です(あと約%d手順)",
+	"status: waiting for bad commit, %d good commit(s) known":                "状態: 悪いコミットを待っています. 良いコミットは%d個分かっています",
+	"status: waiting for good commit(s), bad commit known":                   "状態: 良いコミットを待っています. 悪いコミットは分かっています",
+	"status: waiting for both good and bad commits":                          "状態: 良いコミットと悪いコミットを待っています",
+	"%s is the first bad commit":                                             "%s が最初の悪いコミットです",
+
+	"no note message given; use -m": "ノートのメッセージがありません. -mで指定してください",
+
+	"warning: ignoring ref with broken name %s": "警告: 不正な名前の参照 %s を無視します",
+
+	"nothing to commit: the changes of %s... %s have already been reverted": "コミットするものがありません: %s... %s の変更は既に取り消されています",
+
+	// object
+	"invalid object":        "不正なオブジェクトです",
+	"object too large":      "オブジェクトが大きすぎます",
+	"not commit object":     "コミットオブジェクトではありません",
+	"invalid commit object": "不正なコミットオブジェクトです",
+	"not tree object":       "ツリーオブジェクトではありません",
+	"invalid tree object":   "不正なツリーオブジェクトです",
+	"not tag object":        "タグオブジェクトではありません",
+	"invalid tag object":    "不正なタグオブジェクトです",
+
+	// diff
+	"invalid patch":        "不正なパッチです",
+	"patch does not apply": "パッチを適用できません",
+
+	// color
+	"invalid color setting": "不正な色の設定です",
+
+	// store
+	"ref not found":                 "参照が見つかりません",
+	"invalid ref":                   "不正な参照です",
+	"symbolic ref nesting too deep": "シンボリック参照のネストが深すぎます",
+	"current branch does not have any commits yet":        "現在のブランチにはまだコミットがありません",
+	"invalid index file":                                  "不正なインデックスファイルです",
+	"you have unmerged paths":                             "マージされていないパスがあります",
+	"this operation must be run in a work tree":           "この操作は作業ツリーの中で実行する必要があります",
+	"your local changes would be overwritten by checkout": "チェックアウトすると手元の変更が上書きされます",
+	"not a symbolic ref":                                  "シンボリック参照ではありません",
+	"invalid ref name":                                    "参照の名前が不正です",
+	"branch already exists":                               "ブランチは既に存在します",
+	"tag already exists":                                  "タグは既に存在します",
+	"branch is not fully merged":                          "ブランチが完全にはマージされていません",
+	"cannot delete the branch which you are currently on": "現在いるブランチは削除できません",
+	"no such remote":                                      "そのようなリモートはありません",
+	"remote already exists":                               "リモートは既に存在します",
+	"identity unknown":                                    "名前かメールアドレスが分かりません",
+	"invalid date format":                                 "日時の形式が不正です",
+	"path is used both as a file and a directory":         "パスがファイルとディレクトリの両方に使われています",
+	"tree nesting too deep":                               "ツリーのネストが深すぎます",
+	"object not found":                                    "オブジェクトが見つかりません",
+	"short object ID is ambiguous":                        "短縮したオブジェクトIDが曖昧です",
+	"reflog does not exist":                               "reflogがありません",
+	"invalid reflog entry":                                "不正なreflogの行です",
+	"reflog is too short":                                 "reflogが短すぎます",
+	"cannot do a soft reset in the middle of a merge":     "マージの途中ではsoftリセットはできません",
+	"no stash entries found":                              "退避したエントリがありません",
+	"not a stash reference":                               "退避したエントリではありません",
+	"ref has been changed":                                "参照が変更されています",
+	"object size does not match":                          "オブジェクトのサイズが一致しません",
+	"no such path in the commit":                          "コミットにそのパスはありません",
+	"failed to sign the data":                             "データに署名できませんでした",
+	"no signature found":                                  "署名がありません",
+	"bad signature":                                       "署名が正しくありません",
+	"no tags can describe the commit":                     "コミットを表せるタグがありません",
+	"no note found for object":                            "オブジェクトにノートがありません",
+	"note already exists for object":                      "オブジェクトには既にノートがあります",
+	"refusing to write inside the admin directory":        "管理ディレクトリの中には書き込めません",
+
+	// repo
+	"nothing to commit": "コミットする変更がありません",
+
+	// revparse
+	"unknown revision":                 "不明なリビジョンです",
+	"invalid revision":                 "不正なリビジョンです",
+	"commit does not have that parent": "コミットにその親はありません",
+	"path does not exist in tree":      "パスがツリーにありません",
+
+	// pack
+	"invalid pack file":        "不正なパックファイルです",
+	"invalid pack index":       "不正なパックの索引です",
+	"object not found in pack": "パックにオブジェクトが見つかりません",
+	"invalid delta":            "不正なデルタです",
+	"invalid pack bitmap":      "不正なパックのビットマップです",
+
+	// commitgraph
+	"invalid commit-graph file":         "不正なコミットグラフファイルです",
+	"parent is not in the commit-graph": "親がコミットグラフにありません",
+
+	// transport
+	"invalid pkt-line": "不正なpkt-lineです",
+	"remote error":     "リモートのエラー",
+	"server does not support the smart HTTP protocol": "サーバーがsmart HTTPプロトコルに対応していません",
+	"unexpected HTTP status":                          "予期しないHTTPステータスです",
+	"repository not found":                            "リポジトリが見つかりません",
+	"server does not support shallow clients":         "サーバーが浅い履歴に対応していません",
+
+	// util
+	"not git repository": "gitリポジトリではありません",
+
+	// config
+	"invalid config": "不正な設定ファイルです",
+
+	// pathspec
+	"unknown pathspec magic":         "不明なpathspecのマジックです",
+	"pathspec is outside repository": "pathspecがリポジトリの外を指しています",
+	"invalid pathspec":               "不正なpathspecです",
+
+	// sequencer
+	"a cherry-pick, revert or rebase is already in progress": "cherry-pick、revert、rebaseのいずれかが既に進行中です",
+	"no cherry-pick, revert or rebase in progress":           "進行中のcherry-pick、revert、rebaseはありません",
+	"invalid todo list": "不正なtodoリストです",
+
+	// bisect
+	"the bad commit is an ancestor of a good commit": "悪いコミットが良いコミットの祖先です",
+	"not bisecting":        "二分探索中ではありません",
+	"invalid bisect state": "不正な二分探索の状態です",
+
+	// archive
+	"unknown archive format": "不明なアーカイブ形式です",
+}
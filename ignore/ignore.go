@@ -0,0 +1,118 @@
+// Package ignoreは.gitignoreと.fsegitignoreの読み込みと、パスを無視するかの判定を行う.
+package ignore
+
+import (
+	"bufio"
+	"bytes"
+	"path"
+	"strings"
+
+	"github.com/kanon1343/fsegit/wildmatch"
+)
+
+// FileNamesは作業ツリーの各ディレクトリで読む無視ファイルの名前. 後にあるものの規則ほど優先される.
+var FileNames = []string{".gitignore", ".fsegitignore"}
+
+type pattern struct {
+	// dirは無視ファイルが置かれたディレクトリ. info/excludeなどリポジトリ全体の規則は空.
+	dir     string
+	pattern string
+	// negateは"!"で始まり、前の規則で無視したパスを無視しないことにする.
+	negate bool
+	// basenameOnlyは"/"を含まないパターンで、どの階層でもファイル名だけに照合する.
+	basenameOnly bool
+	dirOnly      bool
+}
+
+// Matcherは複数の無視ファイルの規則をまとめて保持する.
+type Matcher struct {
+	patterns []pattern
+	flags    wildmatch.Flag
+}
+
+// NewMatcherは空のMatcherを返す. ignoreCaseがtrueなら大文字と小文字を区別しない(core.ignorecase).
+func NewMatcher(ignoreCase bool) *Matcher {
+	m := &Matcher{}
+	if ignoreCase {
+		m.flags = wildmatch.CaseFold
+	}
+	return m
+}
+
+// Addはdirに置かれた無視ファイルの内容を追加する. 後から追加した規則ほど優先されるので、
+// core.excludesFile、info/exclude、浅いディレクトリの無視ファイルの順に追加する.
+func (m *Matcher) Add(dir string, data []byte) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := trimTrailingSpaces(strings.TrimSuffix(scanner.Text(), "\r"))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p := pattern{dir: strings.Trim(dir, "/")}
+		// "\!"や"\#"で始まるパターンはwildmatchがエスケープとして扱う.
+		if strings.HasPrefix(line, "!") {
+			p.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			p.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		p.basenameOnly = !strings.Contains(line, "/")
+		p.pattern = strings.TrimPrefix(line, "/")
+		m.patterns = append(m.patterns, p)
+	}
+}
+
+// trimTrailingSpacesは行末の空白を取り除く. "\"でエスケープした空白はエスケープごと残す.
+func trimTrailingSpaces(line string) string {
+	end := len(line)
+	for end > 0 && line[end-1] == ' ' {
+		if end >= 2 && line[end-2] == '\\' {
+			break
+		}
+		end--
+	}
+	return line[:end]
+}
+
+// Ignoredはnameを無視するかを返す. isDirはnameがディレクトリかどうか.
+// gitと同じく、親のディレクトリが無視されていれば、中のパスは"!"の規則に関係なく無視する.
+func (m *Matcher) Ignored(name string, isDir bool) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] == '/' && m.match(name[:i], true) {
+			return true
+		}
+	}
+	return m.match(name, isDir)
+}
+
+// matchは親のディレクトリを見ずに、nameに最後にマッチした規則で無視するかを決める.
+func (m *Matcher) match(name string, isDir bool) bool {
+	for i := len(m.patterns) - 1; i >= 0; i-- {
+		if m.patterns[i].match(name, isDir, m.flags) {
+			return !m.patterns[i].negate
+		}
+	}
+	return false
+}
+
+func (p pattern) match(name string, isDir bool, flags wildmatch.Flag) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	relative := name
+	if p.dir != "" {
+		if !strings.HasPrefix(name, p.dir+"/") {
+			return false
+		}
+		relative = name[len(p.dir)+1:]
+	}
+	if p.basenameOnly {
+		return wildmatch.Match(p.pattern, path.Base(relative), flags)
+	}
+	return wildmatch.Match(p.pattern, relative, flags|wildmatch.Pathname)
+}
@@ -0,0 +1,76 @@
+package ignore
+
+import "testing"
+
+func TestMatcher_Ignored(t *testing.T) {
+	m := NewMatcher(false)
+	m.Add("", []byte("# コメント\n*.log\n!keep.log\nbuild/\n/top.txt\ndoc/**/*.pdf\n\\#hash\nspace\\ \ntrail   \n"))
+	m.Add("sub", []byte("*.tmp\n/local\n!important.log\n"))
+
+	tests := []struct {
+		name  string
+		isDir bool
+		want  bool
+	}{
+		{"a.log", false, true},
+		{"dir/a.log", false, true},
+		{"keep.log", false, false},
+		{"dir/keep.log", false, false},
+		{"build", true, true},
+		{"build", false, false},
+		{"src/build", true, true},
+		{"build/x.c", false, true},
+		{"top.txt", false, true},
+		{"dir/top.txt", false, false},
+		{"doc/a.pdf", false, true},
+		{"doc/x/y/a.pdf", false, true},
+		{"other/doc/a.pdf", false, false},
+		{"#hash", false, true},
+		{"# コメント", false, false},
+		{"space ", false, true},
+		{"space", false, false},
+		{"trail", false, true},
+		{"sub/a.tmp", false, true},
+		{"a.tmp", false, false},
+		{"sub/local", false, true},
+		{"sub/x/local", false, false},
+		{"sub/important.log", false, false},
+		{"important.log", false, true},
+	}
+	for _, tt := range tests {
+		if got := m.Ignored(tt.name, tt.isDir); got != tt.want {
+			t.Errorf("Ignored(%q, %v) = %v, want %v", tt.name, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestMatcher_IgnoredParent(t *testing.T) {
+	m := NewMatcher(false)
+	// 親のディレクトリが無視されていると、中のファイルは"!"でも取り戻せない.
+	m.Add("", []byte("out/\n!out/keep\n"))
+	if !m.Ignored("out/keep", false) {
+		t.Errorf("out/keep should be ignored")
+	}
+	// ディレクトリ自体でなく中身を無視していれば、"!"で取り戻せる.
+	m = NewMatcher(false)
+	m.Add("", []byte("out/*\n!out/keep\n"))
+	if m.Ignored("out/keep", false) {
+		t.Errorf("out/keep should not be ignored")
+	}
+	if !m.Ignored("out/other", false) {
+		t.Errorf("out/other should be ignored")
+	}
+}
+
+func TestMatcher_IgnoreCase(t *testing.T) {
+	m := NewMatcher(true)
+	m.Add("", []byte("*.LOG\n"))
+	if !m.Ignored("a.log", false) {
+		t.Errorf("a.log should be ignored with ignoreCase")
+	}
+	m = NewMatcher(false)
+	m.Add("", []byte("*.LOG\n"))
+	if m.Ignored("a.log", false) {
+		t.Errorf("a.log should not be ignored without ignoreCase")
+	}
+}
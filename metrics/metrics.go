@@ -0,0 +1,72 @@
+// Package metricsはリポジトリ操作の回数や時間を外部の監視系に渡すためのインターフェースを定義する.
+//
+// ライブラリとして組み込む側はRecorderを実装してstore.Optionsに渡す.
+// PrometheusやOpenTelemetryへの橋渡しはRecorderの実装側で行う.
+package metrics
+
+import (
+	"expvar"
+	"time"
+)
+
+// 記録する値の名前.
+const (
+	// ObjectsReadは読み込んだオブジェクトの数.
+	ObjectsRead = "objects_read"
+	// ObjectsWrittenは新しく書き込んだオブジェクトの数.
+	ObjectsWritten = "objects_written"
+	// BytesDecompressedは展開したオブジェクトのバイト数(ヘッダを含む).
+	BytesDecompressed = "bytes_decompressed"
+	// BytesCompressedは書き込んだオブジェクトの圧縮後のバイト数.
+	BytesCompressed = "bytes_compressed"
+	// ObjectCacheHitsは展開したオブジェクトをキャッシュから返した回数.
+	ObjectCacheHits = "object_cache_hits"
+	// PackLookupsはパックファイルの索引を引いた回数.
+	PackLookups = "pack_lookups"
+	// ObjectReadTimeはオブジェクトの読み込みにかかった時間.
+	ObjectReadTime = "object_read_time"
+	// LockWaitTimeはロックファイルの取得を待った時間.
+	LockWaitTime = "lock_wait_time"
+)
+
+// Recorderはカウンタと所要時間を受け取る. 複数のゴルーチンから同時に呼ばれることがある.
+type Recorder interface {
+	// Addはnameのカウンタにdeltaを足す.
+	Add(name string, delta int64)
+	// Observeはnameの操作にかかった時間を記録する.
+	Observe(name string, d time.Duration)
+}
+
+// Nopは何も記録しないRecorder.
+var Nop Recorder = nopRecorder{}
+
+type nopRecorder struct{}
+
+func (nopRecorder) Add(name string, delta int64)         {}
+func (nopRecorder) Observe(name string, d time.Duration) {}
+
+// Sinceはstartからの経過時間をnameとして記録する. deferと組み合わせて使う.
+func Since(r Recorder, name string, start time.Time) {
+	r.Observe(name, time.Since(start))
+}
+
+// ExpvarRecorderは値をexpvarに公開するRecorder.
+// 時間は"<name>_ns"(合計ナノ秒)と"<name>_count"(回数)の2つのカウンタとして記録する.
+type ExpvarRecorder struct {
+	vars *expvar.Map
+}
+
+// NewExpvarRecorderはexpvarにnameという名前のMapを登録してRecorderを返す.
+// 同じnameで2回呼ぶとexpvarがpanicするので、プロセスで1回だけ呼ぶ.
+func NewExpvarRecorder(name string) *ExpvarRecorder {
+	return &ExpvarRecorder{vars: expvar.NewMap(name)}
+}
+
+func (r *ExpvarRecorder) Add(name string, delta int64) {
+	r.vars.Add(name, delta)
+}
+
+func (r *ExpvarRecorder) Observe(name string, d time.Duration) {
+	r.vars.Add(name+"_ns", int64(d))
+	r.vars.Add(name+"_count", 1)
+}
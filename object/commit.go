@@ -1,13 +1,11 @@
 package object
 
 import (
-	"bufio"
 	"bytes"
 	"crypto/sha1"
 	"encoding/hex"
+	"errors"
 	"fmt"
-	"io"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -20,9 +18,18 @@ type Commit struct {
 	Size      int
 	Tree      sha.SHA1
 	Parents   []sha.SHA1 // mergeのとき複数parentがある場合がある.
-	Author    Sign
-	Committer Sign
-	Message   string
+	Author    Signature
+	Committer Signature
+	// ExtraHeadersはcommitterの後に続くencoding、mergetag、gpgsigなどのヘッダ. 書き戻すときにそのまま残す.
+	ExtraHeaders []ExtraHeader
+	Message      string
+}
+
+// ExtraHeaderはコミットのtree、parent、author、committer以外のヘッダ.
+// 複数行の値は継続行の先頭の空白を除き、改行でつないで持つ.
+type ExtraHeader struct {
+	Key   string
+	Value string
 }
 
 // ターミナル上の表示文字列を返す.
@@ -35,26 +42,57 @@ func (c Commit) String() string {
 	}
 	str += fmt.Sprintln("Author   ", c.Author)
 	str += fmt.Sprintln("Committer", c.Committer)
-	str += fmt.Sprint(c.Message)
+	str += fmt.Sprint(strings.TrimSuffix(c.Message, "\n"))
 	return str
 }
 
-type Sign struct {
-	Name      string
-	Email     string
-	Timestamp time.Time
+// Subjectはコミットメッセージの1行目を返す.
+func (c Commit) Subject() string {
+	return strings.SplitN(strings.TrimLeft(c.Message, "\n"), "\n", 2)[0]
 }
 
-func (s Sign) String() string {
-	return fmt.Sprintf("%s %s %s", s.Name, s.Email, s.Timestamp.String())
+// Encodeはコミットオブジェクトのデータ部分を返す.
+func (c Commit) Encode() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "tree %s\n", c.Tree)
+	for _, parent := range c.Parents {
+		fmt.Fprintf(&buf, "parent %s\n", parent)
+	}
+	fmt.Fprintf(&buf, "author %s\n", c.Author.Encode())
+	fmt.Fprintf(&buf, "committer %s\n", c.Committer.Encode())
+	for _, header := range c.ExtraHeaders {
+		fmt.Fprintf(&buf, "%s %s\n", header.Key, strings.ReplaceAll(header.Value, "\n", "\n "))
+	}
+	buf.WriteString("\n")
+	buf.WriteString(c.Message)
+	return buf.Bytes()
 }
 
-var (
-	emailRegexpString     = "([a-zA-Z0-9_.+-]+@([a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9]*\\.)+[a-zA-Z]{2,})"
-	timestampRegexpString = "([1-9][0-9]* \\+[0-9]{4})"
-	sha1Regexp            = regexp.MustCompile("[0-9a-f]{20}")
-	signRegexp            = regexp.MustCompile("^[^<]* <" + emailRegexpString + "> " + timestampRegexpString + "$")
-)
+// Signatureはコミットの作者やコミッター、タグの作成者の名前、メールアドレスと日時.
+type Signature struct {
+	Name  string
+	Email string
+	When  time.Time
+	// TZはオブジェクトに書かれていたタイムゾーン("+0900"など). "-0000"のようにWhenからは
+	// 復元できない表記も書き戻せるように持っておく. 空ならWhenのタイムゾーンを使う.
+	TZ string
+}
+
+func (s Signature) String() string {
+	return fmt.Sprintf("%s %s %s", s.Name, s.Email, s.When.String())
+}
+
+// Encodeはコミットやタグのヘッダに書かれる"name <email> unixtime +0900"の形式で返す.
+func (s Signature) Encode() string {
+	tz := s.TZ
+	if tz == "" {
+		tz = s.When.Format("-0700")
+	}
+	return fmt.Sprintf("%s <%s> %d %s", s.Name, s.Email, s.When.Unix(), tz)
+}
+
+// maxSignLengthは作者などの行の長さの上限. 不正なオブジェクトで巨大な文字列を扱わないようにする.
+const maxSignLength = 64 * 1024
 
 // NewCommitは*Objectを*Commitに変換して返す
 func NewCommit(o *Object) (*Commit, error) {
@@ -63,103 +101,130 @@ func NewCommit(o *Object) (*Commit, error) {
 	}
 
 	checkSum := sha1.New()
-	b := bytes.NewBuffer(o.Data)
-	tr := io.TeeReader(b, checkSum)
-
 	checkSum.Write(o.Header())
+	checkSum.Write(o.Data)
+	hash := checkSum.Sum(nil)
+	if string(o.Hash) != string(hash) {
+		return nil, fmt.Errorf("%w : hash mismatch", ErrInvalidCommitObject)
+	}
 
 	commit := &Commit{
+		Hash: hash,
 		Size: o.Size,
 	}
 
-	scanner := bufio.NewScanner(tr)
-	for scanner.Scan() {
-		text := scanner.Text()
-		splitText := strings.SplitN(text, " ", 2)
-		if len(splitText) != 2 {
-			break
+	// ヘッダは"<種類> <値>"の行の並び. 空白で始まる行はgpgsigなどの継続行.
+	header, message := splitMessage(o.Data)
+	extra := false
+	for i, line := range strings.Split(header, "\n") {
+		if strings.HasPrefix(line, " ") {
+			if extra {
+				last := &commit.ExtraHeaders[len(commit.ExtraHeaders)-1]
+				last.Value += "\n" + line[1:]
+			}
+			continue
+		}
+		extra = false
+		splitLine := strings.SplitN(line, " ", 2)
+		if len(splitLine) != 2 {
+			return nil, fmt.Errorf("%w : malformed header line %d", ErrInvalidCommitObject, i+1)
 		}
-		lineType := splitText[0]
-		data := splitText[1]
+		lineType := splitLine[0]
+		data := splitLine[1]
 
 		switch lineType {
 		case "tree":
+			if i != 0 {
+				return nil, fmt.Errorf("%w : tree must be the first header", ErrInvalidCommitObject)
+			}
 			tree, err := readHash(data)
 			if err != nil {
-				return nil, err
+				return nil, fmt.Errorf("%w : %s", ErrInvalidCommitObject, err)
 			}
 			commit.Tree = tree
 		case "parent":
 			parent, err := readHash(data)
 			if err != nil {
-				return nil, err
+				return nil, fmt.Errorf("%w : %s", ErrInvalidCommitObject, err)
 			}
 			commit.Parents = append(commit.Parents, parent)
 		case "author":
-			author, err := readSign(data)
+			author, err := ParseSignature(data)
 			if err != nil {
-				return nil, err
+				return nil, fmt.Errorf("%w : %s", ErrInvalidCommitObject, err)
 			}
 			commit.Author = author
 		case "committer":
-			committer, err := readSign(data)
+			committer, err := ParseSignature(data)
 			if err != nil {
-				return nil, err
+				return nil, fmt.Errorf("%w : %s", ErrInvalidCommitObject, err)
 			}
 			commit.Committer = committer
+		default:
+			commit.ExtraHeaders = append(commit.ExtraHeaders, ExtraHeader{Key: lineType, Value: data})
+			extra = true
 		}
 	}
-
-	message := make([]string, 0)
-	for scanner.Scan() {
-		message = append(message, scanner.Text())
-	}
-	commit.Message = strings.Join(message, "\n")
-
-	hash := checkSum.Sum(nil)
-	if string(o.Hash) != string(hash) {
-		return nil, ErrInvalidCommitObject
+	if commit.Tree == nil {
+		return nil, fmt.Errorf("%w : missing tree", ErrInvalidCommitObject)
 	}
-	commit.Hash = hash
+	commit.Message = message
 	return commit, nil
 }
 
-// ハッシュ値を受け取り複合化して返す.
+// readHashは40桁の16進数のハッシュを読む.
 func readHash(hashString string) (sha.SHA1, error) {
-	if ok := sha1Regexp.MatchString(hashString); !ok {
-		return nil, ErrInvalidCommitObject
+	if len(hashString) != 40 {
+		return nil, fmt.Errorf("bad hash %q", hashString)
 	}
 	hash := make(sha.SHA1, 20)
 	if _, err := hex.Decode(hash, []byte(hashString)); err != nil {
-		return nil, fmt.Errorf("%w : %s", ErrInvalidCommitObject, err)
+		return nil, err
 	}
 	return hash, nil
 }
 
-func readSign(signString string) (Sign, error) {
-	if ok := signRegexp.MatchString(signString); !ok {
-		return Sign{}, ErrInvalidCommitObject
+// ParseSignatureは"name <email> unixtime +0900"の形式の行を読む. コミットやタグのヘッダ、reflogの各行で使う.
+// gitと同じく最後の"<"と">"でメールアドレスを区切るので、名前やアドレスの文字は制限しない.
+func ParseSignature(signString string) (Signature, error) {
+	if len(signString) > maxSignLength {
+		return Signature{}, errors.New("ident line too long")
+	}
+	open := strings.LastIndexByte(signString, '<')
+	close := strings.LastIndexByte(signString, '>')
+	if open < 0 || close < open {
+		return Signature{}, fmt.Errorf("bad ident %q", signString)
 	}
-	sign1 := strings.SplitN(signString, " <", 2)
-	name := sign1[0]
-	sign2 := strings.SplitN(sign1[1], "> ", 2)
-	email := sign2[0]
-	sign3 := strings.SplitN(sign2[1], " ", 2)
+	name := strings.TrimSuffix(signString[:open], " ")
+	email := signString[open+1 : close]
 
-	unixTime, err := strconv.ParseInt(sign3[0], 10, 64)
-	if err != nil {
-		return Sign{}, fmt.Errorf("%w : %s", ErrInvalidCommitObject, err)
+	date := strings.Fields(signString[close+1:])
+	if len(date) != 2 {
+		return Signature{}, fmt.Errorf("bad date in ident %q", signString)
+	}
+	unixTime, err := strconv.ParseInt(date[0], 10, 64)
+	if err != nil || unixTime < 0 {
+		return Signature{}, fmt.Errorf("bad timestamp %q", date[0])
+	}
+	zone := date[1]
+	if len(zone) != 5 || (zone[0] != '+' && zone[0] != '-') {
+		return Signature{}, fmt.Errorf("bad timezone %q", zone)
+	}
+	offsetHour, err1 := strconv.Atoi(zone[1:3])
+	offsetMinute, err2 := strconv.Atoi(zone[3:5])
+	if err1 != nil || err2 != nil || offsetMinute >= 60 {
+		return Signature{}, fmt.Errorf("bad timezone %q", zone)
 	}
-	var offsetHour, offsetMinute int
-	if _, err := fmt.Sscanf(sign3[1], "+%02d%02d", &offsetHour, &offsetMinute); err != nil {
-		return Sign{}, fmt.Errorf("%w : %s", ErrInvalidCommitObject, err)
+	offset := 3600*offsetHour + 60*offsetMinute
+	if zone[0] == '-' {
+		offset = -offset
 	}
-	location := time.FixedZone(" ", 3600*offsetHour+60*offsetMinute)
+	location := time.FixedZone(" ", offset)
 	timestamp := time.Unix(unixTime, 0).In(location)
-	time.Now().String()
-	return Sign{
-		Name:      name,
-		Email:     email,
-		Timestamp: timestamp,
+	return Signature{
+		Name:  name,
+		Email: email,
+		When:  timestamp,
+		TZ:    zone,
 	}, nil
 }
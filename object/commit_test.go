@@ -0,0 +1,48 @@
+package object
+
+import (
+	"testing"
+	"time"
+)
+
+// 読んだコミットを書き戻すと元のデータに戻るか
+func TestCommit_EncodeRoundTrip(t *testing.T) {
+	data := "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+		"parent 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+		"parent 0123456789abcdef0123456789abcdef01234567\n" +
+		"author A U Thor <author@example.com> 1672531200 +0900\n" +
+		"committer C O Mitter <committer@example.com> 1672534800 -0000\n" +
+		"encoding ISO-8859-1\n" +
+		"gpgsig -----BEGIN PGP SIGNATURE-----\n \n iQEzBAAB\n -----END PGP SIGNATURE-----\n" +
+		"\nsubject\n\nbody\n"
+	commit, err := NewCommit(NewObject(CommitObject, []byte(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commit.Parents) != 2 {
+		t.Errorf("Parents = %v, want 2 parents", commit.Parents)
+	}
+	want := Signature{Name: "A U Thor", Email: "author@example.com", TZ: "+0900"}
+	if got := commit.Author; got.Name != want.Name || got.Email != want.Email || got.TZ != want.TZ || !got.When.Equal(time.Unix(1672531200, 0)) {
+		t.Errorf("Author = %+v", got)
+	}
+	if _, offset := commit.Author.When.Zone(); offset != 9*3600 {
+		t.Errorf("Author.When offset = %d, want %d", offset, 9*3600)
+	}
+	if len(commit.ExtraHeaders) != 2 || commit.ExtraHeaders[1].Key != "gpgsig" ||
+		commit.ExtraHeaders[1].Value != "-----BEGIN PGP SIGNATURE-----\n\niQEzBAAB\n-----END PGP SIGNATURE-----" {
+		t.Errorf("ExtraHeaders = %q", commit.ExtraHeaders)
+	}
+	if commit.Subject() != "subject" {
+		t.Errorf("Subject() = %q", commit.Subject())
+	}
+	if got := string(commit.Encode()); got != data {
+		t.Errorf("Encode() =\n%s\nwant\n%s", got, data)
+	}
+
+	// TZがなければWhenのタイムゾーンで書き出す.
+	sign := Signature{Name: "fsegit", Email: "fsegit@example.com", When: time.Unix(1672531200, 0).In(time.FixedZone("", -5*3600))}
+	if got := sign.Encode(); got != "fsegit <fsegit@example.com> 1672531200 -0500" {
+		t.Errorf("Encode() = %q", got)
+	}
+}
@@ -1,9 +1,37 @@
 package object
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kanon1343/fsegit/sha"
+)
 
 var (
 	ErrInvalidObject       = errors.New("invalid object")
+	ErrObjectTooLarge      = errors.New("object too large")
 	ErrNotCommitObject     = errors.New("not commit object")
 	ErrInvalidCommitObject = errors.New("invalid commit object")
+	ErrNotTreeObject       = errors.New("not tree object")
+	ErrInvalidTreeObject   = errors.New("invalid tree object")
+	ErrNotTagObject        = errors.New("not tag object")
+	ErrInvalidTagObject    = errors.New("invalid tag object")
 )
+
+// ErrStopWalkは履歴の探索を途中で打ち切るときにコールバックから返す. 探索する側はエラーにせずに終える.
+var ErrStopWalk = errors.New("stop walk")
+
+// CorruptObjectErrorはリポジトリ中のオブジェクトが壊れていることを表す.
+// Errには原因になったErrInvalidObjectなどのエラーが入るので、errors.Isで種類を判定できる.
+type CorruptObjectError struct {
+	Hash sha.SHA1
+	Err  error
+}
+
+func (e *CorruptObjectError) Error() string {
+	return fmt.Sprintf("corrupt object %s: %s", e.Hash, e.Err)
+}
+
+func (e *CorruptObjectError) Unwrap() error {
+	return e.Err
+}
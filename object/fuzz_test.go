@@ -0,0 +1,88 @@
+//go:build go1.18
+// +build go1.18
+
+package object
+
+import (
+	"bytes"
+	"compress/zlib"
+	"testing"
+)
+
+var (
+	commitSeed = []byte("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+		"parent 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+		"author fsegit <fsegit@example.com> 1672531200 +0900\n" +
+		"committer fsegit <fsegit@example.com> 1672531200 +0900\n\ninitial commit\n")
+	tagSeed = []byte("object 4b825dc642cb6eb9a060e54bf8d69288fbee4904\ntype commit\ntag v1\n" +
+		"tagger fsegit <fsegit@example.com> 1672531200 +0900\n\nrelease\n")
+	treeSeed = append([]byte("100644 a.txt\x00"), make([]byte, 20)...)
+)
+
+// 壊れたデータを読んでもpanicせずエラーを返すか
+func FuzzReadObject(f *testing.F) {
+	f.Add([]byte("blob 5\x00hello"))
+	f.Add(append([]byte("commit 0\x00"), commitSeed...))
+	f.Add([]byte("blob 99999999999999999999\x00"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		obj, err := ReadObject(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		if obj.Size != len(obj.Data) {
+			t.Fatalf("size = %d, len(data) = %d", obj.Size, len(obj.Data))
+		}
+	})
+}
+
+// zlibで圧縮されたデータとして読んでもpanicしないか
+func FuzzReadObjectCompressed(f *testing.F) {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write([]byte("blob 5\x00hello"))
+	zw.Close()
+	f.Add(buf.Bytes())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		ReadObject(zr)
+	})
+}
+
+func FuzzNewCommit(f *testing.F) {
+	f.Add(commitSeed)
+	f.Add([]byte("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904aa\n"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		commit, err := NewCommit(NewObject(CommitObject, data))
+		if err != nil {
+			return
+		}
+		// 読めたコミットはそのまま書き戻せる.
+		commit.Encode()
+	})
+}
+
+func FuzzNewTree(f *testing.F) {
+	f.Add(treeSeed)
+	f.Add([]byte("40000 ..\x00"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		tree, err := NewTree(NewObject(TreeObject, data))
+		if err != nil {
+			return
+		}
+		for _, entry := range tree.Entries {
+			if !validEntryName(entry.Name) || len(entry.Hash) != 20 {
+				t.Fatalf("bad entry %+v", entry)
+			}
+		}
+	})
+}
+
+func FuzzNewTag(f *testing.F) {
+	f.Add(tagSeed)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		NewTag(NewObject(TagObject, data))
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"strconv"
 	"strings"
 
 	"github.com/kanon1343/fsegit/sha"
@@ -22,6 +23,27 @@ func (o *Object) Header() []byte {
 	return []byte(fmt.Sprintf("%s %d\x00", o.Type, o.Size))
 }
 
+// NewObjectはオブジェクトの種類とデータからハッシュを計算して*Objectを返す.
+func NewObject(objectType Type, data []byte) *Object {
+	object := &Object{
+		Type: objectType,
+		Size: len(data),
+		Data: data,
+	}
+	checkSum := sha1.New()
+	checkSum.Write(object.Header())
+	checkSum.Write(data)
+	object.Hash = checkSum.Sum(nil)
+	return object
+}
+
+// MaxObjectSizeは読み込むオブジェクトのサイズの上限. ヘッダに巨大なサイズを書いた不正なオブジェクトで
+// メモリを使い果たさないようにする.
+var MaxObjectSize int64 = 2 << 30
+
+// maxHeaderLengthはヘッダ("<type> <size>\x00")の長さの上限.
+const maxHeaderLength = 32
+
 // ReadObjectはio.Readerから*Objectを読み込んで返す.
 func ReadObject(r io.Reader) (*Object, error) {
 	checkSum := sha1.New()
@@ -32,13 +54,14 @@ func ReadObject(r io.Reader) (*Object, error) {
 		return nil, err
 	}
 
-	data, err := ioutil.ReadAll(tr)
+	// 宣言されたサイズより長いデータも検出できるように1バイト多く読む.
+	data, err := ioutil.ReadAll(io.LimitReader(tr, int64(size)+1))
 	if err != nil {
 		return nil, err
 	}
 
 	if len(data) != size {
-		return nil, ErrInvalidObject
+		return nil, fmt.Errorf("%w : size is %d but header says %d", ErrInvalidObject, len(data), size)
 	}
 
 	hash := checkSum.Sum(nil)
@@ -53,15 +76,29 @@ func ReadObject(r io.Reader) (*Object, error) {
 }
 
 // readHeaderはobjectのヘッダを読み込んで、オブジェクトの種類とサイズを返す.
+// メモリに読み込むので、サイズがMaxObjectSizeを超えるものはエラーにする.
 func readHeader(r io.Reader) (Type, int, error) {
-	headerString, err := util.ReadNullTerminatedString(r)
+	objectType, size, err := ReadHeader(r)
 	if err != nil {
 		return UndefinedObject, 0, err
 	}
+	if size > MaxObjectSize || int64(int(size)) != size {
+		return UndefinedObject, 0, fmt.Errorf("%w : %d bytes", ErrObjectTooLarge, size)
+	}
+	return objectType, int(size), nil
+}
+
+// ReadHeaderはオブジェクトのヘッダ("<type> <size>\x00")を読み込んで、オブジェクトの種類とサイズを返す.
+// 内容を少しずつ読むときに使うので、サイズの上限は調べない.
+func ReadHeader(r io.Reader) (Type, int64, error) {
+	headerString, err := util.ReadNullTerminatedString(io.LimitReader(r, maxHeaderLength))
+	if err != nil {
+		return UndefinedObject, 0, fmt.Errorf("%w : %s", ErrInvalidObject, err)
+	}
 
 	header := strings.Split(headerString, " ")
 	if len(header) != 2 {
-		return UndefinedObject, 0, ErrInvalidObject
+		return UndefinedObject, 0, fmt.Errorf("%w : bad header %q", ErrInvalidObject, headerString)
 	}
 
 	objectTypeString := header[0]
@@ -69,11 +106,15 @@ func readHeader(r io.Reader) (Type, int, error) {
 
 	objectType, err := NewType(objectTypeString)
 	if err != nil {
-		return UndefinedObject, 0, err
+		return UndefinedObject, 0, fmt.Errorf("%w : %s", ErrInvalidObject, err)
 	}
-	var size int
-	if _, err := fmt.Sscanf(sizeString, "%d", &size); err != nil {
-		return UndefinedObject, 0, err
+	// 符号や先頭の0は受け付けない.
+	if sizeString == "" || sizeString[0] < '0' || sizeString[0] > '9' || (len(sizeString) > 1 && sizeString[0] == '0') {
+		return UndefinedObject, 0, fmt.Errorf("%w : bad size %q", ErrInvalidObject, sizeString)
+	}
+	size, err := strconv.ParseInt(sizeString, 10, 64)
+	if err != nil {
+		return UndefinedObject, 0, fmt.Errorf("%w : bad size %q", ErrInvalidObject, sizeString)
 	}
 	return objectType, size, nil
 }
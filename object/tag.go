@@ -0,0 +1,102 @@
+package object
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/kanon1343/fsegit/sha"
+)
+
+type Tag struct {
+	Hash       sha.SHA1
+	Size       int
+	Object     sha.SHA1
+	ObjectType Type
+	Name       string
+	Tagger     Signature
+	Message    string
+}
+
+// ターミナル上の表示文字列を返す.
+func (t Tag) String() string {
+	str := ""
+	str += fmt.Sprintln("Tag      ", t.Name)
+	str += fmt.Sprintln("Object   ", t.Object)
+	str += fmt.Sprintln("Type     ", t.ObjectType)
+	str += fmt.Sprintln("Tagger   ", t.Tagger)
+	str += fmt.Sprint(t.Message)
+	return str
+}
+
+// Encodeはタグオブジェクトのデータ部分を返す.
+func (t Tag) Encode() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "object %s\n", t.Object)
+	fmt.Fprintf(&buf, "type %s\n", t.ObjectType)
+	fmt.Fprintf(&buf, "tag %s\n", t.Name)
+	if t.Tagger.Name != "" || t.Tagger.Email != "" {
+		fmt.Fprintf(&buf, "tagger %s\n", t.Tagger.Encode())
+	}
+	buf.WriteString("\n")
+	buf.WriteString(t.Message)
+	return buf.Bytes()
+}
+
+// NewTagは*Objectを*Tagに変換して返す.
+func NewTag(o *Object) (*Tag, error) {
+	if o.Type != TagObject {
+		return nil, ErrNotTagObject
+	}
+
+	tag := &Tag{
+		Hash: o.Hash,
+		Size: o.Size,
+	}
+
+	header, message := splitMessage(o.Data)
+	for _, line := range strings.Split(header, "\n") {
+		splitLine := strings.SplitN(line, " ", 2)
+		if len(splitLine) != 2 {
+			return nil, ErrInvalidTagObject
+		}
+		data := splitLine[1]
+
+		switch splitLine[0] {
+		case "object":
+			hash, err := readHash(data)
+			if err != nil {
+				return nil, fmt.Errorf("%w : %s", ErrInvalidTagObject, err)
+			}
+			tag.Object = hash
+		case "type":
+			objectType, err := NewType(data)
+			if err != nil {
+				return nil, fmt.Errorf("%w : %s", ErrInvalidTagObject, err)
+			}
+			tag.ObjectType = objectType
+		case "tag":
+			tag.Name = data
+		case "tagger":
+			tagger, err := ParseSignature(data)
+			if err != nil {
+				return nil, fmt.Errorf("%w : %s", ErrInvalidTagObject, err)
+			}
+			tag.Tagger = tagger
+		}
+	}
+	if tag.Object == nil || tag.ObjectType == UndefinedObject {
+		return nil, ErrInvalidTagObject
+	}
+	tag.Message = message
+	return tag, nil
+}
+
+// splitMessageはコミットやタグのデータをヘッダ部分とメッセージ部分に分ける.
+func splitMessage(data []byte) (string, string) {
+	i := bytes.Index(data, []byte("\n\n"))
+	if i < 0 {
+		return strings.TrimSuffix(string(data), "\n"), ""
+	}
+	return string(data[:i]), string(data[i+2:])
+}
@@ -0,0 +1,173 @@
+package object
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/util"
+)
+
+// FileModeはツリーエントリのモードを表す.
+type FileMode uint32
+
+const (
+	ModeTree       FileMode = 0040000
+	ModeBlob       FileMode = 0100644
+	ModeExecutable FileMode = 0100755
+	ModeSymlink    FileMode = 0120000
+	ModeGitlink    FileMode = 0160000
+)
+
+// ツリーエントリに書かれる8進数表記を返す.
+func (m FileMode) String() string {
+	return fmt.Sprintf("%06o", uint32(m))
+}
+
+// IsTreeはモードがサブツリーを指すかを返す.
+func (m FileMode) IsTree() bool {
+	return m == ModeTree
+}
+
+// ObjectTypeはモードが指すオブジェクトの種類を返す.
+func (m FileMode) ObjectType() Type {
+	switch m {
+	case ModeTree:
+		return TreeObject
+	case ModeGitlink:
+		return CommitObject
+	default:
+		return BlobObject
+	}
+}
+
+// SameModeはaとbが同じモードかを返す. trustExecutableがfalse(core.filemode=false)なら
+// 通常ファイルと実行ファイルの違いを無視する.
+func SameMode(a, b FileMode, trustExecutable bool) bool {
+	if a == b {
+		return true
+	}
+	if trustExecutable {
+		return false
+	}
+	isFile := func(m FileMode) bool { return m == ModeBlob || m == ModeExecutable }
+	return isFile(a) && isFile(b)
+}
+
+type TreeEntry struct {
+	Mode FileMode
+	Name string
+	Hash sha.SHA1
+}
+
+type Tree struct {
+	Hash    sha.SHA1
+	Size    int
+	Entries []TreeEntry
+}
+
+// ターミナル上の表示文字列を返す.
+func (t Tree) String() string {
+	str := ""
+	for _, entry := range t.Entries {
+		str += fmt.Sprintf("%s %s %s\t%s\n", entry.Mode, entry.Mode.ObjectType(), entry.Hash, entry.Name)
+	}
+	return str
+}
+
+// Encodeはツリーオブジェクトのデータ部分を返す. エントリはgitと同じ順序に並べ替えて書き出す.
+func (t Tree) Encode() []byte {
+	entries := make([]TreeEntry, len(t.Entries))
+	copy(entries, t.Entries)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].sortKey() < entries[j].sortKey()
+	})
+
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		fmt.Fprintf(&buf, "%o %s\x00", uint32(entry.Mode), entry.Name)
+		buf.Write(entry.Hash)
+	}
+	return buf.Bytes()
+}
+
+// sortKeyはツリー内の並び順を決める名前を返す. gitはディレクトリ名の末尾に"/"があるものとして比較する.
+func (e TreeEntry) sortKey() string {
+	if e.Mode.IsTree() {
+		return e.Name + "/"
+	}
+	return e.Name
+}
+
+// NewTreeは*Objectを*Treeに変換して返す.
+func NewTree(o *Object) (*Tree, error) {
+	if o.Type != TreeObject {
+		return nil, ErrNotTreeObject
+	}
+
+	tree := &Tree{
+		Hash: o.Hash,
+		Size: o.Size,
+	}
+
+	// エントリは "<mode> <name>\x00<20byteのハッシュ>" の繰り返し.
+	r := bufio.NewReader(bytes.NewReader(o.Data))
+	for {
+		modeString, err := r.ReadString(' ')
+		if err == io.EOF && modeString == "" {
+			break
+		}
+		if err != nil {
+			return nil, ErrInvalidTreeObject
+		}
+		mode, err := strconv.ParseUint(modeString[:len(modeString)-1], 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%w : %s", ErrInvalidTreeObject, err)
+		}
+		if !validMode(FileMode(mode)) {
+			return nil, fmt.Errorf("%w : bad mode %o", ErrInvalidTreeObject, mode)
+		}
+
+		name, err := r.ReadString(0)
+		if err != nil {
+			return nil, ErrInvalidTreeObject
+		}
+		if !validEntryName(name[:len(name)-1]) {
+			return nil, fmt.Errorf("%w : bad entry name %q", ErrInvalidTreeObject, name[:len(name)-1])
+		}
+
+		hash := make(sha.SHA1, 20)
+		if _, err := io.ReadFull(r, hash); err != nil {
+			return nil, ErrInvalidTreeObject
+		}
+
+		tree.Entries = append(tree.Entries, TreeEntry{
+			Mode: FileMode(mode),
+			Name: name[:len(name)-1],
+			Hash: hash,
+		})
+	}
+	return tree, nil
+}
+
+// validModeはモードのファイル種別のビットがgitの扱う種類のどれかかを判定する.
+// 古いgitが書いた100664などのパーミッションは許す.
+func validMode(m FileMode) bool {
+	switch m & 0170000 {
+	case ModeTree, 0100000, ModeSymlink, ModeGitlink:
+		return true
+	}
+	return false
+}
+
+// validEntryNameはツリーエントリの名前として安全かを判定する.
+// 空の名前や"/"を含む名前、"."と".."は作業ツリーの外を指し得るので受け付けない.
+// ".git"や".fsegit"(大文字小文字やファイルシステムが無視する違いを含む)は管理ディレクトリを上書きし得るので受け付けない.
+func validEntryName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.Contains(name, "/") && !util.IsGitDirName(name)
+}
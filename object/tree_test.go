@@ -0,0 +1,44 @@
+package object
+
+import (
+	"errors"
+	"testing"
+)
+
+// 管理ディレクトリと同じに扱われ得る名前のエントリを、ファイルシステムごとの表記の違いも含めて拒むか
+func TestNewTree_RejectsGitDirNames(t *testing.T) {
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"a.txt", true},
+		{".gitignore", true},
+		{".github", true},
+		{"git~1x", true},
+		{"fsegit", true},
+		{".git", false},
+		{".GIT", false},
+		{".fsegit", false},
+		{".FseGit", false},
+		{".git.", false},
+		{".git ..", false},
+		{".git::$INDEX_ALLOCATION", false},
+		{"GIT~1", false},
+		{"fsegit~1", false},
+		{".g\u200cit", false},
+		{"\ufeff.fsegit", false},
+		{`sub\.git`, false},
+		{"..", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		data := append([]byte("40000 "+tt.name+"\x00"), make([]byte, 20)...)
+		_, err := NewTree(NewObject(TreeObject, data))
+		if tt.ok && err != nil {
+			t.Errorf("NewTree(%q) = %v, want nil", tt.name, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrInvalidTreeObject) {
+			t.Errorf("NewTree(%q) = %v, want ErrInvalidTreeObject", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,413 @@
+package pack
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/bits"
+	"sort"
+	"strings"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+)
+
+// bitmapSignatureは.bitmapファイルの先頭4バイト.
+const bitmapSignature = "BITM"
+
+const (
+	bitmapVersion = 1
+	// bitmapOptFullDAGはビット列がコミットから辿れる全てのオブジェクトを含むことを表す. gitはこれのないファイルを読まない.
+	bitmapOptFullDAG = 0x1
+	// bitmapOptHashCacheはエントリの後ろにオブジェクトごとのパスのハッシュの表があることを表す.
+	bitmapOptHashCache = 0x4
+
+	// maxXorOffsetはエントリが差分の元として参照できる前のエントリの数の上限.
+	maxXorOffset = 160
+)
+
+// Bitsetはパック中の順番(オフセットの順)を位置としたビット列. i番目のビットはi/64番目の語の下からi%64番目のビット.
+type Bitset []uint64
+
+// Setはi番目のビットを立てる.
+func (b *Bitset) Set(i int) {
+	for len(*b) <= i/64 {
+		*b = append(*b, 0)
+	}
+	(*b)[i/64] |= 1 << (uint(i) % 64)
+}
+
+// Clearはi番目のビットを下ろす.
+func (b Bitset) Clear(i int) {
+	if i/64 < len(b) {
+		b[i/64] &^= 1 << (uint(i) % 64)
+	}
+}
+
+// Hasはi番目のビットが立っているかを返す.
+func (b Bitset) Has(i int) bool {
+	return i >= 0 && i/64 < len(b) && b[i/64]&(1<<(uint(i)%64)) != 0
+}
+
+// Orはoの立っているビットを立てる.
+func (b *Bitset) Or(o Bitset) {
+	for len(*b) < len(o) {
+		*b = append(*b, 0)
+	}
+	for i, w := range o {
+		(*b)[i] |= w
+	}
+}
+
+// AndNotはoの立っているビットを下ろす.
+func (b Bitset) AndNot(o Bitset) {
+	for i := range b {
+		if i < len(o) {
+			b[i] &^= o[i]
+		}
+	}
+}
+
+// Andはbとoの両方で立っているビットのビット列を新しく作って返す.
+func (b Bitset) And(o Bitset) Bitset {
+	n := len(b)
+	if len(o) < n {
+		n = len(o)
+	}
+	and := make(Bitset, n)
+	for i := range and {
+		and[i] = b[i] & o[i]
+	}
+	return and
+}
+
+// Countは立っているビットの数を返す.
+func (b Bitset) Count() int {
+	n := 0
+	for _, w := range b {
+		n += bits.OnesCount64(w)
+	}
+	return n
+}
+
+// ForEachは立っているビットの位置を小さい順にfnに渡す.
+func (b Bitset) ForEach(fn func(i int)) {
+	for i, w := range b {
+		for w != 0 {
+			fn(i*64 + bits.TrailingZeros64(w))
+			w &= w - 1
+		}
+	}
+}
+
+// decodeEWAHはgitのEWAH形式で圧縮したビット列を展開し、読んだバイト数とともに返す.
+// EWAHは語数、連続する0か1の語の数とそれに続くそのままの語の数を書いた語(RLW)、そのままの語の並びからなる.
+func decodeEWAH(data []byte) (Bitset, int, error) {
+	if len(data) < 8 {
+		return nil, 0, fmt.Errorf("%w : truncated bitmap", ErrInvalidBitmap)
+	}
+	bitSize := binary.BigEndian.Uint32(data)
+	n := int(binary.BigEndian.Uint32(data[4:]))
+	if uint64(n)*8+12 > uint64(len(data)) {
+		return nil, 0, fmt.Errorf("%w : truncated bitmap", ErrInvalidBitmap)
+	}
+	size := int((uint64(bitSize) + 63) / 64)
+	words := data[8 : 8+n*8]
+	b := make(Bitset, 0, size)
+	for pos := 0; pos < n; {
+		rlw := binary.BigEndian.Uint64(words[pos*8:])
+		pos++
+		run := (rlw >> 1) & 0xffffffff
+		literals := int(rlw >> 33)
+		if uint64(len(b))+run+uint64(literals) > uint64(size) || pos+literals > n {
+			return nil, 0, fmt.Errorf("%w : bitmap longer than its size", ErrInvalidBitmap)
+		}
+		var fill uint64
+		if rlw&1 != 0 {
+			fill = ^uint64(0)
+		}
+		for i := uint64(0); i < run; i++ {
+			b = append(b, fill)
+		}
+		for i := 0; i < literals; i++ {
+			b = append(b, binary.BigEndian.Uint64(words[(pos+i)*8:]))
+		}
+		pos += literals
+	}
+	return b, 8 + n*8 + 4, nil
+}
+
+// encodeEWAHはビット列をgitのEWAH形式で圧縮する.
+func encodeEWAH(b Bitset) []byte {
+	words := b
+	for len(words) > 0 && words[len(words)-1] == 0 {
+		words = words[:len(words)-1]
+	}
+	bitSize := 0
+	if len(words) > 0 {
+		bitSize = (len(words)-1)*64 + bits.Len64(words[len(words)-1])
+	}
+
+	var out []uint64
+	last := 0
+	for i := 0; ; {
+		last = len(out)
+		out = append(out, 0)
+		var rlw uint64
+		if i < len(words) && (words[i] == 0 || words[i] == ^uint64(0)) {
+			fill := words[i]
+			run := uint64(0)
+			for i < len(words) && words[i] == fill && run < 0xffffffff {
+				run++
+				i++
+			}
+			if fill != 0 {
+				rlw |= 1
+			}
+			rlw |= run << 1
+		}
+		literals := uint64(0)
+		for i < len(words) && words[i] != 0 && words[i] != ^uint64(0) && literals < 0x7fffffff {
+			out = append(out, words[i])
+			literals++
+			i++
+		}
+		out[last] = rlw | literals<<33
+		if i >= len(words) {
+			break
+		}
+	}
+
+	data := make([]byte, 8+len(out)*8+4)
+	binary.BigEndian.PutUint32(data, uint32(bitSize))
+	binary.BigEndian.PutUint32(data[4:], uint32(len(out)))
+	for i, w := range out {
+		binary.BigEndian.PutUint64(data[8+i*8:], w)
+	}
+	binary.BigEndian.PutUint32(data[8+len(out)*8:], uint32(last))
+	return data
+}
+
+// PackOrderはパックの中の順番(ビット列の位置)と、索引のハッシュの順番の対応.
+type PackOrder struct {
+	// entriesはハッシュの順に並べた索引のエントリ.
+	entries []IndexEntry
+	// byOffsetはビット列の位置からentriesの位置を、bitOfはその逆を引く.
+	byOffset []uint32
+	bitOf    []uint32
+}
+
+// NewPackOrderはパックの索引のエントリからPackOrderを作る.
+func NewPackOrder(entries []IndexEntry) *PackOrder {
+	o := &PackOrder{entries: append([]IndexEntry{}, entries...)}
+	sort.Slice(o.entries, func(i, j int) bool { return bytes.Compare(o.entries[i].Hash, o.entries[j].Hash) < 0 })
+	o.byOffset = make([]uint32, len(o.entries))
+	for i := range o.byOffset {
+		o.byOffset[i] = uint32(i)
+	}
+	sort.Slice(o.byOffset, func(i, j int) bool {
+		return o.entries[o.byOffset[i]].Offset < o.entries[o.byOffset[j]].Offset
+	})
+	o.bitOf = make([]uint32, len(o.entries))
+	for pos, i := range o.byOffset {
+		o.bitOf[i] = uint32(pos)
+	}
+	return o
+}
+
+// Lenはパックのオブジェクトの数を返す.
+func (o *PackOrder) Len() int {
+	return len(o.entries)
+}
+
+// Positionはhashのオブジェクトのビット列の位置を返す. パックになければfalseを返す.
+func (o *PackOrder) Position(hash sha.SHA1) (int, bool) {
+	i, ok := o.indexPosition(hash)
+	if !ok {
+		return 0, false
+	}
+	return int(o.bitOf[i]), true
+}
+
+// Hashはビット列の位置posのオブジェクトのハッシュを返す.
+func (o *PackOrder) Hash(pos int) sha.SHA1 {
+	return o.entries[o.byOffset[pos]].Hash
+}
+
+// indexPositionはhashの索引での位置を返す.
+func (o *PackOrder) indexPosition(hash sha.SHA1) (int, bool) {
+	i := sort.Search(len(o.entries), func(i int) bool { return bytes.Compare(o.entries[i].Hash, hash) >= 0 })
+	if i == len(o.entries) || !bytes.Equal(o.entries[i].Hash, hash) {
+		return 0, false
+	}
+	return i, true
+}
+
+// Bitmapはパックの.bitmapファイル(バージョン1). 選んだコミットごとに、そのコミットから辿れるパックのオブジェクトを
+// ビット列で持つので、コミットを1つずつ読まずに辿れるオブジェクトを求められる.
+type Bitmap struct {
+	order *PackOrder
+	// typesはコミット、ツリー、ブロブ、タグのオブジェクトの位置のビット列.
+	types [4]Bitset
+	// commitsはコミットのハッシュから、そのコミットから辿れるオブジェクトのビット列を引く.
+	commits map[string]Bitset
+	// PackChecksumは対応するパックファイルのチェックサム.
+	PackChecksum sha.SHA1
+}
+
+// bitmapTypesはBitmap.typesの並び.
+var bitmapTypes = [4]object.Type{object.CommitObject, object.TreeObject, object.BlobObject, object.TagObject}
+
+// ReadBitmapはパックファイルpと同じ名前の.bitmapを読む. ファイルがなければos.ErrNotExistを包んだエラーを返す.
+func ReadBitmap(p *Pack) (*Bitmap, error) {
+	data, err := ioutil.ReadFile(strings.TrimSuffix(p.path, ".pack") + ".bitmap")
+	if err != nil {
+		return nil, err
+	}
+	bm, err := ParseBitmap(data, NewPackOrder(p.index.Entries()))
+	if err != nil {
+		return nil, fmt.Errorf("%w : %s", err, p.path)
+	}
+	if !bytes.Equal(bm.PackChecksum, p.index.PackChecksum) {
+		return nil, fmt.Errorf("%w : %s: pack checksum mismatch", ErrInvalidBitmap, p.path)
+	}
+	return bm, nil
+}
+
+// ParseBitmapは.bitmapファイルの内容を読む. orderは対応するパックのPackOrder.
+func ParseBitmap(data []byte, order *PackOrder) (*Bitmap, error) {
+	if len(data) < 32+sha1.Size || string(data[:4]) != bitmapSignature {
+		return nil, fmt.Errorf("%w : bad signature", ErrInvalidBitmap)
+	}
+	if version := binary.BigEndian.Uint16(data[4:]); version != bitmapVersion {
+		return nil, fmt.Errorf("%w : unsupported version %d", ErrInvalidBitmap, version)
+	}
+	if flags := binary.BigEndian.Uint16(data[6:]); flags&bitmapOptFullDAG == 0 {
+		return nil, fmt.Errorf("%w : bitmap is not a full closure", ErrInvalidBitmap)
+	}
+	count := int(binary.BigEndian.Uint32(data[8:]))
+	bm := &Bitmap{
+		order:        order,
+		commits:      map[string]Bitset{},
+		PackChecksum: sha.SHA1(append([]byte{}, data[12:32]...)),
+	}
+	body := data[32 : len(data)-sha1.Size]
+	for i := range bm.types {
+		b, n, err := decodeEWAH(body)
+		if err != nil {
+			return nil, err
+		}
+		bm.types[i] = b
+		body = body[n:]
+	}
+
+	entries := make([]Bitset, count)
+	for i := range entries {
+		if len(body) < 6 {
+			return nil, fmt.Errorf("%w : truncated entry", ErrInvalidBitmap)
+		}
+		indexPos := int(binary.BigEndian.Uint32(body))
+		xorOffset := int(body[4])
+		b, n, err := decodeEWAH(body[6:])
+		if err != nil {
+			return nil, err
+		}
+		body = body[6+n:]
+		if indexPos >= order.Len() || xorOffset > maxXorOffset || xorOffset > i {
+			return nil, fmt.Errorf("%w : bad entry %d", ErrInvalidBitmap, i)
+		}
+		if xorOffset > 0 {
+			// 前のエントリとの差分(XOR)として書かれている.
+			base := entries[i-xorOffset]
+			for len(b) < len(base) {
+				b = append(b, 0)
+			}
+			for j, w := range base {
+				b[j] ^= w
+			}
+		}
+		entries[i] = b
+		bm.commits[string(order.entries[indexPos].Hash)] = b
+	}
+	return bm, nil
+}
+
+// Orderはビット列の位置とオブジェクトの対応を返す.
+func (bm *Bitmap) Order() *PackOrder {
+	return bm.order
+}
+
+// Reachableはcommitから辿れるオブジェクトのビット列を返す. commitのビット列がなければfalseを返す.
+// 返したビット列を書き換えてはならない.
+func (bm *Bitmap) Reachable(commit sha.SHA1) (Bitset, bool) {
+	b, ok := bm.commits[string(commit)]
+	return b, ok
+}
+
+// Typeはビット列の位置posのオブジェクトの種類を返す.
+func (bm *Bitmap) Type(pos int) object.Type {
+	for i, b := range bm.types {
+		if b.Has(pos) {
+			return bitmapTypes[i]
+		}
+	}
+	return object.UndefinedObject
+}
+
+// Typesはobjectの種類のオブジェクトの位置のビット列を返す. 返したビット列を書き換えてはならない.
+func (bm *Bitmap) Types(objectType object.Type) Bitset {
+	for i, t := range bitmapTypes {
+		if t == objectType {
+			return bm.types[i]
+		}
+	}
+	return nil
+}
+
+// WriteBitmapはorderのパックの.bitmapファイルをwに書き出す. typesはビット列の位置ごとのオブジェクトの種類、
+// commitsはコミットのハッシュから、そのコミットから辿れる全てのオブジェクトのビット列を引く.
+func WriteBitmap(w io.Writer, order *PackOrder, packChecksum sha.SHA1, types []object.Type, commits map[string]Bitset) error {
+	var buf bytes.Buffer
+	buf.WriteString(bitmapSignature)
+	binary.Write(&buf, binary.BigEndian, uint16(bitmapVersion))
+	binary.Write(&buf, binary.BigEndian, uint16(bitmapOptFullDAG))
+	binary.Write(&buf, binary.BigEndian, uint32(len(commits)))
+	buf.Write(packChecksum)
+
+	var typeBits [4]Bitset
+	for pos, t := range types {
+		for i, bt := range bitmapTypes {
+			if t == bt {
+				typeBits[i].Set(pos)
+			}
+		}
+	}
+	for _, b := range typeBits {
+		buf.Write(encodeEWAH(b))
+	}
+
+	// 差分にはせず、索引の順に書く.
+	var positions []int
+	byPosition := map[int]Bitset{}
+	for hash, b := range commits {
+		i, ok := order.indexPosition(sha.SHA1(hash))
+		if !ok {
+			return fmt.Errorf("%w : commit %x is not in the pack", ErrInvalidBitmap, hash)
+		}
+		positions = append(positions, i)
+		byPosition[i] = b
+	}
+	sort.Ints(positions)
+	for _, i := range positions {
+		binary.Write(&buf, binary.BigEndian, uint32(i))
+		buf.Write([]byte{0, 0})
+		buf.Write(encodeEWAH(byPosition[i]))
+	}
+	sum := sha1.Sum(buf.Bytes())
+	buf.Write(sum[:])
+	_, err := w.Write(buf.Bytes())
+	return err
+}
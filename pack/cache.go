@@ -0,0 +1,58 @@
+package pack
+
+import (
+	"container/list"
+	"sync"
+)
+
+// deltaBaseCacheはデルタのベースとして展開したオブジェクトをパック中の位置ごとに覚えておくLRUキャッシュ.
+// 合計の大きさがmaxCacheSizeを超えたら最も長く使っていないものから捨てる. ゼロ値で使え、複数のゴルーチンから使える.
+type deltaBaseCache struct {
+	mu   sync.Mutex
+	size int
+	// entriesは最近使ったものを先頭にした並び. 要素の値は*cachedObject.
+	entries  *list.List
+	byOffset map[int64]*list.Element
+}
+
+type cachedObject struct {
+	offset     int64
+	objectType int
+	data       []byte
+}
+
+// getはoffsetのオブジェクトを覚えていれば返す.
+func (c *deltaBaseCache) get(offset int64) (*cachedObject, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.byOffset[offset]
+	if !ok {
+		return nil, false
+	}
+	c.entries.MoveToFront(elem)
+	return elem.Value.(*cachedObject), true
+}
+
+// addはobjを覚える. maxCacheSizeより大きなオブジェクトは覚えない.
+func (c *deltaBaseCache) add(obj *cachedObject) {
+	if len(obj.data) > maxCacheSize {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = list.New()
+		c.byOffset = map[int64]*list.Element{}
+	}
+	if elem, ok := c.byOffset[obj.offset]; ok {
+		c.entries.MoveToFront(elem)
+		return
+	}
+	c.byOffset[obj.offset] = c.entries.PushFront(obj)
+	c.size += len(obj.data)
+	for c.size > maxCacheSize {
+		evicted := c.entries.Remove(c.entries.Back()).(*cachedObject)
+		delete(c.byOffset, evicted.offset)
+		c.size -= len(evicted.data)
+	}
+}
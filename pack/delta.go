@@ -0,0 +1,177 @@
+package pack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/kanon1343/fsegit/object"
+)
+
+const (
+	// deltaBlockSizeはベースの中で一致を探すときの単位.
+	deltaBlockSize = 16
+	// maxCopySizeとmaxInsertSizeは1つの命令で扱える最大の長さ.
+	maxCopySize   = 0x10000
+	maxInsertSize = 0x7f
+)
+
+// ApplyDeltaはbaseにデルタdeltaを適用した結果を返す.
+func ApplyDelta(base, delta []byte) ([]byte, error) {
+	r := bytes.NewReader(delta)
+	baseSize, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w : %s", ErrInvalidDelta, err)
+	}
+	if baseSize != uint64(len(base)) {
+		return nil, fmt.Errorf("%w : base size is %d but delta says %d", ErrInvalidDelta, len(base), baseSize)
+	}
+	resultSize, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w : %s", ErrInvalidDelta, err)
+	}
+	if resultSize > uint64(object.MaxObjectSize) {
+		return nil, fmt.Errorf("%w : result too large", ErrInvalidDelta)
+	}
+
+	result := make([]byte, 0, resultSize)
+	for r.Len() > 0 {
+		op, _ := r.ReadByte()
+		switch {
+		case op&0x80 != 0:
+			// コピー命令: 下位4bitが位置、続く3bitが長さのどのバイトがあるかを表す.
+			var offset, size uint32
+			for i := uint(0); i < 7; i++ {
+				if op&(1<<i) == 0 {
+					continue
+				}
+				b, err := r.ReadByte()
+				if err != nil {
+					return nil, fmt.Errorf("%w : truncated copy", ErrInvalidDelta)
+				}
+				if i < 4 {
+					offset |= uint32(b) << (8 * i)
+				} else {
+					size |= uint32(b) << (8 * (i - 4))
+				}
+			}
+			if size == 0 {
+				size = maxCopySize
+			}
+			if uint64(offset)+uint64(size) > uint64(len(base)) {
+				return nil, fmt.Errorf("%w : copy out of range", ErrInvalidDelta)
+			}
+			result = append(result, base[offset:offset+size]...)
+		case op != 0:
+			// 挿入命令: opバイトのデータが続く.
+			if int(op) > r.Len() {
+				return nil, fmt.Errorf("%w : truncated insert", ErrInvalidDelta)
+			}
+			data := make([]byte, op)
+			r.Read(data)
+			result = append(result, data...)
+		default:
+			return nil, fmt.Errorf("%w : reserved opcode", ErrInvalidDelta)
+		}
+		if uint64(len(result)) > resultSize {
+			return nil, fmt.Errorf("%w : result larger than declared", ErrInvalidDelta)
+		}
+	}
+	if uint64(len(result)) != resultSize {
+		return nil, fmt.Errorf("%w : result size is %d but delta says %d", ErrInvalidDelta, len(result), resultSize)
+	}
+	return result, nil
+}
+
+// ComputeDeltaはbaseからtargetを作るデルタを返す.
+// baseをdeltaBlockSizeごとに索引にし、targetの各位置で一致するブロックを前後に伸ばしてコピー命令にする.
+func ComputeDelta(base, target []byte) []byte {
+	var delta []byte
+	delta = appendUvarint(delta, uint64(len(base)))
+	delta = appendUvarint(delta, uint64(len(target)))
+
+	blocks := map[string]int{}
+	for i := 0; i+deltaBlockSize <= len(base); i += deltaBlockSize {
+		key := string(base[i : i+deltaBlockSize])
+		if _, ok := blocks[key]; !ok {
+			blocks[key] = i
+		}
+	}
+
+	var pending []byte
+	flush := func() {
+		for len(pending) > 0 {
+			n := len(pending)
+			if n > maxInsertSize {
+				n = maxInsertSize
+			}
+			delta = append(delta, byte(n))
+			delta = append(delta, pending[:n]...)
+			pending = pending[n:]
+		}
+	}
+
+	for i := 0; i < len(target); {
+		start, ok := -1, false
+		if i+deltaBlockSize <= len(target) {
+			start, ok = blocks[string(target[i:i+deltaBlockSize])]
+		}
+		if !ok {
+			pending = append(pending, target[i])
+			i++
+			continue
+		}
+		// 挿入待ちのデータの末尾もベースと一致していればコピーに含める.
+		back := 0
+		for back < len(pending) && start-back > 0 && base[start-back-1] == pending[len(pending)-back-1] {
+			back++
+		}
+		pending = pending[:len(pending)-back]
+		start -= back
+		length := deltaBlockSize + back
+		for start+length < len(base) && i-back+length < len(target) && base[start+length] == target[i-back+length] {
+			length++
+		}
+		flush()
+		delta = appendCopy(delta, start, length)
+		i += length - back
+	}
+	flush()
+	return delta
+}
+
+// appendCopyはbase[offset:offset+length]をコピーする命令を追加する.
+func appendCopy(delta []byte, offset, length int) []byte {
+	for length > 0 {
+		size := length
+		if size > maxCopySize {
+			size = maxCopySize
+		}
+		op := byte(0x80)
+		var args []byte
+		for i := uint(0); i < 4; i++ {
+			if b := byte(offset >> (8 * i)); b != 0 {
+				op |= 1 << i
+				args = append(args, b)
+			}
+		}
+		// 長さmaxCopySizeは0として書く.
+		for i := uint(0); i < 3; i++ {
+			if b := byte(size >> (8 * i)); b != 0 && size != maxCopySize {
+				op |= 1 << (4 + i)
+				args = append(args, b)
+			}
+		}
+		delta = append(delta, op)
+		delta = append(delta, args...)
+		offset += size
+		length -= size
+	}
+	return delta
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	return append(buf, tmp[:n]...)
+}
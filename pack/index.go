@@ -0,0 +1,192 @@
+package pack
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/kanon1343/fsegit/sha"
+)
+
+// idxSignatureはバージョン2以降の索引ファイルの先頭4バイト.
+const idxSignature = "\377tOc"
+
+// IndexEntryは索引の1エントリ. パック中のオブジェクトの位置と、格納されたデータのCRC32を持つ.
+type IndexEntry struct {
+	Hash   sha.SHA1
+	Offset int64
+	CRC32  uint32
+}
+
+// Indexはバージョン2の索引ファイル(.idx).
+type Index struct {
+	fanout       [256]uint32
+	hashes       []byte
+	crcs         []byte
+	offsets      []byte
+	largeOffsets []byte
+	// PackChecksumは対応するパックファイルのチェックサム.
+	PackChecksum sha.SHA1
+}
+
+// ParseIndexはバージョン2の索引ファイルの内容を読む. 返したIndexはdataを複製せずに参照する.
+func ParseIndex(data []byte) (*Index, error) {
+	if len(data) < 8+256*4+40 || string(data[:4]) != idxSignature {
+		return nil, fmt.Errorf("%w : bad signature", ErrInvalidIndex)
+	}
+	if version := binary.BigEndian.Uint32(data[4:8]); version != 2 {
+		return nil, fmt.Errorf("%w : unsupported version %d", ErrInvalidIndex, version)
+	}
+	sum := sha1.Sum(data[:len(data)-20])
+	if !bytes.Equal(sum[:], data[len(data)-20:]) {
+		return nil, fmt.Errorf("%w : checksum mismatch", ErrInvalidIndex)
+	}
+
+	idx := &Index{}
+	pos := 8
+	for i := range idx.fanout {
+		idx.fanout[i] = binary.BigEndian.Uint32(data[pos:])
+		if i > 0 && idx.fanout[i] < idx.fanout[i-1] {
+			return nil, fmt.Errorf("%w : bad fanout table", ErrInvalidIndex)
+		}
+		pos += 4
+	}
+	n := int(idx.fanout[255])
+	tail := len(data) - 40
+	if n > (tail-pos)/28 {
+		return nil, fmt.Errorf("%w : truncated", ErrInvalidIndex)
+	}
+	idx.hashes = data[pos : pos+n*20]
+	pos += n * 20
+	idx.crcs = data[pos : pos+n*4]
+	pos += n * 4
+	idx.offsets = data[pos : pos+n*4]
+	pos += n * 4
+	idx.largeOffsets = data[pos:tail]
+	if len(idx.largeOffsets)%8 != 0 {
+		return nil, fmt.Errorf("%w : bad large offset table", ErrInvalidIndex)
+	}
+	idx.PackChecksum = sha.SHA1(append([]byte{}, data[tail:tail+20]...))
+	return idx, nil
+}
+
+// Countは索引にあるオブジェクトの数を返す.
+func (idx *Index) Count() int {
+	return int(idx.fanout[255])
+}
+
+// Findはhashのオブジェクトのパック中の位置を返す.
+func (idx *Index) Find(hash sha.SHA1) (int64, bool) {
+	if len(hash) != 20 {
+		return 0, false
+	}
+	lo := 0
+	if hash[0] > 0 {
+		lo = int(idx.fanout[hash[0]-1])
+	}
+	hi := int(idx.fanout[hash[0]])
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		return bytes.Compare(idx.hash(lo+i), hash) >= 0
+	})
+	if i >= hi || !bytes.Equal(idx.hash(i), hash) {
+		return 0, false
+	}
+	return idx.offset(i), true
+}
+
+// FindPrefixは16進数で書いたハッシュがprefixで始まるオブジェクトのハッシュを、ハッシュの順に返す.
+// prefixは2文字以上の小文字の16進数とする.
+func (idx *Index) FindPrefix(prefix string) []sha.SHA1 {
+	first, err := hex.DecodeString(prefix[:2])
+	if err != nil {
+		return nil
+	}
+	lo := 0
+	if first[0] > 0 {
+		lo = int(idx.fanout[first[0]-1])
+	}
+	hi := int(idx.fanout[first[0]])
+	var hashes []sha.SHA1
+	for i := lo; i < hi; i++ {
+		if strings.HasPrefix(hex.EncodeToString(idx.hash(i)), prefix) {
+			hashes = append(hashes, sha.SHA1(append([]byte{}, idx.hash(i)...)))
+		}
+	}
+	return hashes
+}
+
+// Entriesは索引の全エントリをハッシュの順に返す. ハッシュは索引のデータから複製する.
+func (idx *Index) Entries() []IndexEntry {
+	entries := make([]IndexEntry, idx.Count())
+	hashes := append([]byte{}, idx.hashes...)
+	for i := range entries {
+		entries[i] = IndexEntry{
+			Hash:   sha.SHA1(hashes[i*20 : i*20+20 : i*20+20]),
+			Offset: idx.offset(i),
+			CRC32:  binary.BigEndian.Uint32(idx.crcs[i*4:]),
+		}
+	}
+	return entries
+}
+
+func (idx *Index) hash(i int) []byte {
+	return idx.hashes[i*20 : i*20+20]
+}
+
+// offsetはi番目のオブジェクトの位置を返す. 最上位ビットが立っていれば8バイトの位置の表を引く.
+func (idx *Index) offset(i int) int64 {
+	offset := binary.BigEndian.Uint32(idx.offsets[i*4:])
+	if offset&0x80000000 == 0 {
+		return int64(offset)
+	}
+	j := int(offset&0x7fffffff) * 8
+	if j+8 > len(idx.largeOffsets) {
+		return -1
+	}
+	return int64(binary.BigEndian.Uint64(idx.largeOffsets[j:]))
+}
+
+// WriteIndexはentriesからバージョン2の索引ファイルを書き出す. entriesはハッシュの順に並べ替えられる.
+func WriteIndex(w io.Writer, entries []IndexEntry, packChecksum sha.SHA1) error {
+	sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].Hash, entries[j].Hash) < 0 })
+
+	var buf bytes.Buffer
+	buf.WriteString(idxSignature)
+	binary.Write(&buf, binary.BigEndian, uint32(2))
+	var fanout [256]uint32
+	for _, entry := range entries {
+		fanout[entry.Hash[0]]++
+	}
+	for i := 1; i < 256; i++ {
+		fanout[i] += fanout[i-1]
+	}
+	binary.Write(&buf, binary.BigEndian, fanout)
+	for _, entry := range entries {
+		buf.Write(entry.Hash)
+	}
+	for _, entry := range entries {
+		binary.Write(&buf, binary.BigEndian, entry.CRC32)
+	}
+	var large []uint64
+	for _, entry := range entries {
+		if entry.Offset < 0x80000000 {
+			binary.Write(&buf, binary.BigEndian, uint32(entry.Offset))
+			continue
+		}
+		binary.Write(&buf, binary.BigEndian, 0x80000000|uint32(len(large)))
+		large = append(large, uint64(entry.Offset))
+	}
+	for _, offset := range large {
+		binary.Write(&buf, binary.BigEndian, offset)
+	}
+	buf.Write(packChecksum)
+	sum := sha1.Sum(buf.Bytes())
+	buf.Write(sum[:])
+	_, err := w.Write(buf.Bytes())
+	return err
+}
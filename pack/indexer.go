@@ -0,0 +1,156 @@
+package pack
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+)
+
+// errBaseMissingはREF_DELTAのベースがまだ解決されていないことを表す.
+var errBaseMissing = errors.New("delta base not found")
+
+// streamReaderは受け取ったパックを読みながら、読んだバイトをチェックサムとCRC32に加えてファイルに書き出す.
+// io.ByteReaderを実装しているので、zlibは圧縮データの終わりより先を読まない.
+type streamReader struct {
+	r      *bufio.Reader
+	w      *bufio.Writer
+	sum    hash.Hash
+	crc    hash.Hash32
+	offset int64
+	werr   error
+}
+
+func (sr *streamReader) consume(p []byte) {
+	sr.sum.Write(p)
+	sr.crc.Write(p)
+	sr.offset += int64(len(p))
+	if sr.werr == nil {
+		_, sr.werr = sr.w.Write(p)
+	}
+}
+
+func (sr *streamReader) Read(p []byte) (int, error) {
+	n, err := sr.r.Read(p)
+	sr.consume(p[:n])
+	return n, err
+}
+
+func (sr *streamReader) ReadByte() (byte, error) {
+	b, err := sr.r.ReadByte()
+	if err == nil {
+		sr.consume([]byte{b})
+	}
+	return b, err
+}
+
+// pendingDeltaはまだハッシュの分からないデルタのオブジェクト.
+type pendingDelta struct {
+	offset int64
+	crc    uint32
+}
+
+// IndexPackはrから受け取ったパックファイルをfに書き込みながら読み、全てのオブジェクトのハッシュを求めて
+// パックのチェックサムと索引のエントリを返す. デルタのベースはパックの中になければならない.
+func IndexPack(r io.Reader, f *os.File) (sha.SHA1, []IndexEntry, error) {
+	sr := &streamReader{
+		r:   bufio.NewReader(r),
+		w:   bufio.NewWriter(f),
+		sum: sha1.New(),
+		crc: crc32.NewIEEE(),
+	}
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(sr, header); err != nil {
+		return nil, nil, fmt.Errorf("%w : %s", ErrInvalidPack, err)
+	}
+	count, err := readPackHeader(header)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var entries []IndexEntry
+	var deltas []pendingDelta
+	offsets := map[string]int64{}
+	for i := uint32(0); i < count; i++ {
+		sr.crc.Reset()
+		offset := sr.offset
+		objectType, size, err := readEntryHeader(sr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w : object %d: %s", ErrInvalidPack, i, err)
+		}
+		switch objectType {
+		case int(object.CommitObject), int(object.TreeObject), int(object.BlobObject), int(object.TagObject):
+		case typeOfsDelta:
+			if _, err := readOffset(sr); err != nil {
+				return nil, nil, fmt.Errorf("%w : object %d: %s", ErrInvalidPack, i, err)
+			}
+		case typeRefDelta:
+			if _, err := io.ReadFull(sr, make([]byte, 20)); err != nil {
+				return nil, nil, fmt.Errorf("%w : object %d: %s", ErrInvalidPack, i, err)
+			}
+		default:
+			return nil, nil, fmt.Errorf("%w : object %d: unknown type %d", ErrInvalidPack, i, objectType)
+		}
+		data, err := inflate(sr, size)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w : object %d: %s", ErrInvalidPack, i, err)
+		}
+		if objectType == typeOfsDelta || objectType == typeRefDelta {
+			deltas = append(deltas, pendingDelta{offset: offset, crc: sr.crc.Sum32()})
+			continue
+		}
+		obj := object.NewObject(object.Type(objectType), data)
+		offsets[string(obj.Hash)] = offset
+		entries = append(entries, IndexEntry{Hash: obj.Hash, Offset: offset, CRC32: sr.crc.Sum32()})
+	}
+
+	checksum := sr.sum.Sum(nil)
+	trailer := make([]byte, 20)
+	if _, err := io.ReadFull(sr.r, trailer); err != nil {
+		return nil, nil, fmt.Errorf("%w : missing checksum", ErrInvalidPack)
+	}
+	if string(trailer) != string(checksum) {
+		return nil, nil, fmt.Errorf("%w : checksum mismatch", ErrInvalidPack)
+	}
+	if sr.werr == nil {
+		_, sr.werr = sr.w.Write(trailer)
+	}
+	if sr.werr == nil {
+		sr.werr = sr.w.Flush()
+	}
+	if sr.werr != nil {
+		return nil, nil, sr.werr
+	}
+
+	// REF_DELTAのベースが後ろにあることもあるので、進まなくなるまで繰り返し解決する.
+	p := &Pack{file: f, offsets: offsets}
+	for len(deltas) > 0 {
+		var unresolved []pendingDelta
+		for _, delta := range deltas {
+			objectType, data, err := p.readAt(delta.offset, 0)
+			if errors.Is(err, errBaseMissing) {
+				unresolved = append(unresolved, delta)
+				continue
+			}
+			if err != nil {
+				return nil, nil, fmt.Errorf("%w : object at %d: %s", ErrInvalidPack, delta.offset, err)
+			}
+			obj := object.NewObject(object.Type(objectType), data)
+			offsets[string(obj.Hash)] = delta.offset
+			entries = append(entries, IndexEntry{Hash: obj.Hash, Offset: delta.offset, CRC32: delta.crc})
+		}
+		if len(unresolved) == len(deltas) {
+			_, _, err := p.readAt(unresolved[0].offset, 0)
+			return nil, nil, fmt.Errorf("%w : %d objects: %s", ErrInvalidPack, len(unresolved), err)
+		}
+		deltas = unresolved
+	}
+	return sha.SHA1(checksum), entries, nil
+}
@@ -0,0 +1,459 @@
+// Package packはgitのパックファイル(.pack)とその索引(.idx)を読み書きする.
+package pack
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/util"
+)
+
+var (
+	ErrInvalidPack   = errors.New("invalid pack file")
+	ErrInvalidIndex  = errors.New("invalid pack index")
+	ErrNotFound      = errors.New("object not found in pack")
+	ErrInvalidDelta  = errors.New("invalid delta")
+	ErrInvalidBitmap = errors.New("invalid pack bitmap")
+)
+
+const (
+	packSignature = "PACK"
+	packVersion   = 2
+
+	// パック内のオブジェクトの種類. 1から4はobject.Typeと同じ値.
+	typeOfsDelta = 6
+	typeRefDelta = 7
+
+	// maxDeltaChainはデルタを辿る深さの上限. 壊れたパックで無限に辿らないようにする.
+	maxDeltaChain = 10000
+
+	// maxCacheSizeはパックごとにデルタのベースを覚えておく大きさの上限(バイト).
+	maxCacheSize = 32 << 20
+)
+
+// encodeEntryHeaderはパック内のオブジェクトの先頭に置く種類と大きさを書き出す.
+// 最初のバイトは種類(3bit)と大きさの下位4bit、続くバイトは7bitずつ大きさを持つ.
+func encodeEntryHeader(objectType int, size int64) []byte {
+	b := byte(objectType<<4) | byte(size&0x0f)
+	size >>= 4
+	var header []byte
+	for size > 0 {
+		header = append(header, b|0x80)
+		b = byte(size & 0x7f)
+		size >>= 7
+	}
+	return append(header, b)
+}
+
+// readEntryHeaderはencodeEntryHeaderで書かれた種類と大きさを読む.
+func readEntryHeader(r io.ByteReader) (int, int64, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, err
+	}
+	objectType := int(b>>4) & 7
+	size := int64(b & 0x0f)
+	for shift := uint(4); b&0x80 != 0; shift += 7 {
+		if shift > 56 {
+			return 0, 0, fmt.Errorf("%w : object size too large", ErrInvalidPack)
+		}
+		if b, err = r.ReadByte(); err != nil {
+			return 0, 0, err
+		}
+		size |= int64(b&0x7f) << shift
+	}
+	return objectType, size, nil
+}
+
+// encodeOffsetはOFS_DELTAのベースまでの距離を書き出す. 続きのバイトがあるごとに1を引いて冗長な表現をなくす.
+func encodeOffset(offset int64) []byte {
+	buf := []byte{byte(offset & 0x7f)}
+	for offset >>= 7; offset > 0; offset >>= 7 {
+		offset--
+		buf = append([]byte{byte(0x80 | offset&0x7f)}, buf...)
+	}
+	return buf
+}
+
+// readOffsetはencodeOffsetで書かれた距離を読む.
+func readOffset(r io.ByteReader) (int64, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	offset := int64(b & 0x7f)
+	for b&0x80 != 0 {
+		if offset > 1<<48 {
+			return 0, fmt.Errorf("%w : delta base offset too large", ErrInvalidPack)
+		}
+		if b, err = r.ReadByte(); err != nil {
+			return 0, err
+		}
+		offset = ((offset + 1) << 7) | int64(b&0x7f)
+	}
+	return offset, nil
+}
+
+// Packは索引と組になったパックファイル.
+type Pack struct {
+	path  string
+	file  io.ReaderAt
+	index *Index
+	// offsetsは索引を作っている途中のパックで、解決済みのオブジェクトの位置を引くのに使う.
+	offsets map[string]int64
+
+	// dataとidxDataはメモリに割り当てたパックファイルと索引ファイル. 割り当てられなければnilで、
+	// パックはfileから読み、索引は読み込んだものを使う.
+	data    []byte
+	idxData []byte
+	// refsはOpenで返してまだ閉じていない読み込みの数. 割り当てたメモリはCloseされてrefsが0になってから解放する.
+	refMu  sync.Mutex
+	refs   int
+	closed bool
+
+	// basesはデルタのベースとして読んだオブジェクト.
+	bases deltaBaseCache
+}
+
+// Openはパックファイルpathと同じ名前の.idxを開く. どちらもできればメモリに割り当て、
+// 大きなパックでも全体を読み込まずに必要なところだけを読む.
+func Open(path string) (*Pack, error) {
+	p := &Pack{path: path}
+	idxData, err := p.mapIndex(strings.TrimSuffix(path, ".pack") + ".idx")
+	if err != nil {
+		return nil, err
+	}
+	if p.index, err = ParseIndex(idxData); err != nil {
+		p.unmap()
+		return nil, fmt.Errorf("%w : %s", err, path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		p.unmap()
+		return nil, err
+	}
+	p.file = f
+	if info, err := f.Stat(); err == nil {
+		if data, err := util.Mmap(f, info.Size()); err == nil {
+			// 割り当てた後はファイルを閉じても読める.
+			f.Close()
+			p.data = data
+			p.file = bytes.NewReader(data)
+		}
+	}
+	header := make([]byte, 12)
+	if _, err := p.file.ReadAt(header, 0); err != nil {
+		p.unmap()
+		return nil, fmt.Errorf("%w : %s: %s", ErrInvalidPack, path, err)
+	}
+	count, err := readPackHeader(header)
+	if err != nil || int(count) != p.index.Count() {
+		p.unmap()
+		return nil, fmt.Errorf("%w : %s: object count does not match the index", ErrInvalidPack, path)
+	}
+	return p, nil
+}
+
+// mapIndexは索引ファイルpathをメモリに割り当てて返す. 割り当てられなければ全体を読み込む.
+func (p *Pack) mapIndex(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if data, err := util.Mmap(f, info.Size()); err == nil {
+		p.idxData = data
+		return data, nil
+	}
+	return ioutil.ReadAll(f)
+}
+
+// Pathはパックファイルのパスを返す.
+func (p *Pack) Path() string {
+	return p.path
+}
+
+// Indexはパックの索引を返す. 索引はメモリに割り当てたファイルを指すことがあるので、Closeした後は使えない.
+func (p *Pack) Index() *Index {
+	return p.index
+}
+
+// Closeはパックファイルを閉じる. Openで返した読み込みが残っていれば、それが全て閉じられたときに閉じる.
+func (p *Pack) Close() error {
+	p.refMu.Lock()
+	defer p.refMu.Unlock()
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	if p.refs > 0 {
+		return nil
+	}
+	return p.unmap()
+}
+
+// unmapはメモリの割り当てを解き、ファイルを閉じる.
+func (p *Pack) unmap() error {
+	var err error
+	if p.data != nil {
+		err = util.Munmap(p.data)
+		p.data = nil
+	} else if closer, ok := p.file.(io.Closer); ok {
+		err = closer.Close()
+	}
+	if p.idxData != nil {
+		if unmapErr := util.Munmap(p.idxData); err == nil {
+			err = unmapErr
+		}
+		p.idxData = nil
+	}
+	return err
+}
+
+// packReaderはOpenで返す読み込み. 閉じるまでパックのメモリの割り当てを解かせない.
+type packReader struct {
+	io.ReadCloser
+	p    *Pack
+	once sync.Once
+}
+
+func (r *packReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(func() {
+		r.p.refMu.Lock()
+		defer r.p.refMu.Unlock()
+		r.p.refs--
+		if r.p.closed && r.p.refs == 0 {
+			if unmapErr := r.p.unmap(); err == nil {
+				err = unmapErr
+			}
+		}
+	})
+	return err
+}
+
+// entryReaderはパック中のオブジェクトを先頭から読む.
+type entryReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// readerはパックのoffsetから読むentryReaderを返す. メモリに割り当てたパックは複製せずにそのまま読む.
+func (p *Pack) reader(offset int64) entryReader {
+	if p.data != nil {
+		if offset < 0 || offset > int64(len(p.data)) {
+			return bytes.NewReader(nil)
+		}
+		return bytes.NewReader(p.data[offset:])
+	}
+	return bufio.NewReader(io.NewSectionReader(p.file, offset, 1<<62))
+}
+
+// findはhashのオブジェクトのパック中の位置を返す.
+func (p *Pack) find(hash sha.SHA1) (int64, bool) {
+	if p.index == nil {
+		offset, ok := p.offsets[string(hash)]
+		return offset, ok
+	}
+	return p.index.Find(hash)
+}
+
+// Containsはhashのオブジェクトがパックにあるかを返す.
+func (p *Pack) Contains(hash sha.SHA1) bool {
+	_, ok := p.index.Find(hash)
+	return ok
+}
+
+// Getはhashのオブジェクトをデルタを解決して返す. パックになければErrNotFoundを返す.
+func (p *Pack) Get(hash sha.SHA1) (*object.Object, error) {
+	offset, ok := p.index.Find(hash)
+	if !ok {
+		return nil, fmt.Errorf("%w : %s", ErrNotFound, hash)
+	}
+	objectType, data, err := p.readAt(offset, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w : %s: %s", ErrInvalidPack, hash, err)
+	}
+	obj := object.NewObject(object.Type(objectType), data)
+	if !bytes.Equal(obj.Hash, hash) {
+		return nil, fmt.Errorf("%w : %s: hash mismatch", ErrInvalidPack, hash)
+	}
+	return obj, nil
+}
+
+// Openはhashのオブジェクトの種類とサイズ、展開したデータを読むio.ReadCloserを返す.
+// デルタでないオブジェクトはパックファイルから展開しながら読むので、全体をメモリに読み込まない.
+// デルタはベースに適用するために全体を読み込む. ハッシュは確かめないので呼び出し側で確かめる.
+func (p *Pack) Open(hash sha.SHA1) (object.Type, int64, io.ReadCloser, error) {
+	offset, ok := p.index.Find(hash)
+	if !ok {
+		return object.UndefinedObject, 0, nil, fmt.Errorf("%w : %s", ErrNotFound, hash)
+	}
+	r := p.reader(offset)
+	objectType, size, err := readEntryHeader(r)
+	if err != nil {
+		return object.UndefinedObject, 0, nil, fmt.Errorf("%w : %s: %s", ErrInvalidPack, hash, err)
+	}
+	switch objectType {
+	case int(object.CommitObject), int(object.TreeObject), int(object.BlobObject), int(object.TagObject):
+		zr, err := zlib.NewReader(r)
+		if err != nil {
+			return object.UndefinedObject, 0, nil, fmt.Errorf("%w : %s: %s", ErrInvalidPack, hash, err)
+		}
+		p.refMu.Lock()
+		p.refs++
+		p.refMu.Unlock()
+		return object.Type(objectType), size, &packReader{ReadCloser: zr, p: p}, nil
+	}
+	objectType, data, err := p.readAt(offset, 0)
+	if err != nil {
+		return object.UndefinedObject, 0, nil, fmt.Errorf("%w : %s: %s", ErrInvalidPack, hash, err)
+	}
+	return object.Type(objectType), int64(len(data)), ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Typeはhashのオブジェクトの種類を返す. デルタはベースの種類になるが、データを展開せずにベースを辿るだけで求める.
+func (p *Pack) Type(hash sha.SHA1) (object.Type, error) {
+	offset, ok := p.index.Find(hash)
+	if !ok {
+		return object.UndefinedObject, fmt.Errorf("%w : %s", ErrNotFound, hash)
+	}
+	for depth := 0; depth <= maxDeltaChain; depth++ {
+		r := p.reader(offset)
+		objectType, _, err := readEntryHeader(r)
+		if err != nil {
+			return object.UndefinedObject, fmt.Errorf("%w : %s: %s", ErrInvalidPack, hash, err)
+		}
+		switch objectType {
+		case int(object.CommitObject), int(object.TreeObject), int(object.BlobObject), int(object.TagObject):
+			return object.Type(objectType), nil
+		case typeOfsDelta:
+			distance, err := readOffset(r)
+			if err != nil || distance <= 0 || distance > offset {
+				return object.UndefinedObject, fmt.Errorf("%w : %s: bad delta base offset", ErrInvalidPack, hash)
+			}
+			offset -= distance
+		case typeRefDelta:
+			baseHash := make(sha.SHA1, 20)
+			if _, err := io.ReadFull(r, baseHash); err != nil {
+				return object.UndefinedObject, fmt.Errorf("%w : %s: %s", ErrInvalidPack, hash, err)
+			}
+			if offset, ok = p.find(baseHash); !ok {
+				return object.UndefinedObject, fmt.Errorf("%w : %s: delta base %s not found", ErrInvalidPack, hash, baseHash)
+			}
+		default:
+			return object.UndefinedObject, fmt.Errorf("%w : %s: unknown object type %d", ErrInvalidPack, hash, objectType)
+		}
+	}
+	return object.UndefinedObject, fmt.Errorf("%w : %s: delta chain too long", ErrInvalidPack, hash)
+}
+
+// readAtはoffsetのオブジェクトの種類と展開したデータを返す. デルタならベースを読んで適用する.
+func (p *Pack) readAt(offset int64, depth int) (int, []byte, error) {
+	if depth > maxDeltaChain {
+		return 0, nil, fmt.Errorf("delta chain too long")
+	}
+	if depth > 0 {
+		if cached, ok := p.bases.get(offset); ok {
+			return cached.objectType, cached.data, nil
+		}
+	}
+	r := p.reader(offset)
+	objectType, size, err := readEntryHeader(r)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var baseType int
+	var base []byte
+	switch objectType {
+	case int(object.CommitObject), int(object.TreeObject), int(object.BlobObject), int(object.TagObject):
+	case typeOfsDelta:
+		distance, err := readOffset(r)
+		if err != nil {
+			return 0, nil, err
+		}
+		if distance <= 0 || distance > offset {
+			return 0, nil, fmt.Errorf("bad delta base offset")
+		}
+		if baseType, base, err = p.readAt(offset-distance, depth+1); err != nil {
+			return 0, nil, err
+		}
+	case typeRefDelta:
+		baseHash := make(sha.SHA1, 20)
+		if _, err := io.ReadFull(r, baseHash); err != nil {
+			return 0, nil, err
+		}
+		baseOffset, ok := p.find(baseHash)
+		if !ok {
+			return 0, nil, fmt.Errorf("%w : %s", errBaseMissing, baseHash)
+		}
+		if baseType, base, err = p.readAt(baseOffset, depth+1); err != nil {
+			return 0, nil, err
+		}
+	default:
+		return 0, nil, fmt.Errorf("unknown object type %d", objectType)
+	}
+
+	data, err := inflate(r, size)
+	if err != nil {
+		return 0, nil, err
+	}
+	if base != nil {
+		if data, err = ApplyDelta(base, data); err != nil {
+			return 0, nil, err
+		}
+		objectType = baseType
+	}
+	if depth > 0 {
+		p.bases.add(&cachedObject{offset: offset, objectType: objectType, data: data})
+	}
+	return objectType, data, nil
+}
+
+// inflateはzlibで圧縮されたsizeバイトのデータを展開する.
+func inflate(r io.Reader, size int64) ([]byte, error) {
+	if size > object.MaxObjectSize {
+		return nil, object.ErrObjectTooLarge
+	}
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	var buf bytes.Buffer
+	buf.Grow(int(size))
+	if _, err := io.Copy(&buf, io.LimitReader(zr, size+1)); err != nil {
+		return nil, err
+	}
+	if int64(buf.Len()) != size {
+		return nil, fmt.Errorf("object size mismatch")
+	}
+	return buf.Bytes(), nil
+}
+
+// readPackHeaderはパックファイルの先頭12バイトを読み、オブジェクトの数を返す.
+func readPackHeader(header []byte) (uint32, error) {
+	if len(header) < 12 || string(header[:4]) != packSignature {
+		return 0, fmt.Errorf("%w : bad signature", ErrInvalidPack)
+	}
+	if version := binary.BigEndian.Uint32(header[4:8]); version != packVersion && version != 3 {
+		return 0, fmt.Errorf("%w : unsupported version %d", ErrInvalidPack, version)
+	}
+	return binary.BigEndian.Uint32(header[8:12]), nil
+}
@@ -0,0 +1,330 @@
+package pack
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	"github.com/kanon1343/fsegit/object"
+)
+
+// デルタを適用するともとのデータに戻るか
+func TestComputeDelta(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	random := func(n int) []byte {
+		data := make([]byte, n)
+		for i := range data {
+			data[i] = byte('a' + r.Intn(3))
+		}
+		return data
+	}
+	for i := 0; i < 200; i++ {
+		base := random(r.Intn(2000))
+		target := append([]byte{}, base...)
+		for j := r.Intn(5); j > 0 && len(target) > 0; j-- {
+			pos := r.Intn(len(target))
+			target = append(target[:pos], append(random(r.Intn(50)), target[pos+r.Intn(len(target)-pos):]...)...)
+		}
+		delta := ComputeDelta(base, target)
+		got, err := ApplyDelta(base, delta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, target) {
+			t.Fatalf("ApplyDelta(ComputeDelta()) = %q, want %q", got, target)
+		}
+	}
+
+	big := bytes.Repeat([]byte("0123456789abcdef"), 10000)
+	delta := ComputeDelta(big, append(big, 'x'))
+	if got, err := ApplyDelta(big, delta); err != nil || !bytes.Equal(got, append(big, 'x')) {
+		t.Fatalf("ApplyDelta() for a large copy failed: %v", err)
+	}
+	if len(delta) > 100 {
+		t.Errorf("delta for a one-byte append is %d bytes", len(delta))
+	}
+}
+
+// 書き出したパックと索引から全てのオブジェクトを読み出せるか
+func TestWriterRoundTrip(t *testing.T) {
+	var objs []*object.Object
+	content := bytes.Repeat([]byte("line of text\n"), 200)
+	for i := 0; i < 20; i++ {
+		content = append(content, fmt.Sprintf("version %d\n", i)...)
+		objs = append(objs, object.NewObject(object.BlobObject, append([]byte{}, content...)))
+	}
+	objs = append(objs, object.NewObject(object.CommitObject, []byte("tree 0000000000000000000000000000000000000000\n\nmessage\n")))
+	objs = append(objs, object.NewObject(object.BlobObject, nil))
+
+	dir := t.TempDir()
+	packPath := filepath.Join(dir, "test.pack")
+	var packBuf bytes.Buffer
+	pw, err := NewWriter(&packBuf, len(objs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pw.WriteObjects(objs, DefaultWindow, DefaultMaxDepth); err != nil {
+		t.Fatal(err)
+	}
+	checksum, err := pw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var idxBuf bytes.Buffer
+	if err := WriteIndex(&idxBuf, pw.Entries(), checksum); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(packPath, packBuf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "test.idx"), idxBuf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if total := 20 * len(content); packBuf.Len() > total/5 {
+		t.Errorf("pack is %d bytes, deltas do not seem to be used", packBuf.Len())
+	}
+
+	p, err := Open(packPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	for _, want := range objs {
+		got, err := p.Get(want.Hash)
+		if err != nil {
+			t.Fatalf("Get(%s): %v", want.Hash, err)
+		}
+		if got.Type != want.Type || !bytes.Equal(got.Data, want.Data) {
+			t.Errorf("Get(%s) returned different contents", want.Hash)
+		}
+		// デルタになったオブジェクトもベースの種類になる.
+		if objectType, err := p.Type(want.Hash); err != nil || objectType != want.Type {
+			t.Errorf("Type(%s) = %s, %v, want %s", want.Hash, objectType, err, want.Type)
+		}
+	}
+	if p.Contains(object.NewObject(object.BlobObject, []byte("missing")).Hash) {
+		t.Error("Contains() reported a missing object")
+	}
+}
+
+// 受け取ったパックから書き出したときと同じ索引のエントリが求まるか
+func TestIndexPack(t *testing.T) {
+	base := object.NewObject(object.BlobObject, bytes.Repeat([]byte("base content\n"), 50))
+	target := object.NewObject(object.BlobObject, append(bytes.Repeat([]byte("base content\n"), 50), "more\n"...))
+	other := object.NewObject(object.TreeObject, []byte{})
+
+	var packBuf bytes.Buffer
+	pw, err := NewWriter(&packBuf, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ベースより前に置いたREF_DELTAも解決できる.
+	if err := pw.WriteRefDelta(target, base.Hash, ComputeDelta(base.Data, target.Data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := pw.WriteObject(base); err != nil {
+		t.Fatal(err)
+	}
+	if err := pw.WriteObject(other); err != nil {
+		t.Fatal(err)
+	}
+	want, err := pw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := ioutil.TempFile(t.TempDir(), "pack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	checksum, entries, err := IndexPack(bytes.NewReader(packBuf.Bytes()), f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(checksum, want) {
+		t.Errorf("IndexPack() checksum = %s, want %s", checksum, want)
+	}
+	byHash := map[string]IndexEntry{}
+	for _, entry := range entries {
+		byHash[string(entry.Hash)] = entry
+	}
+	for _, entry := range pw.Entries() {
+		if got, ok := byHash[string(entry.Hash)]; !ok || got.Offset != entry.Offset || got.CRC32 != entry.CRC32 {
+			t.Errorf("IndexPack() entry for %s = %+v, want %+v", entry.Hash, got, entry)
+		}
+	}
+
+	corrupt := append([]byte{}, packBuf.Bytes()...)
+	corrupt[len(corrupt)-1] ^= 1
+	f2, err := ioutil.TempFile(t.TempDir(), "pack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f2.Close()
+	if _, _, err := IndexPack(bytes.NewReader(corrupt), f2); err == nil {
+		t.Error("IndexPack() accepted a pack with a bad checksum")
+	}
+}
+
+// Closeした後も、先にOpenで開いた読み込みは最後まで読めるか. デルタのベースは上限まで古いものから捨てるか
+func TestPack_CloseWhileReading(t *testing.T) {
+	content := bytes.Repeat([]byte("streamed line\n"), 1000)
+	objs := []*object.Object{object.NewObject(object.BlobObject, content)}
+	var packBuf bytes.Buffer
+	pw, err := NewWriter(&packBuf, len(objs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pw.WriteObjects(objs, DefaultWindow, DefaultMaxDepth); err != nil {
+		t.Fatal(err)
+	}
+	checksum, err := pw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var idxBuf bytes.Buffer
+	if err := WriteIndex(&idxBuf, pw.Entries(), checksum); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "test.pack"), packBuf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "test.idx"), idxBuf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := Open(filepath.Join(dir, "test.pack"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := p.Index().Entries()
+	_, _, r, err := p.Open(objs[0].Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil || !bytes.Equal(data, content) {
+		t.Errorf("read %d bytes after Close, %v", len(data), err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || !bytes.Equal(entries[0].Hash, objs[0].Hash) {
+		t.Errorf("Entries() = %v after Close", entries)
+	}
+
+	var cache deltaBaseCache
+	half := make([]byte, maxCacheSize/2)
+	for offset := int64(0); offset < 3; offset++ {
+		cache.add(&cachedObject{offset: offset, data: half})
+		cache.get(0)
+	}
+	if _, ok := cache.get(0); !ok {
+		t.Error("recently used base was evicted")
+	}
+	if _, ok := cache.get(1); ok {
+		t.Error("least recently used base was kept")
+	}
+	if cache.size != maxCacheSize {
+		t.Errorf("cache size = %d, want %d", cache.size, maxCacheSize)
+	}
+}
+
+// EWAHで圧縮したビット列を展開すると元に戻るか
+func TestEWAHRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		var b Bitset
+		for j := r.Intn(40); j > 0; j-- {
+			// 0だけ、1だけ、ばらばらの語を混ぜる.
+			switch r.Intn(3) {
+			case 0:
+				b = append(b, 0)
+			case 1:
+				b = append(b, ^uint64(0))
+			default:
+				b = append(b, r.Uint64())
+			}
+		}
+		got, n, err := decodeEWAH(encodeEWAH(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != len(encodeEWAH(b)) {
+			t.Errorf("decodeEWAH() read %d bytes, want %d", n, len(encodeEWAH(b)))
+		}
+		for len(b) > 0 && b[len(b)-1] == 0 {
+			b = b[:len(b)-1]
+		}
+		if fmt.Sprint(got) != fmt.Sprint(b) {
+			t.Fatalf("decodeEWAH(encodeEWAH(%x)) = %x", b, got)
+		}
+	}
+}
+
+// 書き出した.bitmapからコミットごとのビット列と種類を読み出せるか
+func TestBitmapRoundTrip(t *testing.T) {
+	var entries []IndexEntry
+	var types []object.Type
+	for i := 0; i < 150; i++ {
+		obj := object.NewObject(object.BlobObject, []byte(fmt.Sprint(i)))
+		entries = append(entries, IndexEntry{Hash: obj.Hash, Offset: int64(12 + i*10)})
+		types = append(types, []object.Type{object.CommitObject, object.TreeObject, object.BlobObject}[i%3])
+	}
+	order := NewPackOrder(entries)
+	for pos := 0; pos < order.Len(); pos++ {
+		if got, ok := order.Position(order.Hash(pos)); !ok || got != pos {
+			t.Fatalf("Position(Hash(%d)) = %d, %v", pos, got, ok)
+		}
+	}
+
+	commits := map[string]Bitset{}
+	for _, pos := range []int{0, 3, 147} {
+		var b Bitset
+		for i := 0; i <= pos; i++ {
+			b.Set(i)
+		}
+		commits[string(order.Hash(pos))] = b
+	}
+	checksum := object.NewObject(object.BlobObject, []byte("pack")).Hash
+	var buf bytes.Buffer
+	if err := WriteBitmap(&buf, order, checksum, types, commits); err != nil {
+		t.Fatal(err)
+	}
+	bm, err := ParseBitmap(buf.Bytes(), order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bm.PackChecksum, checksum) {
+		t.Errorf("PackChecksum = %s, want %s", bm.PackChecksum, checksum)
+	}
+	for hash, want := range commits {
+		got, ok := bm.Reachable([]byte(hash))
+		if !ok || got.Count() != want.Count() || fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("Reachable(%x) = %x, %v, want %x", hash, got, ok, want)
+		}
+	}
+	if _, ok := bm.Reachable(order.Hash(1)); ok {
+		t.Error("Reachable() returned a bitmap for a commit without one")
+	}
+	for pos, want := range types {
+		if got := bm.Type(pos); got != want {
+			t.Errorf("Type(%d) = %s, want %s", pos, got, want)
+		}
+	}
+
+	data := buf.Bytes()
+	data[4] = 2
+	if _, err := ParseBitmap(data, order); !errors.Is(err, ErrInvalidBitmap) {
+		t.Errorf("ParseBitmap() of version 2 error = %v, want %v", err, ErrInvalidBitmap)
+	}
+}
@@ -0,0 +1,180 @@
+package pack
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"sort"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+)
+
+const (
+	// DefaultWindowはWriteObjectsでデルタのベースの候補にする直前のオブジェクトの数.
+	DefaultWindow = 10
+	// DefaultMaxDepthはデルタの連鎖の長さの上限.
+	DefaultMaxDepth = 50
+)
+
+// Writerはパックファイルを書き出す. NewWriterで宣言した数のオブジェクトを書いたあとCloseする.
+type Writer struct {
+	w        io.Writer
+	checksum hash.Hash
+	count    int
+	offset   int64
+	entries  []IndexEntry
+	deltas   int
+	// writtenは書き込み済みのオブジェクトの位置とデルタの深さ.
+	written map[string]writtenObject
+}
+
+type writtenObject struct {
+	offset int64
+	depth  int
+}
+
+// NewWriterはcount個のオブジェクトを持つパックファイルのヘッダをwに書き出す.
+func NewWriter(w io.Writer, count int) (*Writer, error) {
+	pw := &Writer{
+		w:        w,
+		checksum: sha1.New(),
+		count:    count,
+		written:  map[string]writtenObject{},
+	}
+	header := make([]byte, 12)
+	copy(header, packSignature)
+	binary.BigEndian.PutUint32(header[4:], packVersion)
+	binary.BigEndian.PutUint32(header[8:], uint32(count))
+	if err := pw.write(header); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+func (pw *Writer) write(data []byte) error {
+	n, err := pw.w.Write(data)
+	pw.checksum.Write(data[:n])
+	pw.offset += int64(n)
+	return err
+}
+
+// WriteObjectはobjをデルタにせずそのまま書き込む.
+func (pw *Writer) WriteObject(obj *object.Object) error {
+	return pw.writeEntry(obj.Hash, int(obj.Type), nil, obj.Data, 0)
+}
+
+// WriteOfsDeltaはobjを書き込み済みのオブジェクトbaseからのデルタdeltaとして書き込む.
+func (pw *Writer) WriteOfsDelta(obj *object.Object, base sha.SHA1, delta []byte) error {
+	b, ok := pw.written[string(base)]
+	if !ok {
+		return fmt.Errorf("%w : delta base %s has not been written", ErrNotFound, base)
+	}
+	pw.deltas++
+	return pw.writeEntry(obj.Hash, typeOfsDelta, encodeOffset(pw.offset-b.offset), delta, b.depth+1)
+}
+
+// WriteRefDeltaはobjをハッシュで指定したbaseからのデルタdeltaとして書き込む.
+// baseはパックに含まれていなくてもよい(受け取る側が既に持っている前提のthin pack).
+func (pw *Writer) WriteRefDelta(obj *object.Object, base sha.SHA1, delta []byte) error {
+	depth := 1
+	if b, ok := pw.written[string(base)]; ok {
+		depth = b.depth + 1
+	}
+	pw.deltas++
+	return pw.writeEntry(obj.Hash, typeRefDelta, base, delta, depth)
+}
+
+// writeEntryはヘッダ、デルタのベースの指定、zlibで圧縮したdataを1つのオブジェクトとして書き込む.
+func (pw *Writer) writeEntry(hash sha.SHA1, objectType int, baseRef []byte, data []byte, depth int) error {
+	if len(pw.entries) >= pw.count {
+		return fmt.Errorf("%w : more than %d objects", ErrInvalidPack, pw.count)
+	}
+	var buf bytes.Buffer
+	buf.Write(encodeEntryHeader(objectType, int64(len(data))))
+	buf.Write(baseRef)
+	zw := zlib.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	offset := pw.offset
+	if err := pw.write(buf.Bytes()); err != nil {
+		return err
+	}
+	pw.entries = append(pw.entries, IndexEntry{Hash: hash, Offset: offset, CRC32: crc32.ChecksumIEEE(buf.Bytes())})
+	pw.written[string(hash)] = writtenObject{offset: offset, depth: depth}
+	return nil
+}
+
+// WriteObjectsはobjsを似たもの同士が近くに並ぶように並べ替え、直前のwindow個の中で最も小さくなるデルタを使って書き込む.
+// 同じ種類で大きい順に並べるので、新しい版(たいてい大きい)がベースとして残り、古い版がデルタになる.
+func (pw *Writer) WriteObjects(objs []*object.Object, window, maxDepth int) error {
+	sorted := make([]*object.Object, len(objs))
+	copy(sorted, objs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Type != sorted[j].Type {
+			return sorted[i].Type < sorted[j].Type
+		}
+		return sorted[i].Size > sorted[j].Size
+	})
+
+	for i, obj := range sorted {
+		var base *object.Object
+		var best []byte
+		for j := i - 1; j >= 0 && j >= i-window; j-- {
+			candidate := sorted[j]
+			if candidate.Type != obj.Type || pw.written[string(candidate.Hash)].depth >= maxDepth {
+				continue
+			}
+			// 大きさが大きく違えば良いデルタにならない.
+			if candidate.Size/2 > obj.Size+deltaBlockSize {
+				continue
+			}
+			delta := ComputeDelta(candidate.Data, obj.Data)
+			if len(delta) < obj.Size/2 && (best == nil || len(delta) < len(best)) {
+				base, best = candidate, delta
+			}
+		}
+		var err error
+		if base == nil {
+			err = pw.WriteObject(obj)
+		} else {
+			err = pw.WriteOfsDelta(obj, base.Hash, best)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Entriesは書き込んだオブジェクトの索引のエントリを返す.
+func (pw *Writer) Entries() []IndexEntry {
+	return pw.entries
+}
+
+// Deltasはデルタとして書き込んだオブジェクトの数を返す.
+func (pw *Writer) Deltas() int {
+	return pw.deltas
+}
+
+// Closeは末尾にチェックサムを書き込んでそれを返す. 宣言した数のオブジェクトが書かれていなければエラーを返す.
+func (pw *Writer) Close() (sha.SHA1, error) {
+	if len(pw.entries) != pw.count {
+		return nil, fmt.Errorf("%w : wrote %d objects but header says %d", ErrInvalidPack, len(pw.entries), pw.count)
+	}
+	sum := pw.checksum.Sum(nil)
+	if _, err := pw.w.Write(sum); err != nil {
+		return nil, err
+	}
+	return sha.SHA1(sum), nil
+}
@@ -0,0 +1,252 @@
+package pathspec
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/kanon1343/fsegit/wildmatch"
+)
+
+var (
+	ErrUnknownMagic  = errors.New("unknown pathspec magic")
+	ErrOutsideRepo   = errors.New("pathspec is outside repository")
+	ErrInvalidSyntax = errors.New("invalid pathspec")
+)
+
+// Magicはパススペックの":(...)"で指定する修飾子を表す.
+type Magic uint
+
+const (
+	MagicGlob Magic = 1 << iota
+	MagicICase
+	MagicTop
+	MagicExclude
+	MagicLiteral
+)
+
+var magicNames = map[string]Magic{
+	"glob":    MagicGlob,
+	"icase":   MagicICase,
+	"top":     MagicTop,
+	"exclude": MagicExclude,
+	"literal": MagicLiteral,
+}
+
+// Itemはパススペック1つ分を表す.
+type Item struct {
+	// Patternはリポジトリのルートからのパターン.
+	Pattern string
+	Magic   Magic
+	// nowildcardLenはPatternの先頭からワイルドカードを含まない部分の長さ.
+	nowildcardLen int
+}
+
+// Pathspecは複数のパススペックをまとめたもの. 空の場合は全てのパスにマッチする.
+type Pathspec struct {
+	items []Item
+}
+
+// Parseはargsをパススペックとして解釈する.
+// prefixはカレントディレクトリのリポジトリルートからの相対パスで、:(top)でない限りパターンの前に付加される.
+func Parse(prefix string, args []string) (*Pathspec, error) {
+	p := &Pathspec{}
+	for _, arg := range args {
+		item, err := parseItem(prefix, arg)
+		if err != nil {
+			return nil, err
+		}
+		p.items = append(p.items, item)
+	}
+	return p, nil
+}
+
+func parseItem(prefix, arg string) (Item, error) {
+	var magic Magic
+	pattern := arg
+
+	if strings.HasPrefix(pattern, ":(") {
+		end := strings.IndexByte(pattern, ')')
+		if end < 0 {
+			return Item{}, fmt.Errorf("%w : %s", ErrInvalidSyntax, arg)
+		}
+		for _, name := range strings.Split(pattern[2:end], ",") {
+			if name == "" {
+				continue
+			}
+			m, ok := magicNames[name]
+			if !ok {
+				return Item{}, fmt.Errorf("%w : %s", ErrUnknownMagic, name)
+			}
+			magic |= m
+		}
+		pattern = pattern[end+1:]
+	} else if strings.HasPrefix(pattern, ":") {
+		// ":/", ":!", ":^" の短縮形.
+		i := 1
+	short:
+		for ; i < len(pattern); i++ {
+			switch pattern[i] {
+			case '/':
+				magic |= MagicTop
+			case '!', '^':
+				magic |= MagicExclude
+			case ':':
+				i++
+				break short
+			default:
+				break short
+			}
+		}
+		pattern = pattern[i:]
+	}
+
+	if magic&MagicGlob != 0 && magic&MagicLiteral != 0 {
+		return Item{}, fmt.Errorf("%w : glob and literal are incompatible", ErrInvalidSyntax)
+	}
+
+	// Windowsの"\"区切りのパスも、インデックスと同じ"/"区切りにそろえる.
+	pattern = filepath.ToSlash(pattern)
+	if magic&MagicTop == 0 && prefix != "" {
+		pattern = prefix + "/" + pattern
+	}
+	pattern, err := normalize(pattern)
+	if err != nil {
+		return Item{}, fmt.Errorf("%w : %s", err, arg)
+	}
+
+	item := Item{
+		Pattern:       pattern,
+		Magic:         magic,
+		nowildcardLen: len(pattern),
+	}
+	if magic&MagicLiteral == 0 {
+		if i := strings.IndexAny(pattern, "*?[\\"); i >= 0 {
+			item.nowildcardLen = i
+		}
+	}
+	return item, nil
+}
+
+// normalizeはパターン中の"."や".."を解決する. 末尾の"/"は残す.
+func normalize(pattern string) (string, error) {
+	trailingSlash := strings.HasSuffix(pattern, "/")
+	cleaned := path.Clean("/" + pattern)
+	if strings.HasPrefix(path.Clean(pattern), "..") {
+		return "", ErrOutsideRepo
+	}
+	cleaned = strings.TrimPrefix(cleaned, "/")
+	if trailingSlash && cleaned != "" {
+		cleaned += "/"
+	}
+	return cleaned, nil
+}
+
+// Itemsはパススペックの各要素を返す.
+func (p *Pathspec) Items() []Item {
+	return p.items
+}
+
+// Emptyはパススペックが何も指定されていないかを返す.
+func (p *Pathspec) Empty() bool {
+	return p == nil || len(p.items) == 0
+}
+
+// Matchはpathがパススペックにマッチするかを返す.
+func (p *Pathspec) Match(name string) bool {
+	if p.Empty() {
+		return true
+	}
+	included := false
+	hasInclude := false
+	for _, item := range p.items {
+		if item.Magic&MagicExclude != 0 {
+			continue
+		}
+		hasInclude = true
+		if item.match(name) {
+			included = true
+			break
+		}
+	}
+	if hasInclude && !included {
+		return false
+	}
+	for _, item := range p.items {
+		if item.Magic&MagicExclude != 0 && item.match(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchDirはdir以下のパスがマッチし得るかを返す. WalkTreeの枝刈りに使う.
+func (p *Pathspec) MatchDir(dir string) bool {
+	if p.Empty() {
+		return true
+	}
+	for _, item := range p.items {
+		if item.Magic&MagicExclude != 0 && item.nowildcardLen == len(item.Pattern) && item.matchPrefix(dir) {
+			return false
+		}
+	}
+	hasInclude := false
+	for _, item := range p.items {
+		if item.Magic&MagicExclude != 0 {
+			continue
+		}
+		hasInclude = true
+		if item.couldMatchUnder(dir) {
+			return true
+		}
+	}
+	return !hasInclude
+}
+
+func (item Item) match(name string) bool {
+	if item.matchPrefix(name) {
+		return true
+	}
+	if item.nowildcardLen == len(item.Pattern) {
+		return false
+	}
+	// gitと同様、:(glob)でなければ"*"は"/"にもマッチする.
+	var flags wildmatch.Flag
+	if item.Magic&MagicGlob != 0 {
+		flags |= wildmatch.Pathname
+	}
+	if item.Magic&MagicICase != 0 {
+		flags |= wildmatch.CaseFold
+	}
+	return wildmatch.Match(item.Pattern, name, flags)
+}
+
+// matchPrefixはワイルドカードを使わずにnameがパターンのディレクトリ以下か、パターンそのものかを判定する.
+func (item Item) matchPrefix(name string) bool {
+	pattern := item.Pattern[:item.nowildcardLen]
+	if item.nowildcardLen != len(item.Pattern) {
+		return false
+	}
+	if item.Magic&MagicICase != 0 {
+		pattern, name = strings.ToLower(pattern), strings.ToLower(name)
+	}
+	if pattern == "" {
+		return true
+	}
+	if strings.HasSuffix(pattern, "/") {
+		return strings.HasPrefix(name, pattern)
+	}
+	return name == pattern || strings.HasPrefix(name, pattern+"/")
+}
+
+// couldMatchUnderはdir以下のパスにこのパターンがマッチし得るかを返す.
+func (item Item) couldMatchUnder(dir string) bool {
+	literal := item.Pattern[:item.nowildcardLen]
+	dir += "/"
+	if item.Magic&MagicICase != 0 {
+		literal, dir = strings.ToLower(literal), strings.ToLower(dir)
+	}
+	return strings.HasPrefix(literal, dir) || strings.HasPrefix(dir, literal)
+}
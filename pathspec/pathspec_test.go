@@ -0,0 +1,69 @@
+package pathspec
+
+import "testing"
+
+func TestPathspec_Match(t *testing.T) {
+	tests := []struct {
+		prefix string
+		args   []string
+		path   string
+		want   bool
+	}{
+		{"", nil, "a/b.go", true},
+		{"", []string{"."}, "a/b.go", true},
+		{"", []string{"a"}, "a/b.go", true},
+		{"", []string{"a"}, "ab/c.go", false},
+		{"", []string{"a/"}, "a/b.go", true},
+		{"", []string{"a/*.go"}, "a/b.go", true},
+		{"", []string{"*.go"}, "a/b/c.go", true},
+		{"", []string{":(glob)*.go"}, "a/b/c.go", false},
+		{"", []string{":(glob)**/*.go"}, "a/b/c.go", true},
+		{"", []string{":(glob,icase)A/*.GO"}, "a/b.go", true},
+		{"", []string{":(literal)a/*.go"}, "a/b.go", false},
+		{"", []string{":(literal)a/*.go"}, "a/*.go", true},
+		{"", []string{":(icase)README"}, "readme", true},
+		{"sub", []string{"x.txt"}, "sub/x.txt", true},
+		{"sub", []string{"x.txt"}, "x.txt", false},
+		{"sub", []string{":(top)x.txt"}, "x.txt", true},
+		{"sub", []string{":/x.txt"}, "x.txt", true},
+		{"sub", []string{"../x.txt"}, "x.txt", true},
+		{"", []string{":(exclude)a"}, "a/b.go", false},
+		{"", []string{":!a"}, "b/c.go", true},
+		{"", []string{"a", ":^a/b.go"}, "a/b.go", false},
+		{"", []string{"a", ":^a/b.go"}, "a/c.go", true},
+	}
+	for _, tt := range tests {
+		p, err := Parse(tt.prefix, tt.args)
+		if err != nil {
+			t.Fatalf("Parse(%q, %q) error: %v", tt.prefix, tt.args, err)
+		}
+		if got := p.Match(tt.path); got != tt.want {
+			t.Errorf("Parse(%q, %q).Match(%q) = %v, want %v", tt.prefix, tt.args, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestPathspec_MatchDir(t *testing.T) {
+	p, err := Parse("", []string{"src/cmd/*.go", ":!vendor"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for dir, want := range map[string]bool{
+		"src":     true,
+		"src/cmd": true,
+		"docs":    false,
+		"vendor":  false,
+	} {
+		if got := p.MatchDir(dir); got != want {
+			t.Errorf("MatchDir(%q) = %v, want %v", dir, got, want)
+		}
+	}
+}
+
+func TestParse_Error(t *testing.T) {
+	for _, arg := range []string{":(foo)a", ":(glob,literal)a", "../a", ":(top"} {
+		if _, err := Parse("", []string{arg}); err == nil {
+			t.Errorf("Parse(%q) should fail", arg)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package repo
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/ignore"
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/pathspec"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+)
+
+// AddOptionsはAddの設定.
+type AddOptions struct {
+	// Allなら新しいファイルと削除したファイルも追加し、パススペックがなければ作業ツリー全体を対象にする.
+	All bool
+	// Updateなら追跡しているファイルの変更と削除だけを追加し、新しいファイルは追加しない.
+	Update bool
+	// Forceなら無視しているファイルも追加する.
+	Force bool
+	// Prefixはパススペックを解釈する基準のディレクトリ. 作業ツリーのルートからの"/"区切りのパスで、空ならルート.
+	Prefix string
+}
+
+// Addはpathspecsにマッチするファイルの今の内容をブロブとして書き込み、インデックスに記録する.
+// 作業ツリーからなくなった追跡しているパスはインデックスから取り除く. ブロブは複数のファイルを並列に書き込み、
+// インデックスは最後に1度だけ書き込む.
+// 何にもマッチしなかったパススペックのうち、無視しているファイルを指すものは他を追加した上でignoredとして返す.
+func (r *Repository) Add(pathspecs []string, opts AddOptions) (ignored []string, err error) {
+	if len(pathspecs) == 0 && !opts.All && !opts.Update {
+		return nil, i18n.Errorf("nothing specified, nothing added")
+	}
+	if opts.All && opts.Update {
+		return nil, i18n.Errorf("-A and -u are mutually incompatible")
+	}
+	client := r.client
+	trustFileMode, err := client.TrustFileMode()
+	if err != nil {
+		return nil, err
+	}
+	trustSymlinks, err := client.TrustSymlinks()
+	if err != nil {
+		return nil, err
+	}
+	index, err := client.ReadIndex()
+	if err != nil {
+		return nil, err
+	}
+	ignoreMatcher, err := client.IgnoreMatcher()
+	if err != nil {
+		return nil, err
+	}
+	ps, err := pathspec.Parse(opts.Prefix, pathspecs)
+	if err != nil {
+		return nil, err
+	}
+	// 各パススペックが何かにマッチしたかを確かめるため、1つずつも解釈しておく.
+	specs := make([]*pathspec.Pathspec, len(pathspecs))
+	for i, arg := range pathspecs {
+		if specs[i], err = pathspec.Parse(opts.Prefix, []string{arg}); err != nil {
+			return nil, err
+		}
+	}
+	matched := make([]bool, len(pathspecs))
+	mark := func(path string) {
+		for i, spec := range specs {
+			if !matched[i] && spec.Match(path) {
+				matched[i] = true
+			}
+		}
+	}
+
+	// インデックスと同じ時刻以降に書き換えられたファイルは、mtimeとサイズが同じでも内容が違い得る.
+	var indexTime int64
+	if info, err := os.Stat(client.IndexFile()); err == nil {
+		indexTime = info.ModTime().UnixNano()
+	}
+	// 書き込むファイルは集めておき、最後にまとめて並列に書き込む.
+	var blobs []*addBlob
+	stage := func(path string, info os.FileInfo) error {
+		old := index.Entry(path)
+		if old != nil && old.Size == uint32(info.Size()) && old.MTime.Equal(info.ModTime()) &&
+			info.ModTime().UnixNano() < indexTime && old.Mode == store.FileModeOf(info) {
+			return nil
+		}
+		blobs = append(blobs, &addBlob{path: path, info: info, old: old})
+		return nil
+	}
+
+	// 追跡しているファイルの変更と削除.
+	tracked := map[string]struct{}{}
+	var trackedPaths []string
+	for _, entry := range index.Entries {
+		if _, ok := tracked[entry.Path]; !ok {
+			tracked[entry.Path] = struct{}{}
+			trackedPaths = append(trackedPaths, entry.Path)
+		}
+	}
+	for _, path := range trackedPaths {
+		if !ps.Match(path) {
+			continue
+		}
+		mark(path)
+		info, err := os.Lstat(filepath.Join(client.WorkTree(), filepath.FromSlash(path)))
+		if entry := index.Entry(path); entry != nil && entry.Mode == object.ModeGitlink && err == nil && info.IsDir() {
+			// サブモジュールは取り出したHEADのコミットを記録する. 取り出していなければそのままにする.
+			head, err := client.SubmoduleHead(path)
+			if err != nil {
+				return nil, err
+			}
+			if head != nil && !bytes.Equal(head, entry.Hash) {
+				updated := *entry
+				updated.Hash = head
+				index.Add(&updated)
+			}
+			continue
+		}
+		if os.IsNotExist(err) || (err == nil && info.IsDir()) {
+			index.Remove(path)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := stage(path, info); err != nil {
+			return nil, err
+		}
+	}
+
+	// 追跡していないファイル.
+	if !opts.Update {
+		err := client.WalkWorktree(func(path string, isDir bool) bool {
+			if !opts.Force && ignoreMatcher.Ignored(path, isDir) {
+				return true
+			}
+			if isDir {
+				return !ps.MatchDir(path)
+			}
+			return !ps.Match(path)
+		}, func(path string, info os.FileInfo) error {
+			if _, ok := tracked[path]; ok {
+				return nil
+			}
+			mark(path)
+			return stage(path, info)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i, arg := range pathspecs {
+		if matched[i] {
+			continue
+		}
+		if !r.isIgnoredArg(ignoreMatcher, opts.Prefix, arg) {
+			return nil, i18n.Errorf("pathspec '%s' did not match any files", arg)
+		}
+		ignored = append(ignored, arg)
+	}
+	if err := writeBlobs(client, blobs); err != nil {
+		return nil, err
+	}
+	entries := make([]*store.IndexEntry, len(blobs))
+	for i, blob := range blobs {
+		entries[i] = store.NewIndexEntry(blob.path, blob.info, blob.hash, blob.old, trustFileMode, trustSymlinks)
+	}
+	index.AddEntries(entries)
+	if err := client.WriteIndex(index); err != nil {
+		return nil, err
+	}
+	return ignored, nil
+}
+
+// addBlobはAddでブロブとして書き込む作業ツリーのファイル.
+type addBlob struct {
+	path string
+	info os.FileInfo
+	// oldはインデックスにある元のエントリ. なければnil.
+	old *store.IndexEntry
+	// hashは書き込んだブロブのハッシュ. writeBlobsが埋める.
+	hash sha.SHA1
+}
+
+// writeBlobsはblobsのファイルをGOMAXPROCS個までのゴルーチンで並列にハッシュを計算して圧縮し、
+// ブロブとして書き込む. どれかが失敗すれば残りは書き込まずに最初のエラーを返す.
+func writeBlobs(client *store.Client, blobs []*addBlob) error {
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(blobs) {
+		workers = len(blobs)
+	}
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		next     int
+		firstErr error
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				mu.Lock()
+				if firstErr != nil || next == len(blobs) {
+					mu.Unlock()
+					return
+				}
+				blob := blobs[next]
+				next++
+				mu.Unlock()
+
+				hash, err := client.WriteWorktreeBlob(blob.path, blob.info)
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+					return
+				}
+				blob.hash = hash
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// isIgnoredArgはprefixを基準にしたargが作業ツリーにある無視しているパスかを返す.
+func (r *Repository) isIgnoredArg(ignoreMatcher *ignore.Matcher, prefix, arg string) bool {
+	name := arg
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(r.client.WorkTree(), filepath.FromSlash(prefix), name)
+	}
+	info, err := os.Lstat(name)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(r.client.WorkTree(), name)
+	if err != nil {
+		return false
+	}
+	rel = path.Clean(filepath.ToSlash(rel))
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+		return false
+	}
+	return ignoreMatcher.Ignored(rel, info.IsDir())
+}
@@ -0,0 +1,51 @@
+package repo
+
+import (
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/revparse"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+)
+
+// Branchesはrefs/heads以下のブランチを名前の順に返す.
+func (r *Repository) Branches() ([]store.Ref, error) {
+	return r.client.ListBranches()
+}
+
+// CreateBranchはstartPointのコミットを指すブランチnameを作る. startPointが空ならHEADのコミットを指す.
+func (r *Repository) CreateBranch(name, startPoint string) error {
+	var start sha.SHA1
+	var err error
+	if startPoint == "" {
+		startPoint = "HEAD"
+		start, err = r.client.ResolveHeadCommit()
+	} else {
+		start, err = revparse.Resolve(r.client, startPoint)
+	}
+	if err != nil {
+		return err
+	}
+	return r.client.CreateBranch(name, start, "branch: Created from "+startPoint)
+}
+
+// DeleteBranchはブランチnameを削除し、削除前に指していたハッシュを返す.
+// HEADから辿れないコミットがあるブランチは、forceでなければstore.ErrBranchNotMergedを返して残す.
+func (r *Repository) DeleteBranch(name string, force bool) (sha.SHA1, error) {
+	return r.client.DeleteBranch(name, force)
+}
+
+// RenameBranchはブランチoldNameの名前をnewNameに変える. oldNameが空なら現在のブランチの名前を変える.
+// HEADがそのブランチを指していれば、HEADも新しい名前に向ける.
+func (r *Repository) RenameBranch(oldName, newName string) error {
+	if oldName == "" {
+		head, err := r.client.ReadHead()
+		if err != nil {
+			return err
+		}
+		if head.Detached() {
+			return i18n.Errorf("cannot rename the current branch while not on any")
+		}
+		oldName = head.ShortBranch()
+	}
+	return r.client.RenameBranch(oldName, newName)
+}
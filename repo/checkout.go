@@ -0,0 +1,78 @@
+package repo
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/revparse"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+)
+
+// CheckoutOptionsはCheckoutの設定.
+type CheckoutOptions struct {
+	// Forceなら作業ツリーとインデックスの変更を捨てて切り替える.
+	Force bool
+}
+
+// CheckoutResultはCheckoutの結果.
+type CheckoutResult struct {
+	// Previousは切り替える前のHEAD.
+	Previous *store.Head
+	// Branchはチェックアウトしたブランチの完全な名前(refs/heads/main). HEADを切り離した場合は空.
+	Branch string
+	// Commitはチェックアウトしたコミット.
+	Commit sha.SHA1
+	// Orphanedは切り離されたHEADから移動したことで、どのブランチからも辿れなくなったコミット.
+	Orphaned []*object.Commit
+}
+
+// Checkoutは作業ツリーとインデックスをnameのブランチかコミットに合わせる.
+// nameがrefs/heads以下のブランチならHEADをそのブランチに向け、そうでなければrev-parseと同じ書き方の
+// リビジョンとして解決してHEADをそのコミットで切り離す. 変更のあるファイルや追跡していないファイルを
+// 書き換えることになる場合は、opts.Forceでなければ何も変えずにstore.ErrWouldOverwriteを返す.
+func (r *Repository) Checkout(name string, opts CheckoutOptions) (*CheckoutResult, error) {
+	client := r.client
+	old, err := client.ReadHead()
+	if err != nil {
+		return nil, err
+	}
+
+	branch := "refs/heads/" + name
+	target, err := client.ResolveRef(branch)
+	if err != nil {
+		branch = ""
+		if target, err = revparse.Resolve(client, name); err != nil {
+			return nil, err
+		}
+	}
+	if target, err = client.PeelToCommit(target); err != nil {
+		return nil, err
+	}
+
+	if err := client.CheckoutCommit(target, store.CheckoutOptions{Force: opts.Force}); err != nil {
+		return nil, err
+	}
+	from := old.ShortBranch()
+	if old.Detached() {
+		from = old.Hash.String()
+	}
+	message := fmt.Sprintf("checkout: moving from %s to %s", from, name)
+	if branch != "" {
+		err = client.AttachHead(branch, message)
+	} else {
+		err = client.DetachHead(target, message)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &CheckoutResult{Previous: old, Branch: branch, Commit: target}
+	if old.Detached() && !bytes.Equal(old.Hash, target) {
+		if result.Orphaned, err = client.OrphanedCommits(old.Hash); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,209 @@
+package repo
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+
+	"github.com/kanon1343/fsegit/i18n"
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+)
+
+// CommitOptionsはCommitの設定.
+type CommitOptions struct {
+	// Messageはコミットメッセージ. 空で、衝突で止まったマージの途中なら保存してあるマージのメッセージを使う.
+	Message string
+	// AuthorとCommitterを指定しなければ、設定と環境変数から作る.
+	Author    *object.Signature
+	Committer *object.Signature
+	// Allなら、コミットする前に追跡しているファイルの変更と削除をインデックスに追加する(add -uと同じ).
+	// 新しいファイルは追加しない.
+	All bool
+	// AllowEmptyなら、ツリーが親のツリーと同じでもコミットする.
+	AllowEmpty bool
+	// Amendなら、新しいコミットでHEADのコミットを置き換える. 親はHEADのコミットの親にし、Messageが空なら
+	// HEADのコミットのメッセージを、Authorを指定しなければHEADのコミットの作者を使う.
+	Amend bool
+	// Signなら、Client.Signで作った署名をgpgsigヘッダとしてコミットに付ける.
+	Sign bool
+}
+
+// ErrNothingToCommitは、コミットのツリーが親のツリー(親がなければ空のツリー)と同じで、何も変更しないときに返す.
+var ErrNothingToCommit = errors.New("nothing to commit")
+
+// Commitはインデックスの内容からコミットを作り、現在のブランチ(または切り離されたHEAD)をそこへ進める.
+// マージの途中なら取り込んだコミットも親にして、マージの状態を消す. 作ったコミットを返す.
+// opts.Amendなら、置き換えたコミットから新しいコミットへの更新としてreflogに記録する.
+// メッセージが空ならコミットせずにエラーを返す. opts.AllowEmptyでなく、マージでもないのにツリーが親と同じなら
+// ErrNothingToCommitを返す. 作者かコミッターが分からなければstore.ErrNoIdentityを返す.
+func (r *Repository) Commit(opts CommitOptions) (*object.Commit, error) {
+	client := r.client
+	mergeState, err := client.ReadMergeState()
+	if err != nil {
+		return nil, err
+	}
+	var amended *object.Commit
+	if opts.Amend {
+		if mergeState != nil {
+			return nil, i18n.Errorf("you are in the middle of a merge -- cannot amend")
+		}
+		head, err := client.ReadHead()
+		if err != nil {
+			return nil, err
+		}
+		if head.Unborn() {
+			return nil, i18n.Errorf("you have nothing to amend")
+		}
+		if amended, err = r.HeadCommit(); err != nil {
+			return nil, err
+		}
+		if opts.Author == nil {
+			opts.Author = &amended.Author
+		}
+	}
+	message := opts.Message
+	switch {
+	case message == "" && amended != nil:
+		message = amended.Message
+	case message == "" && mergeState != nil:
+		message = mergeState.Message
+	}
+	message = CleanupMessage(message)
+	if message == "" {
+		return nil, i18n.Errorf("aborting commit due to empty commit message")
+	}
+
+	if opts.All {
+		if _, err := r.Add(nil, AddOptions{Update: true}); err != nil {
+			return nil, err
+		}
+	}
+	index, err := client.ReadIndex()
+	if err != nil {
+		return nil, err
+	}
+	tree, err := client.WriteTree(index)
+	if err != nil {
+		return nil, err
+	}
+	// 組み立てたツリーをTREE拡張としてインデックスに残し、次のコミットで使う.
+	if err := client.WriteIndex(index); err != nil {
+		return nil, err
+	}
+	var parents []sha.SHA1
+	if amended != nil {
+		parents = amended.Parents
+	} else if parents, err = client.NextCommitParents(); err != nil {
+		return nil, err
+	}
+	if !opts.AllowEmpty && len(parents) <= 1 {
+		parentTree := object.NewObject(object.TreeObject, nil).Hash
+		if len(parents) == 1 {
+			parent, err := client.GetCommit(parents[0])
+			if err != nil {
+				return nil, err
+			}
+			parentTree = parent.Tree
+		}
+		if bytes.Equal(tree, parentTree) {
+			return nil, ErrNothingToCommit
+		}
+	}
+	author, committer, err := r.identity(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	commit := &object.Commit{
+		Tree:      tree,
+		Parents:   parents,
+		Author:    author,
+		Committer: committer,
+		Message:   message,
+	}
+	if opts.Sign {
+		signature, err := client.Sign(commit.Encode())
+		if err != nil {
+			return nil, err
+		}
+		commit.ExtraHeaders = append(commit.ExtraHeaders, object.ExtraHeader{Key: "gpgsig", Value: strings.TrimSuffix(signature, "\n")})
+	}
+	if commit.Hash, err = client.StoreRaw(object.CommitObject, commit.Encode()); err != nil {
+		return nil, err
+	}
+	reflogMessage := "commit: "
+	switch {
+	case amended != nil:
+		reflogMessage = "commit (amend): "
+	case len(parents) == 0:
+		reflogMessage = "commit (initial): "
+	case len(parents) > 1:
+		reflogMessage = "commit (merge): "
+	}
+	if err := client.UpdateHead(commit.Hash, reflogMessage+commit.Subject()); err != nil {
+		return nil, err
+	}
+	if err := client.ClearMergeState(); err != nil {
+		return nil, err
+	}
+	return commit, nil
+}
+
+// HeadCommitはHEADの指すコミットを返す. 浅い履歴の境界のコミットでも親を切らずに返す.
+// まだコミットのないブランチにいるならエラーを返す.
+func (r *Repository) HeadCommit() (*object.Commit, error) {
+	head, err := r.client.ReadHead()
+	if err != nil {
+		return nil, err
+	}
+	if head.Unborn() {
+		return nil, i18n.Errorf("your current branch '%s' does not have any commits yet", head.ShortBranch())
+	}
+	obj, err := r.client.GetObject(head.Hash)
+	if err != nil {
+		return nil, err
+	}
+	return object.NewCommit(obj)
+}
+
+// identityはoptsで指定されていない作者とコミッターを設定と環境変数から作る.
+func (r *Repository) identity(opts CommitOptions) (author, committer object.Signature, err error) {
+	if opts.Author != nil {
+		author = *opts.Author
+	} else if author, err = r.client.Identity(store.Author); err != nil {
+		return author, committer, err
+	}
+	if opts.Committer != nil {
+		committer = *opts.Committer
+	} else if committer, err = r.client.Identity(store.Committer); err != nil {
+		return author, committer, err
+	}
+	return author, committer, nil
+}
+
+// CleanupMessageは各行の末尾の空白と前後の空行を取り除き、末尾に改行を付ける. 空のメッセージは空文字列になる.
+func CleanupMessage(message string) string {
+	lines := strings.Split(message, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+	message = strings.Trim(strings.Join(lines, "\n"), "\n")
+	if message == "" {
+		return ""
+	}
+	return message + "\n"
+}
+
+// StripCommentsは'#'で始まる行を取り除く. エディタで編集したメッセージから説明の行を消すのに使う.
+func StripComments(message string) string {
+	lines := strings.SplitAfter(message, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "#") {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "")
+}
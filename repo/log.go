@@ -0,0 +1,88 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/revparse"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+)
+
+// LogOptionsはLogの設定.
+type LogOptions struct {
+	// Revisionは履歴を辿り始めるリビジョン. rev-parseと同じ書き方ができ、空ならHEAD.
+	Revision string
+	// MaxCountは返すコミットの数の上限. 0なら制限しない.
+	MaxCount int
+	// Orderはコミットを並べる順番.
+	Order store.WalkOrder
+	// Pathsを指定すると、マッチするファイルを変えたコミットだけを返す. gitと同じく履歴を単純化し、
+	// マッチするファイルを親の1つと同じにしたコミットは返さず、マージではその親の側だけを辿る.
+	// 順番はOrderによらずstore.WalkOrderTopoになる.
+	Paths store.TreeFilter
+	// Followを指定すると、Pathsの代わりにこのパスのファイルを変えたコミットだけを、名前の変更を遡って返す.
+	// 名前の変更はstore.DefaultRenameThreshold以上似ていれば認める. 順番はOrderに従う.
+	Follow string
+}
+
+// Logはopts.Revisionから辿れるコミットを返す. 注釈付きタグは指すコミットまで辿る.
+// Revisionが空でHEADのブランチにまだコミットがなければstore.ErrUnbornBranchを返す.
+func (r *Repository) Log(opts LogOptions) ([]*object.Commit, error) {
+	return r.LogContext(context.Background(), opts)
+}
+
+// LogContextはLogと同じだが、ctxが取り消されたらそこで辿るのをやめてctx.Err()を返す.
+func (r *Repository) LogContext(ctx context.Context, opts LogOptions) ([]*object.Commit, error) {
+	start, err := r.resolveCommit(opts.Revision)
+	if err != nil {
+		return nil, err
+	}
+
+	var commits []*object.Commit
+	if opts.Follow != "" {
+		err = r.client.FollowHistoryContext(ctx, start, opts.Follow, store.DefaultRenameThreshold, store.WalkHistoryOpts{Order: opts.Order}, func(commit *object.Commit) error {
+			commits = append(commits, commit)
+			if len(commits) == opts.MaxCount {
+				return object.ErrStopWalk
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return commits, nil
+	}
+	if opts.Order == store.WalkOrderTopo || opts.Paths != nil {
+		if commits, err = r.client.TopoSortHistoryContext(ctx, []sha.SHA1{start}, opts.Paths); err != nil {
+			return nil, err
+		}
+		if opts.MaxCount > 0 && opts.MaxCount < len(commits) {
+			commits = commits[:opts.MaxCount]
+		}
+		return commits, nil
+	}
+	err = r.client.WalkHistoryContext(ctx, start, store.WalkHistoryOpts{Order: opts.Order}, func(commit *object.Commit) error {
+		commits = append(commits, commit)
+		if len(commits) == opts.MaxCount {
+			return object.ErrStopWalk
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return commits, nil
+}
+
+// resolveCommitはrevisionをコミットのハッシュに解決する. 空ならHEADのコミットを返す.
+func (r *Repository) resolveCommit(revision string) (sha.SHA1, error) {
+	if revision == "" {
+		return r.client.ResolveHeadCommit()
+	}
+	hash, err := revparse.Resolve(r.client, revision)
+	if err != nil {
+		return nil, err
+	}
+	return r.client.PeelToCommit(hash)
+}
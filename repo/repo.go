@@ -0,0 +1,66 @@
+// Package repoはfsegitを他のGoプログラムに組み込んで使うための入口.
+// init、add、commit、log、checkout、branch、statusと同じ操作を、出力を書き出さずに結果を返すGoのAPIとして提供する.
+// より細かい操作はClientで得られる*store.Clientを使う.
+package repo
+
+import (
+	"github.com/kanon1343/fsegit/store"
+)
+
+// Repositoryは開いたリポジトリを表す.
+type Repository struct {
+	client *store.Client
+}
+
+// Openはdirか、その親ディレクトリにあるリポジトリを開く.
+func Open(dir string) (*Repository, error) {
+	return OpenWithOptions(dir, store.Options{})
+}
+
+// OpenWithOptionsはoptsで管理ディレクトリや作業ツリーの場所を指定してリポジトリを開く.
+func OpenWithOptions(dir string, opts store.Options) (*Repository, error) {
+	client, err := store.NewClientWithOptions(dir, opts)
+	if err != nil {
+		return nil, err
+	}
+	return New(client), nil
+}
+
+// Newは既に開いているclientのリポジトリを返す.
+func New(client *store.Client) *Repository {
+	return &Repository{client: client}
+}
+
+// Initはdirに空のリポジトリを作って開く. 既にリポジトリがあれば足りないディレクトリだけを作り、reinitializedをtrueにする.
+func Init(dir string, opts store.InitOptions) (r *Repository, reinitialized bool, err error) {
+	client, reinitialized, err := store.Init(dir, opts)
+	if err != nil {
+		return nil, false, err
+	}
+	return New(client), reinitialized, nil
+}
+
+// Clientはリポジトリを操作する*store.Clientを返す.
+func (r *Repository) Client() *store.Client {
+	return r.client
+}
+
+// GitDirは管理ディレクトリのパスを返す.
+func (r *Repository) GitDir() string {
+	return r.client.GitDir()
+}
+
+// WorkTreeは作業ツリーのルートのパスを返す. ベアリポジトリなら空.
+func (r *Repository) WorkTree() string {
+	return r.client.WorkTree()
+}
+
+// Headは現在のHEADを返す.
+func (r *Repository) Head() (*store.Head, error) {
+	return r.client.ReadHead()
+}
+
+// StatusはHEADとインデックス、インデックスと作業ツリーの差分と、追跡していないファイルを返す.
+func (r *Repository) Status() (*store.Status, error) {
+	return r.client.Status()
+}
@@ -0,0 +1,382 @@
+package repo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/store"
+)
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func commit(t *testing.T, r *Repository, message string, when int64) *object.Commit {
+	t.Helper()
+	sig := &object.Signature{Name: "fsegit", Email: "fsegit@example.com", When: time.Unix(when, 0).UTC()}
+	c, err := r.Commit(CommitOptions{Message: message, Author: sig, Committer: sig})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// CLIを使わずに、作ったリポジトリへ追加、コミット、ブランチの作成、チェックアウト、履歴の取得ができるか
+func TestRepository(t *testing.T) {
+	dir := t.TempDir()
+	r, reinitialized, err := Init(dir, store.InitOptions{InitialBranch: "main"})
+	if err != nil || reinitialized {
+		t.Fatalf("Init() = %v, %v", reinitialized, err)
+	}
+	if _, err := r.Log(LogOptions{}); !errors.Is(err, store.ErrUnbornBranch) {
+		t.Errorf("Log() on unborn branch error = %v, want %v", err, store.ErrUnbornBranch)
+	}
+
+	writeFile(t, dir, "a.txt", "a\n")
+	writeFile(t, dir, "sub/b.txt", "b\n")
+	writeFile(t, dir, ".gitignore", "*.log\n")
+	writeFile(t, dir, "debug.log", "log\n")
+	if ignored, err := r.Add([]string{"."}, AddOptions{}); err != nil || len(ignored) != 0 {
+		t.Fatalf("Add(.) = %v, %v", ignored, err)
+	}
+	ignored, err := r.Add([]string{"debug.log"}, AddOptions{})
+	if err != nil || len(ignored) != 1 || ignored[0] != "debug.log" {
+		t.Errorf("Add(debug.log) = %v, %v, want [debug.log]", ignored, err)
+	}
+	first := commit(t, r, "\nfirst  \n\n", 1672531200)
+	if first.Message != "first\n" || len(first.Parents) != 0 {
+		t.Errorf("Commit() = %q with %d parents, want root commit with cleaned message", first.Message, len(first.Parents))
+	}
+	if _, err := r.Commit(CommitOptions{Message: "\n"}); err == nil {
+		t.Error("Commit() with empty message succeeded")
+	}
+
+	if err := r.CreateBranch("topic", ""); err != nil {
+		t.Fatal(err)
+	}
+	result, err := r.Checkout("topic", CheckoutOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Branch != "refs/heads/topic" || result.Previous.Branch != "refs/heads/main" || !bytes.Equal(result.Commit, first.Hash) {
+		t.Errorf("Checkout(topic) = %+v", result)
+	}
+	writeFile(t, dir, "sub/b.txt", "b2\n")
+	status, err := r.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Unstaged) != 1 || status.Unstaged[0].Path != "sub/b.txt" {
+		t.Errorf("Status().Unstaged = %v, want sub/b.txt", status.Unstaged)
+	}
+	if _, err := r.Add(nil, AddOptions{Update: true}); err != nil {
+		t.Fatal(err)
+	}
+	second := commit(t, r, "second", 1672531300)
+
+	commits, err := r.Log(LogOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 2 || !bytes.Equal(commits[0].Hash, second.Hash) || !bytes.Equal(commits[1].Hash, first.Hash) {
+		t.Errorf("Log() = %v, want second and first", commits)
+	}
+	if commits, err := r.Log(LogOptions{Revision: "main", MaxCount: 1}); err != nil || len(commits) != 1 || !bytes.Equal(commits[0].Hash, first.Hash) {
+		t.Errorf("Log(main) = %v, %v, want first", commits, err)
+	}
+
+	// 切り離したHEADで作ったコミットから離れると、辿れなくなったコミットを返す.
+	if _, err := r.Checkout(second.Hash.String(), CheckoutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, dir, "a.txt", "detached\n")
+	if _, err := r.Add([]string{"a.txt"}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	detached := commit(t, r, "detached", 1672531400)
+	if result, err = r.Checkout("main", CheckoutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Orphaned) != 1 || !bytes.Equal(result.Orphaned[0].Hash, detached.Hash) {
+		t.Errorf("Checkout(main).Orphaned = %v, want the detached commit", result.Orphaned)
+	}
+
+	if err := r.RenameBranch("", "trunk"); err != nil {
+		t.Fatal(err)
+	}
+	branches, err := r.Branches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(branches) != 2 || branches[0].Name != "refs/heads/topic" || branches[1].Name != "refs/heads/trunk" {
+		t.Errorf("Branches() = %v, want topic and trunk", branches)
+	}
+	if _, err := r.DeleteBranch("topic", false); !errors.Is(err, store.ErrBranchNotMerged) {
+		t.Errorf("DeleteBranch(topic) error = %v, want %v", err, store.ErrBranchNotMerged)
+	}
+}
+
+// 多くのファイルを並列に書き込んでも、それぞれの内容のブロブがインデックスに記録されるか
+func TestRepository_AddMany(t *testing.T) {
+	dir := t.TempDir()
+	r, _, err := Init(dir, store.InitOptions{InitialBranch: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{}
+	for i := 0; i < 200; i++ {
+		name := fmt.Sprintf("dir%d/file%d.txt", i%7, i)
+		want[name] = fmt.Sprintf("content %d\n", i)
+		writeFile(t, dir, name, want[name])
+	}
+	if _, err := r.Add([]string{"."}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	index, err := r.Client().ReadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Entries) != len(want) {
+		t.Fatalf("index has %d entries, want %d", len(index.Entries), len(want))
+	}
+	for _, entry := range index.Entries {
+		hash := object.NewObject(object.BlobObject, []byte(want[entry.Path])).Hash
+		if !bytes.Equal(entry.Hash, hash) {
+			t.Errorf("%s = %s, want %s", entry.Path, entry.Hash, hash)
+		}
+		if _, err := r.Client().GetObject(entry.Hash); err != nil {
+			t.Errorf("GetObject(%s) error = %v", entry.Path, err)
+		}
+	}
+}
+
+// エディタで編集したメッセージから'#'で始まる行だけを取り除くか
+func TestStripComments(t *testing.T) {
+	for _, tt := range []struct {
+		message, want string
+	}{
+		{"subject\n\n# comment\nbody\n", "subject\n\nbody\n"},
+		{"# only comments\n#\n", ""},
+		{"keep # inside\n  # indented\n#last", "keep # inside\n  # indented\n"},
+	} {
+		if got := StripComments(tt.message); got != tt.want {
+			t.Errorf("StripComments(%q) = %q, want %q", tt.message, got, tt.want)
+		}
+	}
+}
+
+// --amendでHEADのコミットを、親と作者とメッセージを引き継いだ新しいコミットに置き換えるか
+func TestRepository_CommitAmend(t *testing.T) {
+	dir := t.TempDir()
+	r, _, err := Init(dir, store.InitOptions{InitialBranch: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Commit(CommitOptions{Message: "x", Amend: true}); err == nil {
+		t.Error("Commit(Amend) on an unborn branch succeeded")
+	}
+	writeFile(t, dir, "a.txt", "a\n")
+	if _, err := r.Add([]string{"."}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	first := commit(t, r, "first", 1672531200)
+	writeFile(t, dir, "b.txt", "b\n")
+	if _, err := r.Add([]string{"."}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	second := commit(t, r, "second", 1672531300)
+
+	writeFile(t, dir, "c.txt", "c\n")
+	if _, err := r.Add([]string{"."}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	committer := &object.Signature{Name: "other", Email: "other@example.com", When: time.Unix(1672531400, 0).UTC()}
+	amended, err := r.Commit(CommitOptions{Amend: true, Committer: committer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(amended.Parents) != 1 || !bytes.Equal(amended.Parents[0], first.Hash) {
+		t.Errorf("amended parents = %v, want [%s]", amended.Parents, first.Hash)
+	}
+	if amended.Message != second.Message || amended.Author.Name != second.Author.Name || !amended.Author.When.Equal(second.Author.When) || amended.Committer.Name != "other" {
+		t.Errorf("amended commit = %q by %v, committed by %v", amended.Message, amended.Author, amended.Committer)
+	}
+	var paths []string
+	if err := r.Client().WalkTree(amended.Tree, nil, func(path string, entry object.TreeEntry) error {
+		paths = append(paths, path)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(paths) != "[a.txt b.txt c.txt]" {
+		t.Errorf("amended tree = %v", paths)
+	}
+	entries, err := r.Client().ReadReflog("HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := entries[0]
+	if !bytes.Equal(last.Old, second.Hash) || !bytes.Equal(last.New, amended.Hash) || last.Message != "commit (amend): second" {
+		t.Errorf("last reflog entry = %s -> %s %q", last.Old, last.New, last.Message)
+	}
+}
+
+// Allなら追跡しているファイルの変更と削除だけをコミットし、新しいファイルは追加しないか
+func TestRepository_CommitAll(t *testing.T) {
+	dir := t.TempDir()
+	r, _, err := Init(dir, store.InitOptions{InitialBranch: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, dir, "a.txt", "a\n")
+	writeFile(t, dir, "b.txt", "b\n")
+	if _, err := r.Add([]string{"."}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	commit(t, r, "first", 1672531200)
+
+	writeFile(t, dir, "a.txt", "changed\n")
+	writeFile(t, dir, "new.txt", "new\n")
+	if err := os.Remove(filepath.Join(dir, "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+	sig := &object.Signature{Name: "fsegit", Email: "fsegit@example.com", When: time.Unix(1672531300, 0).UTC()}
+	second, err := r.Commit(CommitOptions{Message: "second", All: true, Author: sig, Committer: sig})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	if err := r.Client().WalkTree(second.Tree, nil, func(path string, entry object.TreeEntry) error {
+		obj, err := r.Client().GetObject(entry.Hash)
+		if err != nil {
+			return err
+		}
+		files[path] = string(obj.Data)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files["a.txt"] != "changed\n" {
+		t.Errorf("committed files = %v, want only a.txt with the change", files)
+	}
+	status, err := r.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Staged) != 0 || len(status.Unstaged) != 0 || fmt.Sprint(status.Untracked) != "[new.txt]" {
+		t.Errorf("status after commit -a = %+v", status)
+	}
+}
+
+// ツリーが親と同じコミットはAllowEmptyでなければErrNothingToCommitになるか
+func TestRepository_CommitNothing(t *testing.T) {
+	dir := t.TempDir()
+	r, _, err := Init(dir, store.InitOptions{InitialBranch: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := &object.Signature{Name: "fsegit", Email: "fsegit@example.com", When: time.Unix(1672531200, 0).UTC()}
+	if _, err := r.Commit(CommitOptions{Message: "root", Author: sig, Committer: sig}); !errors.Is(err, ErrNothingToCommit) {
+		t.Errorf("Commit() with an empty index error = %v, want %v", err, ErrNothingToCommit)
+	}
+	writeFile(t, dir, "a.txt", "a\n")
+	if _, err := r.Add([]string{"."}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	first := commit(t, r, "first", 1672531200)
+	if _, err := r.Commit(CommitOptions{Message: "again", Author: sig, Committer: sig}); !errors.Is(err, ErrNothingToCommit) {
+		t.Errorf("Commit() without changes error = %v, want %v", err, ErrNothingToCommit)
+	}
+	empty, err := r.Commit(CommitOptions{Message: "empty", AllowEmpty: true, Author: sig, Committer: sig})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(empty.Tree, first.Tree) {
+		t.Errorf("empty commit tree = %s, want %s", empty.Tree, first.Tree)
+	}
+}
+
+// コンフリクトで止まったマージの途中では、解決するまでコミットできず、解決後のコミットは保存されたメッセージを使い、
+// MERGE_HEADのコミットを2番目の親にしてマージの状態を消すか
+func TestRepository_CommitMerge(t *testing.T) {
+	dir := t.TempDir()
+	r, _, err := Init(dir, store.InitOptions{InitialBranch: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := r.Client()
+	writeFile(t, dir, "a.txt", "a\n")
+	if _, err := r.Add([]string{"."}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	first := commit(t, r, "first", 1672531200)
+	writeFile(t, dir, "a.txt", "theirs\n")
+	if _, err := r.Add([]string{"."}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	theirs := commit(t, r, "theirs", 1672531300)
+	if err := client.WriteRef("refs/heads/main", first.Hash); err != nil {
+		t.Fatal(err)
+	}
+
+	// gitのmergeがコンフリクトで止まったときと同じ状態を作る.
+	message := "Merge branch 'topic'\n\nresolve a.txt\n"
+	for name, content := range map[string]string{"MERGE_HEAD": theirs.Hash.String() + "\n", "MERGE_MSG": message, "MERGE_MODE": ""} {
+		if err := ioutil.WriteFile(filepath.Join(client.GitDir(), name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	index, err := client.ReadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ours, other := *index.Entry("a.txt"), *index.Entry("a.txt")
+	ours.Stage, other.Stage = 2, 3
+	index.AddUnmerged("a.txt", &ours, &other)
+	if err := client.WriteIndex(index); err != nil {
+		t.Fatal(err)
+	}
+	sig := &object.Signature{Name: "fsegit", Email: "fsegit@example.com", When: time.Unix(1672531400, 0).UTC()}
+	if _, err := r.Commit(CommitOptions{Author: sig, Committer: sig}); !errors.Is(err, store.ErrUnmerged) {
+		t.Errorf("Commit() with unmerged paths error = %v, want %v", err, store.ErrUnmerged)
+	}
+
+	writeFile(t, dir, "a.txt", "resolved\n")
+	if _, err := r.Add([]string{"a.txt"}, AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	merge, err := r.Commit(CommitOptions{Author: sig, Committer: sig})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merge.Message != message {
+		t.Errorf("merge message = %q, want %q", merge.Message, message)
+	}
+	if len(merge.Parents) != 2 || !bytes.Equal(merge.Parents[0], first.Hash) || !bytes.Equal(merge.Parents[1], theirs.Hash) {
+		t.Errorf("merge parents = %v, want [%s %s]", merge.Parents, first.Hash, theirs.Hash)
+	}
+	if state, err := client.ReadMergeState(); err != nil || state != nil {
+		t.Errorf("merge state after commit = %+v, %v, want nil", state, err)
+	}
+	entries, err := client.ReadReflog("HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries[0].Message != "commit (merge): Merge branch 'topic'" {
+		t.Errorf("last reflog entry = %q", entries[0].Message)
+	}
+}
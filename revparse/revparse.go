@@ -0,0 +1,229 @@
+// Package revparseはgit rev-parseと同じ書き方のリビジョン("HEAD~2"、"main^2"、"v1.0^{tree}"、
+// "a1b2c3d"、"HEAD:src/main.go"など)をオブジェクトのハッシュに解決する.
+package revparse
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+)
+
+var (
+	ErrUnknownRevision = errors.New("unknown revision")
+	ErrInvalidRevision = errors.New("invalid revision")
+	ErrNoParent        = errors.New("commit does not have that parent")
+	ErrPathNotInTree   = errors.New("path does not exist in tree")
+)
+
+// Resolveはrevを解決してオブジェクトのハッシュを返す. 受け付ける書き方は次のとおり.
+//
+//	HEAD, @            現在のコミット
+//	main, v1.0, ...    参照名(refs/、refs/tags/、refs/heads/、refs/remotes/の順に探す)
+//	a1b2c3d            ハッシュ(4文字以上の先頭の部分でもよい)
+//	<ref>@{<n>}        refのreflogでn個前の更新の後の値. refを省くと現在のブランチ
+//	<rev>~<n>          最初の親をn回辿ったコミット. nを省くと1
+//	<rev>^<n>          n番目の親. nを省くと1、0ならそのコミット自身
+//	<rev>^{<type>}     タグを辿ってtype(commit、tree、blob、tag)のオブジェクトにする. 空ならタグ以外まで辿る
+//	<rev>:<path>       コミットかツリーのpathにあるブロブかツリー. pathが空ならルートのツリー
+func Resolve(client *store.Client, rev string) (sha.SHA1, error) {
+	if i := strings.IndexByte(rev, ':'); i >= 0 {
+		if i == 0 {
+			return nil, fmt.Errorf("%w : %s", ErrInvalidRevision, rev)
+		}
+		hash, err := Resolve(client, rev[:i])
+		if err != nil {
+			return nil, err
+		}
+		return lookupPath(client, hash, rev[i+1:])
+	}
+
+	end := strings.IndexAny(rev, "^~")
+	if end < 0 {
+		end = len(rev)
+	}
+	hash, err := resolveName(client, rev[:end])
+	if err != nil {
+		return nil, err
+	}
+	for suffix := rev[end:]; suffix != ""; {
+		op := suffix[0]
+		suffix = suffix[1:]
+		if op == '^' && strings.HasPrefix(suffix, "{") {
+			close := strings.IndexByte(suffix, '}')
+			if close < 0 {
+				return nil, fmt.Errorf("%w : %s", ErrInvalidRevision, rev)
+			}
+			if hash, err = peel(client, hash, suffix[1:close]); err != nil {
+				return nil, err
+			}
+			suffix = suffix[close+1:]
+			continue
+		}
+
+		digits := 0
+		for digits < len(suffix) && suffix[digits] >= '0' && suffix[digits] <= '9' {
+			digits++
+		}
+		n := 1
+		if digits > 0 {
+			if n, err = strconv.Atoi(suffix[:digits]); err != nil {
+				return nil, fmt.Errorf("%w : %s", ErrInvalidRevision, rev)
+			}
+		}
+		suffix = suffix[digits:]
+		switch op {
+		case '~':
+			for ; n > 0; n-- {
+				if hash, err = parent(client, hash, 1); err != nil {
+					return nil, err
+				}
+			}
+		case '^':
+			if hash, err = parent(client, hash, n); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("%w : %s", ErrInvalidRevision, rev)
+		}
+	}
+	return hash, nil
+}
+
+// resolveNameは接尾辞を除いたリビジョンを、参照名、ハッシュの順に解決する.
+func resolveName(client *store.Client, name string) (sha.SHA1, error) {
+	if name == "" {
+		return nil, fmt.Errorf("%w : empty revision", ErrInvalidRevision)
+	}
+	if name == "@" {
+		name = "HEAD"
+	}
+	if i := strings.Index(name, "@{"); i >= 0 && strings.HasSuffix(name, "}") {
+		return resolveReflog(client, name[:i], name[i+2:len(name)-1])
+	}
+	if fullName, err := client.DWIMRef(name); err == nil {
+		return client.ResolveRef(fullName)
+	}
+	if hash, err := client.ResolveHash(name); err == nil || errors.Is(err, store.ErrAmbiguousHash) {
+		return hash, err
+	}
+	return nil, fmt.Errorf("%w : %s", ErrUnknownRevision, name)
+}
+
+// resolveReflogは"<ref>@{<n>}"をrefのreflogから解決する. refが空なら現在のブランチ、
+// HEADが切り離されていればHEADのreflogを使う.
+func resolveReflog(client *store.Client, ref, selector string) (sha.SHA1, error) {
+	n, err := strconv.Atoi(selector)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("%w : %s@{%s}", ErrInvalidRevision, ref, selector)
+	}
+	var fullName string
+	if ref == "" {
+		head, err := client.ReadHead()
+		if err != nil {
+			return nil, err
+		}
+		fullName = head.Branch
+		if head.Detached() {
+			fullName = "HEAD"
+		}
+	} else if fullName, err = client.DWIMRef(ref); err != nil {
+		return nil, fmt.Errorf("%w : %s", ErrUnknownRevision, ref)
+	}
+	return client.ReflogAt(fullName, n)
+}
+
+// parentはhashのコミットのn番目の親を返す. nが0ならコミット自身を返す.
+func parent(client *store.Client, hash sha.SHA1, n int) (sha.SHA1, error) {
+	hash, err := client.PeelToCommit(hash)
+	if err != nil || n == 0 {
+		return hash, err
+	}
+	obj, err := client.GetObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := object.NewCommit(obj)
+	if err != nil {
+		return nil, err
+	}
+	if n > len(commit.Parents) {
+		return nil, fmt.Errorf("%w : %s^%d", ErrNoParent, hash, n)
+	}
+	return commit.Parents[n-1], nil
+}
+
+// peelはhashのオブジェクトからタグとコミットを辿って、typeNameの種類のオブジェクトを返す.
+// typeNameが空ならタグだけを辿る.
+func peel(client *store.Client, hash sha.SHA1, typeName string) (sha.SHA1, error) {
+	var want object.Type
+	if typeName != "" {
+		var err error
+		if want, err = object.NewType(typeName); err != nil {
+			return nil, fmt.Errorf("%w : ^{%s}", ErrInvalidRevision, typeName)
+		}
+	}
+	for {
+		obj, err := client.GetObject(hash)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case typeName != "" && obj.Type == want, typeName == "" && obj.Type != object.TagObject:
+			return hash, nil
+		case obj.Type == object.TagObject:
+			tag, err := object.NewTag(obj)
+			if err != nil {
+				return nil, err
+			}
+			hash = tag.Object
+		case obj.Type == object.CommitObject && want == object.TreeObject:
+			commit, err := object.NewCommit(obj)
+			if err != nil {
+				return nil, err
+			}
+			hash = commit.Tree
+		default:
+			return nil, fmt.Errorf("%w : %s is a %s, not a %s", ErrInvalidRevision, hash, obj.Type, typeName)
+		}
+	}
+}
+
+// lookupPathはhashのコミットかツリーのpathにあるオブジェクトのハッシュを返す.
+func lookupPath(client *store.Client, hash sha.SHA1, path string) (sha.SHA1, error) {
+	tree, err := client.GetTree(hash)
+	if err != nil {
+		return nil, err
+	}
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return tree.Hash, nil
+	}
+	components := strings.Split(path, "/")
+	for i, name := range components {
+		var found *object.TreeEntry
+		for j := range tree.Entries {
+			if tree.Entries[j].Name == name {
+				found = &tree.Entries[j]
+				break
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("%w : %s", ErrPathNotInTree, path)
+		}
+		if i == len(components)-1 {
+			return found.Hash, nil
+		}
+		if !found.Mode.IsTree() {
+			return nil, fmt.Errorf("%w : %s", ErrPathNotInTree, path)
+		}
+		if tree, err = client.GetTree(found.Hash); err != nil {
+			return nil, err
+		}
+	}
+	return tree.Hash, nil
+}
@@ -0,0 +1,192 @@
+package revparse
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+)
+
+// storeCommitはfilesを内容に持つコミットを書き込む. filesのキーはルートからのパス.
+func storeCommit(t *testing.T, client *store.Client, files map[string]string, message string, parents ...sha.SHA1) sha.SHA1 {
+	t.Helper()
+	var entries []store.PathEntry
+	for name, content := range files {
+		blob, err := client.StoreRaw(object.BlobObject, []byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, store.PathEntry{Path: name, Mode: object.ModeBlob, Hash: blob})
+	}
+	tree, err := client.BuildTree(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := fmt.Sprintf("tree %s\n", tree)
+	for _, parent := range parents {
+		data += fmt.Sprintf("parent %s\n", parent)
+	}
+	data += "author fsegit <fsegit@example.com> 1672531200 +0900\ncommitter fsegit <fsegit@example.com> 1672531200 +0900\n\n" + message + "\n"
+	hash, err := client.StoreRaw(object.CommitObject, []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+// 親を辿る書き方、reflog、パス、タグ、ハッシュの先頭の部分を解決できるか
+func TestResolve(t *testing.T) {
+	client, _, err := store.Init(t.TempDir(), store.InitOptions{InitialBranch: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// c1 - c2 - c3 - merge
+	//    \           /
+	//     side ------
+	c1 := storeCommit(t, client, map[string]string{"a.txt": "1\n"}, "c1")
+	c2 := storeCommit(t, client, map[string]string{"a.txt": "2\n"}, "c2", c1)
+	c3 := storeCommit(t, client, map[string]string{"a.txt": "3\n"}, "c3", c2)
+	side := storeCommit(t, client, map[string]string{"a.txt": "1\n", "dir/b.txt": "b\n"}, "side", c1)
+	merge := storeCommit(t, client, map[string]string{"a.txt": "3\n", "dir/b.txt": "b\n"}, "merge", c3, side)
+	for _, hash := range []sha.SHA1{c1, c3, merge} {
+		if err := client.UpdateRef("refs/heads/main", hash, "commit"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tagger := object.Signature{Name: "fsegit", Email: "fsegit@example.com", When: time.Unix(1672531200, 0)}
+	tag, _, err := client.CreateAnnotatedTag("v1", c2, tagger, "release\n", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mergeCommit, err := client.GetCommit(merge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2Commit, err := client.GetCommit(c2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobA, err := client.StoreRaw(object.BlobObject, []byte("3\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobB, err := client.StoreRaw(object.BlobObject, []byte("b\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirTree, err := Resolve(client, side.String()+":dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		rev  string
+		want sha.SHA1
+	}{
+		{"HEAD", merge},
+		{"@", merge},
+		{"main", merge},
+		{"refs/heads/main", merge},
+		{merge.String(), merge},
+		{merge.String()[:7], merge},
+		{"HEAD^", c3},
+		{"HEAD^1", c3},
+		{"HEAD^2", side},
+		{"HEAD^0", merge},
+		{"HEAD^^", c2},
+		{"HEAD~", c3},
+		{"HEAD~0", merge},
+		{"HEAD~2", c2},
+		{"HEAD~3", c1},
+		{"HEAD^2~1", c1},
+		{"main~1^", c2},
+		{"main@{0}", merge},
+		{"main@{1}", c3},
+		{"main@{2}", c1},
+		{"@{1}", c3},
+		{"main@{1}~2", c1},
+		{"v1", tag},
+		{"v1^{}", c2},
+		{"v1^{commit}", c2},
+		{"v1^{tree}", c2Commit.Tree},
+		{"v1^{tag}", tag},
+		{"v1~1", c1},
+		{"HEAD^{tree}", mergeCommit.Tree},
+		{"HEAD:", mergeCommit.Tree},
+		{"HEAD:a.txt", blobA},
+		{"HEAD:dir/b.txt", blobB},
+		{"HEAD:/dir/b.txt/", blobB},
+		{"HEAD:dir", dirTree},
+		{"HEAD^2:dir/b.txt", blobB},
+		{mergeCommit.Tree.String() + ":a.txt", blobA},
+	}
+	for _, test := range tests {
+		if got, err := Resolve(client, test.rev); err != nil || !bytes.Equal(got, test.want) {
+			t.Errorf("Resolve(%q) = %s, %v, want %s", test.rev, got, err, test.want)
+		}
+	}
+
+	errorTests := []struct {
+		rev  string
+		want error
+	}{
+		{"", ErrInvalidRevision},
+		{":a.txt", ErrInvalidRevision},
+		{"HEAD^{", ErrInvalidRevision},
+		{"HEAD^{unknown}", ErrInvalidRevision},
+		{"HEAD^{tag}", ErrInvalidRevision},
+		{"HEAD:a.txt^{commit}", ErrPathNotInTree},
+		{"HEAD^3", ErrNoParent},
+		{"HEAD~4", ErrNoParent},
+		{"HEAD:missing.txt", ErrPathNotInTree},
+		{"HEAD:a.txt/b", ErrPathNotInTree},
+		{"main@{3}", store.ErrReflogTooShort},
+		{"main@{x}", ErrInvalidRevision},
+		{"nosuch@{1}", ErrUnknownRevision},
+		{"nosuch", ErrUnknownRevision},
+		{"nosuch~1", ErrUnknownRevision},
+	}
+	for _, test := range errorTests {
+		if got, err := Resolve(client, test.rev); !errors.Is(err, test.want) {
+			t.Errorf("Resolve(%q) = %s, %v, want %v", test.rev, got, err, test.want)
+		}
+	}
+}
+
+// 先頭の部分が複数のオブジェクトに一致するハッシュは、曖昧だというエラーになるか
+func TestResolve_AmbiguousHash(t *testing.T) {
+	client, _, err := store.Init(t.TempDir(), store.InitOptions{InitialBranch: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 先頭4文字が同じになる2つのブロブを探して書き込む.
+	seen := map[string]sha.SHA1{}
+	var first, second sha.SHA1
+	for i := 0; second == nil; i++ {
+		hash, err := client.StoreRaw(object.BlobObject, []byte(fmt.Sprintf("blob %d\n", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		key := hash.String()[:4]
+		if other, ok := seen[key]; ok {
+			first, second = other, hash
+		}
+		seen[key] = hash
+	}
+
+	prefix := first.String()[:4]
+	if _, err := Resolve(client, prefix); !errors.Is(err, store.ErrAmbiguousHash) {
+		t.Errorf("Resolve(%q) error = %v, want %v", prefix, err, store.ErrAmbiguousHash)
+	}
+	for _, hash := range []sha.SHA1{first, second} {
+		short := hash.String()[:12]
+		if got, err := Resolve(client, short); err != nil || !bytes.Equal(got, hash) {
+			t.Errorf("Resolve(%q) = %s, %v, want %s", short, got, err, hash)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+// Package sequencerはcherry-pick、revert、rebaseのように複数のコミットを順に適用する操作の
+// 途中経過を<GitDir>/sequencer(rebaseはgitと同じく<GitDir>/rebase-merge)に保存し、
+// --continue、--skip、--abortで再開や中止をできるようにする.
+package sequencer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kanon1343/fsegit/config"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+	"github.com/kanon1343/fsegit/util"
+)
+
+var (
+	ErrInProgress  = errors.New("a cherry-pick, revert or rebase is already in progress")
+	ErrNoSequence  = errors.New("no cherry-pick, revert or rebase in progress")
+	ErrInvalidTodo = errors.New("invalid todo list")
+)
+
+// Actionはtodoの各行でコミットに行う操作.
+type Action string
+
+const (
+	Pick   Action = "pick"
+	Revert Action = "revert"
+)
+
+// Stepはtodoの1行.
+type Step struct {
+	Action  Action
+	Commit  sha.SHA1
+	Subject string
+}
+
+// Optionsは操作全体に共通する設定. 再開したときにも同じ設定で続けるために保存する.
+type Options struct {
+	// Operationは"cherry-pick"、"revert"、"rebase"のどれか. メッセージの表示に使う.
+	Operation string
+	// Mainlineはマージコミットを適用するときに基準にする親の番号(1始まり). 0なら指定なし.
+	Mainline int
+	// NoCommitなら変更をインデックスに反映するだけでコミットしない.
+	NoCommit bool
+	// Editならコミットする前にメッセージをエディタで編集させる.
+	Edit bool
+	// Ontoはrebaseの移動先のコミット.
+	Onto sha.SHA1
+	// HeadNameはrebaseで付け替えるブランチの完全な名前(refs/heads/topic). HEADが切り離されていれば空.
+	HeadName string
+}
+
+// Sequencerは保存された途中経過.
+type Sequencer struct {
+	client *store.Client
+	dir    string
+	// Optionsは開始時に指定された設定.
+	Options Options
+	// Headは開始前のHEADのコミット. --abortで戻す先.
+	Head sha.SHA1
+	// Todoはまだ終わっていないステップ. 先頭が現在のステップ.
+	Todo []Step
+}
+
+// stateDirsは途中経過を置くディレクトリの名前. rebaseだけは別のディレクトリに置く.
+var stateDirs = []string{"sequencer", "rebase-merge"}
+
+func stateDir(client *store.Client, operation string) string {
+	if operation == "rebase" {
+		return filepath.Join(client.GitDir(), "rebase-merge")
+	}
+	return filepath.Join(client.GitDir(), "sequencer")
+}
+
+// currentDirは途中で止まった操作の途中経過のディレクトリを返す. なければ空を返す.
+func currentDir(client *store.Client) string {
+	for _, name := range stateDirs {
+		dir := filepath.Join(client.GitDir(), name)
+		if _, err := os.Stat(filepath.Join(dir, "todo")); err == nil {
+			return dir
+		}
+	}
+	return ""
+}
+
+// InProgressは途中で止まった操作があるかを返す.
+func InProgress(client *store.Client) bool {
+	return currentDir(client) != ""
+}
+
+// Startは新しい操作を始めて途中経過を保存する. 既に別の操作の途中ならErrInProgressを返す.
+func Start(client *store.Client, opts Options, todo []Step) (*Sequencer, error) {
+	if InProgress(client) {
+		return nil, ErrInProgress
+	}
+	head, err := client.ResolveHeadCommit()
+	if err != nil {
+		return nil, err
+	}
+	s := &Sequencer{
+		client:  client,
+		dir:     stateDir(client, opts.Operation),
+		Options: opts,
+		Head:    head,
+		Todo:    todo,
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := util.WriteFileAtomic(filepath.Join(s.dir, "head"), []byte(head.String()+"\n"), 0644); err != nil {
+		return nil, err
+	}
+	if err := util.WriteFileAtomic(filepath.Join(s.dir, "opts"), encodeOptions(opts), 0644); err != nil {
+		return nil, err
+	}
+	return s, s.save()
+}
+
+// Loadは保存された途中経過を読み込む. 操作の途中でなければErrNoSequenceを返す.
+func Load(client *store.Client) (*Sequencer, error) {
+	dir := currentDir(client)
+	if dir == "" {
+		return nil, ErrNoSequence
+	}
+	s := &Sequencer{client: client, dir: dir}
+
+	head, err := ioutil.ReadFile(filepath.Join(s.dir, "head"))
+	if err != nil {
+		return nil, err
+	}
+	if s.Head, err = decodeHash(strings.TrimSpace(string(head))); err != nil {
+		return nil, err
+	}
+
+	opts, err := config.Load(filepath.Join(s.dir, "opts"))
+	if err != nil {
+		return nil, err
+	}
+	if s.Options, err = decodeOptions(opts); err != nil {
+		return nil, err
+	}
+
+	todo, err := ioutil.ReadFile(filepath.Join(s.dir, "todo"))
+	if err != nil {
+		return nil, err
+	}
+	if s.Todo, err = ParseTodo(todo); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Runは残りのステップを先頭から順にapplyで適用する. applyがエラーを返したらそこで止まり、
+// そのステップをtodoに残したままエラーを返す. 全て終わったら途中経過を削除する.
+func (s *Sequencer) Run(apply func(Step) error) error {
+	for len(s.Todo) > 0 {
+		if err := apply(s.Todo[0]); err != nil {
+			return err
+		}
+		if err := s.Advance(); err != nil {
+			return err
+		}
+	}
+	return s.Finish()
+}
+
+// Advanceは先頭のステップを完了したものとしてtodoから取り除く. --continueでコンフリクトを
+// 解決したステップをコミットした後や、--skipで飛ばすときに使う.
+func (s *Sequencer) Advance() error {
+	if len(s.Todo) == 0 {
+		return nil
+	}
+	s.Todo = s.Todo[1:]
+	return s.save()
+}
+
+// Abortは途中経過を削除し、開始前のHEADを返す. 作業ツリーとインデックスを戻すのは呼び出し側で行う.
+func (s *Sequencer) Abort() (sha.SHA1, error) {
+	return s.Head, s.Finish()
+}
+
+// Finishは途中経過を削除する.
+func (s *Sequencer) Finish() error {
+	return os.RemoveAll(s.dir)
+}
+
+func (s *Sequencer) save() error {
+	return util.WriteFileAtomic(filepath.Join(s.dir, "todo"), EncodeTodo(s.Todo), 0644)
+}
+
+// EncodeTodoはtodoを"pick <hash> <subject>"の行の並びにする.
+func EncodeTodo(todo []Step) []byte {
+	var buf bytes.Buffer
+	for _, step := range todo {
+		fmt.Fprintf(&buf, "%s %s %s\n", step.Action, step.Commit, step.Subject)
+	}
+	return buf.Bytes()
+}
+
+// ParseTodoはtodoの行を読む. 空行と"#"で始まる行は無視する. 操作名は"p"のような省略形も受け付ける.
+func ParseTodo(data []byte) ([]Step, error) {
+	var todo []Step
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%w : %s", ErrInvalidTodo, line)
+		}
+		var action Action
+		switch fields[0] {
+		case "pick", "p":
+			action = Pick
+		case "revert":
+			action = Revert
+		default:
+			return nil, fmt.Errorf("%w : unknown action %q", ErrInvalidTodo, fields[0])
+		}
+		hash, err := decodeHash(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%w : %s", ErrInvalidTodo, line)
+		}
+		step := Step{Action: action, Commit: hash}
+		if len(fields) == 3 {
+			step.Subject = fields[2]
+		}
+		todo = append(todo, step)
+	}
+	return todo, scanner.Err()
+}
+
+// encodeOptionsはgitのsequencer/optsと同じ設定ファイルの形式で書き出す.
+func encodeOptions(opts Options) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("[options]\n")
+	fmt.Fprintf(&buf, "\toperation = %s\n", opts.Operation)
+	if opts.Mainline != 0 {
+		fmt.Fprintf(&buf, "\tmainline = %d\n", opts.Mainline)
+	}
+	if opts.NoCommit {
+		buf.WriteString("\tno-commit = true\n")
+	}
+	if opts.Edit {
+		buf.WriteString("\tedit = true\n")
+	}
+	if opts.Onto != nil {
+		fmt.Fprintf(&buf, "\tonto = %s\n", opts.Onto)
+	}
+	if opts.HeadName != "" {
+		fmt.Fprintf(&buf, "\theadname = %s\n", opts.HeadName)
+	}
+	return buf.Bytes()
+}
+
+func decodeOptions(cfg *config.Config) (Options, error) {
+	var opts Options
+	opts.Operation, _ = cfg.Get("options.operation")
+	opts.HeadName, _ = cfg.Get("options.headname")
+	if mainline, ok := cfg.Get("options.mainline"); ok {
+		n, err := strconv.Atoi(mainline)
+		if err != nil {
+			return Options{}, fmt.Errorf("%w : mainline %q", config.ErrInvalidConfig, mainline)
+		}
+		opts.Mainline = n
+	}
+	noCommit, err := cfg.GetBool("options.no-commit", false)
+	if err != nil {
+		return Options{}, err
+	}
+	opts.NoCommit = noCommit
+	if opts.Edit, err = cfg.GetBool("options.edit", false); err != nil {
+		return Options{}, err
+	}
+	if onto, ok := cfg.Get("options.onto"); ok {
+		if opts.Onto, err = decodeHash(onto); err != nil {
+			return Options{}, err
+		}
+	}
+	return opts, nil
+}
+
+func decodeHash(s string) (sha.SHA1, error) {
+	hash, err := hex.DecodeString(s)
+	if err != nil || len(hash) != 20 {
+		return nil, fmt.Errorf("%w : bad hash %q", ErrInvalidTodo, s)
+	}
+	return hash, nil
+}
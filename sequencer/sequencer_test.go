@@ -0,0 +1,244 @@
+package sequencer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kanon1343/fsegit/config"
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+)
+
+// newTestClientはHEADのブランチに空のツリーのコミットが1つあるリポジトリを作る.
+func newTestClient(t *testing.T) (*store.Client, sha.SHA1) {
+	t.Helper()
+	client, _, err := store.Init(t.TempDir(), store.InitOptions{InitialBranch: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := client.StoreRaw(object.TreeObject, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := fmt.Sprintf("tree %s\nauthor fsegit <fsegit@example.com> 1672531200 +0900\ncommitter fsegit <fsegit@example.com> 1672531200 +0900\n\ninit\n", tree)
+	head, err := client.StoreRaw(object.CommitObject, []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.WriteRef("refs/heads/main", head); err != nil {
+		t.Fatal(err)
+	}
+	return client, head
+}
+
+func testHash(b byte) sha.SHA1 {
+	return sha.SHA1(bytes.Repeat([]byte{b}, 20))
+}
+
+// 保存した設定とtodoを読み込むと同じ値に戻り、別の操作を始められないか
+func TestStartLoad(t *testing.T) {
+	client, head := newTestClient(t)
+	opts := Options{Operation: "revert", Mainline: 2, NoCommit: true, Edit: true, Onto: testHash(0x33), HeadName: "refs/heads/topic"}
+	todo := []Step{
+		{Action: Revert, Commit: testHash(0x11), Subject: "first change"},
+		{Action: Pick, Commit: testHash(0x22)},
+	}
+	if InProgress(client) {
+		t.Fatal("InProgress() before Start")
+	}
+	if _, err := Start(client, opts, todo); err != nil {
+		t.Fatal(err)
+	}
+	if !InProgress(client) {
+		t.Error("InProgress() = false after Start")
+	}
+	if _, err := Start(client, Options{Operation: "cherry-pick"}, todo); !errors.Is(err, ErrInProgress) {
+		t.Errorf("second Start() error = %v, want %v", err, ErrInProgress)
+	}
+
+	s, err := Load(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s.Options, opts) {
+		t.Errorf("Options = %+v, want %+v", s.Options, opts)
+	}
+	if !bytes.Equal(s.Head, head) {
+		t.Errorf("Head = %s, want %s", s.Head, head)
+	}
+	if !reflect.DeepEqual(s.Todo, todo) {
+		t.Errorf("Todo = %+v, want %+v", s.Todo, todo)
+	}
+	if _, err := os.Stat(filepath.Join(client.GitDir(), "sequencer", "todo")); err != nil {
+		t.Errorf("todo is not in the sequencer directory: %v", err)
+	}
+}
+
+// rebaseの途中経過はrebase-mergeに置くか
+func TestStartLoad_Rebase(t *testing.T) {
+	client, _ := newTestClient(t)
+	if _, err := Start(client, Options{Operation: "rebase", Onto: testHash(0x44)}, []Step{{Action: Pick, Commit: testHash(0x11)}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(client.GitDir(), "rebase-merge", "todo")); err != nil {
+		t.Errorf("todo is not in rebase-merge: %v", err)
+	}
+	s, err := Load(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Options.Operation != "rebase" || !bytes.Equal(s.Options.Onto, testHash(0x44)) {
+		t.Errorf("Options = %+v", s.Options)
+	}
+}
+
+// 止まったステップはtodoに残り、--skipのように進めると次のステップから読み込まれ、
+// 全て終わると途中経過が消えるか
+func TestRunAdvance(t *testing.T) {
+	client, _ := newTestClient(t)
+	todo := []Step{
+		{Action: Pick, Commit: testHash(0x11), Subject: "one"},
+		{Action: Pick, Commit: testHash(0x22), Subject: "two"},
+		{Action: Pick, Commit: testHash(0x33), Subject: "three"},
+	}
+	s, err := Start(client, Options{Operation: "cherry-pick"}, todo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := errors.New("conflict")
+	var applied []string
+	err = s.Run(func(step Step) error {
+		applied = append(applied, step.Subject)
+		if step.Subject == "two" {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) || !reflect.DeepEqual(applied, []string{"one", "two"}) {
+		t.Fatalf("Run() = %v after applying %v", err, applied)
+	}
+	if s, err = Load(client); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s.Todo, todo[1:]) {
+		t.Errorf("Todo after stopping = %+v, want %+v", s.Todo, todo[1:])
+	}
+
+	if err := s.Advance(); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = Load(client); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s.Todo, todo[2:]) {
+		t.Errorf("Todo after skipping = %+v, want %+v", s.Todo, todo[2:])
+	}
+
+	if err := s.Run(func(Step) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if InProgress(client) {
+		t.Error("InProgress() = true after all steps are done")
+	}
+	if _, err := Load(client); !errors.Is(err, ErrNoSequence) {
+		t.Errorf("Load() after Run error = %v, want %v", err, ErrNoSequence)
+	}
+}
+
+// Abortは開始前のHEADを返して途中経過を消すか
+func TestAbort(t *testing.T) {
+	client, head := newTestClient(t)
+	if _, err := Start(client, Options{Operation: "revert"}, []Step{{Action: Revert, Commit: testHash(0x11)}}); err != nil {
+		t.Fatal(err)
+	}
+	s, err := Load(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig, err := s.Abort()
+	if err != nil || !bytes.Equal(orig, head) {
+		t.Errorf("Abort() = %s, %v, want %s", orig, err, head)
+	}
+	if InProgress(client) {
+		t.Error("InProgress() = true after Abort")
+	}
+	if _, err := Start(client, Options{Operation: "revert"}, nil); err != nil {
+		t.Errorf("Start() after Abort error = %v", err)
+	}
+}
+
+// 壊れたファイルや足りないファイルがあれば、読み込みに失敗するか
+func TestLoad_Corrupt(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    error
+	}{
+		{"unknown action", "todo", "squash " + testHash(0x11).String() + " x\n", ErrInvalidTodo},
+		{"bad todo hash", "todo", "pick 1234 x\n", ErrInvalidTodo},
+		{"todo without hash", "todo", "pick\n", ErrInvalidTodo},
+		{"bad head", "head", "not a hash\n", ErrInvalidTodo},
+		{"bad mainline", "opts", "[options]\n\toperation = revert\n\tmainline = one\n", config.ErrInvalidConfig},
+		{"bad no-commit", "opts", "[options]\n\toperation = revert\n\tno-commit = maybe\n", config.ErrInvalidConfig},
+		{"bad edit", "opts", "[options]\n\toperation = revert\n\tedit = maybe\n", config.ErrInvalidConfig},
+		{"bad onto", "opts", "[options]\n\toperation = rebase\n\tonto = 12\n", ErrInvalidTodo},
+		{"missing head", "head", "", os.ErrNotExist},
+		{"missing opts", "opts", "", nil},
+		{"missing todo", "todo", "", ErrNoSequence},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, _ := newTestClient(t)
+			if _, err := Start(client, Options{Operation: "revert"}, []Step{{Action: Revert, Commit: testHash(0x11)}}); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(client.GitDir(), "sequencer", test.file)
+			var err error
+			if strings.HasPrefix(test.name, "missing") {
+				err = os.Remove(path)
+			} else {
+				err = ioutil.WriteFile(path, []byte(test.content), 0644)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = Load(client)
+			if test.want == nil {
+				// optsがなければ既定の設定として読む.
+				if err != nil {
+					t.Errorf("Load() error = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, test.want) {
+				t.Errorf("Load() error = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+// todoの行を読み、省略形、空行、コメントを扱えるか. 書き出した形も読み戻せるか
+func TestParseTodo(t *testing.T) {
+	hash1, hash2 := testHash(0x11), testHash(0x22)
+	data := fmt.Sprintf("# comment\n\np %s first subject\nrevert %s\n", hash1, hash2)
+	todo, err := ParseTodo([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Step{{Action: Pick, Commit: hash1, Subject: "first subject"}, {Action: Revert, Commit: hash2}}
+	if !reflect.DeepEqual(todo, want) {
+		t.Errorf("ParseTodo() = %+v, want %+v", todo, want)
+	}
+	if todo, err = ParseTodo(EncodeTodo(want)); err != nil || !reflect.DeepEqual(todo, want) {
+		t.Errorf("ParseTodo(EncodeTodo()) = %+v, %v, want %+v", todo, err, want)
+	}
+}
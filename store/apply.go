@@ -0,0 +1,183 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/kanon1343/fsegit/diff"
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/util"
+)
+
+// ApplyOptionsはApplyの動作を指定する.
+type ApplyOptions struct {
+	// Cachedなら作業ツリーではなくインデックスに適用する.
+	Cached bool
+	// Indexなら作業ツリーとインデックスの両方に適用する. 変更前の内容は作業ツリーから読む.
+	Index bool
+	// Checkなら適用できるかを調べるだけで、何も書き換えない.
+	Check bool
+}
+
+// appliedFileはApplyで適用した後のファイル. deletedなら削除する.
+type appliedFile struct {
+	data    []byte
+	mode    object.FileMode
+	deleted bool
+}
+
+// Applyはpatchesを順に作業ツリー(opts.Cachedならインデックス)のファイルに適用する. 全てのファイルに
+// 適用できることを確かめてから書き換えるので、1つでも適用できなければ何も変えずにdiff.ErrPatchFailedを返す.
+// バイナリの変更は適用できない. 作業ツリーに適用するときは、opts.Indexでなければインデックスを変えない.
+func (c *Client) Apply(patches []*diff.FilePatch, opts ApplyOptions) error {
+	if !opts.Cached && c.IsBare() {
+		return ErrNoWorkTree
+	}
+	index, err := c.ReadIndex()
+	if err != nil {
+		return err
+	}
+	where := "working directory"
+	if opts.Cached {
+		where = "index"
+	}
+
+	// 同じパスへの2つ目以降の変更は、前の変更を適用した後の内容に適用する.
+	files := map[string]*appliedFile{}
+	var order []string
+	read := func(path string) (*appliedFile, error) {
+		if file, ok := files[path]; ok {
+			if file.deleted {
+				return nil, nil
+			}
+			return file, nil
+		}
+		if opts.Cached {
+			entry := index.Entry(path)
+			if entry == nil {
+				return nil, nil
+			}
+			obj, err := c.GetObject(entry.Hash)
+			if err != nil {
+				return nil, err
+			}
+			return &appliedFile{data: obj.Data, mode: entry.Mode}, nil
+		}
+		info, err := os.Lstat(util.LongPath(filepath.Join(c.workTree, filepath.FromSlash(path))))
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		data, err := c.ReadWorktreeFile(path, info)
+		if err != nil {
+			return nil, err
+		}
+		return &appliedFile{data: data, mode: FileModeOf(info)}, nil
+	}
+	set := func(path string, file *appliedFile) {
+		if _, ok := files[path]; !ok {
+			order = append(order, path)
+		}
+		files[path] = file
+	}
+
+	for _, patch := range patches {
+		name := patch.NewPath
+		if patch.IsDelete() {
+			name = patch.OldPath
+		}
+		// パッチのパスも、インデックスと同じく作業ツリーの外や管理ディレクトリを指すものは受け付けない.
+		for _, path := range []string{patch.OldPath, patch.NewPath} {
+			if path != "" && !validIndexPath(path) {
+				return fmt.Errorf("%w : invalid path '%s'", diff.ErrPatchFailed, path)
+			}
+		}
+		if patch.Binary {
+			return fmt.Errorf("%w : cannot apply binary patch to '%s'", diff.ErrPatchFailed, name)
+		}
+		old := &appliedFile{mode: object.ModeBlob}
+		if !patch.IsNew() {
+			if old, err = read(patch.OldPath); err != nil {
+				return err
+			}
+			if old == nil {
+				return fmt.Errorf("%w : %s: does not exist in %s", diff.ErrPatchFailed, patch.OldPath, where)
+			}
+		}
+		if patch.IsNew() || patch.IsRename() || patch.Copy {
+			existing, err := read(patch.NewPath)
+			if err != nil {
+				return err
+			}
+			if existing != nil {
+				return fmt.Errorf("%w : %s: already exists in %s", diff.ErrPatchFailed, patch.NewPath, where)
+			}
+		}
+
+		data, err := patch.Apply(old.data)
+		if err != nil {
+			return fmt.Errorf("%w : %s", err, name)
+		}
+		if patch.IsDelete() {
+			if len(data) > 0 {
+				return fmt.Errorf("%w : %s: removal patch leaves file contents", diff.ErrPatchFailed, name)
+			}
+			set(patch.OldPath, &appliedFile{deleted: true})
+			continue
+		}
+		mode := old.mode
+		if patch.NewMode != 0 {
+			mode = patch.NewMode
+		}
+		if patch.IsRename() {
+			set(patch.OldPath, &appliedFile{deleted: true})
+		}
+		set(patch.NewPath, &appliedFile{data: data, mode: mode})
+	}
+	if opts.Check {
+		return nil
+	}
+
+	// 削除を先に行い、名前を変えた先のパスが空くようにする.
+	for _, path := range order {
+		if !files[path].deleted {
+			continue
+		}
+		if opts.Cached || opts.Index {
+			index.Remove(path)
+		}
+		if !opts.Cached {
+			if err := c.RemoveWorktreeFile(path); err != nil {
+				return err
+			}
+		}
+	}
+	for _, path := range order {
+		file := files[path]
+		if file.deleted {
+			continue
+		}
+		hash, err := c.StoreRaw(object.BlobObject, file.data)
+		if err != nil {
+			return err
+		}
+		if opts.Cached {
+			index.Add(&IndexEntry{Mode: file.mode, Hash: hash, Path: path})
+			continue
+		}
+		info, err := c.WriteWorktreeEntry(path, file.mode, hash)
+		if err != nil {
+			return err
+		}
+		if opts.Index {
+			index.Add(NewIndexEntry(path, info, hash, nil, true, true))
+		}
+	}
+	if opts.Cached || opts.Index {
+		return c.WriteIndex(index)
+	}
+	return nil
+}
@@ -0,0 +1,374 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/pack"
+	"github.com/kanon1343/fsegit/sha"
+)
+
+// bitmapCommitIntervalは.bitmapファイルにビット列を書くコミットの間隔. 参照の指すコミットのほかに、
+// 親から順に並べたコミットのこの数ごとに1つを選ぶ.
+const bitmapCommitInterval = 100
+
+// packBitmapはパックの.bitmapファイルを初めて使うときに読み込んで返す. .bitmapを持つパックがないか、
+// 浅いリポジトリならnilを返す. コミットグラフと同じく、壊れたファイルは使わずにオブジェクトを辿る.
+func (c *Client) packBitmap() *pack.Bitmap {
+	// 浅いリポジトリでは境界のコミットの親を切るので、親まで含むビット列は使えない.
+	if shallow, err := c.IsShallow(); err != nil || shallow {
+		return nil
+	}
+	c.packMu.Lock()
+	defer c.packMu.Unlock()
+	if !c.packsLoaded {
+		if err := c.loadPacks(); err != nil {
+			return nil
+		}
+	}
+	if c.bitmapLoaded {
+		return c.bitmap
+	}
+	c.bitmapLoaded = true
+	for _, p := range c.packs {
+		if bitmap, err := pack.ReadBitmap(p); err == nil {
+			c.bitmap = bitmap
+			break
+		}
+	}
+	return c.bitmap
+}
+
+// ReachableSetはReachableで求めたオブジェクトの集合. .bitmapファイルのあるパックのオブジェクトはビット列で持つ.
+type ReachableSet struct {
+	bitmap *pack.Bitmap
+	bits   pack.Bitset
+	// extraはビット列で表せない(.bitmapのあるパックにない)オブジェクトの種類.
+	extra map[string]object.Type
+}
+
+// positionはhashのオブジェクトのビット列の位置を返す.
+func (s *ReachableSet) position(hash sha.SHA1) (int, bool) {
+	if s.bitmap == nil {
+		return 0, false
+	}
+	return s.bitmap.Order().Position(hash)
+}
+
+// Containsはhashのオブジェクトが集合に含まれるかを返す.
+func (s *ReachableSet) Contains(hash sha.SHA1) bool {
+	if pos, ok := s.position(hash); ok {
+		return s.bits.Has(pos)
+	}
+	_, ok := s.extra[string(hash)]
+	return ok
+}
+
+// Countは集合に含まれるobjectTypeの種類のオブジェクトの数を返す. UndefinedObjectなら全ての種類を数える.
+func (s *ReachableSet) Count(objectType object.Type) int {
+	n := 0
+	s.ForEach(objectType, func(hash sha.SHA1, objectType object.Type) error {
+		n++
+		return nil
+	})
+	return n
+}
+
+// ForEachは集合に含まれるobjectTypeの種類のオブジェクトのハッシュと種類をfnに渡す. UndefinedObjectなら全ての種類を渡す.
+// 順番は決まっていない. fnがエラーを返したらそこでやめてそのエラーを返す.
+func (s *ReachableSet) ForEach(objectType object.Type, fn func(hash sha.SHA1, objectType object.Type) error) error {
+	if s.bitmap != nil {
+		var err error
+		bits := s.bits
+		if objectType != object.UndefinedObject {
+			bits = bits.And(s.bitmap.Types(objectType))
+		}
+		bits.ForEach(func(pos int) {
+			if err == nil {
+				err = fn(s.bitmap.Order().Hash(pos), s.bitmap.Type(pos))
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for hash, t := range s.extra {
+		if objectType != object.UndefinedObject && t != objectType {
+			continue
+		}
+		if err := fn(sha.SHA1(hash), t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Removeはotherに含まれるオブジェクトを集合から取り除く.
+func (s *ReachableSet) Remove(other *ReachableSet) {
+	if s.bitmap == other.bitmap {
+		s.bits.AndNot(other.bits)
+		for hash := range other.extra {
+			delete(s.extra, hash)
+		}
+		return
+	}
+	other.ForEach(object.UndefinedObject, func(hash sha.SHA1, objectType object.Type) error {
+		if pos, ok := s.position(hash); ok {
+			s.bits.Clear(pos)
+		} else {
+			delete(s.extra, string(hash))
+		}
+		return nil
+	})
+}
+
+// addはhashのオブジェクトを集合に加える.
+func (s *ReachableSet) add(hash sha.SHA1, objectType object.Type) {
+	if pos, ok := s.position(hash); ok {
+		s.bits.Set(pos)
+		return
+	}
+	s.extra[string(hash)] = objectType
+}
+
+// reachItemはReachableで辿るオブジェクトと、分かっていればその種類.
+type reachItem struct {
+	hash       sha.SHA1
+	objectType object.Type
+}
+
+// Reachableはtipsから辿れるオブジェクトの集合を返す. objectsがfalseならコミットとタグだけを辿り、ツリーとブロブは
+// 含まないことがある. パックの.bitmapファイルにビット列のあるコミットはその先を辿らずにビット列を使うので、
+// 全てのコミットを読まずに数えられる. サブモジュールのコミット(gitlink)は辿らない.
+func (c *Client) Reachable(tips []sha.SHA1, objects bool) (*ReachableSet, error) {
+	set := &ReachableSet{bitmap: c.packBitmap(), extra: map[string]object.Type{}}
+	var queue []reachItem
+	for _, tip := range tips {
+		queue = append(queue, reachItem{hash: tip, objectType: object.UndefinedObject})
+	}
+	for len(queue) > 0 {
+		item := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		hash, objectType := item.hash, item.objectType
+		if set.Contains(hash) {
+			continue
+		}
+		if pos, ok := set.position(hash); ok {
+			objectType = set.bitmap.Type(pos)
+			if objectType == object.CommitObject {
+				if bits, ok := set.bitmap.Reachable(hash); ok {
+					set.bits.Or(bits)
+					continue
+				}
+			}
+		}
+
+		var obj *object.Object
+		if objectType == object.UndefinedObject {
+			var err error
+			if obj, err = c.GetObject(hash); err != nil {
+				return nil, err
+			}
+			objectType = obj.Type
+		}
+		if !objects && (objectType == object.TreeObject || objectType == object.BlobObject) {
+			continue
+		}
+		set.add(hash, objectType)
+
+		switch objectType {
+		case object.CommitObject:
+			commit, err := c.GetCommit(hash)
+			if err != nil {
+				return nil, &object.CorruptObjectError{Hash: hash, Err: err}
+			}
+			if objects {
+				queue = append(queue, reachItem{hash: commit.Tree, objectType: object.TreeObject})
+			}
+			for _, parent := range commit.Parents {
+				queue = append(queue, reachItem{hash: parent, objectType: object.CommitObject})
+			}
+		case object.TreeObject:
+			if obj == nil {
+				var err error
+				if obj, err = c.GetObject(hash); err != nil {
+					return nil, err
+				}
+			}
+			tree, err := object.NewTree(obj)
+			if err != nil {
+				return nil, &object.CorruptObjectError{Hash: hash, Err: err}
+			}
+			for _, entry := range tree.Entries {
+				switch {
+				case entry.Mode == object.ModeGitlink:
+				case entry.Mode.IsTree():
+					queue = append(queue, reachItem{hash: entry.Hash, objectType: object.TreeObject})
+				default:
+					queue = append(queue, reachItem{hash: entry.Hash, objectType: object.BlobObject})
+				}
+			}
+		case object.TagObject:
+			if obj == nil {
+				var err error
+				if obj, err = c.GetObject(hash); err != nil {
+					return nil, err
+				}
+			}
+			tag, err := object.NewTag(obj)
+			if err != nil {
+				return nil, &object.CorruptObjectError{Hash: hash, Err: err}
+			}
+			queue = append(queue, reachItem{hash: tag.Object, objectType: object.UndefinedObject})
+		}
+	}
+	return set, nil
+}
+
+// writeBitmapはpackPathのパックの.bitmapファイルを書き、そのパスを返す. objsはパックに入れた全てのオブジェクトで、
+// そのうち先頭のreachable個が参照などから辿れるもの. 辿れるコミットから参照の指すものと一定の間隔のものを選び、
+// 親から順にビット列を求める. 辿れないオブジェクトは欠けているかもしれないので、そこからは選ばない.
+func (c *Client) writeBitmap(packPath string, objs []*object.Object, reachable int) (string, error) {
+	p, err := pack.Open(packPath)
+	if err != nil {
+		return "", err
+	}
+	order := pack.NewPackOrder(p.Index().Entries())
+	checksum := p.Index().PackChecksum
+	p.Close()
+
+	types := make([]object.Type, order.Len())
+	byHash := map[string]*object.Object{}
+	for _, obj := range objs {
+		if pos, ok := order.Position(obj.Hash); ok {
+			types[pos] = obj.Type
+		}
+		byHash[string(obj.Hash)] = obj
+	}
+
+	// 辿れるコミットを親が先になるように並べる.
+	commits := map[string]*object.Commit{}
+	for _, obj := range objs[:reachable] {
+		if obj.Type != object.CommitObject {
+			continue
+		}
+		commit, err := object.NewCommit(obj)
+		if err != nil {
+			return "", &object.CorruptObjectError{Hash: obj.Hash, Err: err}
+		}
+		commits[string(obj.Hash)] = commit
+	}
+	var sorted []sha.SHA1
+	visited := map[string]struct{}{}
+	for _, obj := range objs[:reachable] {
+		if _, ok := commits[string(obj.Hash)]; !ok {
+			continue
+		}
+		stack := []sha.SHA1{obj.Hash}
+		for len(stack) > 0 {
+			hash := stack[len(stack)-1]
+			if _, ok := visited[string(hash)]; ok {
+				stack = stack[:len(stack)-1]
+				continue
+			}
+			pending := false
+			for _, parent := range commits[string(hash)].Parents {
+				if _, ok := visited[string(parent)]; !ok {
+					if _, ok := commits[string(parent)]; ok {
+						stack = append(stack, parent)
+						pending = true
+					}
+				}
+			}
+			if !pending {
+				visited[string(hash)] = struct{}{}
+				sorted = append(sorted, hash)
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+
+	selected := map[string]struct{}{}
+	roots, err := c.reachabilityRoots()
+	if err != nil {
+		return "", err
+	}
+	for _, root := range roots {
+		if hash, err := c.PeelToCommit(root); err == nil {
+			selected[string(hash)] = struct{}{}
+		}
+	}
+	for i, hash := range sorted {
+		if i%bitmapCommitInterval == bitmapCommitInterval-1 {
+			selected[string(hash)] = struct{}{}
+		}
+	}
+
+	bitmaps := map[string]pack.Bitset{}
+	for _, hash := range sorted {
+		if _, ok := selected[string(hash)]; !ok {
+			continue
+		}
+		var bits pack.Bitset
+		stack := []sha.SHA1{hash}
+		for len(stack) > 0 {
+			h := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			pos, ok := order.Position(h)
+			if !ok {
+				return "", fmt.Errorf("%w : %s is not in the pack", pack.ErrInvalidBitmap, h)
+			}
+			if bits.Has(pos) {
+				continue
+			}
+			// 先に求めた祖先のビット列を使う. 親を後に積むので、ツリーより先に祖先のビット列が入る.
+			if computed, ok := bitmaps[string(h)]; ok {
+				bits.Or(computed)
+				continue
+			}
+			bits.Set(pos)
+			obj := byHash[string(h)]
+			switch obj.Type {
+			case object.CommitObject:
+				commit := commits[string(h)]
+				stack = append(stack, commit.Tree)
+				stack = append(stack, commit.Parents...)
+			case object.TreeObject:
+				tree, err := object.NewTree(obj)
+				if err != nil {
+					return "", &object.CorruptObjectError{Hash: h, Err: err}
+				}
+				for _, entry := range tree.Entries {
+					if entry.Mode != object.ModeGitlink {
+						stack = append(stack, entry.Hash)
+					}
+				}
+			case object.TagObject:
+				tag, err := object.NewTag(obj)
+				if err != nil {
+					return "", &object.CorruptObjectError{Hash: h, Err: err}
+				}
+				stack = append(stack, tag.Object)
+			}
+		}
+		bitmaps[string(hash)] = bits
+	}
+
+	var buf bytes.Buffer
+	if err := pack.WriteBitmap(&buf, order, checksum, types, bitmaps); err != nil {
+		return "", err
+	}
+	path := strings.TrimSuffix(packPath, ".pack") + ".bitmap"
+	if err := ioutil.WriteFile(path+".tmp", buf.Bytes(), 0444); err != nil {
+		return "", err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		os.Remove(path + ".tmp")
+		return "", err
+	}
+	return path, nil
+}
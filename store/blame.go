@@ -0,0 +1,201 @@
+package store
+
+import (
+	"bytes"
+	"container/heap"
+	"fmt"
+	"strings"
+
+	"github.com/kanon1343/fsegit/diff"
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+)
+
+// BlameLineはBlameが返すファイルの1行.
+type BlameLine struct {
+	// Commitはこの行を追加したコミット.
+	Commit *object.Commit
+	// OrigLineはCommitのファイルでのこの行の番号. 1から数える.
+	OrigLine int
+	// Textは行の内容. 最後の行以外は改行を含む.
+	Text string
+}
+
+// blameEntryはまだ追加したコミットが決まっていない行. lineは調べているコミットのファイルでの行番号、
+// finalはstartのファイルでの行番号で、どちらも0から数える.
+type blameEntry struct {
+	line, final int
+}
+
+// Blameはstartのコミットにあるpathのファイルの各行について、その行を追加したコミットを求める.
+// コミット日時の新しい順に履歴を辿り、ファイルを親と比べて変わっていない行は親に引き継ぎ、
+// どの親にもない行をそのコミットが追加したものとする. 親と同じ内容なら、gitと同じく最初のその親に全ての行を引き継ぐ.
+// 名前の変更は追わない. startにpathのファイルがなければErrPathNotInCommitを返す.
+func (c *Client) Blame(start sha.SHA1, path string) ([]BlameLine, error) {
+	path = strings.Trim(path, "/")
+	startCommit, err := c.GetCommit(start)
+	if err != nil {
+		return nil, err
+	}
+	blob, err := c.blobAtPath(startCommit.Tree, path)
+	if err != nil {
+		return nil, err
+	}
+	if blob == nil {
+		return nil, fmt.Errorf("%w : %s", ErrPathNotInCommit, path)
+	}
+
+	contents := map[string][]string{}
+	readLines := func(hash sha.SHA1) ([]string, error) {
+		if lines, ok := contents[string(hash)]; ok {
+			return lines, nil
+		}
+		obj, err := c.GetObject(hash)
+		if err != nil {
+			return nil, err
+		}
+		lines := diff.SplitLines(obj.Data)
+		contents[string(hash)] = lines
+		return lines, nil
+	}
+	lines, err := readLines(blob)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]BlameLine, len(lines))
+	entries := make([]blameEntry, len(lines))
+	for i, line := range lines {
+		result[i].Text = line
+		entries[i] = blameEntry{line: i, final: i}
+	}
+	if len(lines) == 0 {
+		return result, nil
+	}
+
+	// 調べるコミットごとに、まだ決まっていない行とそのコミットでのファイルを持つ.
+	suspects := map[string][]blameEntry{string(start): entries}
+	blobs := map[string]sha.SHA1{string(start): blob}
+	commits := map[string]*object.Commit{string(start): startCommit}
+	queue := &dateQueue{}
+	heap.Push(queue, datedCommit{commit: startCommit, seq: 0})
+	seq := 0
+	for queue.Len() > 0 {
+		commit := heap.Pop(queue).(datedCommit).commit
+		key := string(commit.Hash)
+		entries := suspects[key]
+		delete(suspects, key)
+		blob := blobs[key]
+
+		for _, parentHash := range commit.Parents {
+			if len(entries) == 0 {
+				break
+			}
+			parent, ok := commits[string(parentHash)]
+			if !ok {
+				if parent, err = c.GetCommit(parentHash); err != nil {
+					return nil, err
+				}
+				commits[string(parentHash)] = parent
+			}
+			parentBlob, err := c.blobAtPath(parent.Tree, path)
+			if err != nil {
+				return nil, err
+			}
+			if parentBlob == nil {
+				continue
+			}
+
+			var passed, kept []blameEntry
+			if bytes.Equal(parentBlob, blob) {
+				passed = entries
+			} else {
+				parentLines, err := readLines(parentBlob)
+				if err != nil {
+					return nil, err
+				}
+				commitLines, err := readLines(blob)
+				if err != nil {
+					return nil, err
+				}
+				origins := unchangedLines(parentLines, commitLines)
+				for _, entry := range entries {
+					if origin := origins[entry.line]; origin >= 0 {
+						passed = append(passed, blameEntry{line: origin, final: entry.final})
+					} else {
+						kept = append(kept, entry)
+					}
+				}
+			}
+			entries = kept
+			if len(passed) == 0 {
+				continue
+			}
+			// キューにないコミットだけを入れる. 取り出した後でまた行を引き継いだら、もう一度調べる.
+			if _, queued := suspects[string(parentHash)]; !queued {
+				seq++
+				heap.Push(queue, datedCommit{commit: parent, seq: seq})
+			}
+			suspects[string(parentHash)] = append(suspects[string(parentHash)], passed...)
+			blobs[string(parentHash)] = parentBlob
+		}
+
+		for _, entry := range entries {
+			result[entry.final].Commit = commit
+			result[entry.final].OrigLine = entry.line + 1
+		}
+	}
+	return result, nil
+}
+
+// unchangedLinesはnewLinesの各行について、oldLinesから変わっていなければその行番号を、
+// 追加された行なら-1を返す.
+func unchangedLines(oldLines, newLines []string) []int {
+	origins := make([]int, len(newLines))
+	i, j := 0, 0
+	for _, edit := range diff.Lines(oldLines, newLines) {
+		switch edit.Op {
+		case diff.Equal:
+			origins[j] = i
+			i++
+			j++
+		case diff.Delete:
+			i++
+		case diff.Insert:
+			origins[j] = -1
+			j++
+		}
+	}
+	return origins
+}
+
+// blobAtPathはtreeのpathにあるファイルのブロブを返す. pathがないか、ファイルでなければnilを返す.
+func (c *Client) blobAtPath(tree sha.SHA1, path string) (sha.SHA1, error) {
+	components := strings.Split(path, "/")
+	for i, name := range components {
+		t, err := c.GetTree(tree)
+		if err != nil {
+			return nil, err
+		}
+		var found *object.TreeEntry
+		for j := range t.Entries {
+			if t.Entries[j].Name == name {
+				found = &t.Entries[j]
+				break
+			}
+		}
+		if found == nil {
+			return nil, nil
+		}
+		if i == len(components)-1 {
+			if found.Mode.IsTree() || found.Mode == object.ModeGitlink {
+				return nil, nil
+			}
+			return found.Hash, nil
+		}
+		if !found.Mode.IsTree() {
+			return nil, nil
+		}
+		tree = found.Hash
+	}
+	return nil, nil
+}
@@ -0,0 +1,111 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kanon1343/fsegit/sha"
+)
+
+const branchPrefix = "refs/heads/"
+
+// ListBranchesはrefs/heads以下のブランチを名前順に返す.
+func (c *Client) ListBranches() ([]Ref, error) {
+	return c.ListRefs(branchPrefix)
+}
+
+// checkBranchNameはnameがブランチ名として使えるかを調べる.
+func checkBranchName(name string) error {
+	if strings.HasPrefix(name, "-") || name == "HEAD" || CheckRefName(branchPrefix+name) != nil {
+		return fmt.Errorf("%w : '%s' is not a valid branch name", ErrInvalidRefName, name)
+	}
+	return nil
+}
+
+// CreateBranchはhashのコミットを指すブランチnameを作り、messageをreflogに記録する. 既にあればErrBranchExistsを返す.
+func (c *Client) CreateBranch(name string, hash sha.SHA1, message string) error {
+	if err := checkBranchName(name); err != nil {
+		return err
+	}
+	if _, err := c.ResolveRef(branchPrefix + name); err == nil {
+		return fmt.Errorf("%w : %s", ErrBranchExists, name)
+	}
+	commit, err := c.PeelToCommit(hash)
+	if err != nil {
+		return err
+	}
+	return c.UpdateRef(branchPrefix+name, commit, message)
+}
+
+// DeleteBranchはブランチnameを削除し、削除前に指していたコミットを返す.
+// forceがfalseなら、HEADから辿れないコミットを指すブランチは削除せずにErrBranchNotMergedを返す.
+func (c *Client) DeleteBranch(name string, force bool) (sha.SHA1, error) {
+	head, err := c.ReadHead()
+	if err != nil {
+		return nil, err
+	}
+	if head.Branch == branchPrefix+name {
+		return nil, fmt.Errorf("%w : %s", ErrCurrentBranch, name)
+	}
+	hash, err := c.ResolveRef(branchPrefix + name)
+	if err != nil {
+		return nil, err
+	}
+	if !force {
+		merged := false
+		if !head.Unborn() {
+			if merged, err = c.IsAncestor(hash, head.Hash); err != nil {
+				return nil, err
+			}
+		}
+		if !merged {
+			return nil, fmt.Errorf("%w : %s", ErrBranchNotMerged, name)
+		}
+	}
+	return hash, c.DeleteRef(branchPrefix + name)
+}
+
+// RenameBranchはブランチoldNameをnewNameに変える. HEADがoldNameを指していればnewNameを指すようにする.
+func (c *Client) RenameBranch(oldName, newName string) error {
+	if err := checkBranchName(newName); err != nil {
+		return err
+	}
+	if _, err := c.ResolveRef(branchPrefix + newName); err == nil {
+		return fmt.Errorf("%w : %s", ErrBranchExists, newName)
+	}
+	head, err := c.ReadHead()
+	if err != nil {
+		return err
+	}
+	onBranch := head.Branch == branchPrefix+oldName
+
+	// まだコミットのない現在のブランチは、HEADを書き換えるだけでよい.
+	if onBranch && head.Unborn() {
+		return c.WriteSymbolicRef("HEAD", branchPrefix+newName)
+	}
+	message := fmt.Sprintf("Branch: renamed %s to %s", branchPrefix+oldName, branchPrefix+newName)
+	hash, err := c.ResolveRef(branchPrefix + oldName)
+	if err != nil {
+		return err
+	}
+	if err := c.WriteRef(branchPrefix+newName, hash); err != nil {
+		return err
+	}
+	// DeleteRefはreflogも取り除くので、先に新しい名前へ移しておく.
+	if err := c.renameReflog(branchPrefix+oldName, branchPrefix+newName); err != nil {
+		return err
+	}
+	if err := c.DeleteRef(branchPrefix + oldName); err != nil {
+		return err
+	}
+	if err := c.AppendReflog(branchPrefix+newName, hash, hash, message); err != nil {
+		return err
+	}
+	if onBranch {
+		if err := c.WriteSymbolicRef("HEAD", branchPrefix+newName); err != nil {
+			return err
+		}
+		return c.AppendReflog("HEAD", hash, hash, message)
+	}
+	return nil
+}
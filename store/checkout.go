@@ -0,0 +1,185 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/util"
+)
+
+// CheckoutOptionsはCheckoutCommitの動作を指定する.
+type CheckoutOptions struct {
+	// Forceなら作業ツリーやインデックスの変更を捨てて、対象のコミットの内容で上書きする.
+	Force bool
+}
+
+// CheckoutCommitは作業ツリーとインデックスをhashのコミットの内容に合わせる. HEADは変更しない.
+// HEADと対象のコミットで内容が変わるファイルに手元の変更があれば、何も書き換えずにErrWouldOverwriteを返す.
+// 内容が変わらないファイルの手元の変更はそのまま残す.
+func (c *Client) CheckoutCommit(hash sha.SHA1, opts CheckoutOptions) error {
+	if c.IsBare() {
+		return ErrNoWorkTree
+	}
+	commit, err := c.PeelToCommit(hash)
+	if err != nil {
+		return err
+	}
+	head, err := c.ReadHead()
+	if err != nil {
+		return err
+	}
+	index, err := c.ReadIndex()
+	if err != nil {
+		return err
+	}
+
+	oldFiles := map[string]object.TreeEntry{}
+	if !head.Unborn() && !opts.Force {
+		if err := c.WalkTree(head.Hash, nil, func(path string, entry object.TreeEntry) error {
+			oldFiles[path] = entry
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	newFiles := map[string]object.TreeEntry{}
+	if err := c.WalkTree(commit, nil, func(path string, entry object.TreeEntry) error {
+		newFiles[path] = entry
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	// 書き換えるパス. Forceならインデックスにあるものも含めて全てを対象のコミットに合わせる.
+	var changed []string
+	if opts.Force {
+		seen := map[string]struct{}{}
+		for _, entry := range index.Entries {
+			if _, ok := seen[entry.Path]; !ok {
+				seen[entry.Path] = struct{}{}
+				changed = append(changed, entry.Path)
+			}
+		}
+		for path := range newFiles {
+			if _, ok := seen[path]; !ok {
+				changed = append(changed, path)
+			}
+		}
+	} else {
+		for path, old := range oldFiles {
+			if entry, ok := newFiles[path]; !ok || !sameTreeEntry(old, entry) {
+				changed = append(changed, path)
+			}
+		}
+		for path := range newFiles {
+			if _, ok := oldFiles[path]; !ok {
+				changed = append(changed, path)
+			}
+		}
+		if err := c.checkOverwrite(head, index, oldFiles, changed); err != nil {
+			return err
+		}
+	}
+	sort.Strings(changed)
+	// gitと同じく、別のコミットに切り替えたらコンフリクトを解決する前の記録は捨てる.
+	index.ResolveUndo = nil
+
+	// ファイルとディレクトリが入れ替わる場合に備えて、削除を先に済ませる.
+	for _, path := range changed {
+		if _, ok := newFiles[path]; ok {
+			continue
+		}
+		if entry := index.Entry(path); entry != nil && entry.Mode == object.ModeGitlink {
+			// 取り出したサブモジュールの中身は消さず、空のディレクトリだけを取り除く.
+			os.Remove(util.LongPath(filepath.Join(c.workTree, filepath.FromSlash(path))))
+			index.Remove(path)
+			continue
+		}
+		if err := c.RemoveWorktreeFile(path); err != nil {
+			return err
+		}
+		index.Remove(path)
+	}
+	for _, path := range changed {
+		entry, ok := newFiles[path]
+		if !ok {
+			continue
+		}
+		if opts.Force {
+			// 追跡していないディレクトリが邪魔をしている場合も上書きする.
+			if info, err := os.Lstat(util.LongPath(filepath.Join(c.workTree, filepath.FromSlash(path)))); err == nil && info.IsDir() && entry.Mode != object.ModeGitlink {
+				if err := os.RemoveAll(util.LongPath(filepath.Join(c.workTree, filepath.FromSlash(path)))); err != nil {
+					return err
+				}
+			}
+		}
+		info, err := c.WriteWorktreeEntry(path, entry.Mode, entry.Hash)
+		if err != nil {
+			return err
+		}
+		indexEntry := NewIndexEntry(path, info, entry.Hash, nil, true, true)
+		indexEntry.Mode = entry.Mode
+		index.Add(indexEntry)
+	}
+	return c.WriteIndex(index)
+}
+
+// checkOverwriteはchangedのパスに、書き換えると失われる手元の変更がないかを調べる.
+func (c *Client) checkOverwrite(head *Head, index *Index, oldFiles map[string]object.TreeEntry, changed []string) error {
+	if unmerged := index.Unmerged(); len(unmerged) > 0 {
+		return fmt.Errorf("%w : %s", ErrUnmerged, strings.Join(unmerged, ", "))
+	}
+	var tree sha.SHA1
+	if !head.Unborn() {
+		tree = head.Hash
+	}
+	staged, err := c.DiffTreeIndex(tree, index)
+	if err != nil {
+		return err
+	}
+	unstaged, err := c.DiffIndexWorktree(index)
+	if err != nil {
+		return err
+	}
+	dirty := map[string]struct{}{}
+	for _, change := range staged {
+		dirty[change.Path] = struct{}{}
+	}
+	for _, change := range unstaged {
+		// gitと同じく、サブモジュールの中は書き換えないので、取り出したコミットが違っても切り替えられる.
+		if change.OldMode != object.ModeGitlink {
+			dirty[change.Path] = struct{}{}
+		}
+	}
+
+	var conflicts []string
+	for _, path := range changed {
+		if _, ok := dirty[path]; ok {
+			conflicts = append(conflicts, path)
+			continue
+		}
+		// 追跡していないファイルを上書きしない.
+		_, tracked := oldFiles[path]
+		if !tracked && index.Entry(path) == nil {
+			if _, err := os.Lstat(util.LongPath(filepath.Join(c.workTree, filepath.FromSlash(path)))); err == nil {
+				conflicts = append(conflicts, path)
+			}
+		}
+	}
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		return fmt.Errorf("%w : %s", ErrWouldOverwrite, strings.Join(conflicts, ", "))
+	}
+	return nil
+}
+
+// sameTreeEntryはaとbが同じ内容とモードのファイルかを返す.
+func sameTreeEntry(a, b object.TreeEntry) bool {
+	return a.Mode == b.Mode && bytes.Equal(a.Hash, b.Hash)
+}
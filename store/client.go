@@ -1,36 +1,277 @@
 package store
 
 import (
+	"bytes"
 	"compress/zlib"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/kanon1343/fsegit/commitgraph"
+	"github.com/kanon1343/fsegit/config"
+	"github.com/kanon1343/fsegit/metrics"
 	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/pack"
 	"github.com/kanon1343/fsegit/sha"
 	"github.com/kanon1343/fsegit/util"
 )
 
 type Client struct {
+	workTree  string
+	gitDir    string
 	objectDir string
+	indexFile string
+	recorder  metrics.Recorder
+
+	// packsはobjects/packのパックファイル. ルースオブジェクトが見つからないときに初めて読み込む.
+	packMu      sync.Mutex
+	packs       []*pack.Pack
+	packsLoaded bool
+	// bitmapはパックの.bitmapファイル. 初めて辿れるオブジェクトを求めるときに読み込み、パックと一緒に捨てる.
+	bitmap       *pack.Bitmap
+	bitmapLoaded bool
+
+	// graphはobjects/info/commit-graph. 初めて履歴を辿るときに読み込む.
+	graphMu     sync.Mutex
+	graph       *commitgraph.Graph
+	graphLoaded bool
+
+	// shallowは浅い履歴の境界のコミット. 初めてコミットを読むときに読み込む.
+	shallowMu     sync.Mutex
+	shallow       map[string]struct{}
+	shallowLoaded bool
+
+	// objectsは展開したオブジェクトのキャッシュ. 使わないならnil.
+	objects *objectCache
+}
+
+// Optionsはリポジトリの場所を探索せずに指定するときに使う.
+// 空のフィールドは環境変数(GIT_DIRなど)、それもなければ探索結果から決める.
+type Options struct {
+	// GitDirは管理ディレクトリ(.git)の場所.
+	GitDir string
+	// WorkTreeは作業ツリーの場所.
+	WorkTree string
+	// ObjectDirはオブジェクトを格納するディレクトリ. デフォルトは<GitDir>/objects.
+	ObjectDir string
+	// IndexFileはインデックスファイルの場所. デフォルトは<GitDir>/index.
+	IndexFile string
+	// GitDirNameは作業ツリーの直下で探す管理ディレクトリの名前(".fsegit"か".git").
+	// 空なら環境変数FSEGIT_DIR_NAME、設定fsegit.dirNameの順に決め、どれもなければ.fsegit、.gitの順に探す.
+	GitDirName string
+	// Recorderはオブジェクトの読み書きなどの回数と時間を受け取る. nilなら記録しない.
+	Recorder metrics.Recorder
+	// ObjectCacheSizeは展開したオブジェクトを覚えておくキャッシュの大きさの上限(バイト).
+	// 0ならDefaultObjectCacheSize、負ならキャッシュを使わない.
+	ObjectCacheSize int64
+}
+
+// applyEnvは空のフィールドを環境変数の値で埋める.
+func (opts Options) applyEnv() Options {
+	envs := []struct {
+		field *string
+		name  string
+	}{
+		{&opts.GitDir, "GIT_DIR"},
+		{&opts.WorkTree, "GIT_WORK_TREE"},
+		{&opts.ObjectDir, "GIT_OBJECT_DIRECTORY"},
+		{&opts.IndexFile, "GIT_INDEX_FILE"},
+	}
+	for _, env := range envs {
+		if *env.field == "" {
+			*env.field = os.Getenv(env.name)
+		}
+	}
+	return opts
+}
+
+// gitDirNamesは作業ツリーの直下で探す管理ディレクトリの名前を、name、環境変数FSEGIT_DIR_NAME、
+// 設定fsegit.dirNameの順に決めて返す. どれもなければutil.GitDirNamesを返す.
+func gitDirNames(name string) ([]string, error) {
+	if name == "" {
+		name = os.Getenv("FSEGIT_DIR_NAME")
+	}
+	if name == "" {
+		defaults, err := config.LoadDefaults()
+		if err != nil {
+			return nil, err
+		}
+		if name, err = defaults.GitDirName(); err != nil {
+			return nil, err
+		}
+	}
+	if name == "" {
+		return util.GitDirNames, nil
+	}
+	return []string{name}, nil
 }
 
 // pathのリポジトリのルートディレクトリを探す
 func NewClient(path string) (*Client, error) {
-	rootDir, err := util.FindGitRoot(path)
+	return NewClientWithOptions(path, Options{})
+}
+
+// NewClientWithOptionsはopts、環境変数の順に指定された場所を優先してpathからリポジトリを探す.
+func NewClientWithOptions(path string, opts Options) (*Client, error) {
+	opts = opts.applyEnv()
+	var names []string
+	if opts.GitDir == "" {
+		var err error
+		if names, err = gitDirNames(opts.GitDirName); err != nil {
+			return nil, err
+		}
+	}
+	repo, err := util.DiscoverRepository(path, opts.GitDir, opts.WorkTree, names)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &Client{
+		workTree:  repo.WorkTree,
+		gitDir:    repo.GitDir,
+		objectDir: filepath.Join(repo.GitDir, "objects"),
+		indexFile: filepath.Join(repo.GitDir, "index"),
+		recorder:  opts.Recorder,
+	}
+	switch {
+	case opts.ObjectCacheSize == 0:
+		client.objects = newObjectCache(DefaultObjectCacheSize)
+	case opts.ObjectCacheSize > 0:
+		client.objects = newObjectCache(opts.ObjectCacheSize)
+	}
+	if client.recorder == nil {
+		client.recorder = metrics.Nop
+	}
+	if opts.ObjectDir != "" {
+		if client.objectDir, err = filepath.Abs(opts.ObjectDir); err != nil {
+			return nil, err
+		}
+	}
+	if opts.IndexFile != "" {
+		if client.indexFile, err = filepath.Abs(opts.IndexFile); err != nil {
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+// GitDirはリポジトリの管理ディレクトリ(.git)のパスを返す.
+func (c *Client) GitDir() string {
+	return c.gitDir
+}
+
+// WorkTreeは作業ツリーのルートディレクトリのパスを返す.
+func (c *Client) WorkTree() string {
+	return c.workTree
+}
+
+// IsBareは作業ツリーを持たないベアリポジトリかを返す.
+func (c *Client) IsBare() bool {
+	return c.workTree == ""
+}
+
+// IndexFileはインデックスファイルのパスを返す.
+func (c *Client) IndexFile() string {
+	return c.indexFile
+}
+
+// ConfigPathはリポジトリの設定ファイル(<GitDir>/config)のパスを返す.
+func (c *Client) ConfigPath() string {
+	return filepath.Join(c.gitDir, "config")
+}
+
+// Configはシステム全体と利用者全体の設定にリポジトリの設定ファイルを重ねて返す.
+func (c *Client) Config() (*config.Config, error) {
+	cfg, err := config.LoadDefaults()
+	if err != nil {
+		return nil, err
+	}
+	local, err := config.Load(c.ConfigPath())
 	if err != nil {
 		return nil, err
 	}
-	return &Client{
-		objectDir: filepath.Join(rootDir, ".git", "objects"),
-	}, nil
+	cfg.Merge(local)
+	return cfg, nil
 }
 
-// hashで指定したobjectを返す
+// TrustFileModeは作業ツリーの実行ビットを信頼するか(core.filemode)を返す.
+// 設定がなければファイルシステムが実行ビットを保持できるかで決める.
+func (c *Client) TrustFileMode() (bool, error) {
+	cfg, err := c.Config()
+	if err != nil {
+		return false, err
+	}
+	return cfg.GetBool("core.filemode", util.FileModeSupported)
+}
+
+// TrustSymlinksは作業ツリーにシンボリックリンクを作るか(core.symlinks)を返す. falseならシンボリックリンクは
+// リンク先を内容とする通常のファイルとして取り出し、インデックスのモードを引き継ぐ.
+// 設定がなければファイルシステムがシンボリックリンクを扱えるかで決める.
+func (c *Client) TrustSymlinks() (bool, error) {
+	cfg, err := c.Config()
+	if err != nil {
+		return false, err
+	}
+	return cfg.GetBool("core.symlinks", util.SymlinksSupported)
+}
+
+// GetObjectContextはGetObjectと同じだが、ctxが取り消されていれば読まずにctx.Err()を返す.
+func (c *Client) GetObjectContext(ctx context.Context, hash sha.SHA1) (*object.Object, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.GetObject(hash)
+}
+
+// hashで指定したobjectを返す. 一度展開したオブジェクトはキャッシュにあれば展開し直さない.
+// キャッシュしたものと内容を共有するので、返したオブジェクトのDataを書き換えてはならない.
 func (c *Client) GetObject(hash sha.SHA1) (*object.Object, error) {
+	if obj := c.objects.get(hash); obj != nil {
+		c.recorder.Add(metrics.ObjectCacheHits, 1)
+		cached := *obj
+		return &cached, nil
+	}
+	obj, err := c.readObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	c.objects.add(obj)
+	cached := *obj
+	return &cached, nil
+}
+
+// readObjectはhashのオブジェクトをルースオブジェクトかパックから読んで展開する.
+func (c *Client) readObject(hash sha.SHA1) (*object.Object, error) {
+	if err := checkHashSize(hash); err != nil {
+		return nil, err
+	}
+	defer metrics.Since(c.recorder, metrics.ObjectReadTime, time.Now())
 	hashString := hash.String()
 	objectPath := filepath.Join(c.objectDir, hashString[:2], hashString[2:])
 
-	objectFile, err := os.Open(objectPath)
+	objectFile, err := os.Open(util.LongPath(objectPath))
+	if os.IsNotExist(err) {
+		obj, packErr := c.getPackedObject(hash)
+		if packErr != nil {
+			return nil, packErr
+		}
+		if obj == nil {
+			return nil, err
+		}
+		c.recorder.Add(metrics.ObjectsRead, 1)
+		c.recorder.Add(metrics.BytesDecompressed, int64(len(obj.Header())+len(obj.Data)))
+		return obj, nil
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -38,48 +279,378 @@ func (c *Client) GetObject(hash sha.SHA1) (*object.Object, error) {
 
 	zr, err := zlib.NewReader(objectFile)
 	if err != nil {
-		return nil, err
+		return nil, &object.CorruptObjectError{Hash: hash, Err: err}
 	}
 
 	obj, err := object.ReadObject(zr)
 	if err != nil {
-		return nil, err
+		return nil, &object.CorruptObjectError{Hash: hash, Err: err}
+	}
+	if !bytes.Equal(obj.Hash, hash) {
+		return nil, &object.CorruptObjectError{Hash: hash, Err: fmt.Errorf("%w : hash mismatch", object.ErrInvalidObject)}
 	}
+	c.recorder.Add(metrics.ObjectsRead, 1)
+	c.recorder.Add(metrics.BytesDecompressed, int64(len(obj.Header())+len(obj.Data)))
 	return obj, nil
 }
 
+// HasObjectはhashのオブジェクトがルースかパックにあるかを返す. ルースオブジェクトのファイルとパックの索引だけを見て、
+// 内容を読んだり展開したりはしないので、内容が壊れていないかは調べない.
+func (c *Client) HasObject(hash sha.SHA1) (bool, error) {
+	if ok, err := c.hasObject(hash); ok || err != nil {
+		return ok, err
+	}
+	// 別のプロセスが追加したパックにあるかもしれない.
+	c.packMu.Lock()
+	c.closePacks()
+	c.packMu.Unlock()
+	return c.hasPackedObject(hash)
+}
+
+// checkHashSizeはhashがSHA-1の20バイトかを調べる. 外から受け取ったハッシュでオブジェクトのパスを作る前に使う.
+func checkHashSize(hash sha.SHA1) error {
+	if len(hash) != 20 {
+		return fmt.Errorf("%w : invalid hash %q", ErrObjectNotFound, hash.String())
+	}
+	return nil
+}
+
+// hasObjectはhashのオブジェクトがルースか読み込み済みのパックにあるかを返す. HasObjectと違ってパックを読み込み直さないので、
+// 書き込む前の確認に使う. 他のプロセスが追加したパックにあるものを見落としても、同じ内容をルースに書くだけで済む.
+func (c *Client) hasObject(hash sha.SHA1) (bool, error) {
+	if err := checkHashSize(hash); err != nil {
+		return false, err
+	}
+	hashString := hash.String()
+	_, err := os.Stat(util.LongPath(filepath.Join(c.objectDir, hashString[:2], hashString[2:])))
+	if err == nil {
+		return true, nil
+	}
+	if !os.IsNotExist(err) {
+		return false, err
+	}
+	return c.hasPackedObject(hash)
+}
+
+// ResolveHashは16進数のハッシュの先頭の部分prefixに一致するオブジェクトをルースオブジェクトとパックの索引から探して、
+// そのハッシュを返す. prefixは4文字以上とする. 一致するものがなければErrObjectNotFound、
+// 複数あれば候補を持つ*AmbiguousHashErrorを返す.
+func (c *Client) ResolveHash(prefix string) (sha.SHA1, error) {
+	prefix = strings.ToLower(prefix)
+	if len(prefix) < 4 || len(prefix) > 40 || strings.Trim(prefix, "0123456789abcdef") != "" {
+		return nil, fmt.Errorf("%w : %s", ErrObjectNotFound, prefix)
+	}
+	if len(prefix) == 40 {
+		hash, _ := hex.DecodeString(prefix)
+		ok, err := c.HasObject(hash)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("%w : %s", ErrObjectNotFound, prefix)
+		}
+		return hash, nil
+	}
+
+	candidates := map[string]sha.SHA1{}
+	names, err := ioutil.ReadDir(util.LongPath(filepath.Join(c.objectDir, prefix[:2])))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, info := range names {
+		name := prefix[:2] + info.Name()
+		if len(name) != 40 || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if hash, err := hex.DecodeString(name); err == nil {
+			candidates[name] = hash
+		}
+	}
+	hashes, err := c.findPackedPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, hash := range hashes {
+		candidates[hash.String()] = hash
+	}
+
+	switch len(candidates) {
+	case 0:
+		return nil, fmt.Errorf("%w : %s", ErrObjectNotFound, prefix)
+	case 1:
+		for _, hash := range candidates {
+			return hash, nil
+		}
+	}
+	keys := make([]string, 0, len(candidates))
+	for key := range candidates {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	ambiguous := &AmbiguousHashError{Prefix: prefix}
+	for _, key := range keys {
+		ambiguous.Candidates = append(ambiguous.Candidates, candidates[key])
+	}
+	return nil, ambiguous
+}
+
+// WriteObjectはobjをルースオブジェクトとして書き込む. 既にルースかパックに存在する場合は何もしない.
+func (c *Client) WriteObject(obj *object.Object) error {
+	if ok, err := c.hasObject(obj.Hash); ok || err != nil {
+		return err
+	}
+	hashString := obj.Hash.String()
+	objectPath := filepath.Join(c.objectDir, hashString[:2], hashString[2:])
+	if err := os.MkdirAll(filepath.Dir(objectPath), 0755); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	if _, err := zw.Write(obj.Header()); err != nil {
+		return err
+	}
+	if _, err := zw.Write(obj.Data); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := util.WriteFileViaRename(objectPath, buf.Bytes(), 0444); err != nil {
+		// 同じオブジェクトを別のプロセスが先に書き込んだ場合は成功とみなす.
+		if _, statErr := os.Stat(util.LongPath(objectPath)); statErr == nil {
+			return nil
+		}
+		return err
+	}
+	c.recorder.Add(metrics.ObjectsWritten, 1)
+	c.recorder.Add(metrics.BytesCompressed, int64(buf.Len()))
+	return nil
+}
+
+// StoreRawはobjectTypeとdataからヘッダとハッシュを計算してルースオブジェクトとして書き込み、ハッシュを返す.
+// 既にルースかパックに存在する場合は書き込まずにハッシュだけを返す.
+func (c *Client) StoreRaw(objectType object.Type, data []byte) (sha.SHA1, error) {
+	obj := object.NewObject(objectType, data)
+	if err := c.WriteObject(obj); err != nil {
+		return nil, err
+	}
+	return obj.Hash, nil
+}
+
+// StoreReaderはrから読んだsizeバイトをobjectTypeのオブジェクトとして書き込み、ハッシュを返す.
+// 内容をメモリに読み込まず、ハッシュを計算しながら一時ファイルに圧縮して書き込んでからrenameする.
+// rから読めたデータがsizeと違う場合はErrSizeMismatchを返す.
+func (c *Client) StoreReader(objectType object.Type, size int64, r io.Reader) (sha.SHA1, error) {
+	if err := os.MkdirAll(util.LongPath(c.objectDir), 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := ioutil.TempFile(util.LongPath(c.objectDir), ".tmp-obj-")
+	if err != nil {
+		return nil, err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	checkSum := sha1.New()
+	zw := zlib.NewWriter(tmp)
+	w := io.MultiWriter(checkSum, zw)
+	_, err = fmt.Fprintf(w, "%s %d\x00", objectType, size)
+	var n int64
+	if err == nil {
+		// 宣言より長いデータも検出できるように1バイト多く読む.
+		n, err = io.Copy(w, io.LimitReader(r, size+1))
+	}
+	if err == nil && n != size {
+		err = fmt.Errorf("%w : read %d bytes, want %d", ErrSizeMismatch, n, size)
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha.SHA1(checkSum.Sum(nil))
+	hashString := hash.String()
+	objectPath := filepath.Join(c.objectDir, hashString[:2], hashString[2:])
+	if ok, err := c.hasObject(hash); ok || err != nil {
+		return hash, err
+	}
+	info, err := os.Stat(tmpName)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(util.LongPath(filepath.Dir(objectPath)), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(tmpName, 0444); err != nil {
+		return nil, err
+	}
+	if err := util.Rename(tmpName, util.LongPath(objectPath)); err != nil {
+		// 同じオブジェクトを別のプロセスが先に書き込んだ場合は成功とみなす.
+		if _, statErr := os.Stat(util.LongPath(objectPath)); statErr == nil {
+			return hash, nil
+		}
+		return nil, err
+	}
+	c.recorder.Add(metrics.ObjectsWritten, 1)
+	c.recorder.Add(metrics.BytesCompressed, info.Size())
+	return hash, nil
+}
+
+// WalkFuncは履歴を辿るときにそれぞれのコミットに適用する. object.ErrStopWalkを返すとそこで探索を終える.
 type WalkFunc func(*object.Commit) error
 
-// hashで指定したコミットから履歴を遡ってそれぞれのコミットにwalkFuncを適用する.
+// WalkOrderはWalkHistoryWithOptsでコミットを辿る順番.
+type WalkOrder int
+
+const (
+	// WalkOrderDateはコミット日時の新しいものから辿る. gitのlogの既定の順番と同じ.
+	WalkOrderDate WalkOrder = iota
+	// WalkOrderTopoは子が必ず親より先になるように辿る. gitの--topo-orderと同じ.
+	// 順番を決めるために先に全てのコミットを読み込む.
+	WalkOrderTopo
+)
+
+// WalkHistoryOptsはWalkHistoryWithOptsの設定.
+type WalkHistoryOpts struct {
+	Order WalkOrder
+}
+
+// hashで指定したコミットから履歴を遡って、コミット日時の新しい順にそれぞれのコミットにwalkFuncを適用する.
 func (c *Client) WalkHistory(hash sha.SHA1, walkFunc WalkFunc) error {
-	ancestors := []sha.SHA1{hash}
-	cycleCheck := map[string]struct{}{}
-
-	// BFS
-	for len(ancestors) > 0 {
-		currentHash := ancestors[0]
-		if _, ok := cycleCheck[string(currentHash)]; ok {
-			ancestors = ancestors[1:]
+	return c.WalkHistoryWithOpts(hash, WalkHistoryOpts{}, walkFunc)
+}
+
+// hashで指定したコミットから履歴を遡って、opts.Orderの順にそれぞれのコミットにwalkFuncを適用する.
+// walkFuncがobject.ErrStopWalkを返したら残りのコミットは辿らずにnilを返す.
+func (c *Client) WalkHistoryWithOpts(hash sha.SHA1, opts WalkHistoryOpts, walkFunc WalkFunc) error {
+	return c.WalkHistoryContext(context.Background(), hash, opts, walkFunc)
+}
+
+// WalkHistoryContextはWalkHistoryWithOptsと同じだが、ctxが取り消されたらそこで辿るのをやめてctx.Err()を返す.
+func (c *Client) WalkHistoryContext(ctx context.Context, hash sha.SHA1, opts WalkHistoryOpts, walkFunc WalkFunc) error {
+	var err error
+	switch opts.Order {
+	case WalkOrderTopo:
+		var commits []*object.Commit
+		if commits, err = c.TopoSortHistoryContext(ctx, []sha.SHA1{hash}, nil); err != nil {
+			return err
+		}
+		for _, commit := range commits {
+			if err = ctx.Err(); err != nil {
+				break
+			}
+			if err = walkFunc(commit); err != nil {
+				break
+			}
+		}
+	default:
+		err = c.walkByDate(ctx, hash, walkFunc)
+	}
+	if errors.Is(err, object.ErrStopWalk) {
+		return nil
+	}
+	return err
+}
+
+// tipsから辿れるコミットを、親が必ず子より先になる順でwalkFuncに適用する.
+// skipがtrueを返したコミットはその祖先も含めて辿らない(他のコミットから辿れる祖先は除く).
+func (c *Client) WalkHistoryReverse(tips []sha.SHA1, skip func(sha.SHA1) bool, walkFunc WalkFunc) error {
+	type frame struct {
+		hash sha.SHA1
+		// commitは親を積み終えたときに設定される. 再びスタックの先頭に来たらwalkFuncを適用する.
+		commit *object.Commit
+	}
+	visited := map[string]struct{}{}
+	stack := make([]frame, 0, len(tips))
+	for i := len(tips) - 1; i >= 0; i-- {
+		stack = append(stack, frame{hash: tips[i]})
+	}
+
+	// DFSの帰りがけ順.
+	for len(stack) > 0 {
+		top := len(stack) - 1
+		if stack[top].commit != nil {
+			current := stack[top].commit
+			stack = stack[:top]
+			if err := walkFunc(current); err != nil {
+				return err
+			}
 			continue
 		}
-		cycleCheck[string(currentHash)] = struct{}{}
 
-		obj, err := c.GetObject(currentHash)
-		if err != nil {
-			return err
+		currentHash := stack[top].hash
+		if _, ok := visited[string(currentHash)]; ok || (skip != nil && skip(currentHash)) {
+			stack = stack[:top]
+			continue
 		}
+		visited[string(currentHash)] = struct{}{}
 
-		current, err := object.NewCommit(obj)
+		current, err := c.GetCommit(currentHash)
 		if err != nil {
 			return err
 		}
-
-		if err := walkFunc(current); err != nil {
-			return err
+		stack[top].commit = current
+		for i := len(current.Parents) - 1; i >= 0; i-- {
+			stack = append(stack, frame{hash: current.Parents[i]})
 		}
+	}
+	return nil
+}
 
-		ancestors = append(ancestors[1:], current.Parents...)
+// IsAncestorはancestorのコミットがdescendantから親を辿って到達できるかを返す. 同じコミットならtrue.
+// コミットグラフがあれば、親はコミットオブジェクトを読まずにそこから求め、ancestorより世代数の小さい
+// コミットからは先を辿らない.
+func (c *Client) IsAncestor(ancestor, descendant sha.SHA1) (bool, error) {
+	if c.commitGraph() == nil {
+		return c.isAncestorByDate(ancestor, descendant)
+	}
+	w := newGenerationWalker(c)
+	minGeneration := 0
+	if commit := c.lookupCommitGraph(ancestor); commit != nil {
+		minGeneration = int(commit.Generation)
+	}
+	visited := map[string]struct{}{}
+	stack := []sha.SHA1{descendant}
+	for len(stack) > 0 {
+		hash := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if bytes.Equal(hash, ancestor) {
+			return true, nil
+		}
+		if _, ok := visited[string(hash)]; ok {
+			continue
+		}
+		visited[string(hash)] = struct{}{}
+		if commit := c.lookupCommitGraph(hash); commit != nil && int(commit.Generation) < minGeneration {
+			continue
+		}
+		parents, err := w.commitParents(hash)
+		if err != nil {
+			return false, err
+		}
+		stack = append(stack, parents...)
 	}
+	return false, nil
+}
 
-	return nil
+// isAncestorByDateはコミットグラフがないときのIsAncestor. 新しいコミットから順に読んでancestorを探す.
+func (c *Client) isAncestorByDate(ancestor, descendant sha.SHA1) (bool, error) {
+	found := false
+	err := c.WalkHistory(descendant, func(commit *object.Commit) error {
+		if bytes.Equal(commit.Hash, ancestor) {
+			found = true
+			return object.ErrStopWalk
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return found, nil
 }
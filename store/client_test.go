@@ -1,24 +1,3226 @@
 package store
 
 import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/kanon1343/fsegit/config"
+	"github.com/kanon1343/fsegit/diff"
+	"github.com/kanon1343/fsegit/metrics"
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/util"
 )
 
+// テスト用の空リポジトリを作成してルートディレクトリを返す.
+func newTestRepository(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, ".git", "objects"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// テスト用のルースオブジェクトを書き込んでハッシュを返す.
+func writeTestObject(t *testing.T, dir string, objectType object.Type, data []byte) sha.SHA1 {
+	t.Helper()
+	raw := append([]byte(fmt.Sprintf("%s %d\x00", objectType, len(data))), data...)
+	sum := sha1.Sum(raw)
+	hash := sha.SHA1(sum[:])
+
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	if _, err := zw.Write(raw); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	hashString := hash.String()
+	objectDir := filepath.Join(dir, ".git", "objects", hashString[:2])
+	if err := os.MkdirAll(objectDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(objectDir, hashString[2:]), buf.Bytes(), 0444); err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+// テスト用のツリーオブジェクトのデータを組み立てる.
+func treeData(entries ...object.TreeEntry) []byte {
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		fmt.Fprintf(&buf, "%o %s\x00", uint32(entry.Mode), entry.Name)
+		buf.Write(entry.Hash)
+	}
+	return buf.Bytes()
+}
+
 // コミットオブジェクトが正しく取れるか
 func TestClient_GetObject(t *testing.T) {
-	client, err := NewClient("/Users/haradakanon/Desktop/Atcoder")
+	dir := newTestRepository(t)
+	tree := writeTestObject(t, dir, object.TreeObject, nil)
+	hash := writeTestObject(t, dir, object.CommitObject, []byte(fmt.Sprintf(
+		"tree %s\nauthor fsegit <fsegit@example.com> 1672531200 +0900\ncommitter fsegit <fsegit@example.com> 1672531200 +0900\n\ninitial commit\n",
+		tree)))
+
+	client, err := NewClient(dir)
 	if err != nil {
 		t.Fatal(err)
 	}
-	hashString := "366fa17c32ca232790db770d4e37898e48bdd2ce"
-	hash, err := hex.DecodeString(hashString)
+	obj, err := client.GetObject(hash)
 	if err != nil {
 		t.Fatal(err)
 	}
-	obj, err := client.GetObject(hash)
+	if obj.Type != object.CommitObject {
+		t.Fatalf("type = %s, want commit", obj.Type)
+	}
+	t.Log(obj.Type)
+}
+
+// ツリーを再帰的に辿り、フィルタで枝刈りできるか
+func TestClient_WalkTree(t *testing.T) {
+	dir := newTestRepository(t)
+	blob := writeTestObject(t, dir, object.BlobObject, []byte("hello\n"))
+	sub := writeTestObject(t, dir, object.TreeObject, treeData(
+		object.TreeEntry{Mode: object.ModeBlob, Name: "b.txt", Hash: blob},
+	))
+	root := writeTestObject(t, dir, object.TreeObject, treeData(
+		object.TreeEntry{Mode: object.ModeBlob, Name: "a.txt", Hash: blob},
+		object.TreeEntry{Mode: object.ModeTree, Name: "docs", Hash: sub},
+		object.TreeEntry{Mode: object.ModeTree, Name: "src", Hash: sub},
+	))
+
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	if err := client.WalkTree(root, nil, func(path string, entry object.TreeEntry) error {
+		paths = append(paths, path)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(paths) != "[a.txt docs/b.txt src/b.txt]" {
+		t.Errorf("paths = %v", paths)
+	}
+
+	paths = nil
+	if err := client.WalkTree(root, prefixFilter("src"), func(path string, entry object.TreeEntry) error {
+		paths = append(paths, path)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(paths) != "[src/b.txt]" {
+		t.Errorf("paths = %v", paths)
+	}
+}
+
+type prefixFilter string
+
+func (p prefixFilter) Match(path string) bool {
+	return len(path) > len(p) && path[:len(p)+1] == string(p)+"/"
+}
+
+func (p prefixFilter) MatchDir(dir string) bool {
+	return dir == string(p)
+}
+
+// 環境変数でリポジトリの場所を上書きできるか
+func TestNewClientWithOptions_Env(t *testing.T) {
+	dir := newTestRepository(t)
+	gitDir := filepath.Join(dir, ".git")
+	indexFile := filepath.Join(t.TempDir(), "index")
+	objectDir := t.TempDir()
+	workTree := t.TempDir()
+
+	for name, value := range map[string]string{"GIT_DIR": gitDir, "GIT_INDEX_FILE": indexFile, "GIT_OBJECT_DIRECTORY": objectDir, "GIT_WORK_TREE": workTree} {
+		old, ok := os.LookupEnv(name)
+		os.Setenv(name, value)
+		defer func(name, old string, ok bool) {
+			if ok {
+				os.Setenv(name, old)
+			} else {
+				os.Unsetenv(name)
+			}
+		}(name, old, ok)
+	}
+
+	client, err := NewClient(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.GitDir() != gitDir {
+		t.Errorf("GitDir() = %s, want %s", client.GitDir(), gitDir)
+	}
+	if client.IndexFile() != indexFile {
+		t.Errorf("IndexFile() = %s, want %s", client.IndexFile(), indexFile)
+	}
+	if client.WorkTree() != workTree {
+		t.Errorf("WorkTree() = %s, want %s", client.WorkTree(), workTree)
+	}
+	hash, err := client.StoreRaw(object.BlobObject, []byte("env\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(objectDir, hash.String()[:2], hash.String()[2:])); err != nil {
+		t.Errorf("object was not written to GIT_OBJECT_DIRECTORY: %v", err)
+	}
+	if root, err := util.FindGitRoot(t.TempDir()); err != nil || root != workTree {
+		t.Errorf("FindGitRoot() = %s, %v, want %s", root, err, workTree)
+	}
+
+	client, err = NewClientWithOptions(t.TempDir(), Options{GitDir: gitDir, IndexFile: "override"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(client.IndexFile()) != "override" {
+		t.Errorf("IndexFile() = %s, options should take precedence over the environment", client.IndexFile())
+	}
+}
+
+// コミットのないブランチを指すHEADをエラーにせず読めるか
+func TestClient_ReadHead_Unborn(t *testing.T) {
+	dir := newTestRepository(t)
+	if err := ioutil.WriteFile(filepath.Join(dir, ".git", "HEAD"), []byte("ref: refs/heads/main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	head, err := client.ReadHead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !head.Unborn() || head.ShortBranch() != "main" || head.Parents() != nil {
+		t.Errorf("head = %+v, want unborn main", head)
+	}
+	if _, err := client.ResolveHeadCommit(); !errors.Is(err, ErrUnbornBranch) {
+		t.Errorf("ResolveHeadCommit() error = %v, want ErrUnbornBranch", err)
+	}
+}
+
+// 切り離されたHEADで作ったコミットだけが参照から辿れないものとして返るか
+func TestClient_OrphanedCommits(t *testing.T) {
+	dir := newTestRepository(t)
+	tree := writeTestObject(t, dir, object.TreeObject, nil)
+	commit := func(message string, parents ...sha.SHA1) sha.SHA1 {
+		data := fmt.Sprintf("tree %s\n", tree)
+		for _, parent := range parents {
+			data += fmt.Sprintf("parent %s\n", parent)
+		}
+		data += "author fsegit <fsegit@example.com> 1672531200 +0900\ncommitter fsegit <fsegit@example.com> 1672531200 +0900\n\n" + message + "\n"
+		return writeTestObject(t, dir, object.CommitObject, []byte(data))
+	}
+	base := commit("base")
+	detached1 := commit("detached 1", base)
+	detached2 := commit("detached 2", detached1)
+
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.WriteRef("refs/heads/main", base); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.DetachHead(detached2, "checkout: moving to detached2"); err != nil {
+		t.Fatal(err)
+	}
+	head, err := client.ReadHead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !head.Detached() {
+		t.Errorf("head = %+v, want detached", head)
+	}
+
+	orphaned, err := client.OrphanedCommits(detached2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orphaned) != 2 || !bytes.Equal(orphaned[0].Hash, detached2) || !bytes.Equal(orphaned[1].Hash, detached1) {
+		t.Errorf("orphaned = %v, want [detached 2, detached 1]", orphaned)
+	}
+}
+
+// FETCH_HEADを参照として解決でき、packed-refsの参照を削除できるか
+func TestClient_SpecialRefs(t *testing.T) {
+	dir := newTestRepository(t)
+	blob := writeTestObject(t, dir, object.BlobObject, []byte("hello\n"))
+	other := writeTestObject(t, dir, object.BlobObject, []byte("other\n"))
+	packed := fmt.Sprintf("# pack-refs with: peeled\n%s refs/tags/v1\n^%s\n%s refs/heads/main\n", blob, other, other)
+	if err := ioutil.WriteFile(filepath.Join(dir, ".git", "packed-refs"), []byte(packed), 0644); err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.WriteFetchHead([]FetchHeadEntry{
+		{Hash: other, NotForMerge: true, Description: "branch 'topic' of origin"},
+		{Hash: blob, Description: "branch 'main' of origin"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	name, err := client.DWIMRef(FetchHead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash, err := client.ResolveRef(name); err != nil || !bytes.Equal(hash, blob) {
+		t.Errorf("ResolveRef(FETCH_HEAD) = %s, %v, want the entry for merge", hash, err)
+	}
+
+	if err := client.DeleteRef("refs/tags/v1"); err != nil {
+		t.Fatal(err)
+	}
+	refs, err := client.ListRefs("refs/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 1 || refs[0].Name != "refs/heads/main" {
+		t.Errorf("refs = %v, want only refs/heads/main", refs)
+	}
+	if err := client.DeleteRef("refs/tags/v1"); !errors.Is(err, ErrRefNotFound) {
+		t.Errorf("DeleteRef() error = %v, want ErrRefNotFound", err)
+	}
+}
+
+// インデックスを書き込んで読み直すと同じエントリが得られるか
+func TestIndex_EncodeParse(t *testing.T) {
+	hash := sha.SHA1(bytes.Repeat([]byte{0xab}, 20))
+	index := NewIndex()
+	for _, path := range []string{"b.txt", "a/c.txt", "a.txt"} {
+		index.Add(&IndexEntry{Mode: object.ModeBlob, Hash: hash, Path: path, Size: uint32(len(path))})
+	}
+	index.Entries = append(index.Entries, &IndexEntry{Mode: object.ModeBlob, Hash: hash, Path: "b.txt", Stage: 2})
+
+	parsed, err := ParseIndex(index.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, entry := range parsed.Entries {
+		paths = append(paths, fmt.Sprintf("%s:%d", entry.Path, entry.Stage))
+	}
+	if fmt.Sprint(paths) != "[a.txt:0 a/c.txt:0 b.txt:0 b.txt:2]" {
+		t.Errorf("entries = %v", paths)
+	}
+	if unmerged := parsed.Unmerged(); fmt.Sprint(unmerged) != "[b.txt]" {
+		t.Errorf("Unmerged() = %v", unmerged)
+	}
+
+	data := index.Encode()
+	data[len(data)-1] ^= 0xff
+	if _, err := ParseIndex(data); !errors.Is(err, ErrInvalidIndex) {
+		t.Errorf("ParseIndex() error = %v, want ErrInvalidIndex for a bad checksum", err)
+	}
+
+	// 管理ディレクトリの中を指すパスは、表記を変えても受け付けない.
+	for _, path := range []string{".fsegit/config", ".GIT/hooks/post-checkout", "sub/.Git./config", "GIT~1/config"} {
+		bad := NewIndex()
+		bad.Add(&IndexEntry{Mode: object.ModeBlob, Hash: hash, Path: path})
+		if _, err := ParseIndex(bad.Encode()); !errors.Is(err, ErrInvalidIndex) {
+			t.Errorf("ParseIndex() with %q = %v, want ErrInvalidIndex", path, err)
+		}
+	}
+}
+
+// AddEntriesでまとめて追加した結果が、1つずつAddした場合と同じになるか
+func TestIndex_AddEntries(t *testing.T) {
+	newIndex := func() *Index {
+		index := NewIndex()
+		for _, path := range []string{"b.txt", "d/e.txt"} {
+			index.Add(&IndexEntry{Mode: object.ModeBlob, Hash: bytes.Repeat([]byte{0x01}, 20), Path: path})
+		}
+		index.AddUnmerged("c.txt",
+			&IndexEntry{Mode: object.ModeBlob, Hash: bytes.Repeat([]byte{0x02}, 20), Stage: 2},
+			&IndexEntry{Mode: object.ModeBlob, Hash: bytes.Repeat([]byte{0x03}, 20), Stage: 3})
+		return index
+	}
+	newEntries := func() []*IndexEntry {
+		var entries []*IndexEntry
+		for i, path := range []string{"z.txt", "b.txt", "a.txt", "c.txt", "d/a.txt", "a.txt"} {
+			entries = append(entries, &IndexEntry{Mode: object.ModeBlob, Hash: bytes.Repeat([]byte{byte(0x10 + i)}, 20), Path: path})
+		}
+		return entries
+	}
+	describe := func(index *Index) string {
+		var entries []string
+		for _, entry := range index.Entries {
+			entries = append(entries, fmt.Sprintf("%s:%d:%x", entry.Path, entry.Stage, entry.Hash[:1]))
+		}
+		return fmt.Sprintf("%v %d", entries, len(index.ResolveUndo))
+	}
+
+	want := newIndex()
+	for _, entry := range newEntries() {
+		want.Add(entry)
+	}
+	got := newIndex()
+	got.AddEntries(newEntries())
+	if describe(got) != describe(want) {
+		t.Errorf("AddEntries() = %s, want %s", describe(got), describe(want))
+	}
+}
+
+// バージョン2から4のどれで書いても、拡張フラグと長いパスの差分を含めて同じ内容に読めるか
+func TestIndex_Versions(t *testing.T) {
+	hash := sha.SHA1(bytes.Repeat([]byte{0xab}, 20))
+	long := strings.Repeat("d", 300)
+	paths := []string{"a/b/c.txt", "a/b/d.txt", "a/e.txt", long + "/x", long + "/y", "z"}
+	for _, version := range []uint32{2, 3, 4} {
+		index := NewIndex()
+		index.Version = version
+		for _, path := range paths {
+			index.Add(&IndexEntry{Mode: object.ModeBlob, Hash: hash, Path: path})
+		}
+		index.Entry("a/e.txt").SkipWorktree = version >= 3
+		index.Entry("z").IntentToAdd = version >= 3
+		index.Entry("a/b/d.txt").AssumeValid = true
+
+		data := index.Encode()
+		if got := binary.BigEndian.Uint32(data[4:8]); got != version {
+			t.Errorf("version %d: encoded as version %d", version, got)
+		}
+		parsed, err := ParseIndex(data)
+		if err != nil {
+			t.Fatalf("version %d: %v", version, err)
+		}
+		var got []string
+		for _, entry := range parsed.Entries {
+			got = append(got, entry.Path)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(paths) {
+			t.Errorf("version %d: paths = %v", version, got)
+		}
+		if !parsed.Entry("a/b/d.txt").AssumeValid || parsed.Entry("a/e.txt").SkipWorktree != (version >= 3) || parsed.Entry("z").IntentToAdd != (version >= 3) {
+			t.Errorf("version %d: flags were not kept", version)
+		}
+	}
+
+	// 拡張フラグがあればバージョン2を指定していても3で書く.
+	index := NewIndex()
+	index.Add(&IndexEntry{Mode: object.ModeBlob, Hash: hash, Path: "a", SkipWorktree: true})
+	if got := binary.BigEndian.Uint32(index.Encode()[4:8]); got != 3 {
+		t.Errorf("index with extended flags encoded as version %d, want 3", got)
+	}
+}
+
+// TREE、REUCと知らない拡張が読み書きで保たれ、エントリを変えたディレクトリのキャッシュだけが古くなるか
+func TestIndex_Extensions(t *testing.T) {
+	dir := newTestRepository(t)
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob := writeTestObject(t, dir, object.BlobObject, []byte("hello\n"))
+	other := writeTestObject(t, dir, object.BlobObject, []byte("other\n"))
+
+	index := NewIndex()
+	index.Add(&IndexEntry{Mode: object.ModeBlob, Hash: blob, Path: "a.txt"})
+	index.Add(&IndexEntry{Mode: object.ModeExecutable, Hash: blob, Path: "dir/b.txt"})
+	index.Add(&IndexEntry{Mode: object.ModeBlob, Hash: blob, Path: "dir/sub/c.txt"})
+	index.AddUnmerged("x.txt",
+		&IndexEntry{Mode: object.ModeBlob, Hash: blob, Stage: 1},
+		&IndexEntry{Mode: object.ModeBlob, Hash: other, Stage: 3},
+	)
+	index.Add(&IndexEntry{Mode: object.ModeBlob, Hash: other, Path: "x.txt"})
+	index.Extensions = append(index.Extensions, IndexExtension{Signature: "ZZZZ", Data: []byte("kept")})
+	tree, err := client.WriteTree(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := ParseIndex(index.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Cache == nil || parsed.Cache.EntryCount != 4 || !bytes.Equal(parsed.Cache.Hash, tree) {
+		t.Fatalf("Cache = %+v, want 4 entries and %s", parsed.Cache, tree)
+	}
+	sub := parsed.Cache.subtree("dir")
+	if sub == nil || sub.EntryCount != 2 || sub.subtree("sub") == nil {
+		t.Fatalf("Cache for dir = %+v", sub)
+	}
+	if len(parsed.ResolveUndo) != 1 {
+		t.Fatalf("ResolveUndo = %+v, want x.txt", parsed.ResolveUndo)
+	}
+	undo := parsed.ResolveUndo[0]
+	if undo.Path != "x.txt" || undo.Modes != [3]object.FileMode{object.ModeBlob, 0, object.ModeBlob} || !bytes.Equal(undo.Hashes[2], other) {
+		t.Errorf("ResolveUndo[0] = %+v", undo)
+	}
+	if len(parsed.Extensions) != 1 || parsed.Extensions[0].Signature != "ZZZZ" || string(parsed.Extensions[0].Data) != "kept" {
+		t.Errorf("Extensions = %+v", parsed.Extensions)
+	}
+
+	// 変えたファイルを含むディレクトリだけが古くなり、ツリーを書き直すとgitと同じハッシュに戻る.
+	parsed.Add(&IndexEntry{Mode: object.ModeBlob, Hash: other, Path: "dir/sub/c.txt"})
+	if parsed.Cache.Valid() || sub.Valid() || sub.subtree("sub").Valid() {
+		t.Errorf("cache for the changed directories is still valid")
+	}
+	parsed.Add(&IndexEntry{Mode: object.ModeBlob, Hash: blob, Path: "dir/sub/c.txt"})
+	if got, err := client.WriteTree(parsed); err != nil || !bytes.Equal(got, tree) {
+		t.Errorf("WriteTree() = %s, %v, want %s", got, err, tree)
+	}
+
+	index.Extensions = []IndexExtension{{Signature: "link", Data: []byte("x")}}
+	if _, err := ParseIndex(index.Encode()); !errors.Is(err, ErrInvalidIndex) {
+		t.Errorf("ParseIndex() error = %v, want ErrInvalidIndex for an unknown mandatory extension", err)
+	}
+}
+
+// 入れ子のディレクトリを含むインデックスからgitと同じツリーが作られるか
+func TestClient_WriteTree_Nested(t *testing.T) {
+	dir := newTestRepository(t)
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob := writeTestObject(t, dir, object.BlobObject, []byte("hello\n"))
+
+	index := NewIndex()
+	index.Add(&IndexEntry{Mode: object.ModeBlob, Hash: blob, Path: "a.txt"})
+	index.Add(&IndexEntry{Mode: object.ModeExecutable, Hash: blob, Path: "dir/b.txt"})
+	index.Add(&IndexEntry{Mode: object.ModeBlob, Hash: blob, Path: "dir/sub/c.txt"})
+	hash, err := client.WriteTree(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// git write-treeで作った同じ内容のツリーのハッシュ.
+	if want := "e9553c08aa7beea1250910a985dc5642f44a3b81"; hash.String() != want {
+		t.Errorf("WriteTree() = %s, want %s", hash, want)
+	}
+
+	index.Add(&IndexEntry{Mode: object.ModeBlob, Hash: blob, Path: "dir"})
+	if _, err := client.WriteTree(index); !errors.Is(err, ErrPathConflict) {
+		t.Errorf("WriteTree() error = %v, want ErrPathConflict", err)
+	}
+}
+
+// インデックスと作業ツリーの違いがStatusに現れるか
+func TestClient_Status(t *testing.T) {
+	dir := newTestRepository(t)
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.WriteSymbolicRef("HEAD", "refs/heads/main"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", "b.txt", "new/c.txt"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	index := NewIndex()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		info, err := os.Lstat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		hash, err := client.WriteWorktreeBlob(name, info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		index.Add(NewIndexEntry(name, info, hash, nil, true, true))
+	}
+	if err := client.WriteIndex(index); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := client.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var staged, unstaged []string
+	for _, change := range status.Staged {
+		staged = append(staged, change.Type.String()+" "+change.Path)
+	}
+	for _, change := range status.Unstaged {
+		unstaged = append(unstaged, change.Type.String()+" "+change.Path)
+	}
+	if fmt.Sprint(staged) != "[A a.txt A b.txt]" {
+		t.Errorf("Staged = %v", staged)
+	}
+	if fmt.Sprint(unstaged) != "[M a.txt D b.txt]" {
+		t.Errorf("Unstaged = %v", unstaged)
+	}
+	if fmt.Sprint(status.Untracked) != "[new/]" {
+		t.Errorf("Untracked = %v", status.Untracked)
+	}
+}
+
+// 無視ファイルの規則に合うファイルがStatusのUntrackedに現れないか
+func TestClient_StatusIgnored(t *testing.T) {
+	old, ok := os.LookupEnv("XDG_CONFIG_HOME")
+	os.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	defer func() {
+		if ok {
+			os.Setenv("XDG_CONFIG_HOME", old)
+		} else {
+			os.Unsetenv("XDG_CONFIG_HOME")
+		}
+	}()
+
+	dir := newTestRepository(t)
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.WriteSymbolicRef("HEAD", "refs/heads/main"); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		".gitignore":        "*.log\nbuild/\n",
+		"a.txt":             "a",
+		"a.log":             "a",
+		"build/out":         "out",
+		"logs/x.log":        "x",
+		"sub/.fsegitignore": "*.tmp\n!keep.log\n",
+		"sub/b.tmp":         "b",
+		"sub/keep.log":      "keep",
+		"excluded/c.txt":    "c",
+		".git/info/exclude": "/excluded\n",
+	}
+	for name, data := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	status, err := client.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(status.Untracked) != "[.gitignore a.txt sub/]" {
+		t.Errorf("Untracked = %v", status.Untracked)
+	}
+
+	m, err := client.IgnoreMatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{"a.log": true, "sub/b.tmp": true, "sub/keep.log": false, "b.tmp": false, "excluded": true} {
+		if got := m.Ignored(name, name == "excluded"); got != want {
+			t.Errorf("Ignored(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+// チェックアウトで作業ツリーとインデックスが対象のコミットに合わせて書き換わるか
+func TestClient_CheckoutCommit(t *testing.T) {
+	dir := newTestRepository(t)
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobA := writeTestObject(t, dir, object.BlobObject, []byte("a\n"))
+	blobB := writeTestObject(t, dir, object.BlobObject, []byte("b\n"))
+	commit := func(entries ...object.TreeEntry) sha.SHA1 {
+		tree := writeTestObject(t, dir, object.TreeObject, treeData(entries...))
+		return writeTestObject(t, dir, object.CommitObject, []byte(fmt.Sprintf(
+			"tree %s\nauthor fsegit <fsegit@example.com> 1672531200 +0900\ncommitter fsegit <fsegit@example.com> 1672531200 +0900\n\ncommit\n", tree)))
+	}
+	sub := writeTestObject(t, dir, object.TreeObject, treeData(object.TreeEntry{Mode: object.ModeExecutable, Name: "b.sh", Hash: blobB}))
+	first := commit(object.TreeEntry{Mode: object.ModeBlob, Name: "a.txt", Hash: blobA})
+	second := commit(
+		object.TreeEntry{Mode: object.ModeBlob, Name: "a.txt", Hash: blobB},
+		object.TreeEntry{Mode: object.ModeTree, Name: "dir", Hash: sub},
+	)
+
+	if err := client.WriteSymbolicRef("HEAD", "refs/heads/main"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CheckoutCommit(first, CheckoutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.DetachHead(first, "checkout: moving to first"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CheckoutCommit(second, CheckoutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.DetachHead(second, "checkout: moving to second"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "a.txt"))
+	if err != nil || string(data) != "b\n" {
+		t.Errorf("a.txt = %q, %v", data, err)
+	}
+	if status, err := client.Status(); err != nil || !status.Clean() {
+		t.Errorf("Status() = %+v, %v, want clean", status, err)
+	}
+
+	// 内容が変わるファイルの手元の変更は上書きしない.
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("local\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CheckoutCommit(first, CheckoutOptions{}); !errors.Is(err, ErrWouldOverwrite) {
+		t.Fatalf("CheckoutCommit() error = %v, want ErrWouldOverwrite", err)
+	}
+	if err := client.CheckoutCommit(first, CheckoutOptions{Force: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "dir")); !os.IsNotExist(err) {
+		t.Errorf("dir should be removed, Stat() error = %v", err)
+	}
+	index, err := client.ReadIndex()
 	if err != nil {
 		t.Fatal(err)
 	}
-	t.Log(string(obj.Type))
+	if len(index.Entries) != 1 || !bytes.Equal(index.Entries[0].Hash, blobA) {
+		t.Errorf("index entries = %+v", index.Entries)
+	}
+}
+
+// 参照の名前の検査がgit check-ref-formatと同じ結果になるか
+func TestCheckRefName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"refs/heads/main", true},
+		{"refs/heads/feature/x-1", true},
+		{"refs/heads/a..b", false},
+		{"refs/heads/.hidden", false},
+		{"refs/heads/x.lock", false},
+		{"refs/heads/a b", false},
+		{"refs/heads/a@{1}", false},
+		{"refs/heads//x", false},
+		{"refs/heads/x/", false},
+		{"refs/heads/x.", false},
+		{"refs/heads/a:b", false},
+	}
+	for _, tt := range tests {
+		if err := CheckRefName(tt.name); (err == nil) != tt.valid {
+			t.Errorf("CheckRefName(%q) = %v, want valid = %v", tt.name, err, tt.valid)
+		}
+	}
+}
+
+// 不正な名前の参照やreflogは、管理ディレクトリの外に書き込まずにエラーになるか
+func TestClient_WriteRefInvalidName(t *testing.T) {
+	client, _, err := Init(t.TempDir(), InitOptions{InitialBranch: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := sha.SHA1(bytes.Repeat([]byte{0x11}, 20))
+	config, err := ioutil.ReadFile(filepath.Join(client.GitDir(), "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"refs/tags/../../config", "refs/heads/../../../outside", "../HEAD"} {
+		if err := client.WriteRef(name, hash); !errors.Is(err, ErrInvalidRefName) {
+			t.Errorf("WriteRef(%q) error = %v, want %v", name, err, ErrInvalidRefName)
+		}
+		if err := client.UpdateRef(name, hash, "update"); !errors.Is(err, ErrInvalidRefName) {
+			t.Errorf("UpdateRef(%q) error = %v, want %v", name, err, ErrInvalidRefName)
+		}
+		if err := client.AppendReflog(name, nil, hash, "update"); !errors.Is(err, ErrInvalidRefName) {
+			t.Errorf("AppendReflog(%q) error = %v, want %v", name, err, ErrInvalidRefName)
+		}
+		if err := client.WriteSymbolicRef(name, "refs/heads/main"); !errors.Is(err, ErrInvalidRefName) {
+			t.Errorf("WriteSymbolicRef(%q) error = %v, want %v", name, err, ErrInvalidRefName)
+		}
+	}
+	if err := client.WriteSymbolicRef("HEAD", "refs/heads/../../config"); !errors.Is(err, ErrInvalidRefName) {
+		t.Errorf("WriteSymbolicRef() with a bad target error = %v, want %v", err, ErrInvalidRefName)
+	}
+	if got, err := ioutil.ReadFile(filepath.Join(client.GitDir(), "config")); err != nil || !bytes.Equal(got, config) {
+		t.Errorf("config was overwritten: %q, %v", got, err)
+	}
+	if _, err := os.Stat(filepath.Join(client.GitDir(), "..", "..", "outside")); !os.IsNotExist(err) {
+		t.Errorf("a file was written outside the repository: %v", err)
+	}
+}
+
+// refspecがワイルドカードを含む参照の名前を対応する名前に変換するか
+func TestRefSpec_Match(t *testing.T) {
+	spec, err := ParseRefSpec("+refs/heads/*:refs/remotes/origin/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !spec.Force || spec.String() != "+refs/heads/*:refs/remotes/origin/*" {
+		t.Errorf("ParseRefSpec() = %+v", spec)
+	}
+	tests := []struct {
+		name string
+		dst  string
+		ok   bool
+	}{
+		{"refs/heads/main", "refs/remotes/origin/main", true},
+		{"refs/heads/feature/x", "refs/remotes/origin/feature/x", true},
+		{"refs/tags/v1", "", false},
+	}
+	for _, tt := range tests {
+		if dst, ok := spec.Match(tt.name); dst != tt.dst || ok != tt.ok {
+			t.Errorf("Match(%q) = %q, %t, want %q, %t", tt.name, dst, ok, tt.dst, tt.ok)
+		}
+	}
+
+	exact, err := ParseRefSpec("refs/heads/main:refs/heads/upstream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dst, ok := exact.Match("refs/heads/main"); !ok || dst != "refs/heads/upstream" {
+		t.Errorf("Match() for an exact refspec = %q, %t", dst, ok)
+	}
+	for _, bad := range []string{"", "refs/heads/*:refs/remotes/x", "refs/*/*:refs/*/*"} {
+		if _, err := ParseRefSpec(bad); err == nil {
+			t.Errorf("ParseRefSpec(%q) succeeded", bad)
+		}
+	}
+}
+
+// pushで送るパックに、リモートにある履歴のオブジェクトが含まれず、thin packでは変更したファイルがデルタになるか
+func TestClient_WritePushPack(t *testing.T) {
+	dir := newTestRepository(t)
+	var content bytes.Buffer
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&content, "line %d\n", i)
+	}
+	unchanged := writeTestObject(t, dir, object.BlobObject, []byte("unchanged\n"))
+	oldBlob := writeTestObject(t, dir, object.BlobObject, content.Bytes())
+	content.WriteString("appended\n")
+	newBlob := writeTestObject(t, dir, object.BlobObject, content.Bytes())
+	commit := func(tree sha.SHA1, parents ...sha.SHA1) sha.SHA1 {
+		data := fmt.Sprintf("tree %s\n", tree)
+		for _, parent := range parents {
+			data += fmt.Sprintf("parent %s\n", parent)
+		}
+		data += "author fsegit <fsegit@example.com> 1672531200 +0900\ncommitter fsegit <fsegit@example.com> 1672531200 +0900\n\nmessage\n"
+		return writeTestObject(t, dir, object.CommitObject, []byte(data))
+	}
+	subTree := writeTestObject(t, dir, object.TreeObject, treeData(object.TreeEntry{Mode: object.ModeBlob, Name: "keep.txt", Hash: unchanged}))
+	oldTree := writeTestObject(t, dir, object.TreeObject, treeData(
+		object.TreeEntry{Mode: object.ModeBlob, Name: "file.txt", Hash: oldBlob},
+		object.TreeEntry{Mode: object.ModeTree, Name: "sub", Hash: subTree},
+	))
+	newTree := writeTestObject(t, dir, object.TreeObject, treeData(
+		object.TreeEntry{Mode: object.ModeBlob, Name: "file.txt", Hash: newBlob},
+		object.TreeEntry{Mode: object.ModeTree, Name: "sub", Hash: subTree},
+	))
+	base := commit(oldTree)
+	tip := commit(newTree, base)
+
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var full, thin bytes.Buffer
+	// 新しいコミット、ルートのツリー、変更したブロブの3つだけを送る.
+	if n, err := client.WritePushPack(&full, []sha.SHA1{tip}, []sha.SHA1{base}, PackOptions{}); err != nil || n != 3 {
+		t.Fatalf("WritePushPack() = %d, %v, want 3", n, err)
+	}
+	if n, err := client.WritePushPack(&thin, []sha.SHA1{tip}, []sha.SHA1{base}, PackOptions{Thin: true}); err != nil || n != 3 {
+		t.Fatalf("WritePushPack(thin) = %d, %v, want 3", n, err)
+	}
+	if thin.Len() >= full.Len() {
+		t.Errorf("thin pack is %d bytes, want less than %d", thin.Len(), full.Len())
+	}
+}
+
+// リモートの名前を変えると、追跡ブランチとrefspec、上流の設定が付いてくるか
+func TestClient_RenameRemote(t *testing.T) {
+	dir := newTestRepository(t)
+	blob := writeTestObject(t, dir, object.BlobObject, []byte("hello\n"))
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.AddRemote("origin", "https://example.com/a.git"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.AddRemote("origin", "https://example.com/b.git"); !errors.Is(err, ErrRemoteExists) {
+		t.Errorf("AddRemote() for an existing remote = %v, want ErrRemoteExists", err)
+	}
+	if err := client.SetUpstream("main", "origin", "refs/heads/main"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.WriteRef("refs/remotes/origin/main", blob); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.WriteSymbolicRef("refs/remotes/origin/HEAD", "refs/remotes/origin/main"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.RenameRemote("origin", "upstream"); err != nil {
+		t.Fatal(err)
+	}
+	remote, err := client.ReadRemote("upstream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remote.URL != "https://example.com/a.git" || len(remote.Fetch) != 1 || remote.Fetch[0] != "+refs/heads/*:refs/remotes/upstream/*" {
+		t.Errorf("remote = %+v", remote)
+	}
+	if _, err := client.ReadRemote("origin"); !errors.Is(err, ErrRemoteNotFound) {
+		t.Errorf("ReadRemote(origin) = %v, want ErrRemoteNotFound", err)
+	}
+	if target, err := client.ReadSymbolicRef("refs/remotes/upstream/HEAD"); err != nil || target != "refs/remotes/upstream/main" {
+		t.Errorf("refs/remotes/upstream/HEAD = %q, %v", target, err)
+	}
+	cfg, err := client.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := cfg.Get("branch.main.remote"); got != "upstream" {
+		t.Errorf("branch.main.remote = %q, want upstream", got)
+	}
+
+	if err := client.RemoveRemote("upstream"); err != nil {
+		t.Fatal(err)
+	}
+	if refs, err := client.ListRefs("refs/remotes/"); err != nil || len(refs) != 0 {
+		t.Errorf("ListRefs() after RemoveRemote = %v, %v", refs, err)
+	}
+	if cfg, err = client.Config(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cfg.Get("branch.main.merge"); ok {
+		t.Error("branch.main.merge remains after RemoveRemote")
+	}
+}
+
+// gitの内部形式とRFC 2822、ISO 8601の日時を読めるか
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		in   string
+		unix int64
+		zone string
+	}{
+		{"1700000000 +0900", 1700000000, "+0900"},
+		{"@1700000000 -0130", 1700000000, "-0130"},
+		{"Wed, 15 Nov 2023 07:13:20 +0900", 1700000000, "+0900"},
+		{"2023-11-14T22:13:20Z", 1700000000, "+0000"},
+		{"2023-11-15 07:13:20 +0900", 1700000000, "+0900"},
+	}
+	for _, tt := range tests {
+		got, err := ParseDate(tt.in)
+		if err != nil {
+			t.Errorf("ParseDate(%q): %v", tt.in, err)
+			continue
+		}
+		if got.Unix() != tt.unix || got.Format("-0700") != tt.zone {
+			t.Errorf("ParseDate(%q) = %d %s, want %d %s", tt.in, got.Unix(), got.Format("-0700"), tt.unix, tt.zone)
+		}
+	}
+	if _, err := ParseDate("yesterday"); !errors.Is(err, ErrInvalidDate) {
+		t.Errorf("ParseDate(yesterday) = %v, want ErrInvalidDate", err)
+	}
+}
+
+// 署名の名前とメールアドレスを環境変数、author.name、user.nameの順に探し、見つからなければErrNoIdentityを返すか
+func TestClient_Identity(t *testing.T) {
+	env := map[string]string{
+		"GIT_CONFIG_GLOBAL":   filepath.Join(t.TempDir(), "global"),
+		"GIT_CONFIG_NOSYSTEM": "1",
+	}
+	for _, name := range []string{"GIT_AUTHOR_NAME", "GIT_AUTHOR_EMAIL", "GIT_AUTHOR_DATE", "GIT_COMMITTER_NAME", "GIT_COMMITTER_EMAIL", "GIT_COMMITTER_DATE", "EMAIL"} {
+		env[name] = ""
+	}
+	for name, value := range env {
+		old, ok := os.LookupEnv(name)
+		if value == "" {
+			os.Unsetenv(name)
+		} else {
+			os.Setenv(name, value)
+		}
+		defer func(name, old string, ok bool) {
+			if ok {
+				os.Setenv(name, old)
+			} else {
+				os.Unsetenv(name)
+			}
+		}(name, old, ok)
+	}
+
+	client, err := NewClient(newTestRepository(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Identity(Author); !errors.Is(err, ErrNoIdentity) {
+		t.Errorf("Identity() without config = %v, want ErrNoIdentity", err)
+	}
+
+	if err := ioutil.WriteFile(client.ConfigPath(), []byte("[user]\n\tname = User\n\temail = user@example.com\n[author]\n\tname = Author\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("GIT_COMMITTER_EMAIL", "env@example.com")
+	os.Setenv("GIT_AUTHOR_DATE", "1700000000 +0900")
+	author, err := client.Identity(Author)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if author.Encode() != "Author <user@example.com> 1700000000 +0900" {
+		t.Errorf("author = %q", author.Encode())
+	}
+	committer, err := client.Identity(Committer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if committer.Name != "User" || committer.Email != "env@example.com" {
+		t.Errorf("committer = %+v", committer)
+	}
+}
+
+// 軽量タグと注釈付きタグを作り、注釈付きタグからコミットを辿れるか
+func TestClient_Tags(t *testing.T) {
+	dir := newTestRepository(t)
+	tree := writeTestObject(t, dir, object.TreeObject, nil)
+	commit := writeTestObject(t, dir, object.CommitObject, []byte(fmt.Sprintf("tree %s\nauthor fsegit <fsegit@example.com> 1672531200 +0900\ncommitter fsegit <fsegit@example.com> 1672531200 +0900\n\nmessage\n", tree)))
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.CreateTag("v1", commit, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CreateTag("v1", commit, false); !errors.Is(err, ErrTagExists) {
+		t.Errorf("CreateTag() for an existing tag = %v, want ErrTagExists", err)
+	}
+	if _, err := client.CreateTag("-bad", commit, false); !errors.Is(err, ErrInvalidRefName) {
+		t.Errorf("CreateTag(-bad) = %v, want ErrInvalidRefName", err)
+	}
+
+	tagger := object.Signature{Name: "fsegit", Email: "fsegit@example.com", When: time.Unix(1672531200, 0)}
+	tagHash, old, err := client.CreateAnnotatedTag("v1", commit, tagger, "release\n", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(old, commit) {
+		t.Errorf("old = %s, want %s", old, commit)
+	}
+	obj, err := client.GetObject(tagHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag, err := object.NewTag(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag.Name != "v1" || tag.ObjectType != object.CommitObject || tag.Message != "release\n" || tag.Tagger.Encode() != tagger.Encode() {
+		t.Errorf("tag = %+v", tag)
+	}
+	if peeled, err := client.PeelToCommit(tagHash); err != nil || !bytes.Equal(peeled, commit) {
+		t.Errorf("PeelToCommit() = %s, %v, want %s", peeled, err, commit)
+	}
+
+	if hash, err := client.DeleteTag("v1"); err != nil || !bytes.Equal(hash, tagHash) {
+		t.Errorf("DeleteTag() = %s, %v", hash, err)
+	}
+	if tags, err := client.ListTags(); err != nil || len(tags) != 0 {
+		t.Errorf("ListTags() = %v, %v", tags, err)
+	}
+}
+
+// 最も近いタグとそこからの距離を求め、軽量タグはTagsのときだけ使うか
+func TestClient_Describe(t *testing.T) {
+	dir := newTestRepository(t)
+	tree := writeTestObject(t, dir, object.TreeObject, nil)
+	date := int64(1672531200)
+	commit := func(message string, parents ...sha.SHA1) sha.SHA1 {
+		date++
+		data := fmt.Sprintf("tree %s\n", tree)
+		for _, parent := range parents {
+			data += fmt.Sprintf("parent %s\n", parent)
+		}
+		data += fmt.Sprintf("author fsegit <fsegit@example.com> %d +0900\ncommitter fsegit <fsegit@example.com> %d +0900\n\n%s\n", date, date, message)
+		return writeTestObject(t, dir, object.CommitObject, []byte(data))
+	}
+	//   root - a1 - a2 - m(a2, b2) - top
+	//       \             /
+	//        b1 -------- b2
+	root := commit("root")
+	a1 := commit("a1", root)
+	b1 := commit("b1", root)
+	a2 := commit("a2", a1)
+	b2 := commit("b2", b1)
+	m := commit("m", a2, b2)
+	top := commit("top", m)
+
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tagger := object.Signature{Name: "fsegit", Email: "fsegit@example.com", When: time.Unix(1672531200, 0)}
+	if _, err := client.CreateTag("light", b2, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Describe(top, DescribeOptions{}); !errors.Is(err, ErrNoDescription) {
+		t.Errorf("Describe() without annotated tags = %v, want ErrNoDescription", err)
+	}
+	if _, _, err := client.CreateAnnotatedTag("v1", root, tagger, "v1\n", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := client.CreateAnnotatedTag("v2", b1, tagger, "v2\n", false); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		hash sha.SHA1
+		opts DescribeOptions
+		want Description
+	}{
+		{"tagged", b1, DescribeOptions{}, Description{Tag: "v2", Commit: b1}},
+		{"nearest", top, DescribeOptions{}, Description{Tag: "v2", Distance: 5, Commit: top}},
+		{"first parent side", a2, DescribeOptions{}, Description{Tag: "v1", Distance: 2, Commit: a2}},
+		{"lightweight", top, DescribeOptions{Tags: true}, Description{Tag: "light", Distance: 4, Commit: top}},
+	}
+	for _, tt := range tests {
+		got, err := client.Describe(tt.hash, tt.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got.Tag != tt.want.Tag || got.Distance != tt.want.Distance || !bytes.Equal(got.Commit, tt.want.Commit) {
+			t.Errorf("%s: Describe() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// ノートを付けるたびにrefs/notes/commitsにコミットが積まれ、gitの分けたディレクトリのノートも読めるか
+func TestClient_Notes(t *testing.T) {
+	dir := newTestRepository(t)
+	tree := writeTestObject(t, dir, object.TreeObject, nil)
+	first := writeTestObject(t, dir, object.CommitObject, []byte(fmt.Sprintf("tree %s\nauthor fsegit <fsegit@example.com> 1672531200 +0900\ncommitter fsegit <fsegit@example.com> 1672531200 +0900\n\nfirst\n", tree)))
+	second := writeTestObject(t, dir, object.CommitObject, []byte(fmt.Sprintf("tree %s\nparent %s\nauthor fsegit <fsegit@example.com> 1672531201 +0900\ncommitter fsegit <fsegit@example.com> 1672531201 +0900\n\nsecond\n", tree, first)))
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := object.Signature{Name: "fsegit", Email: "fsegit@example.com", When: time.Unix(1672531200, 0)}
+
+	if notes, err := client.ListNotes(); err != nil || len(notes) != 0 {
+		t.Errorf("ListNotes() without notes = %v, %v", notes, err)
+	}
+	if _, err := client.ReadNote(first); !errors.Is(err, ErrNoNote) {
+		t.Errorf("ReadNote() without notes = %v, want ErrNoNote", err)
+	}
+	if err := client.AddNote(first, "one\n", sig, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.AddNote(second, "two\n", sig, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.AddNote(first, "again\n", sig, false); !errors.Is(err, ErrNoteExists) {
+		t.Errorf("AddNote() for a noted object = %v, want ErrNoteExists", err)
+	}
+	if err := client.AddNote(first, "replaced\n", sig, true); err != nil {
+		t.Fatal(err)
+	}
+	if note, err := client.ReadNote(first); err != nil || string(note) != "replaced\n" {
+		t.Errorf("ReadNote(first) = %q, %v, want %q", note, err, "replaced\n")
+	}
+	notes, err := client.ListNotes()
+	if err != nil || len(notes) != 2 {
+		t.Fatalf("ListNotes() = %v, %v", notes, err)
+	}
+	if bytes.Compare(notes[0].Object, notes[1].Object) >= 0 {
+		t.Errorf("ListNotes() = %v, want sorted by object", notes)
+	}
+	// 3回ノートを付けたので、refs/notes/commitsのコミットは3つ連なる.
+	head, err := client.ResolveRef(NotesRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := client.RevListCount(RevListOptions{Include: []sha.SHA1{head}}); err != nil || n != 3 {
+		t.Errorf("commits on %s = %d, %v, want 3", NotesRef, n, err)
+	}
+
+	// gitはノートが多いと"ab/cdef..."のようにハッシュの先頭2文字のディレクトリに分ける.
+	blob := writeTestObject(t, dir, object.BlobObject, []byte("fanout\n"))
+	name := first.String()
+	sub := object.Tree{Entries: []object.TreeEntry{{Mode: object.ModeBlob, Name: name[2:], Hash: blob}}}
+	subHash := writeTestObject(t, dir, object.TreeObject, sub.Encode())
+	top := object.Tree{Entries: []object.TreeEntry{{Mode: object.ModeTree, Name: name[:2], Hash: subHash}}}
+	topHash := writeTestObject(t, dir, object.TreeObject, top.Encode())
+	notesCommit := writeTestObject(t, dir, object.CommitObject, []byte(fmt.Sprintf("tree %s\nauthor fsegit <fsegit@example.com> 1672531200 +0900\ncommitter fsegit <fsegit@example.com> 1672531200 +0900\n\nnotes\n", topHash)))
+	if err := client.WriteRef(NotesRef, notesCommit); err != nil {
+		t.Fatal(err)
+	}
+	if note, err := client.ReadNote(first); err != nil || string(note) != "fanout\n" {
+		t.Errorf("ReadNote() from a fanout tree = %q, %v, want %q", note, err, "fanout\n")
+	}
+}
+
+// 共通の祖先を求め、交差したマージの履歴では最良の候補を全て返すか
+func TestClient_MergeBases(t *testing.T) {
+	dir := newTestRepository(t)
+	tree := writeTestObject(t, dir, object.TreeObject, nil)
+	commit := func(message string, parents ...sha.SHA1) sha.SHA1 {
+		data := fmt.Sprintf("tree %s\n", tree)
+		for _, parent := range parents {
+			data += fmt.Sprintf("parent %s\n", parent)
+		}
+		data += "author fsegit <fsegit@example.com> 1672531200 +0900\ncommitter fsegit <fsegit@example.com> 1672531200 +0900\n\n" + message + "\n"
+		return writeTestObject(t, dir, object.CommitObject, []byte(data))
+	}
+	//   root - a1 - a2(a1, b1) - a3
+	//       \     X
+	//        b1 - b2(b1, a1)
+	root := commit("root")
+	a1 := commit("a1", root)
+	b1 := commit("b1", root)
+	a2 := commit("a2", a1, b1)
+	b2 := commit("b2", b1, a1)
+	a3 := commit("a3", a2)
+	other := commit("other root")
+
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		a, b sha.SHA1
+		want []sha.SHA1
+	}{
+		{"fork", a1, b1, []sha.SHA1{root}},
+		{"ancestor", a3, a1, []sha.SHA1{a1}},
+		{"same", a2, a2, []sha.SHA1{a2}},
+		{"criss-cross", a3, b2, []sha.SHA1{a1, b1}},
+		{"unrelated", a3, other, nil},
+	}
+	for _, tt := range tests {
+		got, err := client.MergeBases(tt.a, tt.b)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: MergeBases() = %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		// 世代数が同じ候補の順序は決めていないので、集合として比べる.
+		for _, want := range tt.want {
+			found := false
+			for _, hash := range got {
+				found = found || bytes.Equal(hash, want)
+			}
+			if !found {
+				t.Errorf("%s: MergeBases() = %v, want %v", tt.name, got, tt.want)
+			}
+		}
+	}
+	if _, err := client.MergeBase(a3, other); !errors.Is(err, ErrNoMergeBase) {
+		t.Errorf("MergeBase() for unrelated histories = %v, want ErrNoMergeBase", err)
+	}
+}
+
+func TestClient_MergeIntoWorktree(t *testing.T) {
+	dir := newTestRepository(t)
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob := func(data string) object.TreeEntry {
+		return object.TreeEntry{Mode: object.ModeBlob, Hash: writeTestObject(t, dir, object.BlobObject, []byte(data))}
+	}
+	file := func(name string, entry object.TreeEntry) object.TreeEntry {
+		entry.Name = name
+		return entry
+	}
+	commit := func(parent sha.SHA1, entries ...object.TreeEntry) sha.SHA1 {
+		tree := writeTestObject(t, dir, object.TreeObject, treeData(entries...))
+		parentLine := ""
+		if parent != nil {
+			parentLine = fmt.Sprintf("parent %s\n", parent)
+		}
+		return writeTestObject(t, dir, object.CommitObject, []byte(fmt.Sprintf(
+			"tree %s\n%sauthor fsegit <fsegit@example.com> 1672531200 +0900\ncommitter fsegit <fsegit@example.com> 1672531200 +0900\n\ncommit\n", tree, parentLine)))
+	}
+	base := commit(nil,
+		file("a.txt", blob("1\n2\n3\n")),
+		file("b.txt", blob("b\n")),
+		file("c.txt", blob("c\n")),
+	)
+	ours := commit(base,
+		file("a.txt", blob("one\n2\n3\n")),
+		file("b.txt", blob("ours\n")),
+		file("c.txt", blob("c\n")),
+	)
+	theirs := commit(base,
+		file("a.txt", blob("1\n2\nthree\n")),
+		file("b.txt", blob("theirs\n")),
+		file("new.txt", blob("new\n")),
+	)
+
+	if err := client.WriteSymbolicRef("HEAD", "refs/heads/main"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CheckoutCommit(ours, CheckoutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.DetachHead(ours, "checkout: moving to ours"); err != nil {
+		t.Fatal(err)
+	}
+	conflicts, err := client.MergeIntoWorktree(base, theirs, diff.MergeLabels{Ours: "HEAD", Theirs: "theirs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conflicts) != 1 || conflicts[0].Path != "b.txt" || conflicts[0].Kind != "content" {
+		t.Errorf("MergeIntoWorktree() conflicts = %+v, want b.txt", conflicts)
+	}
+	for name, want := range map[string]string{
+		"a.txt":   "one\n2\nthree\n",
+		"b.txt":   "<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> theirs\n",
+		"new.txt": "new\n",
+	} {
+		if data, err := ioutil.ReadFile(filepath.Join(dir, name)); err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v, want %q", name, data, err, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "c.txt")); !os.IsNotExist(err) {
+		t.Errorf("c.txt should be removed, Stat() error = %v", err)
+	}
+	index, err := client.ReadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unmerged := index.Unmerged(); len(unmerged) != 1 || unmerged[0] != "b.txt" {
+		t.Errorf("Unmerged() = %v, want [b.txt]", unmerged)
+	}
+
+	commits, err := client.RebaseCommits(ours, theirs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 1 || !bytes.Equal(commits[0].Hash, theirs) {
+		t.Errorf("RebaseCommits() = %v, want only %s", commits, theirs)
+	}
+}
+
+func TestClient_TopoSortHistory(t *testing.T) {
+	dir := newTestRepository(t)
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := writeTestObject(t, dir, object.TreeObject, nil)
+	date := 1672531200
+	commit := func(subject string, parents ...sha.SHA1) sha.SHA1 {
+		date++
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "tree %s\n", tree)
+		for _, parent := range parents {
+			fmt.Fprintf(&sb, "parent %s\n", parent)
+		}
+		fmt.Fprintf(&sb, "author fsegit <fsegit@example.com> %d +0900\ncommitter fsegit <fsegit@example.com> %d +0900\n\n%s\n", date, date, subject)
+		return writeTestObject(t, dir, object.CommitObject, []byte(sb.String()))
+	}
+	// A - B ------- M
+	//  \           /
+	//   C - D
+	a := commit("A")
+	c := commit("C", a)
+	b := commit("B", a)
+	d := commit("D", c)
+	m := commit("M", b, d)
+
+	commits, err := client.TopoSortHistory([]sha.SHA1{m}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, commit := range commits {
+		got = append(got, commit.Subject())
+	}
+	// BはDより古いので、Mの後はDとCの系統を先にまとめて並べる.
+	if want := "M D C B A"; strings.Join(got, " ") != want {
+		t.Errorf("TopoSortHistory() = %v, want %s", got, want)
+	}
+}
+
+func TestClient_TopoSortHistory_Filter(t *testing.T) {
+	dir := newTestRepository(t)
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := func(src, other string) sha.SHA1 {
+		sub := writeTestObject(t, dir, object.TreeObject, treeData(object.TreeEntry{
+			Mode: object.ModeBlob, Name: "main.go", Hash: writeTestObject(t, dir, object.BlobObject, []byte(src)),
+		}))
+		return writeTestObject(t, dir, object.TreeObject, treeData(
+			object.TreeEntry{Mode: object.ModeBlob, Name: "README", Hash: writeTestObject(t, dir, object.BlobObject, []byte(other))},
+			object.TreeEntry{Mode: object.ModeTree, Name: "src", Hash: sub},
+		))
+	}
+	date := 1672531200
+	commit := func(subject string, tree sha.SHA1, parents ...sha.SHA1) sha.SHA1 {
+		date++
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "tree %s\n", tree)
+		for _, parent := range parents {
+			fmt.Fprintf(&sb, "parent %s\n", parent)
+		}
+		fmt.Fprintf(&sb, "author fsegit <fsegit@example.com> %d +0900\ncommitter fsegit <fsegit@example.com> %d +0900\n\n%s\n", date, date, subject)
+		return writeTestObject(t, dir, object.CommitObject, []byte(sb.String()))
+	}
+	// srcを変えたのはAとCだけ. Mはsrcについて親のCと同じなので表示しない.
+	a := commit("A", tree("1", "r"))
+	b := commit("B", tree("1", "r2"), a)
+	c := commit("C", tree("2", "r"), a)
+	m := commit("M", tree("2", "r2"), c, b)
+
+	commits, err := client.TopoSortHistory([]sha.SHA1{m}, prefixFilter("src"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, commit := range commits {
+		got = append(got, commit.Subject())
+	}
+	if want := "C A"; strings.Join(got, " ") != want {
+		t.Fatalf("TopoSortHistory() = %v, want %s", got, want)
+	}
+	if len(commits[0].Parents) != 1 || !bytes.Equal(commits[0].Parents[0], a) {
+		t.Errorf("parents of C = %v, want [%s]", commits[0].Parents, a)
+	}
+}
+
+// 名前を変えたコミットより前は、変更前のパスの履歴を辿るか
+func TestClient_FollowHistoryContext(t *testing.T) {
+	dir := newTestRepository(t)
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	tree := func(name, content string) sha.SHA1 {
+		return writeTestObject(t, dir, object.TreeObject, treeData(
+			object.TreeEntry{Mode: object.ModeBlob, Name: name, Hash: writeTestObject(t, dir, object.BlobObject, []byte(content))},
+		))
+	}
+	date := 1672531200
+	commit := func(subject string, tree sha.SHA1, parents ...sha.SHA1) sha.SHA1 {
+		date++
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "tree %s\n", tree)
+		for _, parent := range parents {
+			fmt.Fprintf(&sb, "parent %s\n", parent)
+		}
+		fmt.Fprintf(&sb, "author fsegit <fsegit@example.com> %d +0900\ncommitter fsegit <fsegit@example.com> %d +0900\n\n%s\n", date, date, subject)
+		return writeTestObject(t, dir, object.CommitObject, []byte(sb.String()))
+	}
+	a := commit("A", tree("a.txt", lines))
+	b := commit("B", tree("a.txt", lines+"11\n"), a)
+	c := commit("C", tree("b.txt", "one\n"+lines[2:]+"11\n"), b)
+	d := commit("D", tree("b.txt", "one\n"+lines[2:]+"11\n12\n"), c)
+
+	var got []string
+	err = client.FollowHistoryContext(context.Background(), d, "b.txt", DefaultRenameThreshold, WalkHistoryOpts{}, func(commit *object.Commit) error {
+		got = append(got, commit.Subject())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "D C B A"; strings.Join(got, " ") != want {
+		t.Errorf("FollowHistoryContext() = %v, want %s", got, want)
+	}
+}
+
+// ハッシュの先頭の部分から、ルースオブジェクトとパックの両方を探して解決できるか
+func TestClient_ResolveHash(t *testing.T) {
+	dir := newTestRepository(t)
+	// 先頭4文字が同じになる2つのブロブを探し、一方をルースに、もう一方をパックに書く.
+	seen := map[string]*object.Object{}
+	var loose, packed *object.Object
+	for i := 0; packed == nil; i++ {
+		obj := object.NewObject(object.BlobObject, []byte(fmt.Sprintf("blob %d\n", i)))
+		key := obj.Hash.String()[:4]
+		if other, ok := seen[key]; ok {
+			loose, packed = other, obj
+		}
+		seen[key] = obj
+	}
+	writeTestObject(t, dir, object.BlobObject, loose.Data)
+
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(client.packDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := client.writePack([]*object.Object{packed}); err != nil {
+		t.Fatal(err)
+	}
+
+	prefix := loose.Hash.String()[:4]
+	_, err = client.ResolveHash(prefix)
+	var ambiguous *AmbiguousHashError
+	if !errors.As(err, &ambiguous) || !errors.Is(err, ErrAmbiguousHash) || len(ambiguous.Candidates) != 2 {
+		t.Fatalf("ResolveHash(%q) error = %v, want an ambiguity between 2 objects", prefix, err)
+	}
+	for _, obj := range []*object.Object{loose, packed} {
+		short := obj.Hash.String()[:12]
+		if got, err := client.ResolveHash(strings.ToUpper(short)); err != nil || !bytes.Equal(got, obj.Hash) {
+			t.Errorf("ResolveHash(%q) = %s, %v, want %s", short, got, err, obj.Hash)
+		}
+		if got, err := client.ResolveHash(obj.Hash.String()); err != nil || !bytes.Equal(got, obj.Hash) {
+			t.Errorf("ResolveHash(full) = %s, %v, want %s", got, err, obj.Hash)
+		}
+	}
+	for _, prefix := range []string{"abc", "zzzz", strings.Repeat("0", 39)} {
+		if _, err := client.ResolveHash(prefix); !errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("ResolveHash(%q) error = %v, want ErrObjectNotFound", prefix, err)
+		}
+	}
+}
+
+// ルースとパックのオブジェクトを内容を読まずに見つけ、既にあるオブジェクトは書き込み直さないか
+func TestClient_HasObject(t *testing.T) {
+	dir := newTestRepository(t)
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loose := writeTestObject(t, dir, object.BlobObject, []byte("loose\n"))
+	packed := object.NewObject(object.BlobObject, []byte("packed\n"))
+	if ok, err := client.HasObject(packed.Hash); err != nil || ok {
+		t.Errorf("HasObject(packed) before writing the pack = %v, %v, want false", ok, err)
+	}
+	// 一度パックを読み込んだ後に追加したパックも見つける.
+	if err := os.MkdirAll(client.packDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := client.writePack([]*object.Object{packed}); err != nil {
+		t.Fatal(err)
+	}
+	for _, hash := range []sha.SHA1{loose, packed.Hash} {
+		if ok, err := client.HasObject(hash); err != nil || !ok {
+			t.Errorf("HasObject(%s) = %v, %v, want true", hash, ok, err)
+		}
+	}
+	if ok, err := client.HasObject(bytes.Repeat([]byte{0xff}, 20)); err != nil || ok {
+		t.Errorf("HasObject(missing) = %v, %v, want false", ok, err)
+	}
+
+	if _, err := client.StoreRaw(object.BlobObject, packed.Data); err != nil {
+		t.Fatal(err)
+	}
+	name := packed.Hash.String()
+	if _, err := os.Stat(filepath.Join(dir, ".git", "objects", name[:2], name[2:])); !os.IsNotExist(err) {
+		t.Errorf("packed object was written as a loose object: %v", err)
+	}
+}
+
+// 日時の順とトポロジカル順で辿る順番が変わり、ErrStopWalkでエラーにならずに打ち切れるか
+func TestClient_WalkHistoryWithOpts(t *testing.T) {
+	dir := newTestRepository(t)
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := writeTestObject(t, dir, object.TreeObject, nil)
+	date := 1672531200
+	commit := func(subject string, parents ...sha.SHA1) sha.SHA1 {
+		date++
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "tree %s\n", tree)
+		for _, parent := range parents {
+			fmt.Fprintf(&sb, "parent %s\n", parent)
+		}
+		fmt.Fprintf(&sb, "author fsegit <fsegit@example.com> %d +0900\ncommitter fsegit <fsegit@example.com> %d +0900\n\n%s\n", date, date, subject)
+		return writeTestObject(t, dir, object.CommitObject, []byte(sb.String()))
+	}
+	// A - B ------- M
+	//  \           /
+	//   C - D
+	a := commit("A")
+	c := commit("C", a)
+	b := commit("B", a)
+	d := commit("D", c)
+	m := commit("M", b, d)
+
+	walk := func(opts WalkHistoryOpts, limit int) string {
+		var got []string
+		err := client.WalkHistoryWithOpts(m, opts, func(commit *object.Commit) error {
+			got = append(got, commit.Subject())
+			if len(got) == limit {
+				return object.ErrStopWalk
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Join(got, " ")
+	}
+	if got, want := walk(WalkHistoryOpts{Order: WalkOrderDate}, -1), "M D B C A"; got != want {
+		t.Errorf("WalkHistoryWithOpts(date) = %s, want %s", got, want)
+	}
+	if got, want := walk(WalkHistoryOpts{Order: WalkOrderTopo}, -1), "M D C B A"; got != want {
+		t.Errorf("WalkHistoryWithOpts(topo) = %s, want %s", got, want)
+	}
+	if got, want := walk(WalkHistoryOpts{}, 2), "M D"; got != want {
+		t.Errorf("WalkHistoryWithOpts() stopped after 2 = %s, want %s", got, want)
+	}
+}
+
+// OpenObjectでルースとパックのオブジェクトを読め、壊れたオブジェクトは読み終えたときにエラーになるか
+func TestClient_OpenObject(t *testing.T) {
+	dir := newTestRepository(t)
+	var content bytes.Buffer
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&content, "line %d\n", i)
+	}
+	looseData := append([]byte{}, content.Bytes()...)
+	loose := writeTestObject(t, dir, object.BlobObject, looseData)
+	// 似た内容のブロブを2つパックに書いて、片方をデルタにする.
+	content.WriteString("appended\n")
+	base := object.NewObject(object.BlobObject, append([]byte{}, content.Bytes()...))
+	content.WriteString("appended again\n")
+	delta := object.NewObject(object.BlobObject, append([]byte{}, content.Bytes()...))
+
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(client.packDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := client.writePack([]*object.Object{base, delta}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []*object.Object{object.NewObject(object.BlobObject, looseData), base, delta} {
+		r, err := client.OpenObject(want.Hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatalf("reading %s: %v", want.Hash, err)
+		}
+		if r.Type != object.BlobObject || r.Size != int64(want.Size) || !bytes.Equal(data, want.Data) {
+			t.Errorf("OpenObject(%s) = %s %d %d bytes, want blob %d", want.Hash, r.Type, r.Size, len(data), want.Size)
+		}
+	}
+
+	// 別のハッシュの場所に置いたオブジェクトは、内容を読み終えたときにハッシュが合わない.
+	wrong := object.NewObject(object.BlobObject, []byte("other\n")).Hash.String()
+	raw, err := ioutil.ReadFile(filepath.Join(dir, ".git", "objects", loose.String()[:2], loose.String()[2:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, ".git", "objects", wrong[:2]), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, ".git", "objects", wrong[:2], wrong[2:]), raw, 0444); err != nil {
+		t.Fatal(err)
+	}
+	wrongHash, _ := hex.DecodeString(wrong)
+	r, err := client.OpenObject(wrongHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var corrupt *object.CorruptObjectError
+	if _, err := ioutil.ReadAll(r); !errors.As(err, &corrupt) {
+		t.Errorf("reading a misplaced object: error = %v, want *object.CorruptObjectError", err)
+	}
+}
+
+// WalkWorktreeが管理ディレクトリ、別のリポジトリ、skipしたディレクトリを辿らないか
+func TestClient_WalkWorktree(t *testing.T) {
+	dir := newTestRepository(t)
+	for _, path := range []string{"a.txt", "src/b.go", "src/skip/c.go", "nested/.git/HEAD", "nested/d.txt", ".git/config"} {
+		name := filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(path), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	err = client.WalkWorktree(func(path string, isDir bool) bool {
+		return isDir && path == "src/skip"
+	}, func(path string, info os.FileInfo) error {
+		got = append(got, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[a.txt src/b.go]"; fmt.Sprint(got) != want {
+		t.Errorf("WalkWorktree() = %v, want %s", got, want)
+	}
+}
+
+// コミットやブランチの操作がHEADとブランチのreflogに記録され、名前の変更と削除にreflogが追従するか
+func TestClient_Reflog(t *testing.T) {
+	for name, value := range map[string]string{
+		"GIT_COMMITTER_NAME":  "fsegit",
+		"GIT_COMMITTER_EMAIL": "fsegit@example.com",
+		"GIT_COMMITTER_DATE":  "1672531200 +0900",
+	} {
+		old, ok := os.LookupEnv(name)
+		os.Setenv(name, value)
+		defer func(name, old string, ok bool) {
+			if ok {
+				os.Setenv(name, old)
+			} else {
+				os.Unsetenv(name)
+			}
+		}(name, old, ok)
+	}
+
+	dir := newTestRepository(t)
+	tree := writeTestObject(t, dir, object.TreeObject, nil)
+	first := writeTestObject(t, dir, object.CommitObject, []byte(fmt.Sprintf(
+		"tree %s\nauthor fsegit <fsegit@example.com> 1672531200 +0900\ncommitter fsegit <fsegit@example.com> 1672531200 +0900\n\nfirst\n", tree)))
+	second := writeTestObject(t, dir, object.CommitObject, []byte(fmt.Sprintf(
+		"tree %s\nparent %s\nauthor fsegit <fsegit@example.com> 1672531200 +0900\ncommitter fsegit <fsegit@example.com> 1672531200 +0900\n\nsecond\n", tree, first)))
+
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.WriteSymbolicRef("HEAD", "refs/heads/main"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.UpdateHead(first, "commit (initial): first"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.UpdateHead(second, "commit: second"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CreateBranch("topic", first, "branch: Created from main~1"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, ".git", "logs", "HEAD"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf("%s %s fsegit <fsegit@example.com> 1672531200 +0900\tcommit (initial): first\n", zeroHash, first) +
+		fmt.Sprintf("%s %s fsegit <fsegit@example.com> 1672531200 +0900\tcommit: second\n", first, second)
+	if string(data) != want {
+		t.Errorf("logs/HEAD = %q, want %q", data, want)
+	}
+	entries, err := client.ReadReflog("refs/heads/main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Message != "commit: second" || !bytes.Equal(entries[0].Old, first) || entries[1].Old != nil {
+		t.Errorf("main reflog = %+v", entries)
+	}
+	if hash, err := client.ReflogAt("HEAD", 1); err != nil || !bytes.Equal(hash, first) {
+		t.Errorf("ReflogAt(HEAD, 1) = %s, %v, want %s", hash, err, first)
+	}
+	if _, err := client.ReflogAt("HEAD", 2); !errors.Is(err, ErrReflogTooShort) {
+		t.Errorf("ReflogAt(HEAD, 2) error = %v, want ErrReflogTooShort", err)
+	}
+
+	if err := client.RenameBranch("topic", "feature/x"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ReadReflog("refs/heads/topic"); !errors.Is(err, ErrNoReflog) {
+		t.Errorf("ReadReflog(topic) error = %v, want ErrNoReflog", err)
+	}
+	entries, err = client.ReadReflog("refs/heads/feature/x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[1].Message != "branch: Created from main~1" {
+		t.Errorf("feature/x reflog = %+v", entries)
+	}
+	if _, err := client.DeleteBranch("feature/x", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".git", "logs", "refs", "heads", "feature")); !os.IsNotExist(err) {
+		t.Errorf("logs/refs/heads/feature should be removed, Stat() error = %v", err)
+	}
+}
+
+// soft、mixed、hardのそれぞれで、HEAD、インデックス、作業ツリーのどこまでが対象のコミットに戻るか
+func TestClient_Reset(t *testing.T) {
+	dir := newTestRepository(t)
+	blobA := writeTestObject(t, dir, object.BlobObject, []byte("a\n"))
+	blobB := writeTestObject(t, dir, object.BlobObject, []byte("b\n"))
+	commit := func(blob sha.SHA1, parents ...sha.SHA1) sha.SHA1 {
+		tree := writeTestObject(t, dir, object.TreeObject, treeData(object.TreeEntry{Mode: object.ModeBlob, Name: "a.txt", Hash: blob}))
+		data := fmt.Sprintf("tree %s\n", tree)
+		for _, parent := range parents {
+			data += fmt.Sprintf("parent %s\n", parent)
+		}
+		data += "author fsegit <fsegit@example.com> 1672531200 +0900\ncommitter fsegit <fsegit@example.com> 1672531200 +0900\n\ncommit\n"
+		return writeTestObject(t, dir, object.CommitObject, []byte(data))
+	}
+	first := commit(blobA)
+	second := commit(blobB, first)
+
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.WriteSymbolicRef("HEAD", "refs/heads/main"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.WriteRef("refs/heads/main", second); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CheckoutCommit(second, CheckoutOptions{Force: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Reset(first, ResetSoft, "reset: moving to HEAD~1"); err != nil {
+		t.Fatal(err)
+	}
+	status, err := client.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Staged) != 1 || len(status.Unstaged) != 0 {
+		t.Errorf("after soft reset, status = %+v, want a.txt staged", status)
+	}
+	if hash, err := client.ResolveRef(OrigHead); err != nil || !bytes.Equal(hash, second) {
+		t.Errorf("ORIG_HEAD = %s, %v, want %s", hash, err, second)
+	}
+
+	if err := client.Reset(first, ResetMixed, "reset: moving to HEAD"); err != nil {
+		t.Fatal(err)
+	}
+	if status, err = client.Status(); err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Staged) != 0 || len(status.Unstaged) != 1 {
+		t.Errorf("after mixed reset, status = %+v, want a.txt unstaged", status)
+	}
+
+	if err := client.Reset(first, ResetHard, "reset: moving to HEAD"); err != nil {
+		t.Fatal(err)
+	}
+	if status, err = client.Status(); err != nil || !status.Clean() {
+		t.Errorf("after hard reset, status = %+v, %v, want clean", status, err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "a.txt"))
+	if err != nil || string(data) != "a\n" {
+		t.Errorf("a.txt = %q, %v", data, err)
+	}
+	if hash, err := client.ReflogAt("refs/heads/main", 2); err != nil || !bytes.Equal(hash, first) {
+		t.Errorf("main@{2} = %s, %v, want %s", hash, err, first)
+	}
+}
+
+// 退避した変更がrefs/stashのreflogに積み重なり、applyで作業ツリーに戻ってdropで取り除かれるか
+func TestClient_Stash(t *testing.T) {
+	dir := newTestRepository(t)
+	blob := writeTestObject(t, dir, object.BlobObject, []byte("a\n"))
+	tree := writeTestObject(t, dir, object.TreeObject, treeData(object.TreeEntry{Mode: object.ModeBlob, Name: "a.txt", Hash: blob}))
+	head := writeTestObject(t, dir, object.CommitObject, []byte(fmt.Sprintf(
+		"tree %s\nauthor fsegit <fsegit@example.com> 1672531200 +0900\ncommitter fsegit <fsegit@example.com> 1672531200 +0900\n\nfirst\n", tree)))
+	signature := object.Signature{Name: "fsegit", Email: "fsegit@example.com", When: time.Unix(1672531200, 0)}
+
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.WriteSymbolicRef("HEAD", "refs/heads/main"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.WriteRef("refs/heads/main", head); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CheckoutCommit(head, CheckoutOptions{Force: true}); err != nil {
+		t.Fatal(err)
+	}
+	if hash, err := client.StashPush("", signature); err != nil || hash != nil {
+		t.Fatalf("StashPush() on a clean tree = %s, %v, want nil", hash, err)
+	}
+
+	for _, content := range []string{"b\n", "c\n"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.StashPush("", signature); err != nil {
+			t.Fatal(err)
+		}
+		if status, err := client.Status(); err != nil || !status.Clean() {
+			t.Errorf("after StashPush(), status = %+v, %v, want clean", status, err)
+		}
+	}
+	entries, err := client.StashList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Message != "WIP on main: "+head.String()[:7]+" first" {
+		t.Fatalf("StashList() = %+v", entries)
+	}
+
+	if conflicts, err := client.StashApply(1); err != nil || len(conflicts) != 0 {
+		t.Fatalf("StashApply(1) = %v, %v", conflicts, err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "a.txt"))
+	if err != nil || string(data) != "b\n" {
+		t.Errorf("a.txt = %q, %v, want b", data, err)
+	}
+	status, err := client.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Staged) != 0 || len(status.Unstaged) != 1 {
+		t.Errorf("after StashApply(), status = %+v, want a.txt unstaged", status)
+	}
+
+	dropped, err := client.StashDrop(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash, err := client.ResolveRef(StashRef); err != nil || bytes.Equal(hash, dropped) || !bytes.Equal(hash, entries[1].New) {
+		t.Errorf("refs/stash = %s, %v, want %s", hash, err, entries[1].New)
+	}
+	if _, err := client.StashDrop(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ResolveRef(StashRef); !errors.Is(err, ErrRefNotFound) {
+		t.Errorf("ResolveRef(refs/stash) error = %v, want ErrRefNotFound", err)
+	}
+	if _, err := client.StashApply(0); !errors.Is(err, ErrNoStash) {
+		t.Errorf("StashApply() error = %v, want ErrNoStash", err)
+	}
+}
+
+// 壊れたオブジェクト、ないオブジェクトへのリンク、辿れないオブジェクトをそれぞれ見つけられるか
+func TestClient_Fsck(t *testing.T) {
+	dir := newTestRepository(t)
+	blob := writeTestObject(t, dir, object.BlobObject, []byte("a\n"))
+	tree := writeTestObject(t, dir, object.TreeObject, treeData(object.TreeEntry{Mode: object.ModeBlob, Name: "a.txt", Hash: blob}))
+	commit := writeTestObject(t, dir, object.CommitObject, []byte(fmt.Sprintf(
+		"tree %s\nauthor fsegit <fsegit@example.com> 1672531200 +0900\ncommitter fsegit <fsegit@example.com> 1672531200 +0900\n\nfirst\n", tree)))
+	dangling := writeTestObject(t, dir, object.BlobObject, []byte("dangling\n"))
+	missing := object.NewObject(object.BlobObject, []byte("missing\n")).Hash
+	broken := writeTestObject(t, dir, object.TreeObject, treeData(object.TreeEntry{Mode: object.ModeBlob, Name: "b.txt", Hash: missing}))
+
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.WriteRef("refs/heads/main", commit); err != nil {
+		t.Fatal(err)
+	}
+	issues, err := client.Fsck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	type found struct {
+		kind FsckKind
+		hash string
+	}
+	got := map[found]bool{}
+	for _, issue := range issues {
+		got[found{issue.Kind, issue.Hash.String()}] = true
+	}
+	// どこからも辿れないツリーはリンクが切れていてもdanglingとして報告される.
+	want := []found{{FsckDangling, dangling.String()}, {FsckBrokenLink, broken.String()}, {FsckDangling, broken.String()}}
+	if len(got) != len(want) {
+		t.Errorf("Fsck() = %+v, want %v", issues, want)
+	}
+	for _, w := range want {
+		if !got[w] {
+			t.Errorf("Fsck() = %+v, want %v", issues, w)
+		}
+	}
+
+	// 内容を書き換えたルースオブジェクトはハッシュが合わない.
+	path := filepath.Join(dir, ".git", "objects", blob.String()[:2], blob.String()[2:])
+	if err := os.Chmod(path, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte("corrupt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if issues, err = client.Fsck(); err != nil {
+		t.Fatal(err)
+	}
+	corrupt := false
+	for _, issue := range issues {
+		if issue.Kind == FsckCorrupt && bytes.Equal(issue.Hash, blob) && issue.IsError() {
+			corrupt = true
+		}
+	}
+	if !corrupt {
+		t.Errorf("Fsck() = %+v, want corrupt %s", issues, blob)
+	}
+}
+
+// 参照が期待した値のときだけ書き換え、削除できるか
+func TestClient_UpdateRefIfMatch(t *testing.T) {
+	dir := newTestRepository(t)
+	tree := writeTestObject(t, dir, object.TreeObject, nil)
+	first := writeTestObject(t, dir, object.CommitObject, []byte(fmt.Sprintf(
+		"tree %s\nauthor fsegit <fsegit@example.com> 1672531200 +0900\ncommitter fsegit <fsegit@example.com> 1672531200 +0900\n\nfirst\n", tree)))
+	second := writeTestObject(t, dir, object.CommitObject, []byte(fmt.Sprintf(
+		"tree %s\nparent %s\nauthor fsegit <fsegit@example.com> 1672531200 +0900\ncommitter fsegit <fsegit@example.com> 1672531200 +0900\n\nsecond\n", tree, first)))
+
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const name = "refs/heads/topic"
+	if err := client.UpdateRefIfMatch(name, first, zeroHash, "create"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.UpdateRefIfMatch(name, second, zeroHash, "create again"); !errors.Is(err, ErrRefChanged) {
+		t.Errorf("UpdateRefIfMatch() on existing ref error = %v, want %v", err, ErrRefChanged)
+	}
+	if err := client.UpdateRefIfMatch(name, second, second, "stale"); !errors.Is(err, ErrRefChanged) {
+		t.Errorf("UpdateRefIfMatch() with stale old error = %v, want %v", err, ErrRefChanged)
+	}
+	if err := client.UpdateRefIfMatch(name, second, first, "advance"); err != nil {
+		t.Fatal(err)
+	}
+	if hash, err := client.ResolveRef(name); err != nil || !bytes.Equal(hash, second) {
+		t.Errorf("ResolveRef() = %s, %v, want %s", hash, err, second)
+	}
+
+	if err := client.WriteSymbolicRef("HEAD", name); err != nil {
+		t.Fatal(err)
+	}
+	if target, err := client.DerefRefName("HEAD"); err != nil || target != name {
+		t.Errorf("DerefRefName(HEAD) = %q, %v, want %q", target, err, name)
+	}
+
+	if err := client.DeleteRefIfMatch(name, first); !errors.Is(err, ErrRefChanged) {
+		t.Errorf("DeleteRefIfMatch() with stale old error = %v, want %v", err, ErrRefChanged)
+	}
+	if err := client.DeleteRefIfMatch(name, second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ResolveRef(name); !errors.Is(err, ErrRefNotFound) {
+		t.Errorf("ResolveRef() after delete error = %v, want %v", err, ErrRefNotFound)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".git", "refs", "heads", "topic.lock")); !os.IsNotExist(err) {
+		t.Errorf("lock file is left after delete: %v", err)
+	}
+}
+
+// read-tree -mの2方向と3方向の読み込みで、インデックスが正しく合わさるか
+func TestClient_ReadTreeMerge(t *testing.T) {
+	dir := newTestRepository(t)
+	blob := func(content string) sha.SHA1 {
+		return writeTestObject(t, dir, object.BlobObject, []byte(content))
+	}
+	tree := func(a, b, c string) sha.SHA1 {
+		return writeTestObject(t, dir, object.TreeObject, treeData(
+			object.TreeEntry{Mode: object.ModeBlob, Name: "a", Hash: blob(a)},
+			object.TreeEntry{Mode: object.ModeBlob, Name: "b", Hash: blob(b)},
+			object.TreeEntry{Mode: object.ModeBlob, Name: "c", Hash: blob(c)},
+		))
+	}
+	base := tree("1", "1", "1")
+	ours := tree("2", "1", "2")
+	theirs := tree("1", "2", "3")
+
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.ReadTree(ours); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.ReadTreeMerge(base, ours, theirs); err != nil {
+		t.Fatal(err)
+	}
+	index, err := client.ReadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, entry := range index.Entries {
+		obj, err := client.GetObject(entry.Hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, fmt.Sprintf("%s:%d:%s", entry.Path, entry.Stage, obj.Data))
+	}
+	if want := "a:0:2 b:0:2 c:1:1 c:2:2 c:3:3"; strings.Join(got, " ") != want {
+		t.Errorf("ReadTreeMerge(base, ours, theirs) index = %v, want %s", got, want)
+	}
+	if err := client.ReadTreeMerge(ours, theirs); !errors.Is(err, ErrUnmerged) {
+		t.Errorf("ReadTreeMerge() with unmerged index error = %v, want %v", err, ErrUnmerged)
+	}
+
+	// 2方向: インデックスでaを変えていると、aを書き換えるツリーには切り替えられない.
+	if err := client.ReadTree(ours); err != nil {
+		t.Fatal(err)
+	}
+	index, err = client.ReadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	index.Add(&IndexEntry{Mode: object.ModeBlob, Hash: blob("staged"), Path: "a"})
+	if err := client.WriteIndex(index); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.ReadTreeMerge(ours, theirs); !errors.Is(err, ErrWouldOverwrite) {
+		t.Errorf("ReadTreeMerge(ours, theirs) error = %v, want %v", err, ErrWouldOverwrite)
+	}
+	// aが変わらない切り替えなら、インデックスの変更を残したまま他のパスを書き換える.
+	if err := client.ReadTreeMerge(ours, tree("2", "1", "4")); err != nil {
+		t.Fatal(err)
+	}
+	if index, err = client.ReadIndex(); err != nil {
+		t.Fatal(err)
+	}
+	if a, c := index.Entry("a"), index.Entry("c"); !bytes.Equal(a.Hash, blob("staged")) || !bytes.Equal(c.Hash, blob("4")) {
+		t.Errorf("ReadTreeMerge(ours, new) a = %s, c = %s", a.Hash, c.Hash)
+	}
+}
+
+// コミットグラフを書いた後は、コミットオブジェクトを読まずに親と世代数を求められるか
+func TestClient_CommitGraph(t *testing.T) {
+	dir := newTestRepository(t)
+	tree := writeTestObject(t, dir, object.TreeObject, nil)
+	commit := func(message string, parents ...sha.SHA1) sha.SHA1 {
+		data := fmt.Sprintf("tree %s\n", tree)
+		for _, parent := range parents {
+			data += fmt.Sprintf("parent %s\n", parent)
+		}
+		data += "author fsegit <fsegit@example.com> 1672531200 +0900\ncommitter fsegit <fsegit@example.com> 1672531200 +0900\n\n" + message + "\n"
+		return writeTestObject(t, dir, object.CommitObject, []byte(data))
+	}
+	root := commit("root")
+	a1 := commit("a1", root)
+	b1 := commit("b1", root)
+	a2 := commit("a2", a1, b1)
+	b2 := commit("b2", b1, a1)
+	a3 := commit("a3", a2)
+
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.WriteRef("refs/heads/a", a3); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.WriteRef("refs/heads/b", b2); err != nil {
+		t.Fatal(err)
+	}
+	n, err := client.WriteCommitGraph()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 6 {
+		t.Errorf("WriteCommitGraph() = %d, want 6", n)
+	}
+
+	// 先端以外のコミットオブジェクトを消しても、コミットグラフから辿れる.
+	for _, hash := range []sha.SHA1{root, a1, b1, a2} {
+		if err := os.Remove(filepath.Join(dir, ".git", "objects", hash.String()[:2], hash.String()[2:])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bases, err := client.MergeBases(a3, b2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bases) != 2 {
+		t.Errorf("MergeBases(a3, b2) = %v, want [a1 b1]", bases)
+	}
+	for _, tt := range []struct {
+		ancestor, descendant sha.SHA1
+		want                 bool
+	}{
+		{root, a3, true},
+		{b1, a3, true},
+		{b2, a3, false},
+		{a3, root, false},
+	} {
+		got, err := client.IsAncestor(tt.ancestor, tt.descendant)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("IsAncestor(%s, %s) = %v, want %v", tt.ancestor, tt.descendant, got, tt.want)
+		}
+	}
+}
+
+// ルースオブジェクトとパックの全てのオブジェクトを、種類とともに一度ずつ列挙できるか
+func TestClient_ForEachObject(t *testing.T) {
+	dir := newTestRepository(t)
+	blob := writeTestObject(t, dir, object.BlobObject, []byte("a\n"))
+	tree := writeTestObject(t, dir, object.TreeObject, treeData(object.TreeEntry{Mode: object.ModeBlob, Name: "a.txt", Hash: blob}))
+	commit := writeTestObject(t, dir, object.CommitObject, []byte(fmt.Sprintf(
+		"tree %s\nauthor fsegit <fsegit@example.com> 1672531200 +0900\ncommitter fsegit <fsegit@example.com> 1672531200 +0900\n\nfirst\n", tree)))
+
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.WriteRef("refs/heads/main", commit); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Repack(); err != nil {
+		t.Fatal(err)
+	}
+	// パックにあるものと同じオブジェクトがルースにもあっても一度だけ渡す.
+	writeTestObject(t, dir, object.BlobObject, []byte("a\n"))
+	loose := writeTestObject(t, dir, object.BlobObject, []byte("loose\n"))
+
+	got := map[string]object.Type{}
+	if err := client.ForEachObject(func(hash sha.SHA1, objectType object.Type) error {
+		if _, ok := got[hash.String()]; ok {
+			t.Errorf("ForEachObject() passed %s twice", hash)
+		}
+		got[hash.String()] = objectType
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]object.Type{
+		blob.String():   object.BlobObject,
+		tree.String():   object.TreeObject,
+		commit.String(): object.CommitObject,
+		loose.String():  object.BlobObject,
+	}
+	if len(got) != len(want) {
+		t.Errorf("ForEachObject() = %v, want %v", got, want)
+	}
+	for hash, objectType := range want {
+		if got[hash] != objectType {
+			t.Errorf("ForEachObject() type of %s = %s, want %s", hash, got[hash], objectType)
+		}
+	}
+
+	count := 0
+	if err := client.ForEachObject(func(hash sha.SHA1, objectType object.Type) error {
+		count++
+		return object.ErrStopWalk
+	}); err != nil || count != 1 {
+		t.Errorf("ForEachObject() with ErrStopWalk = %d calls, %v", count, err)
+	}
+}
+
+// StoreReaderがStoreRawと同じハッシュで書き込み、サイズが違うデータは書き込まないか
+func TestClient_StoreReader(t *testing.T) {
+	dir := newTestRepository(t)
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte(strings.Repeat("streamed blob\n", 1000))
+	want := object.NewObject(object.BlobObject, data).Hash
+
+	hash, err := client.StoreReader(object.BlobObject, int64(len(data)), bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(hash, want) {
+		t.Errorf("StoreReader() = %s, want %s", hash, want)
+	}
+	obj, err := client.GetObject(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.Type != object.BlobObject || !bytes.Equal(obj.Data, data) {
+		t.Errorf("GetObject() = %s %q, want blob with the stored data", obj.Type, obj.Data)
+	}
+	if hash, err := client.StoreRaw(object.BlobObject, data); err != nil || !bytes.Equal(hash, want) {
+		t.Errorf("StoreRaw() = %s, %v, want %s", hash, err, want)
+	}
+
+	for _, size := range []int64{int64(len(data)) - 1, int64(len(data)) + 1} {
+		if _, err := client.StoreReader(object.BlobObject, size, bytes.NewReader(data)); !errors.Is(err, ErrSizeMismatch) {
+			t.Errorf("StoreReader(size %d) error = %v, want %v", size, err, ErrSizeMismatch)
+		}
+	}
+	// 失敗しても一時ファイルを残さない.
+	files, err := filepath.Glob(filepath.Join(dir, ".git", "objects", ".tmp-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("temporary files are left: %v", files)
+	}
+}
+
+// ctxを取り消すと履歴を辿るのとgcを途中でやめ、ctx.Err()を返すか
+func TestClient_Context(t *testing.T) {
+	dir := newTestRepository(t)
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := writeTestObject(t, dir, object.TreeObject, nil)
+	var head sha.SHA1
+	for i := 0; i < 5; i++ {
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "tree %s\n", tree)
+		if head != nil {
+			fmt.Fprintf(&sb, "parent %s\n", head)
+		}
+		fmt.Fprintf(&sb, "author fsegit <fsegit@example.com> %d +0900\ncommitter fsegit <fsegit@example.com> %d +0900\n\n%d\n", 1672531200+i, 1672531200+i, i)
+		head = writeTestObject(t, dir, object.CommitObject, []byte(sb.String()))
+	}
+	if err := client.WriteRef("refs/heads/main", head); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, order := range []WalkOrder{WalkOrderDate, WalkOrderTopo} {
+		ctx, cancel := context.WithCancel(context.Background())
+		count := 0
+		err := client.WalkHistoryContext(ctx, head, WalkHistoryOpts{Order: order}, func(commit *object.Commit) error {
+			count++
+			cancel()
+			return nil
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("WalkHistoryContext(order %d) error = %v, want %v", order, err, context.Canceled)
+		}
+		if count != 1 {
+			t.Errorf("WalkHistoryContext(order %d) visited %d commits after cancel, want 1", order, count)
+		}
+		cancel()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.TopoSortHistoryContext(ctx, []sha.SHA1{head}, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("TopoSortHistoryContext() error = %v, want %v", err, context.Canceled)
+	}
+	if _, err := client.RepackContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("RepackContext() error = %v, want %v", err, context.Canceled)
+	}
+	// 取り消したgcはルースオブジェクトを消さない.
+	if _, err := os.Stat(filepath.Join(dir, ".git", "objects", head.String()[:2], head.String()[2:])); err != nil {
+		t.Errorf("loose object was removed by the cancelled repack: %v", err)
+	}
+	if _, err := client.WriteCommitGraphContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("WriteCommitGraphContext() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+// .fsegitと.gitの両方があるとき、fsegit.dirNameか環境変数FSEGIT_DIR_NAMEで使う方を選べるか
+func TestNewClient_GitDirName(t *testing.T) {
+	globalConfig := filepath.Join(t.TempDir(), "gitconfig")
+	for name, value := range map[string]string{"GIT_CONFIG_GLOBAL": globalConfig, "GIT_CONFIG_NOSYSTEM": "1", "FSEGIT_DIR_NAME": ""} {
+		old, ok := os.LookupEnv(name)
+		os.Setenv(name, value)
+		defer func(name, old string, ok bool) {
+			if ok {
+				os.Setenv(name, old)
+			} else {
+				os.Unsetenv(name)
+			}
+		}(name, old, ok)
+	}
+	dir := t.TempDir()
+	if _, _, err := Init(dir, InitOptions{GitDirName: ".git"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Init(dir, InitOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	gitDir := func() string {
+		t.Helper()
+		client, err := NewClient(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return filepath.Base(client.GitDir())
+	}
+	if got := gitDir(); got != ".fsegit" {
+		t.Errorf("GitDir() without setting = %s, want .fsegit", got)
+	}
+
+	if err := ioutil.WriteFile(globalConfig, []byte("[fsegit]\n\tdirName = .git\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := gitDir(); got != ".git" {
+		t.Errorf("GitDir() with fsegit.dirName = %s, want .git", got)
+	}
+	os.Setenv("FSEGIT_DIR_NAME", ".fsegit")
+	if got := gitDir(); got != ".fsegit" {
+		t.Errorf("GitDir() with FSEGIT_DIR_NAME = %s, want .fsegit", got)
+	}
+	os.Setenv("FSEGIT_DIR_NAME", "")
+
+	// 設定した名前のディレクトリだけを探し、もう一方があっても使わない.
+	other := t.TempDir()
+	if _, _, err := Init(other, InitOptions{GitDirName: ".fsegit"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewClient(other); !errors.Is(err, util.ErrNotGitRepository) {
+		t.Errorf("NewClient() error = %v, want %v", err, util.ErrNotGitRepository)
+	}
+	os.Setenv("FSEGIT_DIR_NAME", ".git")
+	if _, err := util.FindGitRoot(other); !errors.Is(err, util.ErrNotGitRepository) {
+		t.Errorf("FindGitRoot() with FSEGIT_DIR_NAME error = %v, want %v", err, util.ErrNotGitRepository)
+	}
+	if root, err := util.FindGitRoot(dir); err != nil || root != dir {
+		t.Errorf("FindGitRoot() with FSEGIT_DIR_NAME = %s, %v, want %s", root, err, dir)
+	}
+	os.Setenv("FSEGIT_DIR_NAME", "")
+	client, _, err := Init(t.TempDir(), InitOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(client.GitDir()) != ".git" {
+		t.Errorf("Init() with fsegit.dirName created %s, want .git", client.GitDir())
+	}
+
+	if err := ioutil.WriteFile(globalConfig, []byte("[fsegit]\n\tdirName = .hg\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewClient(dir); !errors.Is(err, config.ErrInvalidConfig) {
+		t.Errorf("NewClient() with invalid fsegit.dirName error = %v, want %v", err, config.ErrInvalidConfig)
+	}
+}
+
+// 浅い履歴の境界のコミットを親のないコミットとして扱い、手元にない親を読もうとしないか
+func TestClient_Shallow(t *testing.T) {
+	dir := newTestRepository(t)
+	tree := writeTestObject(t, dir, object.TreeObject, nil)
+	commit := func(message string, parents ...sha.SHA1) sha.SHA1 {
+		data := fmt.Sprintf("tree %s\n", tree)
+		for _, parent := range parents {
+			data += fmt.Sprintf("parent %s\n", parent)
+		}
+		data += "author fsegit <fsegit@example.com> 1672531200 +0900\ncommitter fsegit <fsegit@example.com> 1672531200 +0900\n\n" + message + "\n"
+		return writeTestObject(t, dir, object.CommitObject, []byte(data))
+	}
+	root := commit("root")
+	first := commit("first", root)
+	second := commit("second", first)
+	if err := os.Remove(filepath.Join(dir, ".git", "objects", root.String()[:2], root.String()[2:])); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.WriteRef("refs/heads/main", second); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.UpdateShallow([]sha.SHA1{first, second}, []sha.SHA1{second}); err != nil {
+		t.Fatal(err)
+	}
+	if shallow, err := client.ReadShallow(); err != nil || len(shallow) != 1 || !bytes.Equal(shallow[0], first) {
+		t.Fatalf("ReadShallow() = %v, %v, want [first]", shallow, err)
+	}
+
+	var walked []string
+	err = client.WalkHistory(second, func(commit *object.Commit) error {
+		walked = append(walked, strings.TrimSpace(commit.Message))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(walked, " ") != "second first" {
+		t.Errorf("WalkHistory() = %v, want [second first]", walked)
+	}
+	issues, err := client.Fsck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, issue := range issues {
+		if issue.Kind == FsckBrokenLink {
+			t.Errorf("Fsck() = %+v, want no broken links", issue)
+		}
+	}
+	if n, err := client.WriteCommitGraph(); err != nil || n != 0 {
+		t.Errorf("WriteCommitGraph() = %d, %v, want 0 in a shallow repository", n, err)
+	}
+
+	if err := client.WriteShallow(nil); err != nil {
+		t.Fatal(err)
+	}
+	if shallow, err := client.IsShallow(); err != nil || shallow {
+		t.Errorf("IsShallow() = %v, %v after removing the shallow file", shallow, err)
+	}
+}
+
+// マージを含む履歴で、各行をその行を追加したコミットに割り当てるか
+func TestClient_Blame(t *testing.T) {
+	dir := newTestRepository(t)
+	commit := func(content, message string, when int64, parents ...sha.SHA1) sha.SHA1 {
+		blob := writeTestObject(t, dir, object.BlobObject, []byte(content))
+		sub := writeTestObject(t, dir, object.TreeObject, treeData(object.TreeEntry{Mode: object.ModeBlob, Name: "f.txt", Hash: blob}))
+		tree := writeTestObject(t, dir, object.TreeObject, treeData(object.TreeEntry{Mode: object.ModeTree, Name: "sub", Hash: sub}))
+		data := fmt.Sprintf("tree %s\n", tree)
+		for _, parent := range parents {
+			data += fmt.Sprintf("parent %s\n", parent)
+		}
+		data += fmt.Sprintf("author fsegit <fsegit@example.com> %d +0900\ncommitter fsegit <fsegit@example.com> %d +0900\n\n%s\n", when, when, message)
+		return writeTestObject(t, dir, object.CommitObject, []byte(data))
+	}
+	root := commit("a\nb\n", "root", 1672531200)
+	left := commit("a\nL\nb\n", "left", 1672531300, root)
+	right := commit("a\nb\nR\n", "right", 1672531400, root)
+	merge := commit("a\nL\nb\nR\nM\n", "merge", 1672531500, left, right)
+
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines, err := client.Blame(merge, "sub/f.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		commit   sha.SHA1
+		origLine int
+	}{{root, 1}, {left, 2}, {root, 2}, {right, 3}, {merge, 5}}
+	if len(lines) != len(want) {
+		t.Fatalf("Blame() = %d lines, want %d", len(lines), len(want))
+	}
+	for i, w := range want {
+		if !bytes.Equal(lines[i].Commit.Hash, w.commit) || lines[i].OrigLine != w.origLine {
+			t.Errorf("Blame() line %d = %s:%d, want %s:%d", i+1, lines[i].Commit.Hash, lines[i].OrigLine, w.commit, w.origLine)
+		}
+	}
+	if _, err := client.Blame(merge, "sub/missing.txt"); !errors.Is(err, ErrPathNotInCommit) {
+		t.Errorf("Blame(missing) error = %v, want %v", err, ErrPathNotInCommit)
+	}
+}
+
+// インデックスとツリーのファイルからマッチする行を探し、バイナリのファイルは1つだけ返すか
+func TestClient_Grep(t *testing.T) {
+	dir := newTestRepository(t)
+	text := writeTestObject(t, dir, object.BlobObject, []byte("hello world\nfoo\nWorld again"))
+	binary := writeTestObject(t, dir, object.BlobObject, []byte("world\x00world\n"))
+	sub := writeTestObject(t, dir, object.TreeObject, treeData(object.TreeEntry{Mode: object.ModeBlob, Name: "b.txt", Hash: text}))
+	tree := writeTestObject(t, dir, object.TreeObject, treeData(
+		object.TreeEntry{Mode: object.ModeBlob, Name: "bin", Hash: binary},
+		object.TreeEntry{Mode: object.ModeTree, Name: "sub", Hash: sub},
+	))
+
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grep := func(pattern string, opts GrepOptions) []string {
+		t.Helper()
+		var got []string
+		err := client.Grep(regexp.MustCompile(pattern), opts, func(match GrepMatch) error {
+			got = append(got, fmt.Sprintf("%s:%d:%s:%v", match.Path, match.Line, match.Text, match.Binary))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	if got, want := grep("(?i)world", GrepOptions{Tree: tree}), []string{"bin:1::true", "sub/b.txt:1:hello world:false", "sub/b.txt:3:World again:false"}; strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Grep(tree) = %q, want %q", got, want)
+	}
+	if got, want := grep("o", GrepOptions{Tree: tree, FirstMatchOnly: true}), []string{"bin:1::true", "sub/b.txt:1:hello world:false"}; strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Grep(tree, FirstMatchOnly) = %q, want %q", got, want)
+	}
+
+	index := NewIndex()
+	index.Add(&IndexEntry{Mode: object.ModeBlob, Hash: text, Path: "a.txt"})
+	if err := client.WriteIndex(index); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := grep("^foo$", GrepOptions{}), []string{"a.txt:2:foo:false"}; strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Grep(index) = %q, want %q", got, want)
+	}
+}
+
+// .gitmodulesとインデックスのgitlinkから、サブモジュールの状態と作業ツリーでの変更を求められるか
+func TestClient_SubmoduleStatuses(t *testing.T) {
+	dir := newTestRepository(t)
+	recorded := bytes.Repeat([]byte{0x11}, 20)
+	moved := sha.SHA1(bytes.Repeat([]byte{0x22}, 20))
+	gitmodules := "[submodule \"lib\"]\n\tpath = libs/lib\n\turl = https://example.com/lib.git\n[submodule \"other\"]\n\tpath = other\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, ".gitmodules"), []byte(gitmodules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// libs/libは取り出してあり、インデックスと違うコミットにいる. otherは取り出していない.
+	subGitDir := filepath.Join(dir, "libs", "lib", ".git")
+	if err := os.MkdirAll(filepath.Join(subGitDir, "refs", "heads"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(subGitDir, "HEAD"), []byte("ref: refs/heads/main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(subGitDir, "refs", "heads", "main"), []byte(moved.String()+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "other"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := NewIndex()
+	index.Add(&IndexEntry{Mode: object.ModeGitlink, Hash: recorded, Path: "libs/lib"})
+	index.Add(&IndexEntry{Mode: object.ModeGitlink, Hash: recorded, Path: "other"})
+	if err := client.WriteIndex(index); err != nil {
+		t.Fatal(err)
+	}
+
+	statuses, err := client.SubmoduleStatuses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 2 {
+		t.Fatalf("SubmoduleStatuses() = %+v, want 2 submodules", statuses)
+	}
+	lib, other := statuses[0], statuses[1]
+	if lib.Name != "lib" || lib.URL != "https://example.com/lib.git" || !lib.Modified() || !bytes.Equal(lib.Current, moved) {
+		t.Errorf("SubmoduleStatuses()[0] = %+v, want lib checked out at %s", lib, moved)
+	}
+	if other.Name != "other" || other.Initialized() || other.Modified() {
+		t.Errorf("SubmoduleStatuses()[1] = %+v, want other not checked out", other)
+	}
+
+	changes, err := client.DiffIndexWorktree(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Path != "libs/lib" || changes[0].Type != ChangeModify || !bytes.Equal(changes[0].NewHash, moved) {
+		t.Errorf("DiffIndexWorktree() = %+v, want libs/lib modified", changes)
+	}
+}
+
+// 実行ビットとシンボリックリンクを取り出せるか. core.symlinks=falseならリンク先を書いた通常のファイルにする.
+func TestClient_CheckoutCommit_Symlinks(t *testing.T) {
+	dir := newTestRepository(t)
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := writeTestObject(t, dir, object.BlobObject, []byte("#!/bin/sh\n"))
+	target := writeTestObject(t, dir, object.BlobObject, []byte("run.sh"))
+	tree := writeTestObject(t, dir, object.TreeObject, treeData(
+		object.TreeEntry{Mode: object.ModeSymlink, Name: "link", Hash: target},
+		object.TreeEntry{Mode: object.ModeExecutable, Name: "run.sh", Hash: script},
+	))
+	commit := writeTestObject(t, dir, object.CommitObject, []byte(fmt.Sprintf(
+		"tree %s\nauthor fsegit <fsegit@example.com> 1672531200 +0900\ncommitter fsegit <fsegit@example.com> 1672531200 +0900\n\ncommit\n", tree)))
+	if err := client.WriteSymbolicRef("HEAD", "refs/heads/main"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CheckoutCommit(commit, CheckoutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.DetachHead(commit, "checkout: moving to commit"); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Lstat(filepath.Join(dir, "run.sh")); err != nil || info.Mode()&0100 == 0 {
+		t.Errorf("run.sh mode = %v, %v, want executable", info.Mode(), err)
+	}
+	if link, err := os.Readlink(filepath.Join(dir, "link")); err != nil || link != "run.sh" {
+		t.Errorf("Readlink(link) = %q, %v, want run.sh", link, err)
+	}
+	if status, err := client.Status(); err != nil || !status.Clean() {
+		t.Errorf("Status() = %+v, %v, want clean", status, err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, ".git", "config"), []byte("[core]\n\tsymlinks = false\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CheckoutCommit(commit, CheckoutOptions{Force: true}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Lstat(filepath.Join(dir, "link"))
+	if err != nil || !info.Mode().IsRegular() {
+		t.Fatalf("link mode = %v, %v, want a regular file", info.Mode(), err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "link")); err != nil || string(data) != "run.sh" {
+		t.Errorf("link = %q, %v, want run.sh", data, err)
+	}
+	if status, err := client.Status(); err != nil || !status.Clean() {
+		t.Errorf("Status() with core.symlinks=false = %+v, %v, want clean", status, err)
+	}
+}
+
+// core.autocrlf=trueならCRLFで取り出し、LFに戻して比べるか
+func TestClient_AutoCRLF(t *testing.T) {
+	for _, tt := range []struct {
+		in, lf, crlf string
+	}{
+		{in: "a\nb\n", lf: "a\nb\n", crlf: "a\r\nb\r\n"},
+		{in: "a\r\nb\r\n", lf: "a\nb\n", crlf: "a\r\nb\r\n"},
+		{in: "a\rb\r\n", lf: "a\rb\r\n", crlf: "a\rb\r\n"},
+		{in: "a\x00\r\n", lf: "a\x00\r\n", crlf: "a\x00\r\n"},
+	} {
+		if got := string(ConvertToLF([]byte(tt.in))); got != tt.lf {
+			t.Errorf("ConvertToLF(%q) = %q, want %q", tt.in, got, tt.lf)
+		}
+		if got := string(ConvertToCRLF([]byte(tt.in))); got != tt.crlf {
+			t.Errorf("ConvertToCRLF(%q) = %q, want %q", tt.in, got, tt.crlf)
+		}
+	}
+
+	dir := newTestRepository(t)
+	if err := ioutil.WriteFile(filepath.Join(dir, ".git", "config"), []byte("[core]\n\tautocrlf = true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob := writeTestObject(t, dir, object.BlobObject, []byte("a\nb\n"))
+	tree := writeTestObject(t, dir, object.TreeObject, treeData(object.TreeEntry{Mode: object.ModeBlob, Name: "a.txt", Hash: blob}))
+	commit := writeTestObject(t, dir, object.CommitObject, []byte(fmt.Sprintf(
+		"tree %s\nauthor fsegit <fsegit@example.com> 1672531200 +0900\ncommitter fsegit <fsegit@example.com> 1672531200 +0900\n\ncommit\n", tree)))
+	if err := client.WriteSymbolicRef("HEAD", "refs/heads/main"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CheckoutCommit(commit, CheckoutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.DetachHead(commit, "checkout: moving to commit"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "a.txt")); err != nil || string(data) != "a\r\nb\r\n" {
+		t.Errorf("a.txt = %q, %v, want CRLF", data, err)
+	}
+	// 時刻を変えて内容を比べさせても、CRLFの違いは変更にならない.
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "a.txt"), future, future); err != nil {
+		t.Fatal(err)
+	}
+	if status, err := client.Status(); err != nil || !status.Clean() {
+		t.Errorf("Status() = %+v, %v, want clean", status, err)
+	}
+	info, err := os.Lstat(filepath.Join(dir, "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash, err := client.WriteWorktreeBlob("a.txt", info); err != nil || !bytes.Equal(hash, blob) {
+		t.Errorf("WriteWorktreeBlob() = %s, %v, want %s", hash, err, blob)
+	}
+}
+
+// countRecorderはAddされた回数を名前ごとに数えるmetrics.Recorder.
+type countRecorder struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func (r *countRecorder) Add(name string, delta int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counts[name] += delta
+}
+
+func (r *countRecorder) Observe(name string, d time.Duration) {}
+
+// 一度展開したオブジェクトをキャッシュから返し、上限を超えたら古いものから忘れるか
+func TestClient_ObjectCache(t *testing.T) {
+	dir := newTestRepository(t)
+	blob := writeTestObject(t, dir, object.BlobObject, []byte("cached\n"))
+	for _, tt := range []struct {
+		size        int64
+		reads, hits int64
+	}{
+		{size: 0, reads: 1, hits: 2},
+		{size: -1, reads: 3, hits: 0},
+	} {
+		recorder := &countRecorder{counts: map[string]int64{}}
+		client, err := NewClientWithOptions(dir, Options{Recorder: recorder, ObjectCacheSize: tt.size})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3; i++ {
+			if obj, err := client.GetObject(blob); err != nil || string(obj.Data) != "cached\n" {
+				t.Fatalf("GetObject() = %v, %v", obj, err)
+			}
+		}
+		if reads, hits := recorder.counts[metrics.ObjectsRead], recorder.counts[metrics.ObjectCacheHits]; reads != tt.reads || hits != tt.hits {
+			t.Errorf("size %d: %d reads and %d hits, want %d and %d", tt.size, reads, hits, tt.reads, tt.hits)
+		}
+	}
+
+	cache := newObjectCache(10)
+	a := object.NewObject(object.BlobObject, []byte("aaaa"))
+	b := object.NewObject(object.BlobObject, []byte("bbbb"))
+	c := object.NewObject(object.BlobObject, []byte("cccc"))
+	cache.add(a)
+	cache.add(b)
+	cache.get(a.Hash)
+	cache.add(c)
+	cache.add(object.NewObject(object.BlobObject, []byte("too large to cache")))
+	if cache.get(a.Hash) == nil || cache.get(b.Hash) != nil || cache.get(c.Hash) == nil || cache.size != 8 {
+		t.Errorf("cache should keep a and c in 8 bytes, size = %d", cache.size)
+	}
+}
+
+// gcで書いた.bitmapを使っても、使わずに辿ったときと同じオブジェクトの集合が求まるか
+func TestClient_RepackBitmap(t *testing.T) {
+	dir := newTestRepository(t)
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var head, side sha.SHA1
+	for i := 0; i < 250; i++ {
+		blob := writeTestObject(t, dir, object.BlobObject, []byte(fmt.Sprintf("%d\n", i)))
+		tree := writeTestObject(t, dir, object.TreeObject, treeData(object.TreeEntry{Mode: object.ModeBlob, Name: "a.txt", Hash: blob}))
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "tree %s\n", tree)
+		if head != nil {
+			fmt.Fprintf(&sb, "parent %s\n", head)
+		}
+		fmt.Fprintf(&sb, "author fsegit <fsegit@example.com> %d +0900\ncommitter fsegit <fsegit@example.com> %d +0900\n\n%d\n", 1672531200+i, 1672531200+i, i)
+		head = writeTestObject(t, dir, object.CommitObject, []byte(sb.String()))
+		if i == 99 {
+			side = head
+		}
+	}
+	if err := client.WriteRef("refs/heads/main", head); err != nil {
+		t.Fatal(err)
+	}
+	result, err := client.RepackWithOptions(context.Background(), RepackOptions{WriteBitmap: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(result.Bitmap); err != nil {
+		t.Fatalf("bitmap was not written: %v", err)
+	}
+	// パックにない新しいコミットはビット列の外で辿る.
+	tip := writeTestObject(t, dir, object.CommitObject, []byte(fmt.Sprintf(
+		"tree %s\nparent %s\nauthor fsegit <fsegit@example.com> 1672540000 +0900\ncommitter fsegit <fsegit@example.com> 1672540000 +0900\n\ntip\n",
+		writeTestObject(t, dir, object.TreeObject, nil), head)))
+
+	counts := func(client *Client) []int {
+		all, err := client.Reachable([]sha.SHA1{tip}, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		commits, err := client.Reachable([]sha.SHA1{tip}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		excluded, err := client.Reachable([]sha.SHA1{side}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		commits.Remove(excluded)
+		return []int{all.Count(object.UndefinedObject), all.Count(object.BlobObject), commits.Count(object.CommitObject)}
+	}
+	want := []int{251*2 + 250, 250, 151}
+	withBitmap, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if withBitmap.packBitmap() == nil {
+		t.Fatal("packBitmap() = nil after writing a bitmap")
+	}
+	if got := counts(withBitmap); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("counts with bitmap = %v, want %v", got, want)
+	}
+	if err := os.Remove(result.Bitmap); err != nil {
+		t.Fatal(err)
+	}
+	withoutBitmap, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := counts(withoutBitmap); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("counts without bitmap = %v, want %v", got, want)
+	}
+}
+
+// 除外したコミットから辿れるものを除いて、コミットを日時の新しい順に、ツリーとブロブをパスとともに列挙するか
+func TestClient_RevList(t *testing.T) {
+	dir := newTestRepository(t)
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared := writeTestObject(t, dir, object.BlobObject, []byte("shared\n"))
+	var commits []sha.SHA1
+	var blobs []sha.SHA1
+	for i := 0; i < 3; i++ {
+		blob := writeTestObject(t, dir, object.BlobObject, []byte(fmt.Sprintf("%d\n", i)))
+		sub := writeTestObject(t, dir, object.TreeObject, treeData(object.TreeEntry{Mode: object.ModeBlob, Name: "b.txt", Hash: blob}))
+		tree := writeTestObject(t, dir, object.TreeObject, treeData(
+			object.TreeEntry{Mode: object.ModeBlob, Name: "a.txt", Hash: shared},
+			object.TreeEntry{Mode: object.ModeTree, Name: "dir", Hash: sub},
+		))
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "tree %s\n", tree)
+		if i > 0 {
+			fmt.Fprintf(&sb, "parent %s\n", commits[i-1])
+		}
+		fmt.Fprintf(&sb, "author fsegit <fsegit@example.com> %d +0900\ncommitter fsegit <fsegit@example.com> %d +0900\n\n%d\n", 1672531200+i, 1672531200+i, i)
+		commits = append(commits, writeTestObject(t, dir, object.CommitObject, []byte(sb.String())))
+		blobs = append(blobs, blob)
+	}
+
+	format := func(entries []RevListEntry) []string {
+		var lines []string
+		for _, entry := range entries {
+			lines = append(lines, entry.Hash.String()[:7]+" "+entry.Path)
+		}
+		return lines
+	}
+	for _, tt := range []struct {
+		name string
+		opts RevListOptions
+		want []string
+	}{
+		{"all", RevListOptions{Include: []sha.SHA1{commits[2]}}, []string{commits[2].String()[:7] + " ", commits[1].String()[:7] + " ", commits[0].String()[:7] + " "}},
+		{"max count", RevListOptions{Include: []sha.SHA1{commits[2]}, MaxCount: 1}, []string{commits[2].String()[:7] + " "}},
+		{"exclude", RevListOptions{Include: []sha.SHA1{commits[2]}, Exclude: []sha.SHA1{commits[0]}}, []string{commits[2].String()[:7] + " ", commits[1].String()[:7] + " "}},
+	} {
+		entries, err := client.RevList(tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := format(entries); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("RevList(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+		count, err := client.RevListCount(tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != len(tt.want) {
+			t.Errorf("RevListCount(%s) = %d, want %d", tt.name, count, len(tt.want))
+		}
+	}
+
+	// 除外したコミットにもあるa.txtは列挙しない.
+	opts := RevListOptions{Include: []sha.SHA1{commits[2]}, Exclude: []sha.SHA1{commits[1]}, Objects: true}
+	entries, err := client.RevList(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, entry := range entries[1:] {
+		paths = append(paths, entry.Path)
+	}
+	if strings.Join(paths, ",") != ",dir,dir/b.txt" || !bytes.Equal(entries[3].Hash, blobs[2]) {
+		t.Errorf("RevList(objects) paths = %q, want [\"\" dir dir/b.txt]", paths)
+	}
+	if count, err := client.RevListCount(opts); err != nil || count != len(entries) {
+		t.Errorf("RevListCount(objects) = %d, %v, want %d", count, err, len(entries))
+	}
+}
+
+// SSHの鍵でコミットとタグに署名し、検証できるか
+func TestClient_SignSSH(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen is not installed")
+	}
+	dir := newTestRepository(t)
+	key := filepath.Join(t.TempDir(), "key")
+	if out, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", "fsegit", "-f", key).CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen: %v: %s", err, out)
+	}
+	pub, err := ioutil.ReadFile(key + ".pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowed := filepath.Join(t.TempDir(), "allowed_signers")
+	if err := ioutil.WriteFile(allowed, append([]byte("fsegit@example.com "), pub...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := fmt.Sprintf("[gpg]\n\tformat = ssh\n[gpg \"ssh\"]\n\tallowedSignersFile = %s\n[user]\n\tsigningkey = %s\n", allowed, key)
+	if err := ioutil.WriteFile(filepath.Join(dir, ".git", "config"), []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree := writeTestObject(t, dir, object.TreeObject, nil)
+	sig := object.Signature{Name: "fsegit", Email: "fsegit@example.com", When: time.Unix(1672531200, 0)}
+	commit := object.Commit{Tree: tree, Author: sig, Committer: sig, Message: "signed\n"}
+	signature, err := client.Sign(commit.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(signature, "-----BEGIN SSH SIGNATURE-----") {
+		t.Fatalf("Sign() = %q", signature)
+	}
+	commit.ExtraHeaders = []object.ExtraHeader{{Key: "gpgsig", Value: strings.TrimSuffix(signature, "\n")}}
+	signed, err := client.StoreRaw(object.CommitObject, commit.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.VerifyCommit(signed); err != nil {
+		t.Errorf("VerifyCommit() = %v", err)
+	}
+	commit.Message = "tampered\n"
+	tampered, err := client.StoreRaw(object.CommitObject, commit.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.VerifyCommit(tampered); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("VerifyCommit(tampered) = %v, want ErrBadSignature", err)
+	}
+	commit.ExtraHeaders = nil
+	unsigned, err := client.StoreRaw(object.CommitObject, commit.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.VerifyCommit(unsigned); !errors.Is(err, ErrNoSignature) {
+		t.Errorf("VerifyCommit(unsigned) = %v, want ErrNoSignature", err)
+	}
+
+	tagHash, _, err := client.CreateSignedTag("v1", signed, sig, "release\n", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj, err := client.GetObject(tagHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag, err := object.NewTag(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(tag.Message, "release\n-----BEGIN SSH SIGNATURE-----\n") {
+		t.Errorf("tag message = %q", tag.Message)
+	}
+	if _, err := client.VerifyTag(tagHash); err != nil {
+		t.Errorf("VerifyTag() = %v", err)
+	}
+}
+
+// チェックアウトやパッチの適用で、管理ディレクトリの中のファイルを書き換えたり消したりしないか
+func TestClient_WriteWorktreeEntry_GitDir(t *testing.T) {
+	dir := newTestRepository(t)
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := filepath.Join(client.GitDir(), "config")
+	before := []byte("[core]\n\tbare = false\n")
+	if err := ioutil.WriteFile(config, before, 0644); err != nil {
+		t.Fatal(err)
+	}
+	blob, err := client.StoreRaw(object.BlobObject, []byte("[core]\n\teditor = evil\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{".fsegit/config", ".FSEGIT/config", ".git/config", "sub/.Git/hooks/post-checkout"} {
+		if _, err := client.WriteWorktreeEntry(path, object.ModeBlob, blob); !errors.Is(err, ErrUnsafePath) {
+			t.Errorf("WriteWorktreeEntry(%q) = %v, want ErrUnsafePath", path, err)
+		}
+	}
+	if err := client.RemoveWorktreeFile(".fsegit/config"); !errors.Is(err, ErrUnsafePath) {
+		t.Errorf("RemoveWorktreeFile() = %v, want ErrUnsafePath", err)
+	}
+	for _, path := range []string{".fsegit/config", "../outside.txt"} {
+		patches, err := diff.ParsePatch([]byte("diff --git a/" + path + " b/" + path + "\nnew file mode 100644\n--- /dev/null\n+++ b/" + path + "\n@@ -0,0 +1 @@\n+evil\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := client.Apply(patches, ApplyOptions{}); !errors.Is(err, diff.ErrPatchFailed) {
+			t.Errorf("Apply() to %q = %v, want ErrPatchFailed", path, err)
+		}
+	}
+	if after, err := ioutil.ReadFile(config); err != nil || !bytes.Equal(after, before) {
+		t.Errorf("config was changed: %q, %v", after, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "..", "outside.txt")); !os.IsNotExist(err) {
+		t.Errorf("Apply() wrote outside the working tree")
+	}
+}
+
+// パッチを作業ツリーとインデックスに適用でき、適用できないパッチでは何も変えないか
+func TestClient_Apply(t *testing.T) {
+	dir := newTestRepository(t)
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("1\n2\n3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	patches, err := diff.ParsePatch([]byte(`diff --git a/a.txt b/b.txt
+rename from a.txt
+rename to b.txt
+--- a/a.txt
++++ b/b.txt
+@@ -1,3 +1,3 @@
+ 1
+-2
++two
+ 3
+diff --git a/new.txt b/new.txt
+new file mode 100644
+--- /dev/null
++++ b/new.txt
+@@ -0,0 +1 @@
++new
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Apply(patches, ApplyOptions{Check: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b.txt")); !os.IsNotExist(err) {
+		t.Errorf("Apply(Check) wrote b.txt")
+	}
+	if err := client.Apply(patches, ApplyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.txt")); !os.IsNotExist(err) {
+		t.Errorf("a.txt was not renamed")
+	}
+	for name, want := range map[string]string{"b.txt": "1\ntwo\n3\n", "new.txt": "new\n"} {
+		if data, err := ioutil.ReadFile(filepath.Join(dir, name)); err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v, want %q", name, data, err, want)
+		}
+	}
+	// 既に適用したパッチは、a.txtがないので適用できない. new.txtも作り直さない.
+	if err := client.Apply(patches, ApplyOptions{}); !errors.Is(err, diff.ErrPatchFailed) {
+		t.Errorf("Apply() again = %v, want ErrPatchFailed", err)
+	}
+
+	// インデックスに適用するときは作業ツリーに触れない.
+	blob, err := client.StoreRaw(object.BlobObject, []byte("1\n2\n3\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := NewIndex()
+	index.Add(&IndexEntry{Mode: object.ModeBlob, Hash: blob, Path: "a.txt"})
+	if err := client.WriteIndex(index); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Apply(patches, ApplyOptions{Cached: true}); err != nil {
+		t.Fatal(err)
+	}
+	if index, err = client.ReadIndex(); err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, entry := range index.Entries {
+		paths = append(paths, entry.Path)
+	}
+	if strings.Join(paths, ",") != "b.txt,new.txt" {
+		t.Errorf("index paths = %v, want [b.txt new.txt]", paths)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.txt")); !os.IsNotExist(err) {
+		t.Errorf("Apply(Cached) touched the working tree")
+	}
+
+	// Indexなら作業ツリーとインデックスの両方に適用する.
+	if err := client.Apply(patches[:1], ApplyOptions{Index: true, Check: true}); !errors.Is(err, diff.ErrPatchFailed) {
+		t.Errorf("Apply(Index) without a.txt in the working tree = %v, want ErrPatchFailed", err)
+	}
+	if err := os.Remove(filepath.Join(dir, "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("1\n2\n3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.WriteIndex(NewIndex()); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Apply(patches[:1], ApplyOptions{Index: true}); err != nil {
+		t.Fatal(err)
+	}
+	if index, err = client.ReadIndex(); err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Entries) != 1 || index.Entries[0].Path != "b.txt" {
+		t.Errorf("index entries after Apply(Index) = %v, want b.txt", index.Entries)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "b.txt")); err != nil || string(data) != "1\ntwo\n3\n" {
+		t.Errorf("b.txt = %q, %v after Apply(Index)", data, err)
+	}
+}
+
+func TestClient_DetectRenames(t *testing.T) {
+	dir := newTestRepository(t)
+	client, err := NewClient(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob := func(content string) sha.SHA1 {
+		hash, err := client.StoreRaw(object.BlobObject, []byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+	lines := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	changes := []TreeChange{
+		{Type: ChangeDelete, Path: "a.txt", OldMode: object.ModeBlob, OldHash: blob(lines)},
+		{Type: ChangeDelete, Path: "b.txt", OldMode: object.ModeBlob, OldHash: blob("same\n")},
+		{Type: ChangeDelete, Path: "gone.txt", OldMode: object.ModeBlob, OldHash: blob("unrelated\n")},
+		{Type: ChangeAdd, Path: "dir/a.txt", NewMode: object.ModeBlob, NewHash: blob(strings.Replace(lines, "5\n", "five\n", 1))},
+		{Type: ChangeAdd, Path: "link", NewMode: object.ModeSymlink, NewHash: blob("same\n")},
+		{Type: ChangeAdd, Path: "z.txt", NewMode: object.ModeBlob, NewHash: blob("same\n")},
+	}
+
+	renamed, err := client.DetectRenames(changes, DefaultRenameThreshold)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, change := range renamed {
+		s := change.Type.String() + " " + change.Path
+		if change.Type == ChangeRename {
+			s = fmt.Sprintf("R%d %s -> %s", change.Similarity, change.OldPath, change.Path)
+		}
+		got = append(got, s)
+	}
+	// シンボリックリンクは通常のファイルの名前の変更とみなさない.
+	want := []string{"R79 a.txt -> dir/a.txt", "D gone.txt", "A link", "R100 b.txt -> z.txt"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("DetectRenames() = %v, want %v", got, want)
+	}
+
+	if renamed, err = client.DetectRenames(changes, 95); err != nil {
+		t.Fatal(err)
+	}
+	if len(renamed) != 5 {
+		t.Errorf("DetectRenames(95) = %v, want only the exact rename", renamed)
+	}
 }
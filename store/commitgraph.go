@@ -0,0 +1,164 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/kanon1343/fsegit/commitgraph"
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/util"
+)
+
+// commitGraphPathはコミットグラフファイルのパスを返す.
+func (c *Client) commitGraphPath() string {
+	return filepath.Join(c.objectDir, "info", "commit-graph")
+}
+
+// commitGraphはコミットグラフファイルを初めて使うときに読み込んで返す. ファイルがないか、
+// core.commitGraphがfalseならnilを返す. gitと同じく、壊れたファイルは使わずにコミットオブジェクトを読む.
+func (c *Client) commitGraph() *commitgraph.Graph {
+	c.graphMu.Lock()
+	defer c.graphMu.Unlock()
+	if c.graphLoaded {
+		return c.graph
+	}
+	c.graphLoaded = true
+	// gitと同じく、浅いリポジトリではコミットグラフの親が実際の履歴と食い違うので使わない.
+	if shallow, err := c.ReadShallow(); err != nil || len(shallow) > 0 {
+		return nil
+	}
+	cfg, err := c.Config()
+	if err != nil {
+		return nil
+	}
+	if enabled, err := cfg.GetBool("core.commitgraph", true); err != nil || !enabled {
+		return nil
+	}
+	data, err := ioutil.ReadFile(util.LongPath(c.commitGraphPath()))
+	if err != nil {
+		return nil
+	}
+	if c.graph, err = commitgraph.Parse(data); err != nil {
+		c.graph = nil
+	}
+	return c.graph
+}
+
+// lookupCommitGraphはhashのコミットをコミットグラフから探す. なければnilを返す.
+func (c *Client) lookupCommitGraph(hash sha.SHA1) *commitgraph.Commit {
+	graph := c.commitGraph()
+	if graph == nil {
+		return nil
+	}
+	commit, ok, err := graph.Lookup(hash)
+	if err != nil || !ok {
+		return nil
+	}
+	return commit
+}
+
+// WriteCommitGraphは参照、HEAD、ORIG_HEADなどから辿れる全てのコミットでコミットグラフファイルを書き直し、
+// 書き込んだコミットの数を返す. 既にコミットグラフにあるコミットはオブジェクトを読まずにそこから写す.
+// 浅いリポジトリではファイルを削除して0を返す.
+func (c *Client) WriteCommitGraph() (int, error) {
+	return c.WriteCommitGraphContext(context.Background())
+}
+
+// WriteCommitGraphContextはWriteCommitGraphと同じだが、ctxが取り消されたらファイルを書き直さずにctx.Err()を返す.
+func (c *Client) WriteCommitGraphContext(ctx context.Context) (int, error) {
+	tips, err := c.reachabilityRoots()
+	if err != nil {
+		return 0, err
+	}
+	// 浅いリポジトリではコミットグラフを使わないので、書かずに古いファイルを削除する.
+	if shallow, err := c.IsShallow(); err != nil {
+		return 0, err
+	} else if shallow {
+		tips = nil
+	}
+
+	var commits []commitgraph.Commit
+	visited := map[string]struct{}{}
+	for len(tips) > 0 {
+		hash := tips[len(tips)-1]
+		tips = tips[:len(tips)-1]
+		if _, ok := visited[string(hash)]; ok {
+			continue
+		}
+		visited[string(hash)] = struct{}{}
+
+		if commit := c.lookupCommitGraph(hash); commit != nil {
+			commits = append(commits, *commit)
+			tips = append(tips, commit.Parents...)
+			continue
+		}
+		obj, err := c.GetObjectContext(ctx, hash)
+		if err != nil {
+			return 0, err
+		}
+		switch obj.Type {
+		case object.CommitObject:
+			commit, err := object.NewCommit(obj)
+			if err != nil {
+				return 0, &object.CorruptObjectError{Hash: hash, Err: err}
+			}
+			commits = append(commits, commitgraph.Commit{
+				Hash:       hash,
+				Tree:       commit.Tree,
+				Parents:    commit.Parents,
+				CommitTime: commit.Committer.When.Unix(),
+			})
+			tips = append(tips, commit.Parents...)
+		case object.TagObject:
+			tag, err := object.NewTag(obj)
+			if err != nil {
+				return 0, &object.CorruptObjectError{Hash: hash, Err: err}
+			}
+			tips = append(tips, tag.Object)
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	path := c.commitGraphPath()
+	if len(commits) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return 0, err
+		}
+		c.resetCommitGraph()
+		return 0, nil
+	}
+	var buf bytes.Buffer
+	if err := commitgraph.Write(&buf, commits); err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, err
+	}
+	lock, err := util.Lock(path, refLockTimeout)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := lock.Write(buf.Bytes()); err != nil {
+		lock.Rollback()
+		return 0, err
+	}
+	if err := lock.Commit(); err != nil {
+		return 0, err
+	}
+	c.resetCommitGraph()
+	return len(commits), nil
+}
+
+// resetCommitGraphは読み込んだコミットグラフを捨て、次に使うときに読み込み直すようにする.
+func (c *Client) resetCommitGraph() {
+	c.graphMu.Lock()
+	defer c.graphMu.Unlock()
+	c.graph = nil
+	c.graphLoaded = false
+}
@@ -0,0 +1,116 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+)
+
+// describeCandidatesはDescribeで距離を比べるタグの数の上限. gitの--candidatesの既定値と同じ.
+const describeCandidates = 10
+
+// DescribeOptionsはDescribeの設定.
+type DescribeOptions struct {
+	// Tagsなら注釈付きタグだけでなく軽量タグも使う.
+	Tags bool
+}
+
+// Descriptionはコミットを、そこから辿れる最も近いタグと、タグからの距離で表したもの.
+type Description struct {
+	// Tagはタグの名前(refs/tags/を除いたもの).
+	Tag string
+	// Distanceはコミットから辿れて、タグからは辿れないコミットの数. コミットにタグが付いていれば0.
+	Distance int
+	// Commitは表したコミットのハッシュ.
+	Commit sha.SHA1
+}
+
+// describeTagはコミットに付いたタグのうちDescribeで使うもの.
+type describeTag struct {
+	name      string
+	annotated bool
+	tagger    object.Signature
+}
+
+// betterはtがoより優先されるかを返す. gitと同じく注釈付きタグを軽量タグより、新しい注釈付きタグを古いものより優先する.
+func (t describeTag) better(o describeTag) bool {
+	if t.annotated != o.annotated {
+		return t.annotated
+	}
+	return t.annotated && t.tagger.When.After(o.tagger.When)
+}
+
+// Describeはhashのコミット(タグならそれが指すコミット)から辿れる注釈付きタグ(opts.Tagsなら軽量タグも)のうち、
+// 最も近いものを返す. gitと同じく、コミット日時の新しい順に辿って最初に見つかったdescribeCandidates個のタグから、
+// 距離の最も短いものを選ぶ. 距離が同じなら先に見つかったものを選ぶ. 使えるタグがなければErrNoDescriptionを返す.
+func (c *Client) Describe(hash sha.SHA1, opts DescribeOptions) (*Description, error) {
+	commit, err := c.PeelToCommit(hash)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := c.ListTags()
+	if err != nil {
+		return nil, err
+	}
+	tags := map[string]describeTag{}
+	for _, ref := range refs {
+		obj, err := c.GetObject(ref.Hash)
+		if err != nil {
+			return nil, err
+		}
+		tag := describeTag{name: strings.TrimPrefix(ref.Name, tagPrefix), annotated: obj.Type == object.TagObject}
+		if !tag.annotated && !opts.Tags {
+			continue
+		}
+		if tag.annotated {
+			t, err := object.NewTag(obj)
+			if err != nil {
+				return nil, err
+			}
+			tag.tagger = t.Tagger
+		}
+		// 木やブロブを指すタグはコミットを表せないので使わない.
+		target, err := c.PeelToCommit(ref.Hash)
+		if err != nil {
+			continue
+		}
+		if old, ok := tags[string(target)]; !ok || tag.better(old) {
+			tags[string(target)] = tag
+		}
+	}
+	if tag, ok := tags[string(commit)]; ok {
+		return &Description{Tag: tag.name, Commit: commit}, nil
+	}
+
+	var candidates []sha.SHA1
+	if len(tags) > 0 {
+		err = c.WalkHistory(commit, func(cm *object.Commit) error {
+			if _, ok := tags[string(cm.Hash)]; ok {
+				candidates = append(candidates, cm.Hash)
+				if len(candidates) == describeCandidates {
+					return object.ErrStopWalk
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("%w : %s", ErrNoDescription, commit)
+	}
+	var best *Description
+	for _, candidate := range candidates {
+		distance, err := c.RevListCount(RevListOptions{Include: []sha.SHA1{commit}, Exclude: []sha.SHA1{candidate}})
+		if err != nil {
+			return nil, err
+		}
+		if best == nil || distance < best.Distance {
+			best = &Description{Tag: tags[string(candidate)].name, Distance: distance, Commit: commit}
+		}
+	}
+	return best, nil
+}
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+)
+
+// ChangeTypeはツリー間のファイルの変更の種類.
+type ChangeType int
+
+const (
+	ChangeAdd ChangeType = iota
+	ChangeDelete
+	ChangeModify
+	// ChangeRenameはDetectRenamesで削除と追加の組をまとめた名前の変更.
+	ChangeRename
+)
+
+// Stringはgit diff --name-statusと同じ1文字の表記を返す.
+func (t ChangeType) String() string {
+	switch t {
+	case ChangeAdd:
+		return "A"
+	case ChangeDelete:
+		return "D"
+	case ChangeRename:
+		return "R"
+	default:
+		return "M"
+	}
+}
+
+// TreeChangeは2つのツリーの間で変更されたファイル. 追加ではOld、削除ではNewのフィールドが空になる.
+// 名前の変更ではPathが変更後の、OldPathが変更前のパスになる.
+type TreeChange struct {
+	Type    ChangeType
+	Path    string
+	OldMode object.FileMode
+	OldHash sha.SHA1
+	NewMode object.FileMode
+	NewHash sha.SHA1
+	// OldPathとSimilarity(内容の類似度、%)は名前の変更のときだけ設定する.
+	OldPath    string
+	Similarity int
+}
+
+// DiffTreesはoldからnewへのファイルの変更をパス順に返す. oldかnewがnilなら空のツリーとして扱う.
+func (c *Client) DiffTrees(old, new sha.SHA1, filter TreeFilter) ([]TreeChange, error) {
+	oldFiles := map[string]object.TreeEntry{}
+	if old != nil {
+		if err := c.WalkTree(old, filter, func(path string, entry object.TreeEntry) error {
+			oldFiles[path] = entry
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	var changes []TreeChange
+	if new != nil {
+		if err := c.WalkTree(new, filter, func(path string, entry object.TreeEntry) error {
+			oldEntry, ok := oldFiles[path]
+			delete(oldFiles, path)
+			switch {
+			case !ok:
+				changes = append(changes, TreeChange{Type: ChangeAdd, Path: path, NewMode: entry.Mode, NewHash: entry.Hash})
+			case !bytes.Equal(oldEntry.Hash, entry.Hash) || oldEntry.Mode != entry.Mode:
+				changes = append(changes, TreeChange{
+					Type:    ChangeModify,
+					Path:    path,
+					OldMode: oldEntry.Mode,
+					OldHash: oldEntry.Hash,
+					NewMode: entry.Mode,
+					NewHash: entry.Hash,
+				})
+			}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	for path, entry := range oldFiles {
+		changes = append(changes, TreeChange{Type: ChangeDelete, Path: path, OldMode: entry.Mode, OldHash: entry.Hash})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
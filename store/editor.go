@@ -0,0 +1,38 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// commitEditMsgFileはエディタで編集するコミットメッセージのファイル.
+const commitEditMsgFile = "COMMIT_EDITMSG"
+
+// defaultEditorはエディタが何も設定されていないときに使うコマンド.
+const defaultEditor = "vi"
+
+// Editorはメッセージを編集するエディタのコマンドを返す. gitと同じく環境変数GIT_EDITOR、設定のcore.editor、
+// 環境変数VISUAL、EDITORの順に探し、どれもなければviを返す. コマンドは引数を含むことがある.
+func (c *Client) Editor() (string, error) {
+	if editor := os.Getenv("GIT_EDITOR"); editor != "" {
+		return editor, nil
+	}
+	cfg, err := c.Config()
+	if err != nil {
+		return "", err
+	}
+	if editor, ok := cfg.Get("core.editor"); ok && editor != "" {
+		return editor, nil
+	}
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if editor := os.Getenv(name); editor != "" {
+			return editor, nil
+		}
+	}
+	return defaultEditor, nil
+}
+
+// CommitEditMsgPathはエディタで編集するコミットメッセージのファイル(COMMIT_EDITMSG)のパスを返す.
+func (c *Client) CommitEditMsgPath() string {
+	return filepath.Join(c.gitDir, commitEditMsgFile)
+}
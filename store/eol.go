@@ -0,0 +1,61 @@
+package store
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/kanon1343/fsegit/config"
+	"github.com/kanon1343/fsegit/diff"
+)
+
+// AutoCRLFは作業ツリーとブロブの間で改行コードを変換するか(core.autocrlf)を表す.
+type AutoCRLF int
+
+const (
+	// AutoCRLFFalseは改行コードを変換しない.
+	AutoCRLFFalse AutoCRLF = iota
+	// AutoCRLFTrueは取り出すときにLFをCRLFにし、追加するときにCRLFをLFに戻す.
+	AutoCRLFTrue
+	// AutoCRLFInputは追加するときにCRLFをLFにするだけで、取り出すときは変換しない.
+	AutoCRLFInput
+)
+
+// AutoCRLFはcore.autocrlfの設定を返す. 設定がなければAutoCRLFFalseを返す.
+func (c *Client) AutoCRLF() (AutoCRLF, error) {
+	cfg, err := c.Config()
+	if err != nil {
+		return AutoCRLFFalse, err
+	}
+	value, ok := cfg.Get("core.autocrlf")
+	if !ok {
+		return AutoCRLFFalse, nil
+	}
+	if strings.EqualFold(value, "input") {
+		return AutoCRLFInput, nil
+	}
+	b, err := config.ParseBool(value)
+	if err != nil || !b {
+		return AutoCRLFFalse, err
+	}
+	return AutoCRLFTrue, nil
+}
+
+// ConvertToLFはテキストのデータのCRLFをLFにする. バイナリのデータと、LFの前以外にCRがあるデータは
+// 変換すると元に戻せないのでそのまま返す.
+func ConvertToLF(data []byte) []byte {
+	if diff.IsBinary(data) || !bytes.Contains(data, []byte("\r\n")) {
+		return data
+	}
+	if bytes.Count(data, []byte("\r")) != bytes.Count(data, []byte("\r\n")) {
+		return data
+	}
+	return bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+}
+
+// ConvertToCRLFはテキストのデータのLFをCRLFにする. バイナリのデータと、既にCRを含むデータはそのまま返す.
+func ConvertToCRLF(data []byte) []byte {
+	if diff.IsBinary(data) || bytes.IndexByte(data, '\r') >= 0 || bytes.IndexByte(data, '\n') < 0 {
+		return data
+	}
+	return bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+}
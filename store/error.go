@@ -0,0 +1,71 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kanon1343/fsegit/sha"
+)
+
+var (
+	ErrRefNotFound      = errors.New("ref not found")
+	ErrInvalidRef       = errors.New("invalid ref")
+	ErrNotSymbolicRef   = errors.New("not a symbolic ref")
+	ErrSymrefTooDeep    = errors.New("symbolic ref nesting too deep")
+	ErrTreeTooDeep      = errors.New("tree nesting too deep")
+	ErrUnbornBranch     = errors.New("current branch does not have any commits yet")
+	ErrInvalidIndex     = errors.New("invalid index file")
+	ErrUnmerged         = errors.New("you have unmerged paths")
+	ErrPathConflict     = errors.New("path is used both as a file and a directory")
+	ErrNoWorkTree       = errors.New("this operation must be run in a work tree")
+	ErrWouldOverwrite   = errors.New("your local changes would be overwritten by checkout")
+	ErrInvalidRefName   = errors.New("invalid ref name")
+	ErrBranchExists     = errors.New("branch already exists")
+	ErrTagExists        = errors.New("tag already exists")
+	ErrNoMergeBase      = errors.New("no merge base")
+	ErrBranchNotMerged  = errors.New("branch is not fully merged")
+	ErrCurrentBranch    = errors.New("cannot delete the branch which you are currently on")
+	ErrRemoteNotFound   = errors.New("no such remote")
+	ErrRemoteExists     = errors.New("remote already exists")
+	ErrNoIdentity       = errors.New("identity unknown")
+	ErrInvalidDate      = errors.New("invalid date format")
+	ErrObjectNotFound   = errors.New("object not found")
+	ErrAmbiguousHash    = errors.New("short object ID is ambiguous")
+	ErrNoReflog         = errors.New("reflog does not exist")
+	ErrInvalidReflog    = errors.New("invalid reflog entry")
+	ErrReflogTooShort   = errors.New("reflog is too short")
+	ErrSoftResetInMerge = errors.New("cannot do a soft reset in the middle of a merge")
+	ErrNoStash          = errors.New("no stash entries found")
+	ErrInvalidStash     = errors.New("not a stash reference")
+	ErrRefChanged       = errors.New("ref has been changed")
+	ErrSizeMismatch     = errors.New("object size does not match")
+	ErrPathNotInCommit  = errors.New("no such path in the commit")
+	ErrSignFailed       = errors.New("failed to sign the data")
+	ErrNoSignature      = errors.New("no signature found")
+	ErrBadSignature     = errors.New("bad signature")
+	ErrNoDescription    = errors.New("no tags can describe the commit")
+	ErrNoNote           = errors.New("no note found for object")
+	ErrNoteExists       = errors.New("note already exists for object")
+	ErrUnsafePath       = errors.New("refusing to write inside the admin directory")
+)
+
+// AmbiguousHashErrorはハッシュの先頭の部分Prefixに複数のオブジェクトが一致したことを表す.
+// errors.IsでErrAmbiguousHashと判定できる.
+type AmbiguousHashError struct {
+	Prefix string
+	// Candidatesは一致したオブジェクトのハッシュ. ハッシュの順に並んでいる.
+	Candidates []sha.SHA1
+}
+
+func (e *AmbiguousHashError) Error() string {
+	candidates := make([]string, len(e.Candidates))
+	for i, hash := range e.Candidates {
+		candidates[i] = hash.String()
+	}
+	return fmt.Sprintf("%s : %s (%s)", ErrAmbiguousHash, e.Prefix, strings.Join(candidates, ", "))
+}
+
+func (e *AmbiguousHashError) Unwrap() error {
+	return ErrAmbiguousHash
+}
@@ -0,0 +1,381 @@
+package store
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/pack"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/util"
+)
+
+// FsckKindはFsckが見つけた問題の種類.
+type FsckKind int
+
+const (
+	// FsckCorruptは展開できないか、内容がハッシュと一致しないオブジェクトやパックファイル.
+	FsckCorrupt FsckKind = iota
+	// FsckBadObjectはコミット、ツリー、タグとして正しく読めないオブジェクト.
+	FsckBadObject
+	// FsckBrokenLinkはないオブジェクトを指しているオブジェクト. Targetに指している先が入る.
+	FsckBrokenLink
+	// FsckBadRefはないオブジェクトを指している参照やインデックス、reflog.
+	FsckBadRef
+	// FsckDanglingはどこからも辿れず、他のオブジェクトからも指されていないオブジェクト. 壊れてはいない.
+	FsckDangling
+)
+
+// FsckIssueはFsckが見つけた1つの問題.
+type FsckIssue struct {
+	Kind FsckKind
+	// TypeとHashは問題のあるオブジェクト. FsckBadRefでは指している先のオブジェクト.
+	Type object.Type
+	Hash sha.SHA1
+	// TargetTypeとTargetはFsckBrokenLinkで指している先のオブジェクト.
+	TargetType object.Type
+	Target     sha.SHA1
+	// Nameはオブジェクトのあるファイルや、FsckBadRefの参照の名前.
+	Name string
+	// Detailは問題の説明.
+	Detail string
+}
+
+// IsErrorは問題がリポジトリの破損を表すかを返す. 辿れないだけのオブジェクトは破損ではない.
+func (i FsckIssue) IsError() bool {
+	return i.Kind != FsckDangling
+}
+
+// fsckObjectはFsckで読んだオブジェクトの種類と、そのオブジェクトが指している先.
+type fsckObject struct {
+	objectType object.Type
+	links      []fsckLink
+}
+
+type fsckLink struct {
+	objectType object.Type
+	hash       sha.SHA1
+}
+
+// Fsckはルースオブジェクトとパックの全てのオブジェクトを展開してハッシュを計算し直し、コミット、ツリー、タグの
+// 書式と指している先があるかを調べる. 参照、特別な参照、インデックス、reflogから辿れないオブジェクトのうち、
+// 他のオブジェクトからも指されていないものは辿れないオブジェクトとして返す. 問題はハッシュの順に並べて返す.
+func (c *Client) Fsck() ([]FsckIssue, error) {
+	shallow, err := c.shallowCommits()
+	if err != nil {
+		return nil, err
+	}
+	var issues []FsckIssue
+	objects := map[string]*fsckObject{}
+	check := func(obj *object.Object, name string) {
+		if _, ok := objects[string(obj.Hash)]; ok {
+			return
+		}
+		checked := &fsckObject{objectType: obj.Type}
+		links, err := fsckLinks(obj)
+		if err != nil {
+			issues = append(issues, FsckIssue{Kind: FsckBadObject, Type: obj.Type, Hash: obj.Hash, Name: name, Detail: err.Error()})
+		}
+		// 浅い履歴の境界のコミットの親は手元にないので、ツリーだけを指しているものとする.
+		if _, ok := shallow[string(obj.Hash)]; ok && len(links) > 0 {
+			links = links[:1]
+		}
+		checked.links = links
+		objects[string(obj.Hash)] = checked
+	}
+
+	loose, err := c.fsckLooseObjects(check)
+	if err != nil {
+		return nil, err
+	}
+	issues = append(issues, loose...)
+	packed, err := c.fsckPacks(check)
+	if err != nil {
+		return nil, err
+	}
+	issues = append(issues, packed...)
+
+	// 指している先があるかを調べる.
+	referenced := map[string]struct{}{}
+	for key, obj := range objects {
+		for _, link := range obj.links {
+			referenced[string(link.hash)] = struct{}{}
+			if _, ok := objects[string(link.hash)]; !ok {
+				issues = append(issues, FsckIssue{
+					Kind:       FsckBrokenLink,
+					Type:       obj.objectType,
+					Hash:       sha.SHA1(key),
+					TargetType: link.objectType,
+					Target:     link.hash,
+				})
+			}
+		}
+	}
+
+	roots, err := c.fsckRoots()
+	if err != nil {
+		return nil, err
+	}
+	reachable := map[string]struct{}{}
+	var stack []sha.SHA1
+	for _, root := range roots {
+		if _, ok := objects[string(root.Hash)]; !ok {
+			issues = append(issues, FsckIssue{Kind: FsckBadRef, Hash: root.Hash, Name: root.Name, Detail: "invalid sha1 pointer"})
+			continue
+		}
+		stack = append(stack, root.Hash)
+	}
+	for len(stack) > 0 {
+		hash := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if _, ok := reachable[string(hash)]; ok {
+			continue
+		}
+		obj, ok := objects[string(hash)]
+		if !ok {
+			continue
+		}
+		reachable[string(hash)] = struct{}{}
+		for _, link := range obj.links {
+			stack = append(stack, link.hash)
+		}
+	}
+	for key, obj := range objects {
+		_, isReachable := reachable[key]
+		_, isReferenced := referenced[key]
+		if !isReachable && !isReferenced {
+			issues = append(issues, FsckIssue{Kind: FsckDangling, Type: obj.objectType, Hash: sha.SHA1(key)})
+		}
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		if c := bytes.Compare(issues[i].Hash, issues[j].Hash); c != 0 {
+			return c < 0
+		}
+		return issues[i].Kind < issues[j].Kind
+	})
+	return issues, nil
+}
+
+// fsckLinksはobjの書式を調べ、指しているオブジェクトを返す. gitlinkはサブモジュールのコミットなので含めない.
+func fsckLinks(obj *object.Object) ([]fsckLink, error) {
+	switch obj.Type {
+	case object.CommitObject:
+		commit, err := object.NewCommit(obj)
+		if err != nil {
+			return nil, err
+		}
+		if commit.Tree == nil {
+			return nil, fmt.Errorf("%w : missing tree", object.ErrInvalidCommitObject)
+		}
+		links := []fsckLink{{object.TreeObject, commit.Tree}}
+		for _, parent := range commit.Parents {
+			links = append(links, fsckLink{object.CommitObject, parent})
+		}
+		return links, nil
+	case object.TreeObject:
+		tree, err := object.NewTree(obj)
+		if err != nil {
+			return nil, err
+		}
+		var links []fsckLink
+		for i, entry := range tree.Entries {
+			if i > 0 && fsckTreeKey(tree.Entries[i-1]) >= fsckTreeKey(entry) {
+				return nil, fmt.Errorf("%w : entries not sorted or duplicated at %q", object.ErrInvalidTreeObject, entry.Name)
+			}
+			if entry.Mode != object.ModeGitlink {
+				links = append(links, fsckLink{entry.Mode.ObjectType(), entry.Hash})
+			}
+		}
+		return links, nil
+	case object.TagObject:
+		tag, err := object.NewTag(obj)
+		if err != nil {
+			return nil, err
+		}
+		if tag.Object == nil || tag.Name == "" {
+			return nil, fmt.Errorf("%w : missing object or tag header", object.ErrInvalidTagObject)
+		}
+		return []fsckLink{{tag.ObjectType, tag.Object}}, nil
+	}
+	return nil, nil
+}
+
+// fsckTreeKeyはツリーのエントリの並び順を決める名前を返す. gitと同じくディレクトリは末尾に"/"があるものとして比べる.
+func fsckTreeKey(entry object.TreeEntry) string {
+	if entry.Mode.IsTree() {
+		return entry.Name + "/"
+	}
+	return entry.Name
+}
+
+// fsckLooseObjectsは全てのルースオブジェクトを展開してハッシュを確かめ、正しく読めたものをcheckに渡す.
+func (c *Client) fsckLooseObjects(check func(obj *object.Object, name string)) ([]FsckIssue, error) {
+	var issues []FsckIssue
+	err := c.forEachLooseObject(func(hash sha.SHA1, path string) error {
+		obj, err := readLooseObjectFile(path)
+		switch {
+		case err != nil:
+			issues = append(issues, FsckIssue{Kind: FsckCorrupt, Hash: hash, Name: path, Detail: err.Error()})
+		case !bytes.Equal(obj.Hash, hash):
+			issues = append(issues, FsckIssue{Kind: FsckCorrupt, Type: obj.Type, Hash: hash, Name: path, Detail: "sha1 mismatch"})
+		default:
+			check(obj, path)
+		}
+		return nil
+	})
+	return issues, err
+}
+
+func readLooseObjectFile(path string) (*object.Object, error) {
+	f, err := os.Open(util.LongPath(path))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := zlib.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := object.ReadObject(zr)
+	if err != nil {
+		return nil, err
+	}
+	// zlibのチェックサムまで読んで、圧縮されたデータが最後まで壊れていないかを確かめる.
+	if _, err := io.Copy(ioutil.Discard, zr); err != nil {
+		return nil, err
+	}
+	return obj, zr.Close()
+}
+
+// fsckPacksは全てのパックファイルのチェックサムと、含まれる全てのオブジェクトを確かめ、正しく読めたものをcheckに渡す.
+func (c *Client) fsckPacks(check func(obj *object.Object, name string)) ([]FsckIssue, error) {
+	c.packMu.Lock()
+	defer c.packMu.Unlock()
+	if err := c.loadPacks(); err != nil {
+		return nil, err
+	}
+	var issues []FsckIssue
+	for _, p := range c.packs {
+		if err := verifyPackChecksum(p); err != nil {
+			issues = append(issues, FsckIssue{Kind: FsckCorrupt, Hash: p.Index().PackChecksum, Name: p.Path(), Detail: err.Error()})
+			continue
+		}
+		for _, entry := range p.Index().Entries() {
+			obj, err := p.Get(entry.Hash)
+			if err != nil {
+				issues = append(issues, FsckIssue{Kind: FsckCorrupt, Hash: entry.Hash, Name: p.Path(), Detail: err.Error()})
+				continue
+			}
+			check(obj, p.Path())
+		}
+	}
+	return issues, nil
+}
+
+// verifyPackChecksumはパックファイルの末尾のチェックサムが内容と索引の記録に一致するかを確かめる.
+func verifyPackChecksum(p *pack.Pack) error {
+	f, err := os.Open(util.LongPath(p.Path()))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() < sha1.Size {
+		return fmt.Errorf("%w : too short", pack.ErrInvalidPack)
+	}
+	h := sha1.New()
+	if _, err := io.CopyN(h, f, info.Size()-sha1.Size); err != nil {
+		return err
+	}
+	trailer := make([]byte, sha1.Size)
+	if _, err := io.ReadFull(f, trailer); err != nil {
+		return err
+	}
+	if sum := h.Sum(nil); !bytes.Equal(sum, trailer) || !bytes.Equal(sum, p.Index().PackChecksum) {
+		return fmt.Errorf("%w : pack checksum mismatch", pack.ErrInvalidPack)
+	}
+	return nil
+}
+
+// fsckRootは辿り始めるオブジェクトと、それを指している参照などの名前.
+type fsckRoot struct {
+	Name string
+	Hash sha.SHA1
+}
+
+// fsckRootsは参照、HEADとORIG_HEADなどの特別な参照、インデックス、reflogの全ての行が指すオブジェクトを返す.
+func (c *Client) fsckRoots() ([]fsckRoot, error) {
+	var roots []fsckRoot
+	refs, err := c.ListRefs("refs/")
+	if err != nil {
+		return nil, err
+	}
+	names := []string{"HEAD", OrigHead}
+	for _, ref := range refs {
+		roots = append(roots, fsckRoot{ref.Name, ref.Hash})
+		names = append(names, ref.Name)
+	}
+	for _, name := range []string{"HEAD", OrigHead} {
+		hash, err := c.ResolveRef(name)
+		if errors.Is(err, ErrRefNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, fsckRoot{name, hash})
+	}
+	mergeHeads, err := c.ReadMergeHeads()
+	if err != nil {
+		return nil, err
+	}
+	for _, hash := range mergeHeads {
+		roots = append(roots, fsckRoot{MergeHead, hash})
+	}
+	if fetchHeads, err := c.ReadFetchHead(); err == nil {
+		for _, entry := range fetchHeads {
+			roots = append(roots, fsckRoot{FetchHead, entry.Hash})
+		}
+	} else if !errors.Is(err, ErrRefNotFound) {
+		return nil, err
+	}
+
+	for _, name := range names {
+		entries, err := c.ReadReflog(name)
+		if errors.Is(err, ErrNoReflog) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for i, entry := range entries {
+			if !bytes.Equal(entry.New, zeroHash) {
+				roots = append(roots, fsckRoot{fmt.Sprintf("%s@{%d}", name, i), entry.New})
+			}
+		}
+	}
+
+	if !c.IsBare() {
+		index, err := c.ReadIndex()
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range index.Entries {
+			if entry.Mode != object.ModeGitlink {
+				roots = append(roots, fsckRoot{"index:" + entry.Path, entry.Hash})
+			}
+		}
+	}
+	return roots, nil
+}
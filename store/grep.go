@@ -0,0 +1,102 @@
+package store
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/kanon1343/fsegit/diff"
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+)
+
+// GrepOptionsはGrepの設定.
+type GrepOptions struct {
+	// Treeは検索するツリーかコミット. nilならインデックスに登録されたファイルを検索する.
+	Tree sha.SHA1
+	// FirstMatchOnlyならファイルごとに最初にマッチした行だけを返す.
+	FirstMatchOnly bool
+}
+
+// GrepMatchはGrepでマッチした1行.
+type GrepMatch struct {
+	// Pathは作業ツリーのルートからの"/"区切りのパス.
+	Path string
+	// Lineは1から数えた行番号.
+	Line int
+	// Textは改行を除いた行の内容. Binaryなら空.
+	Text string
+	// Binaryはファイルがバイナリであることを表す. バイナリのファイルは最初にマッチしたところで1つだけ返す.
+	Binary bool
+}
+
+// GrepMatchFuncはGrepでマッチした行ごとに呼ばれる. エラーを返すとGrepはそこでやめてそのエラーを返す.
+type GrepMatchFunc func(match GrepMatch) error
+
+// Grepはインデックスかopts.Treeのファイルからreにマッチする行を探し、パスの順にfnに渡す.
+// ブロブは全体を読み込まずにOpenObjectで1行ずつ展開して調べる. gitlinkとコンフリクト中のエントリは調べない.
+func (c *Client) Grep(re *regexp.Regexp, opts GrepOptions, fn GrepMatchFunc) error {
+	if opts.Tree != nil {
+		return c.WalkTree(opts.Tree, nil, func(path string, entry object.TreeEntry) error {
+			if entry.Mode == object.ModeGitlink {
+				return nil
+			}
+			return c.grepBlob(re, path, entry.Hash, opts.FirstMatchOnly, fn)
+		})
+	}
+	index, err := c.ReadIndex()
+	if err != nil {
+		return err
+	}
+	for _, entry := range index.Entries {
+		if entry.Stage != 0 || entry.Mode == object.ModeGitlink {
+			continue
+		}
+		if err := c.grepBlob(re, entry.Path, entry.Hash, opts.FirstMatchOnly, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// grepBlobはhashのブロブを1行ずつ読んでreにマッチする行をfnに渡す.
+func (c *Client) grepBlob(re *regexp.Regexp, path string, hash sha.SHA1, firstOnly bool, fn GrepMatchFunc) error {
+	r, err := c.OpenObject(hash)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	// diff.IsBinaryと同じく先頭の8000バイトでバイナリかを判定する.
+	br := bufio.NewReaderSize(r, 8000)
+	head, err := br.Peek(8000)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return err
+	}
+	binary := diff.IsBinary(head)
+
+	for line := 1; ; line++ {
+		text, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if text == "" && err == io.EOF {
+			return nil
+		}
+		text = strings.TrimSuffix(text, "\n")
+		if re.MatchString(text) {
+			if binary {
+				return fn(GrepMatch{Path: path, Line: line, Binary: true})
+			}
+			if err := fn(GrepMatch{Path: path, Line: line, Text: text}); err != nil {
+				return err
+			}
+			if firstOnly {
+				return nil
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
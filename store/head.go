@@ -0,0 +1,169 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+)
+
+// Headは現在チェックアウトしているブランチとコミット.
+type Head struct {
+	// BranchはHEADが指すブランチの完全な名前(refs/heads/main). HEADがハッシュを直接持つ場合は空.
+	Branch string
+	// Hashはチェックアウトしているコミット. ブランチにまだコミットがなければnil.
+	Hash sha.SHA1
+}
+
+// Unbornはブランチにまだコミットがないかを返す.
+func (h *Head) Unborn() bool {
+	return h.Hash == nil
+}
+
+// DetachedはHEADがブランチではなくコミットを直接指しているかを返す.
+func (h *Head) Detached() bool {
+	return h.Branch == ""
+}
+
+// ShortBranchはブランチ名からrefs/heads/を除いた名前を返す.
+func (h *Head) ShortBranch() string {
+	return strings.TrimPrefix(h.Branch, "refs/heads/")
+}
+
+// Parentsは次のコミットの親を返す. 最初のコミットには親がない.
+func (h *Head) Parents() []sha.SHA1 {
+	if h.Unborn() {
+		return nil
+	}
+	return []sha.SHA1{h.Hash}
+}
+
+// ReadHeadはHEADを読み、指しているブランチとコミットを返す.
+// ブランチの参照ファイルがまだない(最初のコミット前の)場合はエラーにせずHashをnilにする.
+func (c *Client) ReadHead() (*Head, error) {
+	ref, err := c.ReadRef("HEAD")
+	if err != nil {
+		return nil, err
+	}
+	if ref.Target == "" {
+		return &Head{Hash: ref.Hash}, nil
+	}
+
+	head := &Head{Branch: ref.Target}
+	hash, err := c.ResolveRef(ref.Target)
+	if errors.Is(err, ErrRefNotFound) {
+		return head, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	head.Hash = hash
+	return head, nil
+}
+
+// ResolveHeadCommitはHEADが指すコミットを返す. ブランチにコミットがなければErrUnbornBranchを返す.
+func (c *Client) ResolveHeadCommit() (sha.SHA1, error) {
+	head, err := c.ReadHead()
+	if err != nil {
+		return nil, err
+	}
+	if head.Unborn() {
+		return nil, fmt.Errorf("%w : %s", ErrUnbornBranch, head.ShortBranch())
+	}
+	return head.Hash, nil
+}
+
+// DetachHeadはHEADがhashのコミットを直接指すようにし、messageをHEADのreflogに記録する.
+// タグを渡した場合はコミットまで辿る.
+func (c *Client) DetachHead(hash sha.SHA1, message string) error {
+	commit, err := c.PeelToCommit(hash)
+	if err != nil {
+		return err
+	}
+	// HEADがまだなければ、作られたものとして記録する.
+	old := &Head{}
+	if head, err := c.ReadHead(); err == nil {
+		old = head
+	} else if !errors.Is(err, ErrRefNotFound) {
+		return err
+	}
+	if err := c.WriteRef("HEAD", commit); err != nil {
+		return err
+	}
+	return c.AppendReflog("HEAD", old.Hash, commit, message)
+}
+
+// UpdateHeadは新しいコミットhashをHEADに記録する. ブランチ上ならブランチを進め、
+// HEADが切り離されていればHEADそのものを書き換える. どちらの場合もmessageをreflogに残す.
+func (c *Client) UpdateHead(hash sha.SHA1, message string) error {
+	head, err := c.ReadHead()
+	if err != nil {
+		return err
+	}
+	if head.Detached() {
+		return c.UpdateRef("HEAD", hash, message)
+	}
+	return c.UpdateRef(head.Branch, hash, message)
+}
+
+// PeelToCommitはタグを辿ってコミットのハッシュを返す. コミット以外を指している場合はErrNotCommitObjectを返す.
+func (c *Client) PeelToCommit(hash sha.SHA1) (sha.SHA1, error) {
+	for {
+		obj, err := c.GetObject(hash)
+		if err != nil {
+			return nil, err
+		}
+		switch obj.Type {
+		case object.CommitObject:
+			return hash, nil
+		case object.TagObject:
+			tag, err := object.NewTag(obj)
+			if err != nil {
+				return nil, err
+			}
+			hash = tag.Object
+		default:
+			return nil, fmt.Errorf("%w : %s", object.ErrNotCommitObject, hash)
+		}
+	}
+}
+
+// OrphanedCommitsはfromから辿れるが、どの参照(refs/以下)からも辿れないコミットを新しい順に返す.
+// 切り離されたHEADから別の場所に移るときに、失われるコミットを警告するのに使う.
+func (c *Client) OrphanedCommits(from sha.SHA1) ([]*object.Commit, error) {
+	refs, err := c.ListRefs("refs/")
+	if err != nil {
+		return nil, err
+	}
+	var tips []sha.SHA1
+	for _, ref := range refs {
+		// タグがツリーやブロブを指している場合は無視する.
+		if tip, err := c.PeelToCommit(ref.Hash); err == nil {
+			tips = append(tips, tip)
+		}
+	}
+	reachable := map[string]struct{}{}
+	if err := c.WalkHistoryReverse(tips, nil, func(commit *object.Commit) error {
+		reachable[string(commit.Hash)] = struct{}{}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	var orphaned []*object.Commit
+	if err := c.WalkHistoryReverse([]sha.SHA1{from}, func(hash sha.SHA1) bool {
+		_, ok := reachable[string(hash)]
+		return ok
+	}, func(commit *object.Commit) error {
+		orphaned = append(orphaned, commit)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(orphaned)-1; i < j; i, j = i+1, j-1 {
+		orphaned[i], orphaned[j] = orphaned[j], orphaned[i]
+	}
+	return orphaned, nil
+}
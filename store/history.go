@@ -0,0 +1,259 @@
+package store
+
+import (
+	"container/heap"
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+)
+
+// TopoSortHistoryはtipsから辿れる全てのコミットを、子が必ず親より先になる順で返す.
+// gitの--topo-orderと同じく、別々の系統のコミットが入り混じらないように、コミットを並べたら
+// 次はその親(マージでは後ろの親)から並べる. 系統の先頭はコミット日時の新しいものを先にする.
+//
+// filterを指定すると、gitと同じように履歴を単純化して、filterにマッチするファイルを変えたコミットだけを返す.
+// 親のどれかとマッチするファイルが同じ(TREESAME)コミットは返さず、マージではその親の側だけを辿る.
+// 返すコミットのParentsは、返すコミットのうち最も近い祖先に書き換えてある.
+func (c *Client) TopoSortHistory(tips []sha.SHA1, filter TreeFilter) ([]*object.Commit, error) {
+	return c.TopoSortHistoryContext(context.Background(), tips, filter)
+}
+
+// TopoSortHistoryContextはTopoSortHistoryと同じだが、ctxが取り消されたらそこで辿るのをやめてctx.Err()を返す.
+func (c *Client) TopoSortHistoryContext(ctx context.Context, tips []sha.SHA1, filter TreeFilter) ([]*object.Commit, error) {
+	commits := map[string]*object.Commit{}
+	shown := map[string]bool{}
+	queue := append([]sha.SHA1{}, tips...)
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		if _, ok := commits[string(hash)]; ok {
+			continue
+		}
+		commit, err := c.GetCommitContext(ctx, hash)
+		if err != nil {
+			return nil, err
+		}
+		show := true
+		if filter != nil {
+			if show, commit.Parents, err = c.simplifyCommit(commit, filter); err != nil {
+				return nil, err
+			}
+		}
+		commits[string(hash)] = commit
+		shown[string(hash)] = show
+		queue = append(queue, commit.Parents...)
+	}
+
+	sorted := topoSort(commits)
+	if filter == nil {
+		return sorted, nil
+	}
+
+	// 古いコミットから順に、返さないコミットを飛ばした親を求める.
+	rewritten := map[string][]sha.SHA1{}
+	for i := len(sorted) - 1; i >= 0; i-- {
+		commit := sorted[i]
+		var parents []sha.SHA1
+		seen := map[string]struct{}{}
+		for _, parent := range commit.Parents {
+			candidates := rewritten[string(parent)]
+			if shown[string(parent)] {
+				candidates = []sha.SHA1{parent}
+			}
+			for _, candidate := range candidates {
+				if _, ok := seen[string(candidate)]; !ok {
+					seen[string(candidate)] = struct{}{}
+					parents = append(parents, candidate)
+				}
+			}
+		}
+		rewritten[string(commit.Hash)] = parents
+	}
+	var result []*object.Commit
+	for _, commit := range sorted {
+		if shown[string(commit.Hash)] {
+			simplified := *commit
+			simplified.Parents = rewritten[string(commit.Hash)]
+			result = append(result, &simplified)
+		}
+	}
+	return result, nil
+}
+
+// simplifyCommitはcommitを返すかと、辿る親を返す. filterにマッチするファイルが親のどれかと同じなら、
+// そのコミットは返さずにその親だけを辿る. 根のコミットはマッチするファイルがあれば返す.
+func (c *Client) simplifyCommit(commit *object.Commit, filter TreeFilter) (bool, []sha.SHA1, error) {
+	if len(commit.Parents) == 0 {
+		changes, err := c.DiffTrees(nil, commit.Hash, filter)
+		return len(changes) > 0, nil, err
+	}
+	for _, parent := range commit.Parents {
+		changes, err := c.DiffTrees(parent, commit.Hash, filter)
+		if err != nil {
+			return false, nil, err
+		}
+		if len(changes) == 0 {
+			return false, []sha.SHA1{parent}, nil
+		}
+	}
+	return true, commit.Parents, nil
+}
+
+// FollowHistoryContextはhashから辿れるコミットのうち、pathのファイルを親のどれとも違う内容にしたコミットを
+// opts.Orderの順にwalkFuncに適用する(git log --follow). コミットでpathが最初の親から追加されていれば、
+// そのコミットの変更から類似度がthreshold(%)以上の名前の変更を探し、見つかれば以降は変更前のパスを辿る.
+// 辿るパスは1つだけなので、枝によって名前が違う履歴では、先に辿った枝での名前の変更が他の枝にも及ぶ.
+func (c *Client) FollowHistoryContext(ctx context.Context, hash sha.SHA1, path string, threshold int, opts WalkHistoryOpts, walkFunc WalkFunc) error {
+	return c.WalkHistoryContext(ctx, hash, opts, func(commit *object.Commit) error {
+		filter := pathFilter(path)
+		if len(commit.Parents) == 0 {
+			changes, err := c.DiffTrees(nil, commit.Hash, filter)
+			if err != nil || len(changes) == 0 {
+				return err
+			}
+			return walkFunc(commit)
+		}
+		var first []TreeChange
+		for i, parent := range commit.Parents {
+			changes, err := c.DiffTrees(parent, commit.Hash, filter)
+			if err != nil {
+				return err
+			}
+			if len(changes) == 0 {
+				return nil
+			}
+			if i == 0 {
+				first = changes
+			}
+		}
+		if first[0].Type == ChangeAdd {
+			changes, err := c.DiffTrees(commit.Parents[0], commit.Hash, nil)
+			if err != nil {
+				return err
+			}
+			if changes, err = c.DetectRenames(changes, threshold); err != nil {
+				return err
+			}
+			for _, change := range changes {
+				if change.Type == ChangeRename && change.Path == path {
+					path = change.OldPath
+					break
+				}
+			}
+		}
+		return walkFunc(commit)
+	})
+}
+
+// pathFilterは1つのパスのファイルだけにマッチするTreeFilter.
+type pathFilter string
+
+func (f pathFilter) Match(path string) bool {
+	return path == string(f)
+}
+
+func (f pathFilter) MatchDir(dir string) bool {
+	return strings.HasPrefix(string(f), dir+"/")
+}
+
+// topoSortはcommitsを子が親より先になる順に並べる. commitsにない親は無視する.
+func topoSort(commits map[string]*object.Commit) []*object.Commit {
+	children := map[string]int{}
+	for _, commit := range commits {
+		for _, parent := range commit.Parents {
+			children[string(parent)]++
+		}
+	}
+
+	// 子が全て並んだコミットを積み、最後に積んだものから取り出す.
+	var stack []*object.Commit
+	for hash, commit := range commits {
+		if children[hash] == 0 {
+			stack = append(stack, commit)
+		}
+	}
+	sort.Slice(stack, func(i, j int) bool {
+		a, b := stack[i].Committer.When, stack[j].Committer.When
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return string(stack[i].Hash) > string(stack[j].Hash)
+	})
+	sorted := make([]*object.Commit, 0, len(commits))
+	for len(stack) > 0 {
+		commit := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		sorted = append(sorted, commit)
+		for _, parent := range commit.Parents {
+			children[string(parent)]--
+			if parentCommit, ok := commits[string(parent)]; ok && children[string(parent)] == 0 {
+				stack = append(stack, parentCommit)
+			}
+		}
+	}
+	return sorted
+}
+
+// walkByDateはhashから辿れるコミットを、読み込んだコミットのうち日時の最も新しいものから順にwalkFuncに適用する.
+// 日時が同じなら先に見つけたものを先にする.
+func (c *Client) walkByDate(ctx context.Context, hash sha.SHA1, walkFunc WalkFunc) error {
+	seen := map[string]struct{}{}
+	queue := &dateQueue{}
+	push := func(hash sha.SHA1) error {
+		if _, ok := seen[string(hash)]; ok {
+			return nil
+		}
+		seen[string(hash)] = struct{}{}
+		commit, err := c.GetCommitContext(ctx, hash)
+		if err != nil {
+			return err
+		}
+		heap.Push(queue, datedCommit{commit: commit, seq: len(seen)})
+		return nil
+	}
+
+	if err := push(hash); err != nil {
+		return err
+	}
+	for queue.Len() > 0 {
+		current := heap.Pop(queue).(datedCommit).commit
+		if err := walkFunc(current); err != nil {
+			return err
+		}
+		for _, parent := range current.Parents {
+			if err := push(parent); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// datedCommitはコミット日時の新しい順に取り出すコミット. seqは見つけた順番.
+type datedCommit struct {
+	commit *object.Commit
+	seq    int
+}
+
+// dateQueueはcontainer/heapで使う、コミット日時の新しいコミットから取り出す優先度付きキュー.
+type dateQueue []datedCommit
+
+func (q dateQueue) Len() int { return len(q) }
+func (q dateQueue) Less(i, j int) bool {
+	a, b := q[i].commit.Committer.When, q[j].commit.Committer.When
+	if !a.Equal(b) {
+		return a.After(b)
+	}
+	return q[i].seq < q[j].seq
+}
+func (q dateQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *dateQueue) Push(x interface{}) { *q = append(*q, x.(datedCommit)) }
+func (q *dateQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
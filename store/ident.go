@@ -0,0 +1,105 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kanon1343/fsegit/object"
+)
+
+// IdentKindは署名が作者のものかコミッターのものかを表す.
+type IdentKind string
+
+const (
+	Author    IdentKind = "author"
+	Committer IdentKind = "committer"
+)
+
+// Identityはkindの署名を作る. 名前とメールアドレスは環境変数GIT_AUTHOR_NAME(コミッターならGIT_COMMITTER_NAME)などを優先し、
+// なければ設定のauthor.name(committer.name)、user.nameの順に探す. メールアドレスは最後に環境変数EMAILも見る.
+// 日時は環境変数GIT_AUTHOR_DATEなどがあればその日時、なければ現在の日時にする.
+// 名前かメールアドレスが分からなければErrNoIdentityを返す.
+func (c *Client) Identity(kind IdentKind) (object.Signature, error) {
+	cfg, err := c.Config()
+	if err != nil {
+		return object.Signature{}, err
+	}
+	env := "GIT_" + strings.ToUpper(string(kind)) + "_"
+	lookup := func(envName, key, fallbackEnv string) (string, bool) {
+		if value, ok := os.LookupEnv(env + envName); ok {
+			return value, true
+		}
+		if value, ok := cfg.Get(string(kind) + "." + key); ok {
+			return value, true
+		}
+		if value, ok := cfg.Get("user." + key); ok {
+			return value, true
+		}
+		if fallbackEnv != "" {
+			return os.LookupEnv(fallbackEnv)
+		}
+		return "", false
+	}
+
+	name, ok := lookup("NAME", "name", "")
+	if !ok {
+		return object.Signature{}, fmt.Errorf("%w : %s name is not set", ErrNoIdentity, kind)
+	}
+	email, ok := lookup("EMAIL", "email", "EMAIL")
+	if !ok {
+		return object.Signature{}, fmt.Errorf("%w : %s email is not set", ErrNoIdentity, kind)
+	}
+	name, email = strings.TrimSpace(name), strings.TrimSpace(email)
+	if name == "" {
+		return object.Signature{}, fmt.Errorf("%w : empty ident name not allowed", ErrNoIdentity)
+	}
+	// "<"と">"はメールアドレスの区切りなので、gitと同じく取り除く.
+	strip := strings.NewReplacer("<", "", ">", "", "\n", "")
+	name, email = strip.Replace(name), strip.Replace(email)
+
+	timestamp := time.Now()
+	if date, ok := os.LookupEnv(env + "DATE"); ok && date != "" {
+		if timestamp, err = ParseDate(date); err != nil {
+			return object.Signature{}, err
+		}
+	}
+	return object.Signature{Name: name, Email: email, When: timestamp}, nil
+}
+
+// dateLayoutsはParseDateが受け付ける、Unix時刻以外の日時の形式.
+var dateLayouts = []string{
+	time.RFC1123Z,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+}
+
+// ParseDateはGIT_AUTHOR_DATEなどに書く日時を読む. gitの内部形式("<Unix時刻> <+hhmm>"、先頭に"@"も可)と
+// RFC 2822、ISO 8601の形式を受け付ける. タイムゾーンのない形式は地方時とみなす.
+func ParseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	fields := strings.Fields(strings.TrimPrefix(s, "@"))
+	if len(fields) >= 1 && len(fields) <= 2 {
+		if unixTime, err := strconv.ParseInt(fields[0], 10, 64); err == nil {
+			if len(fields) == 1 {
+				return time.Unix(unixTime, 0), nil
+			}
+			zone, err := time.Parse("-0700", fields[1])
+			if err != nil {
+				return time.Time{}, fmt.Errorf("%w : %s", ErrInvalidDate, s)
+			}
+			return time.Unix(unixTime, 0).In(zone.Location()), nil
+		}
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w : %s", ErrInvalidDate, s)
+}
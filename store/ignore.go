@@ -0,0 +1,102 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/kanon1343/fsegit/ignore"
+	"github.com/kanon1343/fsegit/util"
+)
+
+// IgnoreMatcherは作業ツリーで追跡していないファイルを無視するかを判定する*ignore.Matcherを返す.
+// gitと同じく、core.excludesFile(なければ$XDG_CONFIG_HOME/git/ignore)、<GitDir>/info/exclude、
+// 作業ツリーの各ディレクトリの.gitignoreと.fsegitignoreの順に読み、後のものほど優先する.
+// 無視されたディレクトリの中の無視ファイルは読まない.
+func (c *Client) IgnoreMatcher() (*ignore.Matcher, error) {
+	cfg, err := c.Config()
+	if err != nil {
+		return nil, err
+	}
+	ignoreCase, err := cfg.GetBool("core.ignorecase", false)
+	if err != nil {
+		return nil, err
+	}
+	m := ignore.NewMatcher(ignoreCase)
+
+	excludesFile, ok := cfg.Get("core.excludesfile")
+	if ok {
+		excludesFile = expandHome(excludesFile)
+	} else if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		excludesFile = filepath.Join(xdg, "git", "ignore")
+	} else if home, err := os.UserHomeDir(); err == nil {
+		excludesFile = filepath.Join(home, ".config", "git", "ignore")
+	}
+	for _, name := range []string{excludesFile, filepath.Join(c.gitDir, "info", "exclude")} {
+		if err := addIgnoreFile(m, "", name); err != nil {
+			return nil, err
+		}
+	}
+	if c.workTree == "" {
+		return m, nil
+	}
+
+	err = filepath.Walk(c.workTree, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		rel := ""
+		if p != c.workTree {
+			if rel, err = filepath.Rel(c.workTree, p); err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if isGitDirName(info.Name()) || isNestedRepository(p) || m.Ignored(rel, true) {
+				return filepath.SkipDir
+			}
+		}
+		for _, name := range ignore.FileNames {
+			if err := addIgnoreFile(m, rel, filepath.Join(p, name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// addIgnoreFileはdirに置かれた無視ファイルnameを読んでmに追加する. ファイルがなければ何もしない.
+func addIgnoreFile(m *ignore.Matcher, dir, name string) error {
+	if name == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(util.LongPath(name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	m.Add(dir, data)
+	return nil
+}
+
+// expandHomeは"~/"で始まるパスをホームディレクトリからのパスにする.
+func expandHome(name string) string {
+	if !strings.HasPrefix(name, "~/") {
+		return name
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return name
+	}
+	return filepath.Join(home, filepath.FromSlash(path.Clean(name[2:])))
+}
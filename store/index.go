@@ -0,0 +1,533 @@
+package store
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kanon1343/fsegit/metrics"
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/util"
+)
+
+const (
+	indexSignature = "DIRC"
+	// indexEntryFixedSizeはパス名を除いたエントリの長さ.
+	indexEntryFixedSize = 62
+	// maxIndexEntriesはエントリ数の上限. 壊れたヘッダで巨大な領域を確保しないようにする.
+	maxIndexEntries = 1 << 24
+
+	indexFlagAssumeValid = 0x8000
+	indexFlagExtended    = 0x4000
+	indexFlagStageMask   = 0x3000
+	indexFlagStageShift  = 12
+	indexFlagNameMask    = 0x0fff
+
+	// バージョン3以降の拡張フラグ.
+	indexExtFlagSkipWorktree = 0x4000
+	indexExtFlagIntentToAdd  = 0x2000
+	indexExtFlagReserved     = 0x8000
+)
+
+// IndexEntryはインデックス(ステージングエリア)の1エントリ.
+type IndexEntry struct {
+	CTime time.Time
+	MTime time.Time
+	Dev   uint32
+	Ino   uint32
+	Mode  object.FileMode
+	UID   uint32
+	GID   uint32
+	Size  uint32
+	Hash  sha.SHA1
+	// Stageはコンフリクト中のエントリの番号. 0は通常のエントリ、1/2/3は共通の祖先/自分/相手.
+	Stage int
+	// Pathは作業ツリーのルートからの"/"区切りのパス.
+	Path string
+	// AssumeValidは作業ツリーのファイルが変わっていないとみなす印(update-index --assume-unchanged).
+	AssumeValid bool
+	// SkipWorktreeとIntentToAddはバージョン3以降の拡張フラグ. どちらかがあるとバージョン3以上で書き出す.
+	SkipWorktree bool
+	IntentToAdd  bool
+}
+
+// extendedはエントリにバージョン3以降の拡張フラグが必要かを返す.
+func (e *IndexEntry) extended() bool {
+	return e.SkipWorktree || e.IntentToAdd
+}
+
+// Indexは.git/indexの内容. エントリはパスとステージの順に並んでいる.
+type Index struct {
+	// Versionは書き出すときのインデックスの形式(2、3、4). 4ではパスを前のエントリとの差分で書いて小さくする.
+	// 2で拡張フラグのあるエントリがあれば3で書き出す.
+	Version uint32
+	Entries []*IndexEntry
+	// CacheはTREE拡張. エントリを変えるとそのパスを含むディレクトリが古いものになる.
+	Cache *CacheTree
+	// ResolveUndoはREUC拡張. Add、Removeでコンフリクトを解決すると、解決する前のエントリを記録する.
+	ResolveUndo []ResolveUndoEntry
+	// Extensionsはその他の省略可能な拡張. 読み込んだまま書き戻す.
+	Extensions []IndexExtension
+}
+
+// NewIndexは空のインデックスを返す.
+func NewIndex() *Index {
+	return &Index{Version: 2}
+}
+
+// ReadIndexはインデックスファイルを読み込む. まだファイルがなければ、設定のindex.versionの形式で書き出す
+// 空のインデックスを返す.
+func (c *Client) ReadIndex() (*Index, error) {
+	data, err := ioutil.ReadFile(util.LongPath(c.indexFile))
+	if os.IsNotExist(err) {
+		index := NewIndex()
+		cfg, err := c.Config()
+		if err != nil {
+			return nil, err
+		}
+		if value, ok := cfg.Get("index.version"); ok {
+			version, err := strconv.ParseUint(value, 10, 32)
+			if err != nil || version < 2 || version > 4 {
+				return nil, fmt.Errorf("%w : bad index.version %q", ErrInvalidIndex, value)
+			}
+			index.Version = uint32(version)
+		}
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ParseIndex(data)
+}
+
+// WriteIndexはインデックスをロックファイルに書いてからインデックスファイルと置き換える.
+func (c *Client) WriteIndex(index *Index) error {
+	start := time.Now()
+	lock, err := util.Lock(c.indexFile, refLockTimeout)
+	c.recorder.Observe(metrics.LockWaitTime, time.Since(start))
+	if err != nil {
+		return err
+	}
+	if _, err := lock.Write(index.Encode()); err != nil {
+		lock.Rollback()
+		return err
+	}
+	return lock.Commit()
+}
+
+// ParseIndexはバージョン2から4のインデックスを読み込む. TREEとREUCの拡張は解釈し、その他の省略可能な拡張はそのまま取っておく.
+func ParseIndex(data []byte) (*Index, error) {
+	if len(data) < 12+sha1.Size {
+		return nil, fmt.Errorf("%w : too short", ErrInvalidIndex)
+	}
+	body, trailer := data[:len(data)-sha1.Size], data[len(data)-sha1.Size:]
+	if sum := sha1.Sum(body); !bytes.Equal(sum[:], trailer) {
+		return nil, fmt.Errorf("%w : checksum mismatch", ErrInvalidIndex)
+	}
+	if string(body[:4]) != indexSignature {
+		return nil, fmt.Errorf("%w : bad signature", ErrInvalidIndex)
+	}
+	index := &Index{Version: binary.BigEndian.Uint32(body[4:8])}
+	if index.Version < 2 || index.Version > 4 {
+		return nil, fmt.Errorf("%w : unsupported version %d", ErrInvalidIndex, index.Version)
+	}
+	count := binary.BigEndian.Uint32(body[8:12])
+	if count > maxIndexEntries {
+		return nil, fmt.Errorf("%w : too many entries", ErrInvalidIndex)
+	}
+
+	offset := 12
+	prevPath := ""
+	for i := uint32(0); i < count; i++ {
+		entry, size, err := parseIndexEntry(body[offset:], index.Version, prevPath)
+		if err != nil {
+			return nil, fmt.Errorf("%w : entry %d: %s", ErrInvalidIndex, i, err)
+		}
+		index.Entries = append(index.Entries, entry)
+		offset += size
+		prevPath = entry.Path
+	}
+	if err := index.parseIndexExtensions(body[offset:]); err != nil {
+		return nil, fmt.Errorf("%w : %s", ErrInvalidIndex, err)
+	}
+	return index, nil
+}
+
+// parseIndexEntryは1エントリを読み、パディングを含めた長さを返す.
+// バージョン4ではパスが前のエントリのパスprevPathとの差分で書かれ、パディングはない.
+func parseIndexEntry(data []byte, version uint32, prevPath string) (*IndexEntry, int, error) {
+	if len(data) < indexEntryFixedSize {
+		return nil, 0, fmt.Errorf("truncated")
+	}
+	u32 := func(i int) uint32 { return binary.BigEndian.Uint32(data[i : i+4]) }
+	entry := &IndexEntry{
+		CTime: time.Unix(int64(u32(0)), int64(u32(4))),
+		MTime: time.Unix(int64(u32(8)), int64(u32(12))),
+		Dev:   u32(16),
+		Ino:   u32(20),
+		Mode:  object.FileMode(u32(24)),
+		UID:   u32(28),
+		GID:   u32(32),
+		Size:  u32(36),
+		Hash:  append(sha.SHA1(nil), data[40:60]...),
+	}
+	flags := binary.BigEndian.Uint16(data[60:62])
+	entry.AssumeValid = flags&indexFlagAssumeValid != 0
+	entry.Stage = int(flags&indexFlagStageMask) >> indexFlagStageShift
+	nameStart := indexEntryFixedSize
+	if flags&indexFlagExtended != 0 {
+		if version < 3 {
+			return nil, 0, fmt.Errorf("extended flags require index version 3")
+		}
+		if len(data) < indexEntryFixedSize+2 {
+			return nil, 0, fmt.Errorf("truncated")
+		}
+		extFlags := binary.BigEndian.Uint16(data[62:64])
+		if extFlags&indexExtFlagReserved != 0 {
+			return nil, 0, fmt.Errorf("unknown extended flags %#x", extFlags)
+		}
+		entry.SkipWorktree = extFlags&indexExtFlagSkipWorktree != 0
+		entry.IntentToAdd = extFlags&indexExtFlagIntentToAdd != 0
+		nameStart += 2
+	}
+
+	if version == 4 {
+		// 前のエントリのパスの末尾から取り除くバイト数と、続けるヌル終端の文字列.
+		strip, n := readIndexVarint(data[nameStart:])
+		if n == 0 || strip > uint64(len(prevPath)) {
+			return nil, 0, fmt.Errorf("bad path prefix")
+		}
+		end := bytes.IndexByte(data[nameStart+n:], 0)
+		if end < 0 {
+			return nil, 0, fmt.Errorf("unterminated path")
+		}
+		entry.Path = prevPath[:len(prevPath)-int(strip)] + string(data[nameStart+n:nameStart+n+end])
+		if !validIndexPath(entry.Path) {
+			return nil, 0, fmt.Errorf("bad path %q", entry.Path)
+		}
+		return entry, nameStart + n + end + 1, nil
+	}
+
+	// パス名はヌル終端. 長さのフィールドは0xfff以上の長さを表せないので終端を探す.
+	end := bytes.IndexByte(data[nameStart:], 0)
+	if end < 0 {
+		return nil, 0, fmt.Errorf("unterminated path")
+	}
+	entry.Path = string(data[nameStart : nameStart+end])
+	if !validIndexPath(entry.Path) {
+		return nil, 0, fmt.Errorf("bad path %q", entry.Path)
+	}
+
+	// エントリは8バイト境界までヌル文字で埋められる(最低1バイト).
+	size := (nameStart + end + 8) &^ 7
+	if size > len(data) {
+		return nil, 0, fmt.Errorf("truncated")
+	}
+	return entry, size, nil
+}
+
+// readIndexVarintはバージョン4のパスの差分に使う可変長の整数を読み、値と読んだバイト数を返す.
+// 続きのバイトがあるたびに1を足してから7ビットずらすので、同じ値の表し方は1つしかない.
+func readIndexVarint(data []byte) (uint64, int) {
+	if len(data) == 0 {
+		return 0, 0
+	}
+	value := uint64(data[0] & 0x7f)
+	n := 1
+	for data[n-1]&0x80 != 0 {
+		if n >= len(data) || n > 9 {
+			return 0, 0
+		}
+		value = ((value + 1) << 7) | uint64(data[n]&0x7f)
+		n++
+	}
+	return value, n
+}
+
+// appendIndexVarintはreadIndexVarintで読める形式でvalueをbufに書く.
+func appendIndexVarint(buf *bytes.Buffer, value uint64) {
+	var tmp [16]byte
+	i := len(tmp) - 1
+	tmp[i] = byte(value & 0x7f)
+	for value >>= 7; value > 0; value >>= 7 {
+		value--
+		i--
+		tmp[i] = 0x80 | byte(value&0x7f)
+	}
+	buf.Write(tmp[i:])
+}
+
+// validIndexPathはパスが作業ツリーの中を指す正規化された相対パスで、管理ディレクトリ(util.IsGitDirName)を
+// 通らないかを判定する.
+func validIndexPath(path string) bool {
+	for _, name := range strings.Split(path, "/") {
+		if name == "" || name == "." || name == ".." || util.IsGitDirName(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// EncodeはidxのVersionの形式でインデックスファイルの内容を返す.
+func (idx *Index) Encode() []byte {
+	version := idx.Version
+	if version < 2 || version > 4 {
+		version = 2
+	}
+	if version == 2 {
+		for _, entry := range idx.Entries {
+			if entry.extended() {
+				version = 3
+				break
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(indexSignature)
+	binary.Write(&buf, binary.BigEndian, version)
+	binary.Write(&buf, binary.BigEndian, uint32(len(idx.Entries)))
+
+	prevPath := ""
+	for _, entry := range idx.Entries {
+		start := buf.Len()
+		for _, v := range []uint32{
+			uint32(entry.CTime.Unix()), uint32(entry.CTime.Nanosecond()),
+			uint32(entry.MTime.Unix()), uint32(entry.MTime.Nanosecond()),
+			entry.Dev, entry.Ino, uint32(entry.Mode), entry.UID, entry.GID, entry.Size,
+		} {
+			binary.Write(&buf, binary.BigEndian, v)
+		}
+		buf.Write(entry.Hash)
+		nameLength := len(entry.Path)
+		if nameLength > indexFlagNameMask {
+			nameLength = indexFlagNameMask
+		}
+		flags := uint16(entry.Stage<<indexFlagStageShift) | uint16(nameLength)
+		if entry.AssumeValid {
+			flags |= indexFlagAssumeValid
+		}
+		if entry.extended() {
+			flags |= indexFlagExtended
+		}
+		binary.Write(&buf, binary.BigEndian, flags)
+		if entry.extended() {
+			var extFlags uint16
+			if entry.SkipWorktree {
+				extFlags |= indexExtFlagSkipWorktree
+			}
+			if entry.IntentToAdd {
+				extFlags |= indexExtFlagIntentToAdd
+			}
+			binary.Write(&buf, binary.BigEndian, extFlags)
+		}
+
+		if version == 4 {
+			common := 0
+			for common < len(prevPath) && common < len(entry.Path) && prevPath[common] == entry.Path[common] {
+				common++
+			}
+			appendIndexVarint(&buf, uint64(len(prevPath)-common))
+			buf.WriteString(entry.Path[common:])
+			buf.WriteByte(0)
+			prevPath = entry.Path
+			continue
+		}
+		buf.WriteString(entry.Path)
+		size := (buf.Len() - start + 8) &^ 7
+		buf.Write(make([]byte, size-(buf.Len()-start)))
+	}
+	idx.encodeIndexExtensions(&buf)
+
+	sum := sha1.Sum(buf.Bytes())
+	buf.Write(sum[:])
+	return buf.Bytes()
+}
+
+// searchはpathとstageのエントリがあるべき位置を返す.
+func (idx *Index) search(path string, stage int) int {
+	return sort.Search(len(idx.Entries), func(i int) bool {
+		e := idx.Entries[i]
+		if e.Path != path {
+			return e.Path > path
+		}
+		return e.Stage >= stage
+	})
+}
+
+// Entryはpathのステージ0のエントリを返す. なければnilを返す.
+func (idx *Index) Entry(path string) *IndexEntry {
+	i := idx.search(path, 0)
+	if i < len(idx.Entries) && idx.Entries[i].Path == path && idx.Entries[i].Stage == 0 {
+		return idx.Entries[i]
+	}
+	return nil
+}
+
+// Addはエントリをステージ0として追加する. 同じパスのエントリ(コンフリクト中のものを含む)は置き換える.
+func (idx *Index) Add(entry *IndexEntry) {
+	entry.Stage = 0
+	idx.recordResolveUndo(entry.Path)
+	idx.remove(entry.Path)
+	idx.invalidateCacheTree(entry.Path)
+	i := idx.search(entry.Path, 0)
+	idx.Entries = append(idx.Entries, nil)
+	copy(idx.Entries[i+1:], idx.Entries[i:])
+	idx.Entries[i] = entry
+}
+
+// AddEntriesはentriesをまとめてステージ0として追加する. 結果はそれぞれAddした場合と同じだが、
+// 新しいパスは最後に1度だけ既存のエントリと併合するので、多くのファイルを追加してもエントリ数の2乗にならない.
+func (idx *Index) AddEntries(entries []*IndexEntry) {
+	var added []*IndexEntry
+	for _, entry := range entries {
+		entry.Stage = 0
+		idx.invalidateCacheTree(entry.Path)
+		i := idx.search(entry.Path, 0)
+		if i < len(idx.Entries) && idx.Entries[i].Path == entry.Path {
+			if idx.Entries[i].Stage == 0 {
+				idx.Entries[i] = entry
+				continue
+			}
+			// コンフリクト中のエントリは解決する前の状態を記録して取り除く.
+			idx.recordResolveUndo(entry.Path)
+			idx.remove(entry.Path)
+		}
+		added = append(added, entry)
+	}
+	if len(added) == 0 {
+		return
+	}
+	// 同じパスが複数あれば後のものを残す.
+	sort.SliceStable(added, func(i, j int) bool { return added[i].Path < added[j].Path })
+	unique := added[:0]
+	for _, entry := range added {
+		if n := len(unique); n > 0 && unique[n-1].Path == entry.Path {
+			unique[n-1] = entry
+			continue
+		}
+		unique = append(unique, entry)
+	}
+
+	merged := make([]*IndexEntry, 0, len(idx.Entries)+len(unique))
+	i, j := 0, 0
+	for i < len(idx.Entries) || j < len(unique) {
+		if j == len(unique) || (i < len(idx.Entries) && idx.Entries[i].Path < unique[j].Path) {
+			merged = append(merged, idx.Entries[i])
+			i++
+			continue
+		}
+		merged = append(merged, unique[j])
+		j++
+	}
+	idx.Entries = merged
+}
+
+// AddUnmergedはコンフリクト中のpathのエントリを、それぞれのStage(1/2/3)のまま追加する.
+// 同じパスの既存のエントリは全て置き換え、ResolveUndoの記録は取り除く.
+func (idx *Index) AddUnmerged(path string, entries ...*IndexEntry) {
+	idx.remove(path)
+	idx.forgetResolveUndo(path)
+	idx.invalidateCacheTree(path)
+	for _, entry := range entries {
+		entry.Path = path
+		i := idx.search(path, entry.Stage)
+		idx.Entries = append(idx.Entries, nil)
+		copy(idx.Entries[i+1:], idx.Entries[i:])
+		idx.Entries[i] = entry
+	}
+}
+
+// Removeはpathの全てのステージのエントリを取り除き、取り除いたかを返す.
+func (idx *Index) Remove(path string) bool {
+	idx.recordResolveUndo(path)
+	if !idx.remove(path) {
+		return false
+	}
+	idx.invalidateCacheTree(path)
+	return true
+}
+
+func (idx *Index) remove(path string) bool {
+	i := idx.search(path, 0)
+	j := i
+	for j < len(idx.Entries) && idx.Entries[j].Path == path {
+		j++
+	}
+	if i == j {
+		return false
+	}
+	idx.Entries = append(idx.Entries[:i], idx.Entries[j:]...)
+	return true
+}
+
+// Unmergedはコンフリクトが解決されていないパスを返す.
+func (idx *Index) Unmerged() []string {
+	var paths []string
+	for _, entry := range idx.Entries {
+		if entry.Stage != 0 && (len(paths) == 0 || paths[len(paths)-1] != entry.Path) {
+			paths = append(paths, entry.Path)
+		}
+	}
+	return paths
+}
+
+// NewIndexEntryは作業ツリーのファイルの情報からエントリを作る.
+// trustFileModeがfalseなら実行ビットを見ずに、既存のエントリのモードを引き継ぐ.
+// trustSymlinksがfalseなら、既存のエントリがシンボリックリンクである通常のファイルはシンボリックリンクのままにする.
+func NewIndexEntry(path string, info os.FileInfo, hash sha.SHA1, old *IndexEntry, trustFileMode, trustSymlinks bool) *IndexEntry {
+	entry := &IndexEntry{
+		CTime: info.ModTime(),
+		MTime: info.ModTime(),
+		Mode:  FileModeOf(info),
+		Size:  uint32(info.Size()),
+		Hash:  hash,
+		Path:  path,
+	}
+	entry.Dev, entry.Ino, entry.UID, entry.GID = util.StatIDs(info)
+	if !trustFileMode && (entry.Mode == object.ModeBlob || entry.Mode == object.ModeExecutable) {
+		entry.Mode = object.ModeBlob
+		if old != nil && old.Mode == object.ModeExecutable {
+			entry.Mode = object.ModeExecutable
+		}
+	}
+	if !trustSymlinks && old != nil && old.Mode == object.ModeSymlink && info.Mode().IsRegular() {
+		entry.Mode = object.ModeSymlink
+	}
+	return entry
+}
+
+// FileModeOfは作業ツリーのファイルのモードをツリーエントリのモードに変換する.
+func FileModeOf(info os.FileInfo) object.FileMode {
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		return object.ModeSymlink
+	case info.IsDir():
+		return object.ModeTree
+	case info.Mode()&0111 != 0:
+		return object.ModeExecutable
+	default:
+		return object.ModeBlob
+	}
+}
+
+// WriteTreeはインデックスのエントリからツリーを組み立てて書き込み、ルートツリーのハッシュを返す.
+// idx.Cacheが使えるディレクトリはツリーを組み立て直さず、組み立てたディレクトリはidx.Cacheに記録する.
+// コンフリクトが解決されていないエントリがあればErrUnmergedを返す.
+func (c *Client) WriteTree(idx *Index) (sha.SHA1, error) {
+	if unmerged := idx.Unmerged(); len(unmerged) > 0 {
+		return nil, fmt.Errorf("%w : %s", ErrUnmerged, strings.Join(unmerged, ", "))
+	}
+	if idx.Cache == nil {
+		idx.Cache = &CacheTree{EntryCount: -1}
+	}
+	return c.writeCacheTree(idx.Entries, 0, idx.Cache)
+}
@@ -0,0 +1,324 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+)
+
+const (
+	cacheTreeSignature   = "TREE"
+	resolveUndoSignature = "REUC"
+)
+
+// IndexExtensionはこのパッケージが解釈しないインデックスの拡張データ. 読み込んだまま書き戻す.
+type IndexExtension struct {
+	Signature string
+	Data      []byte
+}
+
+// CacheTreeはインデックスのTREE拡張. ディレクトリごとにツリーのハッシュを覚えておき、
+// WriteTreeで変わっていないディレクトリのツリーを組み立て直さずに済ませる.
+type CacheTree struct {
+	// Nameはディレクトリの名前. ルートは空.
+	Name string
+	// EntryCountはディレクトリ以下のインデックスのエントリ数. -1ならHashは古くて使えない.
+	EntryCount int
+	Hash       sha.SHA1
+	Subtrees   []*CacheTree
+}
+
+// Validはディレクトリのツリーのハッシュが使えるかを返す.
+func (t *CacheTree) Valid() bool {
+	return t.EntryCount >= 0
+}
+
+// subtreeはnameのサブディレクトリを返す. なければnilを返す.
+func (t *CacheTree) subtree(name string) *CacheTree {
+	for _, sub := range t.Subtrees {
+		if sub.Name == name {
+			return sub
+		}
+	}
+	return nil
+}
+
+// ResolveUndoEntryはインデックスのREUC拡張の1エントリ. コンフリクトを解決する前の
+// ステージ1/2/3のモードとハッシュを覚えておく. 存在しなかったステージのモードは0.
+type ResolveUndoEntry struct {
+	Path   string
+	Modes  [3]object.FileMode
+	Hashes [3]sha.SHA1
+}
+
+// invalidateCacheTreeはpathを含むディレクトリのキャッシュを古いものにする.
+func (idx *Index) invalidateCacheTree(path string) {
+	node := idx.Cache
+	components := strings.Split(path, "/")
+	for i := 0; node != nil; i++ {
+		node.EntryCount = -1
+		if i == len(components)-1 {
+			break
+		}
+		node = node.subtree(components[i])
+	}
+}
+
+// recordResolveUndoはpathのコンフリクト中のエントリを、解決する前の状態としてResolveUndoに記録する.
+func (idx *Index) recordResolveUndo(path string) {
+	var undo *ResolveUndoEntry
+	for i := idx.search(path, 1); i < len(idx.Entries) && idx.Entries[i].Path == path; i++ {
+		entry := idx.Entries[i]
+		if undo == nil {
+			undo = &ResolveUndoEntry{Path: path}
+		}
+		undo.Modes[entry.Stage-1] = entry.Mode
+		undo.Hashes[entry.Stage-1] = entry.Hash
+	}
+	if undo == nil {
+		return
+	}
+	idx.forgetResolveUndo(path)
+	idx.ResolveUndo = append(idx.ResolveUndo, *undo)
+}
+
+// forgetResolveUndoはpathのResolveUndoの記録を取り除く.
+func (idx *Index) forgetResolveUndo(path string) {
+	for i, undo := range idx.ResolveUndo {
+		if undo.Path == path {
+			idx.ResolveUndo = append(idx.ResolveUndo[:i], idx.ResolveUndo[i+1:]...)
+			return
+		}
+	}
+}
+
+// parseIndexExtensionsはエントリの後ろにある拡張データを読む.
+// 知らない拡張のうち、名前が大文字で始まる省略可能なものはそのまま取っておき、それ以外はエラーにする.
+func (idx *Index) parseIndexExtensions(data []byte) error {
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return fmt.Errorf("truncated extension header")
+		}
+		signature := string(data[:4])
+		size := binary.BigEndian.Uint32(data[4:8])
+		if uint64(size) > uint64(len(data)-8) {
+			return fmt.Errorf("truncated extension %q", signature)
+		}
+		body := data[8 : 8+size]
+		data = data[8+size:]
+
+		switch {
+		case signature == cacheTreeSignature:
+			cache, rest, err := parseCacheTree(body)
+			if err != nil {
+				return fmt.Errorf("extension %s: %s", signature, err)
+			}
+			if len(rest) != 0 {
+				return fmt.Errorf("extension %s: trailing data", signature)
+			}
+			idx.Cache = cache
+		case signature == resolveUndoSignature:
+			undo, err := parseResolveUndo(body)
+			if err != nil {
+				return fmt.Errorf("extension %s: %s", signature, err)
+			}
+			idx.ResolveUndo = undo
+		case signature == "EOIE" || signature == "IEOT":
+			// ファイル中の位置を記録した拡張なので、書き直すと合わなくなる. 読み捨てる.
+		case signature[0] >= 'A' && signature[0] <= 'Z':
+			idx.Extensions = append(idx.Extensions, IndexExtension{Signature: signature, Data: append([]byte{}, body...)})
+		default:
+			return fmt.Errorf("unsupported extension %q", signature)
+		}
+	}
+	return nil
+}
+
+// parseCacheTreeはTREE拡張の1ディレクトリとそのサブディレクトリを読み、残りのデータを返す.
+// 各ディレクトリは"<名前>\x00<エントリ数> <サブディレクトリ数>\n"に、エントリ数が0以上ならハッシュが続く.
+func parseCacheTree(data []byte) (*CacheTree, []byte, error) {
+	nul := bytes.IndexByte(data, 0)
+	if nul < 0 {
+		return nil, nil, fmt.Errorf("unterminated cache tree name")
+	}
+	node := &CacheTree{Name: string(data[:nul])}
+	data = data[nul+1:]
+	lf := bytes.IndexByte(data, '\n')
+	if lf < 0 {
+		return nil, nil, fmt.Errorf("unterminated cache tree counts")
+	}
+	counts := strings.Split(string(data[:lf]), " ")
+	data = data[lf+1:]
+	if len(counts) != 2 {
+		return nil, nil, fmt.Errorf("bad cache tree counts %q", counts)
+	}
+	var err error
+	if node.EntryCount, err = strconv.Atoi(counts[0]); err != nil || node.EntryCount < -1 {
+		return nil, nil, fmt.Errorf("bad cache tree entry count %q", counts[0])
+	}
+	subtrees, err := strconv.Atoi(counts[1])
+	if err != nil || subtrees < 0 || subtrees > len(data) {
+		return nil, nil, fmt.Errorf("bad cache tree subtree count %q", counts[1])
+	}
+	if node.Valid() {
+		if len(data) < 20 {
+			return nil, nil, fmt.Errorf("truncated cache tree hash")
+		}
+		node.Hash = append(sha.SHA1(nil), data[:20]...)
+		data = data[20:]
+	}
+	for i := 0; i < subtrees; i++ {
+		var sub *CacheTree
+		if sub, data, err = parseCacheTree(data); err != nil {
+			return nil, nil, err
+		}
+		node.Subtrees = append(node.Subtrees, sub)
+	}
+	return node, data, nil
+}
+
+// encodeCacheTreeはnodeとそのサブディレクトリをTREE拡張の形式でbufに書く.
+func encodeCacheTree(buf *bytes.Buffer, node *CacheTree) {
+	fmt.Fprintf(buf, "%s\x00%d %d\n", node.Name, node.EntryCount, len(node.Subtrees))
+	if node.Valid() {
+		buf.Write(node.Hash)
+	}
+	for _, sub := range node.Subtrees {
+		encodeCacheTree(buf, sub)
+	}
+}
+
+// parseResolveUndoはREUC拡張を読む. 各エントリは"<パス>\x00"と3つの"<8進数のモード>\x00"に、
+// モードが0でないステージのハッシュが続く.
+func parseResolveUndo(data []byte) ([]ResolveUndoEntry, error) {
+	var entries []ResolveUndoEntry
+	for len(data) > 0 {
+		var fields [4]string
+		for i := range fields {
+			nul := bytes.IndexByte(data, 0)
+			if nul < 0 {
+				return nil, fmt.Errorf("unterminated resolve undo entry")
+			}
+			fields[i] = string(data[:nul])
+			data = data[nul+1:]
+		}
+		entry := ResolveUndoEntry{Path: fields[0]}
+		for i := range entry.Modes {
+			mode, err := strconv.ParseUint(fields[i+1], 8, 32)
+			if err != nil {
+				return nil, fmt.Errorf("bad resolve undo mode %q", fields[i+1])
+			}
+			entry.Modes[i] = object.FileMode(mode)
+		}
+		for i, mode := range entry.Modes {
+			if mode == 0 {
+				continue
+			}
+			if len(data) < 20 {
+				return nil, fmt.Errorf("truncated resolve undo hash")
+			}
+			entry.Hashes[i] = append(sha.SHA1(nil), data[:20]...)
+			data = data[20:]
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// encodeResolveUndoはentriesをREUC拡張の形式でbufに書く.
+func encodeResolveUndo(buf *bytes.Buffer, entries []ResolveUndoEntry) {
+	for _, entry := range entries {
+		buf.WriteString(entry.Path)
+		buf.WriteByte(0)
+		for _, mode := range entry.Modes {
+			fmt.Fprintf(buf, "%o\x00", uint32(mode))
+		}
+		for i, mode := range entry.Modes {
+			if mode != 0 {
+				buf.Write(entry.Hashes[i])
+			}
+		}
+	}
+}
+
+// encodeIndexExtensionsは拡張データを"<名前><長さ><データ>"の形式でbufに書く.
+func (idx *Index) encodeIndexExtensions(buf *bytes.Buffer) {
+	write := func(signature string, data []byte) {
+		buf.WriteString(signature)
+		binary.Write(buf, binary.BigEndian, uint32(len(data)))
+		buf.Write(data)
+	}
+	if idx.Cache != nil {
+		var data bytes.Buffer
+		encodeCacheTree(&data, idx.Cache)
+		write(cacheTreeSignature, data.Bytes())
+	}
+	if len(idx.ResolveUndo) > 0 {
+		sort.Slice(idx.ResolveUndo, func(i, j int) bool {
+			return idx.ResolveUndo[i].Path < idx.ResolveUndo[j].Path
+		})
+		var data bytes.Buffer
+		encodeResolveUndo(&data, idx.ResolveUndo)
+		write(resolveUndoSignature, data.Bytes())
+	}
+	for _, ext := range idx.Extensions {
+		write(ext.Signature, ext.Data)
+	}
+}
+
+// writeCacheTreeはentries(パスの先頭prefixLenバイトを除いたものがnodeのディレクトリからの相対パス)の
+// ツリーを書き込んでハッシュを返す. キャッシュが使えるディレクトリは組み立て直さず、nodeを新しい内容に更新する.
+func (c *Client) writeCacheTree(entries []*IndexEntry, prefixLen int, node *CacheTree) (sha.SHA1, error) {
+	if node.Valid() && node.EntryCount == len(entries) {
+		return node.Hash, nil
+	}
+
+	tree := &object.Tree{}
+	files := map[string]struct{}{}
+	var subtrees []*CacheTree
+	for i := 0; i < len(entries); {
+		rel := entries[i].Path[prefixLen:]
+		slash := strings.IndexByte(rel, '/')
+		if slash < 0 {
+			files[rel] = struct{}{}
+			tree.Entries = append(tree.Entries, object.TreeEntry{Mode: entries[i].Mode, Name: rel, Hash: entries[i].Hash})
+			i++
+			continue
+		}
+		// インデックスはパスの順に並んでいるので、同じディレクトリのエントリは連続している.
+		dir := rel[:slash]
+		j := i + 1
+		for j < len(entries) && strings.HasPrefix(entries[j].Path[prefixLen:], dir+"/") {
+			j++
+		}
+		// ファイルの"a"は"a/..."より前に並ぶので、ここで同じ名前のファイルが見つかっている.
+		if _, ok := files[dir]; ok {
+			return nil, fmt.Errorf("%w : %s", ErrPathConflict, entries[i].Path[:prefixLen+slash])
+		}
+		sub := node.subtree(dir)
+		if sub == nil {
+			sub = &CacheTree{Name: dir, EntryCount: -1}
+		}
+		hash, err := c.writeCacheTree(entries[i:j], prefixLen+slash+1, sub)
+		if err != nil {
+			return nil, err
+		}
+		subtrees = append(subtrees, sub)
+		tree.Entries = append(tree.Entries, object.TreeEntry{Mode: object.ModeTree, Name: dir, Hash: hash})
+		i = j
+	}
+	obj := object.NewObject(object.TreeObject, tree.Encode())
+	if err := c.WriteObject(obj); err != nil {
+		return nil, err
+	}
+	node.EntryCount = len(entries)
+	node.Hash = obj.Hash
+	node.Subtrees = subtrees
+	return obj.Hash, nil
+}
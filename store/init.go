@@ -0,0 +1,80 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/kanon1343/fsegit/config"
+	"github.com/kanon1343/fsegit/metrics"
+	"github.com/kanon1343/fsegit/util"
+)
+
+// InitOptionsはリポジトリの作り方を指定する.
+type InitOptions struct {
+	// Bareなら作業ツリーを持たず、pathそのものを管理ディレクトリにする.
+	Bare bool
+	// InitialBranchは最初のブランチ名. 空なら設定のinit.defaultBranchを使う.
+	InitialBranch string
+	// GitDirNameは作業ツリーの直下に作る管理ディレクトリの名前. 空ならOptions.GitDirNameと同じく
+	// 環境変数FSEGIT_DIR_NAME、設定fsegit.dirNameの順に決め、どれもなければ.fsegitにする.
+	GitDirName string
+}
+
+// Initはpathに新しいリポジトリを作る. 既にリポジトリがある場合はHEADや設定を変えずに
+// 足りないディレクトリだけを作り、reinitializedにtrueを返す.
+func Init(path string, opts InitOptions) (client *Client, reinitialized bool, err error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, false, err
+	}
+	client = &Client{workTree: abs, recorder: metrics.Nop}
+	if opts.Bare {
+		client.workTree = ""
+		client.gitDir = abs
+	} else {
+		names, err := gitDirNames(opts.GitDirName)
+		if err != nil {
+			return nil, false, err
+		}
+		client.gitDir = filepath.Join(abs, names[0])
+	}
+	client.objectDir = filepath.Join(client.gitDir, "objects")
+	client.indexFile = filepath.Join(client.gitDir, "index")
+
+	reinitialized = util.IsGitDir(client.gitDir)
+	for _, dir := range []string{"objects/info", "objects/pack", "refs/heads", "refs/tags"} {
+		if err := os.MkdirAll(filepath.Join(client.gitDir, filepath.FromSlash(dir)), 0755); err != nil {
+			return nil, false, err
+		}
+	}
+	if reinitialized {
+		return client, true, nil
+	}
+
+	branch := opts.InitialBranch
+	if branch == "" {
+		defaults, err := config.LoadDefaults()
+		if err != nil {
+			return nil, false, err
+		}
+		branch = defaults.DefaultBranchName()
+	}
+	if err := client.WriteSymbolicRef("HEAD", "refs/heads/"+branch); err != nil {
+		return nil, false, err
+	}
+
+	// 実行ビットを保持できないファイルシステムではcore.filemode = falseにする.
+	fileMode, err := util.ProbeFileMode(client.gitDir)
+	if err != nil {
+		return nil, false, err
+	}
+	cfg := fmt.Sprintf("[core]\n\trepositoryformatversion = 0\n\tfilemode = %t\n\tbare = %t\n", fileMode, opts.Bare)
+	if !opts.Bare {
+		cfg += "\tlogallrefupdates = true\n"
+	}
+	if err := util.WriteFileAtomic(filepath.Join(client.gitDir, "config"), []byte(cfg), 0644); err != nil {
+		return nil, false, err
+	}
+	return client, false, nil
+}
@@ -0,0 +1,34 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestMainは開発者のシステム全体と利用者全体の設定(core.autocrlfなど)がテストの結果を変えないように、
+// 空の設定ファイルだけを読むようにしてからテストを実行する.
+func TestMain(m *testing.M) {
+	os.Exit(runWithoutUserConfig(m))
+}
+
+func runWithoutUserConfig(m *testing.M) int {
+	dir, err := ioutil.TempDir("", "fsegit-store-test")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	globalConfig := filepath.Join(dir, "gitconfig")
+	if err := ioutil.WriteFile(globalConfig, nil, 0644); err != nil {
+		panic(err)
+	}
+	for name, value := range map[string]string{
+		"GIT_CONFIG_GLOBAL":   globalConfig,
+		"GIT_CONFIG_NOSYSTEM": "1",
+		"XDG_CONFIG_HOME":     filepath.Join(dir, "xdg"),
+	} {
+		os.Setenv(name, value)
+	}
+	return m.Run()
+}
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/util"
+)
+
+const (
+	mergeMsgFile  = "MERGE_MSG"
+	mergeModeFile = "MERGE_MODE"
+)
+
+// MergeStateはコンフリクトで止まったマージの状態. 解決後のコミットで使う.
+// fsegitにはmergeのコマンドがないので、gitのmergeが残したMERGE_HEAD、MERGE_MSG、MERGE_MODEを読むだけにしている.
+type MergeState struct {
+	// Headsはマージで取り込むコミット. コミットの2番目以降の親になる.
+	Heads []sha.SHA1
+	// Messageはマージコミットのメッセージの既定値.
+	Message string
+	// NoFastForwardは--no-ffで始めたマージかどうか.
+	NoFastForward bool
+}
+
+// ReadMergeStateは保存されたマージの状態を返す. マージ中でなければnilを返す.
+func (c *Client) ReadMergeState() (*MergeState, error) {
+	heads, err := c.ReadMergeHeads()
+	if err != nil || heads == nil {
+		return nil, err
+	}
+	state := &MergeState{Heads: heads}
+
+	message, err := ioutil.ReadFile(filepath.Join(c.gitDir, mergeMsgFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	state.Message = string(message)
+
+	mode, err := ioutil.ReadFile(filepath.Join(c.gitDir, mergeModeFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	state.NoFastForward = strings.Contains(string(mode), "no-ff")
+	return state, nil
+}
+
+// WriteMergeMsgはコンフリクトで止まったrevertなどで、解決後のコミットに使うメッセージをMERGE_MSGに保存する.
+func (c *Client) WriteMergeMsg(message string) error {
+	return util.WriteFileAtomic(filepath.Join(c.gitDir, mergeMsgFile), []byte(message), 0644)
+}
+
+// ReadMergeMsgはMERGE_MSGに保存されたメッセージを返す. なければ空文字列を返す.
+func (c *Client) ReadMergeMsg() (string, error) {
+	message, err := ioutil.ReadFile(filepath.Join(c.gitDir, mergeMsgFile))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return string(message), err
+}
+
+// ClearMergeStateはマージの状態を削除する. マージの完了時と中止時に呼ぶ.
+func (c *Client) ClearMergeState() error {
+	for _, name := range []string{MergeHead, mergeMsgFile, mergeModeFile} {
+		if err := c.ClearSpecialRef(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NextCommitParentsは次に作るコミットの親を返す. マージ中ならHEADに続けてMERGE_HEADのコミットが並ぶ.
+func (c *Client) NextCommitParents() ([]sha.SHA1, error) {
+	head, err := c.ReadHead()
+	if err != nil {
+		return nil, err
+	}
+	parents := head.Parents()
+	state, err := c.ReadMergeState()
+	if err != nil {
+		return nil, err
+	}
+	if state != nil {
+		parents = append(parents, state.Heads...)
+	}
+	return parents, nil
+}
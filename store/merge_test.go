@@ -0,0 +1,132 @@
+package store
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+)
+
+// newMergeTestClientはHEADのブランチにコミットが1つあるリポジトリと、マージで取り込む2つのコミットを作る.
+func newMergeTestClient(t *testing.T) (*Client, sha.SHA1, []sha.SHA1) {
+	t.Helper()
+	client, _, err := Init(t.TempDir(), InitOptions{InitialBranch: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := client.StoreRaw(object.TreeObject, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var commits []sha.SHA1
+	for _, message := range []string{"head", "theirs", "other"} {
+		data := fmt.Sprintf("tree %s\nauthor fsegit <fsegit@example.com> 1672531200 +0900\ncommitter fsegit <fsegit@example.com> 1672531200 +0900\n\n%s\n", tree, message)
+		hash, err := client.StoreRaw(object.CommitObject, []byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		commits = append(commits, hash)
+	}
+	if err := client.WriteRef("refs/heads/main", commits[0]); err != nil {
+		t.Fatal(err)
+	}
+	return client, commits[0], commits[1:]
+}
+
+// writeMergeFilesはgitのmergeがコンフリクトで止まったときと同じく、MERGE_HEAD、MERGE_MSG、MERGE_MODEを書く.
+func writeMergeFiles(t *testing.T, client *Client, heads []sha.SHA1, message, mode string) {
+	t.Helper()
+	var mergeHead string
+	for _, hash := range heads {
+		mergeHead += hash.String() + "\n"
+	}
+	for name, content := range map[string]string{MergeHead: mergeHead, mergeMsgFile: message, mergeModeFile: mode} {
+		if err := ioutil.WriteFile(filepath.Join(client.GitDir(), name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// 保存されたマージの状態を、メッセージとMERGE_HEADの全てのコミットの順のまま読めるか
+func TestClient_ReadMergeState(t *testing.T) {
+	client, _, heads := newMergeTestClient(t)
+	if state, err := client.ReadMergeState(); err != nil || state != nil {
+		t.Fatalf("ReadMergeState() before merging = %+v, %v, want nil", state, err)
+	}
+
+	message := "Merge branch 'topic'\n\n# Conflicts:\n#\ta.txt\n"
+	writeMergeFiles(t, client, heads, message, "no-ff")
+	state, err := client.ReadMergeState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &MergeState{Heads: heads, Message: message, NoFastForward: true}
+	if !reflect.DeepEqual(state, want) {
+		t.Errorf("ReadMergeState() = %+v, want %+v", state, want)
+	}
+
+	writeMergeFiles(t, client, heads[:1], message, "")
+	if state, err := client.ReadMergeState(); err != nil || state.NoFastForward || len(state.Heads) != 1 {
+		t.Errorf("ReadMergeState() without no-ff = %+v, %v", state, err)
+	}
+}
+
+// マージの途中なら、次のコミットの親がHEADに続けてMERGE_HEADのコミットになるか
+func TestClient_NextCommitParents(t *testing.T) {
+	client, head, heads := newMergeTestClient(t)
+	if parents, err := client.NextCommitParents(); err != nil || !reflect.DeepEqual(parents, []sha.SHA1{head}) {
+		t.Errorf("NextCommitParents() = %v, %v, want %s", parents, err, head)
+	}
+	writeMergeFiles(t, client, heads[:1], "Merge branch 'topic'\n", "")
+	if parents, err := client.NextCommitParents(); err != nil || !reflect.DeepEqual(parents, []sha.SHA1{head, heads[0]}) {
+		t.Errorf("NextCommitParents() while merging = %v, %v, want %s %s", parents, err, head, heads[0])
+	}
+}
+
+// マージの状態を消すと3つのファイルがなくなり、コンフリクト中のパスはstatusで解決していないパスとして出るか
+func TestClient_ClearMergeState(t *testing.T) {
+	client, _, heads := newMergeTestClient(t)
+	writeMergeFiles(t, client, heads, "Merge\n", "")
+
+	blob, err := client.StoreRaw(object.BlobObject, []byte("a\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := NewIndex()
+	index.AddUnmerged("a.txt",
+		&IndexEntry{Mode: object.ModeBlob, Hash: blob, Stage: 1},
+		&IndexEntry{Mode: object.ModeBlob, Hash: blob, Stage: 2},
+		&IndexEntry{Mode: object.ModeBlob, Hash: blob, Stage: 3},
+	)
+	if err := client.WriteIndex(index); err != nil {
+		t.Fatal(err)
+	}
+	status, err := client.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(status.Unmerged, []string{"a.txt"}) {
+		t.Errorf("Status().Unmerged = %v, want [a.txt]", status.Unmerged)
+	}
+
+	if err := client.ClearMergeState(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{MergeHead, mergeMsgFile, mergeModeFile} {
+		if _, err := os.Stat(filepath.Join(client.GitDir(), name)); !os.IsNotExist(err) {
+			t.Errorf("%s was not removed: %v", name, err)
+		}
+	}
+	if state, err := client.ReadMergeState(); err != nil || state != nil {
+		t.Errorf("ReadMergeState() after clearing = %+v, %v, want nil", state, err)
+	}
+	// 消えたファイルをもう一度消しても失敗しない.
+	if err := client.ClearMergeState(); err != nil {
+		t.Errorf("second ClearMergeState() error = %v", err)
+	}
+}
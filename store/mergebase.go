@@ -0,0 +1,228 @@
+package store
+
+import (
+	"container/heap"
+	"fmt"
+
+	"github.com/kanon1343/fsegit/sha"
+)
+
+// MergeBaseはaとbの最も新しい共通の祖先を返す. 候補が複数あれば世代数の最も大きいものを返し、
+// 共通の祖先がなければErrNoMergeBaseを返す.
+func (c *Client) MergeBase(a, b sha.SHA1) (sha.SHA1, error) {
+	bases, err := c.MergeBases(a, b)
+	if err != nil {
+		return nil, err
+	}
+	if len(bases) == 0 {
+		return nil, fmt.Errorf("%w : %s %s", ErrNoMergeBase, a, b)
+	}
+	return bases[0], nil
+}
+
+// 共通の祖先を探すときの印.
+const (
+	paintA = 1 << iota
+	paintB
+	paintStale
+	paintResult
+)
+
+// MergeBasesはaとbの共通の祖先のうち、他の共通の祖先の祖先でないもの全てを世代数の大きい順に返す.
+// 交差したマージ(criss-cross merge)の履歴では複数になる. 共通の祖先がなければ空を返す.
+//
+// gitと同じく、世代数(根からの最長の距離)の大きいコミットから順に親へ印を塗り、
+// 両方の印が付いたコミットを候補にする. 候補の親には祖先であることを示す印を伝えて、それ以上候補にしない.
+func (c *Client) MergeBases(a, b sha.SHA1) ([]sha.SHA1, error) {
+	w := newGenerationWalker(c)
+	a, err := c.PeelToCommit(a)
+	if err != nil {
+		return nil, err
+	}
+	if b, err = c.PeelToCommit(b); err != nil {
+		return nil, err
+	}
+	if string(a) == string(b) {
+		return []sha.SHA1{a}, nil
+	}
+
+	flags := map[string]int{string(a): paintA, string(b): paintB}
+	queue := &commitQueue{}
+	for _, hash := range []sha.SHA1{a, b} {
+		generation, err := w.generation(hash)
+		if err != nil {
+			return nil, err
+		}
+		heap.Push(queue, queuedCommit{hash: hash, generation: generation})
+	}
+
+	var candidates []sha.SHA1
+	for queue.hasNonStale(flags) {
+		current := heap.Pop(queue).(queuedCommit)
+		paint := flags[string(current.hash)] & (paintA | paintB | paintStale)
+		if paint == paintA|paintB {
+			if flags[string(current.hash)]&paintResult == 0 {
+				flags[string(current.hash)] |= paintResult
+				candidates = append(candidates, current.hash)
+			}
+			paint |= paintStale
+		}
+		parents, err := w.commitParents(current.hash)
+		if err != nil {
+			return nil, err
+		}
+		for _, parent := range parents {
+			if flags[string(parent)]&paint == paint {
+				continue
+			}
+			flags[string(parent)] |= paint
+			generation, err := w.generation(parent)
+			if err != nil {
+				return nil, err
+			}
+			heap.Push(queue, queuedCommit{hash: parent, generation: generation})
+		}
+	}
+
+	// 後から古い候補の祖先だと分かったもの(STALEの印が付いたもの)を除く.
+	var bases []sha.SHA1
+	for _, hash := range candidates {
+		if flags[string(hash)]&paintStale == 0 {
+			bases = append(bases, hash)
+		}
+	}
+	return c.removeRedundantBases(bases)
+}
+
+// removeRedundantBasesはbasesのうち、他の要素の祖先であるものを除く.
+func (c *Client) removeRedundantBases(bases []sha.SHA1) ([]sha.SHA1, error) {
+	if len(bases) < 2 {
+		return bases, nil
+	}
+	var result []sha.SHA1
+	for i, base := range bases {
+		redundant := false
+		for j, other := range bases {
+			if i == j {
+				continue
+			}
+			ancestor, err := c.IsAncestor(base, other)
+			if err != nil {
+				return nil, err
+			}
+			if ancestor {
+				redundant = true
+				break
+			}
+		}
+		if !redundant {
+			result = append(result, base)
+		}
+	}
+	return result, nil
+}
+
+// generationWalkerはコミットの親と世代数を覚えておき、同じコミットを何度も読まないようにする.
+// コミットグラフにあるコミットは、コミットオブジェクトを読まずにそこから親と世代数を求める.
+type generationWalker struct {
+	client      *Client
+	parents     map[string][]sha.SHA1
+	generations map[string]int
+}
+
+func newGenerationWalker(c *Client) *generationWalker {
+	return &generationWalker{client: c, parents: map[string][]sha.SHA1{}, generations: map[string]int{}}
+}
+
+func (w *generationWalker) commitParents(hash sha.SHA1) ([]sha.SHA1, error) {
+	if parents, ok := w.parents[string(hash)]; ok {
+		return parents, nil
+	}
+	if commit := w.client.lookupCommitGraph(hash); commit != nil {
+		w.parents[string(hash)] = commit.Parents
+		return commit.Parents, nil
+	}
+	commit, err := w.client.GetCommit(hash)
+	if err != nil {
+		return nil, err
+	}
+	w.parents[string(hash)] = commit.Parents
+	return commit.Parents, nil
+}
+
+// generationはhashの世代数を返す. 根のコミットは1で、それ以外は親の世代数の最大値に1を足したもの.
+// 深い履歴でもスタックを使い切らないように、再帰ではなく明示的なスタックで求める.
+func (w *generationWalker) generation(hash sha.SHA1) (int, error) {
+	if generation, ok := w.generations[string(hash)]; ok {
+		return generation, nil
+	}
+	stack := []sha.SHA1{hash}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		if _, ok := w.generations[string(top)]; ok {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		if commit := w.client.lookupCommitGraph(top); commit != nil {
+			w.generations[string(top)] = int(commit.Generation)
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		parents, err := w.commitParents(top)
+		if err != nil {
+			return 0, err
+		}
+		generation, pending := 1, false
+		for _, parent := range parents {
+			g, ok := w.generations[string(parent)]
+			if !ok {
+				stack = append(stack, parent)
+				pending = true
+				continue
+			}
+			if g+1 > generation {
+				generation = g + 1
+			}
+		}
+		if !pending {
+			w.generations[string(top)] = generation
+			stack = stack[:len(stack)-1]
+		}
+	}
+	return w.generations[string(hash)], nil
+}
+
+// queuedCommitは世代数の大きい順に取り出すコミット.
+type queuedCommit struct {
+	hash       sha.SHA1
+	generation int
+}
+
+// commitQueueはcontainer/heapで使う、世代数の大きいコミットから取り出す優先度付きキュー.
+type commitQueue []queuedCommit
+
+func (q commitQueue) Len() int { return len(q) }
+func (q commitQueue) Less(i, j int) bool {
+	if q[i].generation != q[j].generation {
+		return q[i].generation > q[j].generation
+	}
+	return string(q[i].hash) < string(q[j].hash)
+}
+func (q commitQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *commitQueue) Push(x interface{}) { *q = append(*q, x.(queuedCommit)) }
+func (q *commitQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// hasNonStaleはキューにまだ探索を続ける必要のあるコミットが残っているかを返す.
+func (q commitQueue) hasNonStale(flags map[string]int) bool {
+	for _, item := range q {
+		if flags[string(item.hash)]&paintStale == 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,208 @@
+package store
+
+import (
+	"sort"
+
+	"github.com/kanon1343/fsegit/diff"
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+)
+
+// MergeConflictはMergeIntoWorktreeで自動的に合わせられなかったファイル.
+type MergeConflict struct {
+	Path string
+	// Kindはgitの表示に合わせたコンフリクトの種類. "content"、"add/add"、"modify/delete"のどれか.
+	Kind string
+}
+
+// MergeIntoWorktreeはbaseからtheirsへの変更を3方向マージでHEADの内容に取り込み、作業ツリーとインデックスに書き込む.
+// baseとtheirsはコミットかツリーで、baseがnilなら空のツリーとして扱う. HEADは変更しない.
+// 両方の側で変更されたテキストファイルは行単位で合わせる. 合わせられなければコンフリクトの印を書いたファイルを
+// 作業ツリーに置き、インデックスにはステージ1/2/3のエントリを置いて、コンフリクトとして返す.
+// 書き換えるファイルに手元の変更があれば、何も書き換えずにErrWouldOverwriteを返す.
+func (c *Client) MergeIntoWorktree(base, theirs sha.SHA1, labels diff.MergeLabels) ([]MergeConflict, error) {
+	if c.IsBare() {
+		return nil, ErrNoWorkTree
+	}
+	head, err := c.ReadHead()
+	if err != nil {
+		return nil, err
+	}
+	index, err := c.ReadIndex()
+	if err != nil {
+		return nil, err
+	}
+	baseFiles, err := c.treeFiles(base)
+	if err != nil {
+		return nil, err
+	}
+	oursFiles, err := c.treeFiles(head.Hash)
+	if err != nil {
+		return nil, err
+	}
+	theirsFiles, err := c.treeFiles(theirs)
+	if err != nil {
+		return nil, err
+	}
+
+	// theirsの側で変わっていて、HEADとも内容が違うパスだけを書き換える.
+	var changed []string
+	seen := map[string]struct{}{}
+	for _, files := range []map[string]object.TreeEntry{baseFiles, theirsFiles} {
+		for path := range files {
+			if _, ok := seen[path]; ok {
+				continue
+			}
+			seen[path] = struct{}{}
+			b, bok := baseFiles[path]
+			t, tok := theirsFiles[path]
+			o, ook := oursFiles[path]
+			if !sameEntryOrMissing(b, bok, t, tok) && !sameEntryOrMissing(o, ook, t, tok) {
+				changed = append(changed, path)
+			}
+		}
+	}
+	if err := c.checkOverwrite(head, index, oursFiles, changed); err != nil {
+		return nil, err
+	}
+	sort.Strings(changed)
+
+	var conflicts []MergeConflict
+	for _, path := range changed {
+		b, bok := baseFiles[path]
+		o, ook := oursFiles[path]
+		t, tok := theirsFiles[path]
+		switch {
+		case sameEntryOrMissing(b, bok, o, ook):
+			// HEADの側は変えていないので、theirsの側の内容にする.
+			if !tok {
+				if err := c.RemoveWorktreeFile(path); err != nil {
+					return nil, err
+				}
+				index.Remove(path)
+				continue
+			}
+			if err := c.checkoutIndexEntry(index, path, t.Mode, t.Hash); err != nil {
+				return nil, err
+			}
+
+		case ook && tok:
+			kind := "content"
+			if !bok {
+				kind = "add/add"
+			}
+			clean, err := c.mergeFile(index, path, b, bok, o, t, labels)
+			if err != nil {
+				return nil, err
+			}
+			if !clean {
+				conflicts = append(conflicts, MergeConflict{Path: path, Kind: kind})
+			}
+
+		default:
+			// 片方が削除し、もう片方が変更した. 残っている側の内容を作業ツリーに置く.
+			if tok {
+				if _, err := c.WriteWorktreeEntry(path, t.Mode, t.Hash); err != nil {
+					return nil, err
+				}
+			}
+			index.AddUnmerged(path, unmergedEntries(b, bok, o, ook, t, tok)...)
+			conflicts = append(conflicts, MergeConflict{Path: path, Kind: "modify/delete"})
+		}
+	}
+	return conflicts, c.WriteIndex(index)
+}
+
+// mergeFileは両方の側で変更されたpathの内容を行単位で合わせて作業ツリーとインデックスに書き込み、
+// コンフリクトなく合わせられたかを返す. バイナリやシンボリックリンクは合わせずにHEADの側を残す.
+func (c *Client) mergeFile(index *Index, path string, b object.TreeEntry, bok bool, o, t object.TreeEntry, labels diff.MergeLabels) (bool, error) {
+	mode := o.Mode
+	if bok && o.Mode == b.Mode {
+		mode = t.Mode
+	}
+	if isRegularFile(o.Mode) && isRegularFile(t.Mode) && (!bok || isRegularFile(b.Mode)) {
+		var baseData []byte
+		if bok {
+			obj, err := c.GetObject(b.Hash)
+			if err != nil {
+				return false, err
+			}
+			baseData = obj.Data
+		}
+		ours, err := c.GetObject(o.Hash)
+		if err != nil {
+			return false, err
+		}
+		theirs, err := c.GetObject(t.Hash)
+		if err != nil {
+			return false, err
+		}
+		if !diff.IsBinary(baseData) && !diff.IsBinary(ours.Data) && !diff.IsBinary(theirs.Data) {
+			merged, clean := diff.Merge3(baseData, ours.Data, theirs.Data, labels)
+			obj := object.NewObject(object.BlobObject, merged)
+			if err := c.WriteObject(obj); err != nil {
+				return false, err
+			}
+			if clean {
+				return true, c.checkoutIndexEntry(index, path, mode, obj.Hash)
+			}
+			if _, err := c.WriteWorktreeEntry(path, mode, obj.Hash); err != nil {
+				return false, err
+			}
+		}
+	}
+	index.AddUnmerged(path, unmergedEntries(b, bok, o, true, t, true)...)
+	return false, nil
+}
+
+// checkoutIndexEntryはhashのブロブを作業ツリーのpathに書き出し、インデックスのステージ0に置く.
+func (c *Client) checkoutIndexEntry(index *Index, path string, mode object.FileMode, hash sha.SHA1) error {
+	info, err := c.WriteWorktreeEntry(path, mode, hash)
+	if err != nil {
+		return err
+	}
+	entry := NewIndexEntry(path, info, hash, nil, true, true)
+	entry.Mode = mode
+	index.Add(entry)
+	return nil
+}
+
+// treeFilesはhashのツリーに含まれるファイルをパスごとに返す. hashがnilなら空を返す.
+func (c *Client) treeFiles(hash sha.SHA1) (map[string]object.TreeEntry, error) {
+	files := map[string]object.TreeEntry{}
+	if hash == nil {
+		return files, nil
+	}
+	err := c.WalkTree(hash, nil, func(path string, entry object.TreeEntry) error {
+		files[path] = entry
+		return nil
+	})
+	return files, err
+}
+
+// unmergedEntriesはコンフリクトしたファイルの、存在する側のエントリをステージ1/2/3として返す.
+func unmergedEntries(b object.TreeEntry, bok bool, o object.TreeEntry, ook bool, t object.TreeEntry, tok bool) []*IndexEntry {
+	var entries []*IndexEntry
+	for i, side := range []struct {
+		entry object.TreeEntry
+		ok    bool
+	}{{b, bok}, {o, ook}, {t, tok}} {
+		if side.ok {
+			entries = append(entries, &IndexEntry{Mode: side.entry.Mode, Hash: side.entry.Hash, Stage: i + 1})
+		}
+	}
+	return entries
+}
+
+// sameEntryOrMissingはaとbがどちらもないか、同じ内容とモードのファイルかを返す.
+func sameEntryOrMissing(a object.TreeEntry, aok bool, b object.TreeEntry, bok bool) bool {
+	if aok != bok {
+		return false
+	}
+	return !aok || sameTreeEntry(a, b)
+}
+
+// isRegularFileはmodeが行単位で合わせられる通常のファイルかを返す.
+func isRegularFile(mode object.FileMode) bool {
+	return mode == object.ModeBlob || mode == object.ModeExecutable
+}
@@ -0,0 +1,155 @@
+package store
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+)
+
+// NotesRefはノートを記録する参照. gitの既定と同じ.
+const NotesRef = "refs/notes/commits"
+
+// Noteはオブジェクトに付けたノート.
+type Note struct {
+	// Objectはノートを付けたオブジェクトのハッシュ.
+	Object sha.SHA1
+	// Blobはノートの内容を書き込んだブロブのハッシュ.
+	Blob sha.SHA1
+}
+
+// ListNotesはrefs/notes/commitsのノートを、付けたオブジェクトのハッシュ順に返す. ノートがなければ空を返す.
+// gitと同じく、ツリーにはオブジェクトのハッシュの16進表記の名前でブロブが置かれている. gitがノートの多いときに
+// 作る"ab/cdef..."のようにハッシュの先頭で分けたディレクトリも読む.
+func (c *Client) ListNotes() ([]Note, error) {
+	_, tree, err := c.notesTree()
+	if err != nil || tree == nil {
+		return nil, err
+	}
+	var notes []Note
+	if err := c.listNotes(tree, "", &notes); err != nil {
+		return nil, err
+	}
+	sort.Slice(notes, func(i, j int) bool { return bytes.Compare(notes[i].Object, notes[j].Object) < 0 })
+	return notes, nil
+}
+
+func (c *Client) listNotes(hash sha.SHA1, prefix string, notes *[]Note) error {
+	tree, err := c.GetTree(hash)
+	if err != nil {
+		return err
+	}
+	for _, entry := range tree.Entries {
+		name := prefix + entry.Name
+		if entry.Mode.IsTree() {
+			if len(name) < 40 {
+				if err := c.listNotes(entry.Hash, name, notes); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		// ハッシュの名前でないファイルはノートではないので読み飛ばす.
+		object, err := hex.DecodeString(name)
+		if err != nil || len(object) != 20 {
+			continue
+		}
+		*notes = append(*notes, Note{Object: object, Blob: entry.Hash})
+	}
+	return nil
+}
+
+// ReadNoteはhashのオブジェクトに付けたノートの内容を返す. ノートがなければErrNoNoteを返す.
+func (c *Client) ReadNote(hash sha.SHA1) ([]byte, error) {
+	notes, err := c.ListNotes()
+	if err != nil {
+		return nil, err
+	}
+	for _, note := range notes {
+		if bytes.Equal(note.Object, hash) {
+			obj, err := c.GetObject(note.Blob)
+			if err != nil {
+				return nil, err
+			}
+			return obj.Data, nil
+		}
+	}
+	return nil, fmt.Errorf("%w : %s", ErrNoNote, hash)
+}
+
+// AddNoteはhashのオブジェクトにmessageのノートを付け、ノートのツリーを前のノートのコミットを親とするコミットにして
+// refs/notes/commitsに記録する. 作者とコミッターはsignatureにする. 既にノートがあれば、forceがfalseなら
+// ErrNoteExistsを返し、trueなら置き換える. ツリーはディレクトリに分けずに書き直す.
+func (c *Client) AddNote(hash sha.SHA1, message string, signature object.Signature, force bool) error {
+	ok, err := c.HasObject(hash)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w : %s", ErrObjectNotFound, hash)
+	}
+	parent, _, err := c.notesTree()
+	if err != nil {
+		return err
+	}
+	notes, err := c.ListNotes()
+	if err != nil {
+		return err
+	}
+	var tree object.Tree
+	for _, note := range notes {
+		if !bytes.Equal(note.Object, hash) {
+			tree.Entries = append(tree.Entries, object.TreeEntry{Mode: object.ModeBlob, Name: note.Object.String(), Hash: note.Blob})
+		} else if !force {
+			return fmt.Errorf("%w : %s", ErrNoteExists, hash)
+		}
+	}
+	blob, err := c.StoreRaw(object.BlobObject, []byte(message))
+	if err != nil {
+		return err
+	}
+	tree.Entries = append(tree.Entries, object.TreeEntry{Mode: object.ModeBlob, Name: hash.String(), Hash: blob})
+	treeHash, err := c.StoreRaw(object.TreeObject, tree.Encode())
+	if err != nil {
+		return err
+	}
+	commit := object.Commit{
+		Tree:      treeHash,
+		Author:    signature,
+		Committer: signature,
+		Message:   "Notes added by 'fsegit notes add'\n",
+	}
+	if parent != nil {
+		commit.Parents = []sha.SHA1{parent}
+	}
+	commitHash, err := c.StoreRaw(object.CommitObject, commit.Encode())
+	if err != nil {
+		return err
+	}
+	// 同時に別のノートが付けられていたら、そのノートを消さないように失敗させる.
+	expected := parent
+	if expected == nil {
+		expected = zeroHash
+	}
+	return c.UpdateRefIfMatch(NotesRef, commitHash, expected, "notes: "+commit.Subject())
+}
+
+// notesTreeはrefs/notes/commitsのコミットとそのツリーを返す. まだノートがなければどちらもnilを返す.
+func (c *Client) notesTree() (commit, tree sha.SHA1, err error) {
+	commit, err = c.ResolveRef(NotesRef)
+	if errors.Is(err, ErrRefNotFound) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	notesCommit, err := c.GetCommit(commit)
+	if err != nil {
+		return nil, nil, err
+	}
+	return commit, notesCommit.Tree, nil
+}
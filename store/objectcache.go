@@ -0,0 +1,67 @@
+package store
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/kanon1343/fsegit/object"
+)
+
+// DefaultObjectCacheSizeはOptions.ObjectCacheSizeを指定しないときの、展開したオブジェクトを覚えておく大きさの上限(バイト).
+const DefaultObjectCacheSize = 32 << 20
+
+// objectCacheは展開したオブジェクトをハッシュごとに覚えておくLRUキャッシュ.
+// 履歴を辿るときに同じコミットやツリーを何度も展開しないようにする. 複数のゴルーチンから使える.
+type objectCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	// entriesは最近使ったものを先頭にしたオブジェクトの並び. 要素の値は*object.Object.
+	entries *list.List
+	byHash  map[string]*list.Element
+}
+
+// newObjectCacheはmaxBytesまでのオブジェクトを覚えるキャッシュを作る. maxBytesが0以下ならnilを返し、何も覚えない.
+func newObjectCache(maxBytes int64) *objectCache {
+	if maxBytes <= 0 {
+		return nil
+	}
+	return &objectCache{maxBytes: maxBytes, entries: list.New(), byHash: map[string]*list.Element{}}
+}
+
+// getはhashのオブジェクトを覚えていれば返す. なければnilを返す.
+func (c *objectCache) get(hash []byte) *object.Object {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.byHash[string(hash)]
+	if !ok {
+		return nil
+	}
+	c.entries.MoveToFront(elem)
+	return elem.Value.(*object.Object)
+}
+
+// addはobjを覚え、上限を超えた分は最も長く使っていないものから忘れる. 上限より大きなオブジェクトは覚えない.
+func (c *objectCache) add(obj *object.Object) {
+	if c == nil || int64(len(obj.Data)) > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := string(obj.Hash)
+	if elem, ok := c.byHash[key]; ok {
+		c.entries.MoveToFront(elem)
+		return
+	}
+	c.byHash[key] = c.entries.PushFront(obj)
+	c.size += int64(len(obj.Data))
+	for c.size > c.maxBytes {
+		oldest := c.entries.Back()
+		evicted := c.entries.Remove(oldest).(*object.Object)
+		delete(c.byHash, string(evicted.Hash))
+		c.size -= int64(len(evicted.Data))
+	}
+}
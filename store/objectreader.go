@@ -0,0 +1,114 @@
+package store
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/kanon1343/fsegit/metrics"
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/util"
+)
+
+// ObjectReaderはOpenObjectで開いたオブジェクトの内容を展開しながら読む.
+// 最後まで読むとサイズとハッシュを確かめ、合わなければ*object.CorruptObjectErrorを返す.
+type ObjectReader struct {
+	Hash sha.SHA1
+	Type object.Type
+	Size int64
+
+	r        io.Reader
+	closer   io.Closer
+	checksum hash.Hash
+	read     int64
+	recorder metrics.Recorder
+}
+
+// Readは展開したオブジェクトの内容を読む.
+func (r *ObjectReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.checksum.Write(p[:n])
+	r.read += int64(n)
+	if r.read > r.Size {
+		return n, &object.CorruptObjectError{Hash: r.Hash, Err: fmt.Errorf("%w : size is larger than header says", object.ErrInvalidObject)}
+	}
+	if err == io.EOF {
+		if r.read != r.Size {
+			return n, &object.CorruptObjectError{Hash: r.Hash, Err: fmt.Errorf("%w : size is %d but header says %d", object.ErrInvalidObject, r.read, r.Size)}
+		}
+		if !bytes.Equal(r.checksum.Sum(nil), r.Hash) {
+			return n, &object.CorruptObjectError{Hash: r.Hash, Err: fmt.Errorf("%w : hash mismatch", object.ErrInvalidObject)}
+		}
+	} else if err != nil {
+		return n, &object.CorruptObjectError{Hash: r.Hash, Err: err}
+	}
+	return n, err
+}
+
+// Closeはオブジェクトのファイルを閉じる.
+func (r *ObjectReader) Close() error {
+	r.recorder.Add(metrics.BytesDecompressed, r.read)
+	return r.closer.Close()
+}
+
+// OpenObjectはhashのオブジェクトを開いて、種類とサイズを読んだ*ObjectReaderを返す.
+// GetObjectと違って内容をメモリに読み込まないので、大きなブロブも扱える.
+// パックの中でデルタになっているオブジェクトは全体を読み込んでから返す.
+func (c *Client) OpenObject(hash sha.SHA1) (*ObjectReader, error) {
+	if err := checkHashSize(hash); err != nil {
+		return nil, err
+	}
+	hashString := hash.String()
+	objectPath := filepath.Join(c.objectDir, hashString[:2], hashString[2:])
+
+	objectFile, err := os.Open(util.LongPath(objectPath))
+	if os.IsNotExist(err) {
+		objectType, size, rc, packErr := c.openPackedObject(hash)
+		if packErr != nil {
+			return nil, packErr
+		}
+		if rc == nil {
+			return nil, err
+		}
+		checksum := sha1.New()
+		fmt.Fprintf(checksum, "%s %d\x00", objectType, size)
+		c.recorder.Add(metrics.ObjectsRead, 1)
+		return c.newObjectReader(hash, objectType, size, rc, rc, checksum), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	zr, err := zlib.NewReader(objectFile)
+	if err != nil {
+		objectFile.Close()
+		return nil, &object.CorruptObjectError{Hash: hash, Err: err}
+	}
+	checksum := sha1.New()
+	objectType, size, err := object.ReadHeader(io.TeeReader(zr, checksum))
+	if err != nil {
+		objectFile.Close()
+		return nil, &object.CorruptObjectError{Hash: hash, Err: err}
+	}
+	c.recorder.Add(metrics.ObjectsRead, 1)
+	return c.newObjectReader(hash, objectType, size, zr, objectFile, checksum), nil
+}
+
+func (c *Client) newObjectReader(hash sha.SHA1, objectType object.Type, size int64, r io.Reader, closer io.Closer, checksum hash.Hash) *ObjectReader {
+	return &ObjectReader{
+		Hash: hash,
+		Type: objectType,
+		Size: size,
+		// 宣言されたサイズより長いデータも検出できるように1バイト多く読む.
+		r:        io.LimitReader(r, size+1),
+		closer:   closer,
+		checksum: checksum,
+		recorder: c.recorder,
+	}
+}
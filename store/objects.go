@@ -0,0 +1,127 @@
+package store
+
+import (
+	"compress/zlib"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/util"
+)
+
+// ForEachObjectはルースオブジェクトとパックファイルにある全てのオブジェクトについて、ハッシュと種類をfnに渡す.
+// ルースオブジェクトをハッシュの順に渡してから、パックごとにハッシュの順に渡す. ルースとパックの両方や
+// 複数のパックにあるオブジェクトは一度だけ渡す. 種類はヘッダを読むかデルタのベースを辿って求め、内容は展開しない.
+// fnがobject.ErrStopWalkを返したら残りは渡さずにnilを返す. 種類を読めないオブジェクトがあれば
+// *object.CorruptObjectErrorを返す.
+func (c *Client) ForEachObject(fn func(hash sha.SHA1, objectType object.Type) error) error {
+	seen := map[string]struct{}{}
+	err := c.forEachLooseObject(func(hash sha.SHA1, path string) error {
+		objectType, err := readLooseObjectType(path)
+		if err != nil {
+			return &object.CorruptObjectError{Hash: hash, Err: err}
+		}
+		seen[string(hash)] = struct{}{}
+		return fn(hash, objectType)
+	})
+	if err == nil {
+		err = c.forEachPackedObject(func(hash sha.SHA1, objectType object.Type) error {
+			if _, ok := seen[string(hash)]; ok {
+				return nil
+			}
+			seen[string(hash)] = struct{}{}
+			return fn(hash, objectType)
+		})
+	}
+	if errors.Is(err, object.ErrStopWalk) {
+		return nil
+	}
+	return err
+}
+
+// forEachLooseObjectはobjectsディレクトリにあるルースオブジェクトのファイルを、ハッシュの順にfnに渡す.
+// ハッシュの名前でないファイルは無視する.
+func (c *Client) forEachLooseObject(fn func(hash sha.SHA1, path string) error) error {
+	dirs, err := ioutil.ReadDir(util.LongPath(c.objectDir))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() || len(dir.Name()) != 2 {
+			continue
+		}
+		dirPath := filepath.Join(c.objectDir, dir.Name())
+		files, err := ioutil.ReadDir(util.LongPath(dirPath))
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			hash, err := hex.DecodeString(dir.Name() + file.Name())
+			if err != nil || len(hash) != 20 {
+				continue
+			}
+			if err := fn(hash, filepath.Join(dirPath, file.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// forEachPackedObjectは全てのパックファイルのオブジェクトのハッシュと種類をfnに渡す.
+// fnの中でオブジェクトを読めるように、パックのロックを放してからfnを呼ぶ.
+func (c *Client) forEachPackedObject(fn func(hash sha.SHA1, objectType object.Type) error) error {
+	type packedObject struct {
+		hash       sha.SHA1
+		objectType object.Type
+	}
+	var objs []packedObject
+	c.packMu.Lock()
+	err := c.loadPacks()
+	for _, p := range c.packs {
+		if err != nil {
+			break
+		}
+		for _, entry := range p.Index().Entries() {
+			var objectType object.Type
+			if objectType, err = p.Type(entry.Hash); err != nil {
+				err = &object.CorruptObjectError{Hash: entry.Hash, Err: err}
+				break
+			}
+			objs = append(objs, packedObject{entry.Hash, objectType})
+		}
+	}
+	c.packMu.Unlock()
+	if err != nil {
+		return err
+	}
+	for _, obj := range objs {
+		if err := fn(obj.hash, obj.objectType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readLooseObjectTypeはルースオブジェクトのファイルのヘッダだけを展開して、オブジェクトの種類を返す.
+func readLooseObjectType(path string) (object.Type, error) {
+	f, err := os.Open(util.LongPath(path))
+	if err != nil {
+		return object.UndefinedObject, err
+	}
+	defer f.Close()
+	zr, err := zlib.NewReader(f)
+	if err != nil {
+		return object.UndefinedObject, err
+	}
+	defer zr.Close()
+	objectType, _, err := object.ReadHeader(zr)
+	return objectType, err
+}
@@ -0,0 +1,477 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kanon1343/fsegit/metrics"
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/pack"
+	"github.com/kanon1343/fsegit/sha"
+)
+
+// packDirはパックファイルを置くディレクトリを返す.
+func (c *Client) packDir() string {
+	return filepath.Join(c.objectDir, "pack")
+}
+
+// loadPacksはobjects/packのパックファイルを開き直す. 呼び出し側でpackMuを取っておく.
+func (c *Client) loadPacks() error {
+	c.closePacks()
+	paths, err := filepath.Glob(filepath.Join(c.packDir(), "pack-*.pack"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		p, err := pack.Open(path)
+		if err != nil {
+			// 索引を書き込み中のパックは次に読み込むときまで無視する.
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		c.packs = append(c.packs, p)
+	}
+	c.packsLoaded = true
+	return nil
+}
+
+// closePacksは開いているパックファイルを閉じる. 呼び出し側でpackMuを取っておく.
+func (c *Client) closePacks() {
+	for _, p := range c.packs {
+		p.Close()
+	}
+	c.packs = nil
+	c.packsLoaded = false
+	c.bitmap = nil
+	c.bitmapLoaded = false
+}
+
+// getPackedObjectはパックファイルからhashのオブジェクトを探す. 見つからなければnilを返す.
+// 別のプロセスがパックを追加したかもしれないので、見つからなければ一度だけ読み込み直す.
+func (c *Client) getPackedObject(hash sha.SHA1) (*object.Object, error) {
+	c.packMu.Lock()
+	defer c.packMu.Unlock()
+
+	reloaded := false
+	if !c.packsLoaded {
+		if err := c.loadPacks(); err != nil {
+			return nil, err
+		}
+		reloaded = true
+	}
+	for {
+		for _, p := range c.packs {
+			c.recorder.Add(metrics.PackLookups, 1)
+			if !p.Contains(hash) {
+				continue
+			}
+			obj, err := p.Get(hash)
+			if err != nil {
+				return nil, &object.CorruptObjectError{Hash: hash, Err: err}
+			}
+			return obj, nil
+		}
+		if reloaded {
+			return nil, nil
+		}
+		if err := c.loadPacks(); err != nil {
+			return nil, err
+		}
+		reloaded = true
+	}
+}
+
+// openPackedObjectはパックファイルからhashのオブジェクトを開く. 見つからなければnilのio.ReadCloserを返す.
+// getPackedObjectと同じく、見つからなければ一度だけ読み込み直す.
+func (c *Client) openPackedObject(hash sha.SHA1) (object.Type, int64, io.ReadCloser, error) {
+	c.packMu.Lock()
+	defer c.packMu.Unlock()
+
+	reloaded := false
+	if !c.packsLoaded {
+		if err := c.loadPacks(); err != nil {
+			return object.UndefinedObject, 0, nil, err
+		}
+		reloaded = true
+	}
+	for {
+		for _, p := range c.packs {
+			c.recorder.Add(metrics.PackLookups, 1)
+			if !p.Contains(hash) {
+				continue
+			}
+			objectType, size, rc, err := p.Open(hash)
+			if err != nil {
+				return object.UndefinedObject, 0, nil, &object.CorruptObjectError{Hash: hash, Err: err}
+			}
+			return objectType, size, rc, nil
+		}
+		if reloaded {
+			return object.UndefinedObject, 0, nil, nil
+		}
+		if err := c.loadPacks(); err != nil {
+			return object.UndefinedObject, 0, nil, err
+		}
+		reloaded = true
+	}
+}
+
+// hasPackedObjectはhashのオブジェクトが読み込み済みのパックにあるかを索引だけを見て返す.
+// まだパックを読み込んでいなければ読み込む.
+func (c *Client) hasPackedObject(hash sha.SHA1) (bool, error) {
+	c.packMu.Lock()
+	defer c.packMu.Unlock()
+	if !c.packsLoaded {
+		if err := c.loadPacks(); err != nil {
+			return false, err
+		}
+	}
+	for _, p := range c.packs {
+		if p.Contains(hash) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// findPackedPrefixはパックの索引から、16進数のハッシュがprefixで始まるオブジェクトを探す.
+// 別のプロセスが追加したパックも探せるように読み込み直してから探す.
+func (c *Client) findPackedPrefix(prefix string) ([]sha.SHA1, error) {
+	c.packMu.Lock()
+	defer c.packMu.Unlock()
+	if err := c.loadPacks(); err != nil {
+		return nil, err
+	}
+	var hashes []sha.SHA1
+	for _, p := range c.packs {
+		hashes = append(hashes, p.Index().FindPrefix(prefix)...)
+	}
+	return hashes, nil
+}
+
+// ReachableObjectsは参照、HEAD、ORIG_HEADなどの特別な参照、インデックスから辿れる全てのオブジェクトを返す.
+// サブモジュールのコミット(gitlink)は辿らない.
+func (c *Client) ReachableObjects() ([]*object.Object, error) {
+	return c.reachableObjects(context.Background())
+}
+
+// reachableObjectsはReachableObjectsと同じだが、ctxが取り消されたらそこで辿るのをやめてctx.Err()を返す.
+func (c *Client) reachableObjects(ctx context.Context) ([]*object.Object, error) {
+	tips, err := c.reachabilityRoots()
+	if err != nil {
+		return nil, err
+	}
+	if !c.IsBare() {
+		index, err := c.ReadIndex()
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range index.Entries {
+			if entry.Mode != object.ModeGitlink {
+				tips = append(tips, entry.Hash)
+			}
+		}
+	}
+
+	var objs []*object.Object
+	visited := map[string]struct{}{}
+	for len(tips) > 0 {
+		hash := tips[len(tips)-1]
+		tips = tips[:len(tips)-1]
+		if _, ok := visited[string(hash)]; ok {
+			continue
+		}
+		visited[string(hash)] = struct{}{}
+
+		obj, err := c.GetObjectContext(ctx, hash)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, obj)
+		switch obj.Type {
+		case object.CommitObject:
+			commit, err := object.NewCommit(obj)
+			if err != nil {
+				return nil, &object.CorruptObjectError{Hash: hash, Err: err}
+			}
+			if err := c.cutShallowParents(commit); err != nil {
+				return nil, err
+			}
+			tips = append(tips, commit.Tree)
+			tips = append(tips, commit.Parents...)
+		case object.TreeObject:
+			tree, err := object.NewTree(obj)
+			if err != nil {
+				return nil, &object.CorruptObjectError{Hash: hash, Err: err}
+			}
+			for _, entry := range tree.Entries {
+				if entry.Mode != object.ModeGitlink {
+					tips = append(tips, entry.Hash)
+				}
+			}
+		case object.TagObject:
+			tag, err := object.NewTag(obj)
+			if err != nil {
+				return nil, &object.CorruptObjectError{Hash: hash, Err: err}
+			}
+			tips = append(tips, tag.Object)
+		}
+	}
+	return objs, nil
+}
+
+// reachabilityRootsは参照、HEAD、ORIG_HEAD、MERGE_HEAD、FETCH_HEADが指すオブジェクトを返す.
+func (c *Client) reachabilityRoots() ([]sha.SHA1, error) {
+	var tips []sha.SHA1
+	refs, err := c.ListRefs("refs/")
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range refs {
+		tips = append(tips, ref.Hash)
+	}
+	for _, name := range []string{"HEAD", OrigHead} {
+		if hash, err := c.ResolveRef(name); err == nil {
+			tips = append(tips, hash)
+		} else if !errors.Is(err, ErrRefNotFound) {
+			return nil, err
+		}
+	}
+	mergeHeads, err := c.ReadMergeHeads()
+	if err != nil {
+		return nil, err
+	}
+	tips = append(tips, mergeHeads...)
+	if fetchHeads, err := c.ReadFetchHead(); err == nil {
+		for _, entry := range fetchHeads {
+			tips = append(tips, entry.Hash)
+		}
+	} else if !errors.Is(err, ErrRefNotFound) {
+		return nil, err
+	}
+	return tips, nil
+}
+
+// RepackResultはRepackの結果.
+type RepackResult struct {
+	// Packは書き込んだパックファイルのパス. オブジェクトがなければ空.
+	Pack string
+	// Objectsはパックに入れたオブジェクトの数、Deltasはそのうちデルタにしたものの数.
+	Objects int
+	Deltas  int
+	// PrunedLooseはパックに入ったので削除したルースオブジェクトの数.
+	PrunedLoose int
+	// Bitmapは書き込んだ.bitmapファイルのパス. 書かなかったときは空.
+	Bitmap string
+}
+
+// RepackOptionsはRepackWithOptionsの動作を指定する.
+type RepackOptions struct {
+	// WriteBitmapなら、新しいパックの.bitmapファイルも書く. 浅いリポジトリでは書かない.
+	WriteBitmap bool
+}
+
+// Repackは辿れるオブジェクトと既存のパックの全オブジェクトを1つのパックファイルにまとめ、
+// 古いパックとパックに入ったルースオブジェクトを削除する. 辿れないルースオブジェクトは残す.
+func (c *Client) Repack() (*RepackResult, error) {
+	return c.RepackContext(context.Background())
+}
+
+// RepackContextはRepackと同じだが、ctxが取り消されたらパックを書き込む前にやめてctx.Err()を返す.
+// 取り消したときは古いパックとルースオブジェクトはそのまま残る.
+func (c *Client) RepackContext(ctx context.Context) (*RepackResult, error) {
+	return c.RepackWithOptions(ctx, RepackOptions{})
+}
+
+// RepackWithOptionsはoptsに従ってRepackContextと同じことをする.
+func (c *Client) RepackWithOptions(ctx context.Context, opts RepackOptions) (*RepackResult, error) {
+	objs, err := c.reachableObjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reachable := len(objs)
+	shallow, err := c.IsShallow()
+	if err != nil {
+		return nil, err
+	}
+
+	c.packMu.Lock()
+	defer c.packMu.Unlock()
+	if err := c.loadPacks(); err != nil {
+		return nil, err
+	}
+	// 既にパックにあるオブジェクトは辿れなくても失わないように新しいパックに入れる.
+	included := map[string]struct{}{}
+	for _, obj := range objs {
+		included[string(obj.Hash)] = struct{}{}
+	}
+	var oldPacks []string
+	for _, p := range c.packs {
+		oldPacks = append(oldPacks, p.Path())
+		for _, entry := range p.Index().Entries() {
+			if _, ok := included[string(entry.Hash)]; ok {
+				continue
+			}
+			obj, err := p.Get(entry.Hash)
+			if err != nil {
+				return nil, &object.CorruptObjectError{Hash: entry.Hash, Err: err}
+			}
+			included[string(entry.Hash)] = struct{}{}
+			objs = append(objs, obj)
+		}
+	}
+
+	result := &RepackResult{Objects: len(objs)}
+	if len(objs) == 0 {
+		return result, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(c.packDir(), 0755); err != nil {
+		return nil, err
+	}
+	// 同じ名前のパックを置き換えたり古いパックを削除したりできるように、先にパックを閉じる.
+	c.closePacks()
+	packPath, deltas, err := c.writePack(objs)
+	if err != nil {
+		return nil, err
+	}
+	result.Pack, result.Deltas = packPath, deltas
+	if opts.WriteBitmap && !shallow {
+		if result.Bitmap, err = c.writeBitmap(packPath, objs, reachable); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, old := range oldPacks {
+		if old == packPath {
+			continue
+		}
+		base := strings.TrimSuffix(old, ".pack")
+		for _, path := range []string{base + ".bitmap", base + ".idx", old} {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+	}
+	if result.PrunedLoose, err = c.pruneLooseObjects(included); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// writePackはobjsを新しいパックファイルと索引に書き込み、パックファイルのパスとデルタの数を返す.
+// 一時ファイルに書いてから、パック、索引の順にpack-<チェックサム>の名前に変える.
+func (c *Client) writePack(objs []*object.Object) (string, int, error) {
+	tmp, err := ioutil.TempFile(c.packDir(), "tmp_pack_")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	bw := bufio.NewWriter(tmp)
+	pw, err := pack.NewWriter(bw, len(objs))
+	if err != nil {
+		return "", 0, err
+	}
+	if err := pw.WriteObjects(objs, pack.DefaultWindow, pack.DefaultMaxDepth); err != nil {
+		return "", 0, err
+	}
+	checksum, err := pw.Close()
+	if err != nil {
+		return "", 0, err
+	}
+	if err := bw.Flush(); err != nil {
+		return "", 0, err
+	}
+	path, err := installPack(tmp, checksum, pw.Entries())
+	if err != nil {
+		return "", 0, err
+	}
+	return path, pw.Deltas(), nil
+}
+
+// installPackは書き終えた一時ファイルtmpを閉じて索引を書き、パック、索引の順にpack-<チェックサム>の名前に変える.
+// 索引が揃うまでloadPacksはパックを読まないので、途中のパックを他のプロセスが使うことはない.
+func installPack(tmp *os.File, checksum sha.SHA1, entries []pack.IndexEntry) (string, error) {
+	if err := tmp.Sync(); err != nil {
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	var idx bytes.Buffer
+	if err := pack.WriteIndex(&idx, entries, checksum); err != nil {
+		return "", err
+	}
+	base := filepath.Join(filepath.Dir(tmp.Name()), "pack-"+checksum.String())
+	os.Chmod(tmp.Name(), 0444)
+	if err := os.Rename(tmp.Name(), base+".pack"); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(base+".idx.tmp", idx.Bytes(), 0444); err != nil {
+		return "", err
+	}
+	if err := os.Rename(base+".idx.tmp", base+".idx"); err != nil {
+		os.Remove(base + ".idx.tmp")
+		return "", err
+	}
+	return base + ".pack", nil
+}
+
+// IndexPackはrから受け取ったパックファイルをobjects/packに置いて索引を作り、パックファイルのパスを返す.
+func (c *Client) IndexPack(r io.Reader) (string, error) {
+	if err := os.MkdirAll(c.packDir(), 0755); err != nil {
+		return "", err
+	}
+	tmp, err := ioutil.TempFile(c.packDir(), "tmp_pack_")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	checksum, entries, err := pack.IndexPack(r, tmp)
+	if err != nil {
+		return "", err
+	}
+	c.packMu.Lock()
+	defer c.packMu.Unlock()
+	// 新しいパックのオブジェクトが次の読み込みで見つかるように読み込み直させる.
+	c.closePacks()
+	return installPack(tmp, checksum, entries)
+}
+
+// pruneLooseObjectsはpackedに含まれるルースオブジェクトを削除し、空になったディレクトリも削除する.
+func (c *Client) pruneLooseObjects(packed map[string]struct{}) (int, error) {
+	pruned := 0
+	dirs := map[string]struct{}{}
+	err := c.forEachLooseObject(func(hash sha.SHA1, path string) error {
+		if _, ok := packed[string(hash)]; !ok {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		pruned++
+		dirs[filepath.Dir(path)] = struct{}{}
+		return nil
+	})
+	// 空でないディレクトリは削除できないので、そのまま残る.
+	for dir := range dirs {
+		os.Remove(dir)
+	}
+	return pruned, err
+}
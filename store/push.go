@@ -0,0 +1,253 @@
+package store
+
+import (
+	"io"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/pack"
+	"github.com/kanon1343/fsegit/sha"
+)
+
+// PackOptionsはWritePushPackの動作を指定する.
+type PackOptions struct {
+	// Thinなら、リモートが持っているオブジェクトをベースにしたREF_DELTAを使う.
+	// 受け取る側はベースを自分のリポジトリから補ってパックを完成させる.
+	Thin bool
+}
+
+// pushObjectはpushで送るオブジェクトと、その作業ツリー上のパス.
+type pushObject struct {
+	obj  *object.Object
+	path string
+}
+
+// WritePushPackはwantsから辿れて、havesからは辿れないオブジェクトをパックにしてwに書き込み、オブジェクトの数を返す.
+// havesは手元にもあるリモートの参照の指すコミット. havesの履歴に含まれるかどうかはコミットだけで判定し、
+// ツリーとブロブは境界のコミット(新しいコミットの親のうちhavesから辿れるもの)のツリーにあるものだけを除く.
+func (c *Client) WritePushPack(w io.Writer, wants, haves []sha.SHA1, opts PackOptions) (int, error) {
+	known, err := c.reachableCommits(haves)
+	if err != nil {
+		return 0, err
+	}
+
+	// 注釈付きタグはタグのオブジェクトを送り、指しているコミットから辿る.
+	var objs []pushObject
+	var queue []sha.SHA1
+	tags := map[string]struct{}{}
+	for _, want := range wants {
+		for {
+			obj, err := c.GetObject(want)
+			if err != nil {
+				return 0, err
+			}
+			if obj.Type != object.TagObject {
+				break
+			}
+			tag, err := object.NewTag(obj)
+			if err != nil {
+				return 0, err
+			}
+			if _, ok := tags[string(want)]; !ok {
+				tags[string(want)] = struct{}{}
+				objs = append(objs, pushObject{obj: obj})
+			}
+			want = tag.Object
+		}
+		queue = append(queue, want)
+	}
+
+	// 新しいコミットを集め、境界のコミットのツリーを覚えておく.
+	var commits []*object.Commit
+	var boundaryTrees []sha.SHA1
+	visited := map[string]struct{}{}
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		if _, ok := visited[string(hash)]; ok {
+			continue
+		}
+		visited[string(hash)] = struct{}{}
+		if _, ok := known[string(hash)]; ok {
+			obj, err := c.GetObject(hash)
+			if err != nil {
+				return 0, err
+			}
+			commit, err := object.NewCommit(obj)
+			if err != nil {
+				return 0, err
+			}
+			boundaryTrees = append(boundaryTrees, commit.Tree)
+			continue
+		}
+		commit, err := c.GetCommit(hash)
+		if err != nil {
+			return 0, err
+		}
+		commits = append(commits, commit)
+		queue = append(queue, commit.Parents...)
+	}
+
+	// 境界のツリーにあるオブジェクトはリモートにある. パスごとに覚えてthin packのベースにする.
+	uninteresting := map[string]struct{}{}
+	basesByPath := map[string]sha.SHA1{}
+	for _, tree := range boundaryTrees {
+		if err := c.markTree(tree, "", uninteresting, basesByPath); err != nil {
+			return 0, err
+		}
+	}
+
+	added := map[string]struct{}{}
+	for _, commit := range commits {
+		obj, err := c.GetObject(commit.Hash)
+		if err != nil {
+			return 0, err
+		}
+		objs = append(objs, pushObject{obj: obj})
+		if err := c.collectTree(commit.Tree, "", uninteresting, added, &objs); err != nil {
+			return 0, err
+		}
+	}
+
+	// thin packでは、同じパスにあるリモートのオブジェクトとのデルタが十分小さければREF_DELTAにする.
+	type thinDelta struct {
+		obj   *object.Object
+		base  sha.SHA1
+		delta []byte
+	}
+	var thin []thinDelta
+	var rest []*object.Object
+	for _, po := range objs {
+		if opts.Thin && po.obj.Type != object.CommitObject {
+			if base, ok := basesByPath[po.path]; ok {
+				baseObj, err := c.GetObject(base)
+				if err != nil {
+					return 0, err
+				}
+				if baseObj.Type == po.obj.Type {
+					delta := pack.ComputeDelta(baseObj.Data, po.obj.Data)
+					if len(delta) < po.obj.Size/2 {
+						thin = append(thin, thinDelta{po.obj, base, delta})
+						continue
+					}
+				}
+			}
+		}
+		rest = append(rest, po.obj)
+	}
+
+	pw, err := pack.NewWriter(w, len(thin)+len(rest))
+	if err != nil {
+		return 0, err
+	}
+	for _, d := range thin {
+		if err := pw.WriteRefDelta(d.obj, d.base, d.delta); err != nil {
+			return 0, err
+		}
+	}
+	if err := pw.WriteObjects(rest, pack.DefaultWindow, pack.DefaultMaxDepth); err != nil {
+		return 0, err
+	}
+	if _, err := pw.Close(); err != nil {
+		return 0, err
+	}
+	return len(thin) + len(rest), nil
+}
+
+// collectTreeはtreeとその中のオブジェクトのうち、uninterestingにもaddedにもないものをobjsに加える.
+// リモートにあるツリーの中身はリモートにもあるので、その先は辿らない.
+func (c *Client) collectTree(tree sha.SHA1, dir string, uninteresting, added map[string]struct{}, objs *[]pushObject) error {
+	if _, ok := uninteresting[string(tree)]; ok {
+		return nil
+	}
+	if _, ok := added[string(tree)]; ok {
+		return nil
+	}
+	added[string(tree)] = struct{}{}
+	obj, err := c.GetObject(tree)
+	if err != nil {
+		return err
+	}
+	t, err := object.NewTree(obj)
+	if err != nil {
+		return err
+	}
+	*objs = append(*objs, pushObject{obj: obj, path: dir})
+	for _, entry := range t.Entries {
+		path := entry.Name
+		if dir != "" {
+			path = dir + "/" + entry.Name
+		}
+		switch {
+		case entry.Mode == object.ModeGitlink:
+		case entry.Mode.IsTree():
+			if err := c.collectTree(entry.Hash, path, uninteresting, added, objs); err != nil {
+				return err
+			}
+		default:
+			if _, ok := uninteresting[string(entry.Hash)]; ok {
+				continue
+			}
+			if _, ok := added[string(entry.Hash)]; ok {
+				continue
+			}
+			added[string(entry.Hash)] = struct{}{}
+			blob, err := c.GetObject(entry.Hash)
+			if err != nil {
+				return err
+			}
+			*objs = append(*objs, pushObject{obj: blob, path: path})
+		}
+	}
+	return nil
+}
+
+// markTreeはtreeとその中の全てのオブジェクトをuninterestingに加え、パスごとのハッシュをbasesByPathに記録する.
+func (c *Client) markTree(tree sha.SHA1, dir string, uninteresting map[string]struct{}, basesByPath map[string]sha.SHA1) error {
+	if _, ok := uninteresting[string(tree)]; ok {
+		return nil
+	}
+	uninteresting[string(tree)] = struct{}{}
+	basesByPath[dir] = tree
+	t, err := c.GetTree(tree)
+	if err != nil {
+		return err
+	}
+	for _, entry := range t.Entries {
+		path := entry.Name
+		if dir != "" {
+			path = dir + "/" + entry.Name
+		}
+		switch {
+		case entry.Mode == object.ModeGitlink:
+		case entry.Mode.IsTree():
+			if err := c.markTree(entry.Hash, path, uninteresting, basesByPath); err != nil {
+				return err
+			}
+		default:
+			uninteresting[string(entry.Hash)] = struct{}{}
+			basesByPath[path] = entry.Hash
+		}
+	}
+	return nil
+}
+
+// reachableCommitsはtipsから親を辿って到達できる全てのコミットを返す. コミットでないtipは無視する.
+// パックの.bitmapファイルがあれば、ビット列のあるコミットより先はコミットを読まない.
+func (c *Client) reachableCommits(tips []sha.SHA1) (map[string]struct{}, error) {
+	var commits []sha.SHA1
+	for _, tip := range tips {
+		if hash, err := c.PeelToCommit(tip); err == nil {
+			commits = append(commits, hash)
+		}
+	}
+	set, err := c.Reachable(commits, false)
+	if err != nil {
+		return nil, err
+	}
+	reachable := map[string]struct{}{}
+	set.ForEach(object.CommitObject, func(hash sha.SHA1, objectType object.Type) error {
+		reachable[string(hash)] = struct{}{}
+		return nil
+	})
+	return reachable, nil
+}
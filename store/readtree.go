@@ -0,0 +1,136 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+)
+
+// ReadTreeはインデックスをtree(コミットならそのツリー)の内容で置き換える. 作業ツリーには触れない.
+// コンフリクト中のエントリも捨てる. エントリにはファイルの情報がないので、次に状態を調べるときに
+// 作業ツリーの内容と比べ直すことになる.
+func (c *Client) ReadTree(tree sha.SHA1) error {
+	index, err := c.ReadIndex()
+	if err != nil {
+		return err
+	}
+	index.Entries = nil
+	index.Cache = nil
+	index.ResolveUndo = nil
+	if err := c.WalkTree(tree, nil, func(path string, entry object.TreeEntry) error {
+		index.Add(&IndexEntry{Mode: entry.Mode, Hash: entry.Hash, Path: path})
+		return nil
+	}); err != nil {
+		return err
+	}
+	return c.WriteIndex(index)
+}
+
+// ReadTreeMergeはgitのread-tree -mと同じく、1から3個のツリーを今のインデックスと合わせて読む. 作業ツリーには触れない.
+//
+// ツリーが1つならResetIndexと同じで、内容の変わらないエントリはファイルの情報を引き継ぐ.
+// 2つなら1つ目(今のHEAD)から2つ目への切り替えで、2つのツリーで違うパスだけを2つ目の内容にする.
+// 3つなら1つ目を共通の祖先とする3方向マージで、片方だけが変えたパスはその内容にし、
+// 両方が別々に変えたパスはステージ1/2/3のエントリとして残す.
+// どちらの場合も、書き換えるパスのインデックスが元の内容(2つなら1つ目、3つなら2つ目)と違えば
+// 何も変えずにErrWouldOverwriteを返す. インデックスにコンフリクトがあればErrUnmergedを返す.
+func (c *Client) ReadTreeMerge(trees ...sha.SHA1) error {
+	if len(trees) < 1 || len(trees) > 3 {
+		return fmt.Errorf("read-tree -m takes 1 to 3 trees, got %d", len(trees))
+	}
+	index, err := c.ReadIndex()
+	if err != nil {
+		return err
+	}
+	if unmerged := index.Unmerged(); len(unmerged) > 0 {
+		return fmt.Errorf("%w : %s", ErrUnmerged, strings.Join(unmerged, ", "))
+	}
+	if len(trees) == 1 {
+		return c.ResetIndex(trees[0])
+	}
+
+	files := make([]map[string]object.TreeEntry, len(trees))
+	seen := map[string]struct{}{}
+	for i, tree := range trees {
+		if files[i], err = c.treeFiles(tree); err != nil {
+			return err
+		}
+		for path := range files[i] {
+			seen[path] = struct{}{}
+		}
+	}
+	for _, entry := range index.Entries {
+		seen[entry.Path] = struct{}{}
+	}
+	paths := make([]string, 0, len(seen))
+	for path := range seen {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	merged := &Index{Version: index.Version, Extensions: index.Extensions}
+	var overwritten []string
+	for _, path := range paths {
+		current := index.Entry(path)
+		// keepは今のエントリをそのまま残す. takeはツリーのエントリにするが、今と同じならファイルの情報を引き継ぐ.
+		keep := func() {
+			if current != nil {
+				merged.Add(current)
+			}
+		}
+		take := func(entry object.TreeEntry, ok bool) {
+			switch {
+			case !ok:
+			case indexMatches(current, entry, ok):
+				merged.Add(current)
+			default:
+				merged.Add(&IndexEntry{Mode: entry.Mode, Hash: entry.Hash, Path: path})
+			}
+		}
+
+		if len(trees) == 2 {
+			h, hok := files[0][path]
+			m, mok := files[1][path]
+			switch {
+			case sameEntryOrMissing(h, hok, m, mok), indexMatches(current, m, mok):
+				keep()
+			case indexMatches(current, h, hok):
+				take(m, mok)
+			default:
+				overwritten = append(overwritten, path)
+			}
+			continue
+		}
+
+		b, bok := files[0][path]
+		o, ook := files[1][path]
+		t, tok := files[2][path]
+		switch {
+		case sameEntryOrMissing(o, ook, t, tok), sameEntryOrMissing(b, bok, t, tok):
+			// 相手の側は何も変えていないので、インデックスの内容を残す.
+			keep()
+		case !indexMatches(current, o, ook):
+			overwritten = append(overwritten, path)
+		case sameEntryOrMissing(b, bok, o, ook):
+			take(t, tok)
+		default:
+			merged.AddUnmerged(path, unmergedEntries(b, bok, o, ook, t, tok)...)
+		}
+	}
+	if len(overwritten) > 0 {
+		return fmt.Errorf("%w : %s", ErrWouldOverwrite, strings.Join(overwritten, ", "))
+	}
+	return c.WriteIndex(merged)
+}
+
+// indexMatchesはインデックスのエントリentryとツリーのエントリtが、どちらもないか同じ内容とモードかを返す.
+func indexMatches(entry *IndexEntry, t object.TreeEntry, ok bool) bool {
+	if entry == nil {
+		return !ok
+	}
+	return ok && entry.Mode == t.Mode && bytes.Equal(entry.Hash, t.Hash)
+}
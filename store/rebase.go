@@ -0,0 +1,26 @@
+package store
+
+import (
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+)
+
+// RebaseCommitsはheadから辿れてupstreamから辿れないコミットを、親が子より先になる順で返す.
+// rebaseで付け替えるコミットの一覧で、gitと同じくマージコミットは含めない.
+func (c *Client) RebaseCommits(upstream, head sha.SHA1) ([]*object.Commit, error) {
+	excluded, err := c.reachableCommits([]sha.SHA1{upstream})
+	if err != nil {
+		return nil, err
+	}
+	var commits []*object.Commit
+	err = c.WalkHistoryReverse([]sha.SHA1{head}, func(hash sha.SHA1) bool {
+		_, ok := excluded[string(hash)]
+		return ok
+	}, func(commit *object.Commit) error {
+		if len(commit.Parents) <= 1 {
+			commits = append(commits, commit)
+		}
+		return nil
+	})
+	return commits, err
+}
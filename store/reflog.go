@@ -0,0 +1,337 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/util"
+)
+
+// reflogDirは参照の更新履歴を置くディレクトリ. logs/HEAD、logs/refs/heads/mainのように参照と同じ名前で置く.
+const reflogDir = "logs"
+
+// zeroHashは参照が作られる前や削除された後を表すreflogのハッシュ.
+var zeroHash = make(sha.SHA1, 20)
+
+// ReflogEntryはreflogの1行. 参照がOldからNewに動いたことを表す.
+type ReflogEntry struct {
+	// Oldは更新前のコミット. 参照が作られたときはnil.
+	Old sha.SHA1
+	// Newは更新後のコミット.
+	New       sha.SHA1
+	Committer object.Signature
+	// Messageは"commit: Add README"や"checkout: moving from main to topic"のような更新の理由.
+	Message string
+}
+
+// Encodeはreflogの1行("<old> <new> <committer>\t<message>")を改行なしで返す.
+func (e ReflogEntry) Encode() string {
+	old := e.Old
+	if old == nil {
+		old = zeroHash
+	}
+	// メッセージは1行に収める. gitと同じく改行は空白にする.
+	message := strings.Join(strings.Fields(e.Message), " ")
+	return fmt.Sprintf("%s %s %s\t%s", old, e.New, e.Committer.Encode(), message)
+}
+
+// parseReflogEntryはreflogの1行を読む.
+func parseReflogEntry(line string) (ReflogEntry, error) {
+	if len(line) < 83 || line[40] != ' ' || line[81] != ' ' {
+		return ReflogEntry{}, fmt.Errorf("%w : %s", ErrInvalidReflog, line)
+	}
+	old, err := parseRefHash(line[:40])
+	if err != nil {
+		return ReflogEntry{}, fmt.Errorf("%w : %s", ErrInvalidReflog, line)
+	}
+	newHash, err := parseRefHash(line[41:81])
+	if err != nil {
+		return ReflogEntry{}, fmt.Errorf("%w : %s", ErrInvalidReflog, line)
+	}
+	ident, message := line[82:], ""
+	if i := strings.IndexByte(ident, '\t'); i >= 0 {
+		ident, message = ident[:i], ident[i+1:]
+	}
+	committer, err := object.ParseSignature(ident)
+	if err != nil {
+		return ReflogEntry{}, fmt.Errorf("%w : %s", ErrInvalidReflog, err)
+	}
+	if bytes.Equal(old, zeroHash) {
+		old = nil
+	}
+	return ReflogEntry{Old: old, New: newHash, Committer: committer, Message: message}, nil
+}
+
+func (c *Client) reflogPath(name string) string {
+	return filepath.Join(c.gitDir, reflogDir, filepath.FromSlash(name))
+}
+
+// shouldLogRefはnameの更新をreflogに残すかを返す. gitのcore.logAllRefUpdatesと同じく、
+// 作業ツリーのあるリポジトリではHEADとブランチ、リモート追跡ブランチを記録し、"always"なら全ての参照を記録する.
+// 既にreflogがある参照は常に記録する.
+func (c *Client) shouldLogRef(name string) (bool, error) {
+	if _, err := os.Stat(c.reflogPath(name)); err == nil {
+		return true, nil
+	}
+	// refs/stashはreflogで積み重ねたエントリを管理するので、設定にかかわらず記録する.
+	if name == StashRef {
+		return true, nil
+	}
+	cfg, err := c.Config()
+	if err != nil {
+		return false, err
+	}
+	value, ok := cfg.Get("core.logallrefupdates")
+	if ok && strings.EqualFold(value, "always") {
+		return strings.HasPrefix(name, "refs/") || name == "HEAD", nil
+	}
+	enabled, err := cfg.GetBool("core.logallrefupdates", !c.IsBare())
+	if err != nil || !enabled {
+		return false, err
+	}
+	for _, prefix := range []string{"refs/heads/", "refs/remotes/", "refs/notes/"} {
+		if strings.HasPrefix(name, prefix) {
+			return true, nil
+		}
+	}
+	return name == "HEAD", nil
+}
+
+// AppendReflogはnameのreflogに、oldからnewへの更新を1行追加する. 記録しない参照なら何もしない.
+// nameが参照の名前として不正ならErrInvalidRefNameを返す.
+func (c *Client) AppendReflog(name string, old, new sha.SHA1, message string) error {
+	if err := CheckRefName(name); err != nil {
+		return err
+	}
+	if ok, err := c.shouldLogRef(name); err != nil || !ok {
+		return err
+	}
+	committer, err := c.reflogIdentity()
+	if err != nil {
+		return err
+	}
+	entry := ReflogEntry{Old: old, New: new, Committer: committer, Message: message}
+	if entry.New == nil {
+		entry.New = zeroHash
+	}
+
+	logPath := c.reflogPath(name)
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(util.LongPath(logPath), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(entry.Encode() + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// reflogIdentityはreflogに書くコミッターを返す. 名前やメールアドレスが設定されていなくても参照の更新は
+// 止めたくないので、gitと同じくログイン名とホスト名から作った署名を代わりに使う.
+func (c *Client) reflogIdentity() (object.Signature, error) {
+	committer, err := c.Identity(Committer)
+	if !errors.Is(err, ErrNoIdentity) {
+		return committer, err
+	}
+	name := "unknown"
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		name = u.Username
+	}
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "localhost"
+	}
+	return object.Signature{Name: name, Email: name + "@" + host, When: time.Now()}, nil
+}
+
+// ReadReflogはnameのreflogを新しい順に返す. reflogがなければErrNoReflogを返す.
+func (c *Client) ReadReflog(name string) ([]ReflogEntry, error) {
+	f, err := os.Open(util.LongPath(c.reflogPath(name)))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w : %s", ErrNoReflog, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []ReflogEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		if scanner.Text() == "" {
+			continue
+		}
+		entry, err := parseReflogEntry(scanner.Text())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
+
+// ReflogAtはnameのreflogでn個前の更新の後に参照が指していたコミットを返す. 0なら最新の更新になる.
+// reflogがn個より短ければErrReflogTooShortを返す.
+func (c *Client) ReflogAt(name string, n int) (sha.SHA1, error) {
+	entries, err := c.ReadReflog(name)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 || n >= len(entries) {
+		return nil, fmt.Errorf("%w : %s has only %d entries", ErrReflogTooShort, name, len(entries))
+	}
+	return entries[n].New, nil
+}
+
+// DropReflogEntryはnameのreflogからn個前(0が最新)の更新を取り除く. 残りの行がつながるように、
+// 取り除いた行の次の更新の前の値を書き換える. 最新の行を取り除いたら参照を1つ前の値に戻し、
+// reflogが空になったら参照ごと削除する.
+func (c *Client) DropReflogEntry(name string, n int) error {
+	entries, err := c.ReadReflog(name)
+	if err != nil {
+		return err
+	}
+	if n < 0 || n >= len(entries) {
+		return fmt.Errorf("%w : %s has only %d entries", ErrReflogTooShort, name, len(entries))
+	}
+	if len(entries) == 1 {
+		return c.DeleteRef(name)
+	}
+	if n > 0 {
+		entries[n-1].Old = entries[n].Old
+	}
+	entries = append(entries[:n], entries[n+1:]...)
+
+	var sb strings.Builder
+	for i := len(entries) - 1; i >= 0; i-- {
+		sb.WriteString(entries[i].Encode() + "\n")
+	}
+	lock, err := util.Lock(c.reflogPath(name), refLockTimeout)
+	if err != nil {
+		return err
+	}
+	if _, err := lock.Write([]byte(sb.String())); err != nil {
+		lock.Rollback()
+		return err
+	}
+	if err := lock.Commit(); err != nil {
+		return err
+	}
+	if n == 0 {
+		return c.WriteRef(name, entries[0].New)
+	}
+	return nil
+}
+
+// deleteReflogは削除した参照nameのreflogを取り除く.
+func (c *Client) deleteReflog(name string) error {
+	logPath := c.reflogPath(name)
+	if err := os.Remove(logPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	c.removeEmptyLogDirs(filepath.Dir(logPath))
+	return nil
+}
+
+// renameReflogは参照の名前を変えたときに、reflogも新しい名前に移す.
+func (c *Client) renameReflog(oldName, newName string) error {
+	oldPath, newPath := c.reflogPath(oldName), c.reflogPath(newName)
+	if _, err := os.Stat(oldPath); os.IsNotExist(err) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(newPath), 0755); err != nil {
+		return err
+	}
+	if err := util.Rename(oldPath, newPath); err != nil {
+		return err
+	}
+	c.removeEmptyLogDirs(filepath.Dir(oldPath))
+	return nil
+}
+
+// removeEmptyLogDirsはreflogを取り除いて空になったdirとその親をlogs/refs/heads/などの手前まで取り除く.
+func (c *Client) removeEmptyLogDirs(dir string) {
+	refsDir := filepath.Join(c.gitDir, reflogDir, "refs")
+	for {
+		parent := filepath.Dir(dir)
+		if parent == refsDir || !strings.HasPrefix(parent, refsDir) {
+			return
+		}
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = parent
+	}
+}
+
+// UpdateRefはnameの参照をhashに書き換え、messageを理由としてreflogに記録する.
+// HEADがnameのブランチを指していれば、HEADのreflogにも同じ更新を記録する.
+func (c *Client) UpdateRef(name string, hash sha.SHA1, message string) error {
+	return c.UpdateRefIfMatch(name, hash, nil, message)
+}
+
+// UpdateRefIfMatchはUpdateRefと同じだが、参照の値がexpectedのときだけ書き換える.
+// expectedがnilなら今の値を問わず、全て0のハッシュなら参照がまだないときだけ作る.
+// 別の値に変わっていればErrRefChangedを返す.
+func (c *Client) UpdateRefIfMatch(name string, hash, expected sha.SHA1, message string) error {
+	if err := CheckRefName(name); err != nil {
+		return err
+	}
+	old, err := c.ResolveRef(name)
+	if err != nil && !errors.Is(err, ErrRefNotFound) {
+		return err
+	}
+	if err := c.writeRefFile(name, hash.String()+"\n", expected); err != nil {
+		return err
+	}
+	if err := c.AppendReflog(name, old, hash, message); err != nil {
+		return err
+	}
+	if name == "HEAD" {
+		return nil
+	}
+	if target, err := c.ReadSymbolicRef("HEAD"); err == nil && target == name {
+		return c.AppendReflog("HEAD", old, hash, message)
+	}
+	return nil
+}
+
+// AttachHeadはHEADをブランチbranchへのシンボリック参照にし、HEADのreflogに移動を記録する.
+// ブランチにまだコミットがなければ記録するものがないのでreflogには書かない.
+func (c *Client) AttachHead(branch, message string) error {
+	old, err := c.ReadHead()
+	if err != nil {
+		return err
+	}
+	if err := c.WriteSymbolicRef("HEAD", branch); err != nil {
+		return err
+	}
+	hash, err := c.ResolveRef(branch)
+	if errors.Is(err, ErrRefNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return c.AppendReflog("HEAD", old.Hash, hash, message)
+}
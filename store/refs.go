@@ -0,0 +1,429 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kanon1343/fsegit/metrics"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/util"
+)
+
+const symrefPrefix = "ref: "
+
+// Refは参照の名前と指しているオブジェクトを表す.
+type Ref struct {
+	Name string
+	Hash sha.SHA1
+	// Targetはシンボリック参照の参照先. 通常の参照では空.
+	Target string
+}
+
+// 参照の名前を補完するときの候補. gitのref_rev_parse_rulesと同じ順序.
+var refRevParseRules = []string{
+	"%s",
+	"refs/%s",
+	"refs/tags/%s",
+	"refs/heads/%s",
+	"refs/remotes/%s",
+	"refs/remotes/%s/HEAD",
+}
+
+// ReadRefはnameの参照を1段だけ読む. シンボリック参照の場合はTargetに参照先が入る.
+func (c *Client) ReadRef(name string) (*Ref, error) {
+	buf, err := ioutil.ReadFile(filepath.Join(c.gitDir, filepath.FromSlash(name)))
+	if os.IsNotExist(err) {
+		return c.readPackedRef(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	content := strings.TrimSpace(string(buf))
+	if strings.HasPrefix(content, symrefPrefix) {
+		return &Ref{Name: name, Target: strings.TrimPrefix(content, symrefPrefix)}, nil
+	}
+	// FETCH_HEADやMERGE_HEADは複数行を持ち得る. 最初の行の先頭のハッシュがその参照の値になる.
+	if i := strings.IndexAny(content, "\t\n "); i >= 0 {
+		content = content[:i]
+	}
+	hash, err := parseRefHash(content)
+	if err != nil {
+		return nil, fmt.Errorf("%w : %s", err, name)
+	}
+	return &Ref{Name: name, Hash: hash}, nil
+}
+
+// refLockTimeoutは参照のロックが取れるまで待つ時間. gitのcore.filesRefLockTimeoutのデフォルトと同じ.
+const refLockTimeout = 100 * time.Millisecond
+
+// WriteRefはnameの参照がhashを指すように書き込む.
+func (c *Client) WriteRef(name string, hash sha.SHA1) error {
+	return c.writeRefFile(name, hash.String()+"\n", nil)
+}
+
+// WriteSymbolicRefはnameをtargetへのシンボリック参照("ref: <target>")として書き込む.
+// targetが参照の名前として不正ならErrInvalidRefNameを返す.
+func (c *Client) WriteSymbolicRef(name, target string) error {
+	if err := CheckRefName(target); err != nil {
+		return err
+	}
+	return c.writeRefFile(name, symrefPrefix+target+"\n", nil)
+}
+
+// ReadSymbolicRefはシンボリック参照nameの参照先を返す. nameがシンボリック参照でなければErrNotSymbolicRefを返す.
+func (c *Client) ReadSymbolicRef(name string) (string, error) {
+	ref, err := c.ReadRef(name)
+	if err != nil {
+		return "", err
+	}
+	if ref.Target == "" {
+		return "", fmt.Errorf("%w : %s", ErrNotSymbolicRef, name)
+	}
+	return ref.Target, nil
+}
+
+// writeRefFileは"<name>.lock"でロックしてから参照ファイルを置き換える.
+// fsyncしてからrenameするので、クラッシュしても参照が途中まで書かれた状態にはならない.
+// oldがnilでなければ、ロックを取った後で参照の値がoldのままかをcheckRefValueで確かめる.
+// nameは"../"などで管理ディレクトリの外を指さないように、CheckRefNameで確かめてから書き込む.
+func (c *Client) writeRefFile(name, content string, old sha.SHA1) error {
+	if err := CheckRefName(name); err != nil {
+		return err
+	}
+	refPath := filepath.Join(c.gitDir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(refPath), 0755); err != nil {
+		return err
+	}
+	start := time.Now()
+	lock, err := util.Lock(refPath, refLockTimeout)
+	c.recorder.Observe(metrics.LockWaitTime, time.Since(start))
+	if err != nil {
+		return err
+	}
+	if err := c.checkRefValue(name, old); err != nil {
+		lock.Rollback()
+		return err
+	}
+	if _, err := lock.Write([]byte(content)); err != nil {
+		lock.Rollback()
+		return err
+	}
+	return lock.Commit()
+}
+
+// DeleteRefはnameの参照をルースファイルとpacked-refsの両方から取り除き、reflogも削除する.
+// 存在しなければErrRefNotFoundを返す.
+func (c *Client) DeleteRef(name string) error {
+	if err := c.deleteRef(name); err != nil {
+		return err
+	}
+	return c.deleteReflog(name)
+}
+
+// DeleteRefIfMatchはnameの参照の値がoldのときだけDeleteRefと同じように削除する.
+// 別の値に変わっていればErrRefChangedを返す.
+func (c *Client) DeleteRefIfMatch(name string, old sha.SHA1) error {
+	refPath := filepath.Join(c.gitDir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(refPath), 0755); err != nil {
+		return err
+	}
+	lock, err := util.Lock(refPath, refLockTimeout)
+	if err != nil {
+		return err
+	}
+	// ロックファイルは削除が終わるまで持っておき、最後に捨てる.
+	err = c.checkRefValue(name, old)
+	if err == nil {
+		err = c.DeleteRef(name)
+	}
+	lock.Rollback()
+	c.removeEmptyRefDirs(filepath.Dir(refPath))
+	return err
+}
+
+// checkRefValueはnameの参照の今の値がoldと一致するかを調べる. oldがnilなら何も調べず、
+// 全て0のハッシュなら参照がまだないことを求める. 一致しなければErrRefChangedを返す.
+func (c *Client) checkRefValue(name string, old sha.SHA1) error {
+	if old == nil {
+		return nil
+	}
+	current, err := c.ResolveRef(name)
+	if errors.Is(err, ErrRefNotFound) {
+		current = nil
+	} else if err != nil {
+		return err
+	}
+	switch {
+	case bytes.Equal(old, zeroHash):
+		if current != nil {
+			return fmt.Errorf("%w : %s already exists", ErrRefChanged, name)
+		}
+	case current == nil:
+		return fmt.Errorf("%w : %s does not exist but expected %s", ErrRefChanged, name, old)
+	case !bytes.Equal(current, old):
+		return fmt.Errorf("%w : %s is at %s but expected %s", ErrRefChanged, name, current, old)
+	}
+	return nil
+}
+
+func (c *Client) deleteRef(name string) error {
+	found := false
+	refPath := filepath.Join(c.gitDir, filepath.FromSlash(name))
+	if err := os.Remove(refPath); err == nil {
+		found = true
+		c.removeEmptyRefDirs(filepath.Dir(refPath))
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	packedPath := filepath.Join(c.gitDir, "packed-refs")
+	lock, err := util.Lock(packedPath, refLockTimeout)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(packedPath)
+	if os.IsNotExist(err) {
+		lock.Rollback()
+		if !found {
+			return fmt.Errorf("%w : %s", ErrRefNotFound, name)
+		}
+		return nil
+	}
+	if err != nil {
+		lock.Rollback()
+		return err
+	}
+
+	// 対象の行と、その直後のピール結果("^"で始まる行)を取り除く.
+	var kept []string
+	removed := false
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		if removed && line[0] == '^' {
+			continue
+		}
+		removed = false
+		if fields := strings.SplitN(strings.TrimSuffix(line, "\n"), " ", 2); len(fields) == 2 && fields[1] == name && line[0] != '#' {
+			removed, found = true, true
+			continue
+		}
+		kept = append(kept, line)
+	}
+	if !found {
+		lock.Rollback()
+		return fmt.Errorf("%w : %s", ErrRefNotFound, name)
+	}
+	if _, err := lock.Write([]byte(strings.Join(kept, ""))); err != nil {
+		lock.Rollback()
+		return err
+	}
+	return lock.Commit()
+}
+
+// removeEmptyRefDirsは参照を削除して空になったdirとその親をrefs/heads/などの手前まで取り除く.
+// 空でないディレクトリは取り除けないので、そこで止まる.
+func (c *Client) removeEmptyRefDirs(dir string) {
+	refsDir := filepath.Join(c.gitDir, "refs")
+	for {
+		parent := filepath.Dir(dir)
+		if parent == refsDir || !strings.HasPrefix(parent, refsDir) {
+			return
+		}
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = parent
+	}
+}
+
+// CheckRefNameはnameが参照の名前として使えるかをgit check-ref-formatと同じ規則で調べる.
+func CheckRefName(name string) error {
+	invalid := func(reason string) error {
+		return fmt.Errorf("%w : '%s' %s", ErrInvalidRefName, name, reason)
+	}
+	if name == "" || name == "@" {
+		return invalid("is not allowed")
+	}
+	if strings.HasSuffix(name, ".") || strings.HasSuffix(name, "/") {
+		return invalid("must not end with '.' or '/'")
+	}
+	if strings.Contains(name, "..") || strings.Contains(name, "@{") {
+		return invalid("must not contain '..' or '@{'")
+	}
+	for _, r := range name {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(" ~^:?*[\\", r) {
+			return invalid(fmt.Sprintf("must not contain %q", r))
+		}
+	}
+	for _, component := range strings.Split(name, "/") {
+		if component == "" || component[0] == '.' || strings.HasSuffix(component, ".lock") {
+			return invalid("has an invalid path component")
+		}
+	}
+	return nil
+}
+
+// ResolveRefはシンボリック参照を辿ってnameが指すオブジェクトのハッシュを返す.
+func (c *Client) ResolveRef(name string) (sha.SHA1, error) {
+	for depth := 0; depth < 5; depth++ {
+		ref, err := c.ReadRef(name)
+		if err != nil {
+			return nil, err
+		}
+		if ref.Target == "" {
+			return ref.Hash, nil
+		}
+		name = ref.Target
+	}
+	return nil, ErrSymrefTooDeep
+}
+
+// DerefRefNameはシンボリック参照を辿って、値を直接持つ参照の名前を返す. 辿った先の参照はまだなくてもよい.
+func (c *Client) DerefRefName(name string) (string, error) {
+	for depth := 0; depth < 5; depth++ {
+		ref, err := c.ReadRef(name)
+		if errors.Is(err, ErrRefNotFound) {
+			return name, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if ref.Target == "" {
+			return name, nil
+		}
+		name = ref.Target
+	}
+	return "", ErrSymrefTooDeep
+}
+
+// DWIMRefは"main"や"v1.0"のような省略された参照名を完全な名前に展開する.
+func (c *Client) DWIMRef(name string) (string, error) {
+	for _, rule := range refRevParseRules {
+		fullName := fmt.Sprintf(rule, name)
+		if _, err := c.ResolveRef(fullName); err == nil {
+			return fullName, nil
+		}
+	}
+	return "", fmt.Errorf("%w : %s", ErrRefNotFound, name)
+}
+
+// ListRefsはprefixで始まる参照をルースファイルとpacked-refsから集めて名前順に返す.
+func (c *Client) ListRefs(prefix string) ([]Ref, error) {
+	refs := map[string]Ref{}
+
+	packed, err := c.readPackedRefs()
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range packed {
+		if strings.HasPrefix(ref.Name, prefix) {
+			refs[ref.Name] = ref
+		}
+	}
+
+	refsDir := filepath.Join(c.gitDir, "refs")
+	if err := filepath.Walk(refsDir, func(p string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(c.gitDir, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		// 書き込み途中のロックファイルは参照ではない.
+		if !strings.HasPrefix(name, prefix) || strings.HasSuffix(name, ".lock") {
+			return nil
+		}
+		hash, err := c.ResolveRef(name)
+		if err != nil {
+			return err
+		}
+		refs[name] = Ref{Name: name, Hash: hash}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	result := make([]Ref, 0, len(refs))
+	for _, ref := range refs {
+		result = append(result, ref)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+func (c *Client) readPackedRef(name string) (*Ref, error) {
+	refs, err := c.readPackedRefs()
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range refs {
+		if ref.Name == name {
+			return &ref, nil
+		}
+	}
+	return nil, fmt.Errorf("%w : %s", ErrRefNotFound, name)
+}
+
+// readPackedRefsは.git/packed-refsを読み込む. ファイルがなければ空を返す.
+func (c *Client) readPackedRefs() ([]Ref, error) {
+	f, err := os.Open(filepath.Join(c.gitDir, "packed-refs"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var refs []Ref
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// "#"はヘッダ、"^"は直前のタグのピール結果.
+		if line == "" || line[0] == '#' || line[0] == '^' {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%w : %s", ErrInvalidRef, line)
+		}
+		hash, err := parseRefHash(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, Ref{Name: fields[1], Hash: hash})
+	}
+	return refs, scanner.Err()
+}
+
+func parseRefHash(s string) (sha.SHA1, error) {
+	if len(s) != 40 {
+		return nil, ErrInvalidRef
+	}
+	hash, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidRef
+	}
+	return hash, nil
+}
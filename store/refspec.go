@@ -0,0 +1,57 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RefSpecは"+refs/heads/*:refs/remotes/origin/*"のような、リモートとローカルの参照の対応.
+type RefSpec struct {
+	// Forceは早送りでない更新も許すか(先頭の"+").
+	Force bool
+	Src   string
+	Dst   string
+}
+
+// ParseRefSpecは"[+]<src>[:<dst>]"を解釈する. "*"は両側に1つずつだけ使える.
+func ParseRefSpec(spec string) (RefSpec, error) {
+	rs := RefSpec{}
+	if strings.HasPrefix(spec, "+") {
+		rs.Force = true
+		spec = spec[1:]
+	}
+	rs.Src = spec
+	if i := strings.IndexByte(spec, ':'); i >= 0 {
+		rs.Src, rs.Dst = spec[:i], spec[i+1:]
+	}
+	srcStars, dstStars := strings.Count(rs.Src, "*"), strings.Count(rs.Dst, "*")
+	if rs.Src == "" || srcStars > 1 || (rs.Dst != "" && srcStars != dstStars) {
+		return RefSpec{}, fmt.Errorf("%w : invalid refspec '%s'", ErrInvalidRefName, spec)
+	}
+	return rs, nil
+}
+
+// Stringはrsを"[+]<src>:<dst>"の形で返す.
+func (rs RefSpec) String() string {
+	s := rs.Src
+	if rs.Dst != "" {
+		s += ":" + rs.Dst
+	}
+	if rs.Force {
+		s = "+" + s
+	}
+	return s
+}
+
+// Matchはnameがsrcに一致すれば、対応するdstの名前を返す.
+func (rs RefSpec) Match(name string) (string, bool) {
+	i := strings.IndexByte(rs.Src, '*')
+	if i < 0 {
+		return rs.Dst, name == rs.Src
+	}
+	prefix, suffix := rs.Src[:i], rs.Src[i+1:]
+	if len(name) < len(prefix)+len(suffix) || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+		return "", false
+	}
+	return strings.Replace(rs.Dst, "*", name[len(prefix):len(name)-len(suffix)], 1), true
+}
@@ -0,0 +1,237 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kanon1343/fsegit/config"
+	"github.com/kanon1343/fsegit/sha"
+)
+
+// DefaultRemoteはcloneで作るリモートの名前.
+const DefaultRemote = "origin"
+
+// Remoteは設定ファイルのremote.<name>セクション.
+type Remote struct {
+	Name string
+	URL  string
+	// Fetchは"+refs/heads/*:refs/remotes/origin/*"のようなfetchするときのrefspec.
+	Fetch []string
+}
+
+// ReadRemoteはリモートnameの設定を返す. 設定がなければErrRemoteNotFoundを返す.
+func (c *Client) ReadRemote(name string) (*Remote, error) {
+	cfg, err := c.Config()
+	if err != nil {
+		return nil, err
+	}
+	url, ok := cfg.Get("remote." + name + ".url")
+	if !ok {
+		return nil, fmt.Errorf("%w : %s", ErrRemoteNotFound, name)
+	}
+	return &Remote{Name: name, URL: url, Fetch: cfg.GetAll("remote." + name + ".fetch")}, nil
+}
+
+// ListRemotesは設定されているリモートを名前順に返す.
+func (c *Client) ListRemotes() ([]*Remote, error) {
+	cfg, err := c.Config()
+	if err != nil {
+		return nil, err
+	}
+	var remotes []*Remote
+	for _, name := range cfg.Subsections("remote") {
+		if url, ok := cfg.Get("remote." + name + ".url"); ok {
+			remotes = append(remotes, &Remote{Name: name, URL: url, Fetch: cfg.GetAll("remote." + name + ".fetch")})
+		}
+	}
+	return remotes, nil
+}
+
+// AddRemoteはリモートnameを、全てのブランチをrefs/remotes/<name>/にfetchする設定で追加する.
+func (c *Client) AddRemote(name, url string) error {
+	if err := CheckRefName("refs/remotes/" + name); err != nil {
+		return err
+	}
+	if _, err := c.ReadRemote(name); err == nil {
+		return fmt.Errorf("%w : %s", ErrRemoteExists, name)
+	}
+	return c.updateConfig(func(d *config.Document) error {
+		if err := d.Set("remote."+name+".url", url); err != nil {
+			return err
+		}
+		return d.Add("remote."+name+".fetch", "+refs/heads/*:refs/remotes/"+name+"/*")
+	})
+}
+
+// RemoveRemoteはリモートnameの設定と追跡ブランチ、それを上流にしているブランチの設定を取り除く.
+func (c *Client) RemoveRemote(name string) error {
+	if _, err := c.ReadRemote(name); err != nil {
+		return err
+	}
+	branches, err := c.branchesTracking(name)
+	if err != nil {
+		return err
+	}
+	if err := c.updateConfig(func(d *config.Document) error {
+		d.RemoveSection("remote." + name)
+		for _, branch := range branches {
+			if _, err := d.Unset("branch." + branch + ".remote"); err != nil {
+				return err
+			}
+			if _, err := d.Unset("branch." + branch + ".merge"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	refs, err := c.ListRefs("refs/remotes/" + name + "/")
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		if err := c.DeleteRef(ref.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RenameRemoteはリモートoldNameをnewNameに変え、fetchのrefspecと追跡ブランチ、上流の設定も合わせて書き換える.
+func (c *Client) RenameRemote(oldName, newName string) error {
+	remote, err := c.ReadRemote(oldName)
+	if err != nil {
+		return err
+	}
+	if err := CheckRefName("refs/remotes/" + newName); err != nil {
+		return err
+	}
+	if _, err := c.ReadRemote(newName); err == nil {
+		return fmt.Errorf("%w : %s", ErrRemoteExists, newName)
+	}
+	branches, err := c.branchesTracking(oldName)
+	if err != nil {
+		return err
+	}
+	oldPrefix, newPrefix := "refs/remotes/"+oldName+"/", "refs/remotes/"+newName+"/"
+	if err := c.updateConfig(func(d *config.Document) error {
+		d.RenameSection("remote."+oldName, "remote."+newName)
+		// 既定のrefspecの追跡ブランチの場所だけを新しい名前にする.
+		if _, err := d.Unset("remote." + newName + ".fetch"); err != nil {
+			return err
+		}
+		for _, fetch := range remote.Fetch {
+			if i := strings.Index(fetch, ":"+oldPrefix); i >= 0 {
+				fetch = fetch[:i+1] + newPrefix + fetch[i+1+len(oldPrefix):]
+			}
+			if err := d.Add("remote."+newName+".fetch", fetch); err != nil {
+				return err
+			}
+		}
+		for _, branch := range branches {
+			if err := d.Set("branch."+branch+".remote", newName); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	refs, err := c.ListRefs(oldPrefix)
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		newRef := newPrefix + strings.TrimPrefix(ref.Name, oldPrefix)
+		// refs/remotes/<name>/HEADのようなシンボリック参照は指す先も新しい名前にする.
+		if target, err := c.ReadSymbolicRef(ref.Name); err == nil {
+			if strings.HasPrefix(target, oldPrefix) {
+				target = newPrefix + strings.TrimPrefix(target, oldPrefix)
+			}
+			if err := c.WriteSymbolicRef(newRef, target); err != nil {
+				return err
+			}
+		} else if err := c.WriteRef(newRef, ref.Hash); err != nil {
+			return err
+		}
+		if err := c.DeleteRef(ref.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// branchesTrackingはリモートnameを上流にしている(branch.<branch>.remoteがnameの)ブランチを返す.
+func (c *Client) branchesTracking(name string) ([]string, error) {
+	cfg, err := config.Load(c.ConfigPath())
+	if err != nil {
+		return nil, err
+	}
+	var branches []string
+	for _, branch := range cfg.Subsections("branch") {
+		if remote, _ := cfg.Get("branch." + branch + ".remote"); remote == name {
+			branches = append(branches, branch)
+		}
+	}
+	return branches, nil
+}
+
+// SetUpstreamはbranchがリモートremoteのmergeRef(refs/heads/...)を追跡するように設定する.
+func (c *Client) SetUpstream(branch, remote, mergeRef string) error {
+	return c.updateConfig(func(d *config.Document) error {
+		if err := d.Set("branch."+branch+".remote", remote); err != nil {
+			return err
+		}
+		return d.Set("branch."+branch+".merge", mergeRef)
+	})
+}
+
+// updateConfigはリポジトリの設定ファイルをeditで書き換える.
+func (c *Client) updateConfig(edit func(d *config.Document) error) error {
+	return config.UpdateFile(c.ConfigPath(), edit)
+}
+
+// maxHavesはfetchでリモートに伝える手元のコミットの数の上限.
+const maxHaves = 256
+
+// Havesはfetchでリモートに伝える手元のコミットを返す. 全ての参照とHEADから幅優先で辿り、maxHaves個で打ち切る.
+// リモートはこの中から共通のコミットを見つけ、それより先のオブジェクトだけを送る.
+func (c *Client) Haves() ([]sha.SHA1, error) {
+	refs, err := c.ListRefs("refs/")
+	if err != nil {
+		return nil, err
+	}
+	var queue []sha.SHA1
+	if head, err := c.ResolveRef("HEAD"); err == nil {
+		queue = append(queue, head)
+	}
+	for _, ref := range refs {
+		queue = append(queue, ref.Hash)
+	}
+
+	var haves []sha.SHA1
+	visited := map[string]struct{}{}
+	for len(queue) > 0 && len(haves) < maxHaves {
+		hash := queue[0]
+		queue = queue[1:]
+		commitHash, err := c.PeelToCommit(hash)
+		if err != nil {
+			// タグがツリーやブロブを指しているなど、コミットでない参照は伝えない.
+			continue
+		}
+		if _, ok := visited[string(commitHash)]; ok {
+			continue
+		}
+		visited[string(commitHash)] = struct{}{}
+		commit, err := c.GetCommit(commitHash)
+		if err != nil {
+			return nil, err
+		}
+		haves = append(haves, commitHash)
+		queue = append(queue, commit.Parents...)
+	}
+	return haves, nil
+}
@@ -0,0 +1,153 @@
+package store
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/kanon1343/fsegit/diff"
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/util"
+)
+
+// DefaultRenameThresholdは名前の変更とみなす内容の類似度(%)の既定値. gitと同じ.
+const DefaultRenameThreshold = 50
+
+// renameLimitは内容を比べる削除と追加の組の数の上限. これより多ければ内容が同じ組だけを名前の変更とみなす.
+const renameLimit = 1000 * 1000
+
+// renamePairは名前の変更の候補になる削除と追加の組.
+type renamePair struct {
+	del, add   int
+	similarity int
+}
+
+// DetectRenamesはchangesの削除と追加の組のうち、内容の類似度がthreshold(%)以上のものを名前の変更
+// (ChangeRename)にまとめ、パス順に返す. 内容が同じ組を先に、それから類似度の高い組から順にまとめる.
+// 通常のファイルとシンボリックリンクの組やサブモジュールはまとめない. 追加の内容がオブジェクトとして
+// 書き込まれていなければ(DiffIndexWorktreeの変更後など)、作業ツリーのファイルを読む.
+func (c *Client) DetectRenames(changes []TreeChange, threshold int) ([]TreeChange, error) {
+	var result, deletes, adds []TreeChange
+	for _, change := range changes {
+		switch {
+		case change.Type == ChangeDelete && change.OldMode != object.ModeGitlink:
+			deletes = append(deletes, change)
+		case change.Type == ChangeAdd && change.NewMode != object.ModeGitlink:
+			adds = append(adds, change)
+		default:
+			result = append(result, change)
+		}
+	}
+	if len(deletes) == 0 || len(adds) == 0 {
+		return changes, nil
+	}
+
+	usedDelete := make([]bool, len(deletes))
+	usedAdd := make([]bool, len(adds))
+	rename := func(d, a, similarity int) {
+		usedDelete[d], usedAdd[a] = true, true
+		result = append(result, TreeChange{
+			Type:       ChangeRename,
+			Path:       adds[a].Path,
+			OldMode:    deletes[d].OldMode,
+			OldHash:    deletes[d].OldHash,
+			NewMode:    adds[a].NewMode,
+			NewHash:    adds[a].NewHash,
+			OldPath:    deletes[d].Path,
+			Similarity: similarity,
+		})
+	}
+	for a, add := range adds {
+		for d, del := range deletes {
+			if !usedDelete[d] && renameCompatible(del, add) && bytes.Equal(del.OldHash, add.NewHash) {
+				rename(d, a, 100)
+				break
+			}
+		}
+	}
+
+	var pairs []renamePair
+	if threshold <= 100 && len(deletes)*len(adds) <= renameLimit {
+		oldData := make([][]byte, len(deletes))
+		for d, del := range deletes {
+			if usedDelete[d] {
+				continue
+			}
+			obj, err := c.GetObject(del.OldHash)
+			if err != nil {
+				return nil, err
+			}
+			oldData[d] = obj.Data
+		}
+		for a, add := range adds {
+			if usedAdd[a] {
+				continue
+			}
+			data, err := c.renameContent(add)
+			if err != nil {
+				return nil, err
+			}
+			for d, del := range deletes {
+				if usedDelete[d] || !renameCompatible(del, add) || !similarSize(len(oldData[d]), len(data), threshold) {
+					continue
+				}
+				if similarity := diff.Similarity(oldData[d], data); similarity >= threshold {
+					pairs = append(pairs, renamePair{del: d, add: a, similarity: similarity})
+				}
+			}
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].similarity > pairs[j].similarity })
+	for _, pair := range pairs {
+		if !usedDelete[pair.del] && !usedAdd[pair.add] {
+			rename(pair.del, pair.add, pair.similarity)
+		}
+	}
+
+	for d, del := range deletes {
+		if !usedDelete[d] {
+			result = append(result, del)
+		}
+	}
+	for a, add := range adds {
+		if !usedAdd[a] {
+			result = append(result, add)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Path < result[j].Path })
+	return result, nil
+}
+
+// renameCompatibleは削除と追加が同じ種類(通常のファイルかシンボリックリンク)のファイルかを返す.
+func renameCompatible(del, add TreeChange) bool {
+	return (del.OldMode == object.ModeSymlink) == (add.NewMode == object.ModeSymlink)
+}
+
+// similarSizeはサイズの差から、類似度がthresholdに届き得るかを返す.
+func similarSize(a, b, threshold int) bool {
+	if a > b {
+		a, b = b, a
+	}
+	return b == 0 || a*100 >= b*threshold
+}
+
+// renameContentは追加されたファイルの内容を返す. オブジェクトがなければ作業ツリーから読む.
+func (c *Client) renameContent(change TreeChange) ([]byte, error) {
+	ok, err := c.HasObject(change.NewHash)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		obj, err := c.GetObject(change.NewHash)
+		if err != nil {
+			return nil, err
+		}
+		return obj.Data, nil
+	}
+	info, err := os.Lstat(util.LongPath(filepath.Join(c.workTree, filepath.FromSlash(change.Path))))
+	if err != nil {
+		return nil, err
+	}
+	return c.ReadWorktreeFile(change.Path, info)
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"bytes"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+)
+
+// ResetModeはResetでHEADの他に何を書き換えるかを表す.
+type ResetMode int
+
+const (
+	// ResetSoftはHEADだけを動かす. インデックスと作業ツリーはそのまま残る.
+	ResetSoft ResetMode = iota
+	// ResetMixedはHEADを動かし、インデックスを対象のコミットの内容にする. 作業ツリーはそのまま残る.
+	ResetMixed
+	// ResetHardはHEADを動かし、インデックスと作業ツリーを対象のコミットの内容にする. 手元の変更は失われる.
+	ResetHard
+)
+
+// Resetは現在のブランチ(切り離されていればHEAD)をhashのコミットに動かし、modeに応じてインデックスと作業ツリーを合わせる.
+// 動かす前のコミットはORIG_HEADに保存し、messageを理由としてreflogに記録する.
+// mixedとhardではマージの途中経過も捨てる.
+func (c *Client) Reset(hash sha.SHA1, mode ResetMode, message string) error {
+	commit, err := c.PeelToCommit(hash)
+	if err != nil {
+		return err
+	}
+	mergeState, err := c.ReadMergeState()
+	if err != nil {
+		return err
+	}
+	switch {
+	case mode == ResetSoft && mergeState != nil:
+		return ErrSoftResetInMerge
+	case mode != ResetSoft && c.IsBare():
+		return ErrNoWorkTree
+	}
+
+	switch mode {
+	case ResetMixed:
+		if err := c.ResetIndex(commit); err != nil {
+			return err
+		}
+	case ResetHard:
+		if err := c.CheckoutCommit(commit, CheckoutOptions{Force: true}); err != nil {
+			return err
+		}
+	}
+	if err := c.SaveOrigHead(); err != nil {
+		return err
+	}
+	if err := c.UpdateHead(commit, message); err != nil {
+		return err
+	}
+	if mode != ResetSoft {
+		return c.ClearMergeState()
+	}
+	return nil
+}
+
+// ResetIndexはインデックスをhashのコミットのツリーと同じ内容にする. 作業ツリーには触れない.
+// 内容とモードが変わらないエントリは、作業ツリーの変更を調べ直さずに済むようにファイルの情報を引き継ぐ.
+func (c *Client) ResetIndex(hash sha.SHA1) error {
+	index, err := c.ReadIndex()
+	if err != nil {
+		return err
+	}
+	oldEntries := map[string]*IndexEntry{}
+	for _, entry := range index.Entries {
+		if entry.Stage == 0 {
+			oldEntries[entry.Path] = entry
+		}
+	}
+
+	index.Entries = nil
+	index.Cache = nil
+	index.ResolveUndo = nil
+	if err := c.WalkTree(hash, nil, func(path string, entry object.TreeEntry) error {
+		if prev, ok := oldEntries[path]; ok && prev.Mode == entry.Mode && bytes.Equal(prev.Hash, entry.Hash) {
+			index.Add(prev)
+			return nil
+		}
+		index.Add(&IndexEntry{Mode: entry.Mode, Hash: entry.Hash, Path: path})
+		return nil
+	}); err != nil {
+		return err
+	}
+	return c.WriteIndex(index)
+}
@@ -0,0 +1,174 @@
+package store
+
+import (
+	"container/heap"
+	"path"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+)
+
+// RevListOptionsはRevListの動作を指定する.
+type RevListOptions struct {
+	// Includeから辿れて、Excludeからは辿れないコミットを列挙する. 注釈付きタグは指しているオブジェクトまで辿る.
+	Include []sha.SHA1
+	Exclude []sha.SHA1
+	// MaxCountが正なら、列挙するコミットをその数までにする.
+	MaxCount int
+	// Objectsなら、列挙したコミットから辿れるツリーとブロブ、Includeの注釈付きタグも列挙する.
+	Objects bool
+}
+
+// RevListEntryはRevListで列挙したオブジェクト.
+type RevListEntry struct {
+	Hash sha.SHA1
+	Type object.Type
+	// Pathはツリーとブロブを最初に見つけたパス. コミット、タグ、ルートのツリーは空.
+	Path string
+}
+
+// RevListはopts.Includeから辿れてopts.Excludeからは辿れないコミットを、コミット日時の新しい順に列挙する.
+// opts.Objectsなら、コミットの後にタグを、その後に列挙したコミットの順にツリーとブロブを列挙する.
+// Excludeから辿れるツリーとブロブは含めない. サブモジュールのコミット(gitlink)は辿らない.
+func (c *Client) RevList(opts RevListOptions) ([]RevListEntry, error) {
+	excluded, err := c.Reachable(opts.Exclude, opts.Objects)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]struct{}{}
+	visit := func(hash sha.SHA1) bool {
+		if _, ok := seen[string(hash)]; ok || excluded.Contains(hash) {
+			return false
+		}
+		seen[string(hash)] = struct{}{}
+		return true
+	}
+
+	// 注釈付きタグを剥がし、コミットは日時の順に辿る. コミットでないものはツリーやブロブとして後で列挙する.
+	var tags, roots []RevListEntry
+	queue := &dateQueue{}
+	for _, hash := range opts.Include {
+		for {
+			obj, err := c.GetObject(hash)
+			if err != nil {
+				return nil, err
+			}
+			if obj.Type == object.CommitObject {
+				if visit(hash) {
+					commit, err := c.GetCommit(hash)
+					if err != nil {
+						return nil, err
+					}
+					heap.Push(queue, datedCommit{commit: commit, seq: len(seen)})
+				}
+				break
+			}
+			if obj.Type != object.TagObject {
+				if visit(hash) {
+					roots = append(roots, RevListEntry{Hash: hash, Type: obj.Type})
+				}
+				break
+			}
+			if visit(hash) {
+				tags = append(tags, RevListEntry{Hash: hash, Type: object.TagObject})
+			}
+			tag, err := object.NewTag(obj)
+			if err != nil {
+				return nil, &object.CorruptObjectError{Hash: hash, Err: err}
+			}
+			hash = tag.Object
+		}
+	}
+
+	var entries []RevListEntry
+	var commits []*object.Commit
+	for queue.Len() > 0 && (opts.MaxCount <= 0 || len(commits) < opts.MaxCount) {
+		commit := heap.Pop(queue).(datedCommit).commit
+		commits = append(commits, commit)
+		entries = append(entries, RevListEntry{Hash: commit.Hash, Type: object.CommitObject})
+		for _, parent := range commit.Parents {
+			if !visit(parent) {
+				continue
+			}
+			parentCommit, err := c.GetCommit(parent)
+			if err != nil {
+				return nil, err
+			}
+			heap.Push(queue, datedCommit{commit: parentCommit, seq: len(seen)})
+		}
+	}
+	if !opts.Objects {
+		return entries, nil
+	}
+
+	entries = append(entries, tags...)
+	for _, commit := range commits {
+		if !visit(commit.Tree) {
+			continue
+		}
+		entries = append(entries, RevListEntry{Hash: commit.Tree, Type: object.TreeObject})
+		if entries, err = c.revListTree(entries, commit.Tree, "", visit); err != nil {
+			return nil, err
+		}
+	}
+	for _, root := range roots {
+		entries = append(entries, root)
+		if root.Type == object.TreeObject {
+			if entries, err = c.revListTree(entries, root.Hash, "", visit); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return entries, nil
+}
+
+// revListTreeはtreeの下にあるツリーとブロブのうち、visitがtrueを返すものをentriesに加えて返す.
+func (c *Client) revListTree(entries []RevListEntry, tree sha.SHA1, prefix string, visit func(sha.SHA1) bool) ([]RevListEntry, error) {
+	obj, err := c.GetObject(tree)
+	if err != nil {
+		return nil, err
+	}
+	t, err := object.NewTree(obj)
+	if err != nil {
+		return nil, &object.CorruptObjectError{Hash: tree, Err: err}
+	}
+	for _, entry := range t.Entries {
+		if entry.Mode == object.ModeGitlink || !visit(entry.Hash) {
+			continue
+		}
+		name := path.Join(prefix, entry.Name)
+		if !entry.Mode.IsTree() {
+			entries = append(entries, RevListEntry{Hash: entry.Hash, Type: object.BlobObject, Path: name})
+			continue
+		}
+		entries = append(entries, RevListEntry{Hash: entry.Hash, Type: object.TreeObject, Path: name})
+		if entries, err = c.revListTree(entries, entry.Hash, name, visit); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// RevListCountはRevListが列挙するオブジェクトの数を返す. opts.MaxCountを指定しなければ、パックの.bitmapファイルを
+// 使ってコミットを1つずつ読まずに数える.
+func (c *Client) RevListCount(opts RevListOptions) (int, error) {
+	if opts.MaxCount > 0 {
+		entries, err := c.RevList(opts)
+		return len(entries), err
+	}
+	set, err := c.Reachable(opts.Include, opts.Objects)
+	if err != nil {
+		return 0, err
+	}
+	if len(opts.Exclude) > 0 {
+		excluded, err := c.Reachable(opts.Exclude, opts.Objects)
+		if err != nil {
+			return 0, err
+		}
+		set.Remove(excluded)
+	}
+	if opts.Objects {
+		return set.Count(object.UndefinedObject), nil
+	}
+	return set.Count(object.CommitObject), nil
+}
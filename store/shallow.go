@@ -0,0 +1,168 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/util"
+)
+
+// shallowFileは浅い履歴の境界のコミットを1行に1つずつ書くファイル.
+const shallowFile = "shallow"
+
+// ReadShallowは浅い履歴の境界のコミット(<GitDir>/shallow)を返す. 浅いリポジトリでなければnilを返す.
+// 境界のコミットの親は手元にない.
+func (c *Client) ReadShallow() ([]sha.SHA1, error) {
+	data, err := ioutil.ReadFile(util.LongPath(filepath.Join(c.gitDir, shallowFile)))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var hashes []sha.SHA1
+	for _, line := range strings.Fields(string(data)) {
+		hash, err := parseRefHash(line)
+		if err != nil {
+			return nil, fmt.Errorf("%w : %s", err, shallowFile)
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, nil
+}
+
+// IsShallowは浅い履歴しか持たないリポジトリかを返す.
+func (c *Client) IsShallow() (bool, error) {
+	shallow, err := c.shallowCommits()
+	return len(shallow) > 0, err
+}
+
+// WriteShallowは浅い履歴の境界のコミットを書き直す. hashesが空ならファイルを削除して浅いリポジトリでなくする.
+// 浅いリポジトリではコミットグラフを使わないので、境界が変わったらコミットグラフも削除する.
+func (c *Client) WriteShallow(hashes []sha.SHA1) error {
+	path := filepath.Join(c.gitDir, shallowFile)
+	defer c.resetShallow()
+	if len(hashes) == 0 {
+		if err := os.Remove(util.LongPath(path)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	sorted := append([]sha.SHA1{}, hashes...)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i], sorted[j]) < 0 })
+	var buf strings.Builder
+	for i, hash := range sorted {
+		if i > 0 && bytes.Equal(sorted[i-1], hash) {
+			continue
+		}
+		buf.WriteString(hash.String() + "\n")
+	}
+	lock, err := util.Lock(path, refLockTimeout)
+	if err != nil {
+		return err
+	}
+	if _, err := lock.Write([]byte(buf.String())); err != nil {
+		lock.Rollback()
+		return err
+	}
+	if err := lock.Commit(); err != nil {
+		return err
+	}
+	if err := os.Remove(util.LongPath(c.commitGraphPath())); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	c.resetCommitGraph()
+	return nil
+}
+
+// UpdateShallowはリモートから取得したときに伝えられた境界の変化を反映する.
+// shallowのコミットを境界に加え、unshallowのコミットを境界から外す.
+func (c *Client) UpdateShallow(shallow, unshallow []sha.SHA1) error {
+	if len(shallow) == 0 && len(unshallow) == 0 {
+		return nil
+	}
+	current, err := c.ReadShallow()
+	if err != nil {
+		return err
+	}
+	removed := map[string]struct{}{}
+	for _, hash := range unshallow {
+		removed[string(hash)] = struct{}{}
+	}
+	var hashes []sha.SHA1
+	for _, hash := range append(current, shallow...) {
+		if _, ok := removed[string(hash)]; !ok {
+			hashes = append(hashes, hash)
+		}
+	}
+	return c.WriteShallow(hashes)
+}
+
+// shallowCommitsは浅い履歴の境界のコミットの集合を初めて使うときに読み込んで返す.
+func (c *Client) shallowCommits() (map[string]struct{}, error) {
+	c.shallowMu.Lock()
+	defer c.shallowMu.Unlock()
+	if c.shallowLoaded {
+		return c.shallow, nil
+	}
+	hashes, err := c.ReadShallow()
+	if err != nil {
+		return nil, err
+	}
+	c.shallow = map[string]struct{}{}
+	for _, hash := range hashes {
+		c.shallow[string(hash)] = struct{}{}
+	}
+	c.shallowLoaded = true
+	return c.shallow, nil
+}
+
+// resetShallowは読み込んだ境界のコミットを捨て、次に使うときに読み込み直すようにする.
+func (c *Client) resetShallow() {
+	c.shallowMu.Lock()
+	defer c.shallowMu.Unlock()
+	c.shallow = nil
+	c.shallowLoaded = false
+}
+
+// GetCommitはhashのコミットを読む. 浅い履歴の境界のコミットは、gitと同じく親のないコミットとして返す.
+// 履歴を辿るときはGetObjectの代わりにこれを使い、手元にない親を読もうとしないようにする.
+func (c *Client) GetCommit(hash sha.SHA1) (*object.Commit, error) {
+	return c.GetCommitContext(context.Background(), hash)
+}
+
+// GetCommitContextはGetCommitと同じだが、ctxが取り消されていれば読まずにctx.Err()を返す.
+func (c *Client) GetCommitContext(ctx context.Context, hash sha.SHA1) (*object.Commit, error) {
+	obj, err := c.GetObjectContext(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := object.NewCommit(obj)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.cutShallowParents(commit); err != nil {
+		return nil, err
+	}
+	return commit, nil
+}
+
+// cutShallowParentsはcommitが浅い履歴の境界のコミットなら親を取り除く.
+func (c *Client) cutShallowParents(commit *object.Commit) error {
+	shallow, err := c.shallowCommits()
+	if err != nil {
+		return err
+	}
+	if _, ok := shallow[string(commit.Hash)]; ok {
+		commit.Parents = nil
+	}
+	return nil
+}
@@ -0,0 +1,304 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+)
+
+// 署名の形式. 設定のgpg.formatで選ぶ.
+const (
+	signFormatOpenPGP = "openpgp"
+	signFormatX509    = "x509"
+	signFormatSSH     = "ssh"
+)
+
+// signFormatsは署名の形式ごとの既定のプログラムと、署名の始まりを表す行.
+var signFormats = map[string]struct {
+	program string
+	markers []string
+}{
+	signFormatOpenPGP: {"gpg", []string{"-----BEGIN PGP SIGNATURE-----", "-----BEGIN PGP MESSAGE-----"}},
+	signFormatX509:    {"gpgsm", []string{"-----BEGIN SIGNED MESSAGE-----"}},
+	signFormatSSH:     {"ssh-keygen", []string{"-----BEGIN SSH SIGNATURE-----"}},
+}
+
+// signProgramは形式formatの署名に使うプログラムを返す. gitと同じくgpg.<format>.programを優先し、
+// OpenPGPならgpg.programも見る.
+func (c *Client) signProgram(format string) (string, error) {
+	cfg, err := c.Config()
+	if err != nil {
+		return "", err
+	}
+	if program, ok := cfg.Get("gpg." + format + ".program"); ok && program != "" {
+		return program, nil
+	}
+	if program, ok := cfg.Get("gpg.program"); ok && program != "" && format == signFormatOpenPGP {
+		return program, nil
+	}
+	return signFormats[format].program, nil
+}
+
+// Signはpayloadに対する署名を作って返す. 形式は設定のgpg.format(openpgp、x509、ssh. 既定はopenpgp)で選び、
+// gpg、gpgsm、ssh-keygenを呼び出す. 鍵はuser.signingkeyを使う. 設定されていなければ、OpenPGPとX.509では
+// コミッターの"名前 <メールアドレス>"で鍵を選び、SSHではErrSignFailedを返す.
+func (c *Client) Sign(payload []byte) (string, error) {
+	cfg, err := c.Config()
+	if err != nil {
+		return "", err
+	}
+	format := signFormatOpenPGP
+	if value, ok := cfg.Get("gpg.format"); ok {
+		format = strings.ToLower(value)
+	}
+	if _, ok := signFormats[format]; !ok {
+		return "", fmt.Errorf("%w : invalid value for gpg.format: %s", ErrSignFailed, format)
+	}
+	program, err := c.signProgram(format)
+	if err != nil {
+		return "", err
+	}
+	key, _ := cfg.Get("user.signingkey")
+	if format == signFormatSSH {
+		return signSSH(program, key, payload)
+	}
+	if key == "" {
+		committer, err := c.Identity(Committer)
+		if err != nil {
+			return "", err
+		}
+		key = fmt.Sprintf("%s <%s>", committer.Name, committer.Email)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(program, "--status-fd=2", "-bsau", key)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = bytes.NewReader(payload), &stdout, &stderr
+	// gpgは鍵が見つからなくても終了コードが0のことがあるので、SIG_CREATEDの行で成功したかを確かめる.
+	if err := cmd.Run(); err != nil || !strings.Contains(stderr.String(), "[GNUPG:] SIG_CREATED ") {
+		return "", fmt.Errorf("%w : %s", ErrSignFailed, strings.TrimSpace(stderr.String()))
+	}
+	return strings.ReplaceAll(stdout.String(), "\r\n", "\n"), nil
+}
+
+// signSSHはssh-keygenでpayloadに署名する. keyは秘密鍵か公開鍵のファイルのパスか、"key::"で始まる(または"ssh-"で
+// 始まる)公開鍵そのもの. 公開鍵なら、対応する秘密鍵はssh-agentにある必要がある.
+func signSSH(program, key string, payload []byte) (string, error) {
+	if key == "" {
+		return "", fmt.Errorf("%w : user.signingkey needs to be set for ssh signing", ErrSignFailed)
+	}
+	args := []string{"-Y", "sign", "-n", "git"}
+	if literal := strings.TrimPrefix(key, "key::"); literal != key || strings.HasPrefix(key, "ssh-") {
+		tmp, err := ioutil.TempFile("", ".fsegit_signing_key_")
+		if err != nil {
+			return "", err
+		}
+		defer os.Remove(tmp.Name())
+		_, err = tmp.WriteString(literal + "\n")
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return "", err
+		}
+		args = append(args, "-U", "-f", tmp.Name())
+	} else {
+		if strings.HasPrefix(key, "~/") {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", err
+			}
+			key = filepath.Join(home, key[2:])
+		}
+		args = append(args, "-f", key)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(program, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = bytes.NewReader(payload), &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%w : %s", ErrSignFailed, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// VerifySignatureはsignatureがpayloadに対する正しい署名かを調べ、検証したプログラムの出力を返す.
+// 形式は署名の始まりの行から判断する. SSHの署名は設定のgpg.ssh.allowedSignersFileに書かれた鍵で検証する.
+// 正しくなければ、プログラムの出力とともにErrBadSignatureを返す.
+func (c *Client) VerifySignature(payload []byte, signature string) (string, error) {
+	format := ""
+	for name, f := range signFormats {
+		for _, marker := range f.markers {
+			if strings.HasPrefix(signature, marker) {
+				format = name
+			}
+		}
+	}
+	if format == "" {
+		return "", ErrNoSignature
+	}
+	program, err := c.signProgram(format)
+	if err != nil {
+		return "", err
+	}
+
+	tmp, err := ioutil.TempFile("", ".fsegit_signature_")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(signature)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if format == signFormatSSH {
+		return c.verifySSH(program, tmp.Name(), payload)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(program, "--keyid-format=long", "--status-fd=1", "--verify", tmp.Name(), "-")
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = bytes.NewReader(payload), &stdout, &stderr
+	err = cmd.Run()
+	output := stderr.String()
+	if err != nil || !strings.Contains(stdout.String(), "[GNUPG:] GOODSIG ") {
+		return output, fmt.Errorf("%w : %s", ErrBadSignature, strings.TrimSpace(output))
+	}
+	return output, nil
+}
+
+// verifySSHはssh-keygenで、sigFileの署名がpayloadに対する、許可された鍵による署名かを調べる.
+func (c *Client) verifySSH(program, sigFile string, payload []byte) (string, error) {
+	cfg, err := c.Config()
+	if err != nil {
+		return "", err
+	}
+	allowed, ok := cfg.Get("gpg.ssh.allowedSignersFile")
+	if !ok || allowed == "" {
+		return "", fmt.Errorf("%w : gpg.ssh.allowedSignersFile needs to be configured for ssh signature verification", ErrBadSignature)
+	}
+	if strings.HasPrefix(allowed, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		allowed = filepath.Join(home, allowed[2:])
+	}
+
+	// 署名した鍵の持ち主を許可された鍵の一覧から探し、その持ち主の鍵として検証する.
+	out, err := exec.Command(program, "-Y", "find-principals", "-f", allowed, "-s", sigFile).Output()
+	principals := strings.Fields(string(out))
+	if err != nil || len(principals) == 0 {
+		return "", fmt.Errorf("%w : no principal matched the signing key", ErrBadSignature)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(program, "-Y", "verify", "-n", "git", "-f", allowed, "-I", principals[0], "-s", sigFile)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = bytes.NewReader(payload), &stdout, &stderr
+	err = cmd.Run()
+	output := stdout.String() + stderr.String()
+	if err != nil {
+		return output, fmt.Errorf("%w : %s", ErrBadSignature, strings.TrimSpace(output))
+	}
+	return output, nil
+}
+
+// VerifyCommitはhashのコミットのgpgsigヘッダの署名を検証し、検証したプログラムの出力を返す.
+// 署名がなければErrNoSignatureを返す.
+func (c *Client) VerifyCommit(hash sha.SHA1) (string, error) {
+	obj, err := c.GetObject(hash)
+	if err != nil {
+		return "", err
+	}
+	if obj.Type != object.CommitObject {
+		return "", fmt.Errorf("%w : %s", object.ErrNotCommitObject, hash)
+	}
+	payload, signature := splitCommitSignature(obj.Data)
+	if signature == "" {
+		return "", fmt.Errorf("%w : %s", ErrNoSignature, hash)
+	}
+	return c.VerifySignature(payload, signature)
+}
+
+// VerifyTagはhashのタグオブジェクトのメッセージの末尾にある署名を検証し、検証したプログラムの出力を返す.
+// 署名がなければErrNoSignatureを返す.
+func (c *Client) VerifyTag(hash sha.SHA1) (string, error) {
+	obj, err := c.GetObject(hash)
+	if err != nil {
+		return "", err
+	}
+	if obj.Type != object.TagObject {
+		return "", fmt.Errorf("%w : %s", object.ErrNotTagObject, hash)
+	}
+	payload, signature := splitTagSignature(obj.Data)
+	if signature == "" {
+		return "", fmt.Errorf("%w : %s", ErrNoSignature, hash)
+	}
+	return c.VerifySignature(payload, signature)
+}
+
+// splitCommitSignatureはコミットのデータを、gpgsigヘッダを除いた署名の対象と署名に分ける.
+func splitCommitSignature(data []byte) ([]byte, string) {
+	header, message := data, []byte(nil)
+	if i := bytes.Index(data, []byte("\n\n")); i >= 0 {
+		header, message = data[:i+1], data[i+1:]
+	}
+	var payload bytes.Buffer
+	var signature []string
+	inSignature := false
+	for _, line := range strings.SplitAfter(string(header), "\n") {
+		switch {
+		case strings.HasPrefix(line, "gpgsig "):
+			inSignature = true
+			signature = append(signature, strings.TrimPrefix(line, "gpgsig "))
+		case inSignature && strings.HasPrefix(line, " "):
+			signature = append(signature, line[1:])
+		default:
+			inSignature = false
+			payload.WriteString(line)
+		}
+	}
+	payload.Write(message)
+	return payload.Bytes(), strings.Join(signature, "")
+}
+
+// splitTagSignatureはタグのデータを、メッセージの後に付けられた署名とそれより前の署名の対象に分ける.
+func splitTagSignature(data []byte) ([]byte, string) {
+	start := -1
+	for offset := 0; offset < len(data); {
+		end := bytes.IndexByte(data[offset:], '\n')
+		if end < 0 {
+			end = len(data) - offset
+		}
+		line := string(data[offset : offset+end])
+		for _, f := range signFormats {
+			for _, marker := range f.markers {
+				if line == marker && start < 0 {
+					start = offset
+				}
+			}
+		}
+		offset += end + 1
+	}
+	if start < 0 {
+		return data, ""
+	}
+	return data[:start], string(data[start:])
+}
+
+// signTagはtagのデータに署名し、署名をメッセージの後に付けたタグを返す.
+func (c *Client) signTag(tag object.Tag) (object.Tag, error) {
+	signature, err := c.Sign(tag.Encode())
+	if err != nil {
+		return tag, err
+	}
+	tag.Message += signature
+	return tag, nil
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/util"
+)
+
+// 履歴を動かす操作の間だけ使われる特別な参照. 管理ディレクトリの直下に置かれる.
+const (
+	// OrigHeadはreset、merge、rebaseなどでHEADを動かす前のコミット.
+	OrigHead = "ORIG_HEAD"
+	// MergeHeadはマージ中に取り込もうとしているコミット. オクトパスマージでは複数行になる.
+	MergeHead = "MERGE_HEAD"
+	// FetchHeadは最後にfetchした参照の一覧.
+	FetchHead = "FETCH_HEAD"
+	// RevertHeadはコンフリクトで止まったrevertで取り消そうとしているコミット.
+	RevertHead = "REVERT_HEAD"
+)
+
+// SaveOrigHeadは現在のHEADのコミットをORIG_HEADに記録する. HEADにコミットがなければ何もしない.
+func (c *Client) SaveOrigHead() error {
+	head, err := c.ReadHead()
+	if err != nil {
+		return err
+	}
+	if head.Unborn() {
+		return nil
+	}
+	return c.WriteRef(OrigHead, head.Hash)
+}
+
+// ReadMergeHeadsはMERGE_HEADのコミットを返す. マージ中でなければnilを返す.
+func (c *Client) ReadMergeHeads() ([]sha.SHA1, error) {
+	data, err := ioutil.ReadFile(filepath.Join(c.gitDir, MergeHead))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var hashes []sha.SHA1
+	for _, line := range strings.Fields(string(data)) {
+		hash, err := parseRefHash(line)
+		if err != nil {
+			return nil, fmt.Errorf("%w : %s", err, MergeHead)
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, nil
+}
+
+// FetchHeadEntryはFETCH_HEADの1行. Descriptionは"branch 'main' of <url>"のような説明.
+type FetchHeadEntry struct {
+	Hash        sha.SHA1
+	NotForMerge bool
+	Description string
+}
+
+// WriteFetchHeadはfetchした参照をFETCH_HEADに書き込む.
+// マージ対象の行を先に書くので、FETCH_HEADを参照として読むとマージ対象のコミットになる.
+func (c *Client) WriteFetchHead(entries []FetchHeadEntry) error {
+	var forMerge, notForMerge strings.Builder
+	for _, entry := range entries {
+		if entry.NotForMerge {
+			fmt.Fprintf(&notForMerge, "%s\tnot-for-merge\t%s\n", entry.Hash, entry.Description)
+		} else {
+			fmt.Fprintf(&forMerge, "%s\t\t%s\n", entry.Hash, entry.Description)
+		}
+	}
+	return util.WriteFileAtomic(filepath.Join(c.gitDir, FetchHead), []byte(forMerge.String()+notForMerge.String()), 0644)
+}
+
+// ReadFetchHeadはFETCH_HEADの内容を返す. まだfetchしていなければErrRefNotFoundを返す.
+func (c *Client) ReadFetchHead() ([]FetchHeadEntry, error) {
+	data, err := ioutil.ReadFile(filepath.Join(c.gitDir, FetchHead))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w : %s", ErrRefNotFound, FetchHead)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []FetchHeadEntry
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%w : %s", ErrInvalidRef, line)
+		}
+		hash, err := parseRefHash(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%w : %s", err, FetchHead)
+		}
+		entries = append(entries, FetchHeadEntry{
+			Hash:        hash,
+			NotForMerge: fields[1] == "not-for-merge",
+			Description: fields[2],
+		})
+	}
+	return entries, nil
+}
+
+// ClearSpecialRefはnameの特別な参照を取り除く. 存在しなくてもエラーにしない.
+func (c *Client) ClearSpecialRef(name string) error {
+	err := os.Remove(filepath.Join(c.gitDir, name))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/kanon1343/fsegit/diff"
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/util"
+)
+
+// StashRefは退避した変更の最新のエントリを指す参照. それより前のエントリはreflogに積み重なっている.
+const StashRef = "refs/stash"
+
+// StashPushは作業ツリーとインデックスの追跡しているファイルの変更を退避し、両方をHEADの内容に戻す.
+// gitと同じく、インデックスの内容をHEADを親とするコミットにし、作業ツリーの内容をHEADとそのコミットを親とする
+// コミットにしてrefs/stashに記録する. messageが空なら"WIP on <branch>: <HEADの要約>"にする.
+// 退避する変更がなければnilを返す.
+func (c *Client) StashPush(message string, committer object.Signature) (sha.SHA1, error) {
+	if c.IsBare() {
+		return nil, ErrNoWorkTree
+	}
+	head, err := c.ReadHead()
+	if err != nil {
+		return nil, err
+	}
+	if head.Unborn() {
+		return nil, fmt.Errorf("%w : %s", ErrUnbornBranch, head.ShortBranch())
+	}
+	headObj, err := c.GetObject(head.Hash)
+	if err != nil {
+		return nil, err
+	}
+	headCommit, err := object.NewCommit(headObj)
+	if err != nil {
+		return nil, err
+	}
+	index, err := c.ReadIndex()
+	if err != nil {
+		return nil, err
+	}
+	indexTree, err := c.WriteTree(index)
+	if err != nil {
+		return nil, err
+	}
+	worktreeTree, err := c.writeWorktreeTree(index)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(indexTree, headCommit.Tree) && bytes.Equal(worktreeTree, headCommit.Tree) {
+		return nil, nil
+	}
+
+	branch := head.ShortBranch()
+	if head.Detached() {
+		branch = "(no branch)"
+	}
+	summary := fmt.Sprintf("%s: %s %s", branch, head.Hash.String()[:7], headCommit.Subject())
+	if message == "" {
+		message = "WIP on " + summary
+	} else {
+		message = "On " + branch + ": " + message
+	}
+
+	indexCommit := object.Commit{
+		Tree:      indexTree,
+		Parents:   []sha.SHA1{head.Hash},
+		Author:    committer,
+		Committer: committer,
+		Message:   "index on " + summary + "\n",
+	}
+	indexObj := object.NewObject(object.CommitObject, indexCommit.Encode())
+	if err := c.WriteObject(indexObj); err != nil {
+		return nil, err
+	}
+	stashCommit := object.Commit{
+		Tree:      worktreeTree,
+		Parents:   []sha.SHA1{head.Hash, indexObj.Hash},
+		Author:    committer,
+		Committer: committer,
+		Message:   message + "\n",
+	}
+	stashObj := object.NewObject(object.CommitObject, stashCommit.Encode())
+	if err := c.WriteObject(stashObj); err != nil {
+		return nil, err
+	}
+	if err := c.UpdateRef(StashRef, stashObj.Hash, message); err != nil {
+		return nil, err
+	}
+	return stashObj.Hash, c.CheckoutCommit(head.Hash, CheckoutOptions{Force: true})
+}
+
+// writeWorktreeTreeはインデックスで追跡しているファイルの作業ツリーの内容でツリーを作り、ハッシュを返す.
+// 作業ツリーから削除されたファイルはツリーに含めない.
+func (c *Client) writeWorktreeTree(index *Index) (sha.SHA1, error) {
+	changes, err := c.DiffIndexWorktree(index)
+	if err != nil {
+		return nil, err
+	}
+	changed := map[string]TreeChange{}
+	for _, change := range changes {
+		changed[change.Path] = change
+	}
+	var entries []PathEntry
+	for _, entry := range index.Entries {
+		change, ok := changed[entry.Path]
+		switch {
+		case !ok:
+			entries = append(entries, PathEntry{Path: entry.Path, Mode: entry.Mode, Hash: entry.Hash})
+		case change.Type == ChangeModify:
+			info, err := os.Lstat(util.LongPath(filepath.Join(c.workTree, filepath.FromSlash(entry.Path))))
+			if err != nil {
+				return nil, err
+			}
+			hash, err := c.WriteWorktreeBlob(entry.Path, info)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, PathEntry{Path: entry.Path, Mode: change.NewMode, Hash: hash})
+		}
+	}
+	return c.BuildTree(entries)
+}
+
+// StashListは退避したエントリを新しい順に返す. i番目がstash@{i}になる. 何も退避していなければnilを返す.
+func (c *Client) StashList() ([]ReflogEntry, error) {
+	entries, err := c.ReadReflog(StashRef)
+	if errors.Is(err, ErrNoReflog) {
+		return nil, nil
+	}
+	return entries, err
+}
+
+// stashCommitはstash@{n}のコミットを返す. 退避したエントリでなければErrInvalidStashを返す.
+func (c *Client) stashCommit(n int) (*object.Commit, error) {
+	entries, err := c.StashList()
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, ErrNoStash
+	}
+	if n < 0 || n >= len(entries) {
+		return nil, fmt.Errorf("%w : stash@{%d}", ErrInvalidStash, n)
+	}
+	obj, err := c.GetObject(entries[n].New)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := object.NewCommit(obj)
+	if err != nil {
+		return nil, err
+	}
+	if len(commit.Parents) < 2 {
+		return nil, fmt.Errorf("%w : stash@{%d}", ErrInvalidStash, n)
+	}
+	return commit, nil
+}
+
+// StashApplyはstash@{n}の作業ツリーの変更を、退避したときのHEADからの3方向マージで作業ツリーに戻す.
+// 変更はインデックスには戻さないが、退避したときのHEADになかったファイルは追加したままにする.
+// 書き換えるファイルに手元の変更があれば何も変えずにErrWouldOverwriteを返し、
+// 合わせられなかったファイルはコンフリクトとして返す.
+func (c *Client) StashApply(n int) ([]MergeConflict, error) {
+	stash, err := c.stashCommit(n)
+	if err != nil {
+		return nil, err
+	}
+	base := stash.Parents[0]
+	conflicts, err := c.MergeIntoWorktree(base, stash.Hash, diff.MergeLabels{Ours: "Updated upstream", Theirs: "Stashed changes"})
+	if err != nil || len(conflicts) > 0 {
+		return conflicts, err
+	}
+
+	// 取り込んだ変更をステージされていない状態に戻す.
+	head, err := c.ReadHead()
+	if err != nil {
+		return nil, err
+	}
+	headFiles, err := c.treeFiles(head.Hash)
+	if err != nil {
+		return nil, err
+	}
+	baseFiles, err := c.treeFiles(base)
+	if err != nil {
+		return nil, err
+	}
+	stashFiles, err := c.treeFiles(stash.Hash)
+	if err != nil {
+		return nil, err
+	}
+	index, err := c.ReadIndex()
+	if err != nil {
+		return nil, err
+	}
+	for path, b := range baseFiles {
+		if s, ok := stashFiles[path]; ok && sameTreeEntry(b, s) {
+			continue
+		}
+		unstageStashedPath(index, path, headFiles)
+	}
+	for path := range stashFiles {
+		if _, ok := baseFiles[path]; !ok {
+			unstageStashedPath(index, path, headFiles)
+		}
+	}
+	return nil, c.WriteIndex(index)
+}
+
+// unstageStashedPathはpathのインデックスのエントリをHEADの内容に戻す. HEADにないファイルは追加したままにする.
+func unstageStashedPath(index *Index, path string, headFiles map[string]object.TreeEntry) {
+	h, ok := headFiles[path]
+	if !ok {
+		return
+	}
+	if entry := index.Entry(path); entry != nil && entry.Mode == h.Mode && bytes.Equal(entry.Hash, h.Hash) {
+		return
+	}
+	index.Add(&IndexEntry{Mode: h.Mode, Hash: h.Hash, Path: path})
+}
+
+// StashDropはstash@{n}を取り除き、そのコミットを返す.
+func (c *Client) StashDrop(n int) (sha.SHA1, error) {
+	stash, err := c.stashCommit(n)
+	if err != nil {
+		return nil, err
+	}
+	return stash.Hash, c.DropReflogEntry(StashRef, n)
+}
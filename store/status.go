@@ -0,0 +1,304 @@
+package store
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kanon1343/fsegit/ignore"
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/util"
+)
+
+// StatusはHEAD、インデックス、作業ツリーの間の違い.
+type Status struct {
+	// StagedはHEADのツリーからインデックスへの変更.
+	Staged []TreeChange
+	// Unstagedはインデックスから作業ツリーへの変更. 追加(ChangeAdd)は含まない.
+	Unstaged []TreeChange
+	// Unmergedはコンフリクトが解決されていないパス.
+	Unmerged []string
+	// Untrackedはインデックスにないファイル. 追跡しているファイルを含まないディレクトリは"dir/"とまとめる.
+	Untracked []string
+}
+
+// Cleanはコミットすべき変更も追跡していないファイルもないかを返す.
+func (s *Status) Clean() bool {
+	return len(s.Staged) == 0 && len(s.Unstaged) == 0 && len(s.Unmerged) == 0 && len(s.Untracked) == 0
+}
+
+// StatusはHEAD、インデックス、作業ツリーを比較する.
+// 作業ツリーのファイルはインデックスのmtimeとサイズが一致すれば読まずに変更なしとみなす.
+func (c *Client) Status() (*Status, error) {
+	index, err := c.ReadIndex()
+	if err != nil {
+		return nil, err
+	}
+	head, err := c.ReadHead()
+	if err != nil {
+		return nil, err
+	}
+	trustFileMode, err := c.TrustFileMode()
+	if err != nil {
+		return nil, err
+	}
+	trustSymlinks, err := c.TrustSymlinks()
+	if err != nil {
+		return nil, err
+	}
+
+	status := &Status{Unmerged: index.Unmerged()}
+	var tree sha.SHA1
+	if !head.Unborn() {
+		tree = head.Hash
+	}
+	if status.Staged, err = c.DiffTreeIndex(tree, index); err != nil {
+		return nil, err
+	}
+	if c.IsBare() {
+		return status, nil
+	}
+	if status.Unstaged, err = c.diffIndexWorktree(index, trustFileMode, trustSymlinks); err != nil {
+		return nil, err
+	}
+	if status.Untracked, err = c.untrackedFiles(index); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// DiffTreeIndexはtree(コミットでもよい)からインデックスのステージ0のエントリへの変更をパス順に返す.
+// treeがnilなら空のツリーとして扱う.
+func (c *Client) DiffTreeIndex(tree sha.SHA1, index *Index) ([]TreeChange, error) {
+	headFiles := map[string]object.TreeEntry{}
+	if tree != nil {
+		if err := c.WalkTree(tree, nil, func(path string, entry object.TreeEntry) error {
+			headFiles[path] = entry
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	var changes []TreeChange
+	seen := map[string]struct{}{}
+	for _, entry := range index.Entries {
+		seen[entry.Path] = struct{}{}
+		if entry.Stage != 0 {
+			continue
+		}
+		old, ok := headFiles[entry.Path]
+		switch {
+		case !ok:
+			changes = append(changes, TreeChange{Type: ChangeAdd, Path: entry.Path, NewMode: entry.Mode, NewHash: entry.Hash})
+		case !bytes.Equal(old.Hash, entry.Hash) || old.Mode != entry.Mode:
+			changes = append(changes, TreeChange{
+				Type:    ChangeModify,
+				Path:    entry.Path,
+				OldMode: old.Mode,
+				OldHash: old.Hash,
+				NewMode: entry.Mode,
+				NewHash: entry.Hash,
+			})
+		}
+	}
+	for path, old := range headFiles {
+		if _, ok := seen[path]; !ok {
+			changes = append(changes, TreeChange{Type: ChangeDelete, Path: path, OldMode: old.Mode, OldHash: old.Hash})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// DiffIndexWorktreeはインデックスのステージ0のエントリから作業ツリーのファイルへの変更をパス順に返す.
+// 変更後のハッシュは作業ツリーの内容から計算したもので、オブジェクトとしては書き込まない.
+func (c *Client) DiffIndexWorktree(index *Index) ([]TreeChange, error) {
+	trustFileMode, err := c.TrustFileMode()
+	if err != nil {
+		return nil, err
+	}
+	trustSymlinks, err := c.TrustSymlinks()
+	if err != nil {
+		return nil, err
+	}
+	return c.diffIndexWorktree(index, trustFileMode, trustSymlinks)
+}
+
+func (c *Client) diffIndexWorktree(index *Index, trustFileMode, trustSymlinks bool) ([]TreeChange, error) {
+	// インデックスと同じ時刻以降に書き換えられたファイルは、mtimeが同じでも内容が違い得る(racy git).
+	var indexTime time.Time
+	if info, err := os.Stat(util.LongPath(c.indexFile)); err == nil {
+		indexTime = info.ModTime()
+	}
+
+	var changes []TreeChange
+	for _, entry := range index.Entries {
+		if entry.Stage != 0 {
+			continue
+		}
+		info, err := os.Lstat(util.LongPath(filepath.Join(c.workTree, filepath.FromSlash(entry.Path))))
+		if entry.Mode == object.ModeGitlink && err == nil && info.IsDir() {
+			// サブモジュールは取り出したHEADをインデックスのコミットと比べる. 取り出していなければ変更なしとする.
+			head, err := c.SubmoduleHead(entry.Path)
+			if err != nil {
+				return nil, err
+			}
+			if head != nil && !bytes.Equal(head, entry.Hash) {
+				changes = append(changes, TreeChange{
+					Type:    ChangeModify,
+					Path:    entry.Path,
+					OldMode: entry.Mode,
+					OldHash: entry.Hash,
+					NewMode: entry.Mode,
+					NewHash: head,
+				})
+			}
+			continue
+		}
+		if os.IsNotExist(err) || (err == nil && info.IsDir()) {
+			changes = append(changes, TreeChange{Type: ChangeDelete, Path: entry.Path, OldMode: entry.Mode, OldHash: entry.Hash})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		mode := FileModeOf(info)
+		if !trustFileMode && object.SameMode(mode, entry.Mode, false) {
+			mode = entry.Mode
+		}
+		if !trustSymlinks && entry.Mode == object.ModeSymlink && info.Mode().IsRegular() {
+			// シンボリックリンクを作らない作業ツリーでは、リンク先を書いた通常のファイルと比べる.
+			mode = entry.Mode
+		}
+		if mode == entry.Mode && statUnchanged(entry, info) && info.ModTime().Before(indexTime) {
+			continue
+		}
+		data, err := c.ReadWorktreeFile(entry.Path, info)
+		if err != nil {
+			return nil, err
+		}
+		hash := object.NewObject(object.BlobObject, data).Hash
+		if mode != entry.Mode || !bytes.Equal(hash, entry.Hash) {
+			changes = append(changes, TreeChange{
+				Type:    ChangeModify,
+				Path:    entry.Path,
+				OldMode: entry.Mode,
+				OldHash: entry.Hash,
+				NewMode: mode,
+				NewHash: hash,
+			})
+		}
+	}
+	return changes, nil
+}
+
+// statUnchangedはインデックスに記録したmtimeとサイズが作業ツリーのファイルと一致するかを返す.
+func statUnchanged(entry *IndexEntry, info os.FileInfo) bool {
+	return entry.MTime.Unix() == info.ModTime().Unix() &&
+		entry.MTime.Nanosecond() == info.ModTime().Nanosecond() &&
+		entry.Size == uint32(info.Size())
+}
+
+// untrackedFilesは作業ツリーにあってインデックスになく、無視もしないファイルを返す.
+func (c *Client) untrackedFiles(index *Index) ([]string, error) {
+	ignored, err := c.IgnoreMatcher()
+	if err != nil {
+		return nil, err
+	}
+	tracked := map[string]struct{}{}
+	trackedDirs := map[string]struct{}{}
+	for _, entry := range index.Entries {
+		tracked[entry.Path] = struct{}{}
+		for dir := path.Dir(entry.Path); dir != "."; dir = path.Dir(dir) {
+			trackedDirs[dir] = struct{}{}
+		}
+	}
+
+	var untracked []string
+	err = filepath.Walk(c.workTree, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == c.workTree {
+			return nil
+		}
+		rel, err := filepath.Rel(c.workTree, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if info.IsDir() {
+			if isGitDirName(info.Name()) {
+				return filepath.SkipDir
+			}
+			if _, ok := trackedDirs[rel]; ok {
+				return nil
+			}
+			if _, ok := tracked[rel]; ok {
+				return filepath.SkipDir
+			}
+			if ignored.Ignored(rel, true) {
+				return filepath.SkipDir
+			}
+			// 追跡しているファイルを含まないディレクトリは中身を列挙しない.
+			// 空のディレクトリや、無視するファイルしかないディレクトリは表示しない.
+			if hasUntrackedFiles(p, rel, ignored) {
+				untracked = append(untracked, rel+"/")
+			}
+			return filepath.SkipDir
+		}
+		if _, ok := tracked[rel]; !ok && !ignored.Ignored(rel, false) {
+			untracked = append(untracked, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return untracked, nil
+}
+
+// isGitDirNameは管理ディレクトリの名前(.fsegitや.git)かを返す.
+func isGitDirName(name string) bool {
+	for _, gitDirName := range util.GitDirNames {
+		if strings.EqualFold(name, gitDirName) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasUntrackedFilesは作業ツリーのディレクトリrel(ファイルシステム上はdir)以下に、
+// ディレクトリ以外の無視しないものがあるかを返す.
+func hasUntrackedFiles(dir, rel string, ignored *ignore.Matcher) bool {
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		sub, err := filepath.Rel(dir, p)
+		if err != nil {
+			return nil
+		}
+		name := path.Join(rel, filepath.ToSlash(sub))
+		if ignored.Ignored(name, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.IsDir() {
+			// 1つ見つかれば探索を打ち切る.
+			return io.EOF
+		}
+		return nil
+	})
+	return err == io.EOF
+}
@@ -0,0 +1,195 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kanon1343/fsegit/config"
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/util"
+)
+
+// gitmodulesFileはサブモジュールの名前、パス、URLを書く作業ツリーのルートのファイル.
+const gitmodulesFile = ".gitmodules"
+
+// Submoduleは.gitmodulesのsubmodule.<name>セクション.
+type Submodule struct {
+	Name string
+	// Pathは作業ツリーのルートからの"/"区切りのパス.
+	Path string
+	URL  string
+	// Branchはupdate --remoteで追うブランチ. 指定がなければ空.
+	Branch string
+}
+
+// ParseGitmodulesは.gitmodulesの内容を読み、パスのあるサブモジュールをパスの順に返す.
+func ParseGitmodules(data []byte) ([]Submodule, error) {
+	cfg, err := config.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	var submodules []Submodule
+	for _, name := range cfg.Subsections("submodule") {
+		path, ok := cfg.Get("submodule." + name + ".path")
+		if !ok {
+			continue
+		}
+		url, _ := cfg.Get("submodule." + name + ".url")
+		branch, _ := cfg.Get("submodule." + name + ".branch")
+		submodules = append(submodules, Submodule{Name: name, Path: strings.Trim(path, "/"), URL: url, Branch: branch})
+	}
+	sort.Slice(submodules, func(i, j int) bool { return submodules[i].Path < submodules[j].Path })
+	return submodules, nil
+}
+
+// Submodulesは作業ツリーの.gitmodulesに書かれたサブモジュールを返す. 作業ツリーにファイルがなければ
+// gitと同じくインデックスに登録された内容を読む. どちらにもなければnilを返す.
+func (c *Client) Submodules() ([]Submodule, error) {
+	var data []byte
+	err := error(os.ErrNotExist)
+	if c.workTree != "" {
+		data, err = ioutil.ReadFile(util.LongPath(filepath.Join(c.workTree, gitmodulesFile)))
+	}
+	if os.IsNotExist(err) {
+		index, err := c.ReadIndex()
+		if err != nil {
+			return nil, err
+		}
+		entry := index.Entry(gitmodulesFile)
+		if entry == nil {
+			return nil, nil
+		}
+		obj, err := c.GetObject(entry.Hash)
+		if err != nil {
+			return nil, err
+		}
+		data = obj.Data
+	} else if err != nil {
+		return nil, err
+	}
+	submodules, err := ParseGitmodules(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w : %s", err, gitmodulesFile)
+	}
+	return submodules, nil
+}
+
+// SubmoduleHeadは作業ツリーのpathに取り出したサブモジュールのHEADのコミットを返す.
+// 取り出していない(管理ディレクトリがない)か、まだコミットがなければnilを返す.
+func (c *Client) SubmoduleHead(path string) (sha.SHA1, error) {
+	dir := filepath.Join(c.workTree, filepath.FromSlash(path))
+	gitDir, err := submoduleGitDir(dir)
+	if gitDir == "" || err != nil {
+		return nil, err
+	}
+	sub, err := NewClientWithOptions(dir, Options{GitDir: gitDir, WorkTree: dir})
+	if err != nil {
+		return nil, err
+	}
+	head, err := sub.ReadHead()
+	if err != nil {
+		return nil, err
+	}
+	if head.Unborn() {
+		return nil, nil
+	}
+	return head.Hash, nil
+}
+
+// submoduleGitDirはサブモジュールの作業ツリーdirの管理ディレクトリを返す. gitが作る
+// "gitdir: <path>"と書いた.gitファイルにも対応する. 管理ディレクトリがなければ空文字列を返す.
+func submoduleGitDir(dir string) (string, error) {
+	for _, name := range util.GitDirNames {
+		gitDir := filepath.Join(dir, name)
+		info, err := os.Stat(util.LongPath(gitDir))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.IsDir() {
+			return gitDir, nil
+		}
+		data, err := ioutil.ReadFile(util.LongPath(gitDir))
+		if err != nil {
+			return "", err
+		}
+		line := strings.TrimSpace(string(data))
+		if !strings.HasPrefix(line, "gitdir: ") {
+			return "", fmt.Errorf("%w : invalid gitfile %s", util.ErrNotGitRepository, gitDir)
+		}
+		target := filepath.FromSlash(strings.TrimPrefix(line, "gitdir: "))
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(dir, target)
+		}
+		return target, nil
+	}
+	return "", nil
+}
+
+// SubmoduleStatusはSubmoduleStatusesが返すサブモジュール1つの状態.
+type SubmoduleStatus struct {
+	// Submoduleは.gitmodulesの設定. .gitmodulesに書かれていなければNameとPathだけを埋める.
+	Submodule
+	// Hashはインデックスに記録されたコミット. コンフリクト中なら自分の側(ステージ2)のコミット.
+	Hash sha.SHA1
+	// Currentは作業ツリーに取り出したサブモジュールのHEAD. 取り出していなければnil.
+	Current sha.SHA1
+	// Unmergedはインデックスでコンフリクトしていることを表す.
+	Unmerged bool
+}
+
+// Initializedはサブモジュールが作業ツリーに取り出してあるかを返す.
+func (s SubmoduleStatus) Initialized() bool {
+	return s.Current != nil
+}
+
+// Modifiedは取り出したサブモジュールのHEADがインデックスのコミットと違うかを返す.
+func (s SubmoduleStatus) Modified() bool {
+	return s.Current != nil && !bytes.Equal(s.Current, s.Hash)
+}
+
+// SubmoduleStatusesはインデックスのgitlinkのエントリごとに、サブモジュールの状態をパスの順に返す.
+func (c *Client) SubmoduleStatuses() ([]SubmoduleStatus, error) {
+	index, err := c.ReadIndex()
+	if err != nil {
+		return nil, err
+	}
+	submodules, err := c.Submodules()
+	if err != nil {
+		return nil, err
+	}
+	byPath := map[string]Submodule{}
+	for _, submodule := range submodules {
+		byPath[submodule.Path] = submodule
+	}
+
+	var statuses []SubmoduleStatus
+	for _, entry := range index.Entries {
+		if entry.Mode != object.ModeGitlink || (entry.Stage != 0 && entry.Stage != 2) {
+			continue
+		}
+		if n := len(statuses); n > 0 && statuses[n-1].Path == entry.Path {
+			continue
+		}
+		submodule, ok := byPath[entry.Path]
+		if !ok {
+			submodule = Submodule{Name: entry.Path, Path: entry.Path}
+		}
+		status := SubmoduleStatus{Submodule: submodule, Hash: entry.Hash, Unmerged: entry.Stage != 0}
+		if c.workTree != "" {
+			if status.Current, err = c.SubmoduleHead(entry.Path); err != nil {
+				return nil, err
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
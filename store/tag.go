@@ -0,0 +1,94 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+)
+
+const tagPrefix = "refs/tags/"
+
+// ListTagsはrefs/tags以下のタグを名前順に返す.
+func (c *Client) ListTags() ([]Ref, error) {
+	return c.ListRefs(tagPrefix)
+}
+
+// checkTagNameはnameがタグ名として使えるかを調べる.
+func checkTagName(name string) error {
+	if strings.HasPrefix(name, "-") || CheckRefName(tagPrefix+name) != nil {
+		return fmt.Errorf("%w : '%s' is not a valid tag name", ErrInvalidRefName, name)
+	}
+	return nil
+}
+
+// CreateTagはhashのオブジェクトを指す軽量タグnameを作る.
+// 既にあればforceがfalseならErrTagExistsを返し、trueなら置き換えて前に指していたハッシュを返す.
+func (c *Client) CreateTag(name string, hash sha.SHA1, force bool) (sha.SHA1, error) {
+	if err := checkTagName(name); err != nil {
+		return nil, err
+	}
+	old, err := c.ResolveRef(tagPrefix + name)
+	if err == nil && !force {
+		return nil, fmt.Errorf("%w : %s", ErrTagExists, name)
+	}
+	ok, err := c.HasObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w : %s", ErrRefNotFound, hash)
+	}
+	return old, c.WriteRef(tagPrefix+name, hash)
+}
+
+// CreateAnnotatedTagはhashのオブジェクトにtaggerとmessageを付けたタグオブジェクトを書き込み、それを指すタグnameを作る.
+// 既にあるときの扱いはCreateTagと同じ. 書き込んだタグオブジェクトのハッシュと、前に指していたハッシュを返す.
+func (c *Client) CreateAnnotatedTag(name string, hash sha.SHA1, tagger object.Signature, message string, force bool) (tagHash, old sha.SHA1, err error) {
+	return c.createAnnotatedTag(name, hash, tagger, message, force, false)
+}
+
+// CreateSignedTagはCreateAnnotatedTagと同じくタグを作るが、タグオブジェクトのメッセージの後にSignで作った署名を付ける.
+func (c *Client) CreateSignedTag(name string, hash sha.SHA1, tagger object.Signature, message string, force bool) (tagHash, old sha.SHA1, err error) {
+	return c.createAnnotatedTag(name, hash, tagger, message, force, true)
+}
+
+func (c *Client) createAnnotatedTag(name string, hash sha.SHA1, tagger object.Signature, message string, force, sign bool) (tagHash, old sha.SHA1, err error) {
+	if err := checkTagName(name); err != nil {
+		return nil, nil, err
+	}
+	if _, err := c.ResolveRef(tagPrefix + name); err == nil && !force {
+		return nil, nil, fmt.Errorf("%w : %s", ErrTagExists, name)
+	}
+	target, err := c.GetObject(hash)
+	if err != nil {
+		return nil, nil, err
+	}
+	tag := object.Tag{
+		Object:     hash,
+		ObjectType: target.Type,
+		Name:       name,
+		Tagger:     tagger,
+		Message:    message,
+	}
+	if sign {
+		if tag, err = c.signTag(tag); err != nil {
+			return nil, nil, err
+		}
+	}
+	if tagHash, err = c.StoreRaw(object.TagObject, tag.Encode()); err != nil {
+		return nil, nil, err
+	}
+	old, err = c.CreateTag(name, tagHash, true)
+	return tagHash, old, err
+}
+
+// DeleteTagはタグnameを削除し、削除前に指していたハッシュを返す.
+func (c *Client) DeleteTag(name string) (sha.SHA1, error) {
+	hash, err := c.ResolveRef(tagPrefix + name)
+	if err != nil {
+		return nil, fmt.Errorf("%w : tag '%s'", ErrRefNotFound, name)
+	}
+	return hash, c.DeleteRef(tagPrefix + name)
+}
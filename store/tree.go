@@ -0,0 +1,147 @@
+package store
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+)
+
+// GetTreeはhashで指定したツリーを返す. hashがコミットの場合はそのルートツリーを返す.
+// タグはその先のオブジェクトまで辿る.
+func (c *Client) GetTree(hash sha.SHA1) (*object.Tree, error) {
+	obj, err := c.GetObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	for obj.Type == object.TagObject {
+		tag, err := object.NewTag(obj)
+		if err != nil {
+			return nil, err
+		}
+		if obj, err = c.GetObject(tag.Object); err != nil {
+			return nil, err
+		}
+	}
+	if obj.Type == object.CommitObject {
+		commit, err := object.NewCommit(obj)
+		if err != nil {
+			return nil, err
+		}
+		if obj, err = c.GetObject(commit.Tree); err != nil {
+			return nil, err
+		}
+	}
+	return object.NewTree(obj)
+}
+
+// TreeFilterはWalkTreeで辿るパスを絞り込む.
+type TreeFilter interface {
+	// Matchはpathのエントリを返すかを判定する.
+	Match(path string) bool
+	// MatchDirはdir以下にマッチし得るエントリがあるかを判定する. falseならdirの探索を打ち切る.
+	MatchDir(dir string) bool
+}
+
+// TreeWalkFuncはツリー中のファイルエントリごとに呼ばれる. pathはルートからの"/"区切りのパス.
+type TreeWalkFunc func(path string, entry object.TreeEntry) error
+
+// hashで指定したツリーを再帰的に辿り、filterにマッチするファイルエントリにwalkFuncを適用する.
+// filterがnilの場合は全てのエントリを辿る.
+func (c *Client) WalkTree(hash sha.SHA1, filter TreeFilter, walkFunc TreeWalkFunc) error {
+	tree, err := c.GetTree(hash)
+	if err != nil {
+		return err
+	}
+	return c.walkTree(tree, "", 0, filter, walkFunc)
+}
+
+// MaxTreeDepthはWalkTreeで辿るサブツリーの深さの上限.
+var MaxTreeDepth = 2048
+
+func (c *Client) walkTree(tree *object.Tree, dir string, depth int, filter TreeFilter, walkFunc TreeWalkFunc) error {
+	if depth > MaxTreeDepth {
+		return fmt.Errorf("%w : %s", ErrTreeTooDeep, dir)
+	}
+	for _, entry := range tree.Entries {
+		entryPath := path.Join(dir, entry.Name)
+
+		if entry.Mode.IsTree() {
+			if filter != nil && !filter.MatchDir(entryPath) {
+				continue
+			}
+			subTree, err := c.GetTree(entry.Hash)
+			if err != nil {
+				return err
+			}
+			if err := c.walkTree(subTree, entryPath, depth+1, filter, walkFunc); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if filter != nil && !filter.Match(entryPath) {
+			continue
+		}
+		if err := walkFunc(entryPath, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PathEntryはルートからのパスを持つツリーエントリ.
+type PathEntry struct {
+	Path string
+	Mode object.FileMode
+	Hash sha.SHA1
+}
+
+// BuildTreeはパスの一覧からサブツリーを下の階層から順に書き込み、ルートツリーのハッシュを返す.
+// 同じ名前がファイルとディレクトリの両方に使われていればErrPathConflictを返す.
+func (c *Client) BuildTree(entries []PathEntry) (sha.SHA1, error) {
+	tree := &object.Tree{}
+	var dirs []string
+	children := map[string][]PathEntry{}
+	files := map[string]struct{}{}
+	for _, entry := range entries {
+		i := strings.IndexByte(entry.Path, '/')
+		if i < 0 {
+			files[entry.Path] = struct{}{}
+			tree.Entries = append(tree.Entries, object.TreeEntry{
+				Mode: entry.Mode,
+				Name: entry.Path,
+				Hash: entry.Hash,
+			})
+			continue
+		}
+		dir := entry.Path[:i]
+		if _, ok := children[dir]; !ok {
+			dirs = append(dirs, dir)
+		}
+		children[dir] = append(children[dir], PathEntry{
+			Path: entry.Path[i+1:],
+			Mode: entry.Mode,
+			Hash: entry.Hash,
+		})
+	}
+
+	for _, dir := range dirs {
+		if _, ok := files[dir]; ok {
+			return nil, fmt.Errorf("%w : %s", ErrPathConflict, dir)
+		}
+		hash, err := c.BuildTree(children[dir])
+		if err != nil {
+			return nil, err
+		}
+		tree.Entries = append(tree.Entries, object.TreeEntry{
+			Mode: object.ModeTree,
+			Name: dir,
+			Hash: hash,
+		})
+	}
+
+	return c.StoreRaw(object.TreeObject, tree.Encode())
+}
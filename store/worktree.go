@@ -0,0 +1,227 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/util"
+)
+
+// ReadWorktreeFileは作業ツリーのpathの内容をブロブのデータとして読む.
+// シンボリックリンクはリンク先を辿らず、リンク先のパスをデータとする.
+// core.autocrlfがtrueかinputなら、テキストのファイルのCRLFをLFにする.
+func (c *Client) ReadWorktreeFile(path string, info os.FileInfo) ([]byte, error) {
+	name := util.LongPath(filepath.Join(c.workTree, filepath.FromSlash(path)))
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(name)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(filepath.ToSlash(target)), nil
+	}
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	autoCRLF, err := c.AutoCRLF()
+	if err != nil {
+		return nil, err
+	}
+	if autoCRLF != AutoCRLFFalse {
+		data = ConvertToLF(data)
+	}
+	return data, nil
+}
+
+// smallBlobSizeはWriteWorktreeBlobがメモリに読み込んでから書き込むファイルの大きさの上限.
+const smallBlobSize = 1 << 20
+
+// WriteWorktreeBlobは作業ツリーのpathの内容をブロブとして書き込み、ハッシュを返す.
+func (c *Client) WriteWorktreeBlob(path string, info os.FileInfo) (sha.SHA1, error) {
+	autoCRLF, err := c.AutoCRLF()
+	if err != nil {
+		return nil, err
+	}
+	// 改行コードを変換する場合は内容全体を見る必要がある. 小さなファイルも読み込んで先にハッシュを計算し、
+	// 既にあるオブジェクトなら圧縮せずに済ませる.
+	if !info.Mode().IsRegular() || autoCRLF != AutoCRLFFalse || info.Size() <= smallBlobSize {
+		data, err := c.ReadWorktreeFile(path, info)
+		if err != nil {
+			return nil, err
+		}
+		return c.StoreRaw(object.BlobObject, data)
+	}
+	// 大きなファイルもメモリに読み込まずに書き込む.
+	f, err := os.Open(util.LongPath(filepath.Join(c.workTree, filepath.FromSlash(path))))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return c.StoreReader(object.BlobObject, info.Size(), f)
+}
+
+// WalkWorktreeは作業ツリーのファイルとシンボリックリンクを辿って、ルートからの"/"区切りのパスと情報をwalkFuncに渡す.
+// 管理ディレクトリ(.fsegitや.git)と、その中に管理ディレクトリを持つ別のリポジトリは辿らない.
+// skipがtrueを返したディレクトリ(isDirがtrue)は中を辿らず、ファイルはwalkFuncに渡さない.
+func (c *Client) WalkWorktree(skip func(path string, isDir bool) bool, walkFunc func(path string, info os.FileInfo) error) error {
+	if c.workTree == "" {
+		return ErrNoWorkTree
+	}
+	return filepath.Walk(c.workTree, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == c.workTree {
+			return nil
+		}
+		rel, err := filepath.Rel(c.workTree, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if info.IsDir() {
+			if isGitDirName(info.Name()) || isNestedRepository(p) || (skip != nil && skip(rel, true)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if skip != nil && skip(rel, false) {
+			return nil
+		}
+		return walkFunc(rel, info)
+	})
+}
+
+// isNestedRepositoryはdirが管理ディレクトリを持つ別のリポジトリかを返す.
+func isNestedRepository(dir string) bool {
+	for _, name := range util.GitDirNames {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteWorktreeEntryはhashのブロブを作業ツリーのpathにmodeに従って書き出し、書き出したファイルの情報を返す.
+// pathに既にあるファイルは置き換える. core.autocrlfがtrueなら、テキストのファイルのLFをCRLFにして書き出す.
+// 管理ディレクトリの中を指すpathは、ツリーやインデックスを読むときに弾かれているはずだが、念のためここでも
+// ErrUnsafePathにして書き出さない.
+func (c *Client) WriteWorktreeEntry(path string, mode object.FileMode, hash sha.SHA1) (os.FileInfo, error) {
+	if c.inGitDir(path) {
+		return nil, fmt.Errorf("%w : %s", ErrUnsafePath, path)
+	}
+	name := util.LongPath(filepath.Join(c.workTree, filepath.FromSlash(path)))
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return nil, err
+	}
+	if mode == object.ModeGitlink {
+		// サブモジュールは中身を取り出さず、空のディレクトリだけを作る.
+		if err := os.MkdirAll(name, 0755); err != nil {
+			return nil, err
+		}
+		return os.Lstat(name)
+	}
+
+	// 大きなブロブもメモリに読み込まずに書き出す.
+	blob, err := c.OpenObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Close()
+	if blob.Type != object.BlobObject {
+		return nil, fmt.Errorf("%w : %s is not a blob", object.ErrInvalidTreeObject, hash)
+	}
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if mode == object.ModeSymlink {
+		trustSymlinks, err := c.TrustSymlinks()
+		if err != nil {
+			return nil, err
+		}
+		if !trustSymlinks {
+			// シンボリックリンクを作らない作業ツリーでは、リンク先を内容とする通常のファイルとして書き出す.
+			mode = object.ModeBlob
+		}
+	}
+	if mode == object.ModeSymlink {
+		target, err := ioutil.ReadAll(blob)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Symlink(filepath.FromSlash(string(target)), name); err != nil {
+			return nil, err
+		}
+		return os.Lstat(name)
+	}
+	autoCRLF, err := c.AutoCRLF()
+	if err != nil {
+		return nil, err
+	}
+	var src io.Reader = blob
+	if autoCRLF == AutoCRLFTrue {
+		data, err := ioutil.ReadAll(blob)
+		if err != nil {
+			return nil, err
+		}
+		src = bytes.NewReader(ConvertToCRLF(data))
+	}
+	perm := os.FileMode(0644)
+	if mode == object.ModeExecutable {
+		perm = 0755
+	}
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(f, src); err != nil {
+		f.Close()
+		os.Remove(name)
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	return os.Lstat(name)
+}
+
+// RemoveWorktreeFileは作業ツリーのpathを削除し、空になった親ディレクトリも取り除く.
+// WriteWorktreeEntryと同じく、管理ディレクトリの中を指すpathはErrUnsafePathにして削除しない.
+func (c *Client) RemoveWorktreeFile(path string) error {
+	if c.inGitDir(path) {
+		return fmt.Errorf("%w : %s", ErrUnsafePath, path)
+	}
+	name := filepath.Join(c.workTree, filepath.FromSlash(path))
+	if err := os.Remove(util.LongPath(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for dir := filepath.Dir(name); dir != c.workTree && strings.HasPrefix(dir, c.workTree); dir = filepath.Dir(dir) {
+		// 空でないディレクトリの削除は失敗するので、そこで止める.
+		if os.Remove(util.LongPath(dir)) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// inGitDirは作業ツリーからの相対パスpathのいずれかの要素が、大文字と小文字の違いなどを除いて管理ディレクトリの名前に
+// なるかを返す. 管理ディレクトリが作業ツリーの直下にあれば、その実際の名前とも比べる.
+func (c *Client) inGitDir(path string) bool {
+	gitDirName := ""
+	if filepath.Dir(c.gitDir) == filepath.Clean(c.workTree) {
+		gitDirName = filepath.Base(c.gitDir)
+	}
+	for _, name := range strings.Split(path, "/") {
+		if util.IsGitDirName(name) || (gitDirName != "" && strings.EqualFold(name, gitDirName)) {
+			return true
+		}
+	}
+	return false
+}
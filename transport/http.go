@@ -0,0 +1,473 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kanon1343/fsegit/sha"
+)
+
+// UserAgentはHTTPリクエストとagentケーパビリティで名乗る名前.
+const UserAgent = "fsegit/0.1"
+
+// Refはリモートが広告した参照.
+type Ref struct {
+	Name string
+	Hash sha.SHA1
+	// Peeledは注釈付きタグの指すオブジェクト. 広告に"^{}"の行がなければnil.
+	Peeled sha.SHA1
+}
+
+// Advertisementはリモートが最初に送る参照の一覧とケーパビリティ.
+type Advertisement struct {
+	Refs         []Ref
+	Capabilities []string
+}
+
+// Hasはリモートがcapabilityに対応しているかを返す.
+func (a *Advertisement) Has(capability string) bool {
+	for _, c := range a.Capabilities {
+		if c == capability || strings.HasPrefix(c, capability+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// Symrefはリモートのシンボリック参照name(たいていHEAD)の指す先を返す. 分からなければ空文字列を返す.
+func (a *Advertisement) Symref(name string) string {
+	for _, c := range a.Capabilities {
+		if strings.HasPrefix(c, "symref="+name+":") {
+			return strings.TrimPrefix(c, "symref="+name+":")
+		}
+	}
+	return ""
+}
+
+// Lookupはnameの参照のハッシュを返す.
+func (a *Advertisement) Lookup(name string) (sha.SHA1, bool) {
+	for _, ref := range a.Refs {
+		if ref.Name == name {
+			return ref.Hash, true
+		}
+	}
+	return nil, false
+}
+
+// Remoteはsmart HTTPで通信するリモートのリポジトリ.
+type Remote struct {
+	// URLはリポジトリのURL. "https://example.com/repo.git"のような形.
+	URL string
+	// HTTPはリクエストに使うクライアント.
+	HTTP *http.Client
+	// Progressにはリモートが送る進捗のメッセージを書く. nilなら進捗を送らないように頼む.
+	Progress io.Writer
+}
+
+// NewRemoteはurlのリモートを返す.
+func NewRemote(url string) *Remote {
+	return &Remote{URL: strings.TrimSuffix(url, "/"), HTTP: http.DefaultClient}
+}
+
+// ListRefsはservice("git-upload-pack"か"git-receive-pack")の参照の広告を取得する.
+func (r *Remote) ListRefs(service string) (*Advertisement, error) {
+	return r.ListRefsContext(context.Background(), service)
+}
+
+// ListRefsContextはListRefsと同じだが、ctxが取り消されたら通信をやめてctx.Err()を返す.
+func (r *Remote) ListRefsContext(ctx context.Context, service string) (*Advertisement, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", r.URL+"/info/refs?service="+service, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	resp, err := r.HTTP.Do(req)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w : %s", ErrRepositoryNotFound, r.URL)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w : %s: %s", ErrHTTP, r.URL, resp.Status)
+	}
+	if resp.Header.Get("Content-Type") != "application/x-"+service+"-advertisement" {
+		return nil, fmt.Errorf("%w : %s", ErrUnsupportedProtocol, r.URL)
+	}
+
+	pr := NewPacketReader(bufio.NewReader(&contextReader{ctx: ctx, r: resp.Body}))
+	data, _, err := pr.ReadPacket()
+	if err != nil {
+		return nil, err
+	}
+	if trimNewline(string(data)) != "# service="+service {
+		return nil, fmt.Errorf("%w : unexpected first line %q", ErrInvalidPacket, data)
+	}
+	// サービス名の行の後にflush-pktがある.
+	if _, flush, err := pr.ReadPacket(); err != nil {
+		return nil, err
+	} else if !flush {
+		return nil, fmt.Errorf("%w : missing flush after service line", ErrInvalidPacket)
+	}
+	return readAdvertisement(pr)
+}
+
+// readAdvertisementは参照の広告をflush-pktまで読む. 最初の行だけNULの後にケーパビリティが続く.
+func readAdvertisement(pr *PacketReader) (*Advertisement, error) {
+	adv := &Advertisement{}
+	for first := true; ; first = false {
+		data, flush, err := pr.ReadPacket()
+		if err != nil {
+			return nil, err
+		}
+		if flush {
+			return adv, nil
+		}
+		line := trimNewline(string(data))
+		if first {
+			if i := strings.IndexByte(line, 0); i >= 0 {
+				adv.Capabilities = strings.Fields(line[i+1:])
+				line = line[:i]
+			}
+		}
+		if strings.HasPrefix(line, "ERR ") {
+			return nil, fmt.Errorf("%w : %s", ErrRemote, line[4:])
+		}
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%w : bad ref line %q", ErrInvalidPacket, line)
+		}
+		hash, err := hex.DecodeString(fields[0])
+		if err != nil || len(hash) != 20 {
+			return nil, fmt.Errorf("%w : bad ref line %q", ErrInvalidPacket, line)
+		}
+		// 空のリポジトリは"capabilities^{}"という名前でケーパビリティだけを送る.
+		// 注釈付きタグの"^{}"の行は直前のタグの指すオブジェクトで、参照ではない.
+		if strings.HasSuffix(fields[1], "^{}") {
+			if n := len(adv.Refs); n > 0 && adv.Refs[n-1].Name == strings.TrimSuffix(fields[1], "^{}") {
+				adv.Refs[n-1].Peeled = hash
+			}
+			continue
+		}
+		adv.Refs = append(adv.Refs, Ref{Name: fields[1], Hash: hash})
+	}
+}
+
+// FetchPackはwantsのオブジェクトと、havesから辿れないその祖先を含むパックを要求し、パックのデータを返す.
+// 返したio.ReadCloserは呼び出し側で閉じる.
+func (r *Remote) FetchPack(adv *Advertisement, wants, haves []sha.SHA1) (io.ReadCloser, error) {
+	return r.FetchPackContext(context.Background(), adv, wants, haves)
+}
+
+// FetchPackContextはFetchPackと同じだが、ctxが取り消されたら通信をやめてctx.Err()を返す.
+// 返したio.ReadCloserの読み込みも、ctxが取り消されるとctx.Err()を返す.
+func (r *Remote) FetchPackContext(ctx context.Context, adv *Advertisement, wants, haves []sha.SHA1) (io.ReadCloser, error) {
+	packData, _, err := r.FetchPackWithOptions(ctx, adv, wants, haves, FetchOptions{})
+	return packData, err
+}
+
+// FetchOptionsはFetchPackWithOptionsの設定.
+type FetchOptions struct {
+	// Depthが正なら、wantsからその数のコミットまでの浅い履歴を要求する.
+	Depth int
+	// Shallowは手元の浅い履歴の境界のコミット. 浅いリポジトリから取得するときは必ず渡す.
+	Shallow []sha.SHA1
+}
+
+// ShallowUpdateはリモートが返した浅い履歴の境界の変化.
+type ShallowUpdate struct {
+	// Shallowは新しく境界になったコミット.
+	Shallow []sha.SHA1
+	// Unshallowは親も送られてくるので境界でなくなったコミット.
+	Unshallow []sha.SHA1
+}
+
+// FetchPackWithOptionsはFetchPackContextと同じだが、optsで浅い履歴を要求できる.
+// Depthを指定したときは境界の変化も返す. リモートが浅い履歴に対応していなければErrShallowUnsupportedを返す.
+func (r *Remote) FetchPackWithOptions(ctx context.Context, adv *Advertisement, wants, haves []sha.SHA1, opts FetchOptions) (io.ReadCloser, *ShallowUpdate, error) {
+	shallow := opts.Depth > 0 || len(opts.Shallow) > 0
+	if shallow && !adv.Has("shallow") {
+		return nil, nil, ErrShallowUnsupported
+	}
+	capabilities := []string{"ofs-delta", "agent=" + UserAgent}
+	sideband := ""
+	for _, c := range []string{"side-band-64k", "side-band"} {
+		if adv.Has(c) {
+			sideband = c
+			capabilities = append(capabilities, c)
+			break
+		}
+	}
+	if r.Progress == nil && adv.Has("no-progress") {
+		capabilities = append(capabilities, "no-progress")
+	}
+	if adv.Has("include-tag") {
+		capabilities = append(capabilities, "include-tag")
+	}
+	if shallow {
+		capabilities = append(capabilities, "shallow")
+	}
+
+	var body bytes.Buffer
+	for i, want := range wants {
+		line := "want " + want.String()
+		if i == 0 {
+			line += " " + strings.Join(capabilities, " ")
+		}
+		WritePacketString(&body, line+"\n")
+	}
+	for _, hash := range opts.Shallow {
+		WritePacketString(&body, "shallow "+hash.String()+"\n")
+	}
+	if opts.Depth > 0 {
+		WritePacketString(&body, "deepen "+strconv.Itoa(opts.Depth)+"\n")
+	}
+	WriteFlush(&body)
+	for _, have := range haves {
+		WritePacketString(&body, "have "+have.String()+"\n")
+	}
+	WritePacketString(&body, "done\n")
+
+	resp, err := r.post(ctx, "git-upload-pack", &body)
+	if err != nil {
+		return nil, nil, err
+	}
+	br := bufio.NewReader(&contextReader{ctx: ctx, r: resp.Body})
+	pr := NewPacketReader(br)
+	// 浅い履歴の境界の変化は、deepenを送ったときだけACKかNAKの前に送られてくる.
+	var update *ShallowUpdate
+	if opts.Depth > 0 {
+		if update, err = readShallowInfo(pr); err != nil {
+			resp.Body.Close()
+			return nil, nil, contextError(ctx, err)
+		}
+	}
+	// doneを送ったので、ACKかNAKの行の後にパックが続く.
+	for {
+		peek, err := br.Peek(5)
+		if err != nil {
+			resp.Body.Close()
+			return nil, nil, contextError(ctx, fmt.Errorf("%w : %s", ErrInvalidPacket, err))
+		}
+		if sideband == "" && string(peek[:4]) == "PACK" {
+			break
+		}
+		if sideband != "" && peek[4] != 'A' && peek[4] != 'N' && peek[4] != 'E' {
+			break
+		}
+		data, _, err := pr.ReadPacket()
+		if err != nil {
+			resp.Body.Close()
+			return nil, nil, err
+		}
+		if line := trimNewline(string(data)); strings.HasPrefix(line, "ERR ") {
+			resp.Body.Close()
+			return nil, nil, fmt.Errorf("%w : %s", ErrRemote, line[4:])
+		}
+	}
+	if sideband == "" {
+		return readCloser{br, resp.Body}, update, nil
+	}
+	return readCloser{&sidebandReader{pr: pr, progress: r.Progress}, resp.Body}, update, nil
+}
+
+// readShallowInfoはACKかNAKの前に送られてくる"shallow <hash>"と"unshallow <hash>"の行をflush-pktまで読む.
+func readShallowInfo(pr *PacketReader) (*ShallowUpdate, error) {
+	update := &ShallowUpdate{}
+	for {
+		data, flush, err := pr.ReadPacket()
+		if err != nil {
+			return nil, err
+		}
+		if flush {
+			return update, nil
+		}
+		line := trimNewline(string(data))
+		if strings.HasPrefix(line, "ERR ") {
+			return nil, fmt.Errorf("%w : %s", ErrRemote, line[4:])
+		}
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 || (fields[0] != "shallow" && fields[0] != "unshallow") {
+			return nil, fmt.Errorf("%w : bad shallow line %q", ErrInvalidPacket, line)
+		}
+		hash, err := hex.DecodeString(fields[1])
+		if err != nil || len(hash) != 20 {
+			return nil, fmt.Errorf("%w : bad shallow line %q", ErrInvalidPacket, line)
+		}
+		if fields[0] == "shallow" {
+			update.Shallow = append(update.Shallow, hash)
+		} else {
+			update.Unshallow = append(update.Unshallow, hash)
+		}
+	}
+}
+
+// postはserviceにbodyを送り、成功すれば応答を返す.
+func (r *Remote) post(ctx context.Context, service string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", r.URL+"/"+service, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	req.Header.Set("Content-Type", "application/x-"+service+"-request")
+	req.Header.Set("Accept", "application/x-"+service+"-result")
+	resp, err := r.HTTP.Do(req)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w : %s/%s: %s", ErrHTTP, r.URL, service, resp.Status)
+	}
+	return resp, nil
+}
+
+// readCloserは読み込みと閉じる処理を別々のものに任せる.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// contextReaderはctxが取り消されたことで読み込みに失敗したとき、通信のエラーの代わりにctx.Err()を返す.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = contextError(cr.ctx, err)
+	}
+	return n, err
+}
+
+// contextErrorはctxが取り消されていればctx.Err()を、そうでなければerrを返す.
+func contextError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+// Commandはpushで更新するリモートの参照. Oldがnilなら作成、Newがnilなら削除を表す.
+type Command struct {
+	Name string
+	Old  sha.SHA1
+	New  sha.SHA1
+}
+
+// RefStatusはreceive-packが報告した参照ごとの結果. OKでなければReasonに理由が入る.
+type RefStatus struct {
+	Name   string
+	OK     bool
+	Reason string
+}
+
+// PushResultはreceive-packのreport-statusの内容.
+type PushResult struct {
+	// Unpackはパックの展開の結果. 成功なら"ok".
+	Unpack string
+	Refs   []RefStatus
+}
+
+// Statusはnameの参照の結果を返す.
+func (r *PushResult) Status(name string) (RefStatus, bool) {
+	for _, status := range r.Refs {
+		if status.Name == name {
+			return status, true
+		}
+	}
+	return RefStatus{}, false
+}
+
+// zeroHashは参照がないことを表すハッシュ.
+var zeroHash = sha.SHA1(make([]byte, 20))
+
+// SendPackはreceive-packにcommandsとpackのデータを送り、report-statusの結果を返す.
+// packは削除だけのときはnilでよい.
+func (r *Remote) SendPack(adv *Advertisement, commands []Command, pack []byte) (*PushResult, error) {
+	return r.SendPackContext(context.Background(), adv, commands, pack)
+}
+
+// SendPackContextはSendPackと同じだが、ctxが取り消されたら通信をやめてctx.Err()を返す.
+func (r *Remote) SendPackContext(ctx context.Context, adv *Advertisement, commands []Command, pack []byte) (*PushResult, error) {
+	capabilities := []string{"report-status", "agent=" + UserAgent}
+	sideband := adv.Has("side-band-64k")
+	if sideband {
+		capabilities = append(capabilities, "side-band-64k")
+	}
+	if r.Progress == nil && adv.Has("quiet") {
+		capabilities = append(capabilities, "quiet")
+	}
+
+	var body bytes.Buffer
+	for i, cmd := range commands {
+		oldHash, newHash := cmd.Old, cmd.New
+		if oldHash == nil {
+			oldHash = zeroHash
+		}
+		if newHash == nil {
+			newHash = zeroHash
+		}
+		line := oldHash.String() + " " + newHash.String() + " " + cmd.Name
+		if i == 0 {
+			line += "\x00" + strings.Join(capabilities, " ")
+		}
+		if err := WritePacketString(&body, line+"\n"); err != nil {
+			return nil, err
+		}
+	}
+	WriteFlush(&body)
+	body.Write(pack)
+
+	resp, err := r.post(ctx, "git-receive-pack", &body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var status io.Reader = bufio.NewReader(&contextReader{ctx: ctx, r: resp.Body})
+	if sideband {
+		status = bufio.NewReader(&sidebandReader{pr: NewPacketReader(status), progress: r.Progress})
+	}
+	return readReportStatus(NewPacketReader(status))
+}
+
+// readReportStatusは"unpack ok"に続く"ok <ref>"か"ng <ref> <reason>"の行をflush-pktまで読む.
+func readReportStatus(pr *PacketReader) (*PushResult, error) {
+	result := &PushResult{}
+	for first := true; ; first = false {
+		data, flush, err := pr.ReadPacket()
+		if err != nil {
+			return nil, err
+		}
+		if flush {
+			return result, nil
+		}
+		line := trimNewline(string(data))
+		if first {
+			if !strings.HasPrefix(line, "unpack ") {
+				return nil, fmt.Errorf("%w : bad report-status line %q", ErrInvalidPacket, line)
+			}
+			result.Unpack = line[len("unpack "):]
+			continue
+		}
+		fields := strings.SplitN(line, " ", 3)
+		switch {
+		case len(fields) >= 2 && fields[0] == "ok":
+			result.Refs = append(result.Refs, RefStatus{Name: fields[1], OK: true})
+		case len(fields) == 3 && fields[0] == "ng":
+			result.Refs = append(result.Refs, RefStatus{Name: fields[1], Reason: fields[2]})
+		default:
+			return nil, fmt.Errorf("%w : bad report-status line %q", ErrInvalidPacket, line)
+		}
+	}
+}
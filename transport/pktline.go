@@ -0,0 +1,140 @@
+// Package transportはgitのsmart HTTPプロトコルでリモートのリポジトリと通信する.
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+var (
+	ErrInvalidPacket       = errors.New("invalid pkt-line")
+	ErrRemote              = errors.New("remote error")
+	ErrUnsupportedProtocol = errors.New("server does not support the smart HTTP protocol")
+	ErrHTTP                = errors.New("unexpected HTTP status")
+	ErrRepositoryNotFound  = errors.New("repository not found")
+	ErrShallowUnsupported  = errors.New("server does not support shallow clients")
+)
+
+const (
+	// maxPacketSizeは長さの4バイトを含むpkt-lineの最大の長さ.
+	maxPacketSize = 65520
+
+	// side-bandの番号.
+	bandData     = 1
+	bandProgress = 2
+	bandError    = 3
+)
+
+// WritePacketはdataを"<16進4桁の長さ><data>"のpkt-lineとして書き込む.
+func WritePacket(w io.Writer, data []byte) error {
+	if len(data)+4 > maxPacketSize {
+		return fmt.Errorf("%w : %d bytes is too long", ErrInvalidPacket, len(data))
+	}
+	if _, err := fmt.Fprintf(w, "%04x", len(data)+4); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// WritePacketStringはsをpkt-lineとして書き込む.
+func WritePacketString(w io.Writer, s string) error {
+	return WritePacket(w, []byte(s))
+}
+
+// WriteFlushは区切りのflush-pkt("0000")を書き込む.
+func WriteFlush(w io.Writer) error {
+	_, err := io.WriteString(w, "0000")
+	return err
+}
+
+// PacketReaderはpkt-lineを1つずつ読む.
+type PacketReader struct {
+	r io.Reader
+}
+
+// NewPacketReaderはrからpkt-lineを読むPacketReaderを返す.
+func NewPacketReader(r io.Reader) *PacketReader {
+	return &PacketReader{r: r}
+}
+
+// ReadPacketは次のpkt-lineの内容を返す. flush-pktならflushにtrueを返す.
+func (pr *PacketReader) ReadPacket() (data []byte, flush bool, err error) {
+	var length [4]byte
+	if _, err := io.ReadFull(pr.r, length[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = fmt.Errorf("%w : truncated length", ErrInvalidPacket)
+		}
+		return nil, false, err
+	}
+	n, err := strconv.ParseUint(string(length[:]), 16, 16)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w : bad length %q", ErrInvalidPacket, length[:])
+	}
+	switch {
+	case n == 0:
+		return nil, true, nil
+	case n < 4 || n > maxPacketSize:
+		return nil, false, fmt.Errorf("%w : bad length %q", ErrInvalidPacket, length[:])
+	}
+	data = make([]byte, n-4)
+	if _, err := io.ReadFull(pr.r, data); err != nil {
+		return nil, false, fmt.Errorf("%w : %s", ErrInvalidPacket, err)
+	}
+	return data, false, nil
+}
+
+// sidebandReaderはside-bandで多重化された応答からパックのデータだけを取り出す.
+// 進捗のメッセージはprogressに書き、エラーのメッセージはErrRemoteとして返す.
+type sidebandReader struct {
+	pr       *PacketReader
+	progress io.Writer
+	buf      []byte
+	done     bool
+}
+
+func (sr *sidebandReader) Read(p []byte) (int, error) {
+	for len(sr.buf) == 0 {
+		if sr.done {
+			return 0, io.EOF
+		}
+		data, flush, err := sr.pr.ReadPacket()
+		if err == io.EOF {
+			return 0, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		if flush {
+			sr.done = true
+			continue
+		}
+		if len(data) == 0 {
+			continue
+		}
+		switch data[0] {
+		case bandData:
+			sr.buf = data[1:]
+		case bandProgress:
+			if sr.progress != nil {
+				sr.progress.Write(data[1:])
+			}
+		case bandError:
+			return 0, fmt.Errorf("%w : %s", ErrRemote, trimNewline(string(data[1:])))
+		default:
+			return 0, fmt.Errorf("%w : unknown side-band %d", ErrInvalidPacket, data[0])
+		}
+	}
+	n := copy(p, sr.buf)
+	sr.buf = sr.buf[n:]
+	return n, nil
+}
+
+func trimNewline(s string) string {
+	if len(s) > 0 && s[len(s)-1] == '\n' {
+		return s[:len(s)-1]
+	}
+	return s
+}
@@ -0,0 +1,155 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kanon1343/fsegit/sha"
+)
+
+// 書いたpkt-lineとflush-pktがそのまま読めるか
+func TestPacketRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	WritePacketString(&buf, "hello\n")
+	WriteFlush(&buf)
+	WritePacket(&buf, []byte{})
+	if buf.String() != "000ahello\n00000004" {
+		t.Fatalf("written packets = %q", buf.String())
+	}
+
+	pr := NewPacketReader(&buf)
+	if data, flush, err := pr.ReadPacket(); err != nil || flush || string(data) != "hello\n" {
+		t.Errorf("ReadPacket() = %q, %t, %v", data, flush, err)
+	}
+	if _, flush, err := pr.ReadPacket(); err != nil || !flush {
+		t.Errorf("ReadPacket() flush = %t, %v", flush, err)
+	}
+	if data, flush, err := pr.ReadPacket(); err != nil || flush || len(data) != 0 {
+		t.Errorf("ReadPacket() empty = %q, %t, %v", data, flush, err)
+	}
+	if _, _, err := NewPacketReader(strings.NewReader("0003")).ReadPacket(); !errors.Is(err, ErrInvalidPacket) {
+		t.Errorf("ReadPacket() with a bad length = %v", err)
+	}
+}
+
+// 参照の広告からケーパビリティと参照を読み、"^{}"の行をタグの指す先として読むか
+func TestReadAdvertisement(t *testing.T) {
+	var buf bytes.Buffer
+	hash1, hash2 := strings.Repeat("1", 40), strings.Repeat("2", 40)
+	WritePacketString(&buf, hash1+" HEAD\x00multi_ack side-band-64k symref=HEAD:refs/heads/main\n")
+	WritePacketString(&buf, hash1+" refs/heads/main\n")
+	WritePacketString(&buf, hash2+" refs/tags/v1\n")
+	WritePacketString(&buf, hash1+" refs/tags/v1^{}\n")
+	WriteFlush(&buf)
+
+	adv, err := readAdvertisement(NewPacketReader(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(adv.Refs) != 3 || adv.Refs[2].Name != "refs/tags/v1" || adv.Refs[2].Hash.String() != hash2 {
+		t.Errorf("Refs = %v", adv.Refs)
+	}
+	if adv.Refs[1].Peeled != nil || adv.Refs[2].Peeled.String() != hash1 {
+		t.Errorf("Peeled = %s, %s, want none and %s", adv.Refs[1].Peeled, adv.Refs[2].Peeled, hash1)
+	}
+	if !adv.Has("side-band-64k") || adv.Has("side-band") || !adv.Has("symref") {
+		t.Errorf("Capabilities = %v", adv.Capabilities)
+	}
+	if got := adv.Symref("HEAD"); got != "refs/heads/main" {
+		t.Errorf("Symref(HEAD) = %q", got)
+	}
+}
+
+// side-bandからデータだけを取り出し、進捗とエラーを振り分けるか
+func TestSidebandReader(t *testing.T) {
+	var buf bytes.Buffer
+	WritePacketString(&buf, "\x01PA")
+	WritePacketString(&buf, "\x02Counting objects\n")
+	WritePacketString(&buf, "\x01CK")
+	WriteFlush(&buf)
+	var progress bytes.Buffer
+	data, err := ioutil.ReadAll(&sidebandReader{pr: NewPacketReader(&buf), progress: &progress})
+	if err != nil || string(data) != "PACK" || progress.String() != "Counting objects\n" {
+		t.Errorf("sidebandReader read %q, progress %q, %v", data, progress.String(), err)
+	}
+
+	buf.Reset()
+	WritePacketString(&buf, "\x03access denied\n")
+	if _, err := ioutil.ReadAll(&sidebandReader{pr: NewPacketReader(&buf)}); !errors.Is(err, ErrRemote) || !strings.Contains(err.Error(), "access denied") {
+		t.Errorf("sidebandReader error = %v", err)
+	}
+}
+
+// 応答を待っている間にctxを取り消すと、すぐにctx.Err()を返すか
+func TestListRefsContext(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := NewRemote(server.URL).ListRefsContext(ctx, "git-upload-pack")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ListRefsContext() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("ListRefsContext() returned after %s", elapsed)
+	}
+}
+
+// 浅い履歴を要求するときにshallowとdeepenの行を送り、ACKかNAKの前の境界の変化を読めるか
+func TestFetchPackWithOptions_Shallow(t *testing.T) {
+	want := bytes.Repeat([]byte{0x11}, 20)
+	old := bytes.Repeat([]byte{0x22}, 20)
+	boundary := bytes.Repeat([]byte{0x33}, 20)
+	var request string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		request = string(body)
+		WritePacketString(w, "shallow "+hex.EncodeToString(boundary)+"\n")
+		WritePacketString(w, "unshallow "+hex.EncodeToString(old)+"\n")
+		WriteFlush(w)
+		WritePacketString(w, "NAK\n")
+		w.Write([]byte("PACKdata"))
+	}))
+	defer server.Close()
+
+	remote := NewRemote(server.URL)
+	adv := &Advertisement{Capabilities: []string{"shallow"}}
+	packData, update, err := remote.FetchPackWithOptions(context.Background(), adv, []sha.SHA1{want}, nil, FetchOptions{Depth: 2, Shallow: []sha.SHA1{old}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(packData)
+	packData.Close()
+	if err != nil || string(data) != "PACKdata" {
+		t.Errorf("pack data = %q, %v, want PACKdata", data, err)
+	}
+	for _, line := range []string{" shallow", "shallow " + hex.EncodeToString(old) + "\n", "deepen 2\n"} {
+		if !strings.Contains(request, line) {
+			t.Errorf("request %q does not contain %q", request, line)
+		}
+	}
+	if len(update.Shallow) != 1 || !bytes.Equal(update.Shallow[0], boundary) || len(update.Unshallow) != 1 || !bytes.Equal(update.Unshallow[0], old) {
+		t.Errorf("FetchPackWithOptions() update = %+v", update)
+	}
+
+	if _, _, err := remote.FetchPackWithOptions(context.Background(), &Advertisement{}, []sha.SHA1{want}, nil, FetchOptions{Depth: 1}); !errors.Is(err, ErrShallowUnsupported) {
+		t.Errorf("FetchPackWithOptions() without shallow capability error = %v, want %v", err, ErrShallowUnsupported)
+	}
+}
@@ -0,0 +1,541 @@
+// Package tuiは端末上で対話的に履歴を閲覧し、変更をファイルやhunkの単位でステージする.
+//
+// 端末を生モードにせず、1行ずつコマンドを読むので、どの端末やパイプでも動作する.
+package tui
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kanon1343/fsegit/diff"
+	"github.com/kanon1343/fsegit/graph"
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+)
+
+// DefaultPageSizeは1画面に表示するコミットの数.
+const DefaultPageSize = 20
+
+const help = `  l                  show the commit graph
+  n, p               show the next or previous page of the graph
+  <number>           show the commit and its diff
+  s                  list the staged, unstaged and untracked files
+  d <file>           show the diff of a listed file with numbered hunks
+  a <file> [<hunk>]  stage a listed file, or one of its hunks
+  r <file> [<hunk>]  unstage a listed file, or one of its hunks
+  h                  show this help
+  q                  quit
+`
+
+// Browserはコミットのグラフと各コミットの差分を表示し、作業ツリーの変更をステージする.
+type Browser struct {
+	client   *store.Client
+	in       *bufio.Scanner
+	out      io.Writer
+	PageSize int
+	// Contextは差分のhunkの前後に表示する行数.
+	Context int
+
+	commits []*object.Commit
+	rows    []graphRow
+	page    int
+	// filesは最後にsで表示したファイル. d、a、rの番号はこの一覧の番号.
+	files []fileEntry
+}
+
+// graphRowはグラフの中の1つのコミットの行と、その下に描く親へつなぐ線.
+type graphRow struct {
+	row        string
+	transition []string
+}
+
+// fileStateはファイルがstatusのどの一覧にあるか.
+type fileState int
+
+const (
+	staged fileState = iota
+	unstaged
+	untracked
+)
+
+// fileEntryはsで表示した1つのファイル. untrackedならchangeはPathだけを持つ.
+type fileEntry struct {
+	state  fileState
+	change store.TreeChange
+}
+
+// NewBrowserはinからコマンドを読み、outに表示するBrowserを返す.
+func NewBrowser(client *store.Client, in io.Reader, out io.Writer) *Browser {
+	return &Browser{
+		client:   client,
+		in:       bufio.NewScanner(in),
+		out:      out,
+		PageSize: DefaultPageSize,
+		Context:  diff.DefaultContext,
+	}
+}
+
+// Runはheadから辿れるコミットを読み込み、qが入力されるか入力が終わるまでコマンドを処理する.
+// headがnilならまだコミットがないものとして、ステージだけを扱う.
+func (b *Browser) Run(head sha.SHA1) error {
+	if b.PageSize <= 0 {
+		b.PageSize = DefaultPageSize
+	}
+	if err := b.load(head); err != nil {
+		return err
+	}
+
+	b.showLog()
+	for {
+		fmt.Fprint(b.out, "[h for help]> ")
+		if !b.in.Scan() {
+			fmt.Fprintln(b.out)
+			return b.in.Err()
+		}
+		fields := strings.Fields(b.in.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		var err error
+		switch fields[0] {
+		case "q":
+			return nil
+		case "h":
+			fmt.Fprint(b.out, help)
+		case "n":
+			if (b.page+1)*b.PageSize < len(b.commits) {
+				b.page++
+			}
+			b.showLog()
+		case "p":
+			if b.page > 0 {
+				b.page--
+			}
+			b.showLog()
+		case "l":
+			b.showLog()
+		case "s":
+			err = b.showStatus()
+		case "d", "a", "r":
+			err = b.fileCommand(fields[0], fields[1:])
+		default:
+			n, convErr := strconv.Atoi(fields[0])
+			if convErr != nil || n < 0 || n >= len(b.commits) || len(fields) > 1 {
+				fmt.Fprintf(b.out, "unknown command: %s\n", strings.Join(fields, " "))
+				continue
+			}
+			err = b.showCommit(b.commits[n])
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// loadはheadから辿れるコミットを、子が親より先になる順に読み込み、log --graphと同じグラフを組み立てる.
+func (b *Browser) load(head sha.SHA1) error {
+	b.commits, b.rows, b.page = nil, nil, 0
+	if head == nil {
+		return nil
+	}
+	g := &graph.Graph{}
+	return b.client.WalkHistoryWithOpts(head, store.WalkHistoryOpts{Order: store.WalkOrderTopo}, func(commit *object.Commit) error {
+		row, _, transition := g.Next(commit)
+		b.commits = append(b.commits, commit)
+		b.rows = append(b.rows, graphRow{row: row, transition: transition})
+		return nil
+	})
+}
+
+// showLogは現在のページのコミットを、グラフと共に1行ずつ表示する.
+func (b *Browser) showLog() {
+	if len(b.commits) == 0 {
+		fmt.Fprintln(b.out, "-- no commits yet --")
+		return
+	}
+	start := b.page * b.PageSize
+	end := start + b.PageSize
+	if end > len(b.commits) {
+		end = len(b.commits)
+	}
+	for i := start; i < end; i++ {
+		commit := b.commits[i]
+		fmt.Fprintf(b.out, "%4d %s %s %s (%s)\n", i, b.rows[i].row, commit.Hash.String()[:7], commit.Subject(), commit.Author.Name)
+		for _, line := range b.rows[i].transition {
+			fmt.Fprintf(b.out, "     %s\n", line)
+		}
+	}
+	fmt.Fprintf(b.out, "-- page %d/%d --\n", b.page+1, (len(b.commits)+b.PageSize-1)/b.PageSize)
+}
+
+// showCommitはコミットの内容と、最初の親からの差分を表示する.
+func (b *Browser) showCommit(commit *object.Commit) error {
+	fmt.Fprintln(b.out, commit)
+	fmt.Fprintln(b.out)
+
+	var parentTree sha.SHA1
+	if len(commit.Parents) > 0 {
+		parent, err := b.client.GetCommit(commit.Parents[0])
+		if err != nil {
+			return err
+		}
+		parentTree = parent.Tree
+	}
+	changes, err := b.client.DiffTrees(parentTree, commit.Tree, nil)
+	if err != nil {
+		return err
+	}
+	if changes, err = b.client.DetectRenames(changes, store.DefaultRenameThreshold); err != nil {
+		return err
+	}
+	for _, change := range changes {
+		oldPath := change.Path
+		if change.Type == store.ChangeRename {
+			oldPath = change.OldPath
+		}
+		file := diff.File{
+			OldPath:    oldPath,
+			NewPath:    change.Path,
+			OldMode:    change.OldMode,
+			NewMode:    change.NewMode,
+			OldHash:    change.OldHash,
+			NewHash:    change.NewHash,
+			Similarity: change.Similarity,
+		}
+		if file.Old, err = b.content(change.OldMode, change.OldHash); err != nil {
+			return err
+		}
+		if file.New, err = b.content(change.NewMode, change.NewHash); err != nil {
+			return err
+		}
+		if err := diff.WriteUnified(b.out, file, diff.Options{Context: b.Context}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// showStatusはステージした変更、ステージしていない変更、追跡していないファイルに番号を付けて表示する.
+func (b *Browser) showStatus() error {
+	status, err := b.client.Status()
+	if err != nil {
+		return err
+	}
+	b.files = nil
+	section := func(title string, state fileState, changes []store.TreeChange) {
+		if len(changes) == 0 {
+			return
+		}
+		fmt.Fprintln(b.out, title)
+		for _, change := range changes {
+			b.files = append(b.files, fileEntry{state: state, change: change})
+			if state == untracked {
+				fmt.Fprintf(b.out, "%4d %s\n", len(b.files), change.Path)
+				continue
+			}
+			fmt.Fprintf(b.out, "%4d %-9s %s\n", len(b.files), changeLabel(change.Type), change.Path)
+		}
+	}
+	section("Changes to be committed:", staged, status.Staged)
+	section("Changes not staged for commit:", unstaged, status.Unstaged)
+	var untrackedChanges []store.TreeChange
+	for _, path := range status.Untracked {
+		untrackedChanges = append(untrackedChanges, store.TreeChange{Type: store.ChangeAdd, Path: path})
+	}
+	section("Untracked files:", untracked, untrackedChanges)
+	if len(status.Unmerged) > 0 {
+		// コンフリクトの解決はここでは扱わない.
+		fmt.Fprintln(b.out, "Unmerged paths:")
+		for _, path := range status.Unmerged {
+			fmt.Fprintf(b.out, "     %s\n", path)
+		}
+	}
+	if len(b.files) == 0 && len(status.Unmerged) == 0 {
+		fmt.Fprintln(b.out, "nothing to commit, working tree clean")
+	}
+	return nil
+}
+
+func changeLabel(t store.ChangeType) string {
+	switch t {
+	case store.ChangeAdd:
+		return "new file:"
+	case store.ChangeDelete:
+		return "deleted:"
+	case store.ChangeRename:
+		return "renamed:"
+	default:
+		return "modified:"
+	}
+}
+
+// fileCommandはd、a、rのコマンドを処理する. argsは一覧のファイルの番号と、省略できるhunkの番号.
+func (b *Browser) fileCommand(command string, args []string) error {
+	if command == "d" && len(args) != 1 {
+		fmt.Fprintln(b.out, "usage: d <file>")
+		return nil
+	}
+	if len(args) == 0 || len(args) > 2 {
+		fmt.Fprintf(b.out, "usage: %s <file> [<hunk>]\n", command)
+		return nil
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 || n > len(b.files) {
+		fmt.Fprintf(b.out, "no such file: %s (s lists the files)\n", args[0])
+		return nil
+	}
+	entry := b.files[n-1]
+	hunk := 0
+	if len(args) == 2 {
+		if hunk, err = strconv.Atoi(args[1]); err != nil || hunk < 1 {
+			fmt.Fprintf(b.out, "no such hunk: %s\n", args[1])
+			return nil
+		}
+	}
+
+	switch command {
+	case "d":
+		return b.showFileDiff(entry)
+	case "a":
+		if entry.state == staged {
+			fmt.Fprintf(b.out, "%s is already staged\n", entry.change.Path)
+			return nil
+		}
+		if hunk == 0 {
+			err = b.stageFile(entry)
+		} else {
+			err = b.applyHunk(entry, hunk, false)
+		}
+	case "r":
+		if entry.state != staged {
+			fmt.Fprintf(b.out, "%s is not staged\n", entry.change.Path)
+			return nil
+		}
+		if hunk == 0 {
+			err = b.unstageFile(entry)
+		} else {
+			err = b.applyHunk(entry, hunk, true)
+		}
+	}
+	if errors.Is(err, errSkipped) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return b.showStatus()
+}
+
+// errSkippedはステージできない理由を表示済みで、一覧を表示し直さないことを表す.
+var errSkipped = errors.New("skipped")
+
+// showFileDiffはファイルの差分を、a、rで指定できるようにhunkに番号を付けて表示する.
+func (b *Browser) showFileDiff(entry fileEntry) error {
+	hunks, binary, err := b.fileHunks(entry)
+	if err != nil {
+		return err
+	}
+	change := entry.change
+	oldName, newName := "a/"+change.Path, "b/"+change.Path
+	if entry.state == untracked || change.Type == store.ChangeAdd {
+		oldName = "/dev/null"
+	}
+	if change.Type == store.ChangeDelete {
+		newName = "/dev/null"
+	}
+	fmt.Fprintf(b.out, "--- %s\n+++ %s\n", oldName, newName)
+	switch {
+	case binary:
+		fmt.Fprintln(b.out, "Binary files differ")
+	case len(hunks) == 0:
+		fmt.Fprintln(b.out, "no changes to the contents")
+	}
+	for i, hunk := range hunks {
+		fmt.Fprintf(b.out, "[%d] %s\n", i+1, hunk.Header())
+		for _, edit := range hunk.Edits {
+			fmt.Fprintf(b.out, "%c%s\n", " -+"[edit.Op], strings.TrimSuffix(edit.Text, "\n"))
+			if !strings.HasSuffix(edit.Text, "\n") {
+				fmt.Fprintln(b.out, "\\ No newline at end of file")
+			}
+		}
+	}
+	return nil
+}
+
+// fileHunksはファイルの変更前と変更後の内容の差分をhunkに分けて返す. どちらかがバイナリならbinaryを返す.
+// ステージした変更はHEADからインデックス、それ以外はインデックスから作業ツリーへの差分になる.
+func (b *Browser) fileHunks(entry fileEntry) (hunks []diff.Hunk, binary bool, err error) {
+	change := entry.change
+	if strings.HasSuffix(change.Path, "/") {
+		return nil, false, nil
+	}
+	old, err := b.content(change.OldMode, change.OldHash)
+	if err != nil {
+		return nil, false, err
+	}
+	var new []byte
+	switch {
+	case entry.state == staged:
+		new, err = b.content(change.NewMode, change.NewHash)
+	case change.Type != store.ChangeDelete:
+		new, err = b.worktreeContent(change.Path)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if diff.IsBinary(old) || diff.IsBinary(new) {
+		return nil, true, nil
+	}
+	return diff.Hunks(diff.Lines(diff.SplitLines(old), diff.SplitLines(new)), b.Context), false, nil
+}
+
+// stageFileは作業ツリーのファイルをそのままインデックスに登録する. 削除されたファイルはインデックスから除く.
+func (b *Browser) stageFile(entry fileEntry) error {
+	path := entry.change.Path
+	if strings.HasSuffix(path, "/") {
+		fmt.Fprintf(b.out, "%s is a directory; stage its files with fsegit add\n", path)
+		return errSkipped
+	}
+	if entry.change.NewMode == object.ModeGitlink || entry.change.OldMode == object.ModeGitlink {
+		fmt.Fprintf(b.out, "%s is a submodule; stage it with fsegit add\n", path)
+		return errSkipped
+	}
+	index, err := b.client.ReadIndex()
+	if err != nil {
+		return err
+	}
+	if entry.change.Type == store.ChangeDelete {
+		index.Remove(path)
+	} else {
+		info, err := os.Lstat(filepath.Join(b.client.WorkTree(), filepath.FromSlash(path)))
+		if err != nil {
+			return err
+		}
+		hash, err := b.client.WriteWorktreeBlob(path, info)
+		if err != nil {
+			return err
+		}
+		trustFileMode, err := b.client.TrustFileMode()
+		if err != nil {
+			return err
+		}
+		trustSymlinks, err := b.client.TrustSymlinks()
+		if err != nil {
+			return err
+		}
+		index.Add(store.NewIndexEntry(path, info, hash, index.Entry(path), trustFileMode, trustSymlinks))
+	}
+	if err := b.client.WriteIndex(index); err != nil {
+		return err
+	}
+	fmt.Fprintf(b.out, "staged %s\n", path)
+	return nil
+}
+
+// unstageFileはインデックスのファイルをHEADと同じ内容に戻す. HEADになければインデックスから除く.
+func (b *Browser) unstageFile(entry fileEntry) error {
+	change := entry.change
+	index, err := b.client.ReadIndex()
+	if err != nil {
+		return err
+	}
+	if change.Type == store.ChangeAdd {
+		index.Remove(change.Path)
+	} else {
+		index.Add(&store.IndexEntry{Mode: change.OldMode, Hash: change.OldHash, Path: change.Path})
+	}
+	if err := b.client.WriteIndex(index); err != nil {
+		return err
+	}
+	fmt.Fprintf(b.out, "unstaged %s\n", change.Path)
+	return nil
+}
+
+// applyHunkはファイルのn番目のhunkだけをインデックスに適用する. reverseなら、ステージしたhunkを
+// 逆向きに適用してHEADの内容に戻す. hunkで扱えるのは両方にある、バイナリでないファイルの変更だけ.
+func (b *Browser) applyHunk(entry fileEntry, n int, reverse bool) error {
+	change := entry.change
+	if entry.state == untracked || change.Type != store.ChangeModify || change.OldMode == object.ModeGitlink || change.NewMode == object.ModeGitlink {
+		fmt.Fprintf(b.out, "%s has no hunks to choose from; stage the whole file\n", change.Path)
+		return errSkipped
+	}
+	hunks, binary, err := b.fileHunks(entry)
+	if err != nil {
+		return err
+	}
+	if binary || n > len(hunks) {
+		fmt.Fprintf(b.out, "no such hunk: %d\n", n)
+		return errSkipped
+	}
+	hunk := hunks[n-1]
+	if reverse {
+		hunk = reverseHunk(hunk)
+	}
+	patch := &diff.FilePatch{OldPath: change.Path, NewPath: change.Path, Hunks: []diff.Hunk{hunk}}
+	err = b.client.Apply([]*diff.FilePatch{patch}, store.ApplyOptions{Cached: true})
+	if errors.Is(err, diff.ErrPatchFailed) {
+		fmt.Fprintln(b.out, err)
+		return errSkipped
+	}
+	if err != nil {
+		return err
+	}
+	verb := "staged"
+	if reverse {
+		verb = "unstaged"
+	}
+	fmt.Fprintf(b.out, "%s hunk %d of %s\n", verb, n, change.Path)
+	return nil
+}
+
+// reverseHunkは追加と削除を入れ替えた、hunkを取り消すhunkを返す.
+func reverseHunk(hunk diff.Hunk) diff.Hunk {
+	reversed := diff.Hunk{
+		OldStart: hunk.NewStart,
+		OldLines: hunk.NewLines,
+		NewStart: hunk.OldStart,
+		NewLines: hunk.OldLines,
+		Edits:    make([]diff.Edit, len(hunk.Edits)),
+	}
+	for i, edit := range hunk.Edits {
+		switch edit.Op {
+		case diff.Insert:
+			edit.Op = diff.Delete
+		case diff.Delete:
+			edit.Op = diff.Insert
+		}
+		reversed.Edits[i] = edit
+	}
+	return reversed
+}
+
+// contentはmodeとhashのエントリの内容を返す. modeが0なら空、サブモジュールならgitと同じ1行にする.
+func (b *Browser) content(mode object.FileMode, hash sha.SHA1) ([]byte, error) {
+	switch mode {
+	case 0:
+		return nil, nil
+	case object.ModeGitlink:
+		return []byte("Subproject commit " + hash.String() + "\n"), nil
+	}
+	obj, err := b.client.GetObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	return obj.Data, nil
+}
+
+// worktreeContentは作業ツリーのpathの内容を、インデックスに登録するときと同じ変換をして返す.
+func (b *Browser) worktreeContent(path string) ([]byte, error) {
+	info, err := os.Lstat(filepath.Join(b.client.WorkTree(), filepath.FromSlash(path)))
+	if err != nil {
+		return nil, err
+	}
+	return b.client.ReadWorktreeFile(path, info)
+}
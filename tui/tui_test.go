@@ -0,0 +1,195 @@
+package tui
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+)
+
+// numberedは1行目から20行目までの各行に行番号を書いた内容を返す. changedの行は"changed"にする.
+func numbered(changed ...int) string {
+	var buf strings.Builder
+	for i := 1; i <= 20; i++ {
+		line := fmt.Sprint(i)
+		for _, n := range changed {
+			if n == i {
+				line = "changed"
+			}
+		}
+		buf.WriteString(line + "\n")
+	}
+	return buf.String()
+}
+
+func storeCommit(t *testing.T, client *store.Client, files map[string]string, message string, when int, parents ...sha.SHA1) sha.SHA1 {
+	t.Helper()
+	var tree object.Tree
+	for name, content := range files {
+		blob, err := client.StoreRaw(object.BlobObject, []byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree.Entries = append(tree.Entries, object.TreeEntry{Mode: object.ModeBlob, Name: name, Hash: blob})
+	}
+	treeHash, err := client.StoreRaw(object.TreeObject, tree.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := fmt.Sprintf("tree %s\n", treeHash)
+	for _, parent := range parents {
+		data += fmt.Sprintf("parent %s\n", parent)
+	}
+	data += fmt.Sprintf("author fsegit <fsegit@example.com> %d +0900\ncommitter fsegit <fsegit@example.com> %d +0900\n\n%s\n", 1672531200+when, 1672531200+when, message)
+	hash, err := client.StoreRaw(object.CommitObject, []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+// テスト用に、2つに分かれてマージした履歴と、それを取り出した作業ツリーのあるリポジトリを作る.
+func newTestRepository(t *testing.T) (*store.Client, sha.SHA1) {
+	t.Helper()
+	dir := t.TempDir()
+	client, _, err := store.Init(dir, store.InitOptions{InitialBranch: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := storeCommit(t, client, map[string]string{"a.txt": numbered()}, "root", 0)
+	left := storeCommit(t, client, map[string]string{"a.txt": numbered(), "left.txt": "left\n"}, "left", 1, root)
+	right := storeCommit(t, client, map[string]string{"a.txt": numbered(), "right.txt": "right\n"}, "right", 2, root)
+	merge := storeCommit(t, client, map[string]string{"a.txt": numbered(), "left.txt": "left\n", "right.txt": "right\n"}, "merge", 3, left, right)
+	if err := client.WriteRef("refs/heads/main", merge); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"a.txt": numbered(), "left.txt": "left\n", "right.txt": "right\n"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := client.ResetIndex(merge); err != nil {
+		t.Fatal(err)
+	}
+	return client, merge
+}
+
+func run(t *testing.T, client *store.Client, head sha.SHA1, input string) string {
+	t.Helper()
+	var out bytes.Buffer
+	if err := NewBrowser(client, strings.NewReader(input), &out).Run(head); err != nil {
+		t.Fatalf("Run(%q) error = %v", input, err)
+	}
+	return out.String()
+}
+
+func indexContent(t *testing.T, client *store.Client, path string) string {
+	t.Helper()
+	index, err := client.ReadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := index.Entry(path)
+	if entry == nil {
+		return ""
+	}
+	obj, err := client.GetObject(entry.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(obj.Data)
+}
+
+func checkContains(t *testing.T, out string, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		if !strings.Contains(out, w) {
+			t.Errorf("output does not contain %q:\n%s", w, out)
+		}
+	}
+}
+
+// 履歴をグラフで表示し、コミットを開くと最初の親からの差分が出るか
+func TestBrowser_Log(t *testing.T) {
+	client, head := newTestRepository(t)
+	out := run(t, client, head, "0\nq\n")
+	checkContains(t, out,
+		"   0 * "+head.String()[:7]+" merge (fsegit)\n",
+		"     |\\\n",
+		"   3 * ",
+		"diff --git a/right.txt b/right.txt\n",
+		"+right\n",
+	)
+
+	if out := run(t, client, nil, "q\n"); !strings.Contains(out, "-- no commits yet --") {
+		t.Errorf("Run(nil) = %q", out)
+	}
+}
+
+// ファイル単位とhunk単位でステージし、ステージを取り消せるか
+func TestBrowser_Stage(t *testing.T) {
+	client, head := newTestRepository(t)
+	dir := client.WorkTree()
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte(numbered(2, 18)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "new.txt"), []byte("new\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := run(t, client, head, "s\nd 1\n")
+	checkContains(t, out,
+		"Changes not staged for commit:\n   1 modified: a.txt\n",
+		"Untracked files:\n   2 new.txt\n",
+		"[1] @@ -1,5 +1,5 @@\n 1\n-2\n+changed\n",
+		"[2] @@ -15,6 +15,6 @@\n",
+	)
+
+	// 2つ目のhunkだけをステージすると、同じファイルがステージした変更とステージしていない変更の両方に出る.
+	out = run(t, client, head, "s\na 1 2\n")
+	checkContains(t, out, "staged hunk 2 of a.txt\n", "Changes to be committed:\n   1 modified: a.txt\n", "Changes not staged for commit:\n   2 modified: a.txt\n")
+	if got := indexContent(t, client, "a.txt"); got != numbered(18) {
+		t.Errorf("index a.txt after staging hunk 2 = %q", got)
+	}
+
+	out = run(t, client, head, "s\nr 1 1\n")
+	checkContains(t, out, "unstaged hunk 1 of a.txt\n")
+	if got := indexContent(t, client, "a.txt"); got != numbered() {
+		t.Errorf("index a.txt after unstaging the hunk = %q", got)
+	}
+
+	out = run(t, client, head, "s\na 1\na 2\nr 2 1\n")
+	checkContains(t, out, "staged a.txt\n", "staged new.txt\n", "new.txt has no hunks to choose from; stage the whole file\n")
+	if got := indexContent(t, client, "a.txt"); got != numbered(2, 18) {
+		t.Errorf("index a.txt after staging the file = %q", got)
+	}
+	if got := indexContent(t, client, "new.txt"); got != "new\n" {
+		t.Errorf("index new.txt after staging the file = %q", got)
+	}
+
+	out = run(t, client, head, "s\nr 1\nr 1\nr 5\na 1 9\n")
+	checkContains(t, out, "unstaged a.txt\n", "unstaged new.txt\n", "no such file: 5 (s lists the files)\n", "no such hunk: 9\n")
+	if got := indexContent(t, client, "a.txt"); got != numbered() {
+		t.Errorf("index a.txt after unstaging the file = %q", got)
+	}
+	if got := indexContent(t, client, "new.txt"); got != "" {
+		t.Errorf("new.txt is still in the index: %q", got)
+	}
+
+	// 削除したファイルはファイル単位でステージすると、インデックスから除かれる.
+	if err := os.Remove(filepath.Join(dir, "left.txt")); err != nil {
+		t.Fatal(err)
+	}
+	out = run(t, client, head, "s\nd 2\na 2\n")
+	checkContains(t, out, "   2 deleted:  left.txt\n", "+++ /dev/null\n", "staged left.txt\n", "   1 deleted:  left.txt\n")
+	if got := indexContent(t, client, "left.txt"); got != "" {
+		t.Errorf("left.txt is still in the index: %q", got)
+	}
+}
@@ -3,13 +3,14 @@ package util
 import "io"
 
 // ReadNullTerminatedStringはio.Readerからヌル終端文字列を読み込んで返す.
+// ヌル文字が現れる前にデータが終わった場合はio.ErrUnexpectedEOFを返す.
 func ReadNullTerminatedString(r io.Reader) (string, error) {
 	str := make([]byte, 0)
+	c := make([]byte, 1)
 	for {
-		c := make([]byte, 1)
-		_, err := r.Read(c)
+		_, err := io.ReadFull(r, c)
 		if err == io.EOF {
-			break
+			return string(str), io.ErrUnexpectedEOF
 		}
 		if err != nil {
 			return string(str), err
@@ -0,0 +1,84 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// WriteFileViaRenameはdataを同じディレクトリの一時ファイルに書き込んでからnameにrenameする.
+// 書き込み途中のファイルが他のプロセスから見えることはない.
+func WriteFileViaRename(name string, data []byte, perm os.FileMode) error {
+	return writeFileViaRename(name, data, perm, false)
+}
+
+// WriteFileAtomicはWriteFileViaRenameに加えて、一時ファイルとディレクトリをfsyncする.
+// 途中でクラッシュしても、nameは古い内容か新しい内容のどちらかで、途中までしか書かれていない状態にはならない.
+func WriteFileAtomic(name string, data []byte, perm os.FileMode) error {
+	return writeFileViaRename(name, data, perm, true)
+}
+
+func writeFileViaRename(name string, data []byte, perm os.FileMode, durable bool) error {
+	name = LongPath(name)
+	tmp, err := ioutil.TempFile(filepath.Dir(name), ".tmp-"+filepath.Base(name)+"-")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if durable {
+		if err := tmp.Sync(); err != nil {
+			tmp.Close()
+			os.Remove(tmpName)
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := Rename(tmpName, name); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if durable {
+		return SyncDir(filepath.Dir(name))
+	}
+	return nil
+}
+
+// ProbeFileModeはdirに一時ファイルを作り、実行ビットの変更が保持されるかを調べる.
+// FAT32やWindowsのようにchmodが反映されないファイルシステムではfalseを返す.
+func ProbeFileMode(dir string) (bool, error) {
+	if !FileModeSupported {
+		return false, nil
+	}
+	f, err := ioutil.TempFile(dir, ".probe-filemode-")
+	if err != nil {
+		return false, err
+	}
+	name := f.Name()
+	f.Close()
+	defer os.Remove(name)
+
+	before, err := os.Stat(name)
+	if err != nil {
+		return false, err
+	}
+	if err := os.Chmod(name, before.Mode()^0100); err != nil {
+		return false, nil
+	}
+	after, err := os.Stat(name)
+	if err != nil {
+		return false, err
+	}
+	return before.Mode() != after.Mode(), nil
+}
@@ -0,0 +1,32 @@
+//go:build !windows
+// +build !windows
+
+package util
+
+import "os"
+
+// FileModeSupportedはファイルシステムが実行ビットを保持できるかを表す.
+const FileModeSupported = true
+
+// SymlinksSupportedはファイルシステムでシンボリックリンクを作れるかを表す.
+const SymlinksSupported = true
+
+// Renameはoldpathをnewpathに置き換える.
+func Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+// LongPathはWindows以外ではパスをそのまま返す.
+func LongPath(path string) string {
+	return path
+}
+
+// SyncDirはdirをfsyncして、直前のrenameやファイルの作成をディスクに反映させる.
+func SyncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,65 @@
+//go:build windows
+// +build windows
+
+package util
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// FileModeSupportedはファイルシステムが実行ビットを保持できるかを表す. Windowsでは保持できない.
+const FileModeSupported = false
+
+// SymlinksSupportedはファイルシステムでシンボリックリンクを作れるかを表す. Windowsでは管理者権限などが要るため作らない.
+const SymlinksSupported = false
+
+const (
+	errorAccessDenied     syscall.Errno = 5
+	errorSharingViolation syscall.Errno = 32
+)
+
+// Renameはoldpathをnewpathに置き換える.
+// Windowsではウイルス対策ソフトなどが一時的にファイルを開いていると失敗するので、しばらく再試行する.
+// 置き換え先が読み取り専用の場合は属性を外してから置き換える.
+func Rename(oldpath, newpath string) error {
+	oldpath, newpath = LongPath(oldpath), LongPath(newpath)
+	var err error
+	for wait := time.Millisecond; wait < time.Second; wait *= 2 {
+		if err = os.Rename(oldpath, newpath); err == nil {
+			return nil
+		}
+		var errno syscall.Errno
+		if !errors.As(err, &errno) || (errno != errorAccessDenied && errno != errorSharingViolation) {
+			return err
+		}
+		os.Chmod(newpath, 0644)
+		time.Sleep(wait)
+	}
+	return err
+}
+
+// LongPathはMAX_PATHを超える絶対パスに"\\?\"を付けて長いパスとして扱えるようにする.
+func LongPath(path string) string {
+	if len(path) < 248 || strings.HasPrefix(path, `\\?\`) {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		// UNCパスは"\\?\UNC\server\share"の形式にする.
+		return `\\?\UNC\` + abs[2:]
+	}
+	return `\\?\` + abs
+}
+
+// SyncDirはWindowsでは何もしない. ディレクトリをfsyncする方法がなく、renameはメタデータと一緒に記録される.
+func SyncDir(dir string) error {
+	return nil
+}
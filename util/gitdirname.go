@@ -0,0 +1,53 @@
+package util
+
+import "strings"
+
+// IsGitDirNameはパスの要素nameが、ファイルシステムが同じ名前として扱う違いを除くと管理ディレクトリの名前
+// (GitDirNames)になるかを返す. gitのverify_pathと同じく、大文字と小文字の違い、NTFSが無視する末尾の"."と空白と
+// 代替データストリームの":"以降、8.3形式の短い名前("GIT~1")、HFS+が無視するUnicodeの文字を考える.
+// Windowsでは"\"も区切りになるので、"\"で区切ったどの部分が当たってもtrueを返す.
+// ツリーやインデックスのパスにこれを許すと、チェックアウトで管理ディレクトリの設定やフックを書き換えられてしまう.
+func IsGitDirName(name string) bool {
+	for _, part := range strings.Split(name, "\\") {
+		if isGitDirName(part) {
+			return true
+		}
+	}
+	return false
+}
+
+func isGitDirName(name string) bool {
+	name = strings.Map(func(r rune) rune {
+		if hfsIgnorable(r) {
+			return -1
+		}
+		return r
+	}, name)
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		name = name[:i]
+	}
+	name = strings.ToLower(strings.TrimRight(name, ". "))
+	for _, dir := range GitDirNames {
+		if name == dir {
+			return true
+		}
+		// 8.3形式の短い名前は、先頭の"."を除いた名前の6文字までに"~"と数字を付けたもの.
+		short := dir[1:]
+		if len(short) > 6 {
+			short = short[:6]
+		}
+		if len(name) == len(short)+2 && strings.HasPrefix(name, short+"~") && name[len(name)-1] >= '1' && name[len(name)-1] <= '9' {
+			return true
+		}
+	}
+	return false
+}
+
+// hfsIgnorableはHFS+がファイル名を比べるときに無視する文字かを返す. gitのis_hfs_dotgitと同じ文字.
+func hfsIgnorable(r rune) bool {
+	switch {
+	case 0x200c <= r && r <= 0x200f, 0x202a <= r && r <= 0x202e, 0x206a <= r && r <= 0x206f, r == 0xfeff:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var ErrLocked = errors.New("file is locked")
+
+// LockFileはgitと同じ"<name>.lock"によるロック. ロックファイルに新しい内容を書き込み、
+// Commitでnameにrenameして置き換える. Rollbackすれば元のファイルは変わらない.
+type LockFile struct {
+	name string
+	file *os.File
+}
+
+// Lockはnameのロックを取る. 他のプロセスがロックしている場合はtimeoutまで再試行する.
+func Lock(name string, timeout time.Duration) (*LockFile, error) {
+	name = LongPath(name)
+	lockName := name + ".lock"
+	deadline := time.Now().Add(timeout)
+	wait := time.Millisecond
+	for {
+		f, err := os.OpenFile(lockName, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			return &LockFile{name: name, file: f}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if !time.Now().Before(deadline) {
+			return nil, fmt.Errorf("%w : %s", ErrLocked, lockName)
+		}
+		time.Sleep(wait)
+		if wait < 100*time.Millisecond {
+			wait *= 2
+		}
+	}
+}
+
+// Writeはロックファイルにdataを書き込む.
+func (l *LockFile) Write(data []byte) (int, error) {
+	return l.file.Write(data)
+}
+
+// Commitはロックファイルをfsyncしてnameにrenameし、ロックを解放する.
+func (l *LockFile) Commit() error {
+	lockName := l.file.Name()
+	if err := l.file.Sync(); err != nil {
+		l.Rollback()
+		return err
+	}
+	if err := l.file.Close(); err != nil {
+		os.Remove(lockName)
+		return err
+	}
+	if err := Rename(lockName, l.name); err != nil {
+		os.Remove(lockName)
+		return err
+	}
+	return SyncDir(filepath.Dir(l.name))
+}
+
+// Rollbackは書き込んだ内容を捨ててロックを解放する.
+func (l *LockFile) Rollback() error {
+	l.file.Close()
+	return os.Remove(l.file.Name())
+}
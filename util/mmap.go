@@ -0,0 +1,6 @@
+package util
+
+import "errors"
+
+// ErrMmapUnsupportedはファイルをメモリに割り当てられないことを表す.
+var ErrMmapUnsupported = errors.New("mmap is not supported")
@@ -0,0 +1,16 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package util
+
+import "os"
+
+// MmapはWindowsなどでは使えないので、常にErrMmapUnsupportedを返す.
+func Mmap(f *os.File, size int64) ([]byte, error) {
+	return nil, ErrMmapUnsupported
+}
+
+// Munmapは何もしない.
+func Munmap(data []byte) error {
+	return nil
+}
@@ -0,0 +1,28 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package util
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Mmapはfの先頭からsizeバイトを読み込み専用でメモリに割り当てる.
+// 割り当てられなければErrMmapUnsupportedを包んだエラーを返すので、呼び出し側は通常の読み込みに切り替える.
+func Mmap(f *os.File, size int64) ([]byte, error) {
+	if size <= 0 || int64(int(size)) != size {
+		return nil, ErrMmapUnsupported
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("%w : %s: %s", ErrMmapUnsupported, f.Name(), err)
+	}
+	return data, nil
+}
+
+// MunmapはMmapで割り当てたdataを解放する. 解放した後にdataを読んではならない.
+func Munmap(data []byte) error {
+	return syscall.Munmap(data)
+}
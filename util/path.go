@@ -2,30 +2,118 @@ package util
 
 import (
 	"errors"
-	"io/ioutil"
+	"os"
 	"path/filepath"
 )
 
 var ErrNotGitRepository = errors.New("not git repository")
 
-// pathで指定したリポジトリのルートディレクトリを返す
+// Repositoryはリポジトリの作業ツリーと管理ディレクトリ(.fsegitか.git)の場所を表す.
+// ベアリポジトリではWorkTreeが空になる.
+type Repository struct {
+	WorkTree string
+	GitDir   string
+}
+
+// GitDirNamesは作業ツリーの直下で管理ディレクトリとして探す名前. 先にあるものを優先する.
+var GitDirNames = []string{".fsegit", ".git"}
+
+// pathで指定したリポジトリのルートディレクトリを返す.
+// store.NewClientと同じく環境変数GIT_DIRとGIT_WORK_TREEがあれば探索せずにその場所を使い、
+// FSEGIT_DIR_NAMEがあればその名前の管理ディレクトリだけを探す.
+// configはこのパッケージに依存しているので設定fsegit.dirNameは読まない. 設定も考えるときはstore.NewClientを使う.
 func FindGitRoot(path string) (string, error) {
-	files, err := ioutil.ReadDir(path)
+	var names []string
+	if name := os.Getenv("FSEGIT_DIR_NAME"); name != "" {
+		names = []string{name}
+	}
+	repo, err := DiscoverRepository(path, os.Getenv("GIT_DIR"), os.Getenv("GIT_WORK_TREE"), names)
 	if err != nil {
 		return "", err
 	}
-	for _, file := range files {
-		if file.IsDir() && file.Name() == ".git" {
-			return path, nil
+	if repo.WorkTree == "" {
+		return repo.GitDir, nil
+	}
+	return repo.WorkTree, nil
+}
+
+// findRepositoryはpathから親ディレクトリへ遡って、namesの名前の管理ディレクトリを探す.
+// ディレクトリ自体が管理ディレクトリであればベアリポジトリとして作業ツリーを空にする.
+func findRepository(path string, names []string) (*Repository, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		for _, name := range names {
+			gitDir := filepath.Join(abs, name)
+			if info, err := os.Stat(gitDir); err == nil && info.IsDir() {
+				return &Repository{WorkTree: abs, GitDir: gitDir}, nil
+			}
+		}
+		if IsGitDir(abs) {
+			return &Repository{GitDir: abs}, nil
+		}
+		parent := filepath.Dir(abs)
+		if parent == abs {
+			return nil, ErrNotGitRepository
+		}
+		abs = parent
+	}
+}
+
+// IsGitDirはdirがHEAD、objects、refsを持つ管理ディレクトリかを判定する.
+func IsGitDir(dir string) bool {
+	if info, err := os.Stat(filepath.Join(dir, "HEAD")); err != nil || info.IsDir() {
+		return false
+	}
+	for _, name := range []string{"objects", "refs"} {
+		if info, err := os.Stat(filepath.Join(dir, name)); err != nil || !info.IsDir() {
+			return false
 		}
 	}
+	return true
+}
+
+// DiscoverRepositoryはpathからリポジトリを探す. 作業ツリーの直下ではnamesの名前の管理ディレクトリを
+// 先にあるものから探し、namesが空ならGitDirNamesを使う.
+// gitDirやworkTreeが指定された場合は探索せずにその場所を使う. gitDirだけが指定された場合はpathを作業ツリーとする.
+func DiscoverRepository(path, gitDir, workTree string, names []string) (*Repository, error) {
 	abs, err := filepath.Abs(path)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	if abs == "/" {
-		return "", ErrNotGitRepository
+
+	repo := &Repository{}
+	if gitDir != "" {
+		if repo.GitDir, err = absFrom(abs, gitDir); err != nil {
+			return nil, err
+		}
+		if info, err := os.Stat(repo.GitDir); err != nil || !info.IsDir() {
+			return nil, ErrNotGitRepository
+		}
+		repo.WorkTree = abs
+	} else {
+		if len(names) == 0 {
+			names = GitDirNames
+		}
+		if repo, err = findRepository(abs, names); err != nil {
+			return nil, err
+		}
 	}
 
-	return FindGitRoot(filepath.Join(path, "."))
+	if workTree != "" {
+		if repo.WorkTree, err = absFrom(abs, workTree); err != nil {
+			return nil, err
+		}
+	}
+	return repo, nil
+}
+
+// absFromはpathがbaseからの相対パスであれば絶対パスに変換する.
+func absFrom(base, path string) (string, error) {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path), nil
+	}
+	return filepath.Abs(filepath.Join(base, path))
 }
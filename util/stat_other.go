@@ -0,0 +1,12 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package util
+
+import "os"
+
+// StatIDsはインデックスに記録するファイルのデバイス番号、inode番号、所有者のuidとgidを返す.
+// Windowsなどこれらを持たないファイルシステムでは全て0を返し、gitと同じく比較に使わない.
+func StatIDs(info os.FileInfo) (dev, ino, uid, gid uint32) {
+	return 0, 0, 0, 0
+}
@@ -0,0 +1,19 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package util
+
+import (
+	"os"
+	"syscall"
+)
+
+// StatIDsはインデックスに記録するファイルのデバイス番号、inode番号、所有者のuidとgidを返す.
+// インデックスの形式に合わせて下位32ビットだけを使う.
+func StatIDs(info os.FileInfo) (dev, ino, uid, gid uint32) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, 0, 0
+	}
+	return uint32(st.Dev), uint32(st.Ino), uint32(st.Uid), uint32(st.Gid)
+}
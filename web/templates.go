@@ -0,0 +1,92 @@
+package web
+
+const layout = `
+{{define "header"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>fsegit</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+td { padding: 2px 12px 2px 0; vertical-align: top; }
+pre, code, .hash { font-family: monospace; }
+pre { background: #f6f8fa; padding: 1em; overflow: auto; }
+a { color: #0366d6; text-decoration: none; }
+.diff div { white-space: pre; }
+.diff .meta { font-weight: bold; }
+.diff .hunk { color: #6f42c1; }
+.diff .add { background: #e6ffed; }
+.diff .del { background: #ffeef0; }
+</style>
+</head>
+<body>
+<p><a href="/">refs</a> | <a href="/log/HEAD">log</a> | <a href="/tree/HEAD">tree</a></p>
+{{end}}
+
+{{define "footer"}}</body>
+</html>
+{{end}}
+
+{{define "refs"}}{{template "header"}}
+<h1>Refs</h1>
+<table>
+{{range .}}<tr><td><a href="/log/{{.Name}}">{{.Name}}</a></td><td class="hash"><a href="/commit/{{.Hash}}">{{short .Hash}}</a></td></tr>
+{{end}}</table>
+{{template "footer"}}{{end}}
+
+{{define "log"}}{{template "header"}}
+<h1>Log</h1>
+<table>
+{{range .}}<tr>
+<td class="hash"><a href="/commit/{{.Hash}}">{{short .Hash}}</a></td>
+<td>{{summary .Message}}</td>
+<td>{{.Author.Name}}</td>
+<td>{{date .Author}}</td>
+</tr>
+{{end}}</table>
+{{template "footer"}}{{end}}
+
+{{define "commit"}}{{template "header"}}
+{{with .Commit}}
+<h1>Commit <span class="hash">{{short .Hash}}</span></h1>
+<table>
+<tr><td>commit</td><td class="hash">{{.Hash}}</td></tr>
+<tr><td>tree</td><td class="hash"><a href="/tree/{{.Tree}}">{{.Tree}}</a></td></tr>
+{{range .Parents}}<tr><td>parent</td><td class="hash"><a href="/commit/{{.}}">{{.}}</a></td></tr>
+{{end}}<tr><td>author</td><td>{{.Author.Name}} &lt;{{.Author.Email}}&gt; {{date .Author}}</td></tr>
+<tr><td>committer</td><td>{{.Committer.Name}} &lt;{{.Committer.Email}}&gt; {{date .Committer}}</td></tr>
+</table>
+<pre>{{.Message}}</pre>
+{{end}}
+<h2>Changes</h2>
+<table>
+{{range .Changes}}<tr>
+<td>{{.Type}}</td>
+<td>{{if .OldPath}}{{.OldPath}} &rarr; {{end}}{{if .NewHash}}<a href="/blob/{{.NewHash}}">{{.Path}}</a>{{else}}{{.Path}}{{end}}</td>
+<td class="hash">{{if .OldHash}}<a href="/blob/{{.OldHash}}">{{short .OldHash}}</a>{{end}}</td>
+<td class="hash">{{if .NewHash}}<a href="/blob/{{.NewHash}}">{{short .NewHash}}</a>{{end}}</td>
+</tr>
+{{end}}</table>
+<h2>Diff</h2>
+{{range .Changes}}<pre class="diff">{{range .Diff}}<div class="{{.Class}}">{{.Text}}</div>{{end}}</pre>
+{{end}}
+{{template "footer"}}{{end}}
+
+{{define "tree"}}{{template "header"}}
+<h1>Tree <span class="hash">{{short .Hash}}</span></h1>
+<table>
+{{range .Entries}}<tr>
+<td class="hash">{{.Mode}}</td>
+<td>{{if .Mode.IsTree}}<a href="/tree/{{.Hash}}">{{.Name}}/</a>{{else if eq .Mode.ObjectType.String "blob"}}<a href="/blob/{{.Hash}}">{{.Name}}</a>{{else}}{{.Name}}{{end}}</td>
+<td class="hash">{{short .Hash}}</td>
+</tr>
+{{end}}</table>
+{{template "footer"}}{{end}}
+
+{{define "blob"}}{{template "header"}}
+<h1>Blob <span class="hash">{{short .Hash}}</span></h1>
+<p><a href="/blob/{{.Hash}}?raw=1">raw</a></p>
+{{if .Binary}}<p>binary file</p>{{else}}<pre>{{.Text}}</pre>{{end}}
+{{template "footer"}}{{end}}
+`
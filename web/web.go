@@ -0,0 +1,330 @@
+// Package webはリポジトリの履歴をブラウザで閲覧するためのHTTPハンドラを提供する.
+package web
+
+import (
+	"bytes"
+	"encoding/hex"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/kanon1343/fsegit/diff"
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+)
+
+// logLimitは1ページに表示するコミットの数.
+const logLimit = 100
+
+// Serverはリポジトリの内容をHTMLに描画するhttp.Handler.
+type Server struct {
+	client *store.Client
+	mux    *http.ServeMux
+}
+
+// NewServerはclientのリポジトリを閲覧するServerを返す.
+func NewServer(client *store.Client) *Server {
+	s := &Server{client: client, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/", s.handleRefs)
+	s.mux.HandleFunc("/log/", s.handleLog)
+	s.mux.HandleFunc("/commit/", s.handleCommit)
+	s.mux.HandleFunc("/tree/", s.handleTree)
+	s.mux.HandleFunc("/blob/", s.handleBlob)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+type refView struct {
+	Name string
+	Hash sha.SHA1
+}
+
+func (s *Server) handleRefs(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	refs, err := s.client.ListRefs("refs/")
+	if err != nil {
+		s.error(w, err)
+		return
+	}
+	var views []refView
+	if head, err := s.client.ResolveRef("HEAD"); err == nil {
+		views = append(views, refView{Name: "HEAD", Hash: head})
+	}
+	for _, ref := range refs {
+		views = append(views, refView{Name: ref.Name, Hash: ref.Hash})
+	}
+	s.render(w, "refs", views)
+}
+
+func (s *Server) handleLog(w http.ResponseWriter, r *http.Request) {
+	hash, err := s.resolve(strings.TrimPrefix(r.URL.Path, "/log/"))
+	if err != nil {
+		s.notFound(w, err)
+		return
+	}
+	hash, err = s.peelToCommit(hash)
+	if err != nil {
+		s.notFound(w, err)
+		return
+	}
+
+	var commits []*object.Commit
+	err = s.client.WalkHistory(hash, func(commit *object.Commit) error {
+		if len(commits) == logLimit {
+			return object.ErrStopWalk
+		}
+		commits = append(commits, commit)
+		return nil
+	})
+	if err != nil {
+		s.error(w, err)
+		return
+	}
+	s.render(w, "log", commits)
+}
+
+func (s *Server) handleCommit(w http.ResponseWriter, r *http.Request) {
+	hash, err := s.resolve(strings.TrimPrefix(r.URL.Path, "/commit/"))
+	if err != nil {
+		s.notFound(w, err)
+		return
+	}
+	if hash, err = s.peelToCommit(hash); err != nil {
+		s.notFound(w, err)
+		return
+	}
+	commit, err := s.commit(hash)
+	if err != nil {
+		s.notFound(w, err)
+		return
+	}
+	var parentTree sha.SHA1
+	if len(commit.Parents) > 0 {
+		parent, err := s.commit(commit.Parents[0])
+		if err != nil {
+			s.error(w, err)
+			return
+		}
+		parentTree = parent.Tree
+	}
+	changes, err := s.client.DiffTrees(parentTree, commit.Tree, nil)
+	if err != nil {
+		s.error(w, err)
+		return
+	}
+	if changes, err = s.client.DetectRenames(changes, store.DefaultRenameThreshold); err != nil {
+		s.error(w, err)
+		return
+	}
+	views := make([]changeView, 0, len(changes))
+	for _, change := range changes {
+		lines, err := s.diffLines(change)
+		if err != nil {
+			s.error(w, err)
+			return
+		}
+		views = append(views, changeView{TreeChange: change, Diff: lines})
+	}
+	s.render(w, "commit", struct {
+		Commit  *object.Commit
+		Changes []changeView
+	}{commit, views})
+}
+
+// changeViewはコミットのページに表示する1つのファイルの変更と、その差分の行.
+type changeView struct {
+	store.TreeChange
+	Diff []diffLine
+}
+
+// diffLineは差分の1行. Classは行の種類に応じたCSSのクラス.
+type diffLine struct {
+	Class string
+	Text  string
+}
+
+// diffLinesはchangeの変更前後の内容の差分を、gitと同じ形式で行ごとに分けて返す.
+func (s *Server) diffLines(change store.TreeChange) ([]diffLine, error) {
+	file := diff.File{
+		OldPath:    change.Path,
+		NewPath:    change.Path,
+		OldMode:    change.OldMode,
+		NewMode:    change.NewMode,
+		OldHash:    change.OldHash,
+		NewHash:    change.NewHash,
+		Similarity: change.Similarity,
+	}
+	if change.Type == store.ChangeRename {
+		file.OldPath = change.OldPath
+	}
+	var err error
+	if file.Old, err = s.content(change.OldMode, change.OldHash); err != nil {
+		return nil, err
+	}
+	if file.New, err = s.content(change.NewMode, change.NewHash); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := diff.WriteUnified(&buf, file, diff.Options{Context: 3}); err != nil {
+		return nil, err
+	}
+	var lines []diffLine
+	for _, text := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		class := ""
+		switch {
+		case strings.HasPrefix(text, "@@"):
+			class = "hunk"
+		case strings.HasPrefix(text, "+++"), strings.HasPrefix(text, "---"), strings.HasPrefix(text, "diff "):
+			class = "meta"
+		case strings.HasPrefix(text, "+"):
+			class = "add"
+		case strings.HasPrefix(text, "-"):
+			class = "del"
+		}
+		lines = append(lines, diffLine{Class: class, Text: text})
+	}
+	return lines, nil
+}
+
+// contentは差分を取るファイルの内容を返す. modeが0(存在しない側)なら空を返す.
+func (s *Server) content(mode object.FileMode, hash sha.SHA1) ([]byte, error) {
+	switch mode {
+	case 0:
+		return nil, nil
+	case object.ModeGitlink:
+		return []byte("Subproject commit " + hash.String() + "\n"), nil
+	}
+	obj, err := s.client.GetObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	return obj.Data, nil
+}
+
+func (s *Server) handleTree(w http.ResponseWriter, r *http.Request) {
+	hash, err := s.resolve(strings.TrimPrefix(r.URL.Path, "/tree/"))
+	if err != nil {
+		s.notFound(w, err)
+		return
+	}
+	if hash, err = s.peelToCommit(hash); err != nil {
+		s.notFound(w, err)
+		return
+	}
+	tree, err := s.client.GetTree(hash)
+	if err != nil {
+		s.notFound(w, err)
+		return
+	}
+	s.render(w, "tree", tree)
+}
+
+func (s *Server) handleBlob(w http.ResponseWriter, r *http.Request) {
+	hash, err := hex.DecodeString(strings.TrimPrefix(r.URL.Path, "/blob/"))
+	if err != nil || len(hash) != 20 {
+		http.Error(w, "invalid object name", http.StatusBadRequest)
+		return
+	}
+	obj, err := s.client.GetObject(hash)
+	if err != nil || obj.Type != object.BlobObject {
+		s.notFound(w, err)
+		return
+	}
+	if r.URL.Query().Get("raw") != "" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(obj.Data)
+		return
+	}
+	s.render(w, "blob", struct {
+		Hash   sha.SHA1
+		Binary bool
+		Text   string
+	}{obj.Hash, bytes.IndexByte(obj.Data, 0) >= 0, string(obj.Data)})
+}
+
+// resolveは40桁のハッシュか参照名をハッシュに変換する.
+func (s *Server) resolve(name string) (sha.SHA1, error) {
+	if name == "" {
+		name = "HEAD"
+	}
+	if len(name) == 40 {
+		if hash, err := hex.DecodeString(name); err == nil {
+			return hash, nil
+		}
+	}
+	fullName, err := s.client.DWIMRef(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.client.ResolveRef(fullName)
+}
+
+func (s *Server) commit(hash sha.SHA1) (*object.Commit, error) {
+	obj, err := s.client.GetObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	return object.NewCommit(obj)
+}
+
+// peelToCommitはタグを辿ってタグ以外のオブジェクトのハッシュを返す.
+func (s *Server) peelToCommit(hash sha.SHA1) (sha.SHA1, error) {
+	for {
+		obj, err := s.client.GetObject(hash)
+		if err != nil {
+			return nil, err
+		}
+		if obj.Type != object.TagObject {
+			return hash, nil
+		}
+		tag, err := object.NewTag(obj)
+		if err != nil {
+			return nil, err
+		}
+		hash = tag.Object
+	}
+}
+
+func (s *Server) render(w http.ResponseWriter, name string, data interface{}) {
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, name, data); err != nil {
+		s.error(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+func (s *Server) notFound(w http.ResponseWriter, err error) {
+	message := "not found"
+	if err != nil {
+		message = err.Error()
+	}
+	http.Error(w, message, http.StatusNotFound)
+}
+
+func (s *Server) error(w http.ResponseWriter, err error) {
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	"short": func(hash sha.SHA1) string {
+		if s := hash.String(); len(s) > 7 {
+			return s[:7]
+		}
+		return hash.String()
+	},
+	"summary": func(message string) string {
+		return strings.SplitN(message, "\n", 2)[0]
+	},
+	"date": func(sign object.Signature) string {
+		return sign.When.Format("2006-01-02 15:04:05 -0700")
+	},
+}).Parse(layout))
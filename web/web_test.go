@@ -0,0 +1,125 @@
+package web
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kanon1343/fsegit/object"
+	"github.com/kanon1343/fsegit/sha"
+	"github.com/kanon1343/fsegit/store"
+)
+
+// テスト用に、a.txtを変える2つのコミットと、2つ目を指す注釈付きタグv1のあるリポジトリを作る.
+func newTestServer(t *testing.T) (*Server, map[string]sha.SHA1) {
+	t.Helper()
+	client, _, err := store.Init(t.TempDir(), store.InitOptions{InitialBranch: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes := map[string]sha.SHA1{}
+	var parent sha.SHA1
+	for i, content := range []string{"one\ntwo\n", "one\n2\n"} {
+		blob, err := client.StoreRaw(object.BlobObject, []byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree := object.Tree{Entries: []object.TreeEntry{{Mode: object.ModeBlob, Name: "a.txt", Hash: blob}}}
+		treeHash, err := client.StoreRaw(object.TreeObject, tree.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := fmt.Sprintf("tree %s\n", treeHash)
+		if parent != nil {
+			data += fmt.Sprintf("parent %s\n", parent)
+		}
+		data += fmt.Sprintf("author fsegit <fsegit@example.com> %d +0900\ncommitter fsegit <fsegit@example.com> %d +0900\n\ncommit %d\n", 1672531200+i, 1672531200+i, i+1)
+		if parent, err = client.StoreRaw(object.CommitObject, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+		hashes[fmt.Sprintf("blob%d", i+1)] = blob
+		hashes[fmt.Sprintf("commit%d", i+1)] = parent
+	}
+	if err := client.WriteRef("refs/heads/main", parent); err != nil {
+		t.Fatal(err)
+	}
+	tagger := object.Signature{Name: "fsegit", Email: "fsegit@example.com", When: time.Unix(1672531200, 0)}
+	if hashes["tag"], _, err = client.CreateAnnotatedTag("v1", parent, tagger, "release\n", false); err != nil {
+		t.Fatal(err)
+	}
+	return NewServer(client), hashes
+}
+
+func get(t *testing.T, s *Server, path string) (int, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	body, err := ioutil.ReadAll(rec.Result().Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code, string(body)
+}
+
+// 各ページが表示され、コミットのページに差分が出るか. 注釈付きタグはコミットまで辿るか
+func TestServer(t *testing.T) {
+	s, hashes := newTestServer(t)
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"/", []string{"refs/heads/main", "refs/tags/v1", "HEAD"}},
+		{"/log/main", []string{"commit 2", "commit 1"}},
+		{"/commit/" + hashes["commit2"].String(), []string{"commit 2", `<div class="del">-two</div>`, `<div class="add">&#43;2</div>`, `<div class="hunk">@@ -1,2 &#43;1,2 @@</div>`}},
+		{"/commit/v1", []string{hashes["commit2"].String(), `<div class="add">&#43;2</div>`}},
+		{"/commit/" + hashes["commit1"].String(), []string{`<div class="add">&#43;one</div>`, "new file mode 100644"}},
+		{"/tree/main", []string{"a.txt", hashes["blob2"].String()[:7]}},
+		{"/blob/" + hashes["blob1"].String(), []string{"one\ntwo\n"}},
+	}
+	for _, tt := range tests {
+		code, body := get(t, s, tt.path)
+		if code != http.StatusOK {
+			t.Errorf("GET %s = %d, want 200: %s", tt.path, code, body)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(body, want) {
+				t.Errorf("GET %s does not contain %q:\n%s", tt.path, want, body)
+			}
+		}
+	}
+	if code, body := get(t, s, "/blob/"+hashes["blob2"].String()+"?raw=1"); code != http.StatusOK || body != "one\n2\n" {
+		t.Errorf("GET raw blob = %d, %q", code, body)
+	}
+}
+
+// 不正なハッシュや存在しないオブジェクトでpanicせず、400か404を返すか
+func TestServer_BadRequests(t *testing.T) {
+	s, hashes := newTestServer(t)
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/blob/", http.StatusBadRequest},
+		{"/blob/zz", http.StatusBadRequest},
+		{"/blob/abcd", http.StatusBadRequest},
+		{"/blob/" + strings.Repeat("ab", 21), http.StatusBadRequest},
+		{"/blob/" + strings.Repeat("ab", 20), http.StatusNotFound},
+		{"/blob/" + hashes["commit1"].String(), http.StatusNotFound},
+		{"/commit/" + strings.Repeat("ab", 20), http.StatusNotFound},
+		{"/commit/" + hashes["blob1"].String(), http.StatusNotFound},
+		{"/commit/nosuchref", http.StatusNotFound},
+		{"/tree/nosuchref", http.StatusNotFound},
+		{"/log/nosuchref", http.StatusNotFound},
+		{"/nosuchpage", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if code, body := get(t, s, tt.path); code != tt.code {
+			t.Errorf("GET %s = %d, want %d: %s", tt.path, code, tt.code, body)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+// Package wildmatchはgitのwildmatch.cと同じ規則でグロブパターンを照合する.
+// ignoreルール、属性、refspec、パススペックなどgitと同じマッチングが必要な箇所で使う.
+package wildmatch
+
+// Flagは照合の挙動を切り替える.
+type Flag uint
+
+const (
+	// CaseFoldは大文字と小文字を区別せずに照合する.
+	CaseFold Flag = 1 << iota
+	// Pathnameを指定すると"*"と"?"は"/"にマッチせず、"**"だけがディレクトリをまたぐ.
+	Pathname
+)
+
+const (
+	wmMatch = iota
+	wmNoMatch
+	wmAbortAll
+	wmAbortToStarStar
+)
+
+// Matchはnameがpatternにマッチするかを返す.
+func Match(pattern, name string, flags Flag) bool {
+	return dowild([]byte(pattern), []byte(name), flags) == wmMatch
+}
+
+// dowildはwildmatch.cのdowild()をそのまま移植したもの.
+func dowild(p, text []byte, flags Flag) int {
+	pi, ti := 0, 0
+	for ; pi < len(p); pi, ti = pi+1, ti+1 {
+		pCh := p[pi]
+		tCh := at(text, ti)
+		if tCh == 0 && pCh != '*' {
+			return wmAbortAll
+		}
+		if flags&CaseFold != 0 {
+			tCh = toLower(tCh)
+			pCh = toLower(pCh)
+		}
+
+		switch pCh {
+		case '\\':
+			// 次の1文字をそのまま照合する.
+			pi++
+			if at(p, pi) != tCh {
+				return wmNoMatch
+			}
+		case '?':
+			// "/"以外の任意の1文字.
+			if flags&Pathname != 0 && tCh == '/' {
+				return wmNoMatch
+			}
+		case '*':
+			var matchSlash bool
+			pi++
+			if at(p, pi) == '*' {
+				prevP := pi - 2
+				for {
+					pi++
+					if at(p, pi) != '*' {
+						break
+					}
+				}
+				if flags&Pathname == 0 {
+					// Pathnameを指定しない場合"*"は"**"と同じ.
+					matchSlash = true
+				} else if (prevP < 0 || p[prevP] == '/') &&
+					(at(p, pi) == 0 || at(p, pi) == '/' || (at(p, pi) == '\\' && at(p, pi+1) == '/')) {
+					// "foo/**/bar"が"foo/bar"にもマッチするように、"**/"が何にもマッチしない場合を先に試す.
+					if at(p, pi) == '/' && dowild(p[pi+1:], text[ti:], flags) == wmMatch {
+						return wmMatch
+					}
+					matchSlash = true
+				} else {
+					matchSlash = false
+				}
+			} else {
+				// Pathnameを指定しない場合"*"は"**"と同じ.
+				matchSlash = flags&Pathname == 0
+			}
+
+			if at(p, pi) == 0 {
+				// 末尾の"**"は全てにマッチし、末尾の"*"は"/"を含まない場合のみマッチする.
+				if !matchSlash && indexByte(text[ti:], '/') >= 0 {
+					return wmNoMatch
+				}
+				return wmMatch
+			}
+			if !matchSlash && at(p, pi) == '/' {
+				// "*/"は次のディレクトリまでにマッチする.
+				slash := indexByte(text[ti:], '/')
+				if slash < 0 {
+					return wmNoMatch
+				}
+				ti += slash
+				// "/"はループの末尾で読み進める.
+				continue
+			}
+			for {
+				if tCh == 0 {
+					break
+				}
+				// "*"の後がリテラルなら、その文字が現れるまでは"*"にマッチするとみなして読み飛ばす.
+				if !isGlobSpecial(at(p, pi)) {
+					pc := at(p, pi)
+					if flags&CaseFold != 0 {
+						pc = toLower(pc)
+					}
+					for {
+						tCh = at(text, ti)
+						if tCh == 0 || (!matchSlash && tCh == '/') {
+							break
+						}
+						if flags&CaseFold != 0 {
+							tCh = toLower(tCh)
+						}
+						if tCh == pc {
+							break
+						}
+						ti++
+					}
+					if tCh != pc {
+						return wmNoMatch
+					}
+				}
+				if matched := dowild(p[pi:], text[ti:], flags); matched != wmNoMatch {
+					if !matchSlash || matched != wmAbortToStarStar {
+						return matched
+					}
+				} else if !matchSlash && tCh == '/' {
+					return wmAbortToStarStar
+				}
+				ti++
+				tCh = at(text, ti)
+			}
+			return wmAbortAll
+		case '[':
+			pi++
+			pCh = at(p, pi)
+			if pCh == '^' {
+				pCh = '!'
+			}
+			negated := pCh == '!'
+			if negated {
+				pi++
+				pCh = at(p, pi)
+			}
+			var prevCh byte
+			matched := false
+			for {
+				if pCh == 0 {
+					return wmAbortAll
+				}
+				if pCh == '\\' {
+					pi++
+					pCh = at(p, pi)
+					if pCh == 0 {
+						return wmAbortAll
+					}
+					if tCh == pCh {
+						matched = true
+					}
+				} else if pCh == '-' && prevCh != 0 && at(p, pi+1) != 0 && at(p, pi+1) != ']' {
+					pi++
+					pCh = at(p, pi)
+					if pCh == '\\' {
+						pi++
+						pCh = at(p, pi)
+						if pCh == 0 {
+							return wmAbortAll
+						}
+					}
+					if tCh <= pCh && tCh >= prevCh {
+						matched = true
+					} else if flags&CaseFold != 0 && isLower(tCh) {
+						upper := toUpper(tCh)
+						if upper <= pCh && upper >= prevCh {
+							matched = true
+						}
+					}
+					pCh = 0
+				} else if pCh == '[' && at(p, pi+1) == ':' {
+					pi += 2
+					s := pi
+					for {
+						pCh = at(p, pi)
+						if pCh == 0 || pCh == ']' {
+							break
+						}
+						pi++
+					}
+					if pCh == 0 {
+						return wmAbortAll
+					}
+					if n := pi - s - 1; n < 0 || p[pi-1] != ':' {
+						// ":]"で閉じていなければ通常の文字として扱う.
+						pi = s - 2
+						pCh = '['
+						if tCh == pCh {
+							matched = true
+						}
+					} else {
+						ok, valid := matchClass(string(p[s:s+n]), tCh, flags)
+						if !valid {
+							return wmAbortAll
+						}
+						if ok {
+							matched = true
+						}
+						pCh = 0
+					}
+				} else if tCh == pCh {
+					matched = true
+				}
+
+				prevCh = pCh
+				pi++
+				pCh = at(p, pi)
+				if pCh == ']' {
+					break
+				}
+			}
+			if matched == negated || (flags&Pathname != 0 && tCh == '/') {
+				return wmNoMatch
+			}
+		default:
+			if tCh != pCh {
+				return wmNoMatch
+			}
+		}
+	}
+
+	if ti < len(text) {
+		return wmNoMatch
+	}
+	return wmMatch
+}
+
+// matchClassは"[:alpha:]"などの文字クラスにcがマッチするかを返す. 2つ目の戻り値はクラス名が正しいか.
+func matchClass(class string, c byte, flags Flag) (bool, bool) {
+	switch class {
+	case "alnum":
+		return isAlpha(c) || isDigit(c), true
+	case "alpha":
+		return isAlpha(c), true
+	case "blank":
+		return c == ' ' || c == '\t', true
+	case "cntrl":
+		return c < 0x20 || c == 0x7f, true
+	case "digit":
+		return isDigit(c), true
+	case "graph":
+		return c > 0x20 && c < 0x7f, true
+	case "lower":
+		return isLower(c), true
+	case "print":
+		return c >= 0x20 && c < 0x7f, true
+	case "punct":
+		return c > 0x20 && c < 0x7f && !isAlpha(c) && !isDigit(c), true
+	case "space":
+		return c == ' ' || (c >= '\t' && c <= '\r'), true
+	case "upper":
+		return isUpper(c) || (flags&CaseFold != 0 && isLower(c)), true
+	case "xdigit":
+		return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F'), true
+	}
+	return false, false
+}
+
+func at(s []byte, i int) byte {
+	if i < 0 || i >= len(s) {
+		return 0
+	}
+	return s[i]
+}
+
+func indexByte(s []byte, c byte) int {
+	for i, b := range s {
+		if b == c {
+			return i
+		}
+	}
+	return -1
+}
+
+func isGlobSpecial(c byte) bool {
+	return c == '*' || c == '?' || c == '[' || c == '\\'
+}
+
+func isUpper(c byte) bool { return c >= 'A' && c <= 'Z' }
+func isLower(c byte) bool { return c >= 'a' && c <= 'z' }
+func isAlpha(c byte) bool { return isUpper(c) || isLower(c) }
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func toLower(c byte) byte {
+	if isUpper(c) {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+func toUpper(c byte) byte {
+	if isLower(c) {
+		return c - ('a' - 'A')
+	}
+	return c
+}
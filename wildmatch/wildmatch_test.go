@@ -0,0 +1,106 @@
+package wildmatch
+
+import "testing"
+
+// gitのt3070-wildmatch.shから抜粋したケース.
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		text     string
+		pathname bool // Pathnameを指定した場合の結果
+		plain    bool // フラグなしの場合の結果
+	}{
+		{"foo", "foo", true, true},
+		{"bar", "foo", false, false},
+		{"???", "foo", true, true},
+		{"??", "foo", false, false},
+		{"*", "foo", true, true},
+		{"f*", "foo", true, true},
+		{"*f", "foo", false, false},
+		{"*foo*", "foo", true, true},
+		{"*ob*a*r*", "foobar", true, true},
+		{"*ab", "aaaaaaabababab", true, true},
+		{"foo\\*", "foo*", true, true},
+		{"foo\\*bar", "foobar", false, false},
+		{"f\\\\oo", "f\\oo", true, true},
+		{"*[al]?", "ball", true, true},
+		{"[ten]", "ten", false, false},
+		{"**[!te]", "ten", true, true},
+		{"**[!ten]", "ten", false, false},
+		{"t[a-g]n", "ten", true, true},
+		{"t[!a-g]n", "ten", false, false},
+		{"t[!a-g]n", "ton", true, true},
+		{"t[^a-g]n", "ton", true, true},
+		{"a[]]b", "a]b", true, true},
+		{"a[]-]b", "a-b", true, true},
+		{"a[]a-]b", "aab", true, true},
+		{"]", "]", true, true},
+		{"foo*bar", "foo/baz/bar", false, true},
+		{"foo**bar", "foo/baz/bar", false, true},
+		{"foo/*/bar", "foo/baz/bar", true, true},
+		{"foo/**/bar", "foo/baz/bar", true, true},
+		{"foo/**/bar", "foo/b/a/z/bar", true, true},
+		{"foo/**/bar", "foo/bar", true, false},
+		{"foo/**/**/bar", "foo/b/a/z/bar", true, true},
+		{"foo?bar", "foo/bar", false, true},
+		{"foo[/]bar", "foo/bar", false, true},
+		{"f[^eiu][^eiu][^eiu][^eiu][^eiu]r", "foo-bar", true, true},
+		{"**/foo", "foo", true, false},
+		{"**/foo", "XXX/foo", true, true},
+		{"**/foo", "bar/baz/foo", true, true},
+		{"*/foo", "bar/baz/foo", false, true},
+		{"**/bar*", "foo/bar/baz", false, true},
+		{"**/bar/*", "deep/foo/bar/baz", true, true},
+		{"**/bar/*", "deep/foo/bar/baz/", false, true},
+		{"**/bar/**", "deep/foo/bar/baz/", true, true},
+		{"**/bar/*", "deep/foo/bar", false, false},
+		{"**/bar/**", "deep/foo/bar/", true, true},
+		{"*/bar/**", "foo/bar/baz/x", true, true},
+		{"*/bar/**", "deep/foo/bar/baz/x", false, true},
+		{"**/bar/*/*", "deep/foo/bar/baz/x", true, true},
+		{"[[:alpha:]][[:digit:]][[:upper:]]", "a1B", true, true},
+		{"[[:digit:][:upper:][:space:]]", "a", false, false},
+		{"[[:digit:][:upper:][:space:]]", "A", true, true},
+		{"[[:xdigit:]]", "5", true, true},
+		{"[a-c[:digit:]x-z]", "5", true, true},
+		{"[a-c[:digit:]x-z]", "q", false, false},
+		{"*/*/*", "foo/bba/arr", true, true},
+		{"*/*/*", "foo/bb/aa/rr", false, true},
+		{"**/**/**", "foo/bb/aa/rr", true, true},
+		{"*X*i", "abcXdefXghi", true, true},
+		{"*/*X*/*/*i", "ab/cXd/efXg/hi", true, true},
+		{"**/*X*/**/*i", "ab/cXd/efXg/hi", true, true},
+		{"-*-*-*-*-*-*-12-*-*-*-m-*-*-*", "-adobe-courier-bold-o-normal--12-120-75-75-m-70-iso8859-1", true, true},
+		{"XXX/*/*/*/*/*/*/12/*/*/*/m/*/*/*", "XXX/adobe/courier/bold/o/normal//12/120/75/75/X/70/iso8859/1", false, false},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.text, Pathname); got != tt.pathname {
+			t.Errorf("Match(%q, %q, Pathname) = %v, want %v", tt.pattern, tt.text, got, tt.pathname)
+		}
+		if got := Match(tt.pattern, tt.text, 0); got != tt.plain {
+			t.Errorf("Match(%q, %q, 0) = %v, want %v", tt.pattern, tt.text, got, tt.plain)
+		}
+	}
+}
+
+func TestMatch_CaseFold(t *testing.T) {
+	tests := []struct {
+		pattern string
+		text    string
+		want    bool
+	}{
+		{"[A-Z]", "a", true},
+		{"[a-z]", "A", true},
+		{"[[:upper:]]", "a", true},
+		{"FOO/*", "foo/bar", true},
+		{"foo", "FOO", true},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.text, CaseFold|Pathname); got != tt.want {
+			t.Errorf("Match(%q, %q, CaseFold) = %v, want %v", tt.pattern, tt.text, got, tt.want)
+		}
+		if Match(tt.pattern, tt.text, Pathname) {
+			t.Errorf("Match(%q, %q) should not match without CaseFold", tt.pattern, tt.text)
+		}
+	}
+}